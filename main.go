@@ -1,111 +1,1084 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
 )
 
+// exitInterrupted is the exit status when a run is stopped by SIGINT or SIGTERM, following
+// the shell convention of 128 plus the signal number of SIGINT
+const exitInterrupted = 130
+
 func main() {
 	// Parse command line flags
-	configFile := flag.String("config", "aws-resources.yaml", "Path to configuration file")
+	configFile := flag.String("config", "aws-resources.yaml", "Configuration file, - for stdin, an http(s):// or s3://bucket/key URL, or a comma-separated list of them to merge")
 	dryRun := flag.Bool("dry-run", false, "Run in dry-run mode without making changes")
+	plan := flag.Bool("plan", false, "Compare the configuration with the resources in AWS and show what would change")
+	changesOnly := flag.Bool("changes-only", false, "With -plan, show only the resources that would be created or updated")
+	verify := flag.Bool("verify", false, "Check that the resources in AWS match the configuration without changing anything; exits non-zero on drift")
 	checkCreds := flag.Bool("check-creds", false, "Only check AWS credentials and exit")
+	destroy := flag.Bool("destroy", false, "Delete all resources defined in the configuration")
+	force := flag.Bool("force", false, "Skip the confirmation prompt for destructive operations, let -init overwrite an existing file, and make -incremental check every resource")
+	initConfig := flag.Bool("init", false, "Write a commented starter configuration to the -config path and exit")
+	printSchema := flag.Bool("print-schema", false, "Print a JSON Schema of the configuration file, for editor autocompletion and validation, and exit")
+	renderConfig := flag.Bool("render-config", false, "Print the effective configuration as YAML, after environment variables, merging, global tags, -wait, -only and -skip are applied, and exit")
+	showSecrets := flag.Bool("show-secrets", false, "Show passwords in the -render-config output instead of redacting them")
+	wait := flag.Bool("wait", false, "Wait for RDS instances to become available, or stopped with desired_state stopped, and print their endpoints")
+	timeout := flag.Duration("timeout", 0, "Overall deadline for the run, e.g. 30m (0 means no timeout)")
+	outputFormat := flag.String("output", "text", "Output format for provisioning results: text or json")
+	profile := flag.String("profile", "", "AWS shared config profile to use (overrides AWS_PROFILE)")
+	assumeRoleARN := flag.String("assume-role-arn", "", "ARN of an IAM role to assume for all AWS calls (overrides assume_role_arn)")
+	externalID := flag.String("external-id", "", "External ID to pass when assuming the role (overrides external_id)")
+	roleSessionName := flag.String("role-session-name", "", "Session name to use when assuming the role (overrides role_session_name)")
+	mfaSerial := flag.String("mfa-serial", "", "Serial number or ARN of the MFA device required by the role (overrides mfa_serial)")
+	mfaToken := flag.String("mfa-token", "", "6-digit MFA code; prompted for on stdin when -mfa-serial is set and this is empty")
+	retryMaxAttempts := flag.Int("retry-max-attempts", 0, "Maximum attempts per AWS call, including the first (overrides retry_max_attempts; default 3)")
+	retryMode := flag.String("retry-mode", "", "AWS retry mode: standard or adaptive (overrides retry_mode; default standard)")
+	iamRetryAttempts := flag.Int("iam-retry-attempts", 0, "Attempts for IAM calls that fail while a newly created user, group or policy propagates (default 5)")
+	iamRetryInterval := flag.Duration("iam-retry-interval", 0, "Wait before the first IAM propagation retry, doubling after each attempt (default 500ms)")
+	endpointURL := flag.String("endpoint-url", "", "Send all AWS calls to a custom endpoint such as LocalStack (overrides AWS_ENDPOINT_URL)")
+	only := flag.String("only", "", "Comma-separated resource types (s3, ecr, iam, iam_group, iam_user, rds, aurora, hosted_zone, certificate, lambda, vpc, key_pair, security_group, password_policy, eventbridge_rule) or type:name selectors to act on")
+	skip := flag.String("skip", "", "Comma-separated resource types or type:name selectors to leave untouched")
+	logLevel := flag.String("log-level", "info", "Minimum level of progress logs: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Format of progress logs written to stderr: text or json")
+	rollbackOnError := flag.Bool("rollback-on-error", false, "Delete the resources created by this run if provisioning fails")
+	continueOnError := flag.Bool("continue-on-error", false, "Keep provisioning the remaining resources when one fails, and report every failure at the end")
+	maxErrors := flag.Int("max-errors", 0, "With -continue-on-error, stop once more than this many resources have failed (default 0, no limit)")
+	prune := flag.Bool("prune", false, "Delete resources recorded in the state file that are no longer in the configuration")
+	credentialsOut := flag.String("credentials-out", "", "Write generated credentials, such as console passwords and private keys, to this file with owner-only permissions, as JSON if it ends in .json and YAML otherwise")
+	outputARNs := flag.String("output-arns", "", "Write the ARNs of the provisioned resources to this file, as JSON if it ends in .json and YAML otherwise")
+	statePath := flag.String("state", "", "Path to a JSON state file recording the resources managed by previous runs")
+	incremental := flag.Bool("incremental", false, "Skip resources whose configuration is unchanged since the last successful apply recorded in the -state file")
+	diffPolicy := flag.Bool("diff-policy", false, "Print a unified diff of every managed IAM policy document that changes")
+	pruneTags := flag.Bool("prune-tags", false, "Remove tags from existing resources that are not in the configuration")
+	importExisting := flag.Bool("import", false, "Adopt existing S3 buckets, ECR repositories and IAM users and groups: also remove the settings, tags and managed policies their configuration leaves out")
+	quiet := flag.Bool("quiet", false, "Only log warnings and errors, and skip informational output")
+	progressMode := flag.String("progress", "auto", "Progress of slow waits: auto (a spinner when stderr is a terminal and -log-format is text, log lines otherwise), plain (log lines) or off")
 	flag.Parse()
 
+	// Progress logs go to stderr so they never mix with results on stdout
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		log.Fatalf("Unknown log level %q: must be debug, info, warn or error", *logLevel)
+	}
+	if *quiet && level < slog.LevelWarn {
+		level = slog.LevelWarn
+	}
+	// The spinner shares stderr with the logs, so logs are written through it to keep
+	// records from breaking into the spinner line
+	var logOut io.Writer = os.Stderr
+	switch *progressMode {
+	case "auto":
+		if *logFormat == "text" && !*quiet && bootstrap.IsTerminal(os.Stderr) {
+			spinner := bootstrap.NewProgress(os.Stderr, true)
+			bootstrap.SetProgress(spinner)
+			logOut = spinner
+			log.SetOutput(spinner)
+		}
+	case "plain":
+	case "off":
+		bootstrap.SetProgress(nil)
+	default:
+		log.Fatalf("Unknown progress mode %q: must be auto, plain or off", *progressMode)
+	}
+	logger, err := bootstrap.NewLogger(logOut, *logFormat, level)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	bootstrap.SetLogger(logger)
+
+	// Scaffold a starter configuration instead of running
+	if *initConfig {
+		if *configFile == "-" || strings.Contains(*configFile, "://") {
+			log.Fatalf("-init needs a local -config path, got %q", *configFile)
+		}
+		if err := bootstrap.WriteStarterConfig(*configFile, *force); err != nil {
+			log.Fatalf("Failed to write starter configuration: %v", err)
+		}
+		fmt.Printf("Wrote starter configuration to %s\n", *configFile)
+		return
+	}
+	if *printSchema {
+		schema, err := bootstrap.ConfigSchema()
+		if err != nil {
+			log.Fatalf("Failed to generate configuration schema: %v", err)
+		}
+		fmt.Println(string(schema))
+		return
+	}
+
+	// In JSON mode only the results document is written to stdout
+	var out io.Writer = os.Stdout
+	switch *outputFormat {
+	case "text":
+		if *quiet {
+			out = io.Discard
+		}
+	case "json":
+		out = io.Discard
+	default:
+		log.Fatalf("Unknown output format %q: must be text or json", *outputFormat)
+	}
+
+	if *plan && *destroy {
+		log.Fatalf("-plan cannot be combined with -destroy")
+	}
+	if *verify && (*plan || *destroy || *prune || *dryRun) {
+		log.Fatalf("-verify cannot be combined with -plan, -destroy, -prune or -dry-run")
+	}
+	if *prune && (*plan || *destroy) {
+		log.Fatalf("-prune cannot be combined with -plan or -destroy")
+	}
+	if *prune && *statePath == "" {
+		log.Fatalf("-prune requires -state")
+	}
+	if *incremental && *statePath == "" {
+		log.Fatalf("-incremental requires -state")
+	}
+	if *incremental && (*plan || *verify || *destroy || *prune) {
+		log.Fatalf("-incremental cannot be combined with -plan, -verify, -destroy or -prune")
+	}
+	if *showSecrets && !*renderConfig {
+		log.Fatalf("-show-secrets requires -render-config")
+	}
+	if *changesOnly && !*plan {
+		log.Fatalf("-changes-only requires -plan")
+	}
+	if *maxErrors < 0 {
+		log.Fatalf("-max-errors must not be negative")
+	}
+	if *maxErrors > 0 && !*continueOnError {
+		log.Fatalf("-max-errors requires -continue-on-error")
+	}
+	// Pruning deletes resources just like -destroy, only a different set of them
+	deleting := *destroy || *prune
+
+	// Ctrl-C or SIGTERM cancels the context: the call in flight returns, no new resource is
+	// started, and the results gathered so far are still printed
+	// stop is only called once a signal arrives, so the context is never cancelled otherwise
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupted.Done()
+		// Restore the default handling so a second signal stops the process immediately
+		stop()
+		logger.Warn("Interrupt received, finishing the current operation; interrupt again to exit immediately")
+	}()
+
+	ctx := context.Context(interrupted)
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
 	// Load configuration
-	config, err := bootstrap.LoadConfig(*configFile)
+	// Remote configs in S3 are read with the profile and endpoint given on the command line
+	config, err := loadConfigs(ctx, *configFile, bootstrap.AWSOptions{Profile: *profile, EndpointURL: *endpointURL})
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// -wait applies to every RDS instance, in addition to per-instance wait_for_available
+	if *wait {
+		for i := range config.RDSInstances {
+			config.RDSInstances[i].WaitForAvailable = true
+		}
+	}
+
+	// Show the configuration a run would use instead of running; this comes before
+	// validation so an invalid configuration can be inspected too
+	if *renderConfig {
+		rendered, err := config.Filter(splitList(*only), splitList(*skip))
+		if err != nil {
+			log.Fatalf("Invalid resource filter: %v", err)
+		}
+		data, err := rendered.Render(*showSecrets)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+
+	// Catch configuration mistakes before making any AWS calls
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	// Load the state of earlier runs and report resources that were dropped from the config
+	var state *bootstrap.State
+	if *statePath != "" {
+		state, err = bootstrap.LoadState(*statePath)
+		if err != nil {
+			log.Fatalf("Failed to load state: %v", err)
+		}
+		for _, orphan := range state.Orphans(config) {
+			logger.Warn("Resource in the state file is no longer in the configuration",
+				"type", orphan.Type, "name", orphan.Name, "arn", orphan.ARN)
+		}
+	}
+
+	// When pruning, the resources to act on are the orphans rather than the configuration
+	var unprunable []bootstrap.StateResource
+	if *prune {
+		unprunable = state.UnprunableOrphans(config)
+		for _, orphan := range unprunable {
+			logger.Warn("Orphaned resource cannot be pruned; delete it by hand",
+				"type", orphan.Type, "name", orphan.Name, "arn", orphan.ARN)
+		}
+		config = state.OrphanedConfig(config)
+		if config.Empty() {
+			if len(unprunable) > 0 {
+				fmt.Fprintf(out, "No orphaned resources can be pruned; %d must be deleted by hand.\n", len(unprunable))
+			} else {
+				fmt.Fprintln(out, "No orphaned resources to prune.")
+			}
+			return
+		}
+	}
+
+	// Narrow the run to the selected resources
+	config, err = config.Filter(splitList(*only), splitList(*skip))
+	if err != nil {
+		log.Fatalf("Invalid resource filter: %v", err)
+	}
+
+	// Flags take precedence over the AWS settings in the config file
+	awsOptions := config.AWSOptions()
+	awsOptions.Profile = *profile
+	if *assumeRoleARN != "" {
+		awsOptions.AssumeRoleARN = *assumeRoleARN
+	}
+	if *externalID != "" {
+		awsOptions.ExternalID = *externalID
+	}
+	if *roleSessionName != "" {
+		awsOptions.RoleSessionName = *roleSessionName
+	}
+	if *mfaSerial != "" {
+		awsOptions.MFASerial = *mfaSerial
+	}
+	awsOptions.MFAToken = *mfaToken
+	if *retryMaxAttempts != 0 {
+		awsOptions.RetryMaxAttempts = *retryMaxAttempts
+	}
+	if *retryMode != "" {
+		awsOptions.RetryMode = *retryMode
+	}
+	awsOptions.EndpointURL = *endpointURL
+
 	// Check AWS credentials first
-	fmt.Println("Checking AWS credentials...")
-	fmt.Println(bootstrap.GetAWSProfileInfo())
+	fmt.Fprintln(out, "Checking AWS credentials...")
+	fmt.Fprintln(out, bootstrap.GetAWSProfileInfo(awsOptions))
 
-	arn, err := bootstrap.CheckAWSCredentials(context.Background(), config.Region)
+	// The bootstrapper's session is reused for the check so an MFA code is only asked for once
+	bootstrapper, err := bootstrap.NewBootstrapper(ctx, config.Region, awsOptions)
+	if err != nil {
+		log.Fatalf("Failed to initialize bootstrapper: %v\n\nPlease check your AWS credentials and region configuration.\nMake sure you have valid credentials in ~/.aws/credentials or environment variables.\n", err)
+	}
+
+	bootstrapper.SetPruneTags(*pruneTags || *importExisting)
+	bootstrapper.SetImport(*importExisting)
+	bootstrapper.SetIAMRetry(*iamRetryAttempts, *iamRetryInterval)
+	bootstrapper.SetContinueOnError(*continueOnError, *maxErrors)
+	bootstrapper.SetCredentialsOut(*credentialsOut)
+	if *incremental && !*force {
+		bootstrapper.SetIncremental(state.ConfigHashes())
+	}
+	if *diffPolicy {
+		// stdout is reserved for the results document in JSON mode
+		var diffOut io.Writer = os.Stdout
+		if *outputFormat == "json" {
+			diffOut = os.Stderr
+		}
+		bootstrapper.SetPolicyDiff(diffOut)
+	}
+
+	identity, err := bootstrapper.CheckCredentials(ctx)
 	if err != nil {
 		log.Fatalf("AWS credential check failed: %v", err)
 	}
 
-	fmt.Printf("✅ AWS credentials validated. Authenticated as: %s\n\n", arn)
+	fmt.Fprintf(out, "✅ AWS credentials validated. Authenticated as: %s (account %s)\n\n", identity.ARN, identity.Account)
 
 	// If only checking credentials, exit now
 	if *checkCreds {
-		fmt.Println("Credential check completed successfully.")
+		fmt.Fprintln(out, "Credential check completed successfully.")
 		return
 	}
 
 	// Check if dry run mode is enabled
 	if *dryRun {
-		fmt.Println("Running in dry-run mode. No changes will be made.")
-		printPlannedChanges(config)
+		fmt.Fprintln(out, "Running in dry-run mode. No changes will be made.")
+		if deleting {
+			printPlannedDeletions(out, config)
+		} else {
+			// RDS changes can cause downtime, so the existing instances are compared even in a dry run
+			rdsPlans, err := bootstrapper.PlanRDSInstances(ctx, config)
+			if err != nil {
+				log.Fatalf("Failed to compare RDS instances: %v", err)
+			}
+			printPlannedChanges(out, config, rdsPlans)
+			printResourceRoles(out, config, identity.Account)
+			printResourceCounts(out, config)
+			fmt.Fprintln(out)
+			bootstrap.EstimateMonthlyCost(config).Fprint(out)
+
+			// Lint the policy documents, so the dry run catches what IAM, S3 and ECR would reject
+			if err := config.LintPolicies(); err != nil {
+				log.Fatalf("Invalid policy documents:\n%v", err)
+			}
+		}
 		return
 	}
 
-	// Initialize bootstrapper
-	bootstrapper, err := bootstrap.NewBootstrapper(config.Region)
-	if err != nil {
-		log.Fatalf("Failed to initialize bootstrapper: %v\n\nPlease check your AWS credentials and region configuration.\nMake sure you have valid credentials in ~/.aws/credentials or environment variables.\n", err)
+	// Confirm before deleting anything
+	if deleting && !*force {
+		printPlannedDeletions(os.Stdout, config)
+		if !confirm("\nType 'yes' to delete these resources: ") {
+			fmt.Println("Aborted. No resources were deleted.")
+			return
+		}
+	}
+
+	// Show drift against the live resources without changing anything
+	if *plan {
+		planned, err := bootstrapper.Plan(ctx, config)
+		if err != nil {
+			exitIfInterrupted(interrupted, logger, err)
+			log.Fatalf("Failed to plan changes: %v", err)
+		}
+
+		fmt.Println("Planned changes:")
+		planned.Fprint(os.Stdout, *changesOnly)
+		fmt.Println()
+		bootstrap.EstimateMonthlyCost(config).Print()
+		return
+	}
+
+	// Assert the live resources already match, for smoke tests and drift alerts
+	if *verify {
+		planned, err := bootstrapper.Plan(ctx, config)
+		if err != nil {
+			exitIfInterrupted(interrupted, logger, err)
+			log.Fatalf("Failed to verify resources: %v", err)
+		}
+
+		planned.PrintVerify()
+		if drifted := planned.Drifted(); len(drifted) > 0 {
+			log.Fatalf("%d resource(s) do not match the configuration or could not be verified", len(drifted))
+		}
+		fmt.Println("✅ All resources match the configuration.")
+		return
+	}
+
+	if deleting {
+		if err := bootstrapper.DestroyResources(ctx, config); err != nil {
+			exitIfInterrupted(interrupted, logger, err)
+			log.Fatalf("Failed to destroy resources: %v", err)
+		}
+		if state != nil {
+			state.ForgetDestroyed(config)
+			if err := state.Save(*statePath); err != nil {
+				log.Fatalf("Failed to save state: %v", err)
+			}
+		}
+
+		if *prune && len(unprunable) > 0 {
+			fmt.Printf("✅ Orphaned resources pruned; %d that cannot be pruned were left in place and must be deleted by hand.\n", len(unprunable))
+		} else if *prune {
+			fmt.Println("✅ All orphaned resources pruned successfully.")
+		} else if kept := bootstrap.KeptByDestroy(config); len(kept) > 0 {
+			fmt.Printf("✅ Resources deleted; %d of a type -destroy does not delete were kept: %s\n", len(kept), strings.Join(kept, ", "))
+		} else {
+			fmt.Println("✅ All resources deleted successfully.")
+		}
+		return
 	}
 
 	// Provision resources
-	if err := bootstrapper.ProvisionResources(config); err != nil {
+	result, err := bootstrapper.ProvisionResources(ctx, config)
+
+	// Undo this run's creations; the run may have failed because ctx expired, so the
+	// rollback is not bound by it
+	var rolledBack *bootstrap.Config
+	if err != nil && *rollbackOnError {
+		var rollbackErr error
+		rolledBack, rollbackErr = bootstrapper.Rollback(context.WithoutCancel(ctx), result, config)
+		if rollbackErr != nil {
+			logger.Error("Failed to roll back created resources", "error", rollbackErr)
+			rolledBack = nil
+		}
+	}
+
+	// Record what was touched even if provisioning stopped partway through
+	if state != nil {
+		state.Record(result, time.Now())
+		if rolledBack != nil {
+			state.Forget(rolledBack)
+		}
+		if saveErr := state.Save(*statePath); saveErr != nil {
+			log.Fatalf("Failed to save state: %v", saveErr)
+		}
+	}
+	if *outputARNs != "" {
+		if writeErr := result.WriteARNs(*outputARNs); writeErr != nil {
+			log.Fatalf("Failed to write ARNs: %v", writeErr)
+		}
+	}
+	if *outputFormat == "json" {
+		if writeErr := result.WriteJSON(os.Stdout, err); writeErr != nil {
+			log.Fatalf("Failed to write results: %v", writeErr)
+		}
+		if err != nil {
+			exitIfInterrupted(interrupted, logger, err)
+		}
+		if err != nil || len(result.Failed()) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Println("\nProvisioning results:")
+	result.Print()
+	fmt.Println("\nSummary:")
+	if printErr := result.PrintSummary(os.Stdout); printErr != nil {
+		log.Fatalf("Failed to write summary: %v", printErr)
+	}
+	if err != nil {
+		exitIfInterrupted(interrupted, logger, err)
 		log.Fatalf("Failed to provision resources: %v", err)
 	}
+	if failed := result.Failed(); len(failed) > 0 {
+		log.Fatalf("%d resource(s) failed to provision", len(failed))
+	}
 
 	fmt.Println("✅ All resources configured successfully.")
 }
 
-// printPlannedChanges prints what would be done in dry-run mode
-func printPlannedChanges(config *bootstrap.Config) {
-	fmt.Println("The following resources would be provisioned:")
+// exitIfInterrupted exits with exitInterrupted when err was caused by SIGINT or SIGTERM
+// cancelling the run
+func exitIfInterrupted(interrupted context.Context, logger *slog.Logger, err error) {
+	if interrupted.Err() == nil {
+		return
+	}
+	logger.Error("Run interrupted before it completed", "error", err)
+	os.Exit(exitInterrupted)
+}
+
+// loadConfigs loads a comma-separated list of config sources and merges them into one
+func loadConfigs(ctx context.Context, paths string, opts bootstrap.AWSOptions) (*bootstrap.Config, error) {
+	var configs []*bootstrap.Config
+	for _, path := range splitList(paths) {
+		config, err := bootstrap.LoadConfigSource(ctx, path, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		configs = append(configs, config)
+	}
+
+	if len(configs) == 1 {
+		return configs[0], nil
+	}
+	return bootstrap.MergeConfigs(configs...)
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// skippedNote marks disabled resources in dry-run output
+const skippedNote = " (skipped: enabled is false)"
+
+// printResourceRoles lists the roles resource types would be provisioned with and the
+// references that would cross accounts because of them
+func printResourceRoles(w io.Writer, config *bootstrap.Config, account string) {
+	if len(config.ResourceRoles) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "\nResource roles:")
+	keys := make([]string, 0, len(config.ResourceRoles))
+	for key := range config.ResourceRoles {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		role := config.ResourceRoles[key]
+		if role.AssumeRoleARN != "" {
+			fmt.Fprintf(w, "  - %s: %s\n", key, role.AssumeRoleARN)
+		} else {
+			fmt.Fprintf(w, "  - %s: role %s in account %s\n", key, role.RoleName, role.Account)
+		}
+	}
+	for _, warning := range config.CrossAccountWarnings(account) {
+		fmt.Fprintf(w, "  - Warning: %s\n", warning)
+	}
+}
+
+// printPlannedChanges prints what would be done in dry-run mode. RDS instances are shown
+// with the changes rdsPlans found against the existing instances.
+func printPlannedChanges(w io.Writer, config *bootstrap.Config, rdsPlans []bootstrap.ResourcePlan) {
+	fmt.Fprintln(w, "The following resources would be provisioned:")
+
+	if len(config.Tags) > 0 {
+		fmt.Fprintf(w, "\nCommon tags applied to every resource: %d\n", len(config.Tags))
+	}
 
 	// Print S3 buckets
 	if len(config.S3Buckets) > 0 {
-		fmt.Println("\nS3 Buckets:")
+		fmt.Fprintln(w, "\nS3 Buckets:")
 		for _, bucket := range config.S3Buckets {
-			fmt.Printf("  - %s\n", bucket.Name)
-			if bucket.Versioning == "enabled" {
-				fmt.Println("    - Versioning: enabled")
+			if !bucket.IsEnabled() {
+				fmt.Fprintf(w, "  - %s%s\n", bucket.Name, skippedNote)
+				continue
+			}
+			fmt.Fprintf(w, "  - %s\n", bucket.Name)
+			if bucket.Region != "" {
+				fmt.Fprintf(w, "    - Region: %s\n", bucket.Region)
+			}
+			if bucket.Versioning != "" {
+				fmt.Fprintf(w, "    - Versioning: %s\n", bucket.Versioning)
 			}
 			if bucket.Encryption != "" {
-				fmt.Printf("    - Encryption: %s\n", bucket.Encryption)
+				fmt.Fprintf(w, "    - Encryption: %s\n", bucket.Encryption)
+				if bucket.KMSKeyID != "" {
+					fmt.Fprintf(w, "    - KMS key: %s\n", bucket.KMSKeyID)
+				}
+			}
+			if len(bucket.CORS) > 0 {
+				fmt.Fprintf(w, "    - %d CORS rule(s) would be applied\n", len(bucket.CORS))
+			}
+			if len(bucket.Tags) > 0 {
+				fmt.Fprintf(w, "    - %d tag(s) would be applied\n", len(bucket.Tags))
+			}
+			if len(bucket.LifecycleRules) > 0 {
+				fmt.Fprintf(w, "    - %d lifecycle rule(s) would be applied\n", len(bucket.LifecycleRules))
+			}
+			if bucket.ObjectOwnership != "" {
+				fmt.Fprintf(w, "    - Object ownership would be set to %s\n", bucket.ObjectOwnership)
+			}
+			if bucket.ACL != "" {
+				fmt.Fprintf(w, "    - ACL would be set to %s\n", bucket.ACL)
+			}
+			if bucket.TransferAcceleration != nil {
+				if *bucket.TransferAcceleration {
+					fmt.Fprintln(w, "    - Transfer acceleration would be enabled")
+				} else {
+					fmt.Fprintln(w, "    - Transfer acceleration would be suspended")
+				}
+			}
+			if bucket.RequestPayer != "" {
+				fmt.Fprintf(w, "    - Request payer would be set to %s\n", bucket.RequestPayer)
 			}
-			if bucket.CORS != nil {
-				fmt.Println("    - CORS configuration would be applied")
+			if bucket.ObjectLock != nil {
+				fmt.Fprintf(w, "    - Object Lock would be enabled (%s, %d day retention)\n", bucket.ObjectLock.Mode, bucket.ObjectLock.RetentionDays)
+			}
+			if len(bucket.Notifications) > 0 {
+				fmt.Fprintf(w, "    - %d event notification(s) would be configured\n", len(bucket.Notifications))
+			}
+			if bucket.Replication != nil {
+				fmt.Fprintf(w, "    - Replication to %s would be configured\n", bucket.Replication.DestinationBucket)
 			}
 			if bucket.Policy != "" {
-				fmt.Println("    - Bucket policy would be applied")
+				fmt.Fprintln(w, "    - Bucket policy would be applied")
+			}
+			if bucket.PolicyFile != "" {
+				fmt.Fprintf(w, "    - Bucket policy from %s would be applied\n", bucket.PolicyFile)
+			}
+			for _, accessPoint := range bucket.AccessPoints {
+				origin := "internet"
+				if accessPoint.VPCID != "" {
+					origin = "VPC " + accessPoint.VPCID
+				}
+				fmt.Fprintf(w, "    - Access point %s (%s) would be created", accessPoint.Name, origin)
+				if accessPoint.Policy != "" {
+					fmt.Fprint(w, " with a policy")
+				}
+				fmt.Fprintln(w)
 			}
 		}
 	}
 
 	// Print ECR repositories
 	if len(config.ECRRepositories) > 0 {
-		fmt.Println("\nECR Repositories:")
+		fmt.Fprintln(w, "\nECR Repositories:")
 		for _, repo := range config.ECRRepositories {
-			fmt.Printf("  - %s\n", repo.Name)
+			if !repo.IsEnabled() {
+				fmt.Fprintf(w, "  - %s%s\n", repo.Name, skippedNote)
+				continue
+			}
+			fmt.Fprintf(w, "  - %s\n", repo.Name)
+			if repo.Region != "" {
+				fmt.Fprintf(w, "    - Region: %s\n", repo.Region)
+			}
 			if repo.LifecyclePolicy != "" {
-				fmt.Println("    - Lifecycle policy would be applied")
+				fmt.Fprintln(w, "    - Lifecycle policy would be applied")
+			}
+			if repo.LifecyclePolicyFile != "" {
+				fmt.Fprintf(w, "    - Lifecycle policy from %s would be applied\n", repo.LifecyclePolicyFile)
+			}
+			if repo.Encryption != nil {
+				fmt.Fprintf(w, "    - Encryption: %s\n", repo.Encryption.Type)
+			}
+			if repo.RepositoryPolicy != "" {
+				fmt.Fprintln(w, "    - Repository policy would be applied")
+			}
+			if len(repo.PullAccountIDs) > 0 {
+				fmt.Fprintf(w, "    - Pull access would be granted to %d account(s)\n", len(repo.PullAccountIDs))
+			}
+		}
+	}
+
+	// Print IAM groups
+	if len(config.IAMGroups) > 0 {
+		fmt.Fprintln(w, "\nIAM Groups:")
+		for _, group := range config.IAMGroups {
+			if !group.IsEnabled() {
+				fmt.Fprintf(w, "  - %s%s\n", group.Name, skippedNote)
+				continue
+			}
+			fmt.Fprintf(w, "  - %s\n", group.Name)
+			if len(group.Policies) > 0 {
+				fmt.Fprintln(w, "    Policies:")
+				for _, policy := range group.Policies {
+					if policy.PolicyArn != "" {
+						fmt.Fprintf(w, "    - %s (existing)\n", policy.PolicyArn)
+					} else {
+						fmt.Fprintf(w, "    - %s: %s\n", policy.Name, policy.Description)
+					}
+				}
 			}
 		}
 	}
 
+	// Print the account password policy, which is applied before the IAM users
+	if policy := config.PasswordPolicy; policy != nil {
+		fmt.Fprintln(w, "\nAccount Password Policy:")
+		minimumLength := policy.MinimumLength
+		if minimumLength == 0 {
+			minimumLength = 8
+		}
+		fmt.Fprintf(w, "  - Minimum length: %d\n", minimumLength)
+		var required []string
+		if policy.RequireSymbols {
+			required = append(required, "symbols")
+		}
+		if policy.RequireNumbers {
+			required = append(required, "numbers")
+		}
+		if policy.RequireUppercase {
+			required = append(required, "uppercase")
+		}
+		if policy.RequireLowercase {
+			required = append(required, "lowercase")
+		}
+		if len(required) > 0 {
+			fmt.Fprintf(w, "  - Requires: %s\n", strings.Join(required, ", "))
+		}
+		if policy.MaxAgeDays > 0 {
+			fmt.Fprintf(w, "  - Passwords expire after %d days", policy.MaxAgeDays)
+			if policy.HardExpiry {
+				fmt.Fprint(w, " (hard expiry: an administrator must reset them)")
+			}
+			fmt.Fprintln(w)
+		}
+		if policy.ReusePrevention > 0 {
+			fmt.Fprintf(w, "  - The last %d passwords cannot be reused\n", policy.ReusePrevention)
+		}
+		if policy.AllowUsersToChangePassword != nil && !*policy.AllowUsersToChangePassword {
+			fmt.Fprintln(w, "  - Users cannot change their own password")
+		}
+	}
+
 	// Print IAM users
 	if len(config.IAMUsers) > 0 {
-		fmt.Println("\nIAM Users:")
+		fmt.Fprintln(w, "\nIAM Users:")
 		for _, user := range config.IAMUsers {
-			fmt.Printf("  - %s\n", user.Name)
+			if !user.IsEnabled() {
+				fmt.Fprintf(w, "  - %s%s\n", user.Name, skippedNote)
+				continue
+			}
+			fmt.Fprintf(w, "  - %s\n", user.Name)
 			if len(user.Policies) > 0 {
-				fmt.Println("    Policies:")
+				fmt.Fprintln(w, "    Policies:")
 				for _, policy := range user.Policies {
-					fmt.Printf("    - %s: %s\n", policy.Name, policy.Description)
+					if policy.PolicyArn != "" {
+						fmt.Fprintf(w, "    - %s (existing)\n", policy.PolicyArn)
+					} else {
+						fmt.Fprintf(w, "    - %s: %s\n", policy.Name, policy.Description)
+					}
+					if policy.Simulate != nil {
+						fmt.Fprintf(w, "      %d simulation check(s) would be run\n", len(policy.Simulate.Checks))
+					}
+				}
+			}
+			if len(user.InlinePolicies) > 0 {
+				fmt.Fprintf(w, "    - %d inline policy(ies) would be applied\n", len(user.InlinePolicies))
+			}
+			if user.PermissionBoundary != "" {
+				fmt.Fprintf(w, "    - Permissions boundary: %s\n", user.PermissionBoundary)
+			}
+			if len(user.Groups) > 0 {
+				fmt.Fprintf(w, "    Groups: %s\n", strings.Join(user.Groups, ", "))
+			}
+			if access := user.ConsoleAccess; access != nil {
+				source := "configured password"
+				if access.Password == "" {
+					source = "generated password"
+				}
+				fmt.Fprintf(w, "    - Console access would be enabled (%s, password reset required: %t)\n", source, access.PasswordResetRequired)
+			}
+		}
+	}
+
+	// Print VPCs
+	if len(config.VPCs) > 0 {
+		fmt.Fprintln(w, "\nVPCs:")
+		for _, vpc := range config.VPCs {
+			if !vpc.IsEnabled() {
+				fmt.Fprintf(w, "  - %s%s\n", vpc.Name, skippedNote)
+				continue
+			}
+			fmt.Fprintf(w, "  - %s (%s)\n", vpc.Name, vpc.CIDRBlock)
+			if vpc.InternetGateway {
+				fmt.Fprintln(w, "    - Internet gateway would be attached")
+			}
+			for _, subnet := range vpc.Subnets {
+				visibility := "private"
+				if subnet.Public {
+					visibility = "public"
+				}
+				fmt.Fprintf(w, "    - Subnet %s/%s: %s in %s (%s)\n", vpc.Name, subnet.Name, subnet.CIDRBlock, subnet.AvailabilityZone, visibility)
+			}
+		}
+	}
+
+	// Print key pairs
+	if len(config.KeyPairs) > 0 {
+		fmt.Fprintln(w, "\nKey Pairs:")
+		for _, keyPair := range config.KeyPairs {
+			if !keyPair.IsEnabled() {
+				fmt.Fprintf(w, "  - %s%s\n", keyPair.Name, skippedNote)
+				continue
+			}
+			fmt.Fprintf(w, "  - %s\n", keyPair.Name)
+			if keyPair.PublicKey != "" || keyPair.PublicKeyFile != "" {
+				fmt.Fprintln(w, "    - Public key would be imported")
+			} else {
+				fmt.Fprintln(w, "    - Key pair would be generated and its private key written to -credentials-out")
+			}
+		}
+	}
+
+	// Print security groups
+	if len(config.SecurityGroups) > 0 {
+		fmt.Fprintln(w, "\nSecurity Groups:")
+		for _, group := range config.SecurityGroups {
+			if !group.IsEnabled() {
+				fmt.Fprintf(w, "  - %s%s\n", group.Name, skippedNote)
+				continue
+			}
+			fmt.Fprintf(w, "  - %s (VPC %s)\n", group.Name, group.VPC)
+			for _, rule := range group.Ingress {
+				fmt.Fprintf(w, "    - Ingress: %s\n", describeSecurityGroupRule(rule))
+			}
+			for _, rule := range group.Egress {
+				fmt.Fprintf(w, "    - Egress: %s\n", describeSecurityGroupRule(rule))
+			}
+		}
+	}
+
+	// Print RDS instances, which can go down while some changes are applied
+	if len(config.RDSInstances) > 0 {
+		fmt.Fprintln(w, "\nRDS Instances:")
+		plans := make(map[string]bootstrap.ResourcePlan, len(rdsPlans))
+		for _, p := range rdsPlans {
+			plans[p.Name] = p
+		}
+		for _, instance := range config.RDSInstances {
+			if !instance.IsEnabled() {
+				fmt.Fprintf(w, "  - %s%s\n", instance.Identifier, skippedNote)
+				continue
+			}
+			fmt.Fprintf(w, "  - %s (%s, %s, %d GB)\n", instance.Identifier, instance.Engine, instance.InstanceClass, instance.AllocatedStorage)
+			p := plans[instance.Identifier]
+			switch {
+			case p.Action == bootstrap.PlanCreate:
+				fmt.Fprintln(w, "    - Would be created")
+			case instance.IfNotExists:
+				fmt.Fprintln(w, "    - Already exists and is left as it is (if_not_exists)")
+			case len(p.Changes) == 0:
+				fmt.Fprintln(w, "    - Already exists and matches the configuration")
+			}
+			for _, change := range p.Changes {
+				fmt.Fprintf(w, "    - %s\n", change)
+			}
+		}
+	}
+
+	// Print Aurora clusters
+	if len(config.AuroraClusters) > 0 {
+		fmt.Fprintln(w, "\nAurora Clusters:")
+		for _, cluster := range config.AuroraClusters {
+			if !cluster.IsEnabled() {
+				fmt.Fprintf(w, "  - %s%s\n", cluster.Identifier, skippedNote)
+				continue
+			}
+			fmt.Fprintf(w, "  - %s (%s)\n", cluster.Identifier, cluster.Engine)
+			for _, instance := range cluster.Instances {
+				fmt.Fprintf(w, "    - Instance: %s (%s)\n", instance.Identifier, instance.InstanceClass)
+			}
+			if cluster.BackupRetentionPeriod > 0 {
+				fmt.Fprintf(w, "    - Backup retention: %d day(s)\n", cluster.BackupRetentionPeriod)
+			}
+			if cluster.DeletionProtection {
+				fmt.Fprintln(w, "    - Deletion protection would be enabled")
+			}
+		}
+	}
+
+	// Print hosted zones
+	if len(config.HostedZones) > 0 {
+		fmt.Fprintln(w, "\nHosted Zones:")
+		for _, zone := range config.HostedZones {
+			if !zone.IsEnabled() {
+				fmt.Fprintf(w, "  - %s%s\n", zone.Name, skippedNote)
+				continue
+			}
+			if zone.Private {
+				fmt.Fprintf(w, "  - %s (private, %s)\n", zone.Name, zone.VPCID)
+			} else {
+				fmt.Fprintf(w, "  - %s\n", zone.Name)
+			}
+			if len(zone.Records) > 0 {
+				fmt.Fprintf(w, "    - %d record(s) would be upserted\n", len(zone.Records))
+			}
+		}
+	}
+
+	// Print certificates
+	if len(config.Certificates) > 0 {
+		fmt.Fprintln(w, "\nCertificates:")
+		for _, certificate := range config.Certificates {
+			if !certificate.IsEnabled() {
+				fmt.Fprintf(w, "  - %s%s\n", certificate.DomainName, skippedNote)
+				continue
+			}
+			fmt.Fprintf(w, "  - %s\n", certificate.DomainName)
+			if len(certificate.SubjectAlternativeNames) > 0 {
+				fmt.Fprintf(w, "    - Alternative names: %s\n", strings.Join(certificate.SubjectAlternativeNames, ", "))
+			}
+			if certificate.ValidationMethod == "EMAIL" {
+				fmt.Fprintln(w, "    - Would be validated by email")
+			} else {
+				fmt.Fprintln(w, "    - Would be validated by DNS")
+			}
+		}
+	}
+
+	// Print Lambda functions
+	if len(config.LambdaFunctions) > 0 {
+		fmt.Fprintln(w, "\nLambda Functions:")
+		for _, function := range config.LambdaFunctions {
+			if !function.IsEnabled() {
+				fmt.Fprintf(w, "  - %s%s\n", function.Name, skippedNote)
+				continue
+			}
+			if function.ImageURI != "" {
+				fmt.Fprintf(w, "  - %s (image %s)\n", function.Name, function.ImageURI)
+			} else {
+				fmt.Fprintf(w, "  - %s (%s, %s)\n", function.Name, function.Runtime, function.ZipFile)
+			}
+			if function.MemorySize != 0 {
+				fmt.Fprintf(w, "    - Memory: %d MB\n", function.MemorySize)
+			}
+			if function.Timeout != 0 {
+				fmt.Fprintf(w, "    - Timeout: %ds\n", function.Timeout)
+			}
+			if len(function.Environment) > 0 {
+				fmt.Fprintf(w, "    - %d environment variable(s) would be set\n", len(function.Environment))
+			}
+			if function.VPCConfig != nil {
+				fmt.Fprintf(w, "    - VPC subnets: %s\n", strings.Join(function.VPCConfig.SubnetIDs, ", "))
+			}
+		}
+	}
+
+	// Print EventBridge rules
+	if len(config.EventBridgeRules) > 0 {
+		fmt.Fprintln(w, "\nEventBridge Rules:")
+		for _, rule := range config.EventBridgeRules {
+			if !rule.IsEnabled() {
+				fmt.Fprintf(w, "  - %s%s\n", rule.Name, skippedNote)
+				continue
+			}
+			if rule.ScheduleExpression != "" {
+				fmt.Fprintf(w, "  - %s (schedule %s)\n", rule.Name, rule.ScheduleExpression)
+			} else {
+				fmt.Fprintf(w, "  - %s (event pattern)\n", rule.Name)
+			}
+			if rule.State == "DISABLED" {
+				fmt.Fprintln(w, "    - Rule would be disabled")
+			}
+			for _, target := range rule.Targets {
+				switch {
+				case target.LambdaFunction != "":
+					fmt.Fprintf(w, "    - Target: Lambda function %s, which would be given invoke permission\n", target.LambdaFunction)
+				case target.Queue != "":
+					fmt.Fprintf(w, "    - Target: SQS queue %s\n", target.Queue)
+				default:
+					fmt.Fprintf(w, "    - Target: SNS topic %s\n", target.Topic)
 				}
 			}
 		}
 	}
 }
+
+// describeSecurityGroupRule summarizes a security group rule as protocol, ports and peers
+func describeSecurityGroupRule(rule bootstrap.SecurityGroupRule) string {
+	ports := ""
+	switch {
+	case rule.Port != 0:
+		ports = fmt.Sprintf(" %d", rule.Port)
+	case rule.FromPort != 0 || rule.ToPort != 0:
+		ports = fmt.Sprintf(" %d-%d", rule.FromPort, rule.ToPort)
+	}
+	peers := append(append([]string(nil), rule.CIDRBlocks...), rule.SecurityGroups...)
+	return fmt.Sprintf("%s%s with %s", rule.Protocol, ports, strings.Join(peers, ", "))
+}
+
+// countEnabled returns how many of the resources are enabled
+func countEnabled[T interface{ IsEnabled() bool }](resources []T) int {
+	count := 0
+	for _, resource := range resources {
+		if resource.IsEnabled() {
+			count++
+		}
+	}
+	return count
+}
+
+// printResourceCounts prints how many resources of each type would be provisioned. Dry-run
+// only looks up RDS instances, so resources that already exist are included; -plan tells
+// them apart.
+func printResourceCounts(w io.Writer, config *bootstrap.Config) {
+	passwordPolicies := 0
+	if config.PasswordPolicy != nil {
+		passwordPolicies = 1
+	}
+	counts := []struct {
+		label string
+		count int
+	}{
+		{"S3 buckets", countEnabled(config.S3Buckets)},
+		{"ECR repositories", countEnabled(config.ECRRepositories)},
+		{"IAM groups", countEnabled(config.IAMGroups)},
+		{"IAM users", countEnabled(config.IAMUsers)},
+		{"RDS instances", countEnabled(config.RDSInstances)},
+		{"Aurora clusters", countEnabled(config.AuroraClusters)},
+		{"Hosted zones", countEnabled(config.HostedZones)},
+		{"Certificates", countEnabled(config.Certificates)},
+		{"Lambda functions", countEnabled(config.LambdaFunctions)},
+		{"VPCs", countEnabled(config.VPCs)},
+		{"Key pairs", countEnabled(config.KeyPairs)},
+		{"Security groups", countEnabled(config.SecurityGroups)},
+		{"EventBridge rules", countEnabled(config.EventBridgeRules)},
+		{"Account password policy", passwordPolicies},
+	}
+
+	fmt.Fprintln(w, "\nResource counts (created or reconciled; use -plan to see which already exist):")
+	total := 0
+	for _, c := range counts {
+		if c.count > 0 {
+			fmt.Fprintf(w, "  %s: %d\n", c.label, c.count)
+			total += c.count
+		}
+	}
+	fmt.Fprintf(w, "  Total: %d\n", total)
+}
+
+// printPlannedDeletions prints the resources that would be deleted by -destroy
+func printPlannedDeletions(w io.Writer, config *bootstrap.Config) {
+	fmt.Fprintln(w, "The following resources will be permanently deleted:")
+
+	for _, instance := range config.RDSInstances {
+		if !instance.IsEnabled() {
+			fmt.Fprintf(w, "  - RDS instance: %s%s\n", instance.Identifier, skippedNote)
+			continue
+		}
+		if instance.SkipFinalSnapshot {
+			fmt.Fprintf(w, "  - RDS instance: %s (no final snapshot)\n", instance.Identifier)
+		} else if instance.FinalSnapshotIdentifier != "" {
+			fmt.Fprintf(w, "  - RDS instance: %s (final snapshot %s will be taken)\n", instance.Identifier, instance.FinalSnapshotIdentifier)
+		} else {
+			fmt.Fprintf(w, "  - RDS instance: %s (final snapshot will be taken)\n", instance.Identifier)
+		}
+	}
+	for _, user := range config.IAMUsers {
+		if !user.IsEnabled() {
+			fmt.Fprintf(w, "  - IAM user: %s%s\n", user.Name, skippedNote)
+			continue
+		}
+		fmt.Fprintf(w, "  - IAM user: %s (and %d managed policies)\n", user.Name, len(user.Policies))
+	}
+	for _, group := range config.IAMGroups {
+		if !group.IsEnabled() {
+			fmt.Fprintf(w, "  - IAM group: %s%s\n", group.Name, skippedNote)
+			continue
+		}
+		fmt.Fprintf(w, "  - IAM group: %s (and %d managed policies)\n", group.Name, len(group.Policies))
+	}
+	for _, repo := range config.ECRRepositories {
+		if !repo.IsEnabled() {
+			fmt.Fprintf(w, "  - ECR repository: %s%s\n", repo.Name, skippedNote)
+			continue
+		}
+		fmt.Fprintf(w, "  - ECR repository: %s (including all images)\n", repo.Name)
+	}
+	for _, bucket := range config.S3Buckets {
+		if !bucket.IsEnabled() {
+			fmt.Fprintf(w, "  - S3 bucket: %s%s\n", bucket.Name, skippedNote)
+			continue
+		}
+		fmt.Fprintf(w, "  - S3 bucket: %s (including all objects)\n", bucket.Name)
+	}
+
+	if kept := bootstrap.KeptByDestroy(config); len(kept) > 0 {
+		fmt.Fprintln(w, "\nThe following resources are not deleted by -destroy and will be kept:")
+		for _, resource := range kept {
+			fmt.Fprintf(w, "  - %s\n", resource)
+		}
+	}
+}
+
+// confirm prompts the user and returns true only if they answer "yes"
+func confirm(prompt string) bool {
+	fmt.Print(prompt)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(strings.ToLower(answer)) == "yes"
+}
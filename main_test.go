@@ -1,10 +1,20 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
+	"gopkg.in/yaml.v3"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -67,3 +77,968 @@ iam_users:
 		t.Errorf("IAM user config not loaded correctly")
 	}
 }
+
+func TestLoadConfigMultipleCORSRules(t *testing.T) {
+	testConfig := `
+region: us-west-2
+s3_buckets:
+  - name: test-bucket
+    cors:
+      - allowed_origins: ["https://app.example.com"]
+        allowed_methods: ["GET", "PUT"]
+        allowed_headers: ["*"]
+        max_age_seconds: 3000
+      - allowed_origins: ["https://cdn.example.com"]
+        allowed_methods: ["GET"]
+        expose_headers: ["ETag"]
+        max_age_seconds: 600
+  - name: legacy-bucket
+    cors:
+      allowed_origins: ["https://example.com"]
+      allowed_methods: ["GET"]
+`
+	config, err := bootstrap.LoadConfig(writeTempConfig(t, testConfig))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	rules := config.S3Buckets[0].CORS
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 CORS rules, got %d", len(rules))
+	}
+	if rules[0].AllowedOrigins[0] != "https://app.example.com" || rules[0].MaxAgeSeconds != 3000 {
+		t.Errorf("First CORS rule not loaded correctly: %+v", rules[0])
+	}
+	if rules[1].AllowedOrigins[0] != "https://cdn.example.com" || rules[1].ExposeHeaders[0] != "ETag" {
+		t.Errorf("Second CORS rule not loaded correctly: %+v", rules[1])
+	}
+
+	// The legacy single-object form is still accepted
+	legacy := config.S3Buckets[1].CORS
+	if len(legacy) != 1 || legacy[0].AllowedOrigins[0] != "https://example.com" {
+		t.Errorf("Legacy CORS config not loaded correctly: %+v", legacy)
+	}
+
+	// Round-trip the rules through YAML
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+	var roundTripped bootstrap.Config
+	if err := yaml.Unmarshal(data, &roundTripped); err != nil {
+		t.Fatalf("Failed to unmarshal config: %v", err)
+	}
+	if !reflect.DeepEqual(roundTripped.S3Buckets[0].CORS, rules) {
+		t.Errorf("CORS rules changed after round-trip: %+v", roundTripped.S3Buckets[0].CORS)
+	}
+}
+
+func TestLoadConfigResolvesPolicyFile(t *testing.T) {
+	testConfig := `
+region: us-west-2
+s3_buckets:
+  - name: test-bucket
+    policy_file: policies/bucket.json
+  - name: absolute-bucket
+    policy_file: /etc/policies/bucket.json
+ecr_repositories:
+  - name: test-repo
+    lifecycle_policy_file: policies/lifecycle.json
+`
+	path := writeTempConfig(t, testConfig)
+	config, err := bootstrap.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	expected := filepath.Join(filepath.Dir(path), "policies", "bucket.json")
+	if config.S3Buckets[0].PolicyFile != expected {
+		t.Errorf("Expected policy file %s, got %s", expected, config.S3Buckets[0].PolicyFile)
+	}
+	if config.S3Buckets[1].PolicyFile != "/etc/policies/bucket.json" {
+		t.Errorf("Absolute policy file path should be unchanged, got %s", config.S3Buckets[1].PolicyFile)
+	}
+	expected = filepath.Join(filepath.Dir(path), "policies", "lifecycle.json")
+	if config.ECRRepositories[0].LifecyclePolicyFile != expected {
+		t.Errorf("Expected lifecycle policy file %s, got %s", expected, config.ECRRepositories[0].LifecyclePolicyFile)
+	}
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	testConfig := `{
+  "region": "us-west-2",
+  "s3_buckets": [
+    {
+      "name": "test-bucket",
+      "versioning": "enabled",
+      "cors": {"allowed_origins": ["https://example.com"], "allowed_methods": ["GET"]},
+      "lifecycle_rules": [{"id": "expire", "expiration_days": 30}]
+    }
+  ],
+  "rds_instances": [{"identifier": "test-db", "apply_immediately": false}]
+}`
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(testConfig), 0o644); err != nil {
+		t.Fatalf("Failed to write temp config: %v", err)
+	}
+
+	config, err := bootstrap.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	bucket := config.S3Buckets[0]
+	if bucket.Name != "test-bucket" || bucket.Versioning != "enabled" {
+		t.Errorf("S3 bucket config not loaded correctly: %+v", bucket)
+	}
+	if len(bucket.CORS) != 1 || bucket.CORS[0].AllowedOrigins[0] != "https://example.com" {
+		t.Errorf("Single CORS rule object not loaded correctly: %+v", bucket.CORS)
+	}
+	if len(bucket.LifecycleRules) != 1 || bucket.LifecycleRules[0].ExpirationDays != 30 {
+		t.Errorf("Lifecycle rules not loaded correctly: %+v", bucket.LifecycleRules)
+	}
+	if apply := config.RDSInstances[0].ApplyImmediately; apply == nil || *apply {
+		t.Errorf("Expected apply_immediately to be false, got %v", apply)
+	}
+}
+
+func TestLoadConfigExpandsEnv(t *testing.T) {
+	t.Setenv("TEST_BUCKET_NAME", "env-bucket")
+	t.Setenv("TEST_EMPTY", "")
+
+	testConfig := `
+region: ${TEST_REGION:-us-east-2}
+s3_buckets:
+  - name: ${TEST_BUCKET_NAME}
+    encryption: ${TEST_EMPTY:-AES256}
+    policy: '{"Resource": "arn:aws:s3:::${aws:username}/*"}'
+`
+	config, err := bootstrap.LoadConfig(writeTempConfig(t, testConfig))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.Region != "us-east-2" {
+		t.Errorf("Expected default region us-east-2, got %s", config.Region)
+	}
+	if config.S3Buckets[0].Name != "env-bucket" {
+		t.Errorf("Expected bucket name from environment, got %s", config.S3Buckets[0].Name)
+	}
+	if config.S3Buckets[0].Encryption != "AES256" {
+		t.Errorf("Expected default to replace empty variable, got %s", config.S3Buckets[0].Encryption)
+	}
+	if config.S3Buckets[0].Policy != `{"Resource": "arn:aws:s3:::${aws:username}/*"}` {
+		t.Errorf("IAM policy variables should be left untouched, got %s", config.S3Buckets[0].Policy)
+	}
+}
+
+func TestLoadConfigMissingEnv(t *testing.T) {
+	path := writeTempConfig(t, "region: ${TEST_UNSET_REGION_VARIABLE}\n")
+
+	_, err := bootstrap.LoadConfig(path)
+	if err == nil {
+		t.Fatal("Expected an error for an unset variable")
+	}
+	if !strings.Contains(err.Error(), "TEST_UNSET_REGION_VARIABLE") || !strings.Contains(err.Error(), path) {
+		t.Errorf("Expected error to name the variable and config path, got %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	accelerated := true
+	config := &bootstrap.Config{
+		Region: "us-west-2",
+		S3Buckets: []bootstrap.S3Bucket{
+			{Name: "Invalid_Bucket", Versioning: "on"},
+			{Name: "valid-bucket", Policy: "{not json"},
+			{Name: "replicated-bucket", Versioning: "suspended",
+				Replication: &bootstrap.S3Replication{Role: "arn:aws:iam::123456789012:role/replication", DestinationBucket: "my-replica"}},
+			{Name: "notifying-bucket", Notifications: []bootstrap.S3Notification{
+				{Topic: "arn:aws:sqs:us-west-2:123456789012:uploads", Events: []string{"ObjectCreated"}},
+			}},
+			{Name: "enforced-bucket", ObjectOwnership: "BucketOwnerEnforced", ACL: "private"},
+			{Name: "dotted.bucket", TransferAcceleration: &accelerated, RequestPayer: "Anyone",
+				AccessPoints: []bootstrap.S3AccessPoint{{Name: "Tenant_A", VPCID: "main"}}},
+		},
+		ECRRepositories: []bootstrap.ECRRepository{
+			{Name: "broken-json", LifecyclePolicy: "{\n  \"rules\": [\n    {\"rulePriority\": 1,}\n  ]\n}"},
+			{Name: "no-action", Region: "eu-west-9", LifecyclePolicy: `{"rules": [{"rulePriority": 1, "selection": {"tagStatus": "any", "countType": "imageCountMoreThan", "countNumber": 10}}]}`},
+		},
+		IAMUsers: []bootstrap.IAMUser{
+			{Policies: []bootstrap.IAMPolicy{{Name: "no-document"}}},
+			{Name: "simulated", Policies: []bootstrap.IAMPolicy{{Name: "read-only", PolicyArn: "arn:aws:iam::aws:policy/ReadOnlyAccess",
+				Tags:     map[string]string{"Team": "platform"},
+				Simulate: &bootstrap.IAMPolicySimulation{Checks: []bootstrap.IAMSimulationCheck{{Action: "s3:GetObject", Expect: "allow"}}}}}},
+		},
+		RDSInstances: []bootstrap.RDSInstance{
+			{Identifier: "db", Engine: "postgres", InstanceClass: "db.t3.micro", AllocatedStorage: 20,
+				FinalSnapshotIdentifier: "db--final",
+				DesiredState:            "paused",
+				SubnetGroup:             &bootstrap.RDSSubnetGroup{Name: "db-subnets", SubnetIDs: []string{"subnet-1"}},
+				ParameterGroup:          &bootstrap.RDSParameterGroup{Name: "db-params"}},
+			{Identifier: "db-ha", Engine: "postgres", InstanceClass: "db.t3.micro", AllocatedStorage: 20,
+				MultiAZ: true, DesiredState: "stopped"},
+		},
+		AuroraClusters: []bootstrap.AuroraCluster{
+			{Identifier: "aurora", Engine: "postgres", MasterUsername: "admin", Instances: []bootstrap.AuroraInstance{{Identifier: "aurora-1"}}},
+		},
+		HostedZones: []bootstrap.HostedZone{
+			{Name: "example.com", Private: true, Records: []bootstrap.DNSRecord{
+				{Name: "www", Type: "CNAME"},
+				{Name: "static", Type: "A", Alias: &bootstrap.DNSAlias{S3Website: "missing-bucket"}},
+			}},
+		},
+		Certificates: []bootstrap.Certificate{
+			{DomainName: "example.com", ValidationMethod: "HTTP"},
+		},
+		LambdaFunctions: []bootstrap.LambdaFunction{
+			{Name: "api", Role: "arn:aws:iam::123456789012:role/api", ImageURI: "missing-repo:v1", Handler: "app.handler",
+				VPCConfig: &bootstrap.LambdaVPCConfig{SubnetIDs: []string{"main/missing"}, SecurityGroupIDs: []string{"sg-1"}}},
+		},
+		VPCs: []bootstrap.VPC{
+			{Name: "main", CIDRBlock: "10.0.0.0/16", Subnets: []bootstrap.VPCSubnet{
+				{Name: "public-a", AvailabilityZone: "us-west-2a", CIDRBlock: "10.1.0.0/24", Public: true},
+			}},
+		},
+		KeyPairs: []bootstrap.KeyPair{
+			{Name: "deploy", PublicKey: "not-a-key", KeyType: "ed25519"},
+		},
+		SecurityGroups: []bootstrap.SecurityGroup{
+			{Name: "sg-web", VPC: "main", Ingress: []bootstrap.SecurityGroupRule{{Protocol: "tcp", CIDRBlocks: []string{"10.0.0.1/16"}}}},
+			{Name: "db", VPC: "other", Ingress: []bootstrap.SecurityGroupRule{{Protocol: "all", Port: 5432, SecurityGroups: []string{"sg-web"}}}},
+		},
+		EventBridgeRules: []bootstrap.EventBridgeRule{
+			{Name: "nightly", ScheduleExpression: "every day", Targets: []bootstrap.EventBridgeTarget{{Queue: "jobs", Topic: "arn:aws:sns:us-west-2:123456789012:alerts"}}},
+		},
+		PasswordPolicy: &bootstrap.PasswordPolicy{MinimumLength: 4, HardExpiry: true},
+		ResourceRoles: map[string]bootstrap.ResourceRole{
+			"sqs": {AssumeRoleARN: "arn:aws:iam::123456789012:role/queues"},
+			"rds": {Account: "1234", RoleName: "DatabaseAdmin"},
+			"s3":  {AssumeRoleARN: "arn:aws:iam::123456789012:role/storage", Account: "210987654321"},
+		},
+		Timeouts: map[string]string{"rds": "forever", "queue:jobs": "1m"},
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Expected validation to fail")
+	}
+
+	// Every problem is reported, not just the first
+	for _, expected := range []string{
+		`s3_buckets[0]: bucket name "Invalid_Bucket"`,
+		`s3_buckets[0]: versioning must be enabled, suspended or empty`,
+		`s3_buckets[1]: policy is not valid JSON`,
+		`s3_buckets[2].replication: destination_bucket must be a bucket ARN`,
+		`s3_buckets[2]: versioning cannot be suspended when replication is set`,
+		`s3_buckets[3].notifications[0]: topic must be an sns ARN`,
+		`s3_buckets[3].notifications[0]: event "ObjectCreated" must start with s3:`,
+		`s3_buckets[4]: acl cannot be set when object_ownership is BucketOwnerEnforced`,
+		`s3_buckets[5]: request_payer must be BucketOwner or Requester, got "Anyone"`,
+		`s3_buckets[5]: transfer_acceleration cannot be enabled for bucket names that contain dots`,
+		`s3_buckets[5].access_points[0]: name "Tenant_A" must be 3 to 50 lowercase letters`,
+		`s3_buckets[5].access_points[0]: vpc_id must be a VPC ID`,
+		`ecr_repositories[0]: lifecycle_policy: line 3, column 24: invalid character '}'`,
+		`ecr_repositories[1]: lifecycle_policy: rules[0]: action type must be expire`,
+		`ecr_repositories[1].region: "eu-west-9" is not a known AWS region`,
+		`iam_users[0]: name is required`,
+		`iam_users[0].policies[0]: exactly one of policy_document or policy_arn must be set`,
+		`iam_users[1].policies[0]: tags are only set on policies created from policy_document, not on policy_arn`,
+		`iam_users[1].policies[0].simulate.checks[0]: expect must be allowed or denied, got "allow"`,
+		`rds_instances[0].subnet_group: subnet_ids must list at least two subnets`,
+		`rds_instances[0].parameter_group: family is required`,
+		`rds_instances[0]: final_snapshot_identifier "db--final" must start with a letter`,
+		`rds_instances[0]: desired_state must be running, stopped or empty, got "paused"`,
+		`rds_instances[1]: desired_state stopped requires a single-AZ instance`,
+		`aurora_clusters[0]: engine must be aurora-mysql or aurora-postgresql`,
+		`aurora_clusters[0].instances[0]: instance_class is required`,
+		`hosted_zones[0]: vpc_id is required for a private zone`,
+		`hosted_zones[0].records[0]: exactly one of values or alias must be set`,
+		`hosted_zones[0].records[1].alias: s3_website "missing-bucket" is not a bucket in the configuration`,
+		`certificates[0]: validation_method must be DNS or EMAIL`,
+		`lambda_functions[0]: runtime and handler cannot be set with image_uri`,
+		`lambda_functions[0]: image_uri "missing-repo:v1" must be a full image URI or name an ECR repository`,
+		`lambda_functions[0].vpc_config: subnet "main/missing" is not a subnet of VPC main in the configuration`,
+		`vpcs[0].subnets[0]: cidr_block 10.1.0.0/24 is outside the VPC block 10.0.0.0/16`,
+		`vpcs[0].subnets[0]: public subnets require internet_gateway`,
+		`key_pairs[0]: public_key must be an OpenSSH public key`,
+		`key_pairs[0]: key_type cannot be set when a public key is imported`,
+		`security_groups[0]: name "sg-web" cannot start with sg-`,
+		`security_groups[0].ingress[0]: port or from_port and to_port are required`,
+		`security_groups[0].ingress[0]: cidr_block 10.0.0.1/16 must be written as 10.0.0.0/16`,
+		`security_groups[1].ingress[0]: ports cannot be set for protocol all`,
+		`security_groups[1].ingress[0]: security group sg-web is in VPC main, not other`,
+		`eventbridge_rules[0]: schedule_expression must be rate(...) or cron(...), got "every day"`,
+		`eventbridge_rules[0].targets[0]: exactly one of lambda_function, queue or topic is required`,
+		`eventbridge_rules[0].targets[0]: queue must be an SQS queue ARN`,
+		`password_policy: minimum_length must be between 6 and 128, got 4`,
+		`password_policy: hard_expiry requires max_age_days`,
+		`resource_roles.sqs: unknown resource type "sqs"`,
+		`resource_roles.rds.account: must be a 12-digit account ID, got "1234"`,
+		`resource_roles.s3: assume_role_arn is in account 123456789012, not 210987654321`,
+		`timeouts.rds: must be a positive duration such as 90s or 5m, got "forever"`,
+		`timeouts.queue:jobs: unknown resource type "queue"`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected validation error to contain %q, got:\n%v", expected, err)
+		}
+	}
+
+	valid := &bootstrap.Config{
+		Region:    "us-west-2",
+		S3Buckets: []bootstrap.S3Bucket{{Name: "my.valid-bucket", Versioning: "enabled", Encryption: "AES256"}},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected valid config to pass, got %v", err)
+	}
+
+	typo := &bootstrap.Config{Region: "us-west-22"}
+	if err := typo.Validate(); err == nil || !strings.Contains(err.Error(), `region: "us-west-22" is not a known AWS region`) {
+		t.Errorf("Expected unknown region error, got %v", err)
+	}
+}
+
+// TestRequiredTags tests that required_tags fails validation for every taggable resource
+// missing a key, counting the top-level tags
+func TestRequiredTags(t *testing.T) {
+	config := &bootstrap.Config{
+		Region:       "us-west-2",
+		Tags:         map[string]string{"Environment": "prod"},
+		RequiredTags: []string{"Environment", "Owner", "CostCenter"},
+		S3Buckets: []bootstrap.S3Bucket{
+			{Name: "tagged-bucket", Tags: map[string]string{"Owner": "platform", "CostCenter": "1234"}},
+			{Name: "untagged-bucket"},
+		},
+		IAMUsers: []bootstrap.IAMUser{
+			{Name: "deployer", Tags: map[string]string{"Owner": "platform", "CostCenter": "1234"},
+				Policies: []bootstrap.IAMPolicy{{Name: "deploy", PolicyDocument: `{"Version": "2012-10-17", "Statement": []}`}}},
+		},
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Expected resources missing required tags to fail validation")
+	}
+	for _, expected := range []string{
+		"s3_buckets[1].tags: S3 bucket untagged-bucket is missing required tags: Owner, CostCenter",
+		"iam_users[0].policies[0].tags: IAM policy deploy of IAM user deployer is missing required tags: Owner, CostCenter",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected validation error to contain %q, got:\n%v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "s3_buckets[0]") || strings.Contains(err.Error(), "iam_users[0].tags") {
+		t.Errorf("Expected fully tagged resources to pass, got:\n%v", err)
+	}
+
+	config.Tags["Owner"] = "platform"
+	config.Tags["CostCenter"] = "1234"
+	config.S3Buckets[1].Tags = map[string]string{"Owner": "data"}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected resources with every required tag to pass, got %v", err)
+	}
+}
+
+func TestLintPolicies(t *testing.T) {
+	config := &bootstrap.Config{
+		Region: "us-west-2",
+		S3Buckets: []bootstrap.S3Bucket{
+			{Name: "public-read", Policy: `{"Version": "2012-10-17", "Statement": [
+				{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::public-read/*"}]}`},
+			{Name: "no-principal", Policy: `{"Version": "2012-10-17", "Statement":
+				{"Effect": "allow", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::no-principal/*"}}`},
+		},
+		ECRRepositories: []bootstrap.ECRRepository{
+			{Name: "shared", RepositoryPolicy: `{"Version": "2012-10-17", "Statement": [
+				{"Sid": "pull", "Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": ["ecr:BatchGetImage"]},
+				{"Sid": "pull", "Effect": "Allow", "Principal": {"Users": "alice"}, "Action": "ecr:GetDownloadUrlForLayer"}]}`},
+		},
+		IAMUsers: []bootstrap.IAMUser{
+			{Name: "ci",
+				Policies: []bootstrap.IAMPolicy{{Name: "deploy", PolicyDocument: `{"Statement": [
+					{"Effect": "Allow", "Principal": "*", "Action": "deploy", "Resources": "*"}]}`}},
+				InlinePolicies: []bootstrap.IAMInlinePolicy{{Name: "empty", PolicyDocument: `{"Version": "2012-10-17", "Statement": []}`}}},
+		},
+	}
+
+	err := config.LintPolicies()
+	if err == nil {
+		t.Fatal("Expected policy lint to fail")
+	}
+	for _, expected := range []string{
+		`S3 bucket no-principal: policy: Statement[0]: Effect must be Allow or Deny, got "allow"`,
+		`S3 bucket no-principal: policy: Statement[0]: Principal is required`,
+		`ECR repository shared: repository_policy: Statement[1]: Principal must be "*" or map AWS, Service, Federated or CanonicalUser to strings`,
+		`ECR repository shared: repository_policy: Statement[1]: Sid "pull" is used by another statement`,
+		`IAM user ci: policy deploy: Version is required`,
+		`IAM user ci: policy deploy: Statement[0]: unknown element Resources`,
+		`IAM user ci: policy deploy: Statement[0]: Action "deploy" must be * or service:action`,
+		`IAM user ci: policy deploy: Statement[0]: Resource is required`,
+		`IAM user ci: policy deploy: Statement[0]: Principal cannot be set in a policy attached to an IAM identity`,
+		`IAM user ci: inline policy empty: Statement must list at least one statement`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected lint error to contain %q, got:\n%v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "public-read") {
+		t.Errorf("Expected the public-read bucket policy to pass, got:\n%v", err)
+	}
+}
+
+func TestMergeConfigs(t *testing.T) {
+	storage := &bootstrap.Config{
+		Region:    "us-west-2",
+		Tags:      map[string]string{"Environment": "production"},
+		S3Buckets: []bootstrap.S3Bucket{{Name: "storage-team-bucket"}},
+	}
+	platform := &bootstrap.Config{
+		Tags:            map[string]string{"Owner": "platform"},
+		S3Buckets:       []bootstrap.S3Bucket{{Name: "platform-team-bucket"}},
+		ECRRepositories: []bootstrap.ECRRepository{{Name: "platform-api"}},
+		IAMUsers:        []bootstrap.IAMUser{{Name: "platform-deployer"}},
+		VPCs:            []bootstrap.VPC{{Name: "platform"}},
+	}
+
+	merged, err := bootstrap.MergeConfigs(storage, platform)
+	if err != nil {
+		t.Fatalf("Failed to merge configs: %v", err)
+	}
+
+	if merged.Region != "us-west-2" {
+		t.Errorf("Expected region us-west-2, got %s", merged.Region)
+	}
+	if len(merged.S3Buckets) != 2 || merged.S3Buckets[0].Name != "storage-team-bucket" || merged.S3Buckets[1].Name != "platform-team-bucket" {
+		t.Errorf("S3 buckets not concatenated in order: %+v", merged.S3Buckets)
+	}
+	if len(merged.ECRRepositories) != 1 || len(merged.IAMUsers) != 1 || len(merged.VPCs) != 1 {
+		t.Errorf("ECR repositories, IAM users or VPCs not merged: %+v", merged)
+	}
+	if !reflect.DeepEqual(merged.Tags, map[string]string{"Environment": "production", "Owner": "platform"}) {
+		t.Errorf("Common tags not merged: %v", merged.Tags)
+	}
+}
+
+func TestMergeConfigsDuplicateName(t *testing.T) {
+	first := &bootstrap.Config{Region: "us-west-2", S3Buckets: []bootstrap.S3Bucket{{Name: "shared-bucket"}}}
+	second := &bootstrap.Config{Region: "us-west-2", S3Buckets: []bootstrap.S3Bucket{{Name: "shared-bucket"}}}
+
+	_, err := bootstrap.MergeConfigs(first, second)
+	if err == nil || !strings.Contains(err.Error(), `duplicate S3 bucket "shared-bucket"`) {
+		t.Errorf("Expected duplicate bucket error, got %v", err)
+	}
+
+	// The same name may be used by different resource types
+	third := &bootstrap.Config{Region: "us-west-2", ECRRepositories: []bootstrap.ECRRepository{{Name: "shared-bucket"}}}
+	if _, err := bootstrap.MergeConfigs(first, third); err != nil {
+		t.Errorf("Expected different resource types to merge, got %v", err)
+	}
+}
+
+func TestCrossAccountWarnings(t *testing.T) {
+	config := &bootstrap.Config{
+		Region: "us-west-2",
+		S3Buckets: []bootstrap.S3Bucket{{Name: "uploads", Notifications: []bootstrap.S3Notification{
+			{Queue: "arn:aws:sqs:us-west-2:111111111111:uploads", Events: []string{"s3:ObjectCreated:*"}},
+		}}},
+		IAMGroups: []bootstrap.IAMGroup{{Name: "developers"}},
+		IAMUsers:  []bootstrap.IAMUser{{Name: "ci", Groups: []string{"developers"}}},
+		ResourceRoles: map[string]bootstrap.ResourceRole{
+			"s3":        {Account: "222222222222", RoleName: "StorageAdmin"},
+			"iam":       {AssumeRoleARN: "arn:aws:iam::333333333333:role/IdentityAdmin"},
+			"iam_group": {AssumeRoleARN: "arn:aws:iam::444444444444:role/GroupAdmin"},
+		},
+	}
+
+	warnings := config.CrossAccountWarnings("111111111111")
+	expected := []string{
+		"iam:ci in account 333333333333 references iam_group:developers in account 444444444444: users can only join groups in their own account",
+		"S3 bucket uploads in account 222222222222 notifies arn:aws:sqs:us-west-2:111111111111:uploads in account 111111111111: its policy must allow the bucket to publish to it",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("Expected warnings %q, got %q", expected, warnings)
+	}
+
+	// Without a role of their own, groups use the iam role and so the users' account
+	delete(config.ResourceRoles, "iam_group")
+	if warnings := config.CrossAccountWarnings(""); len(warnings) != 1 {
+		t.Errorf("Expected only the notification warning, got %q", warnings)
+	}
+}
+
+func TestMergeConfigsPasswordPolicy(t *testing.T) {
+	policy := &bootstrap.Config{PasswordPolicy: &bootstrap.PasswordPolicy{MinimumLength: 14}}
+	merged, err := bootstrap.MergeConfigs(&bootstrap.Config{Region: "us-west-2"}, policy)
+	if err != nil || merged.PasswordPolicy == nil || merged.PasswordPolicy.MinimumLength != 14 {
+		t.Fatalf("Expected the password policy to be merged, got %+v, %v", merged, err)
+	}
+
+	other := &bootstrap.Config{PasswordPolicy: &bootstrap.PasswordPolicy{MinimumLength: 8}}
+	if _, err := bootstrap.MergeConfigs(policy, other); err == nil || !strings.Contains(err.Error(), "different password policies") {
+		t.Errorf("Expected password policy conflict error, got %v", err)
+	}
+}
+
+func TestMergeConfigsRegionMismatch(t *testing.T) {
+	_, err := bootstrap.MergeConfigs(&bootstrap.Config{Region: "us-west-2"}, &bootstrap.Config{Region: "eu-west-1"})
+	if err == nil || !strings.Contains(err.Error(), "different regions") {
+		t.Errorf("Expected region mismatch error, got %v", err)
+	}
+}
+
+// TestConfigFilter tests selecting resources by type and by name
+func TestConfigFilter(t *testing.T) {
+	config := &bootstrap.Config{
+		Region:          "us-west-2",
+		S3Buckets:       []bootstrap.S3Bucket{{Name: "bucket-a"}, {Name: "bucket-b"}},
+		ECRRepositories: []bootstrap.ECRRepository{{Name: "repo"}},
+		IAMUsers:        []bootstrap.IAMUser{{Name: "alice"}},
+	}
+
+	filtered, err := config.Filter([]string{"s3:bucket-a", "iam"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to filter config: %v", err)
+	}
+	if len(filtered.S3Buckets) != 1 || filtered.S3Buckets[0].Name != "bucket-a" {
+		t.Errorf("Expected only bucket-a, got %+v", filtered.S3Buckets)
+	}
+	if len(filtered.ECRRepositories) != 0 || len(filtered.IAMUsers) != 1 {
+		t.Errorf("Expected only IAM users besides the bucket, got %+v", filtered)
+	}
+
+	filtered, err = config.Filter(nil, []string{"s3", "iam_user:alice"})
+	if err != nil {
+		t.Fatalf("Failed to filter config: %v", err)
+	}
+	if len(filtered.S3Buckets) != 0 || len(filtered.IAMUsers) != 0 || len(filtered.ECRRepositories) != 1 {
+		t.Errorf("Expected only the ECR repository, got %+v", filtered)
+	}
+
+	if _, err := config.Filter([]string{"s3:missing"}, nil); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("Expected unknown name error, got %v", err)
+	}
+	if _, err := config.Filter([]string{"dynamodb"}, nil); err == nil || !strings.Contains(err.Error(), "unknown resource type") {
+		t.Errorf("Expected unknown type error, got %v", err)
+	}
+}
+
+// TestStateRoundTrip tests recording results, persisting the state and finding orphans
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := bootstrap.LoadState(path)
+	if err != nil {
+		t.Fatalf("Failed to load missing state: %v", err)
+	}
+	state.Record(&bootstrap.ProvisionResult{Resources: []bootstrap.ResourceResult{
+		{Type: bootstrap.ResourceTypeS3, Name: "bucket-a", ARN: "arn:aws:s3:::bucket-a", Action: bootstrap.ActionCreated},
+		{Type: bootstrap.ResourceTypeS3, Name: "bucket-b", ARN: "arn:aws:s3:::bucket-b", Action: bootstrap.ActionUnchanged},
+		{Type: bootstrap.ResourceTypeECR, Name: "repo", Action: bootstrap.ActionFailed},
+		{Type: bootstrap.ResourceTypeLambda, Name: "worker", Action: bootstrap.ActionCreated},
+	}}, time.Now())
+	if err := state.Save(path); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	loaded, err := bootstrap.LoadState(path)
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if len(loaded.Resources) != 3 {
+		t.Fatalf("Expected the failed resource to be left out, got %+v", loaded.Resources)
+	}
+
+	config := &bootstrap.Config{Region: "us-west-2", S3Buckets: []bootstrap.S3Bucket{{Name: "bucket-a"}}}
+	orphans := loaded.Orphans(config)
+	if len(orphans) != 2 || orphans[0].Name != "bucket-b" || orphans[0].ARN != "arn:aws:s3:::bucket-b" {
+		t.Errorf("Expected bucket-b and worker to be orphans, got %+v", orphans)
+	}
+	if unprunable := loaded.UnprunableOrphans(config); len(unprunable) != 1 || unprunable[0].Name != "worker" {
+		t.Errorf("Expected the Lambda function to be reported as unprunable, got %+v", unprunable)
+	}
+
+	orphaned := loaded.OrphanedConfig(config)
+	if len(orphaned.S3Buckets) != 1 || orphaned.S3Buckets[0].Name != "bucket-b" || orphaned.Region != "us-west-2" {
+		t.Errorf("Expected only bucket-b to be pruned, got %+v", orphaned)
+	}
+	loaded.Forget(orphaned)
+	if len(loaded.Orphans(config)) != 1 {
+		t.Errorf("Expected pruned resources to be forgotten, got %+v", loaded.Resources)
+	}
+}
+
+// TestStateForgetDestroyed tests that -destroy only forgets the resources it deletes, so
+// types it leaves in place and disabled resources stay in the state
+func TestStateForgetDestroyed(t *testing.T) {
+	state, err := bootstrap.LoadState(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("Failed to load missing state: %v", err)
+	}
+	state.Record(&bootstrap.ProvisionResult{Resources: []bootstrap.ResourceResult{
+		{Type: bootstrap.ResourceTypeS3, Name: "bucket-a", Action: bootstrap.ActionCreated},
+		{Type: bootstrap.ResourceTypeS3, Name: "bucket-b", Action: bootstrap.ActionCreated},
+		{Type: bootstrap.ResourceTypeLambda, Name: "worker", Action: bootstrap.ActionCreated},
+	}}, time.Now())
+
+	disabled := false
+	state.ForgetDestroyed(&bootstrap.Config{
+		Region:          "us-west-2",
+		S3Buckets:       []bootstrap.S3Bucket{{Name: "bucket-a"}, {Name: "bucket-b", Enabled: &disabled}},
+		LambdaFunctions: []bootstrap.LambdaFunction{{Name: "worker"}},
+	})
+	var names []string
+	for _, res := range state.Resources {
+		names = append(names, res.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"bucket-b", "worker"}) {
+		t.Errorf("Expected only bucket-a to be forgotten, got %v", names)
+	}
+}
+
+// writeTempConfig writes config content to a temporary file and returns its path
+func writeTempConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write temp config: %v", err)
+	}
+	return path
+}
+
+func TestStarterConfig(t *testing.T) {
+	// Every field in the starter config must exist in the config structs
+	decoder := yaml.NewDecoder(strings.NewReader(string(bootstrap.StarterConfig())))
+	decoder.KnownFields(true)
+	var config bootstrap.Config
+	if err := decoder.Decode(&config); err != nil {
+		t.Fatalf("Failed to parse starter config: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected starter config to be valid, got %v", err)
+	}
+	if err := config.LintPolicies(); err != nil {
+		t.Errorf("Expected starter config policies to be well-formed, got %v", err)
+	}
+	if len(config.S3Buckets) == 0 || len(config.ECRRepositories) == 0 || len(config.IAMGroups) == 0 ||
+		len(config.IAMUsers) == 0 || len(config.RDSInstances) == 0 || len(config.AuroraClusters) == 0 {
+		t.Errorf("Expected starter config to define one of each resource type, got %+v", config)
+	}
+
+	path := filepath.Join(t.TempDir(), "aws-resources.yaml")
+	if err := bootstrap.WriteStarterConfig(path, false); err != nil {
+		t.Fatalf("Failed to write starter config: %v", err)
+	}
+	if err := bootstrap.WriteStarterConfig(path, false); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected existing file to be kept, got %v", err)
+	}
+	if err := bootstrap.WriteStarterConfig(path, true); err != nil {
+		t.Errorf("Expected overwrite to succeed, got %v", err)
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	data, err := bootstrap.ConfigSchema()
+	if err != nil {
+		t.Fatalf("Failed to generate config schema: %v", err)
+	}
+	type objectSchema struct {
+		Properties           map[string]map[string]any `json:"properties"`
+		Required             []string                  `json:"required"`
+		AdditionalProperties *bool                     `json:"additionalProperties"`
+	}
+	var schema struct {
+		objectSchema
+		Defs map[string]objectSchema `json:"$defs"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("Expected the schema to be JSON, got %v", err)
+	}
+
+	if _, ok := schema.Properties["security_groups"]; !ok {
+		t.Errorf("Expected a security_groups property, got %v", schema.Properties)
+	}
+	if !reflect.DeepEqual(schema.Required, []string{"region"}) {
+		t.Errorf("Expected region to be required, got %v", schema.Required)
+	}
+	bucket := schema.Defs["S3Bucket"]
+	if bucket.AdditionalProperties == nil || *bucket.AdditionalProperties {
+		t.Errorf("Expected unknown bucket fields to be rejected, got %+v", bucket)
+	}
+	if !reflect.DeepEqual(bucket.Required, []string{"name"}) {
+		t.Errorf("Expected bucket name to be required, got %v", bucket.Required)
+	}
+	if enum := bucket.Properties["versioning"]["enum"]; !reflect.DeepEqual(enum, []any{"enabled", "suspended"}) {
+		t.Errorf("Expected versioning to be enabled or suspended, got %v", enum)
+	}
+	if _, ok := bucket.Properties["cors"]["anyOf"]; !ok {
+		t.Errorf("Expected cors to accept a list or a single rule, got %v", bucket.Properties["cors"])
+	}
+	if items := schema.Properties["rds_instances"]["items"]; !reflect.DeepEqual(items, map[string]any{"$ref": "#/$defs/RDSInstance"}) {
+		t.Errorf("Expected rds_instances to refer to the RDSInstance definition, got %v", items)
+	}
+}
+
+func TestConfigRender(t *testing.T) {
+	config, err := bootstrap.LoadConfigFrom(strings.NewReader(`region: us-west-2
+tags:
+  team: platform
+iam_users:
+  - name: deployer
+    console_access:
+      password: initial-password
+rds_instances:
+  - identifier: app-db
+    master_password: db-password
+`), "stdin")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	data, err := config.Render(false)
+	if err != nil {
+		t.Fatalf("Failed to render config: %v", err)
+	}
+	if strings.Contains(string(data), "initial-password") || strings.Contains(string(data), "db-password") {
+		t.Errorf("Expected passwords to be redacted, got:\n%s", data)
+	}
+	var rendered bootstrap.Config
+	if err := yaml.Unmarshal(data, &rendered); err != nil {
+		t.Fatalf("Expected the rendered config to load again, got %v", err)
+	}
+	if rendered.IAMUsers[0].Tags["team"] != "platform" {
+		t.Errorf("Expected global tags merged into the user, got %v", rendered.IAMUsers[0].Tags)
+	}
+	if config.RDSInstances[0].MasterPassword != "db-password" {
+		t.Errorf("Expected rendering to leave the config unchanged, got %q", config.RDSInstances[0].MasterPassword)
+	}
+
+	data, err = config.Render(true)
+	if err != nil {
+		t.Fatalf("Failed to render config with secrets: %v", err)
+	}
+	if !strings.Contains(string(data), "db-password") {
+		t.Errorf("Expected passwords with showSecrets, got:\n%s", data)
+	}
+}
+
+func TestLoadConfigFrom(t *testing.T) {
+	t.Setenv("TEST_BUCKET", "from-env")
+
+	config, err := bootstrap.LoadConfigFrom(strings.NewReader("region: us-west-2\ns3_buckets:\n  - name: ${TEST_BUCKET}\n"), "stdin")
+	if err != nil {
+		t.Fatalf("Failed to load YAML config: %v", err)
+	}
+	if config.Region != "us-west-2" || len(config.S3Buckets) != 1 || config.S3Buckets[0].Name != "from-env" {
+		t.Errorf("Unexpected YAML config: %+v", config)
+	}
+
+	config, err = bootstrap.LoadConfigFrom(strings.NewReader(`{"region": "eu-west-1"}`), "config.json")
+	if err != nil {
+		t.Fatalf("Failed to load JSON config: %v", err)
+	}
+	if config.Region != "eu-west-1" {
+		t.Errorf("Expected region eu-west-1, got %q", config.Region)
+	}
+
+	if _, err := bootstrap.LoadConfigFrom(strings.NewReader("region: [unclosed"), "stdin"); err == nil {
+		t.Error("Expected invalid YAML to fail")
+	}
+}
+
+func TestLoadConfigSourceURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/aws-resources.json" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"region": "us-west-2", "ecr_repositories": [{"name": "remote-repo"}]}`)
+	}))
+	defer server.Close()
+
+	config, err := bootstrap.LoadConfigSource(context.Background(), server.URL+"/aws-resources.json?version=2", bootstrap.AWSOptions{})
+	if err != nil {
+		t.Fatalf("Failed to load config from URL: %v", err)
+	}
+	if len(config.ECRRepositories) != 1 || config.ECRRepositories[0].Name != "remote-repo" {
+		t.Errorf("Unexpected config from URL: %+v", config)
+	}
+
+	if _, err := bootstrap.LoadConfigSource(context.Background(), server.URL+"/missing.yaml", bootstrap.AWSOptions{}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected a 404 error, got %v", err)
+	}
+}
+
+func TestProvisionResultSummary(t *testing.T) {
+	result := &bootstrap.ProvisionResult{Resources: []bootstrap.ResourceResult{
+		{Type: bootstrap.ResourceTypeS3, Name: "new-bucket", Action: bootstrap.ActionCreated},
+		{Type: bootstrap.ResourceTypeS3, Name: "old-bucket", Action: bootstrap.ActionUpdated, Warnings: []bootstrap.Warning{{Message: "failed to set tags"}}},
+		{Type: bootstrap.ResourceTypeECR, Name: "repo", Action: bootstrap.ActionUnchanged},
+		{Type: bootstrap.ResourceTypeS3, Name: "broken-bucket", Action: bootstrap.ActionFailed},
+	}}
+
+	summaries := result.Summary()
+	expected := []bootstrap.ResultSummary{
+		{Type: bootstrap.ResourceTypeS3, Created: 1, Updated: 1, Failed: 1, Warned: 1},
+		{Type: bootstrap.ResourceTypeECR, Unchanged: 1},
+		{Type: "total", Created: 1, Updated: 1, Unchanged: 1, Failed: 1, Warned: 1},
+	}
+	if !reflect.DeepEqual(summaries, expected) {
+		t.Errorf("Expected summary %+v, got %+v", expected, summaries)
+	}
+
+	var out strings.Builder
+	if err := result.PrintSummary(&out); err != nil {
+		t.Fatalf("Failed to print summary: %v", err)
+	}
+	for _, line := range []string{"TYPE", "total", "Warnings (1):", "s3 old-bucket: failed to set tags"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected summary to contain %q, got:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestPlanDrifted(t *testing.T) {
+	plan := &bootstrap.Plan{Resources: []bootstrap.ResourcePlan{
+		{Type: bootstrap.ResourceTypeS3, Name: "in-sync", Action: bootstrap.PlanNoOp},
+		{Type: bootstrap.ResourceTypeS3, Name: "missing", Action: bootstrap.PlanCreate},
+		{Type: bootstrap.ResourceTypeECR, Name: "drifted", Action: bootstrap.PlanUpdate, Changes: []string{"lifecycle_policy: changed"}},
+	}}
+
+	drifted := plan.Drifted()
+	if len(drifted) != 2 || drifted[0].Name != "missing" || drifted[1].Name != "drifted" {
+		t.Errorf("Expected missing and drifted resources, got %+v", drifted)
+	}
+	if drifted := (&bootstrap.Plan{Resources: plan.Resources[:1]}).Drifted(); len(drifted) != 0 {
+		t.Errorf("Expected no drift, got %+v", drifted)
+	}
+}
+
+func TestPlanChangesOnly(t *testing.T) {
+	plan := &bootstrap.Plan{Resources: []bootstrap.ResourcePlan{
+		{Type: bootstrap.ResourceTypeS3, Name: "in-sync", Action: bootstrap.PlanNoOp},
+		{Type: bootstrap.ResourceTypeS3, Name: "missing", Action: bootstrap.PlanCreate},
+		{Type: bootstrap.ResourceTypeECR, Name: "drifted", Action: bootstrap.PlanUpdate, Changes: []string{"lifecycle_policy: changed"}},
+	}}
+
+	var full, changes strings.Builder
+	plan.Fprint(&full, false)
+	plan.Fprint(&changes, true)
+
+	if !strings.Contains(full.String(), "= s3 in-sync: no-op") || strings.Contains(full.String(), "hidden") {
+		t.Errorf("Expected the full plan to list unchanged resources, got:\n%s", full.String())
+	}
+	if strings.Contains(changes.String(), "in-sync") {
+		t.Errorf("Expected unchanged resources to be hidden, got:\n%s", changes.String())
+	}
+	for _, line := range []string{"+ s3 missing: create", "~ ecr drifted: update", "    lifecycle_policy: changed",
+		"Plan: 1 to create, 1 to update, 1 unchanged.", "1 unchanged resource(s) hidden by -changes-only."} {
+		if !strings.Contains(changes.String(), line) {
+			t.Errorf("Expected changes-only plan to contain %q, got:\n%s", line, changes.String())
+		}
+	}
+}
+
+func TestEstimateMonthlyCost(t *testing.T) {
+	disabled := false
+	config := &bootstrap.Config{
+		Region:    "us-east-1",
+		S3Buckets: []bootstrap.S3Bucket{{Name: "free-until-used"}},
+		RDSInstances: []bootstrap.RDSInstance{
+			{Identifier: "db", InstanceClass: "db.t3.micro", AllocatedStorage: 20, MasterPassword: "secret"},
+			{Identifier: "ha", InstanceClass: "db.t3.micro", AllocatedStorage: 20, MultiAZ: true, MasterPasswordSecret: "prod/ha"},
+			{Identifier: "huge", InstanceClass: "db.x2g.16xlarge", AllocatedStorage: 20},
+			{Identifier: "off", InstanceClass: "db.r5.xlarge", AllocatedStorage: 500, Enabled: &disabled},
+		},
+		HostedZones: []bootstrap.HostedZone{{Name: "example.com"}},
+	}
+
+	estimate := bootstrap.EstimateMonthlyCost(config)
+
+	// db.t3.micro with 20 GB of gp2, once and twice for Multi-AZ, a generated password
+	// secret for the unpriced instance class, and the hosted zone
+	single := 0.018*730 + 20*0.115
+	want := single + 2*single + 0.40 + 0.50
+	if got := estimate.Total(); got < want-0.001 || got > want+0.001 {
+		t.Errorf("Expected a total of %.2f, got %.2f (%+v)", want, got, estimate.Items)
+	}
+	if len(estimate.Unpriced) != 1 || !strings.Contains(estimate.Unpriced[0], "db.x2g.16xlarge") {
+		t.Errorf("Expected the unknown instance class to be unpriced, got %v", estimate.Unpriced)
+	}
+
+	config.Region = "eu-central-1"
+	if regional := bootstrap.EstimateMonthlyCost(config).Total(); regional <= want {
+		t.Errorf("Expected eu-central-1 to cost more than us-east-1, got %.2f", regional)
+	}
+}
+
+// TestDryRunOutputWriter tests that the dry-run report is written to the given writer, so
+// -quiet and -output json can keep it off stdout
+func TestDryRunOutputWriter(t *testing.T) {
+	config := &bootstrap.Config{
+		Region:       "us-east-1",
+		S3Buckets:    []bootstrap.S3Bucket{{Name: "artifacts"}},
+		RDSInstances: []bootstrap.RDSInstance{{Identifier: "db", InstanceClass: "db.t3.micro", AllocatedStorage: 20}},
+	}
+
+	var buf strings.Builder
+	printPlannedChanges(&buf, config, nil)
+	printResourceCounts(&buf, config)
+	bootstrap.EstimateMonthlyCost(config).Fprint(&buf)
+	printPlannedDeletions(&buf, config)
+
+	for _, want := range []string{"- artifacts", "S3 buckets: 1", "Estimated monthly cost", "- RDS instance: db"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected the dry-run output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+// TestPrintPlannedDeletionsListsKept tests that the -destroy prompt lists the configured
+// resources of types that are not deleted
+func TestPrintPlannedDeletionsListsKept(t *testing.T) {
+	config := &bootstrap.Config{
+		Region:          "us-east-1",
+		S3Buckets:       []bootstrap.S3Bucket{{Name: "artifacts"}},
+		LambdaFunctions: []bootstrap.LambdaFunction{{Name: "worker"}},
+	}
+
+	var buf strings.Builder
+	printPlannedDeletions(&buf, config)
+	output := buf.String()
+	kept := strings.Index(output, "will be kept:")
+	if kept < 0 || !strings.Contains(output[kept:], "- lambda:worker") || strings.Contains(output[kept:], "artifacts") {
+		t.Errorf("Expected only the Lambda function to be listed as kept, got:\n%s", output)
+	}
+}
+
+func TestWriteARNs(t *testing.T) {
+	result := &bootstrap.ProvisionResult{Resources: []bootstrap.ResourceResult{
+		{Type: bootstrap.ResourceTypeS3, Name: "my-bucket", ARN: "arn:aws:s3:::my-bucket"},
+		{Type: bootstrap.ResourceTypeIAM, Name: "deployer", ARN: "arn:aws:iam::123456789012:user/deployer",
+			PolicyARNs: map[string]string{"deploy": "arn:aws:iam::123456789012:policy/deployer-deploy"}},
+		{Type: bootstrap.ResourceTypeECR, Name: "broken-repo", Action: bootstrap.ActionFailed},
+	}}
+
+	path := filepath.Join(t.TempDir(), "arns.yaml")
+	if err := result.WriteARNs(path); err != nil {
+		t.Fatalf("Failed to write ARNs: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read ARNs: %v", err)
+	}
+
+	var arns map[string]map[string]string
+	if err := yaml.Unmarshal(data, &arns); err != nil {
+		t.Fatalf("Failed to parse ARNs: %v", err)
+	}
+	expected := map[string]map[string]string{
+		"s3":         {"my-bucket": "arn:aws:s3:::my-bucket"},
+		"iam":        {"deployer": "arn:aws:iam::123456789012:user/deployer"},
+		"iam_policy": {"deployer/deploy": "arn:aws:iam::123456789012:policy/deployer-deploy"},
+	}
+	if !reflect.DeepEqual(arns, expected) {
+		t.Errorf("Expected ARNs %v, got %v", expected, arns)
+	}
+}
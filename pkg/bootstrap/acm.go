@@ -0,0 +1,334 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	acmtypes "github.com/aws/aws-sdk-go-v2/service/acm/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	r53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	// certificateWaitTimeout bounds how long to wait for a certificate to be issued
+	certificateWaitTimeout = 30 * time.Minute
+
+	// ACM fills in the DNS validation records of a new certificate shortly after it is
+	// requested; they are polled for this many times, this far apart
+	certificateRecordAttempts = 10
+	certificateRecordInterval = 2 * time.Second
+)
+
+// validatesByDNS reports whether the certificate uses DNS validation, the default
+func (c Certificate) validatesByDNS() bool {
+	return c.ValidationMethod == "" || c.ValidationMethod == "DNS"
+}
+
+// domains returns the domain name followed by the subject alternative names, without
+// duplicates and lowercased, which is how ACM lists the names of a certificate
+func (c Certificate) domains() []string {
+	domains := []string{strings.ToLower(c.DomainName)}
+	for _, name := range c.SubjectAlternativeNames {
+		name = strings.ToLower(name)
+		if !slices.Contains(domains, name) {
+			domains = append(domains, name)
+		}
+	}
+	return domains
+}
+
+// validationZone returns the public zone in zones that domain belongs to, preferring the
+// most specific one, or nil if there is none
+func validationZone(zones []HostedZone, domain string) *HostedZone {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	var best *HostedZone
+	for i, zone := range zones {
+		if zone.Private {
+			continue
+		}
+		name := strings.TrimSuffix(strings.ToLower(zone.Name), ".")
+		if domain != name && !strings.HasSuffix(domain, "."+name) {
+			continue
+		}
+		if best == nil || len(name) > len(strings.TrimSuffix(best.Name, ".")) {
+			best = &zones[i]
+		}
+	}
+	return best
+}
+
+// RequestCertificates requests ACM certificates based on the configuration. DNS validation
+// records are created in the given hosted zones where a certificate's domains belong to one.
+func (b *Bootstrapper) RequestCertificates(ctx context.Context, certificates []Certificate, zones []HostedZone) ([]ResourceResult, error) {
+	var results []ResourceResult
+	for _, certificate := range certificates {
+		// Stop before starting the next resource if the run was cancelled or timed out
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+
+		res := newResourceResult(ResourceTypeCertificate, certificate.DomainName)
+		err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+			return b.ensureCertificate(ctx, certificate, zones, res)
+		})
+		results = append(results, res.finish(err))
+		if err != nil && !b.tolerate(err) {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// ensureCertificate requests a single certificate unless one for the same domains exists
+// already, then completes its DNS validation
+func (b *Bootstrapper) ensureCertificate(ctx context.Context, certificate Certificate, zones []HostedZone, res *ResourceResult) error {
+	logger.Info("Ensuring certificate", "domain", certificate.DomainName)
+
+	arn, err := b.findCertificate(ctx, certificate)
+	if err != nil {
+		return fmt.Errorf("failed to look up certificate for %s: %w", certificate.DomainName, err)
+	}
+
+	if arn == "" {
+		method := acmtypes.ValidationMethodDns
+		if !certificate.validatesByDNS() {
+			method = acmtypes.ValidationMethodEmail
+		}
+		input := &acm.RequestCertificateInput{
+			DomainName:       aws.String(certificate.DomainName),
+			ValidationMethod: method,
+			IdempotencyToken: aws.String(certificateIdempotencyToken(certificate)),
+		}
+		if len(certificate.SubjectAlternativeNames) > 0 {
+			input.SubjectAlternativeNames = certificate.SubjectAlternativeNames
+		}
+		if len(certificate.Tags) > 0 {
+			input.Tags = buildACMTags(certificate.Tags)
+		}
+
+		output, err := b.acmClient.RequestCertificate(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to request certificate for %s: %w", certificate.DomainName, err)
+		}
+		arn = aws.ToString(output.CertificateArn)
+		res.created()
+		logger.Info("Requested certificate", "domain", certificate.DomainName, "arn", arn)
+	} else {
+		logger.Info("Certificate already exists", "domain", certificate.DomainName, "arn", arn)
+		if certificate.IfNotExists {
+			res.ARN = arn
+			leaveExisting(res)
+			return nil
+		}
+
+		if len(certificate.Tags) > 0 {
+			_, err := b.acmClient.AddTagsToCertificate(ctx, &acm.AddTagsToCertificateInput{
+				CertificateArn: aws.String(arn),
+				Tags:           buildACMTags(certificate.Tags),
+			})
+			if err != nil {
+				res.warnf("failed to set tags for certificate %s: %v", certificate.DomainName, err)
+			} else {
+				res.updated()
+				logger.Info("Set certificate tags", "domain", certificate.DomainName, "tags", len(certificate.Tags))
+			}
+		}
+	}
+	res.ARN = arn
+
+	if certificate.validatesByDNS() {
+		if err := b.createValidationRecords(ctx, certificate, arn, zones, res); err != nil {
+			return err
+		}
+	}
+
+	if certificate.WaitForValidation {
+		logger.Info("Waiting for certificate to be issued", "domain", certificate.DomainName)
+		task := startProgress("Certificate "+certificate.DomainName, "waiting")
+		defer task.done()
+		waiter := acm.NewCertificateValidatedWaiter(b.acmClient)
+		err := waiter.Wait(ctx, &acm.DescribeCertificateInput{CertificateArn: aws.String(arn)}, certificateWaitTimeout, func(o *acm.CertificateValidatedWaiterOptions) {
+			retryable := o.Retryable
+			o.Retryable = func(ctx context.Context, input *acm.DescribeCertificateInput, output *acm.DescribeCertificateOutput, err error) (bool, error) {
+				if err == nil && output.Certificate != nil {
+					task.update(strings.ToLower(string(output.Certificate.Status)))
+				}
+				return retryable(ctx, input, output, err)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed waiting for certificate for %s to be issued: %w", certificate.DomainName, err)
+		}
+		logger.Info("Certificate is issued", "domain", certificate.DomainName)
+	}
+
+	logger.Info("Certificate ARN", "domain", certificate.DomainName, "arn", arn)
+	return nil
+}
+
+// findCertificate returns the ARN of a pending or issued certificate for exactly the
+// certificate's domains, or "" if there is none
+func (b *Bootstrapper) findCertificate(ctx context.Context, certificate Certificate) (string, error) {
+	want := certificate.domains()
+	slices.Sort(want)
+
+	input := &acm.ListCertificatesInput{
+		CertificateStatuses: []acmtypes.CertificateStatus{
+			acmtypes.CertificateStatusPendingValidation,
+			acmtypes.CertificateStatusIssued,
+		},
+	}
+	for {
+		output, err := b.acmClient.ListCertificates(ctx, input)
+		if err != nil {
+			return "", err
+		}
+		for _, summary := range output.CertificateSummaryList {
+			if !strings.EqualFold(aws.ToString(summary.DomainName), certificate.DomainName) {
+				continue
+			}
+			names := summary.SubjectAlternativeNameSummaries
+			// The summary only lists the first names of a certificate with many
+			if aws.ToBool(summary.HasAdditionalSubjectAlternativeNames) {
+				described, err := b.acmClient.DescribeCertificate(ctx, &acm.DescribeCertificateInput{CertificateArn: summary.CertificateArn})
+				if err != nil {
+					return "", err
+				}
+				names = described.Certificate.SubjectAlternativeNames
+			}
+			existing := Certificate{DomainName: aws.ToString(summary.DomainName), SubjectAlternativeNames: names}.domains()
+			slices.Sort(existing)
+			if slices.Equal(existing, want) {
+				return aws.ToString(summary.CertificateArn), nil
+			}
+		}
+		if output.NextToken == nil {
+			return "", nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// createValidationRecords upserts the DNS validation records of a certificate into the
+// hosted zones its domains belong to. Domains outside those zones get a warning with the
+// record to create by hand.
+func (b *Bootstrapper) createValidationRecords(ctx context.Context, certificate Certificate, arn string, zones []HostedZone, res *ResourceResult) error {
+	detail, err := b.describeValidationRecords(ctx, arn)
+	if err != nil {
+		return fmt.Errorf("failed to describe certificate for %s: %w", certificate.DomainName, err)
+	}
+	if detail.Status != acmtypes.CertificateStatusPendingValidation {
+		return nil
+	}
+
+	// A wildcard and its base domain share a record, so records are grouped by zone and
+	// deduplicated by name
+	changes := make(map[string][]r53types.Change)
+	var zoneOrder []*HostedZone
+	seen := make(map[string]bool)
+	for _, option := range detail.DomainValidationOptions {
+		record := option.ResourceRecord
+		if record == nil || seen[aws.ToString(record.Name)] {
+			continue
+		}
+		seen[aws.ToString(record.Name)] = true
+
+		zone := validationZone(zones, aws.ToString(option.DomainName))
+		if zone == nil {
+			res.warnf("no hosted zone in the configuration for %s; create the validation record %s %s %s",
+				aws.ToString(option.DomainName), aws.ToString(record.Name), record.Type, aws.ToString(record.Value))
+			continue
+		}
+		if _, ok := changes[zone.Name]; !ok {
+			zoneOrder = append(zoneOrder, zone)
+		}
+		changes[zone.Name] = append(changes[zone.Name], r53types.Change{
+			Action: r53types.ChangeActionUpsert,
+			ResourceRecordSet: &r53types.ResourceRecordSet{
+				Name:            record.Name,
+				Type:            r53types.RRType(record.Type),
+				TTL:             aws.Int64(defaultRecordTTL),
+				ResourceRecords: []r53types.ResourceRecord{{Value: record.Value}},
+			},
+		})
+	}
+
+	for _, zone := range zoneOrder {
+		zoneID, err := b.findHostedZone(ctx, *zone, res)
+		if err != nil {
+			return fmt.Errorf("failed to look up hosted zone %s: %w", zone.Name, err)
+		}
+		if zoneID == "" {
+			res.warnf("hosted zone %s does not exist; the validation records for %s were not created", zone.Name, certificate.DomainName)
+			continue
+		}
+
+		_, err = b.route53Client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(zoneID),
+			ChangeBatch:  &r53types.ChangeBatch{Changes: changes[zone.Name]},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create validation records for %s in hosted zone %s: %w", certificate.DomainName, zone.Name, err)
+		}
+		res.updated()
+		logger.Info("Upserted certificate validation records", "domain", certificate.DomainName, "zone", zone.Name, "records", len(changes[zone.Name]))
+	}
+	return nil
+}
+
+// describeValidationRecords describes a certificate, polling until ACM has filled in the
+// DNS validation record of every domain
+func (b *Bootstrapper) describeValidationRecords(ctx context.Context, arn string) (*acmtypes.CertificateDetail, error) {
+	for attempt := 1; ; attempt++ {
+		output, err := b.acmClient.DescribeCertificate(ctx, &acm.DescribeCertificateInput{CertificateArn: aws.String(arn)})
+		if err != nil {
+			return nil, err
+		}
+		detail := output.Certificate
+
+		complete := true
+		for _, option := range detail.DomainValidationOptions {
+			if option.ResourceRecord == nil {
+				complete = false
+			}
+		}
+		if complete || detail.Status != acmtypes.CertificateStatusPendingValidation || attempt == certificateRecordAttempts {
+			return detail, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(certificateRecordInterval):
+		}
+	}
+}
+
+// certificateIdempotencyToken derives the token ACM uses to recognise repeated requests
+// for the same certificate. Tokens are limited to 32 alphanumeric characters.
+func certificateIdempotencyToken(certificate Certificate) string {
+	domains := certificate.domains()
+	slices.Sort(domains)
+	sum := sha256.Sum256([]byte(strings.Join(domains, ",")))
+	return hex.EncodeToString(sum[:])[:32]
+}
+
+// buildACMTags converts a tag map into ACM tags sorted by key
+func buildACMTags(tags map[string]string) []acmtypes.Tag {
+	result := make([]acmtypes.Tag, 0, len(tags))
+	for _, key := range sortedKeys(tags) {
+		result = append(result, acmtypes.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+	return result
+}
@@ -0,0 +1,214 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// ManageAuroraClusters creates or reconciles Aurora clusters and their member instances
+func (b *Bootstrapper) ManageAuroraClusters(ctx context.Context, clusters []AuroraCluster) ([]ResourceResult, error) {
+	var results []ResourceResult
+	for _, cluster := range clusters {
+		// Stop before starting the next resource if the run was cancelled or timed out
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+
+		res := newResourceResult(ResourceTypeAurora, cluster.Identifier)
+		err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+			return b.ensureAuroraCluster(ctx, cluster, res)
+		})
+		results = append(results, res.finish(err))
+		if err != nil && !b.tolerate(err) {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// passwordSource returns the cluster's master password settings in the form used to
+// resolve RDS master passwords, so clusters share the secret handling of instances
+func (c AuroraCluster) passwordSource() RDSInstance {
+	return RDSInstance{
+		Identifier:               c.Identifier,
+		Engine:                   c.Engine,
+		MasterUsername:           c.MasterUsername,
+		MasterPassword:           c.MasterPassword,
+		MasterPasswordSecret:     c.MasterPasswordSecret,
+		MasterPasswordSecretName: c.MasterPasswordSecretName,
+		Tags:                     c.Tags,
+	}
+}
+
+// ensureAuroraCluster creates a single Aurora cluster if needed, reconciles the settings of
+// an existing one, and creates any member instances that are missing
+func (b *Bootstrapper) ensureAuroraCluster(ctx context.Context, cluster AuroraCluster, res *ResourceResult) error {
+	logger.Info("Ensuring Aurora cluster", "cluster", cluster.Identifier)
+
+	describeOutput, err := b.rdsClient.DescribeDBClusters(ctx, &rds.DescribeDBClustersInput{
+		DBClusterIdentifier: aws.String(cluster.Identifier),
+	})
+
+	members := make(map[string]bool)
+	if err != nil {
+		if !isAPIError[*rdstypes.DBClusterNotFoundFault](err) {
+			return fmt.Errorf("error checking Aurora cluster %s: %w", cluster.Identifier, err)
+		}
+		if err := b.createAuroraCluster(ctx, cluster, res); err != nil {
+			return err
+		}
+	} else if len(describeOutput.DBClusters) > 0 {
+		existing := describeOutput.DBClusters[0]
+		res.ARN = aws.ToString(existing.DBClusterArn)
+		logger.Info("Aurora cluster already exists", "cluster", cluster.Identifier)
+		// The cluster's member instances are left as they are too
+		if cluster.IfNotExists {
+			leaveExisting(res)
+			return nil
+		}
+
+		for _, member := range existing.DBClusterMembers {
+			members[aws.ToString(member.DBInstanceIdentifier)] = true
+		}
+		b.reconcileAuroraCluster(ctx, cluster, existing, res)
+	}
+
+	// Instances can be added while the cluster itself is still being created
+	for _, instance := range cluster.Instances {
+		if members[instance.Identifier] {
+			continue
+		}
+		if err := b.createAuroraInstance(ctx, cluster, instance); err != nil {
+			return err
+		}
+		res.updated()
+	}
+
+	return nil
+}
+
+// createAuroraCluster creates the cluster itself; its instances are created separately
+func (b *Bootstrapper) createAuroraCluster(ctx context.Context, cluster AuroraCluster, res *ResourceResult) error {
+	logger.Info("Creating new Aurora cluster", "cluster", cluster.Identifier)
+
+	// The password comes from the config, an existing secret, or a newly generated secret
+	password, err := b.resolveRDSMasterPassword(ctx, cluster.passwordSource())
+	if err != nil {
+		return err
+	}
+
+	createInput := &rds.CreateDBClusterInput{
+		DBClusterIdentifier: aws.String(cluster.Identifier),
+		Engine:              aws.String(cluster.Engine),
+		MasterUsername:      aws.String(cluster.MasterUsername),
+		MasterUserPassword:  aws.String(password),
+		DeletionProtection:  aws.Bool(cluster.DeletionProtection),
+	}
+	if cluster.EngineVersion != "" {
+		createInput.EngineVersion = aws.String(cluster.EngineVersion)
+	}
+	if cluster.DBName != "" {
+		createInput.DatabaseName = aws.String(cluster.DBName)
+	}
+	if cluster.BackupRetentionPeriod > 0 {
+		createInput.BackupRetentionPeriod = aws.Int32(int32(cluster.BackupRetentionPeriod))
+	}
+	if len(cluster.Tags) > 0 {
+		createInput.Tags = buildRDSTags(cluster.Tags)
+	}
+
+	createOutput, err := b.rdsClient.CreateDBCluster(ctx, createInput)
+	if err != nil {
+		return fmt.Errorf("failed to create Aurora cluster %s: %w", cluster.Identifier, err)
+	}
+
+	res.created()
+	if createOutput.DBCluster != nil {
+		res.ARN = aws.ToString(createOutput.DBCluster.DBClusterArn)
+	}
+	logger.Info("Created Aurora cluster", "cluster", cluster.Identifier)
+	return nil
+}
+
+// createAuroraInstance adds a DB instance to the cluster
+func (b *Bootstrapper) createAuroraInstance(ctx context.Context, cluster AuroraCluster, instance AuroraInstance) error {
+	logger.Info("Creating Aurora cluster instance", "cluster", cluster.Identifier,
+		"instance", instance.Identifier, "instance_class", instance.InstanceClass)
+
+	createInput := &rds.CreateDBInstanceInput{
+		DBInstanceIdentifier: aws.String(instance.Identifier),
+		DBClusterIdentifier:  aws.String(cluster.Identifier),
+		Engine:               aws.String(cluster.Engine),
+		DBInstanceClass:      aws.String(instance.InstanceClass),
+		PubliclyAccessible:   aws.Bool(instance.PubliclyAccessible),
+	}
+	if len(cluster.Tags) > 0 {
+		createInput.Tags = buildRDSTags(cluster.Tags)
+	}
+
+	if _, err := b.rdsClient.CreateDBInstance(ctx, createInput); err != nil {
+		return fmt.Errorf("failed to create instance %s in Aurora cluster %s: %w", instance.Identifier, cluster.Identifier, err)
+	}
+	logger.Info("Created Aurora cluster instance", "cluster", cluster.Identifier, "instance", instance.Identifier)
+	return nil
+}
+
+// reconcileAuroraCluster updates the backup retention, deletion protection and tags of an
+// existing cluster. Problems are recorded as warnings so the remaining resources still run.
+func (b *Bootstrapper) reconcileAuroraCluster(ctx context.Context, cluster AuroraCluster, existing rdstypes.DBCluster, res *ResourceResult) {
+	modifyInput := &rds.ModifyDBClusterInput{
+		DBClusterIdentifier: aws.String(cluster.Identifier),
+		ApplyImmediately:    aws.Bool(true),
+	}
+	changed := false
+
+	currentRetention := aws.ToInt32(existing.BackupRetentionPeriod)
+	if cluster.BackupRetentionPeriod > 0 && currentRetention != int32(cluster.BackupRetentionPeriod) {
+		modifyInput.BackupRetentionPeriod = aws.Int32(int32(cluster.BackupRetentionPeriod))
+		changed = true
+		logger.Info("Changing backup retention period", "cluster", cluster.Identifier,
+			"from_days", currentRetention, "to_days", cluster.BackupRetentionPeriod)
+	}
+
+	currentDeletionProtection := aws.ToBool(existing.DeletionProtection)
+	if currentDeletionProtection != cluster.DeletionProtection {
+		modifyInput.DeletionProtection = aws.Bool(cluster.DeletionProtection)
+		changed = true
+		logger.Info("Changing deletion protection", "cluster", cluster.Identifier,
+			"from", currentDeletionProtection, "to", cluster.DeletionProtection)
+	}
+
+	if changed {
+		if status := aws.ToString(existing.Status); status != "available" {
+			res.warnf("cannot modify Aurora cluster %s because it is in %s state. Must be 'available'",
+				cluster.Identifier, status)
+		} else if _, err := b.rdsClient.ModifyDBCluster(ctx, modifyInput); err != nil {
+			res.warnf("failed to modify Aurora cluster %s: %v", cluster.Identifier, err)
+		} else {
+			res.updated()
+			logger.Info("Modified Aurora cluster", "cluster", cluster.Identifier)
+		}
+	}
+
+	// Apply tags using the cluster ARN
+	if len(cluster.Tags) > 0 && existing.DBClusterArn != nil {
+		_, err := b.rdsClient.AddTagsToResource(ctx, &rds.AddTagsToResourceInput{
+			ResourceName: existing.DBClusterArn,
+			Tags:         buildRDSTags(cluster.Tags),
+		})
+		if err != nil {
+			res.warnf("failed to set tags for Aurora cluster %s: %v", cluster.Identifier, err)
+		} else {
+			res.updated()
+			logger.Info("Set Aurora cluster tags", "cluster", cluster.Identifier, "tags", len(cluster.Tags))
+		}
+	}
+	if b.pruneTags && existing.DBClusterArn != nil {
+		b.pruneRDSTags(ctx, "Aurora cluster", cluster.Identifier, existing.DBClusterArn, existing.TagList, cluster.Tags, res)
+	}
+}
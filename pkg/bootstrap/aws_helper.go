@@ -2,27 +2,286 @@ package bootstrap
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
 )
 
-// CheckAWSCredentials validates AWS credentials and returns information about the authenticated user
-func CheckAWSCredentials(ctx context.Context, region string) (string, error) {
-	// Load AWS configuration with environment variables prioritized
-	// The AWS SDK's default credential provider chain checks environment variables first,
-	// then falls back to other sources like instance role
-	cfg, err := config.LoadDefaultConfig(ctx,
+// defaultRoleSessionName is used when assuming a role without an explicit session name
+const defaultRoleSessionName = "cloud-bootstrap"
+
+// roleARNPattern matches IAM role ARNs in any partition, including role paths
+var roleARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::\d{12}:role/[\w+=,.@/-]+$`)
+
+// Retry defaults, used when the configuration and flags leave them unset
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryMode        = aws.RetryModeStandard
+)
+
+// mfaTokenPattern matches the 6-digit codes produced by MFA devices
+var mfaTokenPattern = regexp.MustCompile(`^\d{6}$`)
+
+// AWSOptions controls how the AWS configuration and credentials are loaded
+type AWSOptions struct {
+	// Profile selects a shared config profile, taking precedence over AWS_PROFILE
+	Profile string
+	// AssumeRoleARN, when set, is assumed on top of the default credentials and used for all calls
+	AssumeRoleARN string
+	// ExternalID is passed when assuming the role, if the role's trust policy requires one
+	ExternalID string
+	// RoleSessionName identifies the assumed role session; it defaults to "cloud-bootstrap"
+	RoleSessionName string
+	// MFASerial is the serial number or ARN of the MFA device required by the role
+	MFASerial string
+	// MFAToken is the current MFA code. When MFASerial is set and this is empty, the code
+	// is read from stdin.
+	MFAToken string
+
+	// RetryMaxAttempts is the maximum number of attempts per AWS call, including the first;
+	// it defaults to 3. Calls are retried with exponential backoff on throttling errors
+	// (Throttling, ThrottlingException, RequestLimitExceeded, TooManyRequestsException,
+	// SlowDown and similar), transient errors (RequestTimeout, InternalError), HTTP 500,
+	// 502, 503 and 504 responses, and connection failures. Other errors, such as
+	// AccessDenied or validation errors, are never retried.
+	RetryMaxAttempts int
+	// RetryMode is "standard" (the default) or "adaptive". Adaptive mode retries the same
+	// errors but also rate-limits requests on the client once throttling is seen, which
+	// helps large rollouts that keep hitting API limits.
+	RetryMode string
+
+	// EndpointURL sends every AWS call to a custom endpoint, such as LocalStack at
+	// http://localhost:4566, instead of the real AWS endpoints. The AWS_ENDPOINT_URL
+	// environment variable has the same effect. S3 uses path-style addressing when an
+	// endpoint is set.
+	EndpointURL string
+}
+
+// AWSOptions returns the AWS options set in the configuration file
+func (c *Config) AWSOptions() AWSOptions {
+	return AWSOptions{
+		AssumeRoleARN:    c.AssumeRoleARN,
+		ExternalID:       c.ExternalID,
+		RoleSessionName:  c.RoleSessionName,
+		MFASerial:        c.MFASerial,
+		RetryMaxAttempts: c.RetryMaxAttempts,
+		RetryMode:        c.RetryMode,
+	}
+}
+
+// validateRetryMode checks that mode is a retry mode supported by the SDK
+func validateRetryMode(mode string) error {
+	switch mode {
+	case "", string(aws.RetryModeStandard), string(aws.RetryModeAdaptive):
+		return nil
+	default:
+		return fmt.Errorf("retry mode must be standard or adaptive, got %q", mode)
+	}
+}
+
+// validateRoleARN checks that arn looks like an IAM role ARN
+func validateRoleARN(arn string) error {
+	if !roleARNPattern.MatchString(arn) {
+		return fmt.Errorf("%q is not a valid IAM role ARN (expected arn:aws:iam::<account-id>:role/<name>)", arn)
+	}
+	return nil
+}
+
+// LoadAWSConfig loads the AWS configuration with explicit region and retry options, then
+// applies the given options. The AWS SDK's default credential provider chain checks
+// environment variables first, then falls back to other sources like instance role.
+// Credentials are not retrieved until the first call is made.
+func LoadAWSConfig(ctx context.Context, region string, opts AWSOptions) (aws.Config, error) {
+	if opts.AssumeRoleARN != "" {
+		if err := validateRoleARN(opts.AssumeRoleARN); err != nil {
+			return aws.Config{}, err
+		}
+	}
+	if opts.MFASerial != "" && opts.AssumeRoleARN == "" {
+		return aws.Config{}, fmt.Errorf("an MFA serial requires a role to assume")
+	}
+	if opts.MFAToken != "" && !mfaTokenPattern.MatchString(opts.MFAToken) {
+		return aws.Config{}, fmt.Errorf("MFA token must be a 6-digit code")
+	}
+	if err := validateRetryMode(opts.RetryMode); err != nil {
+		return aws.Config{}, err
+	}
+	if opts.RetryMaxAttempts < 0 {
+		return aws.Config{}, fmt.Errorf("retry max attempts must not be negative")
+	}
+	if opts.EndpointURL != "" {
+		if endpoint, err := url.Parse(opts.EndpointURL); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return aws.Config{}, fmt.Errorf("endpoint URL %q must be an http or https URL", opts.EndpointURL)
+		}
+	}
+
+	maxAttempts := opts.RetryMaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	}
+	retryMode := aws.RetryMode(opts.RetryMode)
+	if retryMode == "" {
+		retryMode = defaultRetryMode
+	}
+
+	loadOptions := []func(*config.LoadOptions) error{
 		config.WithRegion(region),
-		config.WithRetryMaxAttempts(3),
-	)
+		config.WithRetryMaxAttempts(maxAttempts),
+		config.WithRetryMode(retryMode),
+		config.WithAPIOptions([]func(*middleware.Stack) error{addDebugRequestLogger}),
+	}
+	if opts.Profile != "" {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(opts.Profile))
+	}
+	// The base endpoint applies to every client built from the config, including STS
+	if opts.EndpointURL != "" {
+		loadOptions = append(loadOptions, config.WithBaseEndpoint(opts.EndpointURL))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, loadOptions...)
 	if err != nil {
-		return "", fmt.Errorf("failed to load AWS config: %w", err)
+		return aws.Config{}, err
 	}
 
+	// Wrap the base credentials so every client uses the assumed role
+	if opts.AssumeRoleARN != "" {
+		sessionName := opts.RoleSessionName
+		if sessionName == "" {
+			sessionName = defaultRoleSessionName
+		}
+
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), opts.AssumeRoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = sessionName
+			if opts.ExternalID != "" {
+				o.ExternalID = aws.String(opts.ExternalID)
+			}
+			if opts.MFASerial != "" {
+				o.SerialNumber = aws.String(opts.MFASerial)
+				o.TokenProvider = mfaTokenProvider(opts)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	return cfg, nil
+}
+
+// mfaTokenProvider returns the configured MFA token, or prompts for one on stdin
+func mfaTokenProvider(opts AWSOptions) func() (string, error) {
+	if opts.MFAToken != "" {
+		return func() (string, error) {
+			return opts.MFAToken, nil
+		}
+	}
+
+	return func() (string, error) {
+		fmt.Fprintf(os.Stderr, "Enter MFA code for %s: ", opts.MFASerial)
+		token, err := readLine(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read MFA token: %w", err)
+		}
+		if !mfaTokenPattern.MatchString(token) {
+			return "", fmt.Errorf("MFA token must be a 6-digit code")
+		}
+		return token, nil
+	}
+}
+
+// readLine reads a single line one byte at a time, so that no input meant for later
+// prompts is consumed
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(string(line)), nil
+}
+
+// wrapCredentialError turns a rejected MFA code into a clear error
+func wrapCredentialError(err error) error {
+	// STS has no dedicated error for this; the message of its AccessDenied error says why
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.ErrorMessage(), "MultiFactorAuthentication") {
+		return fmt.Errorf("invalid MFA token: %w", err)
+	}
+	return err
+}
+
+// CheckAWSCredentials validates AWS credentials and returns information about the authenticated user
+func CheckAWSCredentials(ctx context.Context, region string, opts AWSOptions) (*CallerIdentity, error) {
+	cfg, err := LoadAWSConfig(ctx, region, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return callerIdentity(ctx, cfg)
+}
+
+// CheckCredentials validates the bootstrapper's credentials and returns the identity of the
+// authenticated caller. Unlike CheckAWSCredentials it reuses the bootstrapper's session,
+// so an MFA code is only requested once. The account is remembered to check the accounts of
+// resource_roles against.
+func (b *Bootstrapper) CheckCredentials(ctx context.Context) (*CallerIdentity, error) {
+	identity, err := callerIdentity(ctx, b.awsConfig)
+	if err != nil {
+		return nil, err
+	}
+	b.account = identity.Account
+	return identity, nil
+}
+
+// accountID returns the account the current clients act in: the account of the role in
+// use, or the session's own account, which is looked up with GetCallerIdentity unless
+// CheckCredentials has already found it
+func (b *Bootstrapper) accountID(ctx context.Context) (string, error) {
+	if b.serviceClients.account != "" {
+		return b.serviceClients.account, nil
+	}
+	if b.account == "" {
+		identity, err := callerIdentity(ctx, b.awsConfig)
+		if err != nil {
+			return "", err
+		}
+		b.account = identity.Account
+	}
+	return b.account, nil
+}
+
+// CallerIdentity describes the principal the AWS credentials belong to
+type CallerIdentity struct {
+	// Account is the 12-digit ID of the account the principal belongs to
+	Account string
+	// ARN is the ARN of the user or assumed role
+	ARN string
+	// UserID is the unique ID of the principal
+	UserID string
+}
+
+// callerIdentity calls GetCallerIdentity and returns who the credentials belong to
+func callerIdentity(ctx context.Context, cfg aws.Config) (*CallerIdentity, error) {
 	// Create STS client
 	stsClient := sts.NewFromConfig(cfg)
 
@@ -41,15 +300,23 @@ func CheckAWSCredentials(ctx context.Context, region string) (string, error) {
 			credInfo += fmt.Sprintf("  - %s\n", source)
 		}
 
-		return "", fmt.Errorf("failed to validate AWS credentials: %w\n\nCredentials can be configured via:\n%s", err, credInfo)
+		return nil, fmt.Errorf("failed to validate AWS credentials: %w\n\nCredentials can be configured via:\n%s", wrapCredentialError(err), credInfo)
 	}
 
-	return aws.ToString(identity.Arn), nil
+	return &CallerIdentity{
+		Account: aws.ToString(identity.Account),
+		ARN:     aws.ToString(identity.Arn),
+		UserID:  aws.ToString(identity.UserId),
+	}, nil
 }
 
-// GetAWSProfileInfo returns information about the current AWS profile
-func GetAWSProfileInfo() string {
-	profile := os.Getenv("AWS_PROFILE")
+// GetAWSProfileInfo returns information about the AWS profile in use. A profile set in
+// opts takes precedence over the AWS_PROFILE environment variable.
+func GetAWSProfileInfo(opts AWSOptions) string {
+	profile := opts.Profile
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
 	if profile == "" {
 		profile = "default"
 	}
@@ -64,3 +331,15 @@ func GetAWSProfileInfo() string {
 
 	return fmt.Sprintf("AWS Profile: %s, Region: %s", profile, region)
 }
+
+// partitionForRegion returns the AWS partition a region belongs to
+func partitionForRegion(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	default:
+		return "aws"
+	}
+}
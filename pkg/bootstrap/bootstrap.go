@@ -2,38 +2,158 @@ package bootstrap
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"gopkg.in/yaml.v3"
 )
 
+// serviceClients is the AWS configuration of one session and the service clients built from it
+type serviceClients struct {
+	awsConfig aws.Config
+	// account is the account the clients act in, when it is known up front. It is set for
+	// the clients of a role, since the role's ARN names its account.
+	account string
+
+	s3Client        S3API
+	s3controlClient S3ControlAPI
+	ecrClient       ECRAPI
+	iamClient       IAMAPI
+	rdsClient       RDSAPI
+
+	route53Client Route53API
+	acmClient     ACMAPI
+	lambdaClient  LambdaAPI
+	secretsClient SecretsManagerAPI
+	ec2Client     EC2API
+	eventsClient  EventBridgeAPI
+
+	// regional caches the clients built from the same credentials for other regions; see
+	// inRegion. Copies of the clients share it.
+	regional map[string]serviceClients
+}
+
+// newServiceClients builds every service client from the AWS configuration
+func newServiceClients(awsConfig aws.Config) serviceClients {
+	return serviceClients{
+		awsConfig: awsConfig,
+		s3Client: s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+			// Emulators such as LocalStack serve every bucket from a single host
+			o.UsePathStyle = awsConfig.BaseEndpoint != nil
+		}),
+		s3controlClient: s3control.NewFromConfig(awsConfig),
+		ecrClient:       ecr.NewFromConfig(awsConfig),
+		iamClient:       iam.NewFromConfig(awsConfig),
+		rdsClient:       rds.NewFromConfig(awsConfig),
+
+		route53Client: route53.NewFromConfig(awsConfig),
+		acmClient:     acm.NewFromConfig(awsConfig),
+		lambdaClient:  lambda.NewFromConfig(awsConfig),
+		secretsClient: secretsmanager.NewFromConfig(awsConfig),
+		ec2Client:     ec2.NewFromConfig(awsConfig),
+		eventsClient:  eventbridge.NewFromConfig(awsConfig),
+
+		regional: make(map[string]serviceClients),
+	}
+}
+
+// serviceClients wraps the given clients in a session for region
+func (c Clients) serviceClients(region string) serviceClients {
+	return serviceClients{
+		awsConfig: aws.Config{Region: region},
+		account:   c.Account,
+
+		s3Client:        c.S3,
+		s3controlClient: c.S3Control,
+		ecrClient:       c.ECR,
+		iamClient:       c.IAM,
+		rdsClient:       c.RDS,
+
+		route53Client: c.Route53,
+		acmClient:     c.ACM,
+		lambdaClient:  c.Lambda,
+		secretsClient: c.SecretsManager,
+		ec2Client:     c.EC2,
+		eventsClient:  c.EventBridge,
+
+		regional: make(map[string]serviceClients),
+	}
+}
+
 // Bootstrapper handles AWS resource provisioning
 type Bootstrapper struct {
-	awsConfig aws.Config
-	ctx       context.Context
+	// serviceClients are the clients calls are made with: the session's own, or those of
+	// the role that provisions the current resource type
+	serviceClients
+
+	// roleClients caches the clients of the roles in resource_roles by role ARN, and account
+	// is the account of the session's own credentials once CheckCredentials has run
+	roleClients map[string]serviceClients
+	account     string
+
+	// pruneTags removes tags that are on a resource but not in its configuration
+	pruneTags bool
+	// importing adopts existing resources, removing the settings their configuration
+	// leaves out; see SetImport
+	importing bool
+
+	// iamRetryAttempts and iamRetryInterval bound the retries of IAM calls made right after
+	// the entities they refer to were created; see SetIAMRetry
+	iamRetryAttempts int
+	iamRetryInterval time.Duration
+
+	// policyDiff receives a diff of every managed policy document that changes; see SetPolicyDiff
+	policyDiff io.Writer
+
+	// continueOnError and maxErrors let a run carry on past failed resources, which are
+	// collected in failures; see SetContinueOnError
+	continueOnError bool
+	maxErrors       int
+	failures        []error
+
+	// credentialsOut is the file the credentials generated so far are written to; see
+	// SetCredentialsOut
+	credentialsOut string
+	credentials    []Credential
+
+	// appliedHashes are the configuration hashes of the last successful apply; resources
+	// that still hash the same are skipped. See SetIncremental.
+	appliedHashes map[string]string
+
+	// timeouts are the timeouts configured per resource type or resource; resources without
+	// one use defaultTimeouts
+	timeouts map[string]string
+
+	// buckets caches what the run has looked up about bucket names, so each name costs one
+	// HeadBucket and one GetBucketLocation call at most
+	buckets map[string]*bucketState
 }
 
-// NewBootstrapper creates a new Bootstrapper instance
-func NewBootstrapper(region string) (*Bootstrapper, error) {
-	ctx := context.TODO()
-
-	// Load AWS configuration with explicit region and retry options
-	// The AWS SDK's default credential provider chain checks environment variables first,
-	// then falls back to other sources like instance role
-	awsConfig, err := config.LoadDefaultConfig(ctx,
-		config.WithRegion(region),
-		config.WithRetryMaxAttempts(3),
-		config.WithRetryMode(aws.RetryModeStandard),
-	)
+// NewBootstrapper creates a new Bootstrapper instance. The context is only used while
+// loading the AWS configuration; each provisioning call takes its own context.
+func NewBootstrapper(ctx context.Context, region string, opts AWSOptions) (*Bootstrapper, error) {
+	if err := validateRegion(region); err != nil {
+		return nil, fmt.Errorf("invalid region: %w", err)
+	}
+
+	awsConfig, err := LoadAWSConfig(ctx, region, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize AWS config: %w", err)
 	}
@@ -41,476 +161,275 @@ func NewBootstrapper(region string) (*Bootstrapper, error) {
 	// Validate that AWS credentials are available
 	_, err = awsConfig.Credentials.Retrieve(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+		return nil, fmt.Errorf("failed to retrieve AWS credentials: %w", wrapCredentialError(err))
 	}
 
-	return &Bootstrapper{
-		awsConfig: awsConfig,
-		ctx:       ctx,
-	}, nil
+	return &Bootstrapper{serviceClients: newServiceClients(awsConfig)}, nil
+}
+
+// NewBootstrapperWithClients creates a Bootstrapper that uses the given service clients
+// instead of building them from the default AWS configuration. This is mainly useful for tests.
+func NewBootstrapperWithClients(region string, clients Clients) *Bootstrapper {
+	return &Bootstrapper{serviceClients: clients.serviceClients(region)}
+}
+
+// SetPruneTags controls whether tags missing from the configuration are removed from existing
+// resources. It is off by default so tags added outside this tool are left alone.
+func (b *Bootstrapper) SetPruneTags(prune bool) {
+	b.pruneTags = prune
 }
 
-// LoadConfig loads the configuration from a YAML file
+// LoadConfig loads the configuration from a YAML or JSON file, expanding ${VAR} and
+// ${VAR:-default} references to environment variables first. Files ending in .json are
+// parsed as JSON; everything else is parsed as YAML.
 func LoadConfig(filename string) (*Config, error) {
-	data, err := os.ReadFile(filename)
+	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
+	defer file.Close()
 
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("error parsing YAML: %w", err)
+	config, err := LoadConfigFrom(file, filename)
+	if err != nil {
+		return nil, err
 	}
 
-	return &config, nil
-}
+	// Policy files are referenced relative to the config file's directory
+	config.resolvePaths(filepath.Dir(filename))
 
-// ProvisionResources provisions all resources defined in the configuration
-func (b *Bootstrapper) ProvisionResources(config *Config) error {
-	// Create S3 buckets
-	if err := b.CreateS3Buckets(config.S3Buckets); err != nil {
-		return fmt.Errorf("failed to create S3 buckets: %w", err)
-	}
+	return config, nil
+}
 
-	// Create ECR repositories
-	if err := b.CreateECRRepositories(config.ECRRepositories); err != nil {
-		return fmt.Errorf("failed to create ECR repositories: %w", err)
+// LoadConfigFrom parses a configuration read from r, expanding environment variables
+// first. name is used in error messages and picks the format: names ending in .json are
+// parsed as JSON, everything else as YAML. Relative policy files are left relative to the
+// working directory.
+func LoadConfigFrom(r io.Reader, name string) (*Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config %s: %w", name, err)
 	}
 
-	// Create IAM users and policies
-	if err := b.CreateIAMUsersAndPolicies(config.IAMUsers); err != nil {
-		return fmt.Errorf("failed to create IAM users and policies: %w", err)
+	data, err = expandEnv(data, name)
+	if err != nil {
+		return nil, err
 	}
 
-	// Manage RDS instances
-	if err := b.ManageRDSInstances(config.RDSInstances); err != nil {
-		return fmt.Errorf("failed to manage RDS instances: %w", err)
+	var config Config
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("error parsing JSON: %w", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("error parsing YAML: %w", err)
+		}
 	}
 
-	return nil
+	return &config, nil
 }
 
-// CreateS3Buckets creates S3 buckets based on the configuration
-func (b *Bootstrapper) CreateS3Buckets(buckets []S3Bucket) error {
-	s3Client := s3.NewFromConfig(b.awsConfig)
+// resolvePaths rewrites relative file references in the config to be relative to baseDir
+func (c *Config) resolvePaths(baseDir string) {
+	for i := range c.S3Buckets {
+		c.S3Buckets[i].PolicyFile = resolvePath(baseDir, c.S3Buckets[i].PolicyFile)
+	}
+	for i := range c.ECRRepositories {
+		c.ECRRepositories[i].LifecyclePolicyFile = resolvePath(baseDir, c.ECRRepositories[i].LifecyclePolicyFile)
+	}
+	for i := range c.LambdaFunctions {
+		c.LambdaFunctions[i].ZipFile = resolvePath(baseDir, c.LambdaFunctions[i].ZipFile)
+	}
+	for i := range c.KeyPairs {
+		c.KeyPairs[i].PublicKeyFile = resolvePath(baseDir, c.KeyPairs[i].PublicKeyFile)
+	}
+}
 
-	for _, bucket := range buckets {
-		fmt.Printf("Ensuring S3 bucket: %s\n", bucket.Name)
+// resolvePath joins a relative path onto baseDir, leaving empty and absolute paths untouched
+func resolvePath(baseDir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
 
-		// Check if bucket exists
-		_, err := s3Client.HeadBucket(b.ctx, &s3.HeadBucketInput{
-			Bucket: aws.String(bucket.Name),
-		})
+// loadPolicy returns the inline policy or the contents of the policy file, whichever is set
+func loadPolicy(inline, file string) (string, error) {
+	if inline != "" && file != "" {
+		return "", fmt.Errorf("only one of an inline policy or a policy file (%s) may be set", file)
+	}
+	if file == "" {
+		return inline, nil
+	}
 
-		if err != nil {
-			// Bucket doesn't exist, create it
-			createBucketInput := &s3.CreateBucketInput{
-				Bucket: aws.String(bucket.Name),
-			}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read policy file: %w", err)
+	}
+	return string(data), nil
+}
 
-			// Add location constraint if not in us-east-1
-			if b.awsConfig.Region != "us-east-1" {
-				createBucketInput.CreateBucketConfiguration = &types.CreateBucketConfiguration{
-					LocationConstraint: types.BucketLocationConstraint(b.awsConfig.Region),
-				}
-			}
+// ProvisionResources provisions all resources defined in the configuration and
+// returns the outcome for every resource it touched. The result is returned even
+// when provisioning stops early because of an error.
+func (b *Bootstrapper) ProvisionResources(ctx context.Context, config *Config) (*ProvisionResult, error) {
+	result := &ProvisionResult{}
 
-			_, err = s3Client.CreateBucket(b.ctx, createBucketInput)
-			if err != nil {
-				return fmt.Errorf("failed to create bucket %s: %w", bucket.Name, err)
-			}
-			fmt.Printf("✅ Created bucket: %s\n", bucket.Name)
-		} else {
-			fmt.Printf("✅ Bucket %s already exists\n", bucket.Name)
-		}
+	if err := config.Validate(); err != nil {
+		return result, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := b.checkSessionRegion(config); err != nil {
+		return result, err
+	}
+	b.timeouts = config.Timeouts
+
+	// Leave out disabled resources, then stamp the top-level tags onto the rest
+	config = config.withoutDisabled().withGlobalTags()
+	b.warnCrossAccount(config)
+
+	// In incremental mode only new and changed resources are provisioned; the whole
+	// config is still used to look up the resources they reference
+	full := config
+	hashes := config.configHashes()
+	if b.appliedHashes != nil {
+		config, result.Skipped = config.withoutUnchanged(hashes, b.appliedHashes)
+	}
 
-		// Configure versioning
-		if bucket.Versioning == "enabled" {
-			_, err = s3Client.PutBucketVersioning(b.ctx, &s3.PutBucketVersioningInput{
-				Bucket: aws.String(bucket.Name),
-				VersioningConfiguration: &types.VersioningConfiguration{
-					Status: types.BucketVersioningStatusEnabled,
-				},
-			})
-			if err != nil {
-				fmt.Printf("⚠️ Warning: failed to enable versioning for bucket %s: %v\n", bucket.Name, err)
-			} else {
-				fmt.Printf("✅ Enabled versioning for bucket: %s\n", bucket.Name)
-			}
-		}
+	// Provision in dependency order, so referenced resources exist before the resources
+	// that reference them
+	stages, err := config.provisionOrder()
+	if err != nil {
+		return result, fmt.Errorf("invalid configuration: %w", err)
+	}
 
-		// Configure encryption
-		if bucket.Encryption != "" {
-			_, err = s3Client.PutBucketEncryption(b.ctx, &s3.PutBucketEncryptionInput{
-				Bucket: aws.String(bucket.Name),
-				ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{
-					Rules: []types.ServerSideEncryptionRule{
-						{
-							ApplyServerSideEncryptionByDefault: &types.ServerSideEncryptionByDefault{
-								SSEAlgorithm: types.ServerSideEncryptionAes256,
-							},
-						},
-					},
-				},
+	// Check everything that can be checked without writing before the first write
+	if err := b.preflight(ctx, config, stages); err != nil {
+		return result, fmt.Errorf("preflight checks failed, nothing was changed: %w", err)
+	}
+	b.failures = nil
+	if config.PasswordPolicy != nil {
+		policyRes := newResourceResult(ResourceTypePasswordPolicy, passwordPolicyName)
+		err := b.withResourceRole(ctx, config, ResourceTypePasswordPolicy, func() error {
+			return b.withResourceTimeout(ctx, policyRes, func(ctx context.Context) error {
+				return b.ensurePasswordPolicy(ctx, *config.PasswordPolicy, policyRes)
 			})
-			if err != nil {
-				fmt.Printf("⚠️ Warning: failed to configure encryption for bucket %s: %v\n", bucket.Name, err)
-			} else {
-				fmt.Printf("✅ Configured encryption for bucket: %s\n", bucket.Name)
+		})
+		res := policyRes.finish(err)
+		res.configHash = hashes[stateKey(res.Type, res.Name)]
+		result.Resources = append(result.Resources, res)
+		if err != nil && !b.tolerate(err) {
+			if b.limitExceeded() {
+				return result, b.failuresError(true)
 			}
+			return result, err
 		}
-
-		// Configure CORS
-		if bucket.CORS != nil {
-			corsRules := []types.CORSRule{
-				{
-					AllowedOrigins: bucket.CORS.AllowedOrigins,
-					AllowedMethods: convertToMethodsEnum(bucket.CORS.AllowedMethods),
-					AllowedHeaders: bucket.CORS.AllowedHeaders,
-					ExposeHeaders:  bucket.CORS.ExposeHeaders,
-					MaxAgeSeconds:  aws.Int32(int32(bucket.CORS.MaxAgeSeconds)),
-				},
-			}
-
-			_, err = s3Client.PutBucketCors(b.ctx, &s3.PutBucketCorsInput{
-				Bucket: aws.String(bucket.Name),
-				CORSConfiguration: &types.CORSConfiguration{
-					CORSRules: corsRules,
-				},
-			})
-			if err != nil {
-				fmt.Printf("⚠️ Warning: failed to configure CORS for bucket %s: %v\n", bucket.Name, err)
-			} else {
-				fmt.Printf("✅ Configured CORS for bucket: %s\n", bucket.Name)
-			}
+	}
+	for _, stage := range stages {
+		var results []ResourceResult
+		err := b.withResourceRole(ctx, config, stage.Type, func() error {
+			var err error
+			results, err = b.provisionStage(ctx, stage, full)
+			return err
+		})
+		for i := range results {
+			results[i].configHash = hashes[stateKey(results[i].Type, results[i].Name)]
 		}
-
-		// Configure bucket policy
-		if bucket.Policy != "" {
-			_, err = s3Client.PutBucketPolicy(b.ctx, &s3.PutBucketPolicyInput{
-				Bucket: aws.String(bucket.Name),
-				Policy: aws.String(bucket.Policy),
-			})
-			if err != nil {
-				fmt.Printf("⚠️ Warning: failed to set policy for bucket %s: %v\n", bucket.Name, err)
-			} else {
-				fmt.Printf("✅ Set policy for bucket: %s\n", bucket.Name)
+		result.Resources = append(result.Resources, results...)
+		if err != nil {
+			// A failure past the limit ends the run with every failure collected so far
+			if b.limitExceeded() {
+				return result, b.failuresError(true)
 			}
+			return result, err
 		}
 	}
 
-	return nil
+	return result, b.failuresError(false)
 }
 
-// CreateECRRepositories creates ECR repositories based on the configuration
-func (b *Bootstrapper) CreateECRRepositories(repositories []ECRRepository) error {
-	ecrClient := ecr.NewFromConfig(b.awsConfig)
-
-	for _, repo := range repositories {
-		fmt.Printf("Ensuring ECR repository: %s\n", repo.Name)
-
-		// Check if repository exists
-		_, err := ecrClient.DescribeRepositories(b.ctx, &ecr.DescribeRepositoriesInput{
-			RepositoryNames: []string{repo.Name},
-		})
-
+// provisionStage provisions the resources of one stage with the call for their type. full
+// is the whole config, for resources that look up others they reference.
+func (b *Bootstrapper) provisionStage(ctx context.Context, stage provisionStage, full *Config) ([]ResourceResult, error) {
+	config := stage.Config
+	switch stage.Type {
+	case ResourceTypeS3:
+		results, err := b.CreateS3Buckets(ctx, config.S3Buckets)
 		if err != nil {
-			// Repository doesn't exist, create it
-			_, err = ecrClient.CreateRepository(b.ctx, &ecr.CreateRepositoryInput{
-				RepositoryName: aws.String(repo.Name),
-			})
-			if err != nil {
-				return fmt.Errorf("failed to create ECR repository %s: %w", repo.Name, err)
-			}
-			fmt.Printf("✅ Created ECR repository: %s\n", repo.Name)
-		} else {
-			fmt.Printf("✅ ECR repository %s already exists\n", repo.Name)
+			return results, fmt.Errorf("failed to create S3 buckets: %w", err)
 		}
-
-		// Set lifecycle policy if provided
-		if repo.LifecyclePolicy != "" {
-			_, err = ecrClient.PutLifecyclePolicy(b.ctx, &ecr.PutLifecyclePolicyInput{
-				RepositoryName:      aws.String(repo.Name),
-				LifecyclePolicyText: aws.String(repo.LifecyclePolicy),
-			})
-			if err != nil {
-				fmt.Printf("⚠️ Warning: failed to set lifecycle policy for ECR repository %s: %v\n", repo.Name, err)
-			} else {
-				fmt.Printf("✅ Set lifecycle policy for ECR repository: %s\n", repo.Name)
-			}
+		return results, nil
+	case ResourceTypeECR:
+		results, err := b.CreateECRRepositories(ctx, config.ECRRepositories)
+		if err != nil {
+			return results, fmt.Errorf("failed to create ECR repositories: %w", err)
 		}
-	}
-
-	return nil
-}
-
-// CreateIAMUsersAndPolicies creates IAM users and policies based on the configuration
-func (b *Bootstrapper) CreateIAMUsersAndPolicies(users []IAMUser) error {
-	iamClient := iam.NewFromConfig(b.awsConfig)
-
-	for _, user := range users {
-		fmt.Printf("Ensuring IAM user: %s\n", user.Name)
-
-		// Check if user exists
-		_, err := iamClient.GetUser(b.ctx, &iam.GetUserInput{
-			UserName: aws.String(user.Name),
-		})
-
+		return results, nil
+	case ResourceTypeIAMGroup:
+		results, err := b.CreateIAMGroups(ctx, config.IAMGroups)
 		if err != nil {
-			// User doesn't exist, create it
-			_, err = iamClient.CreateUser(b.ctx, &iam.CreateUserInput{
-				UserName: aws.String(user.Name),
-			})
-			if err != nil {
-				return fmt.Errorf("failed to create IAM user %s: %w", user.Name, err)
-			}
-			fmt.Printf("✅ Created IAM user: %s\n", user.Name)
-		} else {
-			fmt.Printf("✅ IAM user %s already exists\n", user.Name)
+			return results, fmt.Errorf("failed to create IAM groups: %w", err)
 		}
-
-		// Create and attach policies
-		for _, policy := range user.Policies {
-			policyArn, err := b.createIAMPolicy(iamClient, user.Name, policy)
-			if err != nil {
-				return err
-			}
-
-			// Attach policy to user
-			_, err = iamClient.AttachUserPolicy(b.ctx, &iam.AttachUserPolicyInput{
-				UserName:  aws.String(user.Name),
-				PolicyArn: aws.String(policyArn),
-			})
-			if err != nil {
-				// Check if policy is already attached (which is fine)
-				if strings.Contains(err.Error(), "EntityAlreadyExists") {
-					fmt.Printf("✅ Policy %s already attached to user %s\n", policy.Name, user.Name)
-				} else {
-					fmt.Printf("⚠️ Warning: failed to attach policy %s to user %s: %v\n", policy.Name, user.Name, err)
-				}
-			} else {
-				fmt.Printf("✅ Attached policy %s to user %s\n", policy.Name, user.Name)
-			}
+		return results, nil
+	case ResourceTypeIAM:
+		results, err := b.CreateIAMUsersAndPolicies(ctx, config.IAMUsers)
+		if err != nil {
+			return results, fmt.Errorf("failed to create IAM users and policies: %w", err)
 		}
-	}
-
-	return nil
-}
-
-// createIAMPolicy creates or updates an IAM policy and returns its ARN
-func (b *Bootstrapper) createIAMPolicy(iamClient *iam.Client, userName string, policy IAMPolicy) (string, error) {
-	// Create policy name with user prefix to avoid conflicts
-	fullPolicyName := fmt.Sprintf("%s-%s", userName, policy.Name)
-
-	// Check if policy exists
-	listPoliciesOutput, err := iamClient.ListPolicies(b.ctx, &iam.ListPoliciesInput{
-		Scope: "Local",
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to list IAM policies: %w", err)
-	}
-
-	for _, p := range listPoliciesOutput.Policies {
-		if *p.PolicyName == fullPolicyName {
-			fmt.Printf("✅ IAM policy %s already exists, updating policy document\n", fullPolicyName)
-
-			// Get the policy version to update
-			policyArn := *p.Arn
-
-			// Create a new version of the policy (this effectively updates it)
-			_, err := iamClient.CreatePolicyVersion(b.ctx, &iam.CreatePolicyVersionInput{
-				PolicyArn:      aws.String(policyArn),
-				PolicyDocument: aws.String(policy.PolicyDocument),
-				SetAsDefault:   true,
-			})
-			if err != nil {
-				return "", fmt.Errorf("failed to update IAM policy %s: %w", fullPolicyName, err)
-			}
-
-			fmt.Printf("✅ Updated IAM policy: %s\n", fullPolicyName)
-			return policyArn, nil
+		return results, nil
+	case ResourceTypeRDS:
+		results, err := b.ManageRDSInstances(ctx, config.RDSInstances)
+		if err != nil {
+			return results, fmt.Errorf("failed to manage RDS instances: %w", err)
 		}
-	}
-
-	// Policy doesn't exist, create it
-	createPolicyOutput, err := iamClient.CreatePolicy(b.ctx, &iam.CreatePolicyInput{
-		PolicyName:     aws.String(fullPolicyName),
-		Description:    aws.String(policy.Description),
-		PolicyDocument: aws.String(policy.PolicyDocument),
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to create IAM policy %s: %w", fullPolicyName, err)
-	}
-
-	fmt.Printf("✅ Created IAM policy: %s\n", fullPolicyName)
-	return *createPolicyOutput.Policy.Arn, nil
-}
-
-// Helper function to convert methods to uppercase
-func convertToMethodsEnum(methods []string) []string {
-	result := make([]string, len(methods))
-	for i, method := range methods {
-		result[i] = strings.ToUpper(method)
-	}
-	return result
-}
-
-// ManageRDSInstances creates or modifies RDS instances based on the configuration
-func (b *Bootstrapper) ManageRDSInstances(instances []RDSInstance) error {
-	// Skip if no instances are defined
-	if len(instances) == 0 {
-		return nil
-	}
-
-	// Create RDS client
-	rdsClient := rds.NewFromConfig(b.awsConfig)
-
-	for _, instance := range instances {
-		fmt.Printf("Ensuring RDS instance: %s\n", instance.Identifier)
-
-		// Check if the instance exists
-		describeInput := &rds.DescribeDBInstancesInput{
-			DBInstanceIdentifier: aws.String(instance.Identifier),
+		return results, nil
+	case ResourceTypeAurora:
+		results, err := b.ManageAuroraClusters(ctx, config.AuroraClusters)
+		if err != nil {
+			return results, fmt.Errorf("failed to manage Aurora clusters: %w", err)
 		}
-
-		describeOutput, err := rdsClient.DescribeDBInstances(b.ctx, describeInput)
-
+		return results, nil
+	case ResourceTypeHostedZone:
+		results, err := b.CreateHostedZones(ctx, config.HostedZones)
 		if err != nil {
-			// Instance doesn't exist, create it
-			if strings.Contains(err.Error(), "DBInstanceNotFound") {
-				// Create new RDS instance
-				fmt.Printf("Creating new RDS instance: %s\n", instance.Identifier)
-
-				// Set up creation parameters
-				createInput := &rds.CreateDBInstanceInput{
-					DBInstanceIdentifier: aws.String(instance.Identifier),
-					Engine:               aws.String(instance.Engine),
-					DBInstanceClass:      aws.String(instance.InstanceClass),
-					AllocatedStorage:     aws.Int32(int32(instance.AllocatedStorage)),
-					DBName:               aws.String(instance.DBName),
-				}
-
-				// Add optional parameters if provided
-				if instance.EngineVersion != "" {
-					createInput.EngineVersion = aws.String(instance.EngineVersion)
-				}
-
-				if instance.StorageType != "" {
-					createInput.StorageType = aws.String(instance.StorageType)
-				}
-
-				if instance.MasterUsername != "" {
-					createInput.MasterUsername = aws.String(instance.MasterUsername)
-				}
-
-				if instance.MasterPassword != "" {
-					createInput.MasterUserPassword = aws.String(instance.MasterPassword)
-				}
-
-				createInput.PubliclyAccessible = aws.Bool(instance.PubliclyAccessible)
-
-				if instance.BackupRetentionPeriod > 0 {
-					createInput.BackupRetentionPeriod = aws.Int32(int32(instance.BackupRetentionPeriod))
-				}
-
-				createInput.MultiAZ = aws.Bool(instance.MultiAZ)
-
-				// Handle final snapshot setting
-				// For AWS SDK compatibility, we need to adapt our configuration to the actual API fields
-				// SkipFinalSnapshot is handled differently in the AWS SDK
-				if instance.SkipFinalSnapshot {
-					// When skipping final snapshot, no need to specify a snapshot ID
-					// This is the equivalent of setting SkipFinalSnapshot to true
-				} else {
-					// When not skipping, we need to provide a snapshot ID
-					// The AWS SDK requires this field when not skipping the final snapshot
-					createInput.DBName = aws.String(fmt.Sprintf("%s-final-snapshot", instance.Identifier))
-				}
-
-				// Create the instance
-				_, err = rdsClient.CreateDBInstance(b.ctx, createInput)
-				if err != nil {
-					return fmt.Errorf("failed to create RDS instance %s: %w", instance.Identifier, err)
-				}
-
-				fmt.Printf("✅ Created RDS instance: %s\n", instance.Identifier)
-			} else {
-				// Some other error occurred
-				return fmt.Errorf("error checking RDS instance %s: %w", instance.Identifier, err)
-			}
-		} else {
-			// Instance exists, check if we need to modify it
-			if len(describeOutput.DBInstances) > 0 {
-				existingInstance := describeOutput.DBInstances[0]
-
-				// Get current storage size (safely handle nil pointer)
-				var currentStorage int32
-				if existingInstance.AllocatedStorage != nil {
-					currentStorage = *existingInstance.AllocatedStorage
-				}
-
-				// Check if storage size needs to be updated
-				if currentStorage != int32(instance.AllocatedStorage) {
-					fmt.Printf("Modifying storage size for RDS instance %s from %d GB to %d GB\n",
-						instance.Identifier, currentStorage, instance.AllocatedStorage)
-
-					// Check if the instance is in a modifiable state (safely handle nil pointer)
-					var instanceStatus string
-					if existingInstance.DBInstanceStatus != nil {
-						instanceStatus = *existingInstance.DBInstanceStatus
-					}
-
-					if instanceStatus != "available" {
-						fmt.Printf("⚠️ Warning: Cannot modify RDS instance %s because it is in %s state. Must be 'available'.\n",
-							instance.Identifier, instanceStatus)
-						continue
-					}
-
-					// Modify the instance storage
-					modifyInput := &rds.ModifyDBInstanceInput{
-						DBInstanceIdentifier: aws.String(instance.Identifier),
-						AllocatedStorage:     aws.Int32(int32(instance.AllocatedStorage)),
-						ApplyImmediately:     aws.Bool(true),
-					}
-
-					_, err = rdsClient.ModifyDBInstance(b.ctx, modifyInput)
-					if err != nil {
-						fmt.Printf("⚠️ Warning: failed to modify storage for RDS instance %s: %v\n", instance.Identifier, err)
-					} else {
-						fmt.Printf("✅ Modified storage for RDS instance %s to %d GB\n",
-							instance.Identifier, instance.AllocatedStorage)
-						fmt.Printf("   Note: Storage modification is in progress and may take several minutes to complete\n")
-					}
-				} else {
-					fmt.Printf("✅ RDS instance %s already exists with correct storage size (%d GB)\n",
-						instance.Identifier, currentStorage)
-				}
-
-				// Check if instance class needs to be updated (safely handle nil pointer)
-				var currentInstanceClass string
-				if existingInstance.DBInstanceClass != nil {
-					currentInstanceClass = *existingInstance.DBInstanceClass
-				}
-
-				if currentInstanceClass != "" && currentInstanceClass != instance.InstanceClass {
-					fmt.Printf("Instance class change detected (%s -> %s), but not implemented in this version\n",
-						currentInstanceClass, instance.InstanceClass)
-				}
-
-				// Check if engine version needs to be updated (safely handle nil pointer)
-				var currentEngineVersion string
-				if existingInstance.EngineVersion != nil {
-					currentEngineVersion = *existingInstance.EngineVersion
-				}
-
-				if instance.EngineVersion != "" && currentEngineVersion != "" &&
-					currentEngineVersion != instance.EngineVersion {
-					fmt.Printf("Engine version change detected (%s -> %s), but not implemented in this version\n",
-						currentEngineVersion, instance.EngineVersion)
-				}
-			}
+			return results, fmt.Errorf("failed to create hosted zones: %w", err)
 		}
+		return results, nil
+	case ResourceTypeCertificate:
+		results, err := b.RequestCertificates(ctx, config.Certificates, full.HostedZones)
+		if err != nil {
+			return results, fmt.Errorf("failed to request certificates: %w", err)
+		}
+		return results, nil
+	case ResourceTypeLambda:
+		results, err := b.CreateLambdaFunctions(ctx, config.LambdaFunctions)
+		if err != nil {
+			return results, fmt.Errorf("failed to create Lambda functions: %w", err)
+		}
+		return results, nil
+	case ResourceTypeVPC:
+		results, err := b.CreateVPCs(ctx, config.VPCs)
+		if err != nil {
+			return results, fmt.Errorf("failed to create VPCs: %w", err)
+		}
+		return results, nil
+	case ResourceTypeKeyPair:
+		results, err := b.CreateKeyPairs(ctx, config.KeyPairs)
+		if err != nil {
+			return results, fmt.Errorf("failed to create key pairs: %w", err)
+		}
+		return results, nil
+	case ResourceTypeSecurityGroup:
+		results, err := b.CreateSecurityGroups(ctx, config.SecurityGroups)
+		if err != nil {
+			return results, fmt.Errorf("failed to create security groups: %w", err)
+		}
+		return results, nil
+	case ResourceTypeEventBridgeRule:
+		results, err := b.CreateEventBridgeRules(ctx, config.EventBridgeRules)
+		if err != nil {
+			return results, fmt.Errorf("failed to create EventBridge rules: %w", err)
+		}
+		return results, nil
 	}
-
-	return nil
+	return nil, fmt.Errorf("unknown resource type %q", stage.Type)
 }
@@ -0,0 +1,89 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// defaultConfigSourceRegion is used to fetch s3:// configs when no region is configured in
+// the environment or profile. The config itself has not been read yet, so its region is
+// not available.
+const defaultConfigSourceRegion = "us-east-1"
+
+// LoadConfigSource loads a configuration from a local file, from stdin when source is "-",
+// from an http:// or https:// URL, or from an s3://bucket/key object. S3 objects are read
+// with the AWS session described by opts.
+func LoadConfigSource(ctx context.Context, source string, opts AWSOptions) (*Config, error) {
+	switch {
+	case source == "-":
+		return LoadConfigFrom(os.Stdin, "stdin")
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		return loadConfigURL(ctx, source)
+	case strings.HasPrefix(source, "s3://"):
+		return loadConfigS3(ctx, source, opts)
+	default:
+		return LoadConfig(source)
+	}
+}
+
+// loadConfigURL fetches a configuration over HTTP
+func loadConfigURL(ctx context.Context, source string) (*Config, error) {
+	// The URL path, not the query string, decides whether the config is JSON
+	parsed, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config URL %s: %w", source, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config URL %s: %w", source, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch config %s: %w", source, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch config %s: %s", source, resp.Status)
+	}
+	return LoadConfigFrom(resp.Body, parsed.Path)
+}
+
+// loadConfigS3 reads a configuration from an S3 object
+func loadConfigS3(ctx context.Context, source string, opts AWSOptions) (*Config, error) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(source, "s3://"), "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid config location %s: must be s3://bucket/key", source)
+	}
+
+	// An empty region lets the environment or profile choose one
+	awsConfig, err := LoadAWSConfig(ctx, "", opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize AWS config: %w", err)
+	}
+	if awsConfig.Region == "" {
+		awsConfig.Region = defaultConfigSourceRegion
+	}
+	client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		o.UsePathStyle = awsConfig.BaseEndpoint != nil
+	})
+
+	output, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch config %s: %w", source, err)
+	}
+	defer output.Body.Close()
+
+	return LoadConfigFrom(output.Body, key)
+}
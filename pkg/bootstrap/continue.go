@@ -0,0 +1,46 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SetContinueOnError lets provisioning carry on past resources that fail, collecting their
+// errors, instead of stopping at the first one. It stops once more than maxErrors resources
+// have failed; maxErrors 0 means there is no limit.
+func (b *Bootstrapper) SetContinueOnError(enabled bool, maxErrors int) {
+	b.continueOnError = enabled
+	b.maxErrors = maxErrors
+}
+
+// tolerate records the failure of a resource and reports whether provisioning may go on
+// with the next one
+func (b *Bootstrapper) tolerate(err error) bool {
+	if !b.continueOnError {
+		return false
+	}
+	b.failures = append(b.failures, err)
+	if b.limitExceeded() {
+		return false
+	}
+	logger.Warn("Resource failed, continuing", "error", err, "failures", len(b.failures))
+	return true
+}
+
+// limitExceeded reports whether more resources have failed than the run tolerates
+func (b *Bootstrapper) limitExceeded() bool {
+	return b.continueOnError && b.maxErrors > 0 && len(b.failures) > b.maxErrors
+}
+
+// failuresError summarizes the failures collected by a run in continue-on-error mode. stopped
+// is set when the run ended early because the limit was exceeded.
+func (b *Bootstrapper) failuresError(stopped bool) error {
+	if len(b.failures) == 0 {
+		return nil
+	}
+	if stopped {
+		return fmt.Errorf("stopped after %d resources failed, more than the limit of %d:\n%w",
+			len(b.failures), b.maxErrors, errors.Join(b.failures...))
+	}
+	return fmt.Errorf("%d resource(s) failed to provision:\n%w", len(b.failures), errors.Join(b.failures...))
+}
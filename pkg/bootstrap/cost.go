@@ -0,0 +1,192 @@
+package bootstrap
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// hoursPerMonth is the number of hours AWS bills an always-on resource for in a month
+const hoursPerMonth = 730
+
+// Approximate on-demand prices in us-east-1, in USD. They are only meant to show the scale
+// of a configuration and are not kept in sync with AWS pricing.
+var (
+	// dbInstanceHourlyPrices is the hourly price of a single-AZ database instance by class
+	dbInstanceHourlyPrices = map[string]float64{
+		"db.t3.micro":   0.018,
+		"db.t3.small":   0.036,
+		"db.t3.medium":  0.072,
+		"db.t3.large":   0.145,
+		"db.t4g.micro":  0.016,
+		"db.t4g.small":  0.032,
+		"db.t4g.medium": 0.065,
+		"db.t4g.large":  0.129,
+		"db.m5.large":   0.178,
+		"db.m5.xlarge":  0.356,
+		"db.m6g.large":  0.159,
+		"db.m6g.xlarge": 0.318,
+		"db.m6i.large":  0.178,
+		"db.m6i.xlarge": 0.356,
+		"db.r5.large":   0.250,
+		"db.r5.xlarge":  0.500,
+		"db.r6g.large":  0.225,
+		"db.r6g.xlarge": 0.449,
+		"db.r6i.large":  0.250,
+		"db.r6i.xlarge": 0.500,
+	}
+
+	// dbStorageMonthlyPrices is the monthly price of one GB of RDS storage by storage type
+	dbStorageMonthlyPrices = map[string]float64{
+		"gp2":      0.115,
+		"gp3":      0.115,
+		"io1":      0.125,
+		"io2":      0.125,
+		"standard": 0.100,
+	}
+
+	// secretMonthlyPrice is the monthly price of a Secrets Manager secret
+	secretMonthlyPrice = 0.40
+
+	// hostedZoneMonthlyPrice is the monthly price of a Route53 hosted zone
+	hostedZoneMonthlyPrice = 0.50
+)
+
+// regionPriceMultipliers scales the us-east-1 prices to other regions. Regions that are not
+// listed are estimated at us-east-1 prices.
+var regionPriceMultipliers = map[string]float64{
+	"us-east-1":      1.00,
+	"us-east-2":      1.00,
+	"us-west-1":      1.15,
+	"us-west-2":      1.00,
+	"ca-central-1":   1.10,
+	"eu-west-1":      1.10,
+	"eu-west-2":      1.15,
+	"eu-west-3":      1.15,
+	"eu-central-1":   1.20,
+	"eu-north-1":     1.05,
+	"ap-south-1":     1.10,
+	"ap-northeast-1": 1.30,
+	"ap-northeast-2": 1.25,
+	"ap-southeast-1": 1.25,
+	"ap-southeast-2": 1.25,
+	"sa-east-1":      1.60,
+}
+
+// CostItem is the estimated monthly cost of a single resource
+type CostItem struct {
+	Type    string
+	Name    string
+	Detail  string
+	Monthly float64
+}
+
+// CostEstimate is a rough monthly cost of the cost-bearing resources in a configuration.
+// Usage-based charges such as S3 storage, requests, data transfer and Lambda invocations
+// are not included.
+type CostEstimate struct {
+	Region string
+	Items  []CostItem
+	// Unpriced lists resources whose cost is unknown, such as an unlisted instance class
+	Unpriced []string
+}
+
+// Total returns the sum of the estimated monthly costs
+func (e *CostEstimate) Total() float64 {
+	total := 0.0
+	for _, item := range e.Items {
+		total += item.Monthly
+	}
+	return total
+}
+
+// Print writes the estimated cost of each resource and the total, labelled as approximate
+func (e *CostEstimate) Print() {
+	e.Fprint(os.Stdout)
+}
+
+// Fprint writes the estimate to w like Print
+func (e *CostEstimate) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "Estimated monthly cost (approximate, on-demand prices in %s):\n", e.Region)
+	if len(e.Items) == 0 {
+		fmt.Fprintln(w, "  No resources with a fixed monthly cost.")
+	} else {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, item := range e.Items {
+			fmt.Fprintf(tw, "  %s %s\t%s\t$%.2f\n", item.Type, item.Name, item.Detail, item.Monthly)
+		}
+		tw.Flush()
+		fmt.Fprintf(w, "  Total: ~$%.2f/month\n", e.Total())
+	}
+	for _, name := range e.Unpriced {
+		fmt.Fprintf(w, "  Not estimated: %s\n", name)
+	}
+	fmt.Fprintln(w, "  S3 storage and requests, ECR storage, Lambda invocations and data transfer are billed by usage and not included.")
+}
+
+// EstimateMonthlyCost returns a rough monthly cost of the enabled resources in the config
+// from a static pricing table. It makes no AWS calls.
+func EstimateMonthlyCost(config *Config) *CostEstimate {
+	config = config.withoutDisabled()
+	estimate := &CostEstimate{Region: config.Region}
+	multiplier, ok := regionPriceMultipliers[config.Region]
+	if !ok {
+		multiplier = 1
+		estimate.Region = "us-east-1"
+	}
+
+	for _, instance := range config.RDSInstances {
+		if instance.generatesPassword() {
+			estimate.add(ResourceTypeRDS, instance.Identifier+" secret", "generated master password", secretMonthlyPrice*multiplier)
+		}
+		hourly, ok := dbInstanceHourlyPrices[instance.InstanceClass]
+		if !ok {
+			estimate.Unpriced = append(estimate.Unpriced, fmt.Sprintf("%s %s (instance class %s)", ResourceTypeRDS, instance.Identifier, instance.InstanceClass))
+			continue
+		}
+		storageType := instance.StorageType
+		if storageType == "" {
+			storageType = "gp2"
+		}
+		monthly := hourly*hoursPerMonth + float64(instance.AllocatedStorage)*dbStorageMonthlyPrices[storageType]
+		detail := fmt.Sprintf("%s, %d GB %s", instance.InstanceClass, instance.AllocatedStorage, storageType)
+		// Only the storage of a stopped instance is billed
+		if instance.DesiredState == rdsStateStopped {
+			monthly = float64(instance.AllocatedStorage) * dbStorageMonthlyPrices[storageType]
+			detail += ", stopped"
+		}
+		// A Multi-AZ deployment runs and stores everything twice
+		if instance.MultiAZ {
+			monthly *= 2
+			detail += ", Multi-AZ"
+		}
+		estimate.add(ResourceTypeRDS, instance.Identifier, detail, monthly*multiplier)
+	}
+
+	for _, cluster := range config.AuroraClusters {
+		if cluster.passwordSource().generatesPassword() {
+			estimate.add(ResourceTypeAurora, cluster.Identifier+" secret", "generated master password", secretMonthlyPrice*multiplier)
+		}
+		for _, instance := range cluster.Instances {
+			name := cluster.Identifier + "/" + instance.Identifier
+			hourly, ok := dbInstanceHourlyPrices[instance.InstanceClass]
+			if !ok {
+				estimate.Unpriced = append(estimate.Unpriced, fmt.Sprintf("%s %s (instance class %s)", ResourceTypeAurora, name, instance.InstanceClass))
+				continue
+			}
+			estimate.add(ResourceTypeAurora, name, instance.InstanceClass+", storage billed by usage", hourly*hoursPerMonth*multiplier)
+		}
+	}
+
+	for _, zone := range config.HostedZones {
+		estimate.add(ResourceTypeHostedZone, zone.Name, "hosted zone", hostedZoneMonthlyPrice)
+	}
+
+	return estimate
+}
+
+// add records the estimated monthly cost of a resource
+func (e *CostEstimate) add(resourceType, name, detail string, monthly float64) {
+	e.Items = append(e.Items, CostItem{Type: resourceType, Name: name, Detail: detail, Monthly: monthly})
+}
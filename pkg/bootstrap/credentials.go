@@ -0,0 +1,112 @@
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Credential is a secret generated during provisioning, such as a console password or the
+// private key of a key pair
+type Credential struct {
+	Type       string `yaml:"type" json:"type"`
+	Name       string `yaml:"name" json:"name"`
+	Password   string `yaml:"password,omitempty" json:"password,omitempty"`
+	PrivateKey string `yaml:"private_key,omitempty" json:"private_key,omitempty"`
+}
+
+// SetCredentialsOut sets the file generated credentials are written to, as JSON if it ends
+// in .json and YAML otherwise. Resources that need a generated credential fail when no file
+// is set, since generated credentials are never logged.
+func (b *Bootstrapper) SetCredentialsOut(path string) {
+	b.credentialsOut = path
+}
+
+// recordCredential adds a generated credential to the credentials file. The whole file is
+// rewritten, readable only by its owner, so a credential is saved before the resource that
+// uses it is changed. Credentials saved by earlier runs are kept; one for the same resource
+// is replaced.
+func (b *Bootstrapper) recordCredential(credential Credential) error {
+	if b.credentialsOut == "" {
+		return fmt.Errorf("no credentials file set; use -credentials-out to save generated credentials")
+	}
+	asJSON := strings.EqualFold(filepath.Ext(b.credentialsOut), ".json")
+
+	// The first credential of the run starts from what the file already holds
+	if b.credentials == nil {
+		existing, err := loadCredentials(b.credentialsOut, asJSON)
+		if err != nil {
+			return err
+		}
+		b.credentials = existing
+	}
+	replaced := false
+	for i, saved := range b.credentials {
+		if saved.Type == credential.Type && saved.Name == credential.Name {
+			b.credentials[i] = credential
+			replaced = true
+		}
+	}
+	if !replaced {
+		b.credentials = append(b.credentials, credential)
+	}
+
+	data, err := encodeCredentials(b.credentials, asJSON)
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %w", err)
+	}
+
+	if err := os.WriteFile(b.credentialsOut, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write credentials file: %w", err)
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(b.credentialsOut, 0o600); err != nil {
+		return fmt.Errorf("failed to restrict credentials file: %w", err)
+	}
+	return nil
+}
+
+// loadCredentials reads the credentials saved in path; a missing or empty file holds none
+func loadCredentials(path string, asJSON bool) ([]Credential, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Credential{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	credentials := []Credential{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return credentials, nil
+	}
+	if asJSON {
+		err = json.Unmarshal(data, &credentials)
+	} else {
+		err = yaml.Unmarshal(data, &credentials)
+	}
+	if err != nil {
+		// Rewriting a file that cannot be read would lose whatever it holds
+		return nil, fmt.Errorf("failed to parse credentials file %s; move it aside before running again: %w", path, err)
+	}
+	return credentials, nil
+}
+
+// encodeCredentials encodes credentials as JSON or YAML
+func encodeCredentials(credentials []Credential, asJSON bool) ([]byte, error) {
+	if !asJSON {
+		return yaml.Marshal(credentials)
+	}
+	data, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
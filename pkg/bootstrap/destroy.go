@@ -0,0 +1,595 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// destroyedTypes names the resource types DestroyResources deletes, as they appear in its
+// errors. Other types are left in place.
+var destroyedTypes = map[string]string{
+	ResourceTypeRDS:      "RDS instances",
+	ResourceTypeIAM:      "IAM users and policies",
+	ResourceTypeIAMGroup: "IAM groups",
+	ResourceTypeECR:      "ECR repositories",
+	ResourceTypeS3:       "S3 buckets",
+}
+
+// KeptByDestroy returns the enabled resources in config that DestroyResources leaves in
+// place because it does not delete their type, as type:name
+func KeptByDestroy(config *Config) []string {
+	var kept []string
+	if config.PasswordPolicy != nil {
+		kept = append(kept, resourceRef{ResourceTypePasswordPolicy, passwordPolicyName}.String())
+	}
+	for _, ref := range config.withoutDisabled().dependencyGraph().nodes {
+		if _, ok := destroyedTypes[ref.Type]; !ok {
+			kept = append(kept, ref.String())
+		}
+	}
+	return kept
+}
+
+// DestroyResources deletes the resources of the destroyedTypes defined in the configuration.
+// Resources are removed in the reverse of the provisioning order, so every resource is
+// deleted before the resources it references, and resources that no longer exist are
+// treated as already deleted. Disabled resources are left alone.
+//
+// A resource that something outside the configuration still uses is kept, and so are the
+// resources it references. The rest are deleted, then the chains of the kept resources are
+// returned as the error.
+func (b *Bootstrapper) DestroyResources(ctx context.Context, config *Config) error {
+	if err := b.checkSessionRegion(config); err != nil {
+		return err
+	}
+	config = config.withoutDisabled()
+
+	graph := config.dependencyGraph()
+	sorted, err := graph.sort()
+	if err != nil {
+		return err
+	}
+	dependents := graph.dependents()
+
+	// chains records, for every kept resource, what still uses it
+	chains := make(map[resourceRef]string)
+	var kept []string
+	for _, ref := range slices.Backward(sorted) {
+		if _, ok := destroyedTypes[ref.Type]; !ok {
+			continue
+		}
+
+		if chain := keptDependentChain(ref, dependents[ref], chains); chain != "" {
+			logger.Warn("Keeping resource that a kept resource references", "resource", ref.String(), "chain", chain)
+			chains[ref] = chain
+			kept = append(kept, chain)
+			continue
+		}
+
+		resource := &Config{Region: config.Region}
+		config.copyResource(ref, resource)
+		var users []string
+		err := b.withResourceRole(ctx, config, ref.Type, func() error {
+			var err error
+			users, err = b.destroyResource(ctx, ref, resource)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %w", destroyedTypes[ref.Type], err)
+		}
+		if len(users) > 0 {
+			chains[ref] = ref.String() + " <- " + strings.Join(users, ", ")
+			kept = append(kept, chains[ref])
+		}
+	}
+
+	if len(kept) > 0 {
+		return fmt.Errorf("%d resource(s) were kept because they are still in use; remove what uses them and run -destroy again:\n  %s",
+			len(kept), strings.Join(kept, "\n  "))
+	}
+	return nil
+}
+
+// keptDependentChain returns the chain that blocks the deletion of ref when one of the
+// resources that reference it was kept, or "" when the resource can be deleted
+func keptDependentChain(ref resourceRef, dependents []resourceRef, chains map[resourceRef]string) string {
+	for _, dependent := range dependents {
+		if chain, ok := chains[dependent]; ok {
+			return ref.String() + " <- " + chain
+		}
+	}
+	return ""
+}
+
+// destroyResource deletes the single resource of the config identified by ref. It returns
+// the users outside the configuration that keep a shared resource from being deleted.
+func (b *Bootstrapper) destroyResource(ctx context.Context, ref resourceRef, config *Config) ([]string, error) {
+	switch ref.Type {
+	case ResourceTypeRDS:
+		return nil, b.DeleteRDSInstances(ctx, config.RDSInstances)
+	case ResourceTypeIAM:
+		return nil, b.DeleteIAMUsersAndPolicies(ctx, config.IAMUsers)
+	case ResourceTypeIAMGroup:
+		var users []string
+		for _, group := range config.IAMGroups {
+			members, err := b.deleteIAMGroup(ctx, group)
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, members...)
+		}
+		return users, nil
+	case ResourceTypeECR:
+		return nil, b.DeleteECRRepositories(ctx, config.ECRRepositories)
+	case ResourceTypeS3:
+		return nil, b.DeleteS3Buckets(ctx, config.S3Buckets)
+	}
+	return nil, nil
+}
+
+// DeleteS3Buckets empties and deletes S3 buckets
+func (b *Bootstrapper) DeleteS3Buckets(ctx context.Context, buckets []S3Bucket) error {
+	for _, bucket := range buckets {
+		if err := b.inRegion(bucket.Region, func() error { return b.deleteS3Bucket(ctx, bucket) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteS3Bucket empties and deletes a bucket. A bucket that does not exist is skipped.
+func (b *Bootstrapper) deleteS3Bucket(ctx context.Context, bucket S3Bucket) error {
+	logger.Info("Deleting S3 bucket", "bucket", bucket.Name)
+
+	// Only a missing bucket counts as deleted; a denied or failed check is reported
+	ownership, err := b.headBucket(ctx, bucket.Name)
+	if err != nil {
+		return err
+	}
+	switch ownership {
+	case bucketMissing:
+		logger.Info("Bucket does not exist", "bucket", bucket.Name)
+		return nil
+	case bucketForeign:
+		return fmt.Errorf("failed to delete bucket %s: access to it is denied, or it is owned by another AWS account", bucket.Name)
+	}
+
+	// DeleteBucket only succeeds on empty buckets
+	if err := b.emptyBucket(ctx, bucket.Name); err != nil {
+		return err
+	}
+
+	_, err = b.s3Client.DeleteBucket(ctx, &s3.DeleteBucketInput{
+		Bucket: aws.String(bucket.Name),
+	})
+	if err != nil {
+		if hasErrorCode(err, "NoSuchBucket") {
+			logger.Info("Bucket does not exist", "bucket", bucket.Name)
+			return nil
+		}
+		return fmt.Errorf("failed to delete bucket %s: %w", bucket.Name, err)
+	}
+	logger.Info("Deleted bucket", "bucket", bucket.Name)
+	return nil
+}
+
+// s3DeleteBatchSize is the most objects a single DeleteObjects call accepts
+const s3DeleteBatchSize = 1000
+
+// emptyBucket deletes every object version and delete marker in a bucket. DeleteBucket
+// refuses buckets that still hold either, even when no current objects are left.
+func (b *Bootstrapper) emptyBucket(ctx context.Context, bucketName string) error {
+	paginator := s3.NewListObjectVersionsPaginator(b.s3Client, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucketName),
+	})
+
+	deleted := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list objects in bucket %s: %w", bucketName, err)
+		}
+
+		var objects []types.ObjectIdentifier
+		for _, version := range page.Versions {
+			objects = append(objects, types.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+		}
+		for _, marker := range page.DeleteMarkers {
+			objects = append(objects, types.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+
+		// A page normally holds at most 1000 entries, but versions and delete markers are
+		// listed separately, so the batches are cut to the DeleteObjects limit explicitly
+		for batch := range slices.Chunk(objects, s3DeleteBatchSize) {
+			output, err := b.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+				Bucket: aws.String(bucketName),
+				Delete: &types.Delete{
+					Objects: batch,
+					Quiet:   aws.Bool(true),
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to delete objects in bucket %s: %w", bucketName, err)
+			}
+			if len(output.Errors) > 0 {
+				return fmt.Errorf("failed to delete object %s in bucket %s: %s",
+					aws.ToString(output.Errors[0].Key), bucketName, aws.ToString(output.Errors[0].Message))
+			}
+			deleted += len(batch)
+		}
+	}
+
+	if deleted > 0 {
+		logger.Info("Removed object versions", "bucket", bucketName, "versions", deleted)
+	}
+	return nil
+}
+
+// DeleteECRRepositories deletes ECR repositories along with any images they contain.
+// Repositories that are not in the registry, such as orphans deleted by hand, are skipped.
+func (b *Bootstrapper) DeleteECRRepositories(ctx context.Context, repositories []ECRRepository) error {
+	// The repositories of each region are listed once
+	inventories := make(map[string]map[string]ecrtypes.Repository)
+	for _, repo := range repositories {
+		err := b.inRegion(repo.Region, func() error {
+			inventory, ok := inventories[b.awsConfig.Region]
+			if !ok {
+				var err error
+				if inventory, err = b.ecrInventory(ctx); err != nil {
+					return err
+				}
+				inventories[b.awsConfig.Region] = inventory
+			}
+			return b.deleteECRRepository(ctx, repo, inventory)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteECRRepository deletes a repository with its images. A repository that is not in
+// the inventory of its region is skipped.
+func (b *Bootstrapper) deleteECRRepository(ctx context.Context, repo ECRRepository, inventory map[string]ecrtypes.Repository) error {
+	logger.Info("Deleting ECR repository", "repository", repo.Name)
+	if _, ok := inventory[repo.Name]; !ok {
+		logger.Info("ECR repository does not exist", "repository", repo.Name)
+		return nil
+	}
+
+	_, err := b.ecrClient.DeleteRepository(ctx, &ecr.DeleteRepositoryInput{
+		RepositoryName: aws.String(repo.Name),
+		Force:          true,
+	})
+	if err != nil {
+		if isAPIError[*ecrtypes.RepositoryNotFoundException](err) {
+			logger.Info("ECR repository does not exist", "repository", repo.Name)
+			return nil
+		}
+		return fmt.Errorf("failed to delete ECR repository %s: %w", repo.Name, err)
+	}
+	logger.Info("Deleted ECR repository", "repository", repo.Name)
+	return nil
+}
+
+// DeleteIAMUsersAndPolicies detaches and deletes the managed policies created for each user, then deletes the user
+func (b *Bootstrapper) DeleteIAMUsersAndPolicies(ctx context.Context, users []IAMUser) error {
+	for _, user := range users {
+		logger.Info("Deleting IAM user", "user", user.Name)
+
+		_, err := b.iamClient.GetUser(ctx, &iam.GetUserInput{
+			UserName: aws.String(user.Name),
+		})
+		userExists := err == nil
+		if err != nil && !isAPIError[*iamtypes.NoSuchEntityException](err) {
+			return fmt.Errorf("failed to get IAM user %s: %w", user.Name, err)
+		}
+
+		// Detach every managed policy so the user can be deleted
+		if userExists {
+			attached, err := b.iamClient.ListAttachedUserPolicies(ctx, &iam.ListAttachedUserPoliciesInput{
+				UserName: aws.String(user.Name),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to list policies attached to IAM user %s: %w", user.Name, err)
+			}
+			for _, policy := range attached.AttachedPolicies {
+				_, err = b.iamClient.DetachUserPolicy(ctx, &iam.DetachUserPolicyInput{
+					UserName:  aws.String(user.Name),
+					PolicyArn: policy.PolicyArn,
+				})
+				if err != nil && !isAPIError[*iamtypes.NoSuchEntityException](err) {
+					return fmt.Errorf("failed to detach policy %s from IAM user %s: %w", aws.ToString(policy.PolicyName), user.Name, err)
+				}
+				logger.Info("Detached policy", "user", user.Name, "policy", aws.ToString(policy.PolicyName))
+			}
+
+			// Inline policies must be deleted before the user
+			inline, err := b.iamClient.ListUserPolicies(ctx, &iam.ListUserPoliciesInput{
+				UserName: aws.String(user.Name),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to list inline policies for IAM user %s: %w", user.Name, err)
+			}
+			for _, policyName := range inline.PolicyNames {
+				_, err = b.iamClient.DeleteUserPolicy(ctx, &iam.DeleteUserPolicyInput{
+					UserName:   aws.String(user.Name),
+					PolicyName: aws.String(policyName),
+				})
+				if err != nil && !isAPIError[*iamtypes.NoSuchEntityException](err) {
+					return fmt.Errorf("failed to delete inline policy %s from IAM user %s: %w", policyName, user.Name, err)
+				}
+				logger.Info("Deleted inline policy", "user", user.Name, "policy", policyName)
+			}
+
+			// A user can only be deleted once it is no longer a member of any group
+			groups, err := b.iamClient.ListGroupsForUser(ctx, &iam.ListGroupsForUserInput{
+				UserName: aws.String(user.Name),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to list groups for IAM user %s: %w", user.Name, err)
+			}
+			for _, group := range groups.Groups {
+				_, err = b.iamClient.RemoveUserFromGroup(ctx, &iam.RemoveUserFromGroupInput{
+					UserName:  aws.String(user.Name),
+					GroupName: group.GroupName,
+				})
+				if err != nil && !isAPIError[*iamtypes.NoSuchEntityException](err) {
+					return fmt.Errorf("failed to remove IAM user %s from group %s: %w", user.Name, aws.ToString(group.GroupName), err)
+				}
+				logger.Info("Removed user from group", "user", user.Name, "group", aws.ToString(group.GroupName))
+			}
+		}
+
+		// Delete the customer-managed policies this tool created for the user
+		for _, policy := range user.Policies {
+			if policy.PolicyArn != "" {
+				continue
+			}
+			if err := b.deleteIAMPolicy(ctx, iamPolicyName(user.Name, policy.Name)); err != nil {
+				return err
+			}
+		}
+
+		if !userExists {
+			logger.Info("IAM user does not exist", "user", user.Name)
+			continue
+		}
+
+		// IAM refuses to delete a user that still has a console password
+		_, err = b.iamClient.DeleteLoginProfile(ctx, &iam.DeleteLoginProfileInput{
+			UserName: aws.String(user.Name),
+		})
+		if err != nil && !isAPIError[*iamtypes.NoSuchEntityException](err) {
+			return fmt.Errorf("failed to remove console access from IAM user %s: %w", user.Name, err)
+		}
+
+		_, err = b.iamClient.DeleteUser(ctx, &iam.DeleteUserInput{
+			UserName: aws.String(user.Name),
+		})
+		if err != nil {
+			if isAPIError[*iamtypes.NoSuchEntityException](err) {
+				logger.Info("IAM user does not exist", "user", user.Name)
+				continue
+			}
+			return fmt.Errorf("failed to delete IAM user %s: %w", user.Name, err)
+		}
+		logger.Info("Deleted IAM user", "user", user.Name)
+	}
+
+	return nil
+}
+
+// DeleteIAMGroups detaches and deletes the managed policies created for each group, then
+// deletes the group. A group that still has members is kept with a warning.
+func (b *Bootstrapper) DeleteIAMGroups(ctx context.Context, groups []IAMGroup) error {
+	for _, group := range groups {
+		if _, err := b.deleteIAMGroup(ctx, group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteIAMGroup deletes the group and the managed policies created for it. DestroyResources
+// deletes the users in the configuration first, so any member left belongs to someone else:
+// the group is then kept, and its members are returned.
+func (b *Bootstrapper) deleteIAMGroup(ctx context.Context, group IAMGroup) ([]string, error) {
+	logger.Info("Deleting IAM group", "group", group.Name)
+
+	getOutput, err := b.iamClient.GetGroup(ctx, &iam.GetGroupInput{
+		GroupName: aws.String(group.Name),
+	})
+	groupExists := err == nil
+	if err != nil && !isAPIError[*iamtypes.NoSuchEntityException](err) {
+		return nil, fmt.Errorf("failed to get IAM group %s: %w", group.Name, err)
+	}
+
+	if groupExists {
+		if len(getOutput.Users) > 0 {
+			members := make([]string, 0, len(getOutput.Users))
+			for _, member := range getOutput.Users {
+				members = append(members, fmt.Sprintf("IAM user %s (not in the configuration)", aws.ToString(member.UserName)))
+			}
+			logger.Warn("Keeping IAM group that still has members", "group", group.Name, "members", members)
+			return members, nil
+		}
+
+		// Detach every managed policy so the group can be deleted
+		attached, err := b.iamClient.ListAttachedGroupPolicies(ctx, &iam.ListAttachedGroupPoliciesInput{
+			GroupName: aws.String(group.Name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list policies attached to IAM group %s: %w", group.Name, err)
+		}
+		for _, policy := range attached.AttachedPolicies {
+			_, err = b.iamClient.DetachGroupPolicy(ctx, &iam.DetachGroupPolicyInput{
+				GroupName: aws.String(group.Name),
+				PolicyArn: policy.PolicyArn,
+			})
+			if err != nil && !isAPIError[*iamtypes.NoSuchEntityException](err) {
+				return nil, fmt.Errorf("failed to detach policy %s from IAM group %s: %w", aws.ToString(policy.PolicyName), group.Name, err)
+			}
+			logger.Info("Detached policy", "group", group.Name, "policy", aws.ToString(policy.PolicyName))
+		}
+	}
+
+	// Delete the customer-managed policies this tool created for the group
+	for _, policy := range group.Policies {
+		if policy.PolicyArn != "" {
+			continue
+		}
+		if err := b.deleteIAMPolicy(ctx, iamPolicyName(group.Name, policy.Name)); err != nil {
+			return nil, err
+		}
+	}
+
+	if !groupExists {
+		logger.Info("IAM group does not exist", "group", group.Name)
+		return nil, nil
+	}
+
+	_, err = b.iamClient.DeleteGroup(ctx, &iam.DeleteGroupInput{
+		GroupName: aws.String(group.Name),
+	})
+	if err != nil {
+		if isAPIError[*iamtypes.NoSuchEntityException](err) {
+			logger.Info("IAM group does not exist", "group", group.Name)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to delete IAM group %s: %w", group.Name, err)
+	}
+	logger.Info("Deleted IAM group", "group", group.Name)
+	return nil, nil
+}
+
+// deleteIAMPolicy deletes a customer-managed policy by name, including its non-default versions
+func (b *Bootstrapper) deleteIAMPolicy(ctx context.Context, policyName string) error {
+	listPoliciesOutput, err := b.iamClient.ListPolicies(ctx, &iam.ListPoliciesInput{
+		Scope: "Local",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list IAM policies: %w", err)
+	}
+
+	for _, p := range listPoliciesOutput.Policies {
+		if aws.ToString(p.PolicyName) != policyName {
+			continue
+		}
+
+		// A policy can only be deleted once all of its non-default versions are gone
+		versions, err := b.iamClient.ListPolicyVersions(ctx, &iam.ListPolicyVersionsInput{
+			PolicyArn: p.Arn,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list versions of IAM policy %s: %w", policyName, err)
+		}
+		for _, version := range versions.Versions {
+			if version.IsDefaultVersion {
+				continue
+			}
+			_, err = b.iamClient.DeletePolicyVersion(ctx, &iam.DeletePolicyVersionInput{
+				PolicyArn: p.Arn,
+				VersionId: version.VersionId,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to delete version %s of IAM policy %s: %w", aws.ToString(version.VersionId), policyName, err)
+			}
+		}
+
+		_, err = b.iamClient.DeletePolicy(ctx, &iam.DeletePolicyInput{
+			PolicyArn: p.Arn,
+		})
+		if isAPIError[*iamtypes.DeleteConflictException](err) {
+			// Something outside the configuration attached the policy as well
+			logger.Warn("Keeping IAM policy that is still attached outside the configuration", "policy", policyName)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete IAM policy %s: %w", policyName, err)
+		}
+		logger.Info("Deleted IAM policy", "policy", policyName)
+		return nil
+	}
+
+	logger.Info("IAM policy does not exist", "policy", policyName)
+	return nil
+}
+
+// finalSnapshotIdentifier returns the name of the snapshot taken when the instance is
+// deleted. The default includes the time so deleting a recreated instance does not collide
+// with the snapshot of an earlier one.
+func (i RDSInstance) finalSnapshotIdentifier(now time.Time) string {
+	if i.FinalSnapshotIdentifier != "" {
+		return i.FinalSnapshotIdentifier
+	}
+	return fmt.Sprintf("%s-final-%s", i.Identifier, now.UTC().Format("20060102150405"))
+}
+
+// DeleteRDSInstances deletes RDS instances, taking a final snapshot unless skip_final_snapshot is set
+func (b *Bootstrapper) DeleteRDSInstances(ctx context.Context, instances []RDSInstance) error {
+	// Skip if no instances are defined
+	if len(instances) == 0 {
+		return nil
+	}
+
+	for _, instance := range instances {
+		logger.Info("Deleting RDS instance", "instance", instance.Identifier)
+
+		if instance.removeProtection {
+			_, err := b.rdsClient.ModifyDBInstance(ctx, &rds.ModifyDBInstanceInput{
+				DBInstanceIdentifier: aws.String(instance.Identifier),
+				DeletionProtection:   aws.Bool(false),
+				ApplyImmediately:     aws.Bool(true),
+			})
+			if isAPIError[*rdstypes.DBInstanceNotFoundFault](err) {
+				logger.Info("RDS instance does not exist", "instance", instance.Identifier)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to disable deletion protection for RDS instance %s: %w", instance.Identifier, err)
+			}
+			logger.Info("Disabled deletion protection", "instance", instance.Identifier)
+		}
+
+		deleteInput := &rds.DeleteDBInstanceInput{
+			DBInstanceIdentifier: aws.String(instance.Identifier),
+			SkipFinalSnapshot:    aws.Bool(instance.SkipFinalSnapshot),
+		}
+		if !instance.SkipFinalSnapshot {
+			deleteInput.FinalDBSnapshotIdentifier = aws.String(instance.finalSnapshotIdentifier(time.Now()))
+		}
+
+		_, err := b.rdsClient.DeleteDBInstance(ctx, deleteInput)
+		if err != nil {
+			if isAPIError[*rdstypes.DBInstanceNotFoundFault](err) {
+				logger.Info("RDS instance does not exist", "instance", instance.Identifier)
+				continue
+			}
+			return fmt.Errorf("failed to delete RDS instance %s: %w", instance.Identifier, err)
+		}
+
+		if instance.SkipFinalSnapshot {
+			logger.Info("Deleting RDS instance without a final snapshot", "instance", instance.Identifier)
+		} else {
+			logger.Info("Deleting RDS instance with a final snapshot", "instance", instance.Identifier, "snapshot", aws.ToString(deleteInput.FinalDBSnapshotIdentifier))
+		}
+		logger.Info("Deletion is in progress and may take several minutes to complete", "instance", instance.Identifier)
+	}
+
+	return nil
+}
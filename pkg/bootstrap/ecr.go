@@ -0,0 +1,346 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+// CreateECRRepositories creates ECR repositories based on the configuration
+func (b *Bootstrapper) CreateECRRepositories(ctx context.Context, repositories []ECRRepository) ([]ResourceResult, error) {
+	var results []ResourceResult
+	for _, repo := range repositories {
+		// Stop before starting the next resource if the run was cancelled or timed out
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+
+		res := newResourceResult(ResourceTypeECR, repo.Name)
+		b.warnCrossRegion(repo.Region, res)
+		err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+			return b.inRegion(repo.Region, func() error {
+				return b.ensureECRRepository(ctx, repo, res)
+			})
+		})
+		results = append(results, res.finish(err))
+		if err != nil && !b.tolerate(err) {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// ecrInventory lists every repository in the registry by name, following all pages of
+// DescribeRepositories
+func (b *Bootstrapper) ecrInventory(ctx context.Context) (map[string]ecrtypes.Repository, error) {
+	inventory := make(map[string]ecrtypes.Repository)
+	paginator := ecr.NewDescribeRepositoriesPaginator(b.ecrClient, &ecr.DescribeRepositoriesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list ECR repositories: %w", err)
+		}
+		for _, repo := range page.Repositories {
+			inventory[aws.ToString(repo.RepositoryName)] = repo
+		}
+	}
+	return inventory, nil
+}
+
+// ensureECRRepository creates a single ECR repository if needed and applies its configuration
+func (b *Bootstrapper) ensureECRRepository(ctx context.Context, repo ECRRepository, res *ResourceResult) error {
+	logger.Info("Ensuring ECR repository", "repository", repo.Name)
+
+	// Resolve the policies before touching the repository so a bad config fails cleanly
+	lifecyclePolicy, err := loadECRLifecyclePolicy(repo)
+	if err != nil {
+		return fmt.Errorf("invalid lifecycle policy for ECR repository %s: %w", repo.Name, err)
+	}
+	repositoryPolicy, err := buildECRRepositoryPolicy(repo)
+	if err != nil {
+		return fmt.Errorf("invalid repository policy for ECR repository %s: %w", repo.Name, err)
+	}
+	encryption, err := buildECREncryption(repo.Encryption)
+	if err != nil {
+		return fmt.Errorf("invalid encryption for ECR repository %s: %w", repo.Name, err)
+	}
+
+	// Only a missing repository is created; throttling or a denied call is not a reason to create one
+	describeOutput, err := b.ecrClient.DescribeRepositories(ctx, &ecr.DescribeRepositoriesInput{
+		RepositoryNames: []string{repo.Name},
+	})
+	if err != nil && !isAPIError[*ecrtypes.RepositoryNotFoundException](err) {
+		return fmt.Errorf("failed to describe ECR repository %s: %w", repo.Name, err)
+	}
+
+	if err != nil {
+		createInput := &ecr.CreateRepositoryInput{
+			RepositoryName:          aws.String(repo.Name),
+			EncryptionConfiguration: encryption,
+		}
+		if len(repo.Tags) > 0 {
+			createInput.Tags = buildECRTags(repo.Tags)
+		}
+		if repo.ImageTagMutability != "" {
+			createInput.ImageTagMutability = ecrtypes.ImageTagMutability(repo.ImageTagMutability)
+		}
+		if repo.ScanOnPush != nil {
+			createInput.ImageScanningConfiguration = &ecrtypes.ImageScanningConfiguration{ScanOnPush: *repo.ScanOnPush}
+		}
+
+		createOutput, err := b.ecrClient.CreateRepository(ctx, createInput)
+		if err != nil {
+			return fmt.Errorf("failed to create ECR repository %s: %w", repo.Name, err)
+		}
+		res.created()
+		if createOutput.Repository != nil {
+			res.ARN = aws.ToString(createOutput.Repository.RepositoryArn)
+		}
+		logger.Info("Created ECR repository", "repository", repo.Name)
+	} else {
+		logger.Info("ECR repository already exists", "repository", repo.Name)
+		if len(describeOutput.Repositories) > 0 {
+			res.ARN = aws.ToString(describeOutput.Repositories[0].RepositoryArn)
+		}
+		if repo.IfNotExists {
+			leaveExisting(res)
+			return nil
+		}
+
+		if encryption != nil && len(describeOutput.Repositories) > 0 {
+			checkECREncryption(repo.Name, encryption, describeOutput.Repositories[0].EncryptionConfiguration, res)
+		}
+
+		// Apply tags to the existing repository using its ARN
+		if len(repo.Tags) > 0 && len(describeOutput.Repositories) > 0 {
+			_, err = b.ecrClient.TagResource(ctx, &ecr.TagResourceInput{
+				ResourceArn: describeOutput.Repositories[0].RepositoryArn,
+				Tags:        buildECRTags(repo.Tags),
+			})
+			if err != nil {
+				res.warnf("failed to set tags for ECR repository %s: %v", repo.Name, err)
+			} else {
+				res.updated()
+				logger.Info("Set ECR repository tags", "repository", repo.Name, "tags", len(repo.Tags))
+			}
+		}
+
+		if b.pruneTags && len(describeOutput.Repositories) > 0 {
+			b.pruneECRTags(ctx, repo, describeOutput.Repositories[0].RepositoryArn, res)
+		}
+		if len(describeOutput.Repositories) > 0 {
+			b.reconcileECRImageSettings(ctx, repo, describeOutput.Repositories[0], res)
+		}
+		if b.importing {
+			b.adoptECRRepository(ctx, repo, lifecyclePolicy, repositoryPolicy, res)
+		}
+	}
+
+	// Set lifecycle policy if provided
+	if lifecyclePolicy != "" {
+		_, err = b.ecrClient.PutLifecyclePolicy(ctx, &ecr.PutLifecyclePolicyInput{
+			RepositoryName:      aws.String(repo.Name),
+			LifecyclePolicyText: aws.String(lifecyclePolicy),
+		})
+		if err != nil {
+			res.warnf("failed to set lifecycle policy for ECR repository %s: %v", repo.Name, err)
+		} else {
+			res.updated()
+			logger.Info("Set lifecycle policy", "repository", repo.Name)
+		}
+	}
+
+	// Set the repository policy on every run so existing repositories are reconciled too
+	if repositoryPolicy != "" {
+		_, err = b.ecrClient.SetRepositoryPolicy(ctx, &ecr.SetRepositoryPolicyInput{
+			RepositoryName: aws.String(repo.Name),
+			PolicyText:     aws.String(repositoryPolicy),
+		})
+		if err != nil {
+			res.warnf("failed to set repository policy for ECR repository %s: %v", repo.Name, err)
+		} else {
+			res.updated()
+			logger.Info("Set repository policy", "repository", repo.Name)
+		}
+	}
+
+	return nil
+}
+
+// pruneECRTags removes tags from an existing repository that are not in its configuration
+func (b *Bootstrapper) pruneECRTags(ctx context.Context, repo ECRRepository, repositoryArn *string, res *ResourceResult) {
+	tagsOutput, err := b.ecrClient.ListTagsForResource(ctx, &ecr.ListTagsForResourceInput{
+		ResourceArn: repositoryArn,
+	})
+	if err != nil {
+		res.warnf("failed to list tags of ECR repository %s: %v", repo.Name, err)
+		return
+	}
+	current := make(map[string]string, len(tagsOutput.Tags))
+	for _, tag := range tagsOutput.Tags {
+		current[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	stale := staleTagKeys(current, repo.Tags)
+	if len(stale) == 0 {
+		return
+	}
+	_, err = b.ecrClient.UntagResource(ctx, &ecr.UntagResourceInput{
+		ResourceArn: repositoryArn,
+		TagKeys:     stale,
+	})
+	if err != nil {
+		res.warnf("failed to remove tags from ECR repository %s: %v", repo.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Removed ECR repository tags", "repository", repo.Name, "tags", strings.Join(stale, ","))
+}
+
+// reconcileECRImageSettings updates the tag mutability and scan-on-push setting of an
+// existing repository. Unset settings are left as they are, unless the repository is
+// being imported, when they go back to the ECR defaults: mutable tags and no scanning.
+func (b *Bootstrapper) reconcileECRImageSettings(ctx context.Context, repo ECRRepository, existing ecrtypes.Repository, res *ResourceResult) {
+	mutability := repo.ImageTagMutability
+	if mutability == "" && b.importing {
+		mutability = string(ecrtypes.ImageTagMutabilityMutable)
+	}
+	if mutability != "" && mutability != string(existing.ImageTagMutability) {
+		_, err := b.ecrClient.PutImageTagMutability(ctx, &ecr.PutImageTagMutabilityInput{
+			RepositoryName:     aws.String(repo.Name),
+			ImageTagMutability: ecrtypes.ImageTagMutability(mutability),
+		})
+		if err != nil {
+			res.warnf("failed to set image tag mutability for ECR repository %s: %v", repo.Name, err)
+		} else {
+			res.updated()
+			logger.Info("Set image tag mutability", "repository", repo.Name, "mutability", mutability)
+		}
+	}
+
+	scanOnPush := repo.ScanOnPush
+	if scanOnPush == nil && b.importing {
+		scanOnPush = aws.Bool(false)
+	}
+	current := existing.ImageScanningConfiguration != nil && existing.ImageScanningConfiguration.ScanOnPush
+	if scanOnPush != nil && *scanOnPush != current {
+		_, err := b.ecrClient.PutImageScanningConfiguration(ctx, &ecr.PutImageScanningConfigurationInput{
+			RepositoryName:             aws.String(repo.Name),
+			ImageScanningConfiguration: &ecrtypes.ImageScanningConfiguration{ScanOnPush: *scanOnPush},
+		})
+		if err != nil {
+			res.warnf("failed to set scan on push for ECR repository %s: %v", repo.Name, err)
+		} else {
+			res.updated()
+			logger.Info("Set scan on push", "repository", repo.Name, "scan_on_push", *scanOnPush)
+		}
+	}
+}
+
+// buildECREncryption converts the encryption config into the ECR API form. It returns nil
+// when no encryption is configured, leaving ECR's default AES256 encryption in place.
+func buildECREncryption(encryption *ECREncryption) (*ecrtypes.EncryptionConfiguration, error) {
+	if encryption == nil {
+		return nil, nil
+	}
+
+	switch strings.ToUpper(encryption.Type) {
+	case "", "AES256":
+		if encryption.KMSKey != "" {
+			return nil, fmt.Errorf("kms_key requires encryption type KMS")
+		}
+		return &ecrtypes.EncryptionConfiguration{EncryptionType: ecrtypes.EncryptionTypeAes256}, nil
+	case "KMS":
+		config := &ecrtypes.EncryptionConfiguration{EncryptionType: ecrtypes.EncryptionTypeKms}
+		if encryption.KMSKey != "" {
+			config.KmsKey = aws.String(encryption.KMSKey)
+		}
+		return config, nil
+	default:
+		return nil, fmt.Errorf("unsupported encryption type %q (must be AES256 or KMS)", encryption.Type)
+	}
+}
+
+// checkECREncryption warns when an existing repository's encryption differs from the
+// requested configuration. ECR encryption is fixed at creation time, so the mismatch can
+// only be resolved by re-creating the repository.
+func checkECREncryption(repoName string, want, current *ecrtypes.EncryptionConfiguration, res *ResourceResult) {
+	currentType := ecrtypes.EncryptionTypeAes256
+	var currentKey string
+	if current != nil {
+		currentType = current.EncryptionType
+		currentKey = aws.ToString(current.KmsKey)
+	}
+
+	wantKey := aws.ToString(want.KmsKey)
+	if currentType == want.EncryptionType && (wantKey == "" || wantKey == currentKey) {
+		return
+	}
+
+	have := string(currentType)
+	if currentKey != "" {
+		have = fmt.Sprintf("%s (%s)", have, currentKey)
+	}
+	requested := string(want.EncryptionType)
+	if wantKey != "" {
+		requested = fmt.Sprintf("%s (%s)", requested, wantKey)
+	}
+	res.warnf("ECR repository %s is encrypted with %s but %s was requested; encryption cannot be changed after creation, so the repository must be deleted and re-created to apply it",
+		repoName, have, requested)
+}
+
+// buildECRRepositoryPolicy returns the raw repository policy, or a policy granting pull
+// access to the configured accounts
+func buildECRRepositoryPolicy(repo ECRRepository) (string, error) {
+	if repo.RepositoryPolicy != "" && len(repo.PullAccountIDs) > 0 {
+		return "", fmt.Errorf("only one of repository_policy or pull_account_ids may be set")
+	}
+	if len(repo.PullAccountIDs) == 0 {
+		return repo.RepositoryPolicy, nil
+	}
+
+	principals := make([]string, 0, len(repo.PullAccountIDs))
+	for _, accountID := range repo.PullAccountIDs {
+		principals = append(principals, fmt.Sprintf("arn:aws:iam::%s:root", accountID))
+	}
+
+	policy := map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{
+			{
+				"Sid":       "AllowCrossAccountPull",
+				"Effect":    "Allow",
+				"Principal": map[string]any{"AWS": principals},
+				"Action": []string{
+					"ecr:BatchCheckLayerAvailability",
+					"ecr:BatchGetImage",
+					"ecr:GetDownloadUrlForLayer",
+				},
+			},
+		},
+	}
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// buildECRTags converts a tag map into ECR tags sorted by key
+func buildECRTags(tags map[string]string) []ecrtypes.Tag {
+	result := make([]ecrtypes.Tag, 0, len(tags))
+	for _, key := range sortedKeys(tags) {
+		result = append(result, ecrtypes.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+	return result
+}
@@ -0,0 +1,129 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ecrLifecyclePolicy is the structure of an ECR lifecycle policy document
+type ecrLifecyclePolicy struct {
+	Rules []ecrLifecycleRule `json:"rules"`
+}
+
+type ecrLifecycleRule struct {
+	RulePriority *int   `json:"rulePriority"`
+	Description  string `json:"description"`
+	Selection    *struct {
+		TagStatus      string   `json:"tagStatus"`
+		TagPrefixList  []string `json:"tagPrefixList"`
+		TagPatternList []string `json:"tagPatternList"`
+		CountType      string   `json:"countType"`
+		CountUnit      string   `json:"countUnit"`
+		CountNumber    *int     `json:"countNumber"`
+	} `json:"selection"`
+	Action *struct {
+		Type string `json:"type"`
+	} `json:"action"`
+}
+
+// loadECRLifecyclePolicy returns the repository's lifecycle policy, read from
+// lifecycle_policy_file when that is set, after checking its structure. Errors name the
+// field or file the policy came from.
+func loadECRLifecyclePolicy(repo ECRRepository) (string, error) {
+	if repo.LifecyclePolicy != "" && repo.LifecyclePolicyFile != "" {
+		return "", fmt.Errorf("only one of lifecycle_policy or lifecycle_policy_file may be set")
+	}
+	policy, err := loadPolicy(repo.LifecyclePolicy, repo.LifecyclePolicyFile)
+	if err != nil {
+		return "", fmt.Errorf("lifecycle_policy_file: %w", err)
+	}
+	if policy == "" {
+		return "", nil
+	}
+
+	if err := checkECRLifecyclePolicy(policy); err != nil {
+		if repo.LifecyclePolicyFile != "" {
+			return "", fmt.Errorf("lifecycle_policy_file %s: %w", repo.LifecyclePolicyFile, err)
+		}
+		return "", fmt.Errorf("lifecycle_policy: %w", err)
+	}
+	return policy, nil
+}
+
+// checkECRLifecyclePolicy parses a lifecycle policy and checks the structure ECR requires:
+// a non-empty rules array in which every rule has a unique positive rulePriority, a
+// selection and an expire action. Syntax errors report the line and column.
+func checkECRLifecyclePolicy(policy string) error {
+	var parsed ecrLifecyclePolicy
+	if err := json.Unmarshal([]byte(policy), &parsed); err != nil {
+		return jsonPositionError(policy, err)
+	}
+	if len(parsed.Rules) == 0 {
+		return fmt.Errorf("rules must list at least one rule")
+	}
+
+	priorities := make(map[int]bool)
+	for i, rule := range parsed.Rules {
+		if rule.RulePriority == nil || *rule.RulePriority < 1 {
+			return fmt.Errorf("rules[%d]: rulePriority must be a positive integer", i)
+		}
+		if priorities[*rule.RulePriority] {
+			return fmt.Errorf("rules[%d]: rulePriority %d is used by another rule", i, *rule.RulePriority)
+		}
+		priorities[*rule.RulePriority] = true
+
+		selection := rule.Selection
+		if selection == nil {
+			return fmt.Errorf("rules[%d]: selection is required", i)
+		}
+		switch selection.TagStatus {
+		case "tagged":
+			if len(selection.TagPrefixList) == 0 && len(selection.TagPatternList) == 0 {
+				return fmt.Errorf("rules[%d]: tagPrefixList or tagPatternList is required when tagStatus is tagged", i)
+			}
+		case "untagged", "any":
+		default:
+			return fmt.Errorf("rules[%d]: tagStatus must be tagged, untagged or any, got %q", i, selection.TagStatus)
+		}
+		switch selection.CountType {
+		case "imageCountMoreThan":
+		case "sinceImagePushed":
+			if selection.CountUnit != "days" {
+				return fmt.Errorf("rules[%d]: countUnit must be days when countType is sinceImagePushed", i)
+			}
+		default:
+			return fmt.Errorf("rules[%d]: countType must be imageCountMoreThan or sinceImagePushed, got %q", i, selection.CountType)
+		}
+		if selection.CountNumber == nil || *selection.CountNumber < 1 {
+			return fmt.Errorf("rules[%d]: countNumber must be a positive integer", i)
+		}
+
+		if rule.Action == nil || rule.Action.Type != "expire" {
+			return fmt.Errorf("rules[%d]: action type must be expire", i)
+		}
+	}
+	return nil
+}
+
+// jsonPositionError adds the line and column of a JSON syntax or type error in document
+func jsonPositionError(document string, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err
+	}
+
+	// The offset counts the bytes read up to and including the offending one
+	before := document[:min(int(offset), len(document))]
+	line := strings.Count(before, "\n") + 1
+	column := max(len(before)-strings.LastIndex(before, "\n")-1, 1)
+	return fmt.Errorf("line %d, column %d: %w", line, column, err)
+}
@@ -0,0 +1,85 @@
+package bootstrap
+
+// isEnabled reports whether an optional enabled setting is on; resources are enabled
+// unless they set enabled: false
+func isEnabled(enabled *bool) bool {
+	return enabled == nil || *enabled
+}
+
+// IsEnabled reports whether the bucket is provisioned
+func (b S3Bucket) IsEnabled() bool { return isEnabled(b.Enabled) }
+
+// IsEnabled reports whether the repository is provisioned
+func (r ECRRepository) IsEnabled() bool { return isEnabled(r.Enabled) }
+
+// IsEnabled reports whether the group is provisioned
+func (g IAMGroup) IsEnabled() bool { return isEnabled(g.Enabled) }
+
+// IsEnabled reports whether the user is provisioned
+func (u IAMUser) IsEnabled() bool { return isEnabled(u.Enabled) }
+
+// IsEnabled reports whether the instance is provisioned
+func (i RDSInstance) IsEnabled() bool { return isEnabled(i.Enabled) }
+
+// IsEnabled reports whether the cluster is provisioned
+func (c AuroraCluster) IsEnabled() bool { return isEnabled(c.Enabled) }
+
+// IsEnabled reports whether the zone is provisioned
+func (z HostedZone) IsEnabled() bool { return isEnabled(z.Enabled) }
+
+// IsEnabled reports whether the certificate is provisioned
+func (c Certificate) IsEnabled() bool { return isEnabled(c.Enabled) }
+
+// IsEnabled reports whether the function is provisioned
+func (f LambdaFunction) IsEnabled() bool { return isEnabled(f.Enabled) }
+
+// IsEnabled reports whether the VPC is provisioned
+func (n VPC) IsEnabled() bool { return isEnabled(n.Enabled) }
+
+// IsEnabled reports whether the key pair is provisioned
+func (k KeyPair) IsEnabled() bool { return isEnabled(k.Enabled) }
+
+// IsEnabled reports whether the security group is provisioned
+func (g SecurityGroup) IsEnabled() bool { return isEnabled(g.Enabled) }
+
+// IsEnabled reports whether the EventBridge rule is provisioned
+func (r EventBridgeRule) IsEnabled() bool { return isEnabled(r.Enabled) }
+
+// leaveExisting records that an existing resource setting if_not_exists was left as it is,
+// without reconciling any of its settings
+func leaveExisting(res *ResourceResult) {
+	logger.Info("Resource already exists; leaving it as it is because of if_not_exists", "type", res.Type, "name", res.Name)
+}
+
+// enabledOnly returns the enabled resources of one type, logging each one that is skipped
+func enabledOnly[T interface{ IsEnabled() bool }](resources []T, resourceType string, name func(T) string) []T {
+	var kept []T
+	for _, resource := range resources {
+		if resource.IsEnabled() {
+			kept = append(kept, resource)
+			continue
+		}
+		logger.Info("Skipping disabled resource", "type", resourceType, "name", name(resource))
+	}
+	return kept
+}
+
+// withoutDisabled returns a copy of the config without the resources that set
+// enabled: false. The receiver is not modified.
+func (c *Config) withoutDisabled() *Config {
+	enabled := *c
+	enabled.S3Buckets = enabledOnly(c.S3Buckets, ResourceTypeS3, func(b S3Bucket) string { return b.Name })
+	enabled.ECRRepositories = enabledOnly(c.ECRRepositories, ResourceTypeECR, func(r ECRRepository) string { return r.Name })
+	enabled.IAMGroups = enabledOnly(c.IAMGroups, ResourceTypeIAMGroup, func(g IAMGroup) string { return g.Name })
+	enabled.IAMUsers = enabledOnly(c.IAMUsers, ResourceTypeIAM, func(u IAMUser) string { return u.Name })
+	enabled.RDSInstances = enabledOnly(c.RDSInstances, ResourceTypeRDS, func(i RDSInstance) string { return i.Identifier })
+	enabled.AuroraClusters = enabledOnly(c.AuroraClusters, ResourceTypeAurora, func(a AuroraCluster) string { return a.Identifier })
+	enabled.HostedZones = enabledOnly(c.HostedZones, ResourceTypeHostedZone, func(z HostedZone) string { return z.Name })
+	enabled.Certificates = enabledOnly(c.Certificates, ResourceTypeCertificate, func(cert Certificate) string { return cert.DomainName })
+	enabled.LambdaFunctions = enabledOnly(c.LambdaFunctions, ResourceTypeLambda, func(f LambdaFunction) string { return f.Name })
+	enabled.VPCs = enabledOnly(c.VPCs, ResourceTypeVPC, func(v VPC) string { return v.Name })
+	enabled.KeyPairs = enabledOnly(c.KeyPairs, ResourceTypeKeyPair, func(k KeyPair) string { return k.Name })
+	enabled.SecurityGroups = enabledOnly(c.SecurityGroups, ResourceTypeSecurityGroup, func(g SecurityGroup) string { return g.Name })
+	enabled.EventBridgeRules = enabledOnly(c.EventBridgeRules, ResourceTypeEventBridgeRule, func(r EventBridgeRule) string { return r.Name })
+	return &enabled
+}
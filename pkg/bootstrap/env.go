@@ -0,0 +1,37 @@
+package bootstrap
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envVarPattern matches ${VAR} and ${VAR:-default}. Other uses of "$", such as IAM policy
+// variables like ${aws:username} or a bare $ in a password, are left untouched.
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// expandEnv substitutes environment variables in raw config data. A default is used when
+// the variable is unset or empty; an unset variable without a default is an error.
+func expandEnv(data []byte, filename string) ([]byte, error) {
+	var missing []string
+	expanded := envVarPattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		groups := envVarPattern.FindSubmatch(match)
+		name, fallback := string(groups[1]), string(groups[2])
+
+		value, ok := os.LookupEnv(name)
+		if fallback != "" && value == "" {
+			return []byte(strings.TrimPrefix(fallback, ":-"))
+		}
+		if !ok {
+			missing = append(missing, name)
+		}
+		return []byte(value)
+	})
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("config file %s references unset environment variable(s) without a default: %s",
+			filename, strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
@@ -0,0 +1,23 @@
+package bootstrap
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/aws/smithy-go"
+)
+
+// isAPIError reports whether err, or an error it wraps, is the typed AWS error T, such as
+// *iamtypes.NoSuchEntityException
+func isAPIError[T error](err error) bool {
+	var target T
+	return errors.As(err, &target)
+}
+
+// hasErrorCode reports whether err is an AWS API error with one of the given error codes.
+// It is used for errors the SDK has no type for, which includes most S3 configuration
+// errors; typed errors report their code too.
+func hasErrorCode(err error, codes ...string) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && slices.Contains(codes, apiErr.ErrorCode())
+}
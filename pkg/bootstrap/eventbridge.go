@@ -0,0 +1,279 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// maxEventBridgeTargets is the most targets EventBridge allows on a rule
+const maxEventBridgeTargets = 5
+
+// invalidTargetIDChars matches the characters EventBridge does not allow in target IDs
+var invalidTargetIDChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// state returns the configured state of the rule, ENABLED unless set
+func (r EventBridgeRule) state() ebtypes.RuleState {
+	if r.State == "" {
+		return ebtypes.RuleStateEnabled
+	}
+	return ebtypes.RuleState(r.State)
+}
+
+// destination returns the function, queue or topic the target sends events to
+func (t EventBridgeTarget) destination() string {
+	switch {
+	case t.LambdaFunction != "":
+		return t.LambdaFunction
+	case t.Queue != "":
+		return t.Queue
+	default:
+		return t.Topic
+	}
+}
+
+// id returns the ID of the target within its rule: the configured ID, or the name of its
+// function, queue or topic, trimmed to the characters and length EventBridge allows
+func (t EventBridgeTarget) id() string {
+	if t.ID != "" {
+		return t.ID
+	}
+	name := t.destination()
+	if strings.HasPrefix(name, "arn:") {
+		name = name[strings.LastIndex(name, ":")+1:]
+	}
+	name = invalidTargetIDChars.ReplaceAllString(name, "-")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// CreateEventBridgeRules creates or updates the configured EventBridge rules and their
+// targets
+func (b *Bootstrapper) CreateEventBridgeRules(ctx context.Context, rules []EventBridgeRule) ([]ResourceResult, error) {
+	var results []ResourceResult
+	for _, rule := range rules {
+		// Stop before starting the next resource if the run was cancelled or timed out
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+
+		res := newResourceResult(ResourceTypeEventBridgeRule, rule.Name)
+		err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+			return b.ensureEventBridgeRule(ctx, rule, res)
+		})
+		results = append(results, res.finish(err))
+		if err != nil && !b.tolerate(err) {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// ensureEventBridgeRule creates the rule or brings an existing one up to the configuration,
+// then reconciles its targets. Targets that are not in the configuration are removed.
+func (b *Bootstrapper) ensureEventBridgeRule(ctx context.Context, rule EventBridgeRule, res *ResourceResult) error {
+	logger.Info("Ensuring EventBridge rule", "rule", rule.Name)
+
+	// Resolve the targets first so a missing function fails before the rule is touched
+	targets, err := b.resolveEventBridgeTargets(ctx, rule)
+	if err != nil {
+		return err
+	}
+
+	current, err := b.eventsClient.DescribeRule(ctx, &eventbridge.DescribeRuleInput{Name: aws.String(rule.Name)})
+	exists := err == nil
+	if err != nil && !isAPIError[*ebtypes.ResourceNotFoundException](err) {
+		return fmt.Errorf("failed to describe EventBridge rule %s: %w", rule.Name, err)
+	}
+
+	// Its targets are left as they are too
+	if exists && rule.IfNotExists {
+		res.ARN = aws.ToString(current.Arn)
+		leaveExisting(res)
+		return nil
+	}
+
+	if !exists || eventBridgeRuleChanged(rule, current) {
+		input := &eventbridge.PutRuleInput{
+			Name:  aws.String(rule.Name),
+			State: rule.state(),
+		}
+		if rule.Description != "" {
+			input.Description = aws.String(rule.Description)
+		}
+		if rule.EventPattern != "" {
+			input.EventPattern = aws.String(rule.EventPattern)
+		}
+		if rule.ScheduleExpression != "" {
+			input.ScheduleExpression = aws.String(rule.ScheduleExpression)
+		}
+		// Tags are only applied by PutRule when it creates the rule
+		if !exists && len(rule.Tags) > 0 {
+			input.Tags = buildEventBridgeTags(rule.Tags)
+		}
+		output, err := b.eventsClient.PutRule(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to put EventBridge rule %s: %w", rule.Name, err)
+		}
+		res.ARN = aws.ToString(output.RuleArn)
+		if exists {
+			res.updated()
+			logger.Info("Updated EventBridge rule", "rule", rule.Name)
+		} else {
+			res.created()
+			logger.Info("Created EventBridge rule", "rule", rule.Name, "arn", res.ARN)
+		}
+	} else {
+		res.ARN = aws.ToString(current.Arn)
+		logger.Info("EventBridge rule already exists", "rule", rule.Name)
+	}
+
+	if exists && len(rule.Tags) > 0 {
+		_, err := b.eventsClient.TagResource(ctx, &eventbridge.TagResourceInput{
+			ResourceARN: aws.String(res.ARN),
+			Tags:        buildEventBridgeTags(rule.Tags),
+		})
+		if err != nil {
+			res.warnf("failed to set tags for EventBridge rule %s: %v", rule.Name, err)
+		} else {
+			logger.Info("Set EventBridge rule tags", "rule", rule.Name, "tags", len(rule.Tags))
+		}
+	}
+
+	// Functions need permission before the rule can invoke them
+	for _, target := range rule.Targets {
+		if target.LambdaFunction != "" {
+			b.allowEventBridgeInvoke(ctx, rule.Name, res.ARN, targets[target.id()], res)
+		}
+	}
+
+	return b.reconcileEventBridgeTargets(ctx, rule, targets, res)
+}
+
+// resolveEventBridgeTargets returns the ARN of every target of the rule by target ID.
+// Functions given by name are looked up; queues and topics are given by ARN.
+func (b *Bootstrapper) resolveEventBridgeTargets(ctx context.Context, rule EventBridgeRule) (map[string]string, error) {
+	arns := make(map[string]string, len(rule.Targets))
+	for _, target := range rule.Targets {
+		arn := target.destination()
+		if target.LambdaFunction != "" && !strings.HasPrefix(arn, "arn:") {
+			output, err := b.lambdaClient.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: aws.String(arn)})
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up Lambda function %s for EventBridge rule %s: %w", arn, rule.Name, err)
+			}
+			arn = aws.ToString(output.Configuration.FunctionArn)
+		}
+		arns[target.id()] = arn
+	}
+	return arns, nil
+}
+
+// eventBridgeRuleChanged reports whether the configured settings of a rule differ from the
+// existing rule
+func eventBridgeRuleChanged(rule EventBridgeRule, current *eventbridge.DescribeRuleOutput) bool {
+	return current.State != rule.state() ||
+		aws.ToString(current.Description) != rule.Description ||
+		aws.ToString(current.ScheduleExpression) != rule.ScheduleExpression ||
+		!jsonEqual(aws.ToString(current.EventPattern), rule.EventPattern)
+}
+
+// reconcileEventBridgeTargets puts the targets that are missing or differ from the
+// configuration and removes the targets that are not in it
+func (b *Bootstrapper) reconcileEventBridgeTargets(ctx context.Context, rule EventBridgeRule, arns map[string]string, res *ResourceResult) error {
+	output, err := b.eventsClient.ListTargetsByRule(ctx, &eventbridge.ListTargetsByRuleInput{Rule: aws.String(rule.Name)})
+	if err != nil {
+		return fmt.Errorf("failed to list targets of EventBridge rule %s: %w", rule.Name, err)
+	}
+	current := make(map[string]ebtypes.Target, len(output.Targets))
+	for _, target := range output.Targets {
+		current[aws.ToString(target.Id)] = target
+	}
+
+	var put []ebtypes.Target
+	for _, target := range rule.Targets {
+		id := target.id()
+		existing, ok := current[id]
+		delete(current, id)
+		if ok && aws.ToString(existing.Arn) == arns[id] && jsonEqual(aws.ToString(existing.Input), target.Input) {
+			continue
+		}
+		want := ebtypes.Target{Id: aws.String(id), Arn: aws.String(arns[id])}
+		if target.Input != "" {
+			want.Input = aws.String(target.Input)
+		}
+		put = append(put, want)
+	}
+
+	if len(put) > 0 {
+		output, err := b.eventsClient.PutTargets(ctx, &eventbridge.PutTargetsInput{Rule: aws.String(rule.Name), Targets: put})
+		if err != nil {
+			return fmt.Errorf("failed to put targets of EventBridge rule %s: %w", rule.Name, err)
+		}
+		// PutTargets reports targets it could not add without failing the call
+		for _, failed := range output.FailedEntries {
+			res.warnf("failed to put target %s of EventBridge rule %s: %s: %s", aws.ToString(failed.TargetId), rule.Name,
+				aws.ToString(failed.ErrorCode), aws.ToString(failed.ErrorMessage))
+		}
+		if int(output.FailedEntryCount) < len(put) {
+			res.updated()
+			logger.Info("Put EventBridge rule targets", "rule", rule.Name, "targets", len(put)-int(output.FailedEntryCount))
+		}
+	}
+
+	if len(current) > 0 {
+		stale := slices.Sorted(maps.Keys(current))
+		output, err := b.eventsClient.RemoveTargets(ctx, &eventbridge.RemoveTargetsInput{Rule: aws.String(rule.Name), Ids: stale})
+		if err != nil {
+			res.warnf("failed to remove targets %s from EventBridge rule %s: %v", strings.Join(stale, ", "), rule.Name, err)
+		} else {
+			for _, failed := range output.FailedEntries {
+				res.warnf("failed to remove target %s from EventBridge rule %s: %s", aws.ToString(failed.TargetId), rule.Name, aws.ToString(failed.ErrorMessage))
+			}
+			res.updated()
+			logger.Info("Removed targets that are not in the configuration", "rule", rule.Name, "targets", stale)
+		}
+	}
+	return nil
+}
+
+// allowEventBridgeInvoke lets the rule invoke the function. The permission statement is
+// named after the rule, so it is only added once.
+func (b *Bootstrapper) allowEventBridgeInvoke(ctx context.Context, ruleName, ruleARN, functionARN string, res *ResourceResult) {
+	_, err := b.lambdaClient.AddPermission(ctx, &lambda.AddPermissionInput{
+		FunctionName: aws.String(functionARN),
+		StatementId:  aws.String("eventbridge-" + ruleName),
+		Action:       aws.String("lambda:InvokeFunction"),
+		Principal:    aws.String("events.amazonaws.com"),
+		SourceArn:    aws.String(ruleARN),
+	})
+	switch {
+	case isAPIError[*lambdatypes.ResourceConflictException](err):
+		// The statement exists from an earlier run
+	case err != nil:
+		res.warnf("failed to allow EventBridge rule %s to invoke %s: %v", ruleName, functionARN, err)
+	default:
+		res.updated()
+		logger.Info("Allowed EventBridge rule to invoke Lambda function", "rule", ruleName, "function", functionARN)
+	}
+}
+
+// buildEventBridgeTags converts a tag map into EventBridge tags, sorted by key
+func buildEventBridgeTags(tags map[string]string) []ebtypes.Tag {
+	result := make([]ebtypes.Tag, 0, len(tags))
+	for _, key := range sortedKeys(tags) {
+		result = append(result, ebtypes.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return result
+}
@@ -0,0 +1,192 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// filterTypes maps the resource type names accepted by Filter to the resource types they
+// select. "iam" covers groups, users and the account password policy.
+var filterTypes = map[string][]string{
+	"s3":        {ResourceTypeS3},
+	"ecr":       {ResourceTypeECR},
+	"iam":       {ResourceTypeIAMGroup, ResourceTypeIAM, ResourceTypePasswordPolicy},
+	"iam_group": {ResourceTypeIAMGroup},
+	"iam_user":  {ResourceTypeIAM},
+	"rds":       {ResourceTypeRDS},
+	"aurora":    {ResourceTypeAurora},
+
+	"hosted_zone":      {ResourceTypeHostedZone},
+	"certificate":      {ResourceTypeCertificate},
+	"lambda":           {ResourceTypeLambda},
+	"vpc":              {ResourceTypeVPC},
+	"key_pair":         {ResourceTypeKeyPair},
+	"security_group":   {ResourceTypeSecurityGroup},
+	"eventbridge_rule": {ResourceTypeEventBridgeRule},
+	"password_policy":  {ResourceTypePasswordPolicy},
+}
+
+// resourceSelector matches resources by type and, optionally, by name
+type resourceSelector struct {
+	selector string
+	types    []string
+	name     string
+	// matched records whether the selector matched any resource
+	matched bool
+}
+
+func (s *resourceSelector) matches(resourceType, name string) bool {
+	if s.name != "" && s.name != name {
+		return false
+	}
+	for _, t := range s.types {
+		if t == resourceType {
+			s.matched = true
+			return true
+		}
+	}
+	return false
+}
+
+// parseSelectors parses selectors of the form "type" or "type:name"
+func parseSelectors(selectors []string) ([]*resourceSelector, error) {
+	parsed := make([]*resourceSelector, 0, len(selectors))
+	for _, selector := range selectors {
+		typeName, name, _ := strings.Cut(strings.TrimSpace(selector), ":")
+		types, ok := filterTypes[typeName]
+		if !ok {
+			return nil, fmt.Errorf("unknown resource type %q in %q: must be one of s3, ecr, iam, iam_group, iam_user, rds, aurora, hosted_zone, certificate, lambda, vpc, key_pair, security_group, eventbridge_rule or password_policy", typeName, selector)
+		}
+		parsed = append(parsed, &resourceSelector{selector: selector, types: types, name: name})
+	}
+	return parsed, nil
+}
+
+// anyMatch reports whether any selector matches the resource. Every selector is tried so
+// that each one records whether it matched.
+func anyMatch(selectors []*resourceSelector, resourceType, name string) bool {
+	matched := false
+	for _, s := range selectors {
+		if s.matches(resourceType, name) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// Filter returns a copy of the config that keeps only the resources selected by only (all
+// resources when only is empty) and drops those selected by skip. Selectors are resource
+// type names such as "s3" or "iam", optionally followed by ":name" to target a single
+// resource. A selector naming a resource that is not in the config is an error.
+func (c *Config) Filter(only, skip []string) (*Config, error) {
+	if len(only) == 0 && len(skip) == 0 {
+		return c, nil
+	}
+
+	onlySelectors, err := parseSelectors(only)
+	if err != nil {
+		return nil, err
+	}
+	skipSelectors, err := parseSelectors(skip)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := func(resourceType, name string) bool {
+		selected := len(onlySelectors) == 0 || anyMatch(onlySelectors, resourceType, name)
+		skipped := anyMatch(skipSelectors, resourceType, name)
+		return selected && !skipped
+	}
+
+	filtered := *c
+	filtered.S3Buckets = nil
+	for _, bucket := range c.S3Buckets {
+		if keep(ResourceTypeS3, bucket.Name) {
+			filtered.S3Buckets = append(filtered.S3Buckets, bucket)
+		}
+	}
+	filtered.ECRRepositories = nil
+	for _, repo := range c.ECRRepositories {
+		if keep(ResourceTypeECR, repo.Name) {
+			filtered.ECRRepositories = append(filtered.ECRRepositories, repo)
+		}
+	}
+	filtered.IAMGroups = nil
+	for _, group := range c.IAMGroups {
+		if keep(ResourceTypeIAMGroup, group.Name) {
+			filtered.IAMGroups = append(filtered.IAMGroups, group)
+		}
+	}
+	filtered.IAMUsers = nil
+	for _, user := range c.IAMUsers {
+		if keep(ResourceTypeIAM, user.Name) {
+			filtered.IAMUsers = append(filtered.IAMUsers, user)
+		}
+	}
+	filtered.RDSInstances = nil
+	for _, instance := range c.RDSInstances {
+		if keep(ResourceTypeRDS, instance.Identifier) {
+			filtered.RDSInstances = append(filtered.RDSInstances, instance)
+		}
+	}
+	filtered.AuroraClusters = nil
+	for _, cluster := range c.AuroraClusters {
+		if keep(ResourceTypeAurora, cluster.Identifier) {
+			filtered.AuroraClusters = append(filtered.AuroraClusters, cluster)
+		}
+	}
+	filtered.HostedZones = nil
+	for _, zone := range c.HostedZones {
+		if keep(ResourceTypeHostedZone, zone.Name) {
+			filtered.HostedZones = append(filtered.HostedZones, zone)
+		}
+	}
+	filtered.Certificates = nil
+	for _, certificate := range c.Certificates {
+		if keep(ResourceTypeCertificate, certificate.DomainName) {
+			filtered.Certificates = append(filtered.Certificates, certificate)
+		}
+	}
+	filtered.LambdaFunctions = nil
+	for _, function := range c.LambdaFunctions {
+		if keep(ResourceTypeLambda, function.Name) {
+			filtered.LambdaFunctions = append(filtered.LambdaFunctions, function)
+		}
+	}
+
+	filtered.VPCs = nil
+	for _, vpc := range c.VPCs {
+		if keep(ResourceTypeVPC, vpc.Name) {
+			filtered.VPCs = append(filtered.VPCs, vpc)
+		}
+	}
+	filtered.KeyPairs = nil
+	for _, keyPair := range c.KeyPairs {
+		if keep(ResourceTypeKeyPair, keyPair.Name) {
+			filtered.KeyPairs = append(filtered.KeyPairs, keyPair)
+		}
+	}
+	filtered.SecurityGroups = nil
+	for _, group := range c.SecurityGroups {
+		if keep(ResourceTypeSecurityGroup, group.Name) {
+			filtered.SecurityGroups = append(filtered.SecurityGroups, group)
+		}
+	}
+	filtered.EventBridgeRules = nil
+	for _, rule := range c.EventBridgeRules {
+		if keep(ResourceTypeEventBridgeRule, rule.Name) {
+			filtered.EventBridgeRules = append(filtered.EventBridgeRules, rule)
+		}
+	}
+	if c.PasswordPolicy != nil && !keep(ResourceTypePasswordPolicy, passwordPolicyName) {
+		filtered.PasswordPolicy = nil
+	}
+
+	for _, s := range append(onlySelectors, skipSelectors...) {
+		if s.name != "" && !s.matched {
+			return nil, fmt.Errorf("%s does not match any resource in the configuration", s.selector)
+		}
+	}
+
+	return &filtered, nil
+}
@@ -0,0 +1,536 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// CreateIAMUsersAndPolicies creates IAM users and policies based on the configuration
+func (b *Bootstrapper) CreateIAMUsersAndPolicies(ctx context.Context, users []IAMUser) ([]ResourceResult, error) {
+	var results []ResourceResult
+	for _, user := range users {
+		// Stop before starting the next resource if the run was cancelled or timed out
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+
+		res := newResourceResult(ResourceTypeIAM, user.Name)
+		err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+			return b.ensureIAMUser(ctx, user, res)
+		})
+		results = append(results, res.finish(err))
+		if err != nil && !b.tolerate(err) {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// ensureIAMUser creates a single IAM user if needed and attaches its policies
+func (b *Bootstrapper) ensureIAMUser(ctx context.Context, user IAMUser, res *ResourceResult) error {
+	logger.Info("Ensuring IAM user", "user", user.Name)
+
+	// Check if user exists
+	getUserOutput, err := b.iamClient.GetUser(ctx, &iam.GetUserInput{
+		UserName: aws.String(user.Name),
+	})
+
+	existed := err == nil
+	if err != nil {
+		if !isAPIError[*iamtypes.NoSuchEntityException](err) {
+			return fmt.Errorf("failed to get IAM user %s: %w", user.Name, err)
+		}
+
+		// User doesn't exist, create it
+		createInput := &iam.CreateUserInput{
+			UserName: aws.String(user.Name),
+		}
+		if len(user.Tags) > 0 {
+			createInput.Tags = buildIAMTags(user.Tags)
+		}
+		if user.PermissionBoundary != "" {
+			createInput.PermissionsBoundary = aws.String(user.PermissionBoundary)
+		}
+
+		createOutput, err := b.iamClient.CreateUser(ctx, createInput)
+		if err != nil {
+			return fmt.Errorf("failed to create IAM user %s: %w", user.Name, err)
+		}
+		res.created()
+		if createOutput.User != nil {
+			res.ARN = aws.ToString(createOutput.User.Arn)
+		}
+		logger.Info("Created IAM user", "user", user.Name)
+	} else {
+		logger.Info("IAM user already exists", "user", user.Name)
+		if getUserOutput.User != nil {
+			res.ARN = aws.ToString(getUserOutput.User.Arn)
+		}
+		if user.IfNotExists {
+			leaveExisting(res)
+			return nil
+		}
+
+		if len(user.Tags) > 0 {
+			_, err = b.iamClient.TagUser(ctx, &iam.TagUserInput{
+				UserName: aws.String(user.Name),
+				Tags:     buildIAMTags(user.Tags),
+			})
+			if err != nil {
+				res.warnf("failed to set tags for IAM user %s: %v", user.Name, err)
+			} else {
+				res.updated()
+				logger.Info("Set IAM user tags", "user", user.Name, "tags", len(user.Tags))
+			}
+		}
+		if b.pruneTags && getUserOutput.User != nil {
+			b.pruneIAMUserTags(ctx, user, getUserOutput.User.Tags, res)
+		}
+
+		var currentBoundary string
+		if getUserOutput.User != nil && getUserOutput.User.PermissionsBoundary != nil {
+			currentBoundary = aws.ToString(getUserOutput.User.PermissionsBoundary.PermissionsBoundaryArn)
+		}
+		b.reconcileIAMPermissionBoundary(ctx, user, currentBoundary, res)
+	}
+
+	if err := b.reconcileIAMLoginProfile(ctx, user, res); err != nil {
+		return err
+	}
+
+	// Reconcile inline policies
+	if err := b.reconcileIAMInlinePolicies(ctx, user, res); err != nil {
+		return err
+	}
+
+	// Create and attach policies
+	for _, policy := range user.Policies {
+		policyArn, changed, err := b.createIAMPolicy(ctx, user.Name, policy)
+		if err != nil {
+			return err
+		}
+		if changed {
+			res.updated()
+		}
+		if policy.PolicyDocument != "" {
+			b.reconcileIAMPolicyTags(ctx, policyArn, iamPolicyName(user.Name, policy.Name), policy.Tags, res)
+		}
+		res.recordPolicyARN(policy.Name, policyArn)
+
+		// Attach policy to user, waiting for a new user or policy to become visible
+		err = b.retryIAM(ctx, "AttachUserPolicy", func() error {
+			_, err := b.iamClient.AttachUserPolicy(ctx, &iam.AttachUserPolicyInput{
+				UserName:  aws.String(user.Name),
+				PolicyArn: aws.String(policyArn),
+			})
+			return err
+		}, "NoSuchEntity")
+		if err != nil {
+			// Check if policy is already attached (which is fine)
+			if isAPIError[*iamtypes.EntityAlreadyExistsException](err) {
+				logger.Info("Policy already attached", "user", user.Name, "policy", policy.Name)
+			} else {
+				res.warnf("failed to attach policy %s to user %s: %v", policy.Name, user.Name, err)
+			}
+		} else {
+			logger.Info("Attached policy", "user", user.Name, "policy", policy.Name)
+		}
+	}
+
+	if existed && b.importing {
+		if err := b.detachUnconfiguredUserPolicies(ctx, user, res); err != nil {
+			return err
+		}
+	}
+
+	// Reconcile group membership only when the user declares its groups
+	if user.Groups != nil {
+		if err := b.reconcileIAMUserGroups(ctx, user, res); err != nil {
+			return err
+		}
+	}
+
+	return b.simulateIAMPolicies(ctx, user, res)
+}
+
+// reconcileIAMPermissionBoundary sets, replaces or removes the permissions boundary of an
+// existing user so that it matches the configuration
+func (b *Bootstrapper) reconcileIAMPermissionBoundary(ctx context.Context, user IAMUser, currentBoundary string, res *ResourceResult) {
+	if currentBoundary == user.PermissionBoundary {
+		return
+	}
+
+	if user.PermissionBoundary == "" {
+		_, err := b.iamClient.DeleteUserPermissionsBoundary(ctx, &iam.DeleteUserPermissionsBoundaryInput{
+			UserName: aws.String(user.Name),
+		})
+		if err != nil {
+			res.warnf("failed to remove permissions boundary from IAM user %s: %v", user.Name, err)
+			return
+		}
+		res.updated()
+		logger.Info("Removed permissions boundary", "user", user.Name)
+		return
+	}
+
+	_, err := b.iamClient.PutUserPermissionsBoundary(ctx, &iam.PutUserPermissionsBoundaryInput{
+		UserName:            aws.String(user.Name),
+		PermissionsBoundary: aws.String(user.PermissionBoundary),
+	})
+	if err != nil {
+		res.warnf("failed to set permissions boundary for IAM user %s: %v", user.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Set permissions boundary", "user", user.Name, "boundary", user.PermissionBoundary)
+}
+
+// reconcileIAMInlinePolicies writes the user's configured inline policies and deletes any
+// inline policy that is no longer in the configuration
+func (b *Bootstrapper) reconcileIAMInlinePolicies(ctx context.Context, user IAMUser, res *ResourceResult) error {
+	wanted := make(map[string]bool, len(user.InlinePolicies))
+	for _, policy := range user.InlinePolicies {
+		wanted[policy.Name] = true
+
+		_, err := b.iamClient.PutUserPolicy(ctx, &iam.PutUserPolicyInput{
+			UserName:       aws.String(user.Name),
+			PolicyName:     aws.String(policy.Name),
+			PolicyDocument: aws.String(policy.PolicyDocument),
+		})
+		if err != nil {
+			res.warnf("failed to set inline policy %s for IAM user %s: %v", policy.Name, user.Name, err)
+			continue
+		}
+		res.updated()
+		logger.Info("Set inline policy", "user", user.Name, "policy", policy.Name)
+	}
+
+	paginator := iam.NewListUserPoliciesPaginator(b.iamClient, &iam.ListUserPoliciesInput{
+		UserName: aws.String(user.Name),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list inline policies for IAM user %s: %w", user.Name, err)
+		}
+
+		for _, policyName := range page.PolicyNames {
+			if wanted[policyName] {
+				continue
+			}
+
+			_, err = b.iamClient.DeleteUserPolicy(ctx, &iam.DeleteUserPolicyInput{
+				UserName:   aws.String(user.Name),
+				PolicyName: aws.String(policyName),
+			})
+			if err != nil {
+				res.warnf("failed to delete inline policy %s from IAM user %s: %v", policyName, user.Name, err)
+				continue
+			}
+			res.updated()
+			logger.Info("Deleted inline policy", "user", user.Name, "policy", policyName)
+		}
+	}
+
+	return nil
+}
+
+// reconcileIAMUserGroups adds the user to its configured groups and removes it from any other group
+func (b *Bootstrapper) reconcileIAMUserGroups(ctx context.Context, user IAMUser, res *ResourceResult) error {
+	current := make(map[string]bool)
+	paginator := iam.NewListGroupsForUserPaginator(b.iamClient, &iam.ListGroupsForUserInput{
+		UserName: aws.String(user.Name),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list groups for IAM user %s: %w", user.Name, err)
+		}
+		for _, group := range page.Groups {
+			current[aws.ToString(group.GroupName)] = true
+		}
+	}
+
+	wanted := make(map[string]bool, len(user.Groups))
+	for _, groupName := range user.Groups {
+		wanted[groupName] = true
+		if current[groupName] {
+			continue
+		}
+
+		_, err := b.iamClient.AddUserToGroup(ctx, &iam.AddUserToGroupInput{
+			UserName:  aws.String(user.Name),
+			GroupName: aws.String(groupName),
+		})
+		if err != nil {
+			res.warnf("failed to add user %s to group %s: %v", user.Name, groupName, err)
+			continue
+		}
+		res.updated()
+		logger.Info("Added user to group", "user", user.Name, "group", groupName)
+	}
+
+	for groupName := range current {
+		if wanted[groupName] {
+			continue
+		}
+
+		_, err := b.iamClient.RemoveUserFromGroup(ctx, &iam.RemoveUserFromGroupInput{
+			UserName:  aws.String(user.Name),
+			GroupName: aws.String(groupName),
+		})
+		if err != nil {
+			res.warnf("failed to remove user %s from group %s: %v", user.Name, groupName, err)
+			continue
+		}
+		res.updated()
+		logger.Info("Removed user from group", "user", user.Name, "group", groupName)
+	}
+
+	return nil
+}
+
+// createIAMPolicy creates or updates an IAM policy for a user or group and returns its ARN
+// and whether anything was written. A policy created concurrently may not be listed yet, so
+// creating it is retried while IAM reports that it already exists.
+func (b *Bootstrapper) createIAMPolicy(ctx context.Context, ownerName string, policy IAMPolicy) (string, bool, error) {
+	var policyArn string
+	var changed bool
+	err := b.retryIAM(ctx, "CreatePolicy", func() error {
+		var err error
+		policyArn, changed, err = b.ensureIAMPolicy(ctx, ownerName, policy)
+		return err
+	}, "EntityAlreadyExists", "ConcurrentModification")
+	return policyArn, changed, err
+}
+
+// ensureIAMPolicy creates the policy, or adds a new default version when it already exists
+// with a different document
+func (b *Bootstrapper) ensureIAMPolicy(ctx context.Context, ownerName string, policy IAMPolicy) (string, bool, error) {
+	if (policy.PolicyDocument == "") == (policy.PolicyArn == "") {
+		return "", false, fmt.Errorf("IAM policy %s for %s must set exactly one of policy_document or policy_arn", policy.Name, ownerName)
+	}
+
+	// Existing managed policies, including AWS-managed ones, are attached as-is
+	if policy.PolicyArn != "" {
+		return policy.PolicyArn, false, nil
+	}
+
+	fullPolicyName := iamPolicyName(ownerName, policy.Name)
+
+	// Check if policy exists
+	listPoliciesOutput, err := b.iamClient.ListPolicies(ctx, &iam.ListPoliciesInput{
+		Scope: "Local",
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to list IAM policies: %w", err)
+	}
+
+	for _, p := range listPoliciesOutput.Policies {
+		if *p.PolicyName == fullPolicyName {
+			policyArn := *p.Arn
+
+			// A new version with the same document would only use up one of the version slots
+			versionOutput, err := b.iamClient.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+				PolicyArn: aws.String(policyArn),
+				VersionId: p.DefaultVersionId,
+			})
+			if err != nil {
+				return "", false, fmt.Errorf("failed to get the current version of IAM policy %s: %w", fullPolicyName, err)
+			}
+			var current string
+			if versionOutput.PolicyVersion != nil {
+				current = decodePolicyDocument(aws.ToString(versionOutput.PolicyVersion.Document))
+			}
+			if jsonEqual(current, policy.PolicyDocument) {
+				logger.Info("IAM policy already up to date", "policy", fullPolicyName)
+				return policyArn, false, nil
+			}
+
+			logger.Info("IAM policy already exists, updating policy document", "policy", fullPolicyName)
+			if b.policyDiff != nil {
+				if err := writePolicyDiff(b.policyDiff, fullPolicyName, current, policy.PolicyDocument); err != nil {
+					return "", false, fmt.Errorf("failed to write diff of IAM policy %s: %w", fullPolicyName, err)
+				}
+			}
+
+			// IAM keeps at most five versions per policy, so make room for the new one
+			if err := b.pruneIAMPolicyVersions(ctx, policyArn, fullPolicyName); err != nil {
+				return "", false, err
+			}
+
+			// Create a new version of the policy (this effectively updates it)
+			_, err = b.iamClient.CreatePolicyVersion(ctx, &iam.CreatePolicyVersionInput{
+				PolicyArn:      aws.String(policyArn),
+				PolicyDocument: aws.String(policy.PolicyDocument),
+				SetAsDefault:   true,
+			})
+			if err != nil {
+				return "", false, fmt.Errorf("failed to update IAM policy %s: %w", fullPolicyName, err)
+			}
+
+			logger.Info("Updated IAM policy", "policy", fullPolicyName)
+			return policyArn, true, nil
+		}
+	}
+
+	// Policy doesn't exist, create it
+	createInput := &iam.CreatePolicyInput{
+		PolicyName:     aws.String(fullPolicyName),
+		Description:    aws.String(policy.Description),
+		PolicyDocument: aws.String(policy.PolicyDocument),
+	}
+	if len(policy.Tags) > 0 {
+		createInput.Tags = buildIAMTags(policy.Tags)
+	}
+	createPolicyOutput, err := b.iamClient.CreatePolicy(ctx, createInput)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create IAM policy %s: %w", fullPolicyName, err)
+	}
+
+	logger.Info("Created IAM policy", "policy", fullPolicyName)
+	return *createPolicyOutput.Policy.Arn, true, nil
+}
+
+// maxIAMPolicyVersions is the number of versions IAM keeps for a managed policy
+const maxIAMPolicyVersions = 5
+
+// pruneIAMPolicyVersions deletes the oldest non-default version of a policy when it already
+// has the maximum number of versions, so that a new version can be created
+func (b *Bootstrapper) pruneIAMPolicyVersions(ctx context.Context, policyArn, policyName string) error {
+	versions, err := b.iamClient.ListPolicyVersions(ctx, &iam.ListPolicyVersionsInput{
+		PolicyArn: aws.String(policyArn),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list versions of IAM policy %s: %w", policyName, err)
+	}
+	if len(versions.Versions) < maxIAMPolicyVersions {
+		return nil
+	}
+
+	var oldest *iamtypes.PolicyVersion
+	for i, version := range versions.Versions {
+		if version.IsDefaultVersion {
+			continue
+		}
+		if oldest == nil || aws.ToTime(version.CreateDate).Before(aws.ToTime(oldest.CreateDate)) {
+			oldest = &versions.Versions[i]
+		}
+	}
+	if oldest == nil {
+		return nil
+	}
+
+	_, err = b.iamClient.DeletePolicyVersion(ctx, &iam.DeletePolicyVersionInput{
+		PolicyArn: aws.String(policyArn),
+		VersionId: oldest.VersionId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete version %s of IAM policy %s: %w", aws.ToString(oldest.VersionId), policyName, err)
+	}
+	logger.Info("Deleted oldest IAM policy version", "policy", policyName, "version", aws.ToString(oldest.VersionId))
+	return nil
+}
+
+// iamPolicyName returns the name of the managed policy created for a user or group.
+// Policy names are prefixed with the user or group name to avoid conflicts.
+func iamPolicyName(ownerName, policyName string) string {
+	return fmt.Sprintf("%s-%s", ownerName, policyName)
+}
+
+// pruneIAMUserTags removes tags from an existing user that are not in its configuration
+func (b *Bootstrapper) pruneIAMUserTags(ctx context.Context, user IAMUser, tags []iamtypes.Tag, res *ResourceResult) {
+	current := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		current[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	stale := staleTagKeys(current, user.Tags)
+	if len(stale) == 0 {
+		return
+	}
+	_, err := b.iamClient.UntagUser(ctx, &iam.UntagUserInput{
+		UserName: aws.String(user.Name),
+		TagKeys:  stale,
+	})
+	if err != nil {
+		res.warnf("failed to remove tags from IAM user %s: %v", user.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Removed IAM user tags", "user", user.Name, "tags", strings.Join(stale, ","))
+}
+
+// reconcileIAMPolicyTags sets the configured tags of a customer-managed policy that are
+// missing or have another value. With -prune-tags, tags that are not configured are removed.
+func (b *Bootstrapper) reconcileIAMPolicyTags(ctx context.Context, policyArn, policyName string, tags map[string]string, res *ResourceResult) {
+	if len(tags) == 0 && !b.pruneTags {
+		return
+	}
+	output, err := b.iamClient.ListPolicyTags(ctx, &iam.ListPolicyTagsInput{
+		PolicyArn: aws.String(policyArn),
+	})
+	if err != nil {
+		res.warnf("failed to list tags of IAM policy %s: %v", policyName, err)
+		return
+	}
+	current := make(map[string]string, len(output.Tags))
+	for _, tag := range output.Tags {
+		current[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	changed := make(map[string]string)
+	for key, value := range tags {
+		if existing, ok := current[key]; !ok || existing != value {
+			changed[key] = value
+		}
+	}
+	if len(changed) > 0 {
+		_, err := b.iamClient.TagPolicy(ctx, &iam.TagPolicyInput{
+			PolicyArn: aws.String(policyArn),
+			Tags:      buildIAMTags(changed),
+		})
+		if err != nil {
+			res.warnf("failed to set tags for IAM policy %s: %v", policyName, err)
+		} else {
+			res.updated()
+			logger.Info("Set IAM policy tags", "policy", policyName, "tags", len(changed))
+		}
+	}
+
+	if !b.pruneTags {
+		return
+	}
+	stale := staleTagKeys(current, tags)
+	if len(stale) == 0 {
+		return
+	}
+	_, err = b.iamClient.UntagPolicy(ctx, &iam.UntagPolicyInput{
+		PolicyArn: aws.String(policyArn),
+		TagKeys:   stale,
+	})
+	if err != nil {
+		res.warnf("failed to remove tags from IAM policy %s: %v", policyName, err)
+		return
+	}
+	res.updated()
+	logger.Info("Removed IAM policy tags", "policy", policyName, "tags", strings.Join(stale, ","))
+}
+
+// buildIAMTags converts a tag map into IAM tags sorted by key
+func buildIAMTags(tags map[string]string) []iamtypes.Tag {
+	result := make([]iamtypes.Tag, 0, len(tags))
+	for _, key := range sortedKeys(tags) {
+		result = append(result, iamtypes.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// CreateIAMGroups creates IAM groups and their policies based on the configuration
+func (b *Bootstrapper) CreateIAMGroups(ctx context.Context, groups []IAMGroup) ([]ResourceResult, error) {
+	var results []ResourceResult
+	for _, group := range groups {
+		// Stop before starting the next resource if the run was cancelled or timed out
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+
+		res := newResourceResult(ResourceTypeIAMGroup, group.Name)
+		err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+			return b.ensureIAMGroup(ctx, group, res)
+		})
+		results = append(results, res.finish(err))
+		if err != nil && !b.tolerate(err) {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// ensureIAMGroup creates a single IAM group if needed and attaches its policies
+func (b *Bootstrapper) ensureIAMGroup(ctx context.Context, group IAMGroup, res *ResourceResult) error {
+	logger.Info("Ensuring IAM group", "group", group.Name)
+
+	// Check if group exists
+	getOutput, err := b.iamClient.GetGroup(ctx, &iam.GetGroupInput{
+		GroupName: aws.String(group.Name),
+	})
+
+	existed := err == nil
+	if err != nil {
+		if !isAPIError[*iamtypes.NoSuchEntityException](err) {
+			return fmt.Errorf("failed to get IAM group %s: %w", group.Name, err)
+		}
+
+		// Group doesn't exist, create it
+		createOutput, err := b.iamClient.CreateGroup(ctx, &iam.CreateGroupInput{
+			GroupName: aws.String(group.Name),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create IAM group %s: %w", group.Name, err)
+		}
+		res.created()
+		if createOutput.Group != nil {
+			res.ARN = aws.ToString(createOutput.Group.Arn)
+		}
+		logger.Info("Created IAM group", "group", group.Name)
+	} else {
+		logger.Info("IAM group already exists", "group", group.Name)
+		if getOutput.Group != nil {
+			res.ARN = aws.ToString(getOutput.Group.Arn)
+		}
+		if group.IfNotExists {
+			leaveExisting(res)
+			return nil
+		}
+	}
+
+	// Create and attach policies
+	for _, policy := range group.Policies {
+		policyArn, changed, err := b.createIAMPolicy(ctx, group.Name, policy)
+		if err != nil {
+			return err
+		}
+		if changed {
+			res.updated()
+		}
+		if policy.PolicyDocument != "" {
+			b.reconcileIAMPolicyTags(ctx, policyArn, iamPolicyName(group.Name, policy.Name), policy.Tags, res)
+		}
+		res.recordPolicyARN(policy.Name, policyArn)
+
+		// A group or policy created a moment ago may not be visible yet
+		err = b.retryIAM(ctx, "AttachGroupPolicy", func() error {
+			_, err := b.iamClient.AttachGroupPolicy(ctx, &iam.AttachGroupPolicyInput{
+				GroupName: aws.String(group.Name),
+				PolicyArn: aws.String(policyArn),
+			})
+			return err
+		}, "NoSuchEntity")
+		if err != nil {
+			res.warnf("failed to attach policy %s to group %s: %v", policy.Name, group.Name, err)
+		} else {
+			logger.Info("Attached policy", "group", group.Name, "policy", policy.Name)
+		}
+	}
+
+	if existed && b.importing {
+		return b.detachUnconfiguredGroupPolicies(ctx, group, res)
+	}
+	return nil
+}
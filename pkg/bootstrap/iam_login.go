@@ -0,0 +1,115 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// iamPasswordSymbols are the symbols used in generated console passwords; all of them are
+// accepted by IAM password policies that require symbols
+const iamPasswordSymbols = "!#$%^&*()-_=+[]{}"
+
+// maxIAMPasswordLength is the longest console password IAM accepts
+const maxIAMPasswordLength = 128
+
+// reconcileIAMLoginProfile creates, updates or deletes the user's login profile so that
+// console access matches the configuration. The password of an existing login profile is
+// left alone; only password_reset_required is updated.
+func (b *Bootstrapper) reconcileIAMLoginProfile(ctx context.Context, user IAMUser, res *ResourceResult) error {
+	// A user created by this run has no login profile yet
+	var profile *iamtypes.LoginProfile
+	if res.Action != ActionCreated {
+		output, err := b.iamClient.GetLoginProfile(ctx, &iam.GetLoginProfileInput{
+			UserName: aws.String(user.Name),
+		})
+		if err != nil && !isAPIError[*iamtypes.NoSuchEntityException](err) {
+			return fmt.Errorf("failed to get login profile for IAM user %s: %w", user.Name, err)
+		}
+		if err == nil {
+			profile = output.LoginProfile
+		}
+	}
+
+	access := user.ConsoleAccess
+	switch {
+	case access == nil && profile == nil:
+		return nil
+
+	case access == nil:
+		_, err := b.iamClient.DeleteLoginProfile(ctx, &iam.DeleteLoginProfileInput{
+			UserName: aws.String(user.Name),
+		})
+		if err != nil && !isAPIError[*iamtypes.NoSuchEntityException](err) {
+			return fmt.Errorf("failed to remove console access from IAM user %s: %w", user.Name, err)
+		}
+		res.updated()
+		logger.Info("Removed console access", "user", user.Name)
+		return nil
+
+	case profile != nil:
+		if profile.PasswordResetRequired == access.PasswordResetRequired {
+			return nil
+		}
+		_, err := b.iamClient.UpdateLoginProfile(ctx, &iam.UpdateLoginProfileInput{
+			UserName:              aws.String(user.Name),
+			PasswordResetRequired: aws.Bool(access.PasswordResetRequired),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update login profile for IAM user %s: %w", user.Name, err)
+		}
+		res.updated()
+		logger.Info("Updated console access", "user", user.Name, "password_reset_required", access.PasswordResetRequired)
+		return nil
+	}
+
+	password := access.Password
+	if password == "" {
+		var err error
+		if password, err = b.generateConsolePassword(ctx); err != nil {
+			return fmt.Errorf("failed to generate console password for IAM user %s: %w", user.Name, err)
+		}
+		// Save the password before it is set so it is never lost
+		if err := b.recordCredential(Credential{Type: ResourceTypeIAM, Name: user.Name, Password: password}); err != nil {
+			return fmt.Errorf("failed to save console password for IAM user %s: %w", user.Name, err)
+		}
+	}
+
+	// A new user may not be visible to the login profile API yet
+	err := b.retryIAM(ctx, "CreateLoginProfile", func() error {
+		_, err := b.iamClient.CreateLoginProfile(ctx, &iam.CreateLoginProfileInput{
+			UserName:              aws.String(user.Name),
+			Password:              aws.String(password),
+			PasswordResetRequired: access.PasswordResetRequired,
+		})
+		return err
+	}, "NoSuchEntity")
+	if err != nil {
+		return fmt.Errorf("failed to enable console access for IAM user %s: %w", user.Name, err)
+	}
+	res.updated()
+	logger.Info("Enabled console access", "user", user.Name, "password_reset_required", access.PasswordResetRequired)
+	return nil
+}
+
+// generateConsolePassword returns a random console password at least as long as the
+// account password policy requires. The generated password always contains every
+// character class, so the other requirements of the policy are met as well.
+func (b *Bootstrapper) generateConsolePassword(ctx context.Context) (string, error) {
+	length := defaultPasswordLength
+	output, err := b.iamClient.GetAccountPasswordPolicy(ctx, &iam.GetAccountPasswordPolicyInput{})
+	switch {
+	case err == nil:
+		if output.PasswordPolicy != nil {
+			length = max(length, int(aws.ToInt32(output.PasswordPolicy.MinimumPasswordLength)))
+		}
+	case isAPIError[*iamtypes.NoSuchEntityException](err):
+		// The account has no password policy, so the defaults apply
+	default:
+		return "", fmt.Errorf("failed to get account password policy: %w", err)
+	}
+	return generatePassword(min(length, maxIAMPasswordLength), iamPasswordSymbols)
+}
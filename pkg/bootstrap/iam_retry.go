@@ -0,0 +1,52 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// IAM is eventually consistent: a user or policy created a moment ago may not be visible yet
+// to the next call. These defaults wait about seven seconds in total before giving up.
+const (
+	defaultIAMRetryAttempts = 5
+	defaultIAMRetryInterval = 500 * time.Millisecond
+)
+
+// SetIAMRetry sets how often IAM calls that can fail while a new entity propagates are tried,
+// and the wait before the first retry, which doubles after every attempt. Zero values keep
+// the defaults of 5 attempts and 500ms.
+func (b *Bootstrapper) SetIAMRetry(attempts int, interval time.Duration) {
+	b.iamRetryAttempts = attempts
+	b.iamRetryInterval = interval
+}
+
+// retryIAM calls fn until it succeeds or returns an error that does not have one of the
+// given IAM error codes, backing off between attempts. The last error is returned when the
+// attempts run out.
+func (b *Bootstrapper) retryIAM(ctx context.Context, operation string, fn func() error, codes ...string) error {
+	attempts := b.iamRetryAttempts
+	if attempts <= 0 {
+		attempts = defaultIAMRetryAttempts
+	}
+	wait := b.iamRetryInterval
+	if wait <= 0 {
+		wait = defaultIAMRetryInterval
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts || !hasErrorCode(err, codes...) {
+			return err
+		}
+
+		logger.Debug("Retrying IAM call while changes propagate", "operation", operation,
+			"attempt", attempt, "wait", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (while retrying after: %v)", ctx.Err(), err)
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
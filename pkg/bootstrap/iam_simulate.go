@@ -0,0 +1,138 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/smithy-go"
+)
+
+// The decisions a simulation check can expect. denied matches both an explicit deny and
+// the implicit deny of an action no policy allows.
+const (
+	simulationAllowed = "allowed"
+	simulationDenied  = "denied"
+)
+
+// errSimulationPending makes retryIAM simulate again while a policy change propagates
+var errSimulationPending = &smithy.GenericAPIError{Code: "SimulationMismatch", Message: "policy simulation does not match yet"}
+
+// SimulationResult is the outcome of one policy simulation check
+type SimulationResult struct {
+	Policy   string `json:"policy"`
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+	Expected string `json:"expected"`
+	// Decision is the decision IAM made: allowed, explicitDeny or implicitDeny
+	Decision string `json:"decision"`
+	Passed   bool   `json:"passed"`
+}
+
+// String formats the check as a single line, e.g. "PASS read-only: s3:GetObject on * allowed"
+func (s SimulationResult) String() string {
+	if s.Passed {
+		return fmt.Sprintf("PASS %s: %s on %s %s", s.Policy, s.Action, s.Resource, s.Decision)
+	}
+	return fmt.Sprintf("FAIL %s: %s on %s %s, expected %s", s.Policy, s.Action, s.Resource, s.Decision, s.Expected)
+}
+
+// simulateIAMPolicies runs the simulation checks of the user's policies against all the
+// policies that apply to the user and records the results. A mismatch fails the user
+// unless the policy's simulation is warn_only.
+func (b *Bootstrapper) simulateIAMPolicies(ctx context.Context, user IAMUser, res *ResourceResult) error {
+	var mismatches []string
+	for _, policy := range user.Policies {
+		if policy.Simulate == nil {
+			continue
+		}
+		if res.ARN == "" {
+			res.warnf("cannot simulate policy %s: the ARN of IAM user %s is unknown", policy.Name, user.Name)
+			continue
+		}
+
+		// Changes made by this run may take a few seconds to show in simulations
+		changed := res.Action != ActionUnchanged
+		var results []SimulationResult
+		err := b.retryIAM(ctx, "SimulatePrincipalPolicy", func() error {
+			var err error
+			results, err = b.simulatePolicy(ctx, res.ARN, policy)
+			if err != nil {
+				return err
+			}
+			if changed && !allPassed(results) {
+				return errSimulationPending
+			}
+			return nil
+		}, "NoSuchEntity", errSimulationPending.Code)
+		if err != nil && !errors.Is(err, errSimulationPending) {
+			return fmt.Errorf("failed to simulate policy %s for IAM user %s: %w", policy.Name, user.Name, err)
+		}
+		res.Simulations = append(res.Simulations, results...)
+
+		for _, result := range results {
+			if result.Passed {
+				continue
+			}
+			if policy.Simulate.WarnOnly {
+				res.warnf("policy simulation %s", result)
+				continue
+			}
+			mismatches = append(mismatches, result.String())
+		}
+		logger.Info("Simulated policy", "user", user.Name, "policy", policy.Name, "checks", len(results))
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("policy simulation failed for IAM user %s:\n  %s", user.Name, strings.Join(mismatches, "\n  "))
+	}
+	return nil
+}
+
+// simulatePolicy evaluates each check of the policy for the user
+func (b *Bootstrapper) simulatePolicy(ctx context.Context, userARN string, policy IAMPolicy) ([]SimulationResult, error) {
+	results := make([]SimulationResult, 0, len(policy.Simulate.Checks))
+	for _, check := range policy.Simulate.Checks {
+		resource := check.Resource
+		if resource == "" {
+			resource = "*"
+		}
+		output, err := b.iamClient.SimulatePrincipalPolicy(ctx, &iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(userARN),
+			ActionNames:     []string{check.Action},
+			ResourceArns:    []string{resource},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(output.EvaluationResults) == 0 {
+			return nil, fmt.Errorf("no evaluation result for %s on %s", check.Action, resource)
+		}
+
+		decision := output.EvaluationResults[0].EvalDecision
+		allowed := decision == iamtypes.PolicyEvaluationDecisionTypeAllowed
+		results = append(results, SimulationResult{
+			Policy:   policy.Name,
+			Action:   check.Action,
+			Resource: resource,
+			Expected: check.Expect,
+			Decision: string(decision),
+			Passed:   allowed == (check.Expect == simulationAllowed),
+		})
+	}
+	return results, nil
+}
+
+// allPassed reports whether every simulation check passed
+func allPassed(results []SimulationResult) bool {
+	for _, result := range results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
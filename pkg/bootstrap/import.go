@@ -0,0 +1,246 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// SetImport makes the run adopt S3 buckets, ECR repositories and IAM users and groups that
+// already exist. Their configuration is applied as usual, and the settings it leaves out
+// are removed as well, so adopted resources converge to the configuration instead of
+// keeping what was set up outside this tool.
+func (b *Bootstrapper) SetImport(adopt bool) {
+	b.importing = adopt
+}
+
+// importedSetting is an optional setting of an adopted resource, which is removed when the
+// configuration leaves it out
+type importedSetting struct {
+	name       string
+	configured bool
+	// present reports whether the resource has the setting
+	present func() (bool, error)
+	remove  func() error
+}
+
+// settingPresent interprets the error of reading a setting; the error codes mean that the
+// resource does not have it
+func settingPresent(err error, missingCodes ...string) (bool, error) {
+	if err != nil && hasErrorCode(err, missingCodes...) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// removeUnconfigured removes the settings the configuration leaves out from an adopted
+// resource, named for example "bucket my-bucket". Failures are warnings, like the other
+// settings of the resource.
+func removeUnconfigured(resource string, settings []importedSetting, res *ResourceResult) {
+	for _, setting := range settings {
+		if setting.configured {
+			continue
+		}
+		present, err := setting.present()
+		if err != nil {
+			res.warnf("failed to get %s of %s: %v", setting.name, resource, err)
+			continue
+		}
+		if !present {
+			continue
+		}
+		if err := setting.remove(); err != nil {
+			res.warnf("failed to remove %s from %s: %v", setting.name, resource, err)
+			continue
+		}
+		res.updated()
+		logger.Info("Removed setting that is not in the configuration", "resource", resource, "setting", setting.name)
+	}
+}
+
+// adoptS3Bucket removes the policy, CORS rules, lifecycle rules, replication and
+// notifications of an existing bucket that its configuration leaves out. Versioning and
+// encryption are kept: versioning can only be suspended, and every bucket is encrypted.
+func (b *Bootstrapper) adoptS3Bucket(ctx context.Context, bucket S3Bucket, policy string, res *ResourceResult) {
+	logger.Info("Adopting existing S3 bucket; settings not in the configuration are removed", "bucket", bucket.Name)
+
+	name := aws.String(bucket.Name)
+	removeUnconfigured("bucket "+bucket.Name, []importedSetting{
+		{
+			name:       "policy",
+			configured: policy != "",
+			present: func() (bool, error) {
+				_, err := b.s3Client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: name})
+				return settingPresent(err, "NoSuchBucketPolicy")
+			},
+			remove: func() error {
+				_, err := b.s3Client.DeleteBucketPolicy(ctx, &s3.DeleteBucketPolicyInput{Bucket: name})
+				return err
+			},
+		},
+		{
+			name:       "CORS rules",
+			configured: len(bucket.CORS) > 0,
+			present: func() (bool, error) {
+				_, err := b.s3Client.GetBucketCors(ctx, &s3.GetBucketCorsInput{Bucket: name})
+				return settingPresent(err, "NoSuchCORSConfiguration")
+			},
+			remove: func() error {
+				_, err := b.s3Client.DeleteBucketCors(ctx, &s3.DeleteBucketCorsInput{Bucket: name})
+				return err
+			},
+		},
+		{
+			name:       "lifecycle rules",
+			configured: len(bucket.LifecycleRules) > 0,
+			present: func() (bool, error) {
+				_, err := b.s3Client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: name})
+				return settingPresent(err, "NoSuchLifecycleConfiguration")
+			},
+			remove: func() error {
+				_, err := b.s3Client.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{Bucket: name})
+				return err
+			},
+		},
+		{
+			name:       "replication",
+			configured: bucket.Replication != nil,
+			present: func() (bool, error) {
+				_, err := b.s3Client.GetBucketReplication(ctx, &s3.GetBucketReplicationInput{Bucket: name})
+				return settingPresent(err, "ReplicationConfigurationNotFoundError")
+			},
+			remove: func() error {
+				_, err := b.s3Client.DeleteBucketReplication(ctx, &s3.DeleteBucketReplicationInput{Bucket: name})
+				return err
+			},
+		},
+		{
+			name:       "notifications",
+			configured: len(bucket.Notifications) > 0,
+			present: func() (bool, error) {
+				output, err := b.s3Client.GetBucketNotificationConfiguration(ctx, &s3.GetBucketNotificationConfigurationInput{Bucket: name})
+				if err != nil {
+					return false, err
+				}
+				return len(output.TopicConfigurations) > 0 || len(output.QueueConfigurations) > 0 ||
+					len(output.LambdaFunctionConfigurations) > 0 || output.EventBridgeConfiguration != nil, nil
+			},
+			remove: func() error {
+				// An empty configuration turns every notification off
+				_, err := b.s3Client.PutBucketNotificationConfiguration(ctx, &s3.PutBucketNotificationConfigurationInput{
+					Bucket:                    name,
+					NotificationConfiguration: &types.NotificationConfiguration{},
+				})
+				return err
+			},
+		},
+	}, res)
+}
+
+// adoptECRRepository removes the lifecycle and repository policies of an existing
+// repository that its configuration leaves out
+func (b *Bootstrapper) adoptECRRepository(ctx context.Context, repo ECRRepository, lifecyclePolicy, repositoryPolicy string, res *ResourceResult) {
+	logger.Info("Adopting existing ECR repository; settings not in the configuration are removed", "repository", repo.Name)
+
+	name := aws.String(repo.Name)
+	removeUnconfigured("ECR repository "+repo.Name, []importedSetting{
+		{
+			name:       "lifecycle policy",
+			configured: lifecyclePolicy != "",
+			present: func() (bool, error) {
+				_, err := b.ecrClient.GetLifecyclePolicy(ctx, &ecr.GetLifecyclePolicyInput{RepositoryName: name})
+				return settingPresent(err, "LifecyclePolicyNotFoundException")
+			},
+			remove: func() error {
+				_, err := b.ecrClient.DeleteLifecyclePolicy(ctx, &ecr.DeleteLifecyclePolicyInput{RepositoryName: name})
+				return err
+			},
+		},
+		{
+			name:       "repository policy",
+			configured: repositoryPolicy != "",
+			present: func() (bool, error) {
+				_, err := b.ecrClient.GetRepositoryPolicy(ctx, &ecr.GetRepositoryPolicyInput{RepositoryName: name})
+				return settingPresent(err, "RepositoryPolicyNotFoundException")
+			},
+			remove: func() error {
+				_, err := b.ecrClient.DeleteRepositoryPolicy(ctx, &ecr.DeleteRepositoryPolicyInput{RepositoryName: name})
+				return err
+			},
+		},
+	}, res)
+}
+
+// detachUnconfiguredUserPolicies detaches the managed policies of an adopted user that
+// are not in its configuration; res holds the ARNs of the configured ones
+func (b *Bootstrapper) detachUnconfiguredUserPolicies(ctx context.Context, user IAMUser, res *ResourceResult) error {
+	logger.Info("Adopting existing IAM user; managed policies not in the configuration are detached", "user", user.Name)
+
+	attached, err := b.iamClient.ListAttachedUserPolicies(ctx, &iam.ListAttachedUserPoliciesInput{
+		UserName: aws.String(user.Name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list policies attached to IAM user %s: %w", user.Name, err)
+	}
+	for _, policy := range unconfiguredPolicies(attached.AttachedPolicies, res) {
+		_, err := b.iamClient.DetachUserPolicy(ctx, &iam.DetachUserPolicyInput{
+			UserName:  aws.String(user.Name),
+			PolicyArn: policy.PolicyArn,
+		})
+		if err != nil {
+			res.warnf("failed to detach policy %s from IAM user %s: %v", aws.ToString(policy.PolicyName), user.Name, err)
+			continue
+		}
+		res.updated()
+		logger.Info("Detached policy that is not in the configuration", "user", user.Name, "policy", aws.ToString(policy.PolicyName))
+	}
+	return nil
+}
+
+// detachUnconfiguredGroupPolicies detaches the managed policies of an adopted group that
+// are not in its configuration; res holds the ARNs of the configured ones
+func (b *Bootstrapper) detachUnconfiguredGroupPolicies(ctx context.Context, group IAMGroup, res *ResourceResult) error {
+	logger.Info("Adopting existing IAM group; managed policies not in the configuration are detached", "group", group.Name)
+
+	attached, err := b.iamClient.ListAttachedGroupPolicies(ctx, &iam.ListAttachedGroupPoliciesInput{
+		GroupName: aws.String(group.Name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list policies attached to IAM group %s: %w", group.Name, err)
+	}
+	for _, policy := range unconfiguredPolicies(attached.AttachedPolicies, res) {
+		_, err := b.iamClient.DetachGroupPolicy(ctx, &iam.DetachGroupPolicyInput{
+			GroupName: aws.String(group.Name),
+			PolicyArn: policy.PolicyArn,
+		})
+		if err != nil {
+			res.warnf("failed to detach policy %s from IAM group %s: %v", aws.ToString(policy.PolicyName), group.Name, err)
+			continue
+		}
+		res.updated()
+		logger.Info("Detached policy that is not in the configuration", "group", group.Name, "policy", aws.ToString(policy.PolicyName))
+	}
+	return nil
+}
+
+// unconfiguredPolicies returns the attached policies whose ARNs are not among the
+// configured policies recorded in res
+func unconfiguredPolicies(attached []iamtypes.AttachedPolicy, res *ResourceResult) []iamtypes.AttachedPolicy {
+	configured := make(map[string]bool, len(res.PolicyARNs))
+	for _, arn := range res.PolicyARNs {
+		configured[arn] = true
+	}
+	var unconfigured []iamtypes.AttachedPolicy
+	for _, policy := range attached {
+		if !configured[aws.ToString(policy.PolicyArn)] {
+			unconfigured = append(unconfigured, policy)
+		}
+	}
+	return unconfigured
+}
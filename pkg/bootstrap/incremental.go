@@ -0,0 +1,149 @@
+package bootstrap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+)
+
+// SetIncremental makes ProvisionResources skip every resource whose configuration hash
+// equals the one recorded for it in applied, the hashes of the last successful apply as
+// returned by State.ConfigHashes. Resources that are new or changed are provisioned as usual.
+func (b *Bootstrapper) SetIncremental(applied map[string]string) {
+	b.appliedHashes = applied
+}
+
+// ConfigHashes returns the configuration hash recorded for each resource by its last
+// successful apply, keyed by type and name
+func (s *State) ConfigHashes() map[string]string {
+	hashes := make(map[string]string, len(s.Resources))
+	for _, res := range s.Resources {
+		if res.ConfigHash != "" {
+			hashes[stateKey(res.Type, res.Name)] = res.ConfigHash
+		}
+	}
+	return hashes
+}
+
+// configHashes returns a hash of the configuration of every resource in the config,
+// keyed by type and name. The contents of the policy and zip files a resource reads are
+// part of its hash, so editing one of them counts as a change.
+func (c *Config) configHashes() map[string]string {
+	hashes := make(map[string]string)
+	add := func(resourceType, name string, resource any, files ...string) {
+		if hash := c.resourceHash(resource, files...); hash != "" {
+			hashes[stateKey(resourceType, name)] = hash
+		}
+	}
+	for _, bucket := range c.S3Buckets {
+		add(ResourceTypeS3, bucket.Name, bucket, bucket.PolicyFile)
+	}
+	for _, repo := range c.ECRRepositories {
+		add(ResourceTypeECR, repo.Name, repo, repo.LifecyclePolicyFile)
+	}
+	for _, group := range c.IAMGroups {
+		add(ResourceTypeIAMGroup, group.Name, group)
+	}
+	for _, user := range c.IAMUsers {
+		add(ResourceTypeIAM, user.Name, user)
+	}
+	for _, instance := range c.RDSInstances {
+		add(ResourceTypeRDS, instance.Identifier, instance)
+	}
+	for _, cluster := range c.AuroraClusters {
+		add(ResourceTypeAurora, cluster.Identifier, cluster)
+	}
+	for _, zone := range c.HostedZones {
+		add(ResourceTypeHostedZone, zone.Name, zone)
+	}
+	for _, certificate := range c.Certificates {
+		add(ResourceTypeCertificate, certificate.DomainName, certificate)
+	}
+	for _, function := range c.LambdaFunctions {
+		add(ResourceTypeLambda, function.Name, function, function.ZipFile)
+	}
+	for _, vpc := range c.VPCs {
+		add(ResourceTypeVPC, vpc.Name, vpc)
+	}
+	for _, keyPair := range c.KeyPairs {
+		add(ResourceTypeKeyPair, keyPair.Name, keyPair, keyPair.PublicKeyFile)
+	}
+	for _, group := range c.SecurityGroups {
+		add(ResourceTypeSecurityGroup, group.Name, group)
+	}
+	for _, rule := range c.EventBridgeRules {
+		add(ResourceTypeEventBridgeRule, rule.Name, rule)
+	}
+	if c.PasswordPolicy != nil {
+		add(ResourceTypePasswordPolicy, passwordPolicyName, *c.PasswordPolicy)
+	}
+	return hashes
+}
+
+// resourceHash hashes the region, the JSON form of the resource and the contents of the
+// given files. It returns "" when a file cannot be read, so the resource is never skipped
+// and provisioning reports the problem.
+func (c *Config) resourceHash(resource any, files ...string) string {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.New()
+	hash.Write([]byte(c.Region + "\n"))
+	hash.Write(data)
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return ""
+		}
+		hash.Write(contents)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// unchangedOnly drops the resources whose hash equals the applied hash, counting them in skipped
+func unchangedOnly[T any](resources []T, resourceType string, name func(T) string, hashes, applied map[string]string, skipped *int) []T {
+	var kept []T
+	for _, resource := range resources {
+		key := stateKey(resourceType, name(resource))
+		if hash, ok := applied[key]; ok && hash == hashes[key] {
+			logger.Debug("Skipping unchanged resource", "type", resourceType, "name", name(resource))
+			*skipped++
+			continue
+		}
+		kept = append(kept, resource)
+	}
+	return kept
+}
+
+// withoutUnchanged returns a copy of the config without the resources whose hash equals
+// the applied hash, and the number of resources left out. The receiver is not modified.
+func (c *Config) withoutUnchanged(hashes, applied map[string]string) (*Config, int) {
+	skipped := 0
+	changed := *c
+	changed.S3Buckets = unchangedOnly(c.S3Buckets, ResourceTypeS3, func(b S3Bucket) string { return b.Name }, hashes, applied, &skipped)
+	changed.ECRRepositories = unchangedOnly(c.ECRRepositories, ResourceTypeECR, func(r ECRRepository) string { return r.Name }, hashes, applied, &skipped)
+	changed.IAMGroups = unchangedOnly(c.IAMGroups, ResourceTypeIAMGroup, func(g IAMGroup) string { return g.Name }, hashes, applied, &skipped)
+	changed.IAMUsers = unchangedOnly(c.IAMUsers, ResourceTypeIAM, func(u IAMUser) string { return u.Name }, hashes, applied, &skipped)
+	changed.RDSInstances = unchangedOnly(c.RDSInstances, ResourceTypeRDS, func(i RDSInstance) string { return i.Identifier }, hashes, applied, &skipped)
+	changed.AuroraClusters = unchangedOnly(c.AuroraClusters, ResourceTypeAurora, func(a AuroraCluster) string { return a.Identifier }, hashes, applied, &skipped)
+	changed.HostedZones = unchangedOnly(c.HostedZones, ResourceTypeHostedZone, func(z HostedZone) string { return z.Name }, hashes, applied, &skipped)
+	changed.Certificates = unchangedOnly(c.Certificates, ResourceTypeCertificate, func(cert Certificate) string { return cert.DomainName }, hashes, applied, &skipped)
+	changed.LambdaFunctions = unchangedOnly(c.LambdaFunctions, ResourceTypeLambda, func(f LambdaFunction) string { return f.Name }, hashes, applied, &skipped)
+	changed.VPCs = unchangedOnly(c.VPCs, ResourceTypeVPC, func(v VPC) string { return v.Name }, hashes, applied, &skipped)
+	changed.KeyPairs = unchangedOnly(c.KeyPairs, ResourceTypeKeyPair, func(k KeyPair) string { return k.Name }, hashes, applied, &skipped)
+	changed.SecurityGroups = unchangedOnly(c.SecurityGroups, ResourceTypeSecurityGroup, func(g SecurityGroup) string { return g.Name }, hashes, applied, &skipped)
+	changed.EventBridgeRules = unchangedOnly(c.EventBridgeRules, ResourceTypeEventBridgeRule, func(r EventBridgeRule) string { return r.Name }, hashes, applied, &skipped)
+	if c.PasswordPolicy != nil {
+		key := stateKey(ResourceTypePasswordPolicy, passwordPolicyName)
+		if hash, ok := applied[key]; ok && hash == hashes[key] {
+			changed.PasswordPolicy = nil
+			skipped++
+		}
+	}
+	return &changed, skipped
+}
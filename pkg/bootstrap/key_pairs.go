@@ -0,0 +1,133 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// CreateKeyPairs imports or creates the configured EC2 key pairs. Key pairs are found by
+// name, and an existing key pair is never replaced, since its key cannot be read back.
+func (b *Bootstrapper) CreateKeyPairs(ctx context.Context, keyPairs []KeyPair) ([]ResourceResult, error) {
+	var results []ResourceResult
+	for _, keyPair := range keyPairs {
+		// Stop before starting the next resource if the run was cancelled or timed out
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+		res := newResourceResult(ResourceTypeKeyPair, keyPair.Name)
+		err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+			return b.ensureKeyPair(ctx, keyPair, res)
+		})
+		results = append(results, res.finish(err))
+		if err != nil && !b.tolerate(err) {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// ensureKeyPair imports the public key of the key pair, or creates a new key pair and
+// records its private key, unless a key pair with the name exists
+func (b *Bootstrapper) ensureKeyPair(ctx context.Context, keyPair KeyPair, res *ResourceResult) error {
+	logger.Info("Ensuring key pair", "key_pair", keyPair.Name)
+
+	output, err := b.ec2Client.DescribeKeyPairs(ctx, &ec2.DescribeKeyPairsInput{
+		Filters: []ec2types.Filter{{Name: aws.String("key-name"), Values: []string{keyPair.Name}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to look up key pair %s: %w", keyPair.Name, err)
+	}
+	if len(output.KeyPairs) > 0 {
+		keyPairID := aws.ToString(output.KeyPairs[0].KeyPairId)
+		res.ARN = b.keyPairARN(keyPairID)
+		logger.Info("Key pair already exists", "key_pair", keyPair.Name, "key_pair_id", keyPairID)
+		if keyPair.IfNotExists {
+			leaveExisting(res)
+			return nil
+		}
+		if len(keyPair.Tags) > 0 {
+			b.tagEC2Resource(ctx, keyPairID, "key pair "+keyPair.Name, keyPair.Tags, res)
+		}
+		return nil
+	}
+
+	publicKey, err := keyPair.publicKey()
+	if err != nil {
+		return err
+	}
+	tags := ec2TagSpecifications(ec2types.ResourceTypeKeyPair, keyPair.Name, keyPair.Tags)
+	if publicKey != "" {
+		imported, err := b.ec2Client.ImportKeyPair(ctx, &ec2.ImportKeyPairInput{
+			KeyName:           aws.String(keyPair.Name),
+			PublicKeyMaterial: []byte(publicKey),
+			TagSpecifications: tags,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to import key pair %s: %w", keyPair.Name, err)
+		}
+		res.created()
+		res.ARN = b.keyPairARN(aws.ToString(imported.KeyPairId))
+		logger.Info("Imported key pair", "key_pair", keyPair.Name, "fingerprint", aws.ToString(imported.KeyFingerprint))
+		return nil
+	}
+
+	// The private key is only returned when the key pair is created, so there must be
+	// somewhere to save it first
+	if b.credentialsOut == "" {
+		return fmt.Errorf("key pair %s has no public key, so a private key would be generated; use -credentials-out to save it", keyPair.Name)
+	}
+	keyType := ec2types.KeyTypeRsa
+	if keyPair.KeyType != "" {
+		keyType = ec2types.KeyType(keyPair.KeyType)
+	}
+	created, err := b.ec2Client.CreateKeyPair(ctx, &ec2.CreateKeyPairInput{
+		KeyName:           aws.String(keyPair.Name),
+		KeyType:           keyType,
+		KeyFormat:         ec2types.KeyFormatPem,
+		TagSpecifications: tags,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create key pair %s: %w", keyPair.Name, err)
+	}
+	res.created()
+	res.ARN = b.keyPairARN(aws.ToString(created.KeyPairId))
+
+	credential := Credential{Type: ResourceTypeKeyPair, Name: keyPair.Name, PrivateKey: aws.ToString(created.KeyMaterial)}
+	if err := b.recordCredential(credential); err != nil {
+		// A key pair whose private key was lost is useless; delete it so the next run
+		// creates it again
+		if _, deleteErr := b.ec2Client.DeleteKeyPair(ctx, &ec2.DeleteKeyPairInput{KeyName: aws.String(keyPair.Name)}); deleteErr != nil {
+			res.warnf("failed to delete key pair %s after its private key could not be saved: %v", keyPair.Name, deleteErr)
+		}
+		return fmt.Errorf("failed to save private key of key pair %s: %w", keyPair.Name, err)
+	}
+	logger.Info("Created key pair; its private key was written to the credentials file", "key_pair", keyPair.Name)
+	return nil
+}
+
+// publicKey returns the public key to import, read from the public key file if one is
+// set, or "" when a new key pair is created
+func (k KeyPair) publicKey() (string, error) {
+	if k.PublicKeyFile == "" {
+		return strings.TrimSpace(k.PublicKey), nil
+	}
+	data, err := os.ReadFile(k.PublicKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read public key file for key pair %s: %w", k.Name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// keyPairARN returns the ARN of a key pair, or "" when the account is not known
+func (b *Bootstrapper) keyPairARN(keyPairID string) string {
+	if b.account == "" || keyPairID == "" {
+		return ""
+	}
+	return fmt.Sprintf("arn:%s:ec2:%s:%s:key-pair/%s", partitionForRegion(b.awsConfig.Region), b.awsConfig.Region, b.account, keyPairID)
+}
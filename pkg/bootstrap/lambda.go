@@ -0,0 +1,289 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// lambdaWaitTimeout bounds how long to wait for a configuration update of a Lambda function
+// to finish before its code is updated
+const lambdaWaitTimeout = 5 * time.Minute
+
+// ecrImageReference splits an image URI of the form repository[:tag] or
+// repository@digest, which names an ECR repository in the config rather than a full image
+// URI. ok is false for full URIs, which always include a registry host.
+func ecrImageReference(imageURI string) (repository, reference string, ok bool) {
+	if imageURI == "" || strings.Contains(imageURI, "/") {
+		return "", "", false
+	}
+	if name, digest, found := strings.Cut(imageURI, "@"); found {
+		return name, "@" + digest, true
+	}
+	if name, tag, found := strings.Cut(imageURI, ":"); found {
+		return name, ":" + tag, true
+	}
+	return imageURI, ":latest", true
+}
+
+// CreateLambdaFunctions creates Lambda functions based on the configuration
+func (b *Bootstrapper) CreateLambdaFunctions(ctx context.Context, functions []LambdaFunction) ([]ResourceResult, error) {
+	var results []ResourceResult
+	for _, function := range functions {
+		// Stop before starting the next resource if the run was cancelled or timed out
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+
+		res := newResourceResult(ResourceTypeLambda, function.Name)
+		err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+			return b.ensureLambdaFunction(ctx, function, res)
+		})
+		results = append(results, res.finish(err))
+		if err != nil && !b.tolerate(err) {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// ensureLambdaFunction creates a single Lambda function if needed, or reconciles the
+// configuration and code of an existing one
+func (b *Bootstrapper) ensureLambdaFunction(ctx context.Context, function LambdaFunction, res *ResourceResult) error {
+	logger.Info("Ensuring Lambda function", "function", function.Name)
+
+	// Load the code before touching the function so a bad config fails cleanly
+	var zip []byte
+	imageURI := function.ImageURI
+	if function.ZipFile != "" {
+		data, err := os.ReadFile(function.ZipFile)
+		if err != nil {
+			return fmt.Errorf("failed to read zip file for Lambda function %s: %w", function.Name, err)
+		}
+		zip = data
+	} else {
+		resolved, err := b.resolveImageURI(ctx, imageURI)
+		if err != nil {
+			return fmt.Errorf("failed to resolve image for Lambda function %s: %w", function.Name, err)
+		}
+		imageURI = resolved
+	}
+
+	var vpcConfig *lambdatypes.VpcConfig
+	if function.VPCConfig != nil {
+		subnetIDs, err := b.resolveSubnetIDs(ctx, function.VPCConfig.SubnetIDs)
+		if err != nil {
+			return fmt.Errorf("failed to resolve subnets for Lambda function %s: %w", function.Name, err)
+		}
+		vpcConfig = &lambdatypes.VpcConfig{SubnetIds: subnetIDs, SecurityGroupIds: function.VPCConfig.SecurityGroupIDs}
+	}
+
+	current, err := b.lambdaClient.GetFunction(ctx, &lambda.GetFunctionInput{
+		FunctionName: aws.String(function.Name),
+	})
+	if isAPIError[*lambdatypes.ResourceNotFoundException](err) {
+		input := &lambda.CreateFunctionInput{
+			FunctionName: aws.String(function.Name),
+			Role:         aws.String(function.Role),
+			Code:         &lambdatypes.FunctionCode{ZipFile: zip},
+			PackageType:  lambdatypes.PackageTypeZip,
+		}
+		if zip == nil {
+			input.Code = &lambdatypes.FunctionCode{ImageUri: aws.String(imageURI)}
+			input.PackageType = lambdatypes.PackageTypeImage
+		} else {
+			input.Runtime = lambdatypes.Runtime(function.Runtime)
+			input.Handler = aws.String(function.Handler)
+		}
+		if function.Description != "" {
+			input.Description = aws.String(function.Description)
+		}
+		if function.MemorySize != 0 {
+			input.MemorySize = aws.Int32(function.MemorySize)
+		}
+		if function.Timeout != 0 {
+			input.Timeout = aws.Int32(function.Timeout)
+		}
+		if len(function.Environment) > 0 {
+			input.Environment = &lambdatypes.Environment{Variables: function.Environment}
+		}
+		if len(function.Tags) > 0 {
+			input.Tags = function.Tags
+		}
+		input.VpcConfig = vpcConfig
+
+		output, err := b.lambdaClient.CreateFunction(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to create Lambda function %s: %w", function.Name, err)
+		}
+		res.created()
+		res.ARN = aws.ToString(output.FunctionArn)
+		logger.Info("Created Lambda function", "function", function.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get Lambda function %s: %w", function.Name, err)
+	}
+
+	logger.Info("Lambda function already exists", "function", function.Name)
+	configuration := current.Configuration
+	if configuration == nil {
+		configuration = &lambdatypes.FunctionConfiguration{}
+	}
+	res.ARN = aws.ToString(configuration.FunctionArn)
+	if function.IfNotExists {
+		leaveExisting(res)
+		return nil
+	}
+
+	if lambdaConfigurationChanged(function, configuration) || lambdaVPCChanged(vpcConfig, configuration.VpcConfig) {
+		input := &lambda.UpdateFunctionConfigurationInput{
+			FunctionName: aws.String(function.Name),
+			Role:         aws.String(function.Role),
+			Description:  aws.String(function.Description),
+			Environment:  &lambdatypes.Environment{Variables: function.Environment},
+		}
+		if zip != nil {
+			input.Runtime = lambdatypes.Runtime(function.Runtime)
+			input.Handler = aws.String(function.Handler)
+		}
+		if function.MemorySize != 0 {
+			input.MemorySize = aws.Int32(function.MemorySize)
+		}
+		if function.Timeout != 0 {
+			input.Timeout = aws.Int32(function.Timeout)
+		}
+		input.VpcConfig = vpcConfig
+		if _, err := b.lambdaClient.UpdateFunctionConfiguration(ctx, input); err != nil {
+			return fmt.Errorf("failed to update configuration of Lambda function %s: %w", function.Name, err)
+		}
+		res.updated()
+		logger.Info("Updated Lambda function configuration", "function", function.Name)
+
+		// Lambda rejects a code update while the configuration update is in progress
+		task := startProgress("Lambda "+function.Name, "updating")
+		waiter := lambda.NewFunctionUpdatedV2Waiter(b.lambdaClient)
+		err := waiter.Wait(ctx, &lambda.GetFunctionInput{FunctionName: aws.String(function.Name)}, lambdaWaitTimeout, func(o *lambda.FunctionUpdatedV2WaiterOptions) {
+			retryable := o.Retryable
+			o.Retryable = func(ctx context.Context, input *lambda.GetFunctionInput, output *lambda.GetFunctionOutput, err error) (bool, error) {
+				if err == nil && output.Configuration != nil {
+					task.update(string(output.Configuration.LastUpdateStatus))
+				}
+				return retryable(ctx, input, output, err)
+			}
+		})
+		task.done()
+		if err != nil {
+			return fmt.Errorf("failed waiting for Lambda function %s to finish updating: %w", function.Name, err)
+		}
+	}
+
+	// Code is only uploaded when it differs from the deployed package or image
+	codeInput := &lambda.UpdateFunctionCodeInput{FunctionName: aws.String(function.Name)}
+	codeChanged := false
+	if zip != nil {
+		sum := sha256.Sum256(zip)
+		codeChanged = aws.ToString(configuration.CodeSha256) != base64.StdEncoding.EncodeToString(sum[:])
+		codeInput.ZipFile = zip
+	} else {
+		codeChanged = current.Code == nil || aws.ToString(current.Code.ImageUri) != imageURI
+		codeInput.ImageUri = aws.String(imageURI)
+	}
+	if codeChanged {
+		if _, err := b.lambdaClient.UpdateFunctionCode(ctx, codeInput); err != nil {
+			return fmt.Errorf("failed to update code of Lambda function %s: %w", function.Name, err)
+		}
+		res.updated()
+		logger.Info("Updated Lambda function code", "function", function.Name)
+	}
+
+	if len(function.Tags) > 0 && res.ARN != "" {
+		_, err := b.lambdaClient.TagResource(ctx, &lambda.TagResourceInput{
+			Resource: aws.String(res.ARN),
+			Tags:     function.Tags,
+		})
+		if err != nil {
+			res.warnf("failed to set tags for Lambda function %s: %v", function.Name, err)
+		} else {
+			res.updated()
+			logger.Info("Set Lambda function tags", "function", function.Name, "tags", len(function.Tags))
+		}
+	}
+
+	return nil
+}
+
+// resolveImageURI turns a repository[:tag] reference to an ECR repository into the full
+// image URI. Full URIs are returned unchanged.
+func (b *Bootstrapper) resolveImageURI(ctx context.Context, imageURI string) (string, error) {
+	repository, reference, ok := ecrImageReference(imageURI)
+	if !ok {
+		return imageURI, nil
+	}
+
+	output, err := b.ecrClient.DescribeRepositories(ctx, &ecr.DescribeRepositoriesInput{
+		RepositoryNames: []string{repository},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe ECR repository %s: %w", repository, err)
+	}
+	if len(output.Repositories) == 0 {
+		return "", fmt.Errorf("ECR repository %s not found", repository)
+	}
+	return aws.ToString(output.Repositories[0].RepositoryUri) + reference, nil
+}
+
+// lambdaConfigurationChanged reports whether the configured settings of a function differ
+// from its current configuration. Memory and timeout are only compared when configured.
+func lambdaConfigurationChanged(function LambdaFunction, current *lambdatypes.FunctionConfiguration) bool {
+	if aws.ToString(current.Role) != function.Role ||
+		aws.ToString(current.Description) != function.Description {
+		return true
+	}
+	if function.ZipFile != "" &&
+		(string(current.Runtime) != function.Runtime || aws.ToString(current.Handler) != function.Handler) {
+		return true
+	}
+	if function.MemorySize != 0 && aws.ToInt32(current.MemorySize) != function.MemorySize {
+		return true
+	}
+	if function.Timeout != 0 && aws.ToInt32(current.Timeout) != function.Timeout {
+		return true
+	}
+
+	var variables map[string]string
+	if current.Environment != nil {
+		variables = current.Environment.Variables
+	}
+	return !maps.Equal(variables, function.Environment)
+}
+
+// lambdaVPCChanged reports whether the configured subnets or security groups of a function
+// differ from its current VPC configuration. Nothing is compared when no VPC is configured.
+func lambdaVPCChanged(want *lambdatypes.VpcConfig, current *lambdatypes.VpcConfigResponse) bool {
+	if want == nil {
+		return false
+	}
+	if current == nil {
+		return true
+	}
+	sameSet := func(a, b []string) bool {
+		a, b = slices.Clone(a), slices.Clone(b)
+		slices.Sort(a)
+		slices.Sort(b)
+		return slices.Equal(a, b)
+	}
+	return !sameSet(want.SubnetIds, current.SubnetIds) || !sameSet(want.SecurityGroupIds, current.SecurityGroupIds)
+}
@@ -0,0 +1,95 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// logger receives progress messages written while provisioning or destroying resources
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// SetLogger sets the logger used for progress messages
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// NewLogger returns a logger that writes to w at the given level. The format is either
+// "text" or "json".
+func NewLogger(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q: must be text or json", format)
+	}
+}
+
+// redactedFields are the request fields whose values are never logged. Any field with
+// "Password" in its name is redacted as well.
+var redactedFields = map[string]bool{
+	"SecretString": true,
+	"SecretBinary": true,
+	"TokenCode":    true,
+}
+
+// debugRequestLogger logs every AWS request at debug level, with secrets redacted
+var debugRequestLogger = middleware.InitializeMiddlewareFunc("DebugRequestLogger",
+	func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		if logger.Enabled(ctx, slog.LevelDebug) {
+			logger.DebugContext(ctx, "AWS request",
+				"service", awsmiddleware.GetServiceID(ctx),
+				"operation", awsmiddleware.GetOperationName(ctx),
+				"input", redactInput(in.Parameters))
+		}
+		return next.HandleInitialize(ctx, in)
+	})
+
+// addDebugRequestLogger registers debugRequestLogger on an SDK middleware stack
+func addDebugRequestLogger(stack *middleware.Stack) error {
+	return stack.Initialize.Add(debugRequestLogger, middleware.After)
+}
+
+// redactInput converts an SDK input struct into a generic value with secret fields masked
+func redactInput(input any) any {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Sprintf("%T", input)
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Sprintf("%T", input)
+	}
+	return redactValue(value)
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			// Unset pointers and enums only add noise
+			if field == nil || field == "" {
+				delete(v, key)
+			} else if redactedFields[key] || strings.Contains(key, "Password") {
+				v[key] = "REDACTED"
+			} else {
+				v[key] = redactValue(field)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return value
+}
@@ -0,0 +1,179 @@
+package bootstrap
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// MergeConfigs combines several configurations into one by concatenating their resource
+// lists in order. Every config must use the same region (configs without a region inherit
+// it), common tags must not disagree, required tags are combined, a resource name may only
+// appear once per type, and only one password policy may be defined unless the others are
+// identical.
+func MergeConfigs(configs ...*Config) (*Config, error) {
+	merged := &Config{}
+	seen := make(map[string]bool)
+
+	// claim records a resource name, failing if another config already defined it
+	claim := func(resourceType, name string) error {
+		key := resourceType + "/" + name
+		if seen[key] {
+			return fmt.Errorf("duplicate %s %q defined in more than one config", resourceType, name)
+		}
+		seen[key] = true
+		return nil
+	}
+
+	for _, config := range configs {
+		if config.Region != "" {
+			if merged.Region != "" && merged.Region != config.Region {
+				return nil, fmt.Errorf("configs use different regions: %s and %s", merged.Region, config.Region)
+			}
+			merged.Region = config.Region
+		}
+
+		if config.AssumeRoleARN != "" {
+			if merged.AssumeRoleARN != "" && merged.AssumeRoleARN != config.AssumeRoleARN {
+				return nil, fmt.Errorf("configs assume different roles: %s and %s", merged.AssumeRoleARN, config.AssumeRoleARN)
+			}
+			merged.AssumeRoleARN = config.AssumeRoleARN
+			merged.ExternalID = config.ExternalID
+			merged.RoleSessionName = config.RoleSessionName
+			merged.MFASerial = config.MFASerial
+		}
+
+		// Retry settings are tuning knobs, so later configs simply take precedence
+		if config.RetryMaxAttempts != 0 {
+			merged.RetryMaxAttempts = config.RetryMaxAttempts
+		}
+		if config.RetryMode != "" {
+			merged.RetryMode = config.RetryMode
+		}
+
+		for key, role := range config.ResourceRoles {
+			if existing, ok := merged.ResourceRoles[key]; ok && existing != role {
+				return nil, fmt.Errorf("configs set different roles for %s resources", key)
+			}
+			if merged.ResourceRoles == nil {
+				merged.ResourceRoles = make(map[string]ResourceRole)
+			}
+			merged.ResourceRoles[key] = role
+		}
+
+		for key, timeout := range config.Timeouts {
+			if existing, ok := merged.Timeouts[key]; ok && existing != timeout {
+				return nil, fmt.Errorf("configs set different timeouts for %s", key)
+			}
+			if merged.Timeouts == nil {
+				merged.Timeouts = make(map[string]string)
+			}
+			merged.Timeouts[key] = timeout
+		}
+
+		if config.PasswordPolicy != nil {
+			if merged.PasswordPolicy != nil && !reflect.DeepEqual(merged.PasswordPolicy, config.PasswordPolicy) {
+				return nil, fmt.Errorf("configs define different password policies")
+			}
+			merged.PasswordPolicy = config.PasswordPolicy
+		}
+
+		for key, value := range config.Tags {
+			if existing, ok := merged.Tags[key]; ok && existing != value {
+				return nil, fmt.Errorf("common tag %s has conflicting values %q and %q", key, existing, value)
+			}
+			if merged.Tags == nil {
+				merged.Tags = make(map[string]string)
+			}
+			merged.Tags[key] = value
+		}
+
+		// A tag required by any of the configs is required of every resource
+		for _, key := range config.RequiredTags {
+			if !slices.Contains(merged.RequiredTags, key) {
+				merged.RequiredTags = append(merged.RequiredTags, key)
+			}
+		}
+
+		for _, bucket := range config.S3Buckets {
+			if err := claim("S3 bucket", bucket.Name); err != nil {
+				return nil, err
+			}
+			merged.S3Buckets = append(merged.S3Buckets, bucket)
+		}
+		for _, repo := range config.ECRRepositories {
+			if err := claim("ECR repository", repo.Name); err != nil {
+				return nil, err
+			}
+			merged.ECRRepositories = append(merged.ECRRepositories, repo)
+		}
+		for _, group := range config.IAMGroups {
+			if err := claim("IAM group", group.Name); err != nil {
+				return nil, err
+			}
+			merged.IAMGroups = append(merged.IAMGroups, group)
+		}
+		for _, user := range config.IAMUsers {
+			if err := claim("IAM user", user.Name); err != nil {
+				return nil, err
+			}
+			merged.IAMUsers = append(merged.IAMUsers, user)
+		}
+		for _, instance := range config.RDSInstances {
+			if err := claim("RDS instance", instance.Identifier); err != nil {
+				return nil, err
+			}
+			merged.RDSInstances = append(merged.RDSInstances, instance)
+		}
+		for _, cluster := range config.AuroraClusters {
+			if err := claim("Aurora cluster", cluster.Identifier); err != nil {
+				return nil, err
+			}
+			merged.AuroraClusters = append(merged.AuroraClusters, cluster)
+		}
+		for _, zone := range config.HostedZones {
+			if err := claim("hosted zone", zone.Name); err != nil {
+				return nil, err
+			}
+			merged.HostedZones = append(merged.HostedZones, zone)
+		}
+		for _, certificate := range config.Certificates {
+			if err := claim("certificate", certificate.DomainName); err != nil {
+				return nil, err
+			}
+			merged.Certificates = append(merged.Certificates, certificate)
+		}
+		for _, function := range config.LambdaFunctions {
+			if err := claim("Lambda function", function.Name); err != nil {
+				return nil, err
+			}
+			merged.LambdaFunctions = append(merged.LambdaFunctions, function)
+		}
+		for _, vpc := range config.VPCs {
+			if err := claim("VPC", vpc.Name); err != nil {
+				return nil, err
+			}
+			merged.VPCs = append(merged.VPCs, vpc)
+		}
+		for _, keyPair := range config.KeyPairs {
+			if err := claim("key pair", keyPair.Name); err != nil {
+				return nil, err
+			}
+			merged.KeyPairs = append(merged.KeyPairs, keyPair)
+		}
+		for _, group := range config.SecurityGroups {
+			if err := claim("security group", group.Name); err != nil {
+				return nil, err
+			}
+			merged.SecurityGroups = append(merged.SecurityGroups, group)
+		}
+		for _, rule := range config.EventBridgeRules {
+			if err := claim("EventBridge rule", rule.Name); err != nil {
+				return nil, err
+			}
+			merged.EventBridgeRules = append(merged.EventBridgeRules, rule)
+		}
+	}
+
+	return merged, nil
+}
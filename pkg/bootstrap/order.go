@@ -0,0 +1,365 @@
+package bootstrap
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// resourceRef identifies a resource in the config by type and name
+type resourceRef struct {
+	Type string
+	Name string
+}
+
+func (r resourceRef) String() string {
+	return r.Type + ":" + r.Name
+}
+
+// provisionStage is a run of resources of one type that are provisioned by a single call.
+// Config holds only the resources of the stage, in the order they are provisioned.
+type provisionStage struct {
+	Type   string
+	Config *Config
+}
+
+// dependencyGraph records which resources in the config reference other resources in the
+// same config and so must be provisioned after them
+type dependencyGraph struct {
+	// nodes lists every resource in the default provisioning order
+	nodes []resourceRef
+	deps  map[resourceRef][]resourceRef
+	known map[resourceRef]bool
+}
+
+// addNode appends a resource to the default order. A name repeated within a type is a
+// single node; copyResource keeps every copy.
+func (g *dependencyGraph) addNode(ref resourceRef) {
+	if g.known[ref] {
+		return
+	}
+	g.known[ref] = true
+	g.nodes = append(g.nodes, ref)
+}
+
+// addDependency records that from references to. References to resources that are not
+// in the config are assumed to exist already and are ignored.
+func (g *dependencyGraph) addDependency(from, to resourceRef) {
+	if !g.known[to] {
+		return
+	}
+	g.deps[from] = append(g.deps[from], to)
+}
+
+// dependencyGraph builds the graph of references between the resources in the config
+func (c *Config) dependencyGraph() *dependencyGraph {
+	g := &dependencyGraph{
+		deps:  make(map[resourceRef][]resourceRef),
+		known: make(map[resourceRef]bool),
+	}
+
+	// Without references the resources are provisioned type by type in this order
+	for _, bucket := range c.S3Buckets {
+		g.addNode(resourceRef{ResourceTypeS3, bucket.Name})
+	}
+	for _, repo := range c.ECRRepositories {
+		g.addNode(resourceRef{ResourceTypeECR, repo.Name})
+	}
+	for _, group := range c.IAMGroups {
+		g.addNode(resourceRef{ResourceTypeIAMGroup, group.Name})
+	}
+	for _, user := range c.IAMUsers {
+		g.addNode(resourceRef{ResourceTypeIAM, user.Name})
+	}
+	for _, vpc := range c.VPCs {
+		g.addNode(resourceRef{ResourceTypeVPC, vpc.Name})
+	}
+	for _, keyPair := range c.KeyPairs {
+		g.addNode(resourceRef{ResourceTypeKeyPair, keyPair.Name})
+	}
+	for _, group := range c.SecurityGroups {
+		g.addNode(resourceRef{ResourceTypeSecurityGroup, group.Name})
+	}
+	for _, instance := range c.RDSInstances {
+		g.addNode(resourceRef{ResourceTypeRDS, instance.Identifier})
+	}
+	for _, cluster := range c.AuroraClusters {
+		g.addNode(resourceRef{ResourceTypeAurora, cluster.Identifier})
+	}
+	for _, zone := range c.HostedZones {
+		g.addNode(resourceRef{ResourceTypeHostedZone, zone.Name})
+	}
+	for _, certificate := range c.Certificates {
+		g.addNode(resourceRef{ResourceTypeCertificate, certificate.DomainName})
+	}
+	for _, function := range c.LambdaFunctions {
+		g.addNode(resourceRef{ResourceTypeLambda, function.Name})
+	}
+	for _, rule := range c.EventBridgeRules {
+		g.addNode(resourceRef{ResourceTypeEventBridgeRule, rule.Name})
+	}
+
+	// A replication destination must exist before replication to it can be configured
+	for _, bucket := range c.S3Buckets {
+		if bucket.Replication == nil {
+			continue
+		}
+		_, destination, _ := strings.Cut(bucket.Replication.DestinationBucket, ":::")
+		g.addDependency(resourceRef{ResourceTypeS3, bucket.Name}, resourceRef{ResourceTypeS3, destination})
+	}
+	// Users can only be added to groups that exist
+	for _, user := range c.IAMUsers {
+		for _, group := range user.Groups {
+			g.addDependency(resourceRef{ResourceTypeIAM, user.Name}, resourceRef{ResourceTypeIAMGroup, group})
+		}
+	}
+	// An alias to a bucket's website endpoint is only useful once the bucket exists
+	for _, zone := range c.HostedZones {
+		for _, record := range zone.Records {
+			if record.Alias != nil && record.Alias.S3Website != "" {
+				g.addDependency(resourceRef{ResourceTypeHostedZone, zone.Name}, resourceRef{ResourceTypeS3, record.Alias.S3Website})
+			}
+		}
+	}
+	// DNS validation records are written to the zones the certificate's domains belong to
+	for _, certificate := range c.Certificates {
+		if !certificate.validatesByDNS() {
+			continue
+		}
+		for _, domain := range certificate.domains() {
+			if zone := validationZone(c.HostedZones, domain); zone != nil {
+				g.addDependency(resourceRef{ResourceTypeCertificate, certificate.DomainName}, resourceRef{ResourceTypeHostedZone, zone.Name})
+			}
+		}
+	}
+	// An image function needs its repository to resolve the image URI
+	for _, function := range c.LambdaFunctions {
+		if repo, _, ok := ecrImageReference(function.ImageURI); ok {
+			g.addDependency(resourceRef{ResourceTypeLambda, function.Name}, resourceRef{ResourceTypeECR, repo})
+		}
+	}
+	// Subnet references resolve to subnets of a VPC, which must be created first
+	for _, instance := range c.RDSInstances {
+		if instance.SubnetGroup != nil {
+			addSubnetDependencies(g, resourceRef{ResourceTypeRDS, instance.Identifier}, instance.SubnetGroup.SubnetIDs)
+		}
+	}
+	for _, function := range c.LambdaFunctions {
+		if function.VPCConfig != nil {
+			addSubnetDependencies(g, resourceRef{ResourceTypeLambda, function.Name}, function.VPCConfig.SubnetIDs)
+		}
+	}
+	// A security group is created in its VPC, and rules that name other groups need them
+	// to exist. A group may refer to itself without depending on itself.
+	for _, group := range c.SecurityGroups {
+		from := resourceRef{ResourceTypeSecurityGroup, group.Name}
+		g.addDependency(from, resourceRef{ResourceTypeVPC, group.VPC})
+		for _, rule := range append(slices.Clone(group.Ingress), group.Egress...) {
+			for _, ref := range rule.SecurityGroups {
+				if ref != group.Name {
+					g.addDependency(from, resourceRef{ResourceTypeSecurityGroup, ref})
+				}
+			}
+		}
+	}
+	// Rules send events to functions, which must exist before they are given permission
+	for _, rule := range c.EventBridgeRules {
+		for _, target := range rule.Targets {
+			if target.LambdaFunction != "" {
+				g.addDependency(resourceRef{ResourceTypeEventBridgeRule, rule.Name}, resourceRef{ResourceTypeLambda, target.LambdaFunction})
+			}
+		}
+	}
+
+	return g
+}
+
+// addSubnetDependencies records that from references the VPCs of its <vpc>/<subnet> references
+func addSubnetDependencies(g *dependencyGraph, from resourceRef, subnetIDs []string) {
+	for _, subnetID := range subnetIDs {
+		if isSubnetReference(subnetID) {
+			vpcName, _, _ := strings.Cut(subnetID, "/")
+			g.addDependency(from, resourceRef{ResourceTypeVPC, vpcName})
+		}
+	}
+}
+
+// dependents returns, for every resource, the resources in the config that reference it
+func (g *dependencyGraph) dependents() map[resourceRef][]resourceRef {
+	dependents := make(map[resourceRef][]resourceRef)
+	for _, ref := range g.nodes {
+		for _, dep := range g.deps[ref] {
+			dependents[dep] = append(dependents[dep], ref)
+		}
+	}
+	return dependents
+}
+
+// sort orders the resources so that every resource comes after the resources it
+// references. Among the resources that are ready, the one earliest in the default order
+// goes first, so a config without references keeps the default order.
+func (g *dependencyGraph) sort() ([]resourceRef, error) {
+	sorted := make([]resourceRef, 0, len(g.nodes))
+	done := make(map[resourceRef]bool, len(g.nodes))
+
+	ready := func(ref resourceRef) bool {
+		for _, dep := range g.deps[ref] {
+			if !done[dep] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for len(sorted) < len(g.nodes) {
+		progressed := false
+		for _, ref := range g.nodes {
+			if !done[ref] && ready(ref) {
+				done[ref] = true
+				sorted = append(sorted, ref)
+				progressed = true
+				break
+			}
+		}
+		if !progressed {
+			return nil, fmt.Errorf("dependency cycle: %s", g.cycle(done))
+		}
+	}
+	return sorted, nil
+}
+
+// cycle returns the chain of a cycle among the resources that could not be sorted. Each of
+// them references at least one other unsorted resource, so following those references
+// must eventually revisit one.
+func (g *dependencyGraph) cycle(done map[resourceRef]bool) string {
+	var start resourceRef
+	for _, ref := range g.nodes {
+		if !done[ref] {
+			start = ref
+			break
+		}
+	}
+
+	var path []resourceRef
+	seen := make(map[resourceRef]int)
+	for ref := start; ; {
+		if i, ok := seen[ref]; ok {
+			chain := make([]string, 0, len(path)-i+1)
+			for _, r := range path[i:] {
+				chain = append(chain, r.String())
+			}
+			return strings.Join(append(chain, ref.String()), " -> ")
+		}
+		seen[ref] = len(path)
+		path = append(path, ref)
+		for _, dep := range g.deps[ref] {
+			if !done[dep] {
+				ref = dep
+				break
+			}
+		}
+	}
+}
+
+// provisionOrder splits the config into stages in dependency order. Consecutive resources
+// of the same type share a stage, so a config without cross-type references is
+// provisioned with one stage per type.
+func (c *Config) provisionOrder() ([]provisionStage, error) {
+	sorted, err := c.dependencyGraph().sort()
+	if err != nil {
+		return nil, err
+	}
+
+	var stages []provisionStage
+	for _, ref := range sorted {
+		if len(stages) == 0 || stages[len(stages)-1].Type != ref.Type {
+			stages = append(stages, provisionStage{Type: ref.Type, Config: &Config{Region: c.Region}})
+		}
+		c.copyResource(ref, stages[len(stages)-1].Config)
+	}
+	return stages, nil
+}
+
+// copyResource appends the resource identified by ref to the matching list of dst
+func (c *Config) copyResource(ref resourceRef, dst *Config) {
+	switch ref.Type {
+	case ResourceTypeS3:
+		for _, bucket := range c.S3Buckets {
+			if bucket.Name == ref.Name {
+				dst.S3Buckets = append(dst.S3Buckets, bucket)
+			}
+		}
+	case ResourceTypeECR:
+		for _, repo := range c.ECRRepositories {
+			if repo.Name == ref.Name {
+				dst.ECRRepositories = append(dst.ECRRepositories, repo)
+			}
+		}
+	case ResourceTypeIAMGroup:
+		for _, group := range c.IAMGroups {
+			if group.Name == ref.Name {
+				dst.IAMGroups = append(dst.IAMGroups, group)
+			}
+		}
+	case ResourceTypeIAM:
+		for _, user := range c.IAMUsers {
+			if user.Name == ref.Name {
+				dst.IAMUsers = append(dst.IAMUsers, user)
+			}
+		}
+	case ResourceTypeRDS:
+		for _, instance := range c.RDSInstances {
+			if instance.Identifier == ref.Name {
+				dst.RDSInstances = append(dst.RDSInstances, instance)
+			}
+		}
+	case ResourceTypeAurora:
+		for _, cluster := range c.AuroraClusters {
+			if cluster.Identifier == ref.Name {
+				dst.AuroraClusters = append(dst.AuroraClusters, cluster)
+			}
+		}
+	case ResourceTypeHostedZone:
+		for _, zone := range c.HostedZones {
+			if zone.Name == ref.Name {
+				dst.HostedZones = append(dst.HostedZones, zone)
+			}
+		}
+	case ResourceTypeCertificate:
+		for _, certificate := range c.Certificates {
+			if certificate.DomainName == ref.Name {
+				dst.Certificates = append(dst.Certificates, certificate)
+			}
+		}
+	case ResourceTypeLambda:
+		for _, function := range c.LambdaFunctions {
+			if function.Name == ref.Name {
+				dst.LambdaFunctions = append(dst.LambdaFunctions, function)
+			}
+		}
+	case ResourceTypeVPC:
+		for _, vpc := range c.VPCs {
+			if vpc.Name == ref.Name {
+				dst.VPCs = append(dst.VPCs, vpc)
+			}
+		}
+	case ResourceTypeKeyPair:
+		for _, keyPair := range c.KeyPairs {
+			if keyPair.Name == ref.Name {
+				dst.KeyPairs = append(dst.KeyPairs, keyPair)
+			}
+		}
+	case ResourceTypeSecurityGroup:
+		for _, group := range c.SecurityGroups {
+			if group.Name == ref.Name {
+				dst.SecurityGroups = append(dst.SecurityGroups, group)
+			}
+		}
+	case ResourceTypeEventBridgeRule:
+		for _, rule := range c.EventBridgeRules {
+			if rule.Name == ref.Name {
+				dst.EventBridgeRules = append(dst.EventBridgeRules, rule)
+			}
+		}
+	}
+}
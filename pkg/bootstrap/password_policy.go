@@ -0,0 +1,141 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// passwordPolicyName is the name the account password policy is reported under; an
+// account has only one
+const passwordPolicyName = "account"
+
+// defaultMinimumPasswordLength is the minimum length IAM uses when none is given
+const defaultMinimumPasswordLength = 8
+
+// minimumLength returns the configured minimum length, or the IAM default
+func (p PasswordPolicy) minimumLength() int {
+	if p.MinimumLength == 0 {
+		return defaultMinimumPasswordLength
+	}
+	return p.MinimumLength
+}
+
+// ApplyPasswordPolicy sets the account password policy, writing it only when the current
+// policy differs from the configuration
+func (b *Bootstrapper) ApplyPasswordPolicy(ctx context.Context, policy PasswordPolicy) (ResourceResult, error) {
+	res := newResourceResult(ResourceTypePasswordPolicy, passwordPolicyName)
+	err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+		return b.ensurePasswordPolicy(ctx, policy, res)
+	})
+	return res.finish(err), err
+}
+
+func (b *Bootstrapper) ensurePasswordPolicy(ctx context.Context, policy PasswordPolicy, res *ResourceResult) error {
+	logger.Info("Ensuring account password policy")
+
+	current, err := b.currentPasswordPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if current != nil && policy.IfNotExists {
+		leaveExisting(res)
+		return nil
+	}
+	if current != nil {
+		changes := passwordPolicyChanges(current, policy)
+		if len(changes) == 0 {
+			logger.Info("Account password policy is up to date")
+			return nil
+		}
+		logger.Info("Account password policy differs", "changes", changes)
+	}
+
+	input := &iam.UpdateAccountPasswordPolicyInput{
+		MinimumPasswordLength:      aws.Int32(int32(policy.minimumLength())),
+		RequireSymbols:             policy.RequireSymbols,
+		RequireNumbers:             policy.RequireNumbers,
+		RequireUppercaseCharacters: policy.RequireUppercase,
+		RequireLowercaseCharacters: policy.RequireLowercase,
+		AllowUsersToChangePassword: isEnabled(policy.AllowUsersToChangePassword),
+		HardExpiry:                 aws.Bool(policy.HardExpiry),
+	}
+	// IAM rejects zero for these; leaving them out means no expiry and no reuse check
+	if policy.MaxAgeDays > 0 {
+		input.MaxPasswordAge = aws.Int32(int32(policy.MaxAgeDays))
+	}
+	if policy.ReusePrevention > 0 {
+		input.PasswordReusePrevention = aws.Int32(int32(policy.ReusePrevention))
+	}
+	if _, err := b.iamClient.UpdateAccountPasswordPolicy(ctx, input); err != nil {
+		return fmt.Errorf("failed to update account password policy: %w", err)
+	}
+
+	if current == nil {
+		res.created()
+		logger.Info("Created account password policy")
+	} else {
+		res.updated()
+		logger.Info("Updated account password policy")
+	}
+	return nil
+}
+
+// currentPasswordPolicy returns the account password policy, or nil when the account has none
+func (b *Bootstrapper) currentPasswordPolicy(ctx context.Context) (*iamtypes.PasswordPolicy, error) {
+	output, err := b.iamClient.GetAccountPasswordPolicy(ctx, &iam.GetAccountPasswordPolicyInput{})
+	if err != nil {
+		if isAPIError[*iamtypes.NoSuchEntityException](err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get account password policy: %w", err)
+	}
+	return output.PasswordPolicy, nil
+}
+
+// passwordPolicyChanges lists the settings of the current policy that differ from the
+// configuration, as "setting: current -> configured"
+func passwordPolicyChanges(current *iamtypes.PasswordPolicy, policy PasswordPolicy) []string {
+	var changes []string
+	compareInt := func(name string, have *int32, want int) {
+		if got := int(aws.ToInt32(have)); got != want {
+			changes = append(changes, fmt.Sprintf("%s: %d -> %d", name, got, want))
+		}
+	}
+	compareBool := func(name string, have, want bool) {
+		if have != want {
+			changes = append(changes, fmt.Sprintf("%s: %t -> %t", name, have, want))
+		}
+	}
+
+	compareInt("minimum_length", current.MinimumPasswordLength, policy.minimumLength())
+	compareBool("require_symbols", current.RequireSymbols, policy.RequireSymbols)
+	compareBool("require_numbers", current.RequireNumbers, policy.RequireNumbers)
+	compareBool("require_uppercase", current.RequireUppercaseCharacters, policy.RequireUppercase)
+	compareBool("require_lowercase", current.RequireLowercaseCharacters, policy.RequireLowercase)
+	compareBool("allow_users_to_change_password", current.AllowUsersToChangePassword, isEnabled(policy.AllowUsersToChangePassword))
+	compareInt("max_age_days", current.MaxPasswordAge, policy.MaxAgeDays)
+	compareInt("reuse_prevention", current.PasswordReusePrevention, policy.ReusePrevention)
+	compareBool("hard_expiry", aws.ToBool(current.HardExpiry), policy.HardExpiry)
+	return changes
+}
+
+// planPasswordPolicy compares the account password policy with the configuration
+func (b *Bootstrapper) planPasswordPolicy(ctx context.Context, policy PasswordPolicy) (*ResourcePlan, error) {
+	p := newResourcePlan(ResourceTypePasswordPolicy, passwordPolicyName)
+	current, err := b.currentPasswordPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		p.Action = PlanCreate
+		return p, nil
+	}
+	for _, change := range passwordPolicyChanges(current, policy) {
+		p.changef("%s", change)
+	}
+	return p, nil
+}
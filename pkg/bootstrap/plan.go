@@ -0,0 +1,817 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// PlanAction describes what provisioning would do to a resource
+type PlanAction string
+
+const (
+	// PlanCreate means the resource does not exist and would be created
+	PlanCreate PlanAction = "create"
+	// PlanUpdate means the resource exists but differs from the configuration
+	PlanUpdate PlanAction = "update"
+	// PlanNoOp means the resource already matches the configuration
+	PlanNoOp PlanAction = "no-op"
+	// PlanUnverified means the resource is of a type Plan cannot compare with AWS, so
+	// whether it would change is unknown
+	PlanUnverified PlanAction = "unverified"
+)
+
+// ResourcePlan records the planned action for a single resource and the fields that would change
+type ResourcePlan struct {
+	Type    string
+	Name    string
+	Action  PlanAction
+	Changes []string
+}
+
+// Plan is the set of planned actions for every resource in a configuration
+type Plan struct {
+	Resources []ResourcePlan
+}
+
+// Print writes the planned action for each resource, its changes, and a summary line
+func (p *Plan) Print() {
+	p.Fprint(os.Stdout, false)
+}
+
+// Fprint writes the plan to w like Print. With changesOnly, resources that would not
+// change are left out and counted in a line after the summary.
+func (p *Plan) Fprint(w io.Writer, changesOnly bool) {
+	counts := make(map[PlanAction]int)
+	for _, r := range p.Resources {
+		counts[r.Action]++
+		if changesOnly && r.Action == PlanNoOp {
+			continue
+		}
+
+		symbol := "="
+		switch r.Action {
+		case PlanCreate:
+			symbol = "+"
+		case PlanUpdate:
+			symbol = "~"
+		case PlanUnverified:
+			symbol = "?"
+		}
+		fmt.Fprintf(w, "%s %s %s: %s\n", symbol, r.Type, r.Name, r.Action)
+		for _, change := range r.Changes {
+			fmt.Fprintf(w, "    %s\n", change)
+		}
+	}
+
+	// Tally each resource type in the order the types were planned
+	var types []string
+	byType := make(map[string]map[PlanAction]int)
+	for _, r := range p.Resources {
+		if byType[r.Type] == nil {
+			types = append(types, r.Type)
+			byType[r.Type] = make(map[PlanAction]int)
+		}
+		byType[r.Type][r.Action]++
+	}
+	if len(types) > 0 {
+		fmt.Fprintln(w, "\nBy type:")
+		for _, t := range types {
+			c := byType[t]
+			fmt.Fprintf(w, "  %s: %d to create, %d existing (%d to update)",
+				t, c[PlanCreate], c[PlanUpdate]+c[PlanNoOp], c[PlanUpdate])
+			if c[PlanUnverified] > 0 {
+				fmt.Fprintf(w, ", %d not compared", c[PlanUnverified])
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d unchanged.\n",
+		counts[PlanCreate], counts[PlanUpdate], counts[PlanNoOp])
+	if counts[PlanUnverified] > 0 {
+		fmt.Fprintf(w, "%d resource(s) of types that cannot be planned were not compared.\n", counts[PlanUnverified])
+	}
+	if changesOnly && counts[PlanNoOp] > 0 {
+		fmt.Fprintf(w, "%d unchanged resource(s) hidden by -changes-only.\n", counts[PlanNoOp])
+	}
+}
+
+// Drifted returns the resources that are missing or do not match the configuration, and
+// the ones that could not be compared with it
+func (p *Plan) Drifted() []ResourcePlan {
+	var drifted []ResourcePlan
+	for _, r := range p.Resources {
+		if r.Action != PlanNoOp {
+			drifted = append(drifted, r)
+		}
+	}
+	return drifted
+}
+
+// PrintVerify writes PASS or FAIL for each resource, the fields that differ for failures,
+// and a summary line
+func (p *Plan) PrintVerify() {
+	failed := 0
+	for _, r := range p.Resources {
+		switch r.Action {
+		case PlanNoOp:
+			fmt.Printf("PASS %s %s\n", r.Type, r.Name)
+			continue
+		case PlanCreate:
+			fmt.Printf("FAIL %s %s: missing\n", r.Type, r.Name)
+		case PlanUnverified:
+			fmt.Printf("FAIL %s %s: not verifiable\n", r.Type, r.Name)
+		default:
+			fmt.Printf("FAIL %s %s: does not match the configuration\n", r.Type, r.Name)
+		}
+		failed++
+		for _, change := range r.Changes {
+			fmt.Printf("    %s\n", change)
+		}
+	}
+
+	fmt.Printf("\nVerify: %d passed, %d failed.\n", len(p.Resources)-failed, failed)
+}
+
+// newResourcePlan returns a plan for an existing resource; it becomes an update once a change is recorded
+func newResourcePlan(resourceType, name string) *ResourcePlan {
+	return &ResourcePlan{Type: resourceType, Name: name, Action: PlanNoOp}
+}
+
+// changef records a field that would change
+func (p *ResourcePlan) changef(format string, args ...any) {
+	p.Changes = append(p.Changes, fmt.Sprintf(format, args...))
+	if p.Action == PlanNoOp {
+		p.Action = PlanUpdate
+	}
+}
+
+// Plan compares the configuration with the current state in AWS and returns what
+// ProvisionResources would create or update. It makes read-only calls only.
+func (b *Bootstrapper) Plan(ctx context.Context, config *Config) (*Plan, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := b.checkSessionRegion(config); err != nil {
+		return nil, err
+	}
+	config = config.withoutDisabled().withGlobalTags()
+
+	b.warnCrossAccount(config)
+
+	plan := &Plan{}
+	// planAll plans each resource of one type with the role the config sets for the type
+	planAll := func(resourceType string, count int, planOne func(i int) (*ResourcePlan, error)) error {
+		if count == 0 {
+			return nil
+		}
+		return b.withResourceRole(ctx, config, resourceType, func() error {
+			for i := 0; i < count; i++ {
+				p, err := planOne(i)
+				if err != nil {
+					return err
+				}
+				plan.Resources = append(plan.Resources, *p)
+			}
+			return nil
+		})
+	}
+
+	if config.PasswordPolicy != nil {
+		if err := planAll(ResourceTypePasswordPolicy, 1, func(int) (*ResourcePlan, error) {
+			p, err := b.planPasswordPolicy(ctx, *config.PasswordPolicy)
+			return leftAsIs(p, config.PasswordPolicy.IfNotExists), err
+		}); err != nil {
+			return plan, err
+		}
+	}
+	if err := planAll(ResourceTypeS3, len(config.S3Buckets), func(i int) (p *ResourcePlan, err error) {
+		err = b.inRegion(config.S3Buckets[i].Region, func() error {
+			p, err = b.planS3Bucket(ctx, config.S3Buckets[i])
+			p = leftAsIs(p, config.S3Buckets[i].IfNotExists)
+			return err
+		})
+		return p, err
+	}); err != nil {
+		return plan, err
+	}
+	// The repositories of each region are listed once, with the role of the ECR resources
+	repositories := make(map[string]map[string]ecrtypes.Repository)
+	if err := planAll(ResourceTypeECR, len(config.ECRRepositories), func(i int) (p *ResourcePlan, err error) {
+		err = b.inRegion(config.ECRRepositories[i].Region, func() error {
+			inventory, ok := repositories[b.awsConfig.Region]
+			if !ok {
+				if inventory, err = b.ecrInventory(ctx); err != nil {
+					return err
+				}
+				repositories[b.awsConfig.Region] = inventory
+			}
+			p, err = b.planECRRepository(ctx, config.ECRRepositories[i], inventory)
+			p = leftAsIs(p, config.ECRRepositories[i].IfNotExists)
+			return err
+		})
+		return p, err
+	}); err != nil {
+		return plan, err
+	}
+	if err := planAll(ResourceTypeIAMGroup, len(config.IAMGroups), func(i int) (*ResourcePlan, error) {
+		p, err := b.planIAMGroup(ctx, config.IAMGroups[i])
+		return leftAsIs(p, config.IAMGroups[i].IfNotExists), err
+	}); err != nil {
+		return plan, err
+	}
+	if err := planAll(ResourceTypeIAM, len(config.IAMUsers), func(i int) (*ResourcePlan, error) {
+		p, err := b.planIAMUser(ctx, config.IAMUsers[i])
+		return leftAsIs(p, config.IAMUsers[i].IfNotExists), err
+	}); err != nil {
+		return plan, err
+	}
+	if err := planAll(ResourceTypeRDS, len(config.RDSInstances), func(i int) (*ResourcePlan, error) {
+		p, err := b.planRDSInstance(ctx, config.RDSInstances[i])
+		return leftAsIs(p, config.RDSInstances[i].IfNotExists), err
+	}); err != nil {
+		return plan, err
+	}
+
+	plan.Resources = append(plan.Resources, unverifiedPlans(config)...)
+	return plan, nil
+}
+
+// unverifiedPlans lists the resources of the types Plan does not compare with AWS, so
+// -verify fails for them rather than passing without a check
+func unverifiedPlans(config *Config) []ResourcePlan {
+	var plans []ResourcePlan
+	add := func(resourceType, name string) {
+		plans = append(plans, ResourcePlan{
+			Type:    resourceType,
+			Name:    name,
+			Action:  PlanUnverified,
+			Changes: []string{"resources of this type are not compared with AWS; check them by hand"},
+		})
+	}
+	for _, bucket := range config.S3Buckets {
+		for _, accessPoint := range bucket.AccessPoints {
+			add(ResourceTypeS3, bucket.Name+" access point "+accessPoint.Name)
+		}
+	}
+	for _, cluster := range config.AuroraClusters {
+		add(ResourceTypeAurora, cluster.Identifier)
+	}
+	for _, zone := range config.HostedZones {
+		add(ResourceTypeHostedZone, zone.Name)
+	}
+	for _, certificate := range config.Certificates {
+		add(ResourceTypeCertificate, certificate.DomainName)
+	}
+	for _, function := range config.LambdaFunctions {
+		add(ResourceTypeLambda, function.Name)
+	}
+	for _, vpc := range config.VPCs {
+		add(ResourceTypeVPC, vpc.Name)
+	}
+	for _, keyPair := range config.KeyPairs {
+		add(ResourceTypeKeyPair, keyPair.Name)
+	}
+	for _, group := range config.SecurityGroups {
+		add(ResourceTypeSecurityGroup, group.Name)
+	}
+	for _, rule := range config.EventBridgeRules {
+		add(ResourceTypeEventBridgeRule, rule.Name)
+	}
+	return plans
+}
+
+// planS3Bucket compares a bucket's region, ownership, versioning, encryption, tags and policy with the configuration
+func (b *Bootstrapper) planS3Bucket(ctx context.Context, bucket S3Bucket) (*ResourcePlan, error) {
+	p := newResourcePlan(ResourceTypeS3, bucket.Name)
+
+	ownership, err := b.checkBucketOwnership(ctx, bucket.Name)
+	if err != nil {
+		return nil, err
+	}
+	switch ownership {
+	case bucketMissing:
+		p.Action = PlanCreate
+		return p, nil
+	case bucketForeign:
+		p.changef("name: owned by another AWS account (provisioning will fail)")
+		return p, nil
+	}
+
+	bucketRegion, err := b.bucketRegion(ctx, bucket.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get location of bucket %s: %w", bucket.Name, err)
+	}
+	if bucketRegion != b.awsConfig.Region {
+		p.changef("region: %s -> %s (bucket cannot be moved; provisioning will fail)", bucketRegion, b.awsConfig.Region)
+		return p, nil
+	}
+
+	if bucket.ObjectOwnership != "" {
+		current, err := b.bucketObjectOwnership(ctx, bucket.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ownership controls of bucket %s: %w", bucket.Name, err)
+		}
+		if current != bucket.ObjectOwnership {
+			p.changef("object_ownership: %s -> %s", describeValue(current), bucket.ObjectOwnership)
+		}
+	}
+
+	if bucket.Versioning != "" {
+		versioning, err := b.s3Client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+			Bucket: aws.String(bucket.Name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get versioning of bucket %s: %w", bucket.Name, err)
+		}
+		if !versioningSatisfied(versioning.Status, versioningStatus(bucket.Versioning)) {
+			p.changef("versioning: %s -> %s", describeVersioning(versioning.Status), bucket.Versioning)
+		}
+	}
+
+	if bucket.TransferAcceleration != nil {
+		accelerate, err := b.s3Client.GetBucketAccelerateConfiguration(ctx, &s3.GetBucketAccelerateConfigurationInput{
+			Bucket: aws.String(bucket.Name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get transfer acceleration of bucket %s: %w", bucket.Name, err)
+		}
+		desired := accelerateStatus(*bucket.TransferAcceleration)
+		if !accelerateSatisfied(accelerate.Status, desired) {
+			p.changef("transfer_acceleration: %s -> %s", describeValue(string(accelerate.Status)), desired)
+		}
+	}
+
+	if bucket.RequestPayer != "" {
+		payment, err := b.s3Client.GetBucketRequestPayment(ctx, &s3.GetBucketRequestPaymentInput{
+			Bucket: aws.String(bucket.Name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get request payment of bucket %s: %w", bucket.Name, err)
+		}
+		if string(payment.Payer) != bucket.RequestPayer {
+			p.changef("request_payer: %s -> %s", describeValue(string(payment.Payer)), bucket.RequestPayer)
+		}
+	}
+
+	if bucket.Encryption != "" {
+		want, err := buildEncryptionRule(bucket)
+		if err != nil {
+			return nil, err
+		}
+
+		var currentAlgorithm, currentKey string
+		encryption, err := b.s3Client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{
+			Bucket: aws.String(bucket.Name),
+		})
+		if err == nil && encryption.ServerSideEncryptionConfiguration != nil {
+			for _, rule := range encryption.ServerSideEncryptionConfiguration.Rules {
+				if rule.ApplyServerSideEncryptionByDefault != nil {
+					currentAlgorithm = string(rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm)
+					currentKey = aws.ToString(rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID)
+				}
+			}
+		}
+
+		wantAlgorithm := string(want.ApplyServerSideEncryptionByDefault.SSEAlgorithm)
+		wantKey := aws.ToString(want.ApplyServerSideEncryptionByDefault.KMSMasterKeyID)
+		if currentAlgorithm != wantAlgorithm {
+			p.changef("encryption: %s -> %s", describeValue(currentAlgorithm), wantAlgorithm)
+		} else if currentKey != wantKey {
+			p.changef("kms_key_id: %s -> %s", describeValue(currentKey), wantKey)
+		}
+	}
+
+	if len(bucket.Tags) > 0 || b.pruneTags {
+		current := make(map[string]string)
+		tagging, err := b.s3Client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{
+			Bucket: aws.String(bucket.Name),
+		})
+		// Buckets without tags return NoSuchTagSet, which is the same as an empty tag set
+		if err == nil {
+			for _, tag := range tagging.TagSet {
+				current[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+		}
+		// PutBucketTagging replaces the whole tag set, so extra tags go whenever tags are configured
+		planTags(p, current, bucket.Tags, b.pruneTags || len(bucket.Tags) > 0)
+	}
+
+	policy, err := loadPolicy(bucket.Policy, bucket.PolicyFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy for bucket %s: %w", bucket.Name, err)
+	}
+	if policy != "" {
+		var current string
+		policyOutput, err := b.s3Client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{
+			Bucket: aws.String(bucket.Name),
+		})
+		if err == nil {
+			current = aws.ToString(policyOutput.Policy)
+		}
+		planDocument(p, "policy", current, policy)
+	}
+
+	return p, nil
+}
+
+// planECRRepository compares a repository's encryption, tags and policies with the
+// configuration. inventory holds the existing repositories by name.
+func (b *Bootstrapper) planECRRepository(ctx context.Context, repo ECRRepository, inventory map[string]ecrtypes.Repository) (*ResourcePlan, error) {
+	p := newResourcePlan(ResourceTypeECR, repo.Name)
+
+	existing, ok := inventory[repo.Name]
+	if !ok {
+		p.Action = PlanCreate
+		return p, nil
+	}
+
+	encryption, err := buildECREncryption(repo.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption for ECR repository %s: %w", repo.Name, err)
+	}
+	if encryption != nil {
+		current := "AES256"
+		if existing.EncryptionConfiguration != nil {
+			current = string(existing.EncryptionConfiguration.EncryptionType)
+		}
+		if current != string(encryption.EncryptionType) {
+			p.Changes = append(p.Changes, fmt.Sprintf("encryption: %s -> %s (cannot be changed; requires re-creation)",
+				current, encryption.EncryptionType))
+		}
+	}
+
+	if repo.ImageTagMutability != "" && repo.ImageTagMutability != string(existing.ImageTagMutability) {
+		p.changef("image_tag_mutability: %s -> %s", existing.ImageTagMutability, repo.ImageTagMutability)
+	}
+	if repo.ScanOnPush != nil {
+		current := existing.ImageScanningConfiguration != nil && existing.ImageScanningConfiguration.ScanOnPush
+		if current != *repo.ScanOnPush {
+			p.changef("scan_on_push: %t -> %t", current, *repo.ScanOnPush)
+		}
+	}
+
+	if len(repo.Tags) > 0 || b.pruneTags {
+		current := make(map[string]string)
+		tagsOutput, err := b.ecrClient.ListTagsForResource(ctx, &ecr.ListTagsForResourceInput{
+			ResourceArn: existing.RepositoryArn,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of ECR repository %s: %w", repo.Name, err)
+		}
+		for _, tag := range tagsOutput.Tags {
+			current[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+		planTags(p, current, repo.Tags, b.pruneTags)
+	}
+
+	lifecyclePolicy, err := loadECRLifecyclePolicy(repo)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lifecycle policy for ECR repository %s: %w", repo.Name, err)
+	}
+	if lifecyclePolicy != "" {
+		var current string
+		lifecycleOutput, err := b.ecrClient.GetLifecyclePolicy(ctx, &ecr.GetLifecyclePolicyInput{
+			RepositoryName: aws.String(repo.Name),
+		})
+		if err == nil {
+			current = aws.ToString(lifecycleOutput.LifecyclePolicyText)
+		}
+		planDocument(p, "lifecycle_policy", current, lifecyclePolicy)
+	}
+
+	repositoryPolicy, err := buildECRRepositoryPolicy(repo)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository policy for ECR repository %s: %w", repo.Name, err)
+	}
+	if repositoryPolicy != "" {
+		var current string
+		policyOutput, err := b.ecrClient.GetRepositoryPolicy(ctx, &ecr.GetRepositoryPolicyInput{
+			RepositoryName: aws.String(repo.Name),
+		})
+		if err == nil {
+			current = aws.ToString(policyOutput.PolicyText)
+		}
+		planDocument(p, "repository_policy", current, repositoryPolicy)
+	}
+
+	return p, nil
+}
+
+// planIAMGroup checks that a group exists and has its managed policies attached
+func (b *Bootstrapper) planIAMGroup(ctx context.Context, group IAMGroup) (*ResourcePlan, error) {
+	p := newResourcePlan(ResourceTypeIAMGroup, group.Name)
+
+	_, err := b.iamClient.GetGroup(ctx, &iam.GetGroupInput{
+		GroupName: aws.String(group.Name),
+	})
+	if err != nil {
+		if !isAPIError[*iamtypes.NoSuchEntityException](err) {
+			return nil, fmt.Errorf("failed to get IAM group %s: %w", group.Name, err)
+		}
+		p.Action = PlanCreate
+		return p, nil
+	}
+
+	attached, err := b.iamClient.ListAttachedGroupPolicies(ctx, &iam.ListAttachedGroupPoliciesInput{
+		GroupName: aws.String(group.Name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policies attached to IAM group %s: %w", group.Name, err)
+	}
+	attachedArns := make(map[string]bool)
+	attachedNames := make(map[string]bool)
+	for _, policy := range attached.AttachedPolicies {
+		attachedArns[aws.ToString(policy.PolicyArn)] = true
+		attachedNames[aws.ToString(policy.PolicyName)] = true
+	}
+	planAttachedPolicies(p, group.Name, group.Policies, attachedArns, attachedNames)
+
+	return p, nil
+}
+
+// planIAMUser compares a user's tags, permissions boundary, managed and inline policies and
+// group memberships with the configuration
+func (b *Bootstrapper) planIAMUser(ctx context.Context, user IAMUser) (*ResourcePlan, error) {
+	p := newResourcePlan(ResourceTypeIAM, user.Name)
+
+	getUserOutput, err := b.iamClient.GetUser(ctx, &iam.GetUserInput{
+		UserName: aws.String(user.Name),
+	})
+	if err != nil {
+		if !isAPIError[*iamtypes.NoSuchEntityException](err) {
+			return nil, fmt.Errorf("failed to get IAM user %s: %w", user.Name, err)
+		}
+		p.Action = PlanCreate
+		return p, nil
+	}
+
+	var currentBoundary string
+	current := make(map[string]string)
+	if getUserOutput.User != nil {
+		if getUserOutput.User.PermissionsBoundary != nil {
+			currentBoundary = aws.ToString(getUserOutput.User.PermissionsBoundary.PermissionsBoundaryArn)
+		}
+		for _, tag := range getUserOutput.User.Tags {
+			current[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	}
+	planTags(p, current, user.Tags, b.pruneTags)
+	if currentBoundary != user.PermissionBoundary {
+		p.changef("permission_boundary: %s -> %s", describeValue(currentBoundary), describeValue(user.PermissionBoundary))
+	}
+
+	profile, err := b.iamClient.GetLoginProfile(ctx, &iam.GetLoginProfileInput{
+		UserName: aws.String(user.Name),
+	})
+	if err != nil && !isAPIError[*iamtypes.NoSuchEntityException](err) {
+		return nil, fmt.Errorf("failed to get login profile for IAM user %s: %w", user.Name, err)
+	}
+	switch hasProfile := err == nil && profile.LoginProfile != nil; {
+	case user.ConsoleAccess == nil && hasProfile:
+		p.changef("console_access: remove")
+	case user.ConsoleAccess != nil && !hasProfile:
+		p.changef("console_access: add")
+	case user.ConsoleAccess != nil && profile.LoginProfile.PasswordResetRequired != user.ConsoleAccess.PasswordResetRequired:
+		p.changef("console_access.password_reset_required: %t -> %t", profile.LoginProfile.PasswordResetRequired, user.ConsoleAccess.PasswordResetRequired)
+	}
+
+	attached, err := b.iamClient.ListAttachedUserPolicies(ctx, &iam.ListAttachedUserPoliciesInput{
+		UserName: aws.String(user.Name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policies attached to IAM user %s: %w", user.Name, err)
+	}
+	attachedArns := make(map[string]bool)
+	attachedNames := make(map[string]bool)
+	for _, policy := range attached.AttachedPolicies {
+		attachedArns[aws.ToString(policy.PolicyArn)] = true
+		attachedNames[aws.ToString(policy.PolicyName)] = true
+	}
+	planAttachedPolicies(p, user.Name, user.Policies, attachedArns, attachedNames)
+
+	inline, err := b.iamClient.ListUserPolicies(ctx, &iam.ListUserPoliciesInput{
+		UserName: aws.String(user.Name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inline policies for IAM user %s: %w", user.Name, err)
+	}
+	currentInline := make(map[string]bool)
+	for _, name := range inline.PolicyNames {
+		currentInline[name] = true
+	}
+	wantInline := make(map[string]bool)
+	for _, policy := range user.InlinePolicies {
+		wantInline[policy.Name] = true
+		if !currentInline[policy.Name] {
+			p.changef("inline policy %s: add", policy.Name)
+		}
+	}
+	for _, name := range inline.PolicyNames {
+		if !wantInline[name] {
+			p.changef("inline policy %s: remove", name)
+		}
+	}
+
+	if user.Groups != nil {
+		groups, err := b.iamClient.ListGroupsForUser(ctx, &iam.ListGroupsForUserInput{
+			UserName: aws.String(user.Name),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list groups for IAM user %s: %w", user.Name, err)
+		}
+		currentGroups := make(map[string]bool)
+		for _, group := range groups.Groups {
+			currentGroups[aws.ToString(group.GroupName)] = true
+		}
+		wantGroups := make(map[string]bool)
+		for _, name := range user.Groups {
+			wantGroups[name] = true
+			if !currentGroups[name] {
+				p.changef("group %s: add", name)
+			}
+		}
+		for _, group := range groups.Groups {
+			if name := aws.ToString(group.GroupName); !wantGroups[name] {
+				p.changef("group %s: remove", name)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// leftAsIs drops the changes from the plan of an existing resource that sets if_not_exists,
+// since provisioning leaves such a resource as it is
+func leftAsIs(p *ResourcePlan, ifNotExists bool) *ResourcePlan {
+	if ifNotExists && p != nil && p.Action != PlanCreate {
+		p.Action = PlanNoOp
+		p.Changes = nil
+	}
+	return p
+}
+
+// PlanRDSInstances compares the enabled RDS instances of the configuration with the existing
+// ones, so that a dry run can show the changes, some of which cause downtime, before they are
+// applied. It makes read-only calls only.
+func (b *Bootstrapper) PlanRDSInstances(ctx context.Context, config *Config) ([]ResourcePlan, error) {
+	config = config.withoutDisabled().withGlobalTags()
+	if len(config.RDSInstances) == 0 {
+		return nil, nil
+	}
+
+	var plans []ResourcePlan
+	err := b.withResourceRole(ctx, config, ResourceTypeRDS, func() error {
+		for _, instance := range config.RDSInstances {
+			p, err := b.planRDSInstance(ctx, instance)
+			if err != nil {
+				return err
+			}
+			plans = append(plans, *leftAsIs(p, instance.IfNotExists))
+		}
+		return nil
+	})
+	return plans, err
+}
+
+// planRDSInstance compares an instance's storage, class, engine version, Multi-AZ, backup
+// retention, deletion protection and tags with the configuration
+func (b *Bootstrapper) planRDSInstance(ctx context.Context, instance RDSInstance) (*ResourcePlan, error) {
+	p := newResourcePlan(ResourceTypeRDS, instance.Identifier)
+
+	describeOutput, err := b.rdsClient.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: aws.String(instance.Identifier),
+	})
+	if err != nil {
+		if !isAPIError[*rdstypes.DBInstanceNotFoundFault](err) {
+			return nil, fmt.Errorf("error checking RDS instance %s: %w", instance.Identifier, err)
+		}
+		p.Action = PlanCreate
+		return p, nil
+	}
+	if len(describeOutput.DBInstances) == 0 {
+		p.Action = PlanCreate
+		return p, nil
+	}
+	existing := describeOutput.DBInstances[0]
+
+	if current := aws.ToInt32(existing.AllocatedStorage); current != int32(instance.AllocatedStorage) {
+		p.changef("allocated_storage: %d GB -> %d GB", current, instance.AllocatedStorage)
+	}
+	if current := aws.ToString(existing.DBInstanceClass); current != "" && current != instance.InstanceClass {
+		p.changef("instance_class: %s -> %s (causes a brief downtime)", current, instance.InstanceClass)
+	}
+	if current := aws.ToString(existing.EngineVersion); instance.EngineVersion != "" && current != "" && current != instance.EngineVersion {
+		p.Changes = append(p.Changes, fmt.Sprintf("engine_version: %s -> %s (not applied by this tool)", current, instance.EngineVersion))
+	}
+	if current := aws.ToBool(existing.MultiAZ); current != instance.MultiAZ {
+		p.Changes = append(p.Changes, fmt.Sprintf("multi_az: %t -> %t (not applied by this tool)", current, instance.MultiAZ))
+	}
+	// Instances created without backup_retention_period keep the RDS default
+	if current := aws.ToInt32(existing.BackupRetentionPeriod); instance.BackupRetentionPeriod > 0 && current != int32(instance.BackupRetentionPeriod) {
+		p.Changes = append(p.Changes, fmt.Sprintf("backup_retention_period: %d day(s) -> %d day(s) (not applied by this tool)",
+			current, instance.BackupRetentionPeriod))
+	}
+	if current := aws.ToBool(existing.DeletionProtection); current != instance.DeletionProtection {
+		p.changef("deletion_protection: %t -> %t", current, instance.DeletionProtection)
+	}
+	status := aws.ToString(existing.DBInstanceStatus)
+	stopped := status == rdsStatusStopped || status == rdsStatusStopping
+	if (instance.DesiredState == rdsStateStopped && !stopped) || (instance.DesiredState == rdsStateRunning && stopped) {
+		p.changef("state: %s -> %s", status, instance.DesiredState)
+	}
+
+	current := make(map[string]string)
+	for _, tag := range existing.TagList {
+		current[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	planTags(p, current, instance.Tags, b.pruneTags)
+
+	return p, nil
+}
+
+// planAttachedPolicies records managed policies that are not yet attached to a user or group
+func planAttachedPolicies(p *ResourcePlan, ownerName string, policies []IAMPolicy, attachedArns, attachedNames map[string]bool) {
+	for _, policy := range policies {
+		if policy.PolicyArn != "" {
+			if !attachedArns[policy.PolicyArn] {
+				p.changef("policy %s: attach", policy.PolicyArn)
+			}
+			continue
+		}
+		if name := iamPolicyName(ownerName, policy.Name); !attachedNames[name] {
+			p.changef("policy %s: create and attach", name)
+		}
+	}
+}
+
+// planTags records tags that would be added or changed, and, when prune is set, tags that
+// would be removed because they are missing from the configuration
+func planTags(p *ResourcePlan, current, want map[string]string, prune bool) {
+	for _, key := range sortedKeys(want) {
+		value, ok := current[key]
+		switch {
+		case !ok:
+			p.changef("tag %s: (none) -> %q", key, want[key])
+		case value != want[key]:
+			p.changef("tag %s: %q -> %q", key, value, want[key])
+		}
+	}
+	if prune {
+		for _, key := range staleTagKeys(current, want) {
+			p.changef("tag %s: %q -> (removed)", key, current[key])
+		}
+	}
+}
+
+// planDocument records a JSON document that would be written because it differs from the
+// current one. Documents are compared structurally, so formatting differences are ignored.
+func planDocument(p *ResourcePlan, field, current, want string) {
+	if current == "" {
+		p.changef("%s: (none) -> set", field)
+		return
+	}
+	if !jsonEqual(current, want) {
+		p.changef("%s: changed", field)
+	}
+}
+
+// jsonEqual reports whether two JSON documents are structurally equal
+func jsonEqual(a, b string) bool {
+	var x, y any
+	if json.Unmarshal([]byte(a), &x) != nil || json.Unmarshal([]byte(b), &y) != nil {
+		return a == b
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// describeVersioning formats a bucket versioning status for display
+func describeVersioning(status types.BucketVersioningStatus) string {
+	if status == "" {
+		return "disabled"
+	}
+	return strings.ToLower(string(status))
+}
+
+// describeValue formats an optional value for display
+func describeValue(value string) string {
+	if value == "" {
+		return "(none)"
+	}
+	return value
+}
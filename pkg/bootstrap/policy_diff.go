@@ -0,0 +1,153 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// policyDiffContext is the number of unchanged lines shown around each change
+const policyDiffContext = 3
+
+// SetPolicyDiff makes provisioning write a unified diff to w whenever a managed IAM policy
+// document is about to change. A nil writer, the default, turns the diffs off.
+func (b *Bootstrapper) SetPolicyDiff(w io.Writer) {
+	b.policyDiff = w
+}
+
+// decodePolicyDocument undoes the URL encoding IAM applies to the policy documents it returns
+func decodePolicyDocument(document string) string {
+	decoded, err := url.PathUnescape(document)
+	if err != nil {
+		return document
+	}
+	return decoded
+}
+
+// canonicalPolicyLines formats a policy document as indented JSON with sorted keys, so that
+// documents that differ only in layout produce the same lines
+func canonicalPolicyLines(document string) []string {
+	var parsed any
+	if err := json.Unmarshal([]byte(document), &parsed); err != nil {
+		return strings.Split(document, "\n")
+	}
+	formatted, err := json.MarshalIndent(parsed, "", "  ")
+	if err != nil {
+		return strings.Split(document, "\n")
+	}
+	return strings.Split(string(formatted), "\n")
+}
+
+// writePolicyDiff writes a unified diff between the current and configured documents of a policy
+func writePolicyDiff(w io.Writer, policyName, current, want string) error {
+	diff := unifiedDiff(canonicalPolicyLines(current), canonicalPolicyLines(want), policyDiffContext)
+	_, err := fmt.Fprintf(w, "--- %s (current)\n+++ %s (configured)\n%s", policyName, policyName, strings.Join(diff, ""))
+	return err
+}
+
+// diffOp is one line of a line-by-line comparison: ' ' for a line in both, '-' for a line
+// only in the old text and '+' for a line only in the new text
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines compares two texts line by line using their longest common subsequence
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// unifiedDiff returns the hunks of a unified diff between a and b, each line ending in a
+// newline, with context unchanged lines around every change. Identical texts have no hunks.
+func unifiedDiff(a, b []string, context int) []string {
+	ops := diffLines(a, b)
+
+	var out []string
+	for start := 0; start < len(ops); {
+		// Find the next change
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+
+		// Extend the hunk while no more than two contexts of unchanged lines separate the
+		// next change from the last one, so that hunks never overlap or touch
+		last := first
+		for k := first + 1; k < len(ops) && k-last-1 <= 2*context; k++ {
+			if ops[k].kind != ' ' {
+				last = k
+			}
+		}
+		from := max(first-context, start)
+		to := min(last+context+1, len(ops))
+
+		// Line numbers are 1-based positions in a and b of the hunk's first line
+		oldLine, newLine := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+
+		out = append(out, fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount))
+		for _, op := range ops[from:to] {
+			out = append(out, string(op.kind)+op.line+"\n")
+		}
+		start = to
+	}
+	return out
+}
@@ -0,0 +1,260 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// policyKind is the kind of policy a document is, which decides the elements its
+// statements need
+type policyKind int
+
+const (
+	// identityPolicy is attached to an IAM user or group: statements need a Resource and
+	// must not name a Principal
+	identityPolicy policyKind = iota
+	// bucketPolicy is attached to an S3 bucket: statements need a Principal and a Resource
+	bucketPolicy
+	// repositoryPolicy is attached to an ECR repository: statements need a Principal and
+	// apply to the repository itself, so a Resource is optional
+	repositoryPolicy
+)
+
+// policyVersions are the policy language versions IAM accepts
+var policyVersions = map[string]bool{"2012-10-17": true, "2008-10-17": true}
+
+// statementElements are the elements a policy statement may contain
+var statementElements = map[string]bool{
+	"Sid": true, "Effect": true, "Principal": true, "NotPrincipal": true, "Action": true,
+	"NotAction": true, "Resource": true, "NotResource": true, "Condition": true,
+}
+
+// LintPolicies checks the structure of every policy document in the config, reading
+// policy files, against the policy grammar: a Version, a Statement list and, in each
+// statement, an Effect and an Action, plus a Resource or Principal where the kind of
+// policy needs one. All problems are returned together, each naming its resource.
+func (c *Config) LintPolicies() error {
+	v := &validator{}
+
+	for _, bucket := range c.S3Buckets {
+		field := "policy"
+		if bucket.PolicyFile != "" {
+			field = "policy_file " + bucket.PolicyFile
+		}
+		policy, err := loadPolicy(bucket.Policy, bucket.PolicyFile)
+		if err != nil {
+			v.addf("S3 bucket "+bucket.Name, "%s: %v", field, err)
+			continue
+		}
+		v.lintPolicy("S3 bucket "+bucket.Name, field, policy, bucketPolicy)
+	}
+	for _, repo := range c.ECRRepositories {
+		v.lintPolicy("ECR repository "+repo.Name, "repository_policy", repo.RepositoryPolicy, repositoryPolicy)
+	}
+	for _, group := range c.IAMGroups {
+		for _, policy := range group.Policies {
+			v.lintPolicy("IAM group "+group.Name, "policy "+policy.Name, policy.PolicyDocument, identityPolicy)
+		}
+	}
+	for _, user := range c.IAMUsers {
+		for _, policy := range user.Policies {
+			v.lintPolicy("IAM user "+user.Name, "policy "+policy.Name, policy.PolicyDocument, identityPolicy)
+		}
+		for _, policy := range user.InlinePolicies {
+			v.lintPolicy("IAM user "+user.Name, "inline policy "+policy.Name, policy.PolicyDocument, identityPolicy)
+		}
+	}
+
+	return errors.Join(v.errs...)
+}
+
+// lintPolicy records every structural problem of a policy document; empty documents are
+// not set and are skipped
+func (v *validator) lintPolicy(resource, field, document string, kind policyKind) {
+	if document == "" {
+		return
+	}
+	for _, err := range checkPolicyDocument(document, kind) {
+		v.addf(resource, "%s: %v", field, err)
+	}
+}
+
+// checkPolicyDocument parses a policy document and returns its structural problems.
+// Syntax errors report the line and column and stop the check.
+func checkPolicyDocument(document string, kind policyKind) []error {
+	var policy map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return []error{jsonPositionError(document, err)}
+	}
+
+	var problems []error
+	addf := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+	for _, key := range slices.Sorted(maps.Keys(policy)) {
+		if key != "Version" && key != "Id" && key != "Statement" {
+			addf("unknown element %s", key)
+		}
+	}
+
+	var version string
+	if raw, ok := policy["Version"]; !ok {
+		addf("Version is required")
+	} else if json.Unmarshal(raw, &version) != nil || !policyVersions[version] {
+		addf("Version must be 2012-10-17 or 2008-10-17, got %s", raw)
+	}
+
+	raw, ok := policy["Statement"]
+	if !ok {
+		addf("Statement is required")
+		return problems
+	}
+	// A single statement may be given as an object instead of a list
+	var statements []map[string]json.RawMessage
+	if json.Unmarshal(raw, &statements) != nil {
+		var statement map[string]json.RawMessage
+		if json.Unmarshal(raw, &statement) != nil {
+			addf("Statement must be a list of statements")
+			return problems
+		}
+		statements = append(statements, statement)
+	}
+	if len(statements) == 0 {
+		addf("Statement must list at least one statement")
+	}
+
+	sids := make(map[string]bool)
+	for i, statement := range statements {
+		for _, err := range checkPolicyStatement(statement, kind) {
+			addf("Statement[%d]: %v", i, err)
+		}
+		var sid string
+		if json.Unmarshal(statement["Sid"], &sid) == nil && sid != "" {
+			if sids[sid] {
+				addf("Statement[%d]: Sid %q is used by another statement", i, sid)
+			}
+			sids[sid] = true
+		}
+	}
+	return problems
+}
+
+// checkPolicyStatement returns the structural problems of one statement
+func checkPolicyStatement(statement map[string]json.RawMessage, kind policyKind) []error {
+	var problems []error
+	addf := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+	for _, key := range slices.Sorted(maps.Keys(statement)) {
+		if !statementElements[key] {
+			addf("unknown element %s", key)
+		}
+	}
+
+	var effect string
+	if raw, ok := statement["Effect"]; !ok {
+		addf("Effect is required")
+	} else if json.Unmarshal(raw, &effect) != nil || (effect != "Allow" && effect != "Deny") {
+		addf("Effect must be Allow or Deny, got %s", raw)
+	}
+
+	if field, err := exactlyOneOf(statement, "Action", "NotAction"); err != nil {
+		addf("%v", err)
+	} else if actions, ok := stringOrList(statement[field]); !ok {
+		addf("%s must be a string or a list of strings", field)
+	} else {
+		for _, action := range actions {
+			if action != "*" && !strings.Contains(action, ":") {
+				addf("%s %q must be * or service:action", field, action)
+			}
+		}
+	}
+
+	_, hasResource := statement["Resource"]
+	_, hasNotResource := statement["NotResource"]
+	if kind != repositoryPolicy || hasResource || hasNotResource {
+		if field, err := exactlyOneOf(statement, "Resource", "NotResource"); err != nil {
+			addf("%v", err)
+		} else if _, ok := stringOrList(statement[field]); !ok {
+			addf("%s must be a string or a list of strings", field)
+		}
+	}
+
+	_, hasPrincipal := statement["Principal"]
+	_, hasNotPrincipal := statement["NotPrincipal"]
+	switch {
+	case kind == identityPolicy && (hasPrincipal || hasNotPrincipal):
+		addf("Principal cannot be set in a policy attached to an IAM identity")
+	case kind != identityPolicy:
+		if field, err := exactlyOneOf(statement, "Principal", "NotPrincipal"); err != nil {
+			addf("%v", err)
+		} else if !validPrincipal(statement[field]) {
+			addf(`%s must be "*" or map AWS, Service, Federated or CanonicalUser to strings`, field)
+		}
+	}
+
+	if raw, ok := statement["Condition"]; ok {
+		var condition map[string]map[string]json.RawMessage
+		if json.Unmarshal(raw, &condition) != nil {
+			addf("Condition must map operators to keys and values")
+		}
+	}
+	return problems
+}
+
+// exactlyOneOf returns whichever of the two elements the statement has, or an error when
+// it has neither or both
+func exactlyOneOf(statement map[string]json.RawMessage, element, notElement string) (string, error) {
+	_, has := statement[element]
+	_, hasNot := statement[notElement]
+	switch {
+	case has && hasNot:
+		return "", fmt.Errorf("only one of %s or %s may be set", element, notElement)
+	case has:
+		return element, nil
+	case hasNot:
+		return notElement, nil
+	default:
+		return "", fmt.Errorf("%s is required", element)
+	}
+}
+
+// stringOrList decodes an element that is a string or a non-empty list of strings
+func stringOrList(raw json.RawMessage) ([]string, bool) {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return []string{single}, single != ""
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil && len(list) > 0 {
+		return list, true
+	}
+	return nil, false
+}
+
+// validPrincipal reports whether a principal is "*" or maps principal types to strings
+func validPrincipal(raw json.RawMessage) bool {
+	var wildcard string
+	if json.Unmarshal(raw, &wildcard) == nil {
+		return wildcard == "*"
+	}
+	var principals map[string]json.RawMessage
+	if json.Unmarshal(raw, &principals) != nil || len(principals) == 0 {
+		return false
+	}
+	for principalType, value := range principals {
+		switch principalType {
+		case "AWS", "Service", "Federated", "CanonicalUser":
+		default:
+			return false
+		}
+		if _, ok := stringOrList(value); !ok {
+			return false
+		}
+	}
+	return true
+}
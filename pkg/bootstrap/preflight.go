@@ -0,0 +1,197 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// preflight runs the read-only checks of every resource in the config before anything is
+// written, so that a mistake found halfway through would not leave the run partly applied.
+// It reads the files the resources refer to, lints their policy documents, assumes the
+// roles in resource_roles, checks that no bucket name belongs to another account and, without
+// a credentials file, that no credential would be generated. Every problem is returned
+// together.
+func (b *Bootstrapper) preflight(ctx context.Context, config *Config, stages []provisionStage) error {
+	var errs []error
+
+	errs = append(errs, config.preflightFiles()...)
+	if err := config.LintPolicies(); err != nil {
+		errs = append(errs, err)
+	}
+
+	// A role that cannot be assumed would otherwise only fail when its first resource is
+	// reached, after the stages before it were applied
+	types := make([]string, 0, len(stages)+1)
+	if config.PasswordPolicy != nil {
+		types = append(types, ResourceTypePasswordPolicy)
+	}
+	for _, stage := range stages {
+		if !slices.Contains(types, stage.Type) {
+			types = append(types, stage.Type)
+		}
+	}
+	failedRoles := make(map[string]bool)
+	for _, resourceType := range types {
+		role, ok := config.resourceRole(resourceType)
+		if !ok || failedRoles[role.roleARN(config.Region)] {
+			continue
+		}
+		if _, err := b.clientsForRole(ctx, config.Region, role); err != nil {
+			failedRoles[role.roleARN(config.Region)] = true
+			errs = append(errs, fmt.Errorf("resource_roles for %s: %w", resourceType, err))
+		}
+	}
+
+	// Bucket ownership is cached, so CreateS3Buckets does not look the names up again
+	if len(config.S3Buckets) > 0 && !failedRoles[b.roleARNFor(config, ResourceTypeS3)] {
+		err := b.withResourceRole(ctx, config, ResourceTypeS3, func() error {
+			_, err := b.preflightS3Buckets(ctx, config.S3Buckets)
+			return err
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Generated credentials can only be saved to the credentials file, so a resource that
+	// would generate one fails without it
+	if b.credentialsOut == "" {
+		errs = append(errs, b.preflightCredentials(ctx, config, failedRoles)...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// preflightCredentials finds the key pairs and IAM users that would get a generated private
+// key or console password. Existing key pairs and login profiles are never replaced, so
+// only the missing ones are reported.
+func (b *Bootstrapper) preflightCredentials(ctx context.Context, config *Config, failedRoles map[string]bool) []error {
+	var errs []error
+
+	var keyPairs []string
+	for _, keyPair := range config.KeyPairs {
+		// An unreadable public key file is already reported by preflightFiles
+		if publicKey, err := keyPair.publicKey(); err == nil && publicKey == "" {
+			keyPairs = append(keyPairs, keyPair.Name)
+		}
+	}
+	if len(keyPairs) > 0 && !failedRoles[b.roleARNFor(config, ResourceTypeKeyPair)] {
+		err := b.withResourceRole(ctx, config, ResourceTypeKeyPair, func() error {
+			output, err := b.ec2Client.DescribeKeyPairs(ctx, &ec2.DescribeKeyPairsInput{
+				Filters: []ec2types.Filter{{Name: aws.String("key-name"), Values: keyPairs}},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to look up key pairs: %w", err)
+			}
+			existing := make(map[string]bool)
+			for _, keyPair := range output.KeyPairs {
+				existing[aws.ToString(keyPair.KeyName)] = true
+			}
+			for _, name := range keyPairs {
+				if !existing[name] {
+					errs = append(errs, fmt.Errorf("key pair %s has no public key, so a private key would be generated; use -credentials-out to save it", name))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	var users []string
+	for _, user := range config.IAMUsers {
+		if user.generatesPassword() {
+			users = append(users, user.Name)
+		}
+	}
+	if len(users) > 0 && !failedRoles[b.roleARNFor(config, ResourceTypeIAM)] {
+		err := b.withResourceRole(ctx, config, ResourceTypeIAM, func() error {
+			for _, name := range users {
+				missing, err := b.loginProfileMissing(ctx, name)
+				if err != nil {
+					return err
+				}
+				if missing {
+					errs = append(errs, fmt.Errorf("IAM user %s has console_access without a password, so one would be generated; use -credentials-out to save it", name))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// loginProfileMissing reports whether the IAM user, or its login profile, does not exist yet
+func (b *Bootstrapper) loginProfileMissing(ctx context.Context, userName string) (bool, error) {
+	_, err := b.iamClient.GetUser(ctx, &iam.GetUserInput{UserName: aws.String(userName)})
+	if isAPIError[*iamtypes.NoSuchEntityException](err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get IAM user %s: %w", userName, err)
+	}
+
+	_, err = b.iamClient.GetLoginProfile(ctx, &iam.GetLoginProfileInput{UserName: aws.String(userName)})
+	if isAPIError[*iamtypes.NoSuchEntityException](err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get login profile for IAM user %s: %w", userName, err)
+	}
+	return false, nil
+}
+
+// roleARNFor returns the ARN of the role the resources of the type are provisioned with,
+// or "" when they use the session's own credentials
+func (b *Bootstrapper) roleARNFor(config *Config, resourceType string) string {
+	role, ok := config.resourceRole(resourceType)
+	if !ok {
+		return ""
+	}
+	return role.roleARN(config.Region)
+}
+
+// preflightFiles checks that every file the resources read while they are provisioned can
+// be read: bucket policies, ECR lifecycle policies, Lambda deployment packages and public
+// keys. ECR lifecycle policies are also checked for their structure.
+func (c *Config) preflightFiles() []error {
+	var errs []error
+	for _, bucket := range c.S3Buckets {
+		if _, err := loadPolicy(bucket.Policy, bucket.PolicyFile); err != nil {
+			errs = append(errs, fmt.Errorf("S3 bucket %s: %w", bucket.Name, err))
+		}
+	}
+	for _, repo := range c.ECRRepositories {
+		if _, err := loadECRLifecyclePolicy(repo); err != nil {
+			errs = append(errs, fmt.Errorf("ECR repository %s: %w", repo.Name, err))
+		}
+	}
+	for _, function := range c.LambdaFunctions {
+		if function.ZipFile == "" {
+			continue
+		}
+		if _, err := os.Stat(function.ZipFile); err != nil {
+			errs = append(errs, fmt.Errorf("Lambda function %s: failed to read zip file: %w", function.Name, err))
+		}
+	}
+	for _, keyPair := range c.KeyPairs {
+		if _, err := keyPair.publicKey(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
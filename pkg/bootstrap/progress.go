@@ -0,0 +1,197 @@
+package bootstrap
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often the spinner is redrawn, and how often operations still running are logged
+// when there is no spinner
+const (
+	spinnerInterval     = 200 * time.Millisecond
+	progressLogInterval = 30 * time.Second
+)
+
+// spinnerFrames are drawn in turn at the start of the spinner line
+const spinnerFrames = `|/-\`
+
+// clearLine returns the cursor to the start of the line and erases it
+const clearLine = "\r\033[K"
+
+// Progress reports long operations, such as waiting for an RDS instance to become
+// available, while they run. With a spinner it keeps a line with the status and elapsed
+// time of every running operation at the bottom of its writer; log records written
+// through the Progress are printed above that line. Without a spinner the operations
+// still running are logged periodically instead.
+type Progress struct {
+	w       io.Writer
+	spinner bool
+
+	mu    sync.Mutex
+	tasks []*progressTask
+	drawn bool
+	frame int
+	stop  chan struct{}
+}
+
+// progressTask is one operation being reported
+type progressTask struct {
+	progress *Progress
+	label    string
+	status   string
+	started  time.Time
+}
+
+// progress reports the long operations of every bootstrapper; see SetProgress
+var progress = NewProgress(os.Stderr, false)
+
+// NewProgress returns a progress reporter writing to w. With spinner set, w should be a
+// terminal and the logger should write through the returned Progress, see NewLogger, so
+// that log records never break into the spinner line.
+func NewProgress(w io.Writer, spinner bool) *Progress {
+	return &Progress{w: w, spinner: spinner}
+}
+
+// SetProgress sets how long operations report their progress; nil turns reports off
+func SetProgress(p *Progress) {
+	progress = p
+}
+
+// IsTerminal reports whether f is a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Write writes log output, erasing the spinner line first and drawing it again after
+func (p *Progress) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	n, err := p.w.Write(data)
+	p.draw()
+	return n, err
+}
+
+// startProgress begins reporting an operation, such as "RDS my-db", with its current
+// status. The task is nil when reports are off; its methods then do nothing.
+func startProgress(label, status string) *progressTask {
+	p := progress
+	if p == nil {
+		return nil
+	}
+	task := &progressTask{progress: p, label: label, status: status, started: time.Now()}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tasks = append(p.tasks, task)
+	if p.stop == nil {
+		p.stop = make(chan struct{})
+		go p.run(p.stop)
+	}
+	p.clear()
+	p.draw()
+	return task
+}
+
+// update sets the current status of the operation
+func (t *progressTask) update(status string) {
+	if t == nil {
+		return
+	}
+	p := t.progress
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t.status = status
+	p.clear()
+	p.draw()
+}
+
+// done stops reporting the operation
+func (t *progressTask) done() {
+	if t == nil {
+		return
+	}
+	p := t.progress
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, task := range p.tasks {
+		if task == t {
+			p.tasks = append(p.tasks[:i], p.tasks[i+1:]...)
+			break
+		}
+	}
+	p.clear()
+	if len(p.tasks) == 0 {
+		close(p.stop)
+		p.stop = nil
+		return
+	}
+	p.draw()
+}
+
+// run redraws the spinner, or logs the running operations, until stop is closed
+func (p *Progress) run(stop chan struct{}) {
+	interval := progressLogInterval
+	if p.spinner {
+		interval = spinnerInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		if p.spinner {
+			p.frame++
+			p.clear()
+			p.draw()
+			p.mu.Unlock()
+			continue
+		}
+		// The logger may write through this Progress, so log without holding the lock
+		running := make([]progressTask, 0, len(p.tasks))
+		for _, task := range p.tasks {
+			running = append(running, *task)
+		}
+		p.mu.Unlock()
+		for _, task := range running {
+			logger.Info("Still waiting", "operation", task.label, "status", task.status, "elapsed", task.elapsed())
+		}
+	}
+}
+
+// clear erases the spinner line if it is drawn; p.mu must be held
+func (p *Progress) clear() {
+	if p.drawn {
+		fmt.Fprint(p.w, clearLine)
+		p.drawn = false
+	}
+}
+
+// draw writes the spinner line for the running operations; p.mu must be held
+func (p *Progress) draw() {
+	if !p.spinner || len(p.tasks) == 0 {
+		return
+	}
+	parts := make([]string, len(p.tasks))
+	for i, task := range p.tasks {
+		parts[i] = fmt.Sprintf("%s: %s (%s)", task.label, task.status, task.elapsed())
+	}
+	fmt.Fprintf(p.w, "%c %s", spinnerFrames[p.frame%len(spinnerFrames)], strings.Join(parts, ", "))
+	p.drawn = true
+}
+
+// elapsed returns how long the operation has been running, to the second
+func (t *progressTask) elapsed() time.Duration {
+	return time.Since(t.started).Truncate(time.Second)
+}
@@ -0,0 +1,432 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// ManageRDSInstances creates or modifies RDS instances based on the configuration
+func (b *Bootstrapper) ManageRDSInstances(ctx context.Context, instances []RDSInstance) ([]ResourceResult, error) {
+	// Skip if no instances are defined
+	if len(instances) == 0 {
+		return nil, nil
+	}
+
+	var results []ResourceResult
+	for _, instance := range instances {
+		// Stop before starting the next resource if the run was cancelled or timed out
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+
+		res := newResourceResult(ResourceTypeRDS, instance.Identifier)
+		err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+			if err := b.ensureRDSInstance(ctx, instance, res); err != nil {
+				return err
+			}
+			// An existing instance with if_not_exists is not started or stopped either
+			if instance.DesiredState != "" && (!instance.IfNotExists || res.Action == ActionCreated) {
+				if err := b.reconcileRDSInstanceState(ctx, instance, res); err != nil {
+					return err
+				}
+			}
+			// A stopped instance never becomes available; stopping already waited for it
+			if instance.WaitForAvailable && instance.DesiredState != rdsStateStopped {
+				return b.waitForRDSInstance(ctx, instance.Identifier)
+			}
+			return nil
+		})
+		results = append(results, res.finish(err))
+		if err != nil && !b.tolerate(err) {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// rdsWaitTimeout bounds how long to wait for an RDS instance to become available
+const rdsWaitTimeout = 60 * time.Minute
+
+// applyImmediately reports whether modifications should be applied right away instead of
+// during the next maintenance window
+func (i RDSInstance) applyImmediately() bool {
+	return i.ApplyImmediately == nil || *i.ApplyImmediately
+}
+
+// ensureRDSInstance creates a single RDS instance if needed or modifies its storage
+func (b *Bootstrapper) ensureRDSInstance(ctx context.Context, instance RDSInstance, res *ResourceResult) error {
+	logger.Info("Ensuring RDS instance", "instance", instance.Identifier)
+
+	// Check if the instance exists
+	describeInput := &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: aws.String(instance.Identifier),
+	}
+
+	describeOutput, err := b.rdsClient.DescribeDBInstances(ctx, describeInput)
+
+	if err != nil {
+		// Instance doesn't exist, create it
+		if isAPIError[*rdstypes.DBInstanceNotFoundFault](err) {
+			// Create new RDS instance
+			logger.Info("Creating new RDS instance", "instance", instance.Identifier)
+
+			// Set up creation parameters
+			createInput := &rds.CreateDBInstanceInput{
+				DBInstanceIdentifier: aws.String(instance.Identifier),
+				Engine:               aws.String(instance.Engine),
+				DBInstanceClass:      aws.String(instance.InstanceClass),
+				AllocatedStorage:     aws.Int32(int32(instance.AllocatedStorage)),
+				DBName:               aws.String(instance.DBName),
+			}
+
+			// Add optional parameters if provided
+			if instance.EngineVersion != "" {
+				createInput.EngineVersion = aws.String(instance.EngineVersion)
+			}
+
+			if instance.StorageType != "" {
+				createInput.StorageType = aws.String(instance.StorageType)
+			}
+
+			if instance.MasterUsername != "" {
+				createInput.MasterUsername = aws.String(instance.MasterUsername)
+			}
+
+			// The password comes from the config, an existing secret, or a newly generated secret
+			password, err := b.resolveRDSMasterPassword(ctx, instance)
+			if err != nil {
+				return err
+			}
+			createInput.MasterUserPassword = aws.String(password)
+
+			createInput.PubliclyAccessible = aws.Bool(instance.PubliclyAccessible)
+
+			if instance.BackupRetentionPeriod > 0 {
+				createInput.BackupRetentionPeriod = aws.Int32(int32(instance.BackupRetentionPeriod))
+			}
+
+			createInput.MultiAZ = aws.Bool(instance.MultiAZ)
+			createInput.DeletionProtection = aws.Bool(instance.DeletionProtection)
+
+			if len(instance.Tags) > 0 {
+				createInput.Tags = buildRDSTags(instance.Tags)
+			}
+
+			if err := b.ensureRDSParameterGroup(ctx, instance, res); err != nil {
+				return err
+			}
+			if name := instance.parameterGroupName(); name != "" {
+				createInput.DBParameterGroupName = aws.String(name)
+			}
+
+			// Place the instance in the configured VPC subnets and security groups
+			subnetGroupName, err := b.ensureRDSSubnetGroup(ctx, instance)
+			if err != nil {
+				return err
+			}
+			if subnetGroupName != "" {
+				createInput.DBSubnetGroupName = aws.String(subnetGroupName)
+			}
+			if len(instance.VPCSecurityGroupIDs) > 0 {
+				createInput.VpcSecurityGroupIds = instance.VPCSecurityGroupIDs
+			} else if !instance.PubliclyAccessible {
+				res.warnf("RDS instance %s is private but no vpc_security_group_ids are set; the VPC's default security group will be used",
+					instance.Identifier)
+			}
+
+			// Create the instance
+			createOutput, err := b.rdsClient.CreateDBInstance(ctx, createInput)
+			if err != nil {
+				return fmt.Errorf("failed to create RDS instance %s: %w", instance.Identifier, err)
+			}
+
+			res.created()
+			if createOutput.DBInstance != nil {
+				res.ARN = aws.ToString(createOutput.DBInstance.DBInstanceArn)
+			}
+			logger.Info("Created RDS instance", "instance", instance.Identifier)
+		} else {
+			// Some other error occurred
+			return fmt.Errorf("error checking RDS instance %s: %w", instance.Identifier, err)
+		}
+	} else {
+		// Instance exists, check if we need to modify it
+		if len(describeOutput.DBInstances) > 0 {
+			existingInstance := describeOutput.DBInstances[0]
+			res.ARN = aws.ToString(existingInstance.DBInstanceArn)
+			if instance.IfNotExists {
+				leaveExisting(res)
+				return nil
+			}
+
+			// Check if the instance is in a modifiable state (safely handle nil pointer)
+			var instanceStatus string
+			if existingInstance.DBInstanceStatus != nil {
+				instanceStatus = *existingInstance.DBInstanceStatus
+			}
+
+			// Get current storage size (safely handle nil pointer)
+			var currentStorage int32
+			if existingInstance.AllocatedStorage != nil {
+				currentStorage = *existingInstance.AllocatedStorage
+			}
+
+			// Check if storage size needs to be updated
+			if currentStorage != int32(instance.AllocatedStorage) {
+				logger.Info("Modifying storage size", "instance", instance.Identifier,
+					"from_gb", currentStorage, "to_gb", instance.AllocatedStorage)
+
+				// Only the storage change waits for the instance; the settings below are still
+				// reconciled
+				if instanceStatus != "available" {
+					res.warnf("cannot modify storage of RDS instance %s because it is in %s state. Must be 'available'",
+						instance.Identifier, instanceStatus)
+				} else {
+					// Modify the instance storage
+					modifyInput := &rds.ModifyDBInstanceInput{
+						DBInstanceIdentifier: aws.String(instance.Identifier),
+						AllocatedStorage:     aws.Int32(int32(instance.AllocatedStorage)),
+						ApplyImmediately:     aws.Bool(instance.applyImmediately()),
+					}
+
+					_, err = b.rdsClient.ModifyDBInstance(ctx, modifyInput)
+					if err != nil {
+						res.warnf("failed to modify storage for RDS instance %s: %v", instance.Identifier, err)
+					} else {
+						res.updated()
+						logger.Info("Modified storage; the change may take several minutes to complete",
+							"instance", instance.Identifier, "allocated_storage_gb", instance.AllocatedStorage)
+					}
+				}
+			} else {
+				logger.Info("RDS instance already exists with correct storage size",
+					"instance", instance.Identifier, "allocated_storage_gb", currentStorage)
+			}
+
+			// Check if instance class needs to be updated (safely handle nil pointer)
+			var currentInstanceClass string
+			if existingInstance.DBInstanceClass != nil {
+				currentInstanceClass = *existingInstance.DBInstanceClass
+			}
+
+			if currentInstanceClass != "" && currentInstanceClass != instance.InstanceClass {
+				b.modifyRDSInstanceClass(ctx, instance, existingInstance, currentInstanceClass, instanceStatus, res)
+			}
+
+			// Check if engine version needs to be updated (safely handle nil pointer)
+			var currentEngineVersion string
+			if existingInstance.EngineVersion != nil {
+				currentEngineVersion = *existingInstance.EngineVersion
+			}
+
+			if instance.EngineVersion != "" && currentEngineVersion != "" &&
+				currentEngineVersion != instance.EngineVersion {
+				logger.Warn("Engine version change detected, but not implemented in this version",
+					"instance", instance.Identifier, "from", currentEngineVersion, "to", instance.EngineVersion)
+			}
+
+			// Reconcile deletion protection (safely handle nil pointer)
+			currentDeletionProtection := aws.ToBool(existingInstance.DeletionProtection)
+			if currentDeletionProtection != instance.DeletionProtection {
+				_, err = b.rdsClient.ModifyDBInstance(ctx, &rds.ModifyDBInstanceInput{
+					DBInstanceIdentifier: aws.String(instance.Identifier),
+					DeletionProtection:   aws.Bool(instance.DeletionProtection),
+					ApplyImmediately:     aws.Bool(true),
+				})
+				if err != nil {
+					res.warnf("failed to update deletion protection for RDS instance %s: %v", instance.Identifier, err)
+				} else {
+					res.updated()
+					logger.Info("Changed deletion protection", "instance", instance.Identifier,
+						"from", currentDeletionProtection, "to", instance.DeletionProtection)
+				}
+			}
+
+			// Reconcile the parameter group before making sure the instance uses it
+			if err := b.ensureRDSParameterGroup(ctx, instance, res); err != nil {
+				res.warnf("%v", err)
+			} else {
+				b.attachRDSParameterGroup(ctx, instance, existingInstance, res)
+			}
+
+			// Apply tags using the instance ARN
+			if len(instance.Tags) > 0 && existingInstance.DBInstanceArn != nil {
+				_, err = b.rdsClient.AddTagsToResource(ctx, &rds.AddTagsToResourceInput{
+					ResourceName: existingInstance.DBInstanceArn,
+					Tags:         buildRDSTags(instance.Tags),
+				})
+				if err != nil {
+					res.warnf("failed to set tags for RDS instance %s: %v", instance.Identifier, err)
+				} else {
+					res.updated()
+					logger.Info("Set RDS instance tags", "instance", instance.Identifier, "tags", len(instance.Tags))
+				}
+			}
+			if b.pruneTags && existingInstance.DBInstanceArn != nil {
+				b.pruneRDSTags(ctx, "RDS instance", instance.Identifier, existingInstance.DBInstanceArn,
+					existingInstance.TagList, instance.Tags, res)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ensureRDSSubnetGroup creates the instance's inline subnet group if it does not exist yet
+// and returns the name of the subnet group to launch the instance in, if any
+func (b *Bootstrapper) ensureRDSSubnetGroup(ctx context.Context, instance RDSInstance) (string, error) {
+	group := instance.SubnetGroup
+	if group == nil {
+		return instance.DBSubnetGroupName, nil
+	}
+
+	_, err := b.rdsClient.DescribeDBSubnetGroups(ctx, &rds.DescribeDBSubnetGroupsInput{
+		DBSubnetGroupName: aws.String(group.Name),
+	})
+	if err == nil {
+		logger.Info("DB subnet group already exists", "subnet_group", group.Name)
+		return group.Name, nil
+	}
+	if !isAPIError[*rdstypes.DBSubnetGroupNotFoundFault](err) {
+		return "", fmt.Errorf("error checking DB subnet group %s: %w", group.Name, err)
+	}
+
+	subnetIDs, err := b.resolveSubnetIDs(ctx, group.SubnetIDs)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve subnets of DB subnet group %s: %w", group.Name, err)
+	}
+	description := group.Description
+	if description == "" {
+		description = fmt.Sprintf("Subnet group for RDS instance %s", instance.Identifier)
+	}
+	createInput := &rds.CreateDBSubnetGroupInput{
+		DBSubnetGroupName:        aws.String(group.Name),
+		DBSubnetGroupDescription: aws.String(description),
+		SubnetIds:                subnetIDs,
+	}
+	if len(instance.Tags) > 0 {
+		createInput.Tags = buildRDSTags(instance.Tags)
+	}
+
+	if _, err := b.rdsClient.CreateDBSubnetGroup(ctx, createInput); err != nil {
+		return "", fmt.Errorf("failed to create DB subnet group %s: %w", group.Name, err)
+	}
+	logger.Info("Created DB subnet group", "subnet_group", group.Name, "subnets", len(group.SubnetIDs))
+	return group.Name, nil
+}
+
+// waitForRDSInstance polls until the instance is available, then prints its endpoint.
+// The wait is bounded by rdsWaitTimeout and by the context deadline, whichever comes first.
+func (b *Bootstrapper) waitForRDSInstance(ctx context.Context, identifier string) error {
+	logger.Info("Waiting for RDS instance to become available", "instance", identifier)
+	task := startProgress("RDS "+identifier, "waiting")
+	defer task.done()
+
+	waiter := rds.NewDBInstanceAvailableWaiter(b.rdsClient)
+	output, err := waiter.WaitForOutput(ctx, &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: aws.String(identifier),
+	}, rdsWaitTimeout, func(o *rds.DBInstanceAvailableWaiterOptions) {
+		retryable := o.Retryable
+		o.Retryable = func(ctx context.Context, input *rds.DescribeDBInstancesInput, output *rds.DescribeDBInstancesOutput, err error) (bool, error) {
+			if err == nil && len(output.DBInstances) > 0 {
+				task.update(aws.ToString(output.DBInstances[0].DBInstanceStatus))
+			}
+			return retryable(ctx, input, output, err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed waiting for RDS instance %s to become available: %w", identifier, err)
+	}
+
+	if len(output.DBInstances) > 0 && output.DBInstances[0].Endpoint != nil {
+		endpoint := output.DBInstances[0].Endpoint
+		logger.Info("RDS instance is available", "instance", identifier,
+			"address", aws.ToString(endpoint.Address), "port", aws.ToInt32(endpoint.Port))
+	} else {
+		logger.Info("RDS instance is available", "instance", identifier)
+	}
+	return nil
+}
+
+// buildRDSTags converts a tag map into RDS tags sorted by key
+func buildRDSTags(tags map[string]string) []rdstypes.Tag {
+	result := make([]rdstypes.Tag, 0, len(tags))
+	for _, key := range sortedKeys(tags) {
+		result = append(result, rdstypes.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+	return result
+}
+
+// pruneRDSTags removes tags from an existing RDS instance or Aurora cluster that are not in
+// its configuration
+func (b *Bootstrapper) pruneRDSTags(ctx context.Context, kind, identifier string, arn *string,
+	tags []rdstypes.Tag, want map[string]string, res *ResourceResult) {
+	current := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		current[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	stale := staleTagKeys(current, want)
+	if len(stale) == 0 {
+		return
+	}
+	_, err := b.rdsClient.RemoveTagsFromResource(ctx, &rds.RemoveTagsFromResourceInput{
+		ResourceName: arn,
+		TagKeys:      stale,
+	})
+	if err != nil {
+		res.warnf("failed to remove tags from %s %s: %v", kind, identifier, err)
+		return
+	}
+	res.updated()
+	logger.Info("Removed tags", "resource", kind, "identifier", identifier, "tags", strings.Join(stale, ","))
+}
+
+// modifyRDSInstanceClass changes the instance class of an existing RDS instance
+func (b *Bootstrapper) modifyRDSInstanceClass(ctx context.Context, instance RDSInstance, existingInstance rdstypes.DBInstance,
+	currentInstanceClass, instanceStatus string, res *ResourceResult) {
+	logger.Info("Modifying instance class", "instance", instance.Identifier,
+		"from", currentInstanceClass, "to", instance.InstanceClass)
+
+	// Don't stack a second class change on top of one that is still pending
+	if pending := existingInstance.PendingModifiedValues; pending != nil && pending.DBInstanceClass != nil {
+		res.warnf("RDS instance %s already has a pending instance class change to %s; skipping",
+			instance.Identifier, aws.ToString(pending.DBInstanceClass))
+		return
+	}
+
+	if instanceStatus != "available" {
+		res.warnf("cannot modify instance class of RDS instance %s because it is in %s state. Must be 'available'",
+			instance.Identifier, instanceStatus)
+		return
+	}
+
+	_, err := b.rdsClient.ModifyDBInstance(ctx, &rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: aws.String(instance.Identifier),
+		DBInstanceClass:      aws.String(instance.InstanceClass),
+		ApplyImmediately:     aws.Bool(instance.applyImmediately()),
+	})
+	if err != nil {
+		res.warnf("failed to modify instance class for RDS instance %s: %v", instance.Identifier, err)
+		return
+	}
+
+	res.updated()
+	if instance.applyImmediately() {
+		logger.Info("Modifying instance class; the instance will reboot, causing a brief downtime",
+			"instance", instance.Identifier, "instance_class", instance.InstanceClass)
+	} else {
+		logger.Info("Scheduled instance class change for the next maintenance window; it will cause a brief downtime",
+			"instance", instance.Identifier, "instance_class", instance.InstanceClass)
+	}
+}
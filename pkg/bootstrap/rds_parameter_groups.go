@@ -0,0 +1,191 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// maxParametersPerModify is the number of parameters ModifyDBParameterGroup accepts per call
+const maxParametersPerModify = 20
+
+// parameterGroupName returns the name of the parameter group the instance should use, or
+// an empty string to keep the engine's default group
+func (i RDSInstance) parameterGroupName() string {
+	if i.ParameterGroup != nil {
+		return i.ParameterGroup.Name
+	}
+	return i.DBParameterGroupName
+}
+
+// ensureRDSParameterGroup creates the instance's inline parameter group if it does not exist
+// and reconciles its parameters. Parameters that only take effect after a reboot are
+// recorded as a warning.
+func (b *Bootstrapper) ensureRDSParameterGroup(ctx context.Context, instance RDSInstance, res *ResourceResult) error {
+	group := instance.ParameterGroup
+	if group == nil {
+		return nil
+	}
+
+	describeOutput, err := b.rdsClient.DescribeDBParameterGroups(ctx, &rds.DescribeDBParameterGroupsInput{
+		DBParameterGroupName: aws.String(group.Name),
+	})
+	current := make(map[string]string)
+	if err != nil {
+		if !isAPIError[*rdstypes.DBParameterGroupNotFoundFault](err) {
+			return fmt.Errorf("error checking DB parameter group %s: %w", group.Name, err)
+		}
+
+		description := group.Description
+		if description == "" {
+			description = fmt.Sprintf("Parameter group for RDS instance %s", instance.Identifier)
+		}
+		createInput := &rds.CreateDBParameterGroupInput{
+			DBParameterGroupName:   aws.String(group.Name),
+			DBParameterGroupFamily: aws.String(group.Family),
+			Description:            aws.String(description),
+		}
+		if len(instance.Tags) > 0 {
+			createInput.Tags = buildRDSTags(instance.Tags)
+		}
+		if _, err := b.rdsClient.CreateDBParameterGroup(ctx, createInput); err != nil {
+			return fmt.Errorf("failed to create DB parameter group %s: %w", group.Name, err)
+		}
+		logger.Info("Created DB parameter group", "parameter_group", group.Name, "family", group.Family)
+	} else {
+		logger.Info("DB parameter group already exists", "parameter_group", group.Name)
+		if len(describeOutput.DBParameterGroups) > 0 {
+			family := aws.ToString(describeOutput.DBParameterGroups[0].DBParameterGroupFamily)
+			if family != group.Family {
+				res.warnf("DB parameter group %s has family %s but %s was requested; the family cannot be changed after creation",
+					group.Name, family, group.Family)
+			}
+		}
+
+		current, err = b.userParameters(ctx, group.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	var changed []string
+	for _, name := range sortedKeys(group.Parameters) {
+		if value, ok := current[name]; !ok || value != group.Parameters[name] {
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	applyTypes, err := b.parameterApplyTypes(ctx, group.Family)
+	if err != nil {
+		return err
+	}
+
+	var parameters []rdstypes.Parameter
+	var pendingReboot []string
+	for _, name := range changed {
+		// Static parameters can only be applied by rebooting the instance
+		method := rdstypes.ApplyMethodImmediate
+		if applyTypes[name] != "dynamic" {
+			method = rdstypes.ApplyMethodPendingReboot
+			pendingReboot = append(pendingReboot, name)
+		}
+		parameters = append(parameters, rdstypes.Parameter{
+			ParameterName:  aws.String(name),
+			ParameterValue: aws.String(group.Parameters[name]),
+			ApplyMethod:    method,
+		})
+	}
+
+	for start := 0; start < len(parameters); start += maxParametersPerModify {
+		end := min(start+maxParametersPerModify, len(parameters))
+		_, err := b.rdsClient.ModifyDBParameterGroup(ctx, &rds.ModifyDBParameterGroupInput{
+			DBParameterGroupName: aws.String(group.Name),
+			Parameters:           parameters[start:end],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set parameters in DB parameter group %s: %w", group.Name, err)
+		}
+	}
+	res.updated()
+	logger.Info("Set DB parameter group parameters", "parameter_group", group.Name, "parameters", strings.Join(changed, ","))
+
+	if len(pendingReboot) > 0 {
+		res.warnf("parameters %s of DB parameter group %s only take effect after RDS instance %s is rebooted",
+			strings.Join(pendingReboot, ", "), group.Name, instance.Identifier)
+	}
+	return nil
+}
+
+// userParameters returns the parameters that have been changed from the engine defaults in
+// a parameter group
+func (b *Bootstrapper) userParameters(ctx context.Context, groupName string) (map[string]string, error) {
+	parameters := make(map[string]string)
+	paginator := rds.NewDescribeDBParametersPaginator(b.rdsClient, &rds.DescribeDBParametersInput{
+		DBParameterGroupName: aws.String(groupName),
+		Source:               aws.String("user"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parameters of DB parameter group %s: %w", groupName, err)
+		}
+		for _, parameter := range page.Parameters {
+			parameters[aws.ToString(parameter.ParameterName)] = aws.ToString(parameter.ParameterValue)
+		}
+	}
+	return parameters, nil
+}
+
+// parameterApplyTypes returns whether each parameter of a family is "static" or "dynamic"
+func (b *Bootstrapper) parameterApplyTypes(ctx context.Context, family string) (map[string]string, error) {
+	applyTypes := make(map[string]string)
+	paginator := rds.NewDescribeEngineDefaultParametersPaginator(b.rdsClient, &rds.DescribeEngineDefaultParametersInput{
+		DBParameterGroupFamily: aws.String(family),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe default parameters of family %s: %w", family, err)
+		}
+		if page.EngineDefaults == nil {
+			continue
+		}
+		for _, parameter := range page.EngineDefaults.Parameters {
+			applyTypes[aws.ToString(parameter.ParameterName)] = aws.ToString(parameter.ApplyType)
+		}
+	}
+	return applyTypes, nil
+}
+
+// attachRDSParameterGroup associates an existing instance with its configured parameter
+// group. The instance must be rebooted for the new group to take full effect.
+func (b *Bootstrapper) attachRDSParameterGroup(ctx context.Context, instance RDSInstance, existingInstance rdstypes.DBInstance, res *ResourceResult) {
+	want := instance.parameterGroupName()
+	if want == "" {
+		return
+	}
+	for _, group := range existingInstance.DBParameterGroups {
+		if aws.ToString(group.DBParameterGroupName) == want {
+			return
+		}
+	}
+
+	_, err := b.rdsClient.ModifyDBInstance(ctx, &rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: aws.String(instance.Identifier),
+		DBParameterGroupName: aws.String(want),
+		ApplyImmediately:     aws.Bool(instance.applyImmediately()),
+	})
+	if err != nil {
+		res.warnf("failed to attach DB parameter group %s to RDS instance %s: %v", want, instance.Identifier, err)
+		return
+	}
+	res.updated()
+	res.warnf("attached DB parameter group %s to RDS instance %s; reboot the instance for it to take full effect", want, instance.Identifier)
+}
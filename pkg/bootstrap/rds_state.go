@@ -0,0 +1,139 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+)
+
+// The desired states an RDS instance can be kept in
+const (
+	rdsStateRunning = "running"
+	rdsStateStopped = "stopped"
+)
+
+// The RDS instance statuses that matter for starting and stopping
+const (
+	rdsStatusAvailable = "available"
+	rdsStatusStopping  = "stopping"
+	rdsStatusStopped   = "stopped"
+)
+
+// rdsStatusPollInterval is how often the status of an instance is checked while waiting
+// for it to stop
+const rdsStatusPollInterval = 30 * time.Second
+
+// reconcileRDSInstanceState starts or stops an instance to match its desired_state. An
+// instance that is busy, for example still being created, is waited for when waiting is
+// requested, and otherwise left for a later run with a warning.
+func (b *Bootstrapper) reconcileRDSInstanceState(ctx context.Context, instance RDSInstance, res *ResourceResult) error {
+	status, err := b.rdsInstanceStatus(ctx, instance.Identifier)
+	if err != nil {
+		return err
+	}
+
+	switch instance.DesiredState {
+	case rdsStateStopped:
+		switch status {
+		case rdsStatusStopped:
+			logger.Info("RDS instance is already stopped", "instance", instance.Identifier)
+			return nil
+		case rdsStatusStopping:
+			if instance.WaitForAvailable {
+				return b.waitForRDSStatus(ctx, instance.Identifier, rdsStatusStopped)
+			}
+			return nil
+		case rdsStatusAvailable:
+		default:
+			if !instance.WaitForAvailable {
+				res.warnf("cannot stop RDS instance %s while it is %s; run again once it is available", instance.Identifier, status)
+				return nil
+			}
+			if err := b.waitForRDSInstance(ctx, instance.Identifier); err != nil {
+				return err
+			}
+		}
+
+		if _, err := b.rdsClient.StopDBInstance(ctx, &rds.StopDBInstanceInput{
+			DBInstanceIdentifier: aws.String(instance.Identifier),
+		}); err != nil {
+			return fmt.Errorf("failed to stop RDS instance %s: %w", instance.Identifier, err)
+		}
+		res.updated()
+		logger.Info("Stopping RDS instance", "instance", instance.Identifier)
+		res.warnf("RDS instance %s was stopped; RDS starts it again automatically after 7 days, so run again to keep it stopped", instance.Identifier)
+		if instance.WaitForAvailable {
+			return b.waitForRDSStatus(ctx, instance.Identifier, rdsStatusStopped)
+		}
+
+	case rdsStateRunning:
+		switch status {
+		case rdsStatusStopped:
+		case rdsStatusStopping:
+			if !instance.WaitForAvailable {
+				res.warnf("cannot start RDS instance %s while it is stopping; run again once it has stopped", instance.Identifier)
+				return nil
+			}
+			if err := b.waitForRDSStatus(ctx, instance.Identifier, rdsStatusStopped); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		if _, err := b.rdsClient.StartDBInstance(ctx, &rds.StartDBInstanceInput{
+			DBInstanceIdentifier: aws.String(instance.Identifier),
+		}); err != nil {
+			return fmt.Errorf("failed to start RDS instance %s: %w", instance.Identifier, err)
+		}
+		res.updated()
+		logger.Info("Starting RDS instance", "instance", instance.Identifier)
+	}
+	return nil
+}
+
+// rdsInstanceStatus returns the current status of an instance, such as available or stopped
+func (b *Bootstrapper) rdsInstanceStatus(ctx context.Context, identifier string) (string, error) {
+	output, err := b.rdsClient.DescribeDBInstances(ctx, &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: aws.String(identifier),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error checking status of RDS instance %s: %w", identifier, err)
+	}
+	if len(output.DBInstances) == 0 {
+		return "", fmt.Errorf("RDS instance %s not found", identifier)
+	}
+	return aws.ToString(output.DBInstances[0].DBInstanceStatus), nil
+}
+
+// waitForRDSStatus polls until the instance has the status. The SDK has no waiter for
+// stopped instances. The wait is bounded by rdsWaitTimeout and by the context deadline,
+// whichever comes first.
+func (b *Bootstrapper) waitForRDSStatus(ctx context.Context, identifier, status string) error {
+	logger.Info("Waiting for RDS instance", "instance", identifier, "status", status)
+	task := startProgress("RDS "+identifier, "waiting")
+	defer task.done()
+
+	ctx, cancel := context.WithTimeout(ctx, rdsWaitTimeout)
+	defer cancel()
+	for {
+		current, err := b.rdsInstanceStatus(ctx, identifier)
+		if err != nil {
+			return fmt.Errorf("failed waiting for RDS instance %s to be %s: %w", identifier, status, err)
+		}
+		task.update(current)
+		if current == status {
+			logger.Info("RDS instance reached status", "instance", identifier, "status", status)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed waiting for RDS instance %s to be %s, it is %s: %w", identifier, status, current, ctx.Err())
+		case <-time.After(rdsStatusPollInterval):
+		}
+	}
+}
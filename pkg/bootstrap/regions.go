@@ -0,0 +1,118 @@
+package bootstrap
+
+import "fmt"
+
+// knownRegions lists the AWS regions resources can be provisioned in. A region that
+// matches the naming pattern but is not listed here is most likely a typo.
+var knownRegions = map[string]bool{
+	// Commercial regions
+	"af-south-1":     true,
+	"ap-east-1":      true,
+	"ap-east-2":      true,
+	"ap-northeast-1": true,
+	"ap-northeast-2": true,
+	"ap-northeast-3": true,
+	"ap-south-1":     true,
+	"ap-south-2":     true,
+	"ap-southeast-1": true,
+	"ap-southeast-2": true,
+	"ap-southeast-3": true,
+	"ap-southeast-4": true,
+	"ap-southeast-5": true,
+	"ap-southeast-6": true,
+	"ap-southeast-7": true,
+	"ca-central-1":   true,
+	"ca-west-1":      true,
+	"eu-central-1":   true,
+	"eu-central-2":   true,
+	"eu-north-1":     true,
+	"eu-south-1":     true,
+	"eu-south-2":     true,
+	"eu-west-1":      true,
+	"eu-west-2":      true,
+	"eu-west-3":      true,
+	"il-central-1":   true,
+	"me-central-1":   true,
+	"me-south-1":     true,
+	"mx-central-1":   true,
+	"sa-east-1":      true,
+	"us-east-1":      true,
+	"us-east-2":      true,
+	"us-west-1":      true,
+	"us-west-2":      true,
+
+	// China regions
+	"cn-north-1":     true,
+	"cn-northwest-1": true,
+
+	// GovCloud regions
+	"us-gov-east-1": true,
+	"us-gov-west-1": true,
+}
+
+// validateRegion checks that region is a known AWS region identifier
+func validateRegion(region string) error {
+	switch {
+	case region == "":
+		return fmt.Errorf("is required")
+	case !regionPattern.MatchString(region):
+		return fmt.Errorf("%q is not a valid AWS region name", region)
+	case !knownRegions[region]:
+		return fmt.Errorf("%q is not a known AWS region", region)
+	}
+	return nil
+}
+
+// checkSessionRegion fails when the config targets a different region than the AWS
+// session the bootstrapper was created with, so resources never land in the wrong region
+func (b *Bootstrapper) checkSessionRegion(config *Config) error {
+	if b.awsConfig.Region == "" {
+		return fmt.Errorf("the AWS session has no region; set region in the configuration")
+	}
+	if config.Region != b.awsConfig.Region {
+		return fmt.Errorf("configured region %s does not match the AWS session region %s", config.Region, b.awsConfig.Region)
+	}
+	return nil
+}
+
+// SetRegionClients makes the bootstrapper use the given service clients for the resources
+// whose region is set to region, instead of building clients for it. This is mainly useful
+// for tests.
+func (b *Bootstrapper) SetRegionClients(region string, clients Clients) {
+	regional := clients.serviceClients(region)
+	if regional.account == "" {
+		regional.account = b.serviceClients.account
+	}
+	b.regional[region] = regional
+}
+
+// inRegion runs fn with clients for region, switching back afterwards. The clients are
+// built from the credentials of the current clients, the session's or a role's, the first
+// time the region is needed. An empty region runs fn with the current clients.
+func (b *Bootstrapper) inRegion(region string, fn func() error) error {
+	if region == "" || region == b.awsConfig.Region {
+		return fn()
+	}
+	clients, ok := b.regional[region]
+	if !ok {
+		cfg := b.awsConfig.Copy()
+		cfg.Region = region
+		clients = newServiceClients(cfg)
+		clients.account = b.serviceClients.account
+		b.regional[region] = clients
+	}
+
+	current := b.serviceClients
+	b.serviceClients = clients
+	defer func() { b.serviceClients = current }()
+	return fn()
+}
+
+// warnCrossRegion warns that the resource of res is provisioned away from the config region
+func (b *Bootstrapper) warnCrossRegion(region string, res *ResourceResult) {
+	if region == "" || region == b.awsConfig.Region {
+		return
+	}
+	res.warnf("%s %s is in %s rather than %s; access from %s crosses regions, which adds latency and inter-region data transfer charges",
+		res.Type, res.Name, region, b.awsConfig.Region, b.awsConfig.Region)
+}
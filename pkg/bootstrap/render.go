@@ -0,0 +1,58 @@
+package bootstrap
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values in a rendered configuration
+const redacted = "REDACTED"
+
+// Render returns the configuration as YAML the way provisioning sees it: after environment
+// variables are expanded and files are merged, which the loaders do, and with the global
+// tags merged into every resource. Passwords are replaced with REDACTED unless showSecrets
+// is set. The receiver is not modified.
+func (c *Config) Render(showSecrets bool) ([]byte, error) {
+	rendered := *c.withGlobalTags()
+	if !showSecrets {
+		rendered.redactSecrets()
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&rendered); err != nil {
+		return nil, fmt.Errorf("failed to render configuration: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to render configuration: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// redactSecrets replaces the passwords in c, copying the resources that hold them first so
+// that the config c was copied from keeps its values
+func (c *Config) redactSecrets() {
+	c.IAMUsers = append([]IAMUser(nil), c.IAMUsers...)
+	for i, user := range c.IAMUsers {
+		if user.ConsoleAccess != nil && user.ConsoleAccess.Password != "" {
+			access := *user.ConsoleAccess
+			access.Password = redacted
+			c.IAMUsers[i].ConsoleAccess = &access
+		}
+	}
+	c.RDSInstances = append([]RDSInstance(nil), c.RDSInstances...)
+	for i := range c.RDSInstances {
+		if c.RDSInstances[i].MasterPassword != "" {
+			c.RDSInstances[i].MasterPassword = redacted
+		}
+	}
+	c.AuroraClusters = append([]AuroraCluster(nil), c.AuroraClusters...)
+	for i := range c.AuroraClusters {
+		if c.AuroraClusters[i].MasterPassword != "" {
+			c.AuroraClusters[i].MasterPassword = redacted
+		}
+	}
+}
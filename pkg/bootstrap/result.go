@@ -0,0 +1,391 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Resource types reported in provisioning results
+const (
+	ResourceTypeS3  = "s3"
+	ResourceTypeECR = "ecr"
+	ResourceTypeIAM = "iam"
+	ResourceTypeRDS = "rds"
+
+	ResourceTypeIAMGroup = "iam_group"
+	ResourceTypeAurora   = "aurora"
+
+	ResourceTypeHostedZone  = "hosted_zone"
+	ResourceTypeCertificate = "certificate"
+	ResourceTypeLambda      = "lambda"
+	ResourceTypeVPC         = "vpc"
+
+	ResourceTypeKeyPair       = "key_pair"
+	ResourceTypeSecurityGroup = "security_group"
+
+	ResourceTypeEventBridgeRule = "eventbridge_rule"
+
+	ResourceTypePasswordPolicy = "password_policy"
+)
+
+// ResourceAction describes what provisioning did to a resource
+type ResourceAction string
+
+const (
+	// ActionCreated means the resource did not exist and was created
+	ActionCreated ResourceAction = "created"
+	// ActionUpdated means the resource already existed and its configuration was written
+	ActionUpdated ResourceAction = "updated"
+	// ActionUnchanged means the resource already existed and nothing was written
+	ActionUnchanged ResourceAction = "unchanged"
+	// ActionFailed means provisioning the resource returned an error
+	ActionFailed ResourceAction = "failed"
+	// ActionRolledBack means the resource was created by this run and deleted again after
+	// provisioning failed
+	ActionRolledBack ResourceAction = "rolled_back"
+)
+
+// ResourceResult records the outcome of provisioning a single resource
+type ResourceResult struct {
+	Type     string
+	Name     string
+	Action   ResourceAction
+	Error    error
+	Warnings []Warning
+	// ARN identifies the resource in AWS; it is empty when the resource was never found or created
+	ARN string
+	// PolicyARNs maps the name of each managed policy attached to an IAM user or group to its ARN
+	PolicyARNs map[string]string
+	// SubnetIDs maps the name of each subnet of a VPC to its ID
+	SubnetIDs map[string]string
+	// AccessPoints are the access points of an S3 bucket
+	AccessPoints []AccessPointResult
+	// Simulations are the policy simulation checks run for an IAM user
+	Simulations []SimulationResult
+
+	// wasCreated stays set when a resource created by this run later fails, so that it can
+	// still be rolled back
+	wasCreated bool
+	// configHash is the hash of the configuration the resource was provisioned from
+	configHash string
+}
+
+// ProvisionResult records the outcome of every resource touched by ProvisionResources
+type ProvisionResult struct {
+	Resources []ResourceResult
+	// Skipped counts the resources left out in incremental mode because their
+	// configuration is unchanged since the last successful apply
+	Skipped int
+}
+
+// Failed returns the resources that failed to provision
+func (r *ProvisionResult) Failed() []ResourceResult {
+	var failed []ResourceResult
+	for _, res := range r.Resources {
+		if res.Action == ActionFailed {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// Print writes one status line per resource
+func (r *ProvisionResult) Print() {
+	for _, res := range r.Resources {
+		fmt.Println(res.String())
+	}
+}
+
+// ResultSummary counts the outcomes of the resources of one type
+type ResultSummary struct {
+	Type       string
+	Created    int
+	Updated    int
+	Unchanged  int
+	Failed     int
+	RolledBack int
+	// Warned counts resources with at least one warning, whatever their action
+	Warned int
+}
+
+// add counts one resource result
+func (s *ResultSummary) add(res ResourceResult) {
+	switch res.Action {
+	case ActionCreated:
+		s.Created++
+	case ActionUpdated:
+		s.Updated++
+	case ActionUnchanged:
+		s.Unchanged++
+	case ActionFailed:
+		s.Failed++
+	case ActionRolledBack:
+		s.RolledBack++
+	}
+	if len(res.Warnings) > 0 {
+		s.Warned++
+	}
+}
+
+// Summary returns the outcome counts per resource type, in the order the types were
+// provisioned, followed by the totals with Type "total"
+func (r *ProvisionResult) Summary() []ResultSummary {
+	var summaries []ResultSummary
+	index := make(map[string]int)
+	total := ResultSummary{Type: "total"}
+	for _, res := range r.Resources {
+		i, ok := index[res.Type]
+		if !ok {
+			i = len(summaries)
+			index[res.Type] = i
+			summaries = append(summaries, ResultSummary{Type: res.Type})
+		}
+		summaries[i].add(res)
+		total.add(res)
+	}
+	return append(summaries, total)
+}
+
+// PrintSummary writes a table of outcome counts per resource type, followed by every
+// warning so that none is lost among the progress logs
+func (r *ProvisionResult) PrintSummary(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "TYPE\tCREATED\tUPDATED\tUNCHANGED\tWARNED\tFAILED\tROLLED BACK")
+	for _, s := range r.Summary() {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%d\t%d\t%d\n", s.Type, s.Created, s.Updated, s.Unchanged, s.Warned, s.Failed, s.RolledBack)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	if r.Skipped > 0 {
+		if _, err := fmt.Fprintf(w, "Skipped %d resource(s) unchanged since the last apply\n", r.Skipped); err != nil {
+			return err
+		}
+	}
+
+	var simulations []string
+	for _, res := range r.Resources {
+		for _, sim := range res.Simulations {
+			simulations = append(simulations, fmt.Sprintf("  - %s %s: %s", res.Type, res.Name, sim))
+		}
+	}
+	if len(simulations) > 0 {
+		if _, err := fmt.Fprintf(w, "\nPolicy simulations (%d):\n", len(simulations)); err != nil {
+			return err
+		}
+		for _, line := range simulations {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+
+	var warnings []string
+	for _, res := range r.Resources {
+		for _, warning := range res.Warnings {
+			warnings = append(warnings, fmt.Sprintf("  - %s %s: %s", res.Type, res.Name, warning.Message))
+		}
+	}
+	if len(warnings) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "\nWarnings (%d):\n", len(warnings)); err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		if _, err := fmt.Fprintln(w, warning); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AccessPointResult identifies an S3 access point by its ARN and by the alias that can be
+// used in place of a bucket name
+type AccessPointResult struct {
+	Name  string `json:"name"`
+	ARN   string `json:"arn"`
+	Alias string `json:"alias"`
+}
+
+// resourceResultJSON is the JSON form of a ResourceResult
+type resourceResultJSON struct {
+	Type         string              `json:"type"`
+	Name         string              `json:"name"`
+	ARN          string              `json:"arn,omitempty"`
+	PolicyARNs   map[string]string   `json:"policy_arns,omitempty"`
+	SubnetIDs    map[string]string   `json:"subnet_ids,omitempty"`
+	AccessPoints []AccessPointResult `json:"access_points,omitempty"`
+	Simulations  []SimulationResult  `json:"simulations,omitempty"`
+	Action       ResourceAction      `json:"action"`
+	Error        string              `json:"error,omitempty"`
+	Warnings     []string            `json:"warnings,omitempty"`
+}
+
+// WriteJSON writes the results as a JSON document. runErr is the error returned by
+// ProvisionResources, if any, and is included so callers can see why provisioning stopped.
+func (r *ProvisionResult) WriteJSON(w io.Writer, runErr error) error {
+	doc := struct {
+		Resources []resourceResultJSON `json:"resources"`
+		Failed    int                  `json:"failed"`
+		Skipped   int                  `json:"skipped,omitempty"`
+		Error     string               `json:"error,omitempty"`
+	}{
+		Resources: make([]resourceResultJSON, 0, len(r.Resources)),
+		Failed:    len(r.Failed()),
+		Skipped:   r.Skipped,
+	}
+	for _, res := range r.Resources {
+		entry := resourceResultJSON{
+			Type:         res.Type,
+			Name:         res.Name,
+			ARN:          res.ARN,
+			PolicyARNs:   res.PolicyARNs,
+			SubnetIDs:    res.SubnetIDs,
+			AccessPoints: res.AccessPoints,
+			Simulations:  res.Simulations,
+			Action:       res.Action,
+			Warnings:     warningMessages(res.Warnings),
+		}
+		if res.Error != nil {
+			entry.Error = res.Error.Error()
+		}
+		doc.Resources = append(doc.Resources, entry)
+	}
+	if runErr != nil {
+		doc.Error = runErr.Error()
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// String formats the result as a single status line
+func (r ResourceResult) String() string {
+	switch {
+	case r.Action == ActionRolledBack:
+		return fmt.Sprintf("↩️ %s %s: rolled back", r.Type, r.Name)
+	case r.Action == ActionFailed:
+		return fmt.Sprintf("❌ %s %s: %s: %v", r.Type, r.Name, r.Action, r.Error)
+	case len(r.Warnings) > 0:
+		return fmt.Sprintf("⚠️ %s %s: %s with %d warning(s)", r.Type, r.Name, r.Action, len(r.Warnings))
+	default:
+		return fmt.Sprintf("✅ %s %s: %s", r.Type, r.Name, r.Action)
+	}
+}
+
+// newResourceResult starts tracking a resource that has not been changed yet
+func newResourceResult(resourceType, name string) *ResourceResult {
+	return &ResourceResult{
+		Type:   resourceType,
+		Name:   name,
+		Action: ActionUnchanged,
+	}
+}
+
+// created marks the resource as newly created
+func (r *ResourceResult) created() {
+	r.Action = ActionCreated
+	r.wasCreated = true
+}
+
+// WasCreated reports whether the resource was created by this run, even if provisioning it
+// failed afterwards
+func (r ResourceResult) WasCreated() bool {
+	return r.wasCreated
+}
+
+// updated marks an existing resource as updated; newly created resources stay created
+func (r *ResourceResult) updated() {
+	if r.Action == ActionUnchanged {
+		r.Action = ActionUpdated
+	}
+}
+
+// warnf records a non-fatal problem and logs it
+func (r *ResourceResult) warnf(format string, args ...any) {
+	warning := newWarning(r.Type, r.Name, format, args...)
+	r.Warnings = append(r.Warnings, warning)
+	logger.Warn(warning.Message, warning.logAttrs()...)
+}
+
+// recordPolicyARN remembers the ARN of a managed policy attached to the user or group
+func (r *ResourceResult) recordPolicyARN(name, arn string) {
+	if r.PolicyARNs == nil {
+		r.PolicyARNs = make(map[string]string)
+	}
+	r.PolicyARNs[name] = arn
+}
+
+// recordSubnetID remembers the ID of a subnet of the VPC
+func (r *ResourceResult) recordSubnetID(name, id string) {
+	if r.SubnetIDs == nil {
+		r.SubnetIDs = make(map[string]string)
+	}
+	r.SubnetIDs[name] = id
+}
+
+// finish records a fatal error, if any, and returns the final result
+func (r *ResourceResult) finish(err error) ResourceResult {
+	if err != nil {
+		r.Action = ActionFailed
+		r.Error = err
+	}
+	return *r
+}
+
+// ResourceTypeIAMPolicy is the key under which ARNs groups managed policies, named
+// "<user or group>/<policy>" since policy names in the config are only unique per owner
+const ResourceTypeIAMPolicy = "iam_policy"
+
+// ARNs returns the ARN of every provisioned resource, keyed by resource type and then by
+// name. Resources without an ARN, such as those that failed before they were found, are left out.
+func (r *ProvisionResult) ARNs() map[string]map[string]string {
+	arns := make(map[string]map[string]string)
+	add := func(resourceType, name, arn string) {
+		if arn == "" {
+			return
+		}
+		if arns[resourceType] == nil {
+			arns[resourceType] = make(map[string]string)
+		}
+		arns[resourceType][name] = arn
+	}
+
+	for _, res := range r.Resources {
+		add(res.Type, res.Name, res.ARN)
+		for policy, arn := range res.PolicyARNs {
+			add(ResourceTypeIAMPolicy, res.Name+"/"+policy, arn)
+		}
+	}
+	return arns
+}
+
+// WriteARNs writes the ARNs of the provisioned resources to path, as JSON when the path
+// ends in .json and as YAML otherwise
+func (r *ProvisionResult) WriteARNs(path string) error {
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err = json.MarshalIndent(r.ARNs(), "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(r.ARNs())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode ARNs: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write ARNs file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// accountIDPattern matches 12-digit AWS account IDs
+var accountIDPattern = regexp.MustCompile(`^\d{12}$`)
+
+// roleARN returns the ARN of the role, building it from the account and role name in the
+// partition of region when no ARN is set
+func (r ResourceRole) roleARN(region string) string {
+	if r.AssumeRoleARN != "" {
+		return r.AssumeRoleARN
+	}
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", partitionForRegion(region), r.Account, r.RoleName)
+}
+
+// arnAccount returns the account ID of an ARN, or "" when the ARN has none
+func arnAccount(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[4]
+}
+
+// validate checks that the role names exactly one role and that its account is consistent
+func (r ResourceRole) validate(v *validator, path, region string) {
+	switch {
+	case r.AssumeRoleARN != "" && r.RoleName != "":
+		v.addf(path, "only one of assume_role_arn or role_name may be set")
+		return
+	case r.AssumeRoleARN == "" && (r.Account == "" || r.RoleName == ""):
+		v.addf(path, "assume_role_arn or both account and role_name are required")
+		return
+	}
+	if r.Account != "" && !accountIDPattern.MatchString(r.Account) {
+		v.addf(path+".account", "must be a 12-digit account ID, got %q", r.Account)
+		return
+	}
+
+	if err := validateRoleARN(r.roleARN(region)); err != nil {
+		v.addf(path, "%v", err)
+		return
+	}
+	if r.Account != "" && arnAccount(r.AssumeRoleARN) != "" && arnAccount(r.AssumeRoleARN) != r.Account {
+		v.addf(path, "assume_role_arn is in account %s, not %s", arnAccount(r.AssumeRoleARN), r.Account)
+	}
+}
+
+// validateResourceRoles checks the keys and roles of resource_roles
+func (c *Config) validateResourceRoles(v *validator) {
+	for _, key := range slices.Sorted(maps.Keys(c.ResourceRoles)) {
+		path := "resource_roles." + key
+		if _, ok := filterTypes[key]; !ok {
+			v.addf(path, "unknown resource type %q", key)
+			continue
+		}
+		c.ResourceRoles[key].validate(v, path, c.Region)
+	}
+}
+
+// resourceRole returns the role the resources of the type are provisioned with, if any. A
+// key that selects only this type wins over one that selects several, such as iam.
+func (c *Config) resourceRole(resourceType string) (ResourceRole, bool) {
+	var found ResourceRole
+	ok := false
+	for key, role := range c.ResourceRoles {
+		types := filterTypes[key]
+		if !slices.Contains(types, resourceType) {
+			continue
+		}
+		if len(types) == 1 {
+			return role, true
+		}
+		found, ok = role, true
+	}
+	return found, ok
+}
+
+// SetRoleClients makes the bootstrapper use the given service clients for the resources
+// provisioned with a role in resource_roles, instead of assuming the role. This is mainly
+// useful for tests.
+func (b *Bootstrapper) SetRoleClients(roleARN string, clients Clients) {
+	if b.roleClients == nil {
+		b.roleClients = make(map[string]serviceClients)
+	}
+	roleSession := clients.serviceClients(b.awsConfig.Region)
+	if roleSession.account == "" {
+		roleSession.account = arnAccount(roleARN)
+	}
+	b.roleClients[roleARN] = roleSession
+}
+
+// clientsForRole returns the clients of a role, assuming it with the session's credentials
+// the first time it is needed. The credentials are retrieved right away, so a role that
+// cannot be assumed fails before any of its resources are touched.
+func (b *Bootstrapper) clientsForRole(ctx context.Context, region string, role ResourceRole) (serviceClients, error) {
+	roleARN := role.roleARN(region)
+	if clients, ok := b.roleClients[roleARN]; ok {
+		return clients, nil
+	}
+
+	sessionName := role.RoleSessionName
+	if sessionName == "" {
+		sessionName = defaultRoleSessionName
+	}
+	cfg := b.awsConfig.Copy()
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(b.awsConfig), roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = sessionName
+		if role.ExternalID != "" {
+			o.ExternalID = aws.String(role.ExternalID)
+		}
+	})
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return serviceClients{}, fmt.Errorf("failed to assume role %s: %w", roleARN, wrapCredentialError(err))
+	}
+	logger.Info("Assumed role", "role", roleARN)
+
+	clients := newServiceClients(cfg)
+	clients.account = arnAccount(roleARN)
+	if b.roleClients == nil {
+		b.roleClients = make(map[string]serviceClients)
+	}
+	b.roleClients[roleARN] = clients
+	return clients, nil
+}
+
+// withResourceRole runs fn with the clients of the role the config sets for the resource
+// type, switching back to the session's own clients afterwards. Without a role fn runs
+// with the session's clients.
+func (b *Bootstrapper) withResourceRole(ctx context.Context, config *Config, resourceType string, fn func() error) error {
+	role, ok := config.resourceRole(resourceType)
+	if !ok {
+		return fn()
+	}
+	clients, err := b.clientsForRole(ctx, config.Region, role)
+	if err != nil {
+		return err
+	}
+
+	session := b.serviceClients
+	b.serviceClients = clients
+	defer func() { b.serviceClients = session }()
+	return fn()
+}
+
+// crossAccountReasons explains why a reference from one resource type to another needs
+// both resources in the same account
+var crossAccountReasons = map[[2]string]string{
+	{ResourceTypeIAM, ResourceTypeIAMGroup}:           "users can only join groups in their own account",
+	{ResourceTypeCertificate, ResourceTypeHostedZone}: "validation records are written with the certificate's credentials",
+	{ResourceTypeLambda, ResourceTypeECR}:             "the image repository is looked up with the function's credentials",
+	{ResourceTypeLambda, ResourceTypeVPC}:             "subnets are looked up with the function's credentials",
+	{ResourceTypeRDS, ResourceTypeVPC}:                "subnets are looked up with the instance's credentials",
+	{ResourceTypeSecurityGroup, ResourceTypeVPC}:      "the VPC is looked up with the security group's credentials",
+	{ResourceTypeEventBridgeRule, ResourceTypeLambda}: "target functions are looked up and given invoke permission with the rule's credentials",
+}
+
+// CrossAccountWarnings describes every reference that crosses accounts because of
+// resource_roles: references between resources in the config, and ARNs of notification
+// destinations and roles outside it. baseAccount is the account of the session's own
+// credentials; types without a role are only compared when it is known.
+func (c *Config) CrossAccountWarnings(baseAccount string) []string {
+	if len(c.ResourceRoles) == 0 {
+		return nil
+	}
+	accountOf := func(resourceType string) string {
+		if role, ok := c.resourceRole(resourceType); ok {
+			return arnAccount(role.roleARN(c.Region))
+		}
+		return baseAccount
+	}
+	differ := func(a, b string) bool {
+		return a != "" && b != "" && a != b
+	}
+
+	var warnings []string
+	g := c.dependencyGraph()
+	for _, from := range g.nodes {
+		for _, to := range g.deps[from] {
+			reason, ok := crossAccountReasons[[2]string{from.Type, to.Type}]
+			if !ok {
+				continue
+			}
+			if fromAccount, toAccount := accountOf(from.Type), accountOf(to.Type); differ(fromAccount, toAccount) {
+				warnings = append(warnings, fmt.Sprintf("%s in account %s references %s in account %s: %s",
+					from, fromAccount, to, toAccount, reason))
+			}
+		}
+	}
+
+	s3Account := accountOf(ResourceTypeS3)
+	for _, bucket := range c.S3Buckets {
+		for _, notification := range bucket.Notifications {
+			for _, destination := range []string{notification.Topic, notification.Queue, notification.LambdaFunction} {
+				if account := arnAccount(destination); differ(s3Account, account) {
+					warnings = append(warnings, fmt.Sprintf("S3 bucket %s in account %s notifies %s in account %s: its policy must allow the bucket to publish to it",
+						bucket.Name, s3Account, destination, account))
+				}
+			}
+		}
+		if bucket.Replication != nil {
+			if account := arnAccount(bucket.Replication.Role); differ(s3Account, account) {
+				warnings = append(warnings, fmt.Sprintf("S3 bucket %s in account %s replicates with role %s in account %s: the role must be in the bucket's account",
+					bucket.Name, s3Account, bucket.Replication.Role, account))
+			}
+		}
+	}
+
+	lambdaAccount := accountOf(ResourceTypeLambda)
+	for _, function := range c.LambdaFunctions {
+		if account := arnAccount(function.Role); differ(lambdaAccount, account) {
+			warnings = append(warnings, fmt.Sprintf("Lambda function %s in account %s uses execution role %s in account %s: the role must be in the function's account",
+				function.Name, lambdaAccount, function.Role, account))
+		}
+	}
+	return warnings
+}
+
+// warnCrossAccount logs the cross-account references of the config
+func (b *Bootstrapper) warnCrossAccount(config *Config) {
+	for _, warning := range config.CrossAccountWarnings(b.account) {
+		logger.Warn("Cross-account reference", "warning", warning)
+	}
+}
@@ -0,0 +1,80 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+)
+
+// CreatedConfig returns a config holding the entries of config for every resource that was
+// created by the run, including ones that failed after they were created. Resources that
+// already existed are left out, and so are types DestroyResources does not delete.
+func (r *ProvisionResult) CreatedConfig(config *Config) *Config {
+	created := make(map[string]bool)
+	for _, res := range r.Resources {
+		if res.wasCreated {
+			created[stateKey(res.Type, res.Name)] = true
+		}
+	}
+
+	result := &Config{Region: config.Region, ResourceRoles: config.ResourceRoles}
+	for _, bucket := range config.S3Buckets {
+		if created[stateKey(ResourceTypeS3, bucket.Name)] {
+			result.S3Buckets = append(result.S3Buckets, bucket)
+		}
+	}
+	for _, repo := range config.ECRRepositories {
+		if created[stateKey(ResourceTypeECR, repo.Name)] {
+			result.ECRRepositories = append(result.ECRRepositories, repo)
+		}
+	}
+	for _, group := range config.IAMGroups {
+		if created[stateKey(ResourceTypeIAMGroup, group.Name)] {
+			result.IAMGroups = append(result.IAMGroups, group)
+		}
+	}
+	for _, user := range config.IAMUsers {
+		if created[stateKey(ResourceTypeIAM, user.Name)] {
+			result.IAMUsers = append(result.IAMUsers, user)
+		}
+	}
+	for _, instance := range config.RDSInstances {
+		if created[stateKey(ResourceTypeRDS, instance.Identifier)] {
+			// A database created moments ago holds no data worth a snapshot, nor worth
+			// protecting from deletion
+			instance.SkipFinalSnapshot = true
+			instance.removeProtection = instance.DeletionProtection
+			result.RDSInstances = append(result.RDSInstances, instance)
+		}
+	}
+	return result
+}
+
+// Rollback deletes the resources created by a failed run, in the reverse of the
+// provisioning order, marks them as rolled back in result and returns the config of what
+// was rolled back. Resources that existed before the run are never touched. Created
+// resources of types DestroyResources does not delete are left in place with a warning.
+func (b *Bootstrapper) Rollback(ctx context.Context, result *ProvisionResult, config *Config) (*Config, error) {
+	rollback := result.CreatedConfig(config)
+	for i := range result.Resources {
+		res := &result.Resources[i]
+		if _, ok := destroyedTypes[res.Type]; res.wasCreated && !ok {
+			res.warnf("%s %s was created by this run but cannot be rolled back; delete it by hand if it is not wanted", res.Type, res.Name)
+		}
+	}
+	if rollback.Empty() {
+		logger.Info("Nothing to roll back")
+		return rollback, nil
+	}
+
+	logger.Warn("Rolling back resources created by this run")
+	if err := b.DestroyResources(ctx, rollback); err != nil {
+		return rollback, fmt.Errorf("rollback failed: %w", err)
+	}
+
+	for i := range result.Resources {
+		if _, ok := destroyedTypes[result.Resources[i].Type]; ok && result.Resources[i].wasCreated {
+			result.Resources[i].Action = ActionRolledBack
+		}
+	}
+	return rollback, nil
+}
@@ -0,0 +1,272 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	r53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// defaultRecordTTL is the TTL of records that do not set one
+const defaultRecordTTL = 300
+
+// s3WebsiteEndpoint is the DNS name and Route53 hosted zone ID of a region's S3 website endpoint
+type s3WebsiteEndpoint struct {
+	domain string
+	zoneID string
+}
+
+// s3WebsiteEndpoints lists the S3 website endpoints that aliases to buckets resolve to.
+// Older regions use a dash between s3-website and the region, newer ones a dot.
+var s3WebsiteEndpoints = map[string]s3WebsiteEndpoint{
+	"us-east-1":      {"s3-website-us-east-1.amazonaws.com", "Z3AQBSTGFYJSTF"},
+	"us-east-2":      {"s3-website.us-east-2.amazonaws.com", "Z2O1EMRO9K5GLX"},
+	"us-west-1":      {"s3-website-us-west-1.amazonaws.com", "Z2F56UZL2M1ACD"},
+	"us-west-2":      {"s3-website-us-west-2.amazonaws.com", "Z3BJ6K6RIION7M"},
+	"ca-central-1":   {"s3-website.ca-central-1.amazonaws.com", "Z1QDHH18159H29"},
+	"eu-west-1":      {"s3-website-eu-west-1.amazonaws.com", "Z1BKCTXD74EZPE"},
+	"eu-west-2":      {"s3-website.eu-west-2.amazonaws.com", "Z3GKZC51ZF0DB4"},
+	"eu-west-3":      {"s3-website.eu-west-3.amazonaws.com", "Z3R1K369G5AVDG"},
+	"eu-central-1":   {"s3-website.eu-central-1.amazonaws.com", "Z21DNDUVLTQW6Q"},
+	"eu-north-1":     {"s3-website.eu-north-1.amazonaws.com", "Z3BAZG2TWCNX0D"},
+	"ap-south-1":     {"s3-website.ap-south-1.amazonaws.com", "Z11RGJOFQNVJUP"},
+	"ap-northeast-1": {"s3-website-ap-northeast-1.amazonaws.com", "Z2M4EHUR26P7ZW"},
+	"ap-northeast-2": {"s3-website.ap-northeast-2.amazonaws.com", "Z3W03O7B5YMIYP"},
+	"ap-southeast-1": {"s3-website-ap-southeast-1.amazonaws.com", "Z3O0J2DXBE1FTB"},
+	"ap-southeast-2": {"s3-website-ap-southeast-2.amazonaws.com", "Z1WCIGYICN2BYD"},
+	"sa-east-1":      {"s3-website-sa-east-1.amazonaws.com", "Z7KQH4QJS55SO"},
+}
+
+// CreateHostedZones creates Route53 hosted zones based on the configuration and upserts
+// their records
+func (b *Bootstrapper) CreateHostedZones(ctx context.Context, zones []HostedZone) ([]ResourceResult, error) {
+	var results []ResourceResult
+	for _, zone := range zones {
+		// Stop before starting the next resource if the run was cancelled or timed out
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+
+		res := newResourceResult(ResourceTypeHostedZone, zone.Name)
+		err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+			return b.ensureHostedZone(ctx, zone, res)
+		})
+		results = append(results, res.finish(err))
+		if err != nil && !b.tolerate(err) {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// ensureHostedZone creates a single hosted zone if no zone with its name exists and
+// upserts its records
+func (b *Bootstrapper) ensureHostedZone(ctx context.Context, zone HostedZone, res *ResourceResult) error {
+	logger.Info("Ensuring hosted zone", "zone", zone.Name)
+
+	// Resolve the records before touching the zone so a bad config fails cleanly
+	changes, err := b.buildRecordChanges(zone)
+	if err != nil {
+		return fmt.Errorf("invalid records for hosted zone %s: %w", zone.Name, err)
+	}
+
+	zoneID, err := b.findHostedZone(ctx, zone, res)
+	if err != nil {
+		return fmt.Errorf("failed to look up hosted zone %s: %w", zone.Name, err)
+	}
+
+	if zoneID == "" {
+		input := &route53.CreateHostedZoneInput{
+			Name:            aws.String(zone.Name),
+			CallerReference: aws.String(fmt.Sprintf("cloud-bootstrap-%s-%d", zone.Name, time.Now().UnixNano())),
+			HostedZoneConfig: &r53types.HostedZoneConfig{
+				PrivateZone: zone.Private,
+			},
+		}
+		if zone.Comment != "" {
+			input.HostedZoneConfig.Comment = aws.String(zone.Comment)
+		}
+		if zone.Private {
+			region := zone.VPCRegion
+			if region == "" {
+				region = b.awsConfig.Region
+			}
+			input.VPC = &r53types.VPC{
+				VPCId:     aws.String(zone.VPCID),
+				VPCRegion: r53types.VPCRegion(region),
+			}
+		}
+
+		output, err := b.route53Client.CreateHostedZone(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to create hosted zone %s: %w", zone.Name, err)
+		}
+		if output.HostedZone != nil {
+			zoneID = hostedZoneID(aws.ToString(output.HostedZone.Id))
+		}
+		res.created()
+		logger.Info("Created hosted zone", "zone", zone.Name, "id", zoneID)
+	} else {
+		logger.Info("Hosted zone already exists", "zone", zone.Name, "id", zoneID)
+	}
+	res.ARN = fmt.Sprintf("arn:%s:route53:::hostedzone/%s", partitionForRegion(b.awsConfig.Region), zoneID)
+	if zone.IfNotExists && res.Action != ActionCreated {
+		leaveExisting(res)
+		return nil
+	}
+
+	// UPSERT creates missing records and overwrites existing ones, so every run converges
+	if len(changes) > 0 {
+		_, err = b.route53Client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(zoneID),
+			ChangeBatch:  &r53types.ChangeBatch{Changes: changes},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update records in hosted zone %s: %w", zone.Name, err)
+		}
+		res.updated()
+		logger.Info("Upserted hosted zone records", "zone", zone.Name, "records", len(changes))
+	}
+
+	return nil
+}
+
+// findHostedZone returns the ID of the existing zone with the zone's name and visibility,
+// or "" if there is none. Several matching zones are reported and the first one is used, so
+// a domain never gains yet another duplicate zone.
+func (b *Bootstrapper) findHostedZone(ctx context.Context, zone HostedZone, res *ResourceResult) (string, error) {
+	name := fqdn(zone.Name)
+	var matches []string
+
+	input := &route53.ListHostedZonesByNameInput{DNSName: aws.String(name)}
+	for {
+		output, err := b.route53Client.ListHostedZonesByName(ctx, input)
+		if err != nil {
+			return "", err
+		}
+		// Zones are listed in name order starting at the requested name, so the matches
+		// come first
+		done := false
+		for _, hz := range output.HostedZones {
+			if !strings.EqualFold(aws.ToString(hz.Name), name) {
+				done = true
+				break
+			}
+			private := hz.Config != nil && hz.Config.PrivateZone
+			if private == zone.Private {
+				matches = append(matches, hostedZoneID(aws.ToString(hz.Id)))
+			}
+		}
+		if done || !output.IsTruncated || !strings.EqualFold(aws.ToString(output.NextDNSName), name) {
+			break
+		}
+		input.DNSName = output.NextDNSName
+		input.HostedZoneId = output.NextHostedZoneId
+	}
+
+	if len(matches) == 0 {
+		return "", nil
+	}
+	if len(matches) > 1 {
+		res.warnf("found %d hosted zones named %s, using %s", len(matches), zone.Name, matches[0])
+	}
+	return matches[0], nil
+}
+
+// buildRecordChanges returns an UPSERT change for every record of the zone
+func (b *Bootstrapper) buildRecordChanges(zone HostedZone) ([]r53types.Change, error) {
+	var changes []r53types.Change
+	for _, record := range zone.Records {
+		recordSet := &r53types.ResourceRecordSet{
+			Name: aws.String(qualifyRecordName(record.Name, zone.Name)),
+			Type: r53types.RRType(strings.ToUpper(record.Type)),
+		}
+
+		if record.Alias != nil {
+			target, err := b.resolveAlias(*record.Alias)
+			if err != nil {
+				return nil, fmt.Errorf("record %s: %w", aws.ToString(recordSet.Name), err)
+			}
+			recordSet.AliasTarget = target
+		} else {
+			ttl := record.TTL
+			if ttl == 0 {
+				ttl = defaultRecordTTL
+			}
+			recordSet.TTL = aws.Int64(ttl)
+			for _, value := range record.Values {
+				recordSet.ResourceRecords = append(recordSet.ResourceRecords, r53types.ResourceRecord{
+					Value: aws.String(recordValue(recordSet.Type, value)),
+				})
+			}
+		}
+
+		changes = append(changes, r53types.Change{
+			Action:            r53types.ChangeActionUpsert,
+			ResourceRecordSet: recordSet,
+		})
+	}
+	return changes, nil
+}
+
+// resolveAlias returns the alias target of a record, resolving bucket references to the
+// S3 website endpoint of the region the buckets are created in
+func (b *Bootstrapper) resolveAlias(alias DNSAlias) (*r53types.AliasTarget, error) {
+	target := &r53types.AliasTarget{
+		DNSName:              aws.String(alias.DNSName),
+		HostedZoneId:         aws.String(alias.HostedZoneID),
+		EvaluateTargetHealth: alias.EvaluateTargetHealth,
+	}
+	if alias.S3Website != "" {
+		endpoint, ok := s3WebsiteEndpoints[b.awsConfig.Region]
+		if !ok {
+			return nil, fmt.Errorf("no known S3 website endpoint in region %s for bucket %s; set dns_name and hosted_zone_id instead", b.awsConfig.Region, alias.S3Website)
+		}
+		target.DNSName = aws.String(endpoint.domain)
+		target.HostedZoneId = aws.String(endpoint.zoneID)
+	}
+	return target, nil
+}
+
+// qualifyRecordName returns the fully qualified name of a record in zone. Names ending in a
+// dot are already fully qualified; an empty name or "@" is the zone apex.
+func qualifyRecordName(name, zone string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	zone = strings.TrimSuffix(zone, ".")
+	if name == "" || name == "@" {
+		return zone + "."
+	}
+	if strings.EqualFold(name, zone) || strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(zone)) {
+		return name + "."
+	}
+	return name + "." + zone + "."
+}
+
+// recordValue quotes TXT and SPF values, which Route53 requires to be enclosed in double
+// quotes, unless the value is quoted already
+func recordValue(recordType r53types.RRType, value string) string {
+	if (recordType == r53types.RRTypeTxt || recordType == r53types.RRTypeSpf) && !strings.HasPrefix(value, `"`) {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+	return value
+}
+
+// fqdn adds the trailing dot Route53 uses in zone names
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// hostedZoneID strips the /hostedzone/ prefix Route53 puts on zone IDs it returns
+func hostedZoneID(id string) string {
+	return strings.TrimPrefix(id, "/hostedzone/")
+}
@@ -0,0 +1,792 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// bucketOwnership describes whether a bucket name is free, ours, or taken by someone else
+type bucketOwnership int
+
+const (
+	bucketMissing bucketOwnership = iota
+	bucketOwned
+	bucketForeign
+)
+
+// CreateS3Buckets creates S3 buckets based on the configuration. Every bucket name is
+// checked before anything is created so all name collisions are reported at once.
+func (b *Bootstrapper) CreateS3Buckets(ctx context.Context, buckets []S3Bucket) ([]ResourceResult, error) {
+	ownership, err := b.preflightS3Buckets(ctx, buckets)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ResourceResult
+	for _, bucket := range buckets {
+		// Stop before starting the next resource if the run was cancelled or timed out
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+
+		res := newResourceResult(ResourceTypeS3, bucket.Name)
+		checkReplicationDestination(bucket, buckets, res)
+		b.warnCrossRegion(bucket.Region, res)
+		err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+			return b.inRegion(bucket.Region, func() error {
+				return b.ensureS3Bucket(ctx, bucket, ownership[bucket.Name], res)
+			})
+		})
+		results = append(results, res.finish(err))
+		if err != nil && !b.tolerate(err) {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// preflightS3Buckets checks who owns each bucket name and fails with every collision
+// when any of the names is already taken by another account
+func (b *Bootstrapper) preflightS3Buckets(ctx context.Context, buckets []S3Bucket) (map[string]bucketOwnership, error) {
+	ownership := make(map[string]bucketOwnership, len(buckets))
+	var collisions []error
+	for _, bucket := range buckets {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+
+		var owner bucketOwnership
+		err := b.inRegion(bucket.Region, func() error {
+			var err error
+			owner, err = b.checkBucketOwnership(ctx, bucket.Name)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if owner == bucketForeign {
+			collisions = append(collisions, foreignBucketError(bucket.Name))
+		}
+		ownership[bucket.Name] = owner
+	}
+
+	if len(collisions) > 0 {
+		return nil, fmt.Errorf("S3 bucket names are already taken:\n%w", errors.Join(collisions...))
+	}
+	return ownership, nil
+}
+
+// bucketState is what a run has learned about a bucket name: who owns it and, once it has
+// been looked up, the region the bucket is in
+type bucketState struct {
+	ownership bucketOwnership
+	region    string
+}
+
+// rememberBucket returns the cached state of a bucket name, adding it if it is not cached.
+// Entries are never invalidated during a run: a bucket only goes from missing to owned,
+// when the run creates it, and that is recorded here.
+func (b *Bootstrapper) rememberBucket(name string) *bucketState {
+	if b.buckets == nil {
+		b.buckets = make(map[string]*bucketState)
+	}
+	state, ok := b.buckets[name]
+	if !ok {
+		state = &bucketState{}
+		b.buckets[name] = state
+	}
+	return state
+}
+
+// checkBucketOwnership tells whether a bucket does not exist, exists and is accessible to
+// us, or exists and belongs to someone else. Each name is only looked up once per run.
+func (b *Bootstrapper) checkBucketOwnership(ctx context.Context, name string) (bucketOwnership, error) {
+	if state, ok := b.buckets[name]; ok {
+		return state.ownership, nil
+	}
+	ownership, err := b.headBucket(ctx, name)
+	if err != nil {
+		return ownership, err
+	}
+	b.rememberBucket(name).ownership = ownership
+	return ownership, nil
+}
+
+// headBucket uses HeadBucket to find the ownership of a bucket. HeadBucket has no error
+// body, so the HTTP status code is all there is to go on: 404 means the name is free and
+// 403 means another account owns it.
+func (b *Bootstrapper) headBucket(ctx context.Context, name string) (bucketOwnership, error) {
+	_, err := b.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(name),
+	})
+	if err == nil {
+		return bucketOwned, nil
+	}
+
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) {
+		switch responseErr.HTTPStatusCode() {
+		case http.StatusNotFound:
+			return bucketMissing, nil
+		case http.StatusForbidden:
+			return bucketForeign, nil
+		}
+	}
+	if isAPIError[*types.NotFound](err) || hasErrorCode(err, "NoSuchBucket") {
+		return bucketMissing, nil
+	}
+	if hasErrorCode(err, "Forbidden", "AccessDenied") {
+		return bucketForeign, nil
+	}
+	return bucketMissing, fmt.Errorf("failed to check bucket %s: %w", name, err)
+}
+
+// foreignBucketError explains what to do about a bucket name owned by another account
+func foreignBucketError(name string) error {
+	return fmt.Errorf("bucket %s already exists and is owned by another AWS account (or your credentials are denied access to it); S3 bucket names are globally unique, so choose a different name", name)
+}
+
+// ensureS3Bucket creates a single S3 bucket if needed and applies its configuration
+func (b *Bootstrapper) ensureS3Bucket(ctx context.Context, bucket S3Bucket, ownership bucketOwnership, res *ResourceResult) error {
+	logger.Info("Ensuring S3 bucket", "bucket", bucket.Name)
+
+	// Resolve the bucket policy and encryption rule up front so an invalid setting fails before any changes are made
+	policy, err := loadPolicy(bucket.Policy, bucket.PolicyFile)
+	if err != nil {
+		return fmt.Errorf("invalid policy for bucket %s: %w", bucket.Name, err)
+	}
+
+	var encryptionRule types.ServerSideEncryptionRule
+	if bucket.Encryption != "" {
+		rule, err := buildEncryptionRule(bucket)
+		if err != nil {
+			return err
+		}
+		encryptionRule = rule
+	}
+
+	// Object Lock can be configured unless the bucket already exists without it
+	lockable := true
+	// existing is set for a bucket that was there before this run, whichever way it was found
+	existing := false
+
+	switch ownership {
+	case bucketForeign:
+		return foreignBucketError(bucket.Name)
+	case bucketMissing:
+		// Bucket doesn't exist, create it
+		createBucketInput := &s3.CreateBucketInput{
+			Bucket: aws.String(bucket.Name),
+		}
+
+		// Object Lock can only be enabled when the bucket is created
+		if bucket.ObjectLock != nil {
+			createBucketInput.ObjectLockEnabledForBucket = aws.Bool(true)
+		}
+		if bucket.ObjectOwnership != "" {
+			createBucketInput.ObjectOwnership = types.ObjectOwnership(bucket.ObjectOwnership)
+		}
+
+		// Add location constraint if not in us-east-1
+		if b.awsConfig.Region != "us-east-1" {
+			createBucketInput.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+				LocationConstraint: types.BucketLocationConstraint(b.awsConfig.Region),
+			}
+		}
+
+		_, err = b.s3Client.CreateBucket(ctx, createBucketInput)
+		switch {
+		case isAPIError[*types.BucketAlreadyExists](err):
+			// Another account may have claimed the name since the preflight check
+			b.rememberBucket(bucket.Name).ownership = bucketForeign
+			return foreignBucketError(bucket.Name)
+		case isAPIError[*types.BucketAlreadyOwnedByYou](err):
+			// HeadBucket missed a bucket this account already owns, for example after a
+			// transient failure, so it is configured like any existing bucket
+			logger.Info("Bucket is already owned by this account", "bucket", bucket.Name)
+			b.rememberBucket(bucket.Name).ownership = bucketOwned
+			if bucket.IfNotExists {
+				res.ARN = s3BucketARN(b.awsConfig.Region, bucket.Name)
+				leaveExisting(res)
+				return nil
+			}
+			if lockable, err = b.reconcileExistingS3Bucket(ctx, bucket, policy, res); err != nil {
+				return err
+			}
+			existing = true
+		case err != nil:
+			return fmt.Errorf("failed to create bucket %s: %w", bucket.Name, err)
+		default:
+			state := b.rememberBucket(bucket.Name)
+			state.ownership, state.region = bucketOwned, b.awsConfig.Region
+			res.created()
+			logger.Info("Created bucket", "bucket", bucket.Name)
+		}
+	default:
+		if bucket.IfNotExists {
+			res.ARN = s3BucketARN(b.awsConfig.Region, bucket.Name)
+			leaveExisting(res)
+			return nil
+		}
+		if lockable, err = b.reconcileExistingS3Bucket(ctx, bucket, policy, res); err != nil {
+			return err
+		}
+		existing = true
+	}
+
+	res.ARN = s3BucketARN(b.awsConfig.Region, bucket.Name)
+
+	// Apply the ACL once ownership controls allow it
+	if bucket.ACL != "" {
+		b.ensureBucketACL(ctx, bucket, res)
+	}
+
+	// Configure tags; PutBucketTagging replaces the whole tag set so it always matches the config
+	if len(bucket.Tags) > 0 {
+		b.ensureBucketTags(ctx, bucket, res)
+	} else if b.pruneTags && existing {
+		// Without configured tags there is no tag set to replace the current one with
+		b.deleteBucketTags(ctx, bucket.Name, res)
+	}
+
+	// Replication only works on versioned buckets
+	if bucket.Replication != nil && bucket.Versioning == "" {
+		bucket.Versioning = "enabled"
+	}
+
+	// Configure versioning; an empty setting leaves it as it is
+	if bucket.Versioning != "" {
+		b.ensureBucketVersioning(ctx, bucket, res)
+	}
+
+	// Configure encryption
+	if bucket.Encryption != "" {
+		b.ensureBucketEncryption(ctx, bucket, encryptionRule, res)
+	}
+
+	// Configure transfer acceleration and who pays for requests
+	if bucket.TransferAcceleration != nil {
+		b.ensureBucketAcceleration(ctx, bucket, res)
+	}
+	if bucket.RequestPayer != "" {
+		b.ensureBucketRequestPayment(ctx, bucket, res)
+	}
+
+	// Configure CORS
+	if len(bucket.CORS) > 0 {
+		b.ensureBucketCORS(ctx, bucket, res)
+	}
+
+	// Configure lifecycle rules
+	if len(bucket.LifecycleRules) > 0 {
+		b.ensureBucketLifecycle(ctx, bucket, res)
+	}
+
+	// Configure the Object Lock default retention
+	if bucket.ObjectLock != nil && lockable {
+		b.ensureBucketObjectLock(ctx, bucket, res)
+	}
+
+	// Configure replication after versioning, which it depends on
+	if bucket.Replication != nil {
+		b.ensureBucketReplication(ctx, bucket, res)
+	}
+
+	// Configure event notifications
+	if len(bucket.Notifications) > 0 {
+		b.ensureBucketNotifications(ctx, bucket, res)
+	}
+
+	// Configure bucket policy
+	if policy != "" {
+		b.ensureBucketPolicy(ctx, bucket, policy, res)
+	}
+
+	// Access points refer to the bucket, so they come last
+	if len(bucket.AccessPoints) > 0 {
+		b.ensureAccessPoints(ctx, bucket, res)
+	}
+
+	return nil
+}
+
+// reconcileExistingS3Bucket checks that an existing bucket is in the configured region and
+// applies the settings that differ for buckets that were not just created. It reports
+// whether Object Lock can be configured on the bucket.
+func (b *Bootstrapper) reconcileExistingS3Bucket(ctx context.Context, bucket S3Bucket, policy string, res *ResourceResult) (bool, error) {
+	lockable := true
+	// HeadBucket succeeds for buckets in any region, so make sure we're configuring the right one
+	bucketRegion, err := b.bucketRegion(ctx, bucket.Name)
+	if err != nil {
+		return false, fmt.Errorf("failed to get location of bucket %s: %w", bucket.Name, err)
+	}
+	if bucketRegion != b.awsConfig.Region {
+		return false, fmt.Errorf("bucket %s already exists in region %s, but the configured region is %s; update the region in your config or use a different bucket name",
+			bucket.Name, bucketRegion, b.awsConfig.Region)
+	}
+
+	logger.Info("Bucket already exists", "bucket", bucket.Name)
+
+	if bucket.ObjectLock != nil && !b.objectLockEnabled(ctx, bucket.Name) {
+		res.warnf("Object Lock is configured for bucket %s, but the bucket was created without it; Object Lock can only be enabled when a bucket is created", bucket.Name)
+		lockable = false
+	}
+
+	// New buckets get their ownership setting from CreateBucket
+	if bucket.ObjectOwnership != "" {
+		b.ensureBucketOwnership(ctx, bucket, res)
+	}
+	if b.importing {
+		b.adoptS3Bucket(ctx, bucket, policy, res)
+	}
+	return lockable, nil
+}
+
+// buildReplicationConfiguration converts the replication config into the S3 API form, with
+// one rule per prefix or a single rule for the whole bucket
+func buildReplicationConfiguration(replication *S3Replication) *types.ReplicationConfiguration {
+	prefixes := replication.Prefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+
+	destination := &types.Destination{Bucket: aws.String(replication.DestinationBucket)}
+	if replication.StorageClass != "" {
+		destination.StorageClass = types.StorageClass(replication.StorageClass)
+	}
+
+	rules := make([]types.ReplicationRule, 0, len(prefixes))
+	for i, prefix := range prefixes {
+		id := "replicate-all"
+		if prefix != "" {
+			id = "replicate-" + prefix
+		}
+		rules = append(rules, types.ReplicationRule{
+			ID:       aws.String(id),
+			Priority: aws.Int32(int32(i + 1)),
+			Status:   types.ReplicationRuleStatusEnabled,
+			Filter:   &types.ReplicationRuleFilter{Prefix: aws.String(prefix)},
+			// Rules with a filter must say whether delete markers are replicated
+			DeleteMarkerReplication: &types.DeleteMarkerReplication{Status: types.DeleteMarkerReplicationStatusDisabled},
+			Destination:             destination,
+		})
+	}
+
+	return &types.ReplicationConfiguration{
+		Role:  aws.String(replication.Role),
+		Rules: rules,
+	}
+}
+
+// buildNotificationConfiguration converts the configured notifications into the S3 API
+// form, grouped by destination type
+func buildNotificationConfiguration(notifications []S3Notification) *types.NotificationConfiguration {
+	config := &types.NotificationConfiguration{}
+	for _, notification := range notifications {
+		events := make([]types.Event, 0, len(notification.Events))
+		for _, event := range notification.Events {
+			events = append(events, types.Event(event))
+		}
+
+		var filter *types.NotificationConfigurationFilter
+		if notification.Prefix != "" || notification.Suffix != "" {
+			key := &types.S3KeyFilter{}
+			if notification.Prefix != "" {
+				key.FilterRules = append(key.FilterRules, types.FilterRule{Name: types.FilterRuleNamePrefix, Value: aws.String(notification.Prefix)})
+			}
+			if notification.Suffix != "" {
+				key.FilterRules = append(key.FilterRules, types.FilterRule{Name: types.FilterRuleNameSuffix, Value: aws.String(notification.Suffix)})
+			}
+			filter = &types.NotificationConfigurationFilter{Key: key}
+		}
+
+		var id *string
+		if notification.ID != "" {
+			id = aws.String(notification.ID)
+		}
+
+		switch {
+		case notification.Topic != "":
+			config.TopicConfigurations = append(config.TopicConfigurations, types.TopicConfiguration{
+				Id: id, TopicArn: aws.String(notification.Topic), Events: events, Filter: filter,
+			})
+		case notification.Queue != "":
+			config.QueueConfigurations = append(config.QueueConfigurations, types.QueueConfiguration{
+				Id: id, QueueArn: aws.String(notification.Queue), Events: events, Filter: filter,
+			})
+		case notification.LambdaFunction != "":
+			config.LambdaFunctionConfigurations = append(config.LambdaFunctionConfigurations, types.LambdaFunctionConfiguration{
+				Id: id, LambdaFunctionArn: aws.String(notification.LambdaFunction), Events: events, Filter: filter,
+			})
+		}
+	}
+	return config
+}
+
+// checkReplicationDestination warns when a bucket replicates to another bucket in the same
+// config that will not have versioning enabled, since S3 rejects such a destination
+func checkReplicationDestination(bucket S3Bucket, buckets []S3Bucket, res *ResourceResult) {
+	if bucket.Replication == nil {
+		return
+	}
+	_, destinationName, _ := strings.Cut(bucket.Replication.DestinationBucket, ":::")
+	for _, destination := range buckets {
+		if destination.Name != destinationName {
+			continue
+		}
+		if destination.Versioning != "enabled" && destination.Replication == nil && destination.ObjectLock == nil {
+			res.warnf("bucket %s replicates to %s, which does not have versioning enabled in the configuration; replication requires versioning on the destination",
+				bucket.Name, destination.Name)
+		}
+		return
+	}
+}
+
+// bucketRegion returns the region of an existing bucket, which is only looked up once per run
+func (b *Bootstrapper) bucketRegion(ctx context.Context, name string) (string, error) {
+	if state, ok := b.buckets[name]; ok && state.region != "" {
+		return state.region, nil
+	}
+	output, err := b.s3Client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{
+		Bucket: aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+	region := normalizeBucketRegion(output.LocationConstraint)
+	b.rememberBucket(name).region = region
+	return region, nil
+}
+
+// normalizeBucketRegion converts a GetBucketLocation constraint into a region name.
+// Buckets in us-east-1 report an empty constraint and legacy eu-west-1 buckets report "EU".
+func normalizeBucketRegion(constraint types.BucketLocationConstraint) string {
+	switch constraint {
+	case "":
+		return "us-east-1"
+	case types.BucketLocationConstraintEu:
+		return "eu-west-1"
+	default:
+		return string(constraint)
+	}
+}
+
+// bucketObjectOwnership returns the object ownership setting of a bucket, or "" when the
+// bucket has no ownership controls
+func (b *Bootstrapper) bucketObjectOwnership(ctx context.Context, bucketName string) (string, error) {
+	output, err := b.s3Client.GetBucketOwnershipControls(ctx, &s3.GetBucketOwnershipControlsInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		if hasErrorCode(err, "OwnershipControlsNotFoundError") {
+			return "", nil
+		}
+		return "", err
+	}
+	if output.OwnershipControls == nil || len(output.OwnershipControls.Rules) == 0 {
+		return "", nil
+	}
+	return string(output.OwnershipControls.Rules[0].ObjectOwnership), nil
+}
+
+// ensureBucketOwnership sets the object ownership of an existing bucket, skipping the write
+// when it already matches
+func (b *Bootstrapper) ensureBucketOwnership(ctx context.Context, bucket S3Bucket, res *ResourceResult) {
+	current, err := b.bucketObjectOwnership(ctx, bucket.Name)
+	if err != nil {
+		res.warnf("failed to get ownership controls of bucket %s: %v", bucket.Name, err)
+		return
+	}
+	if current == bucket.ObjectOwnership {
+		logger.Debug("Object ownership already in the desired state", "bucket", bucket.Name, "object_ownership", current)
+		return
+	}
+
+	_, err = b.s3Client.PutBucketOwnershipControls(ctx, &s3.PutBucketOwnershipControlsInput{
+		Bucket: aws.String(bucket.Name),
+		OwnershipControls: &types.OwnershipControls{
+			Rules: []types.OwnershipControlsRule{{ObjectOwnership: types.ObjectOwnership(bucket.ObjectOwnership)}},
+		},
+	})
+	if err != nil {
+		res.warnf("failed to set object ownership to %s for bucket %s: %v", bucket.ObjectOwnership, bucket.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Set object ownership", "bucket", bucket.Name, "object_ownership", bucket.ObjectOwnership)
+}
+
+// ensureBucketVersioning sets the versioning status of a bucket, skipping the write when
+// the bucket is already in the desired state
+func (b *Bootstrapper) ensureBucketVersioning(ctx context.Context, bucket S3Bucket, res *ResourceResult) {
+	desired := versioningStatus(bucket.Versioning)
+
+	// A bucket created by this run is unversioned, unless Object Lock turned versioning on
+	var current types.BucketVersioningStatus
+	if res.Action == ActionCreated {
+		if bucket.ObjectLock != nil {
+			current = types.BucketVersioningStatusEnabled
+		}
+	} else {
+		output, err := b.s3Client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+			Bucket: aws.String(bucket.Name),
+		})
+		if err != nil {
+			res.warnf("failed to get versioning of bucket %s: %v", bucket.Name, err)
+			return
+		}
+		current = output.Status
+	}
+
+	if versioningSatisfied(current, desired) {
+		logger.Debug("Versioning already in the desired state", "bucket", bucket.Name, "status", bucket.Versioning)
+		return
+	}
+
+	_, err := b.s3Client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+		Bucket: aws.String(bucket.Name),
+		VersioningConfiguration: &types.VersioningConfiguration{
+			Status: desired,
+		},
+	})
+	if err != nil {
+		res.warnf("failed to set versioning to %s for bucket %s: %v", bucket.Versioning, bucket.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Set versioning", "bucket", bucket.Name, "status", bucket.Versioning)
+}
+
+// accelerateStatus converts the configured transfer acceleration setting into the S3 status
+func accelerateStatus(enabled bool) types.BucketAccelerateStatus {
+	if enabled {
+		return types.BucketAccelerateStatusEnabled
+	}
+	return types.BucketAccelerateStatusSuspended
+}
+
+// accelerateSatisfied reports whether a bucket's transfer acceleration status already
+// matches the desired one. A bucket that never had it enabled counts as suspended.
+func accelerateSatisfied(current, desired types.BucketAccelerateStatus) bool {
+	if desired == types.BucketAccelerateStatusSuspended {
+		return current != types.BucketAccelerateStatusEnabled
+	}
+	return current == desired
+}
+
+// ensureBucketAcceleration enables or suspends transfer acceleration, skipping the write
+// when the bucket is already in the desired state
+func (b *Bootstrapper) ensureBucketAcceleration(ctx context.Context, bucket S3Bucket, res *ResourceResult) {
+	desired := accelerateStatus(*bucket.TransferAcceleration)
+
+	// A bucket created by this run is not accelerated
+	var current types.BucketAccelerateStatus
+	if res.Action != ActionCreated {
+		output, err := b.s3Client.GetBucketAccelerateConfiguration(ctx, &s3.GetBucketAccelerateConfigurationInput{
+			Bucket: aws.String(bucket.Name),
+		})
+		if err != nil {
+			res.warnf("failed to get transfer acceleration of bucket %s: %v", bucket.Name, err)
+			return
+		}
+		current = output.Status
+	}
+
+	if accelerateSatisfied(current, desired) {
+		logger.Debug("Transfer acceleration already in the desired state", "bucket", bucket.Name, "status", desired)
+		return
+	}
+
+	_, err := b.s3Client.PutBucketAccelerateConfiguration(ctx, &s3.PutBucketAccelerateConfigurationInput{
+		Bucket:                  aws.String(bucket.Name),
+		AccelerateConfiguration: &types.AccelerateConfiguration{Status: desired},
+	})
+	if err != nil {
+		res.warnf("failed to set transfer acceleration to %s for bucket %s: %v", desired, bucket.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Set transfer acceleration", "bucket", bucket.Name, "status", desired)
+}
+
+// ensureBucketRequestPayment sets who pays for requests to the bucket, skipping the write
+// when it already matches
+func (b *Bootstrapper) ensureBucketRequestPayment(ctx context.Context, bucket S3Bucket, res *ResourceResult) {
+	// A bucket created by this run is paid for by its owner
+	current := types.PayerBucketOwner
+	if res.Action != ActionCreated {
+		output, err := b.s3Client.GetBucketRequestPayment(ctx, &s3.GetBucketRequestPaymentInput{
+			Bucket: aws.String(bucket.Name),
+		})
+		if err != nil {
+			res.warnf("failed to get request payment of bucket %s: %v", bucket.Name, err)
+			return
+		}
+		current = output.Payer
+	}
+
+	if current == types.Payer(bucket.RequestPayer) {
+		logger.Debug("Request payer already in the desired state", "bucket", bucket.Name, "request_payer", current)
+		return
+	}
+
+	_, err := b.s3Client.PutBucketRequestPayment(ctx, &s3.PutBucketRequestPaymentInput{
+		Bucket:                      aws.String(bucket.Name),
+		RequestPaymentConfiguration: &types.RequestPaymentConfiguration{Payer: types.Payer(bucket.RequestPayer)},
+	})
+	if err != nil {
+		res.warnf("failed to set request payer to %s for bucket %s: %v", bucket.RequestPayer, bucket.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Set request payer", "bucket", bucket.Name, "request_payer", bucket.RequestPayer)
+}
+
+// versioningStatus converts a configured versioning setting into the S3 status
+func versioningStatus(versioning string) types.BucketVersioningStatus {
+	if versioning == "suspended" {
+		return types.BucketVersioningStatusSuspended
+	}
+	return types.BucketVersioningStatusEnabled
+}
+
+// versioningSatisfied reports whether a bucket's current versioning status already matches
+// the desired one. A bucket that never had versioning enabled counts as suspended.
+func versioningSatisfied(current, desired types.BucketVersioningStatus) bool {
+	if desired == types.BucketVersioningStatusSuspended {
+		return current != types.BucketVersioningStatusEnabled
+	}
+	return current == desired
+}
+
+// objectLockEnabled reports whether Object Lock was enabled when the bucket was created.
+// Buckets without it return ObjectLockConfigurationNotFoundError.
+func (b *Bootstrapper) objectLockEnabled(ctx context.Context, bucketName string) bool {
+	output, err := b.s3Client.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil || output.ObjectLockConfiguration == nil {
+		return false
+	}
+	return output.ObjectLockConfiguration.ObjectLockEnabled == types.ObjectLockEnabledEnabled
+}
+
+// s3BucketARN returns the ARN of a bucket. S3 ARNs carry no region or account, only the
+// partition the region belongs to.
+func s3BucketARN(region, bucketName string) string {
+	return fmt.Sprintf("arn:%s:s3:::%s", partitionForRegion(region), bucketName)
+}
+
+// buildEncryptionRule builds the default server-side encryption rule for a bucket
+func buildEncryptionRule(bucket S3Bucket) (types.ServerSideEncryptionRule, error) {
+	switch bucket.Encryption {
+	case string(types.ServerSideEncryptionAes256):
+		return types.ServerSideEncryptionRule{
+			ApplyServerSideEncryptionByDefault: &types.ServerSideEncryptionByDefault{
+				SSEAlgorithm: types.ServerSideEncryptionAes256,
+			},
+		}, nil
+	case string(types.ServerSideEncryptionAwsKms):
+		if bucket.KMSKeyID == "" {
+			return types.ServerSideEncryptionRule{}, fmt.Errorf("bucket %s uses aws:kms encryption but no kms_key_id is configured", bucket.Name)
+		}
+		// Bucket keys reduce the number of KMS requests made on behalf of the bucket
+		return types.ServerSideEncryptionRule{
+			ApplyServerSideEncryptionByDefault: &types.ServerSideEncryptionByDefault{
+				SSEAlgorithm:   types.ServerSideEncryptionAwsKms,
+				KMSMasterKeyID: aws.String(bucket.KMSKeyID),
+			},
+			BucketKeyEnabled: aws.Bool(true),
+		}, nil
+	default:
+		return types.ServerSideEncryptionRule{}, fmt.Errorf("bucket %s has unsupported encryption %q (expected AES256 or aws:kms)", bucket.Name, bucket.Encryption)
+	}
+}
+
+// buildLifecycleRules converts the configured lifecycle rules into their S3 API representation
+func buildLifecycleRules(rules []S3LifecycleRule) []types.LifecycleRule {
+	result := make([]types.LifecycleRule, 0, len(rules))
+	for _, rule := range rules {
+		// An empty prefix filter applies the rule to every object in the bucket
+		lifecycleRule := types.LifecycleRule{
+			ID:     aws.String(rule.ID),
+			Status: types.ExpirationStatusEnabled,
+			Filter: &types.LifecycleRuleFilter{
+				Prefix: aws.String(rule.Prefix),
+			},
+		}
+
+		if rule.ExpirationDays > 0 {
+			lifecycleRule.Expiration = &types.LifecycleExpiration{
+				Days: aws.Int32(int32(rule.ExpirationDays)),
+			}
+		}
+
+		for _, transition := range rule.Transitions {
+			lifecycleRule.Transitions = append(lifecycleRule.Transitions, types.Transition{
+				Days:         aws.Int32(int32(transition.Days)),
+				StorageClass: types.TransitionStorageClass(strings.ToUpper(transition.StorageClass)),
+			})
+		}
+
+		if rule.NoncurrentVersionExpirationDays > 0 {
+			lifecycleRule.NoncurrentVersionExpiration = &types.NoncurrentVersionExpiration{
+				NoncurrentDays: aws.Int32(int32(rule.NoncurrentVersionExpirationDays)),
+			}
+		}
+
+		result = append(result, lifecycleRule)
+	}
+	return result
+}
+
+// deleteBucketTags removes every tag from an existing bucket
+func (b *Bootstrapper) deleteBucketTags(ctx context.Context, bucketName string, res *ResourceResult) {
+	tagging, err := b.s3Client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{
+		Bucket: aws.String(bucketName),
+	})
+	// Buckets without tags return NoSuchTagSet
+	if err != nil || len(tagging.TagSet) == 0 {
+		return
+	}
+
+	_, err = b.s3Client.DeleteBucketTagging(ctx, &s3.DeleteBucketTaggingInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		res.warnf("failed to remove tags from bucket %s: %v", bucketName, err)
+		return
+	}
+	res.updated()
+	logger.Info("Removed bucket tags", "bucket", bucketName, "tags", len(tagging.TagSet))
+}
+
+// buildS3Tags converts a tag map into an S3 tag set sorted by key so repeated runs produce identical requests
+func buildS3Tags(tags map[string]string) []types.Tag {
+	tagSet := make([]types.Tag, 0, len(tags))
+	for _, key := range sortedKeys(tags) {
+		tagSet = append(tagSet, types.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+	return tagSet
+}
+
+// Helper function to convert methods to uppercase
+func convertToMethodsEnum(methods []string) []string {
+	result := make([]string, len(methods))
+	for i, method := range methods {
+		result[i] = strings.ToUpper(method)
+	}
+	return result
+}
@@ -0,0 +1,130 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+)
+
+// ensureAccessPoints creates the access points of the bucket that do not exist yet and
+// reconciles their policies. Access points that are not in the configuration are left
+// alone. Failures are recorded as warnings, like the bucket's other settings.
+func (b *Bootstrapper) ensureAccessPoints(ctx context.Context, bucket S3Bucket, res *ResourceResult) {
+	// Access points belong to an account rather than a bucket, so every call names it
+	accountID, err := b.accountID(ctx)
+	if err != nil {
+		res.warnf("failed to look up the account for the access points of bucket %s: %v", bucket.Name, err)
+		return
+	}
+
+	existing, err := b.listAccessPoints(ctx, accountID, bucket.Name)
+	if err != nil {
+		res.warnf("failed to list access points of bucket %s: %v", bucket.Name, err)
+		return
+	}
+
+	for _, accessPoint := range bucket.AccessPoints {
+		current, ok := existing[accessPoint.Name]
+		if !ok {
+			input := &s3control.CreateAccessPointInput{
+				AccountId: aws.String(accountID),
+				Bucket:    aws.String(bucket.Name),
+				Name:      aws.String(accessPoint.Name),
+			}
+			if accessPoint.VPCID != "" {
+				input.VpcConfiguration = &controltypes.VpcConfiguration{VpcId: aws.String(accessPoint.VPCID)}
+			}
+			output, err := b.s3controlClient.CreateAccessPoint(ctx, input)
+			if err != nil {
+				res.warnf("failed to create access point %s for bucket %s: %v", accessPoint.Name, bucket.Name, err)
+				continue
+			}
+			current = controltypes.AccessPoint{AccessPointArn: output.AccessPointArn, Alias: output.Alias}
+			res.updated()
+			logger.Info("Created access point", "bucket", bucket.Name, "access_point", accessPoint.Name)
+		} else if currentVPC := accessPointVPC(current); currentVPC != accessPoint.VPCID {
+			res.warnf("access point %s of bucket %s has network origin %s, but %s is configured; the network origin can only be set when an access point is created",
+				accessPoint.Name, bucket.Name, describeNetworkOrigin(currentVPC), describeNetworkOrigin(accessPoint.VPCID))
+		}
+
+		res.AccessPoints = append(res.AccessPoints, AccessPointResult{
+			Name:  accessPoint.Name,
+			ARN:   aws.ToString(current.AccessPointArn),
+			Alias: aws.ToString(current.Alias),
+		})
+
+		if accessPoint.Policy != "" {
+			b.ensureAccessPointPolicy(ctx, accountID, bucket.Name, accessPoint, !ok, res)
+		}
+	}
+}
+
+// listAccessPoints returns the access points of the bucket by name
+func (b *Bootstrapper) listAccessPoints(ctx context.Context, accountID, bucketName string) (map[string]controltypes.AccessPoint, error) {
+	accessPoints := make(map[string]controltypes.AccessPoint)
+	paginator := s3control.NewListAccessPointsPaginator(b.s3controlClient, &s3control.ListAccessPointsInput{
+		AccountId: aws.String(accountID),
+		Bucket:    aws.String(bucketName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, accessPoint := range page.AccessPointList {
+			accessPoints[aws.ToString(accessPoint.Name)] = accessPoint
+		}
+	}
+	return accessPoints, nil
+}
+
+// ensureAccessPointPolicy sets the policy of the access point, skipping the write when the
+// current policy is the same document. An access point created by this run has no policy.
+func (b *Bootstrapper) ensureAccessPointPolicy(ctx context.Context, accountID, bucketName string, accessPoint S3AccessPoint, created bool, res *ResourceResult) {
+	if !created {
+		output, err := b.s3controlClient.GetAccessPointPolicy(ctx, &s3control.GetAccessPointPolicyInput{
+			AccountId: aws.String(accountID),
+			Name:      aws.String(accessPoint.Name),
+		})
+		switch {
+		case err != nil && !hasErrorCode(err, "NoSuchAccessPointPolicy"):
+			res.warnf("failed to get policy of access point %s of bucket %s: %v", accessPoint.Name, bucketName, err)
+			return
+		case err == nil && jsonEqual(aws.ToString(output.Policy), accessPoint.Policy):
+			logger.Debug("Access point policy already up to date", "bucket", bucketName, "access_point", accessPoint.Name)
+			return
+		}
+	}
+
+	_, err := b.s3controlClient.PutAccessPointPolicy(ctx, &s3control.PutAccessPointPolicyInput{
+		AccountId: aws.String(accountID),
+		Name:      aws.String(accessPoint.Name),
+		Policy:    aws.String(accessPoint.Policy),
+	})
+	if err != nil {
+		res.warnf("failed to set policy of access point %s of bucket %s: %v", accessPoint.Name, bucketName, err)
+		return
+	}
+	res.updated()
+	logger.Info("Set access point policy", "bucket", bucketName, "access_point", accessPoint.Name)
+}
+
+// accessPointVPC returns the VPC an access point accepts requests from, or "" when it
+// accepts requests from the internet
+func accessPointVPC(accessPoint controltypes.AccessPoint) string {
+	if accessPoint.NetworkOrigin != controltypes.NetworkOriginVpc || accessPoint.VpcConfiguration == nil {
+		return ""
+	}
+	return aws.ToString(accessPoint.VpcConfiguration.VpcId)
+}
+
+// describeNetworkOrigin names the network origin of an access point for messages
+func describeNetworkOrigin(vpcID string) string {
+	if vpcID == "" {
+		return "internet"
+	}
+	return fmt.Sprintf("VPC %s", vpcID)
+}
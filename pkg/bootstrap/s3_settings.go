@@ -0,0 +1,448 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// bucketSettingMatches reports whether an existing bucket already has a setting. read
+// returns the current setting; an error with one of missingCodes means the bucket has none.
+// Other read errors are logged, and the setting is written as if it differed.
+func bucketSettingMatches(bucketName, setting string, want any, read func() (any, error), missingCodes ...string) bool {
+	current, err := read()
+	if err != nil {
+		if !hasErrorCode(err, missingCodes...) {
+			logger.Debug("Failed to read bucket setting; writing it", "bucket", bucketName, "setting", setting, "error", err)
+		}
+		return false
+	}
+	if !equalIgnoringZero(current, want) {
+		return false
+	}
+	logger.Debug("Bucket setting already in the desired state", "bucket", bucketName, "setting", setting)
+	return true
+}
+
+// equalIgnoringZero reports whether two S3 settings are equal once the fields that are unset,
+// empty or zero are left out. S3 returns settings without the empty fields a request set,
+// and with defaults it did not set.
+func equalIgnoringZero(a, b any) bool {
+	x, errX := withoutZeroValues(a)
+	y, errY := withoutZeroValues(b)
+	return errX == nil && errY == nil && reflect.DeepEqual(x, y)
+}
+
+// withoutZeroValues converts a setting to its JSON form with the zero values removed
+func withoutZeroValues(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return pruneZero(decoded), nil
+}
+
+// pruneZero removes empty strings, zero numbers, false, empty objects and empty lists from
+// a decoded JSON value, returning nil when nothing is left
+func pruneZero(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for key, field := range value {
+			if pruned := pruneZero(field); pruned == nil {
+				delete(value, key)
+			} else {
+				value[key] = pruned
+			}
+		}
+		if len(value) == 0 {
+			return nil
+		}
+	case []any:
+		if len(value) == 0 {
+			return nil
+		}
+		for i := range value {
+			value[i] = pruneZero(value[i])
+		}
+	case string:
+		if value == "" {
+			return nil
+		}
+	case float64:
+		if value == 0 {
+			return nil
+		}
+	case bool:
+		if !value {
+			return nil
+		}
+	}
+	return v
+}
+
+// cannedACLGrants are the group grants of the canned ACLs that can be recognised from a
+// bucket's grants, on top of the owner's full control
+var cannedACLGrants = map[string][]string{
+	"private":            nil,
+	"public-read":        {"AllUsers:READ"},
+	"public-read-write":  {"AllUsers:READ", "AllUsers:WRITE"},
+	"authenticated-read": {"AuthenticatedUsers:READ"},
+}
+
+// aclMatches reports whether a bucket's grants are those of the canned ACL. Canned ACLs
+// that cannot be told apart from their grants never match, so they are always written.
+func aclMatches(acl string, output *s3.GetBucketAclOutput) bool {
+	want, ok := cannedACLGrants[acl]
+	if !ok {
+		return false
+	}
+	var ownerID string
+	if output.Owner != nil {
+		ownerID = aws.ToString(output.Owner.ID)
+	}
+
+	var current []string
+	for _, grant := range output.Grants {
+		if grant.Grantee == nil {
+			return false
+		}
+		switch {
+		case grant.Grantee.Type == types.TypeCanonicalUser && aws.ToString(grant.Grantee.ID) == ownerID && grant.Permission == types.PermissionFullControl:
+			// Every canned ACL gives the owner full control
+		case grant.Grantee.Type == types.TypeGroup:
+			uri := aws.ToString(grant.Grantee.URI)
+			current = append(current, uri[strings.LastIndex(uri, "/")+1:]+":"+string(grant.Permission))
+		default:
+			return false
+		}
+	}
+	slices.Sort(current)
+	return slices.Equal(current, want)
+}
+
+// ensureBucketACL applies the canned ACL, skipping the write when the bucket's grants
+// already match it
+func (b *Bootstrapper) ensureBucketACL(ctx context.Context, bucket S3Bucket, res *ResourceResult) {
+	// A bucket created by this run is private
+	if res.Action == ActionCreated && bucket.ACL == string(types.BucketCannedACLPrivate) {
+		return
+	}
+	if res.Action != ActionCreated {
+		output, err := b.s3Client.GetBucketAcl(ctx, &s3.GetBucketAclInput{Bucket: aws.String(bucket.Name)})
+		if err == nil && aclMatches(bucket.ACL, output) {
+			logger.Debug("ACL already in the desired state", "bucket", bucket.Name, "acl", bucket.ACL)
+			return
+		}
+	}
+
+	_, err := b.s3Client.PutBucketAcl(ctx, &s3.PutBucketAclInput{
+		Bucket: aws.String(bucket.Name),
+		ACL:    types.BucketCannedACL(bucket.ACL),
+	})
+	switch {
+	case err != nil && hasErrorCode(err, "AccessControlListNotSupported"):
+		res.warnf("bucket %s does not allow ACLs; set object_ownership to BucketOwnerPreferred or ObjectWriter to apply acl %s", bucket.Name, bucket.ACL)
+	case err != nil:
+		res.warnf("failed to set ACL for bucket %s: %v", bucket.Name, err)
+	default:
+		res.updated()
+		logger.Info("Set bucket ACL", "bucket", bucket.Name, "acl", bucket.ACL)
+	}
+}
+
+// ensureBucketTags replaces the bucket's tag set with the configured tags, skipping the
+// write when they already match
+func (b *Bootstrapper) ensureBucketTags(ctx context.Context, bucket S3Bucket, res *ResourceResult) {
+	if res.Action != ActionCreated {
+		current := make(map[string]string)
+		tagging, err := b.s3Client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(bucket.Name)})
+		// Buckets without tags return NoSuchTagSet, which is the same as an empty tag set
+		if err == nil {
+			for _, tag := range tagging.TagSet {
+				current[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+		}
+		if (err == nil || hasErrorCode(err, "NoSuchTagSet")) && reflect.DeepEqual(current, bucket.Tags) {
+			logger.Debug("Bucket tags already in the desired state", "bucket", bucket.Name)
+			return
+		}
+	}
+
+	_, err := b.s3Client.PutBucketTagging(ctx, &s3.PutBucketTaggingInput{
+		Bucket: aws.String(bucket.Name),
+		Tagging: &types.Tagging{
+			TagSet: buildS3Tags(bucket.Tags),
+		},
+	})
+	if err != nil {
+		res.warnf("failed to set tags for bucket %s: %v", bucket.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Set bucket tags", "bucket", bucket.Name, "tags", len(bucket.Tags))
+}
+
+// ensureBucketEncryption sets the default encryption, skipping the write when the bucket
+// already encrypts with the same algorithm and key
+func (b *Bootstrapper) ensureBucketEncryption(ctx context.Context, bucket S3Bucket, rule types.ServerSideEncryptionRule, res *ResourceResult) {
+	rules := []types.ServerSideEncryptionRule{rule}
+	if res.Action != ActionCreated && bucketSettingMatches(bucket.Name, "encryption", rules, func() (any, error) {
+		output, err := b.s3Client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: aws.String(bucket.Name)})
+		if err != nil || output.ServerSideEncryptionConfiguration == nil {
+			return nil, err
+		}
+		return output.ServerSideEncryptionConfiguration.Rules, nil
+	}) {
+		return
+	}
+
+	_, err := b.s3Client.PutBucketEncryption(ctx, &s3.PutBucketEncryptionInput{
+		Bucket: aws.String(bucket.Name),
+		ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{
+			Rules: rules,
+		},
+	})
+	if err != nil {
+		res.warnf("failed to configure encryption for bucket %s: %v", bucket.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Configured encryption", "bucket", bucket.Name)
+}
+
+// ensureBucketCORS sets the CORS rules, skipping the write when they already match
+func (b *Bootstrapper) ensureBucketCORS(ctx context.Context, bucket S3Bucket, res *ResourceResult) {
+	corsRules := make([]types.CORSRule, 0, len(bucket.CORS))
+	for _, rule := range bucket.CORS {
+		corsRules = append(corsRules, types.CORSRule{
+			AllowedOrigins: rule.AllowedOrigins,
+			AllowedMethods: convertToMethodsEnum(rule.AllowedMethods),
+			AllowedHeaders: rule.AllowedHeaders,
+			ExposeHeaders:  rule.ExposeHeaders,
+			MaxAgeSeconds:  aws.Int32(int32(rule.MaxAgeSeconds)),
+		})
+	}
+	if res.Action != ActionCreated && bucketSettingMatches(bucket.Name, "CORS rules", corsRules, func() (any, error) {
+		output, err := b.s3Client.GetBucketCors(ctx, &s3.GetBucketCorsInput{Bucket: aws.String(bucket.Name)})
+		if err != nil {
+			return nil, err
+		}
+		return output.CORSRules, nil
+	}, "NoSuchCORSConfiguration") {
+		return
+	}
+
+	_, err := b.s3Client.PutBucketCors(ctx, &s3.PutBucketCorsInput{
+		Bucket: aws.String(bucket.Name),
+		CORSConfiguration: &types.CORSConfiguration{
+			CORSRules: corsRules,
+		},
+	})
+	if err != nil {
+		res.warnf("failed to configure CORS for bucket %s: %v", bucket.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Configured CORS", "bucket", bucket.Name)
+}
+
+// ensureBucketLifecycle sets the lifecycle rules, skipping the write when they already match
+func (b *Bootstrapper) ensureBucketLifecycle(ctx context.Context, bucket S3Bucket, res *ResourceResult) {
+	rules := buildLifecycleRules(bucket.LifecycleRules)
+	if res.Action != ActionCreated && bucketSettingMatches(bucket.Name, "lifecycle rules", rules, func() (any, error) {
+		output, err := b.s3Client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucket.Name)})
+		if err != nil {
+			return nil, err
+		}
+		return output.Rules, nil
+	}, "NoSuchLifecycleConfiguration") {
+		return
+	}
+
+	_, err := b.s3Client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket.Name),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{
+			Rules: rules,
+		},
+	})
+	if err != nil {
+		res.warnf("failed to configure lifecycle rules for bucket %s: %v", bucket.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Configured lifecycle rules", "bucket", bucket.Name, "rules", len(bucket.LifecycleRules))
+}
+
+// ensureBucketObjectLock sets the Object Lock default retention, skipping the write when it
+// already matches
+func (b *Bootstrapper) ensureBucketObjectLock(ctx context.Context, bucket S3Bucket, res *ResourceResult) {
+	config := &types.ObjectLockConfiguration{
+		ObjectLockEnabled: types.ObjectLockEnabledEnabled,
+		Rule: &types.ObjectLockRule{
+			DefaultRetention: &types.DefaultRetention{
+				Mode: types.ObjectLockRetentionMode(bucket.ObjectLock.Mode),
+				Days: aws.Int32(int32(bucket.ObjectLock.RetentionDays)),
+			},
+		},
+	}
+	if res.Action != ActionCreated && bucketSettingMatches(bucket.Name, "Object Lock", config, func() (any, error) {
+		output, err := b.s3Client.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{Bucket: aws.String(bucket.Name)})
+		if err != nil {
+			return nil, err
+		}
+		return output.ObjectLockConfiguration, nil
+	}, "ObjectLockConfigurationNotFoundError") {
+		return
+	}
+
+	_, err := b.s3Client.PutObjectLockConfiguration(ctx, &s3.PutObjectLockConfigurationInput{
+		Bucket:                  aws.String(bucket.Name),
+		ObjectLockConfiguration: config,
+	})
+	if err != nil {
+		res.warnf("failed to configure Object Lock for bucket %s: %v", bucket.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Configured Object Lock", "bucket", bucket.Name,
+		"mode", bucket.ObjectLock.Mode, "retention_days", bucket.ObjectLock.RetentionDays)
+}
+
+// ensureBucketReplication sets the replication configuration, skipping the write when it
+// already matches
+func (b *Bootstrapper) ensureBucketReplication(ctx context.Context, bucket S3Bucket, res *ResourceResult) {
+	config := buildReplicationConfiguration(bucket.Replication)
+	if res.Action != ActionCreated && bucketSettingMatches(bucket.Name, "replication", config, func() (any, error) {
+		output, err := b.s3Client.GetBucketReplication(ctx, &s3.GetBucketReplicationInput{Bucket: aws.String(bucket.Name)})
+		if err != nil {
+			return nil, err
+		}
+		return output.ReplicationConfiguration, nil
+	}, "ReplicationConfigurationNotFoundError") {
+		return
+	}
+
+	_, err := b.s3Client.PutBucketReplication(ctx, &s3.PutBucketReplicationInput{
+		Bucket:                   aws.String(bucket.Name),
+		ReplicationConfiguration: config,
+	})
+	if err != nil {
+		res.warnf("failed to configure replication for bucket %s: %v", bucket.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Configured replication", "bucket", bucket.Name, "destination", bucket.Replication.DestinationBucket)
+}
+
+// ensureBucketNotifications sets the event notifications, skipping the write when they
+// already match
+func (b *Bootstrapper) ensureBucketNotifications(ctx context.Context, bucket S3Bucket, res *ResourceResult) {
+	config := buildNotificationConfiguration(bucket.Notifications)
+	if res.Action != ActionCreated && bucketSettingMatches(bucket.Name, "notifications", config, func() (any, error) {
+		output, err := b.s3Client.GetBucketNotificationConfiguration(ctx, &s3.GetBucketNotificationConfigurationInput{Bucket: aws.String(bucket.Name)})
+		if err != nil {
+			return nil, err
+		}
+		// The configuration replaces EventBridge delivery too, so a bucket with it differs
+		if output.EventBridgeConfiguration != nil {
+			return output, nil
+		}
+		return currentNotifications(config, output), nil
+	}) {
+		return
+	}
+
+	_, err := b.s3Client.PutBucketNotificationConfiguration(ctx, &s3.PutBucketNotificationConfigurationInput{
+		Bucket:                    aws.String(bucket.Name),
+		NotificationConfiguration: config,
+	})
+	switch {
+	case hasErrorCode(err, "InvalidArgument") && strings.Contains(err.Error(), "Unable to validate the following destination configurations"):
+		// S3 sends a test event to every destination and rejects the whole configuration
+		// if any of them does not allow it to publish
+		res.warnf("notifications for bucket %s were rejected because a destination does not grant s3.amazonaws.com permission to publish; "+
+			"allow it in the topic, queue or function policy: %v", bucket.Name, err)
+	case err != nil:
+		res.warnf("failed to configure notifications for bucket %s: %v", bucket.Name, err)
+	default:
+		res.updated()
+		logger.Info("Configured notifications", "bucket", bucket.Name, "notifications", len(bucket.Notifications))
+	}
+}
+
+// currentNotifications returns a bucket's notifications in the form they are configured in.
+// S3 generates an ID for notifications configured without one and capitalizes the names of
+// filter rules, so those are left out of the comparison.
+func currentNotifications(want *types.NotificationConfiguration, output *s3.GetBucketNotificationConfigurationOutput) *types.NotificationConfiguration {
+	current := &types.NotificationConfiguration{
+		TopicConfigurations:          slices.Clone(output.TopicConfigurations),
+		QueueConfigurations:          slices.Clone(output.QueueConfigurations),
+		LambdaFunctionConfigurations: slices.Clone(output.LambdaFunctionConfigurations),
+	}
+	for i := range current.TopicConfigurations {
+		if i < len(want.TopicConfigurations) && want.TopicConfigurations[i].Id == nil {
+			current.TopicConfigurations[i].Id = nil
+		}
+		current.TopicConfigurations[i].Filter = lowerFilterRuleNames(current.TopicConfigurations[i].Filter)
+	}
+	for i := range current.QueueConfigurations {
+		if i < len(want.QueueConfigurations) && want.QueueConfigurations[i].Id == nil {
+			current.QueueConfigurations[i].Id = nil
+		}
+		current.QueueConfigurations[i].Filter = lowerFilterRuleNames(current.QueueConfigurations[i].Filter)
+	}
+	for i := range current.LambdaFunctionConfigurations {
+		if i < len(want.LambdaFunctionConfigurations) && want.LambdaFunctionConfigurations[i].Id == nil {
+			current.LambdaFunctionConfigurations[i].Id = nil
+		}
+		current.LambdaFunctionConfigurations[i].Filter = lowerFilterRuleNames(current.LambdaFunctionConfigurations[i].Filter)
+	}
+	return current
+}
+
+// lowerFilterRuleNames returns a copy of a notification filter with the rule names in the
+// lower case they are configured in
+func lowerFilterRuleNames(filter *types.NotificationConfigurationFilter) *types.NotificationConfigurationFilter {
+	if filter == nil || filter.Key == nil {
+		return filter
+	}
+	rules := make([]types.FilterRule, 0, len(filter.Key.FilterRules))
+	for _, rule := range filter.Key.FilterRules {
+		rule.Name = types.FilterRuleName(strings.ToLower(string(rule.Name)))
+		rules = append(rules, rule)
+	}
+	return &types.NotificationConfigurationFilter{Key: &types.S3KeyFilter{FilterRules: rules}}
+}
+
+// ensureBucketPolicy sets the bucket policy, skipping the write when the bucket already has
+// an equivalent one
+func (b *Bootstrapper) ensureBucketPolicy(ctx context.Context, bucket S3Bucket, policy string, res *ResourceResult) {
+	if res.Action != ActionCreated {
+		output, err := b.s3Client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket.Name)})
+		if err == nil && jsonEqual(aws.ToString(output.Policy), policy) {
+			logger.Debug("Bucket policy already in the desired state", "bucket", bucket.Name)
+			return
+		}
+	}
+
+	_, err := b.s3Client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(bucket.Name),
+		Policy: aws.String(policy),
+	})
+	if err != nil {
+		res.warnf("failed to set policy for bucket %s: %v", bucket.Name, err)
+		return
+	}
+	res.updated()
+	logger.Info("Set bucket policy", "bucket", bucket.Name)
+}
@@ -0,0 +1,108 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// schemaDialect is the JSON Schema version of the generated schema
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// ConfigSchema returns a JSON Schema for configuration files, for editors and YAML
+// language servers to autocomplete and check them. It is derived from Config and the
+// structs it contains: properties are named by their yaml tags, and a schema tag marks a
+// field required or lists the values it accepts, e.g. `schema:"required,enum=rsa|ed25519"`.
+// Each struct becomes a definition under $defs.
+func ConfigSchema() ([]byte, error) {
+	g := &schemaGenerator{defs: map[string]any{}}
+	root := g.structSchema(reflect.TypeFor[Config]())
+	root["$schema"] = schemaDialect
+	root["title"] = "cloud-bootstrap configuration"
+	root["$defs"] = g.defs
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// schemaGenerator collects the definitions of the structs reached from Config
+type schemaGenerator struct {
+	defs map[string]any
+}
+
+// typeSchema returns the schema of values of type t
+func (g *schemaGenerator) typeSchema(t reflect.Type) map[string]any {
+	// CORSRules decodes both a list of rules and a single rule
+	if t == reflect.TypeFor[CORSRules]() {
+		rule := g.typeSchema(t.Elem())
+		return map[string]any{"anyOf": []any{map[string]any{"type": "array", "items": rule}, rule}}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		// Definitions are added before they are filled in, so structs that refer to
+		// themselves do not recurse forever
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = map[string]any{}
+			g.defs[t.Name()] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+// structSchema returns the schema of an object with the exported fields of struct t
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		property := g.typeSchema(field.Type)
+		for option := range strings.SplitSeq(field.Tag.Get("schema"), ",") {
+			key, value, _ := strings.Cut(option, "=")
+			switch key {
+			case "":
+			case "required":
+				required = append(required, name)
+			case "enum":
+				property["enum"] = strings.Split(value, "|")
+			default:
+				panic(fmt.Sprintf("unknown schema option %q on %s.%s", option, t.Name(), field.Name))
+			}
+		}
+		properties[name] = property
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,216 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Character classes for generated RDS master passwords. RDS rejects '/', '@', '"' and
+// spaces; quotes, backslashes and backticks are left out as well so the password can be
+// pasted into a shell or connection string without escaping.
+const (
+	passwordLower   = "abcdefghijklmnopqrstuvwxyz"
+	passwordUpper   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	passwordDigits  = "0123456789"
+	passwordSymbols = "!#$%^&*()-_=+[]{}:,.?~"
+)
+
+// defaultPasswordLength is used for engines that allow passwords at least this long
+const defaultPasswordLength = 32
+
+// rdsSecret is the JSON layout of secrets written by the bootstrapper. It matches the
+// layout RDS itself uses for managed master user secrets.
+type rdsSecret struct {
+	Username             string `json:"username,omitempty"`
+	Password             string `json:"password"`
+	Engine               string `json:"engine,omitempty"`
+	DBInstanceIdentifier string `json:"dbInstanceIdentifier,omitempty"`
+}
+
+// masterPasswordSecretName returns the name of the secret a generated password is stored in
+func (i RDSInstance) masterPasswordSecretName() string {
+	if i.MasterPasswordSecretName != "" {
+		return i.MasterPasswordSecretName
+	}
+	return fmt.Sprintf("rds/%s/master-password", i.Identifier)
+}
+
+// generatesPassword reports whether creating the instance stores a generated master
+// password in a new Secrets Manager secret
+func (i RDSInstance) generatesPassword() bool {
+	return i.MasterPassword == "" && i.MasterPasswordSecret == ""
+}
+
+// resolveRDSMasterPassword returns the master password for a new RDS instance. It uses the
+// configured password, fetches it from master_password_secret, or generates a new password
+// and stores it in Secrets Manager, in that order.
+func (b *Bootstrapper) resolveRDSMasterPassword(ctx context.Context, instance RDSInstance) (string, error) {
+	if instance.MasterPassword != "" && instance.MasterPasswordSecret != "" {
+		return "", fmt.Errorf("only one of master_password or master_password_secret may be set for RDS instance %s", instance.Identifier)
+	}
+	if instance.MasterPassword != "" {
+		return instance.MasterPassword, nil
+	}
+	if instance.MasterPasswordSecret != "" {
+		return b.fetchRDSMasterPassword(ctx, instance.MasterPasswordSecret)
+	}
+
+	password, err := generateRDSPassword(instance.Engine)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate master password for RDS instance %s: %w", instance.Identifier, err)
+	}
+
+	// Store the password before creating the instance so it is never lost
+	if err := b.storeRDSMasterPassword(ctx, instance, password); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// fetchRDSMasterPassword reads a password from an existing secret. The secret may hold the
+// password as plain text or as a JSON object with a "password" key.
+func (b *Bootstrapper) fetchRDSMasterPassword(ctx context.Context, secretID string) (string, error) {
+	output, err := b.secretsClient.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", secretID, err)
+	}
+
+	value := aws.ToString(output.SecretString)
+	var secret rdsSecret
+	if strings.HasPrefix(strings.TrimSpace(value), "{") && json.Unmarshal([]byte(value), &secret) == nil {
+		value = secret.Password
+	}
+	if value == "" {
+		return "", fmt.Errorf("secret %s does not contain a password", secretID)
+	}
+
+	logger.Info("Using master password from secret", "secret", aws.ToString(output.ARN))
+	return value, nil
+}
+
+// storeRDSMasterPassword writes a generated password to Secrets Manager, replacing the
+// value of the secret if it already exists
+func (b *Bootstrapper) storeRDSMasterPassword(ctx context.Context, instance RDSInstance, password string) error {
+	secretName := instance.masterPasswordSecretName()
+	value, err := json.Marshal(rdsSecret{
+		Username:             instance.MasterUsername,
+		Password:             password,
+		Engine:               instance.Engine,
+		DBInstanceIdentifier: instance.Identifier,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode secret %s: %w", secretName, err)
+	}
+
+	createInput := &secretsmanager.CreateSecretInput{
+		Name:         aws.String(secretName),
+		Description:  aws.String(fmt.Sprintf("Master password for RDS instance %s", instance.Identifier)),
+		SecretString: aws.String(string(value)),
+	}
+	// The secret carries the same tags as the instance it belongs to
+	if len(instance.Tags) > 0 {
+		createInput.Tags = buildSecretTags(instance.Tags)
+	}
+
+	createOutput, err := b.secretsClient.CreateSecret(ctx, createInput)
+	if err == nil {
+		logger.Info("Stored generated master password in secret", "secret", aws.ToString(createOutput.ARN))
+		return nil
+	}
+	if !isAPIError[*smtypes.ResourceExistsException](err) {
+		return fmt.Errorf("failed to create secret %s: %w", secretName, err)
+	}
+
+	putOutput, err := b.secretsClient.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(secretName),
+		SecretString: aws.String(string(value)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update secret %s: %w", secretName, err)
+	}
+	logger.Info("Stored generated master password in existing secret", "secret", aws.ToString(putOutput.ARN))
+	return nil
+}
+
+// buildSecretTags converts a tag map into Secrets Manager tags sorted by key
+func buildSecretTags(tags map[string]string) []smtypes.Tag {
+	result := make([]smtypes.Tag, 0, len(tags))
+	for _, key := range sortedKeys(tags) {
+		result = append(result, smtypes.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+	return result
+}
+
+// rdsPasswordLength returns the generated password length for an engine, staying within
+// the maximum master password length RDS allows for it
+func rdsPasswordLength(engine string) int {
+	switch {
+	case strings.HasPrefix(engine, "oracle"):
+		return 30
+	default:
+		// MySQL and MariaDB allow 41 characters; PostgreSQL and SQL Server allow 128
+		return defaultPasswordLength
+	}
+}
+
+// generateRDSPassword returns a random password accepted by the given engine. It always
+// starts with a letter and contains at least one lowercase letter, uppercase letter, digit
+// and symbol.
+func generateRDSPassword(engine string) (string, error) {
+	return generatePassword(rdsPasswordLength(engine), passwordSymbols)
+}
+
+// generatePassword returns a random password of the given length that starts with a letter
+// and contains at least one lowercase letter, uppercase letter, digit and one of symbols
+func generatePassword(length int, symbols string) (string, error) {
+	all := passwordLower + passwordUpper + passwordDigits + symbols
+
+	// Fill one character from each class, then the rest from the full set
+	classes := []string{passwordLower + passwordUpper, passwordLower, passwordUpper, passwordDigits, symbols}
+	password := make([]byte, length)
+	for i := range password {
+		charset := all
+		if i < len(classes) {
+			charset = classes[i]
+		}
+		c, err := randomChar(charset)
+		if err != nil {
+			return "", err
+		}
+		password[i] = c
+	}
+
+	// Shuffle everything after the leading letter so the required classes aren't in fixed positions
+	for i := length - 1; i > 1; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i)))
+		if err != nil {
+			return "", err
+		}
+		j := int(n.Int64()) + 1
+		password[i], password[j] = password[j], password[i]
+	}
+
+	return string(password), nil
+}
+
+// randomChar picks a uniformly random character from charset
+func randomChar(charset string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+	if err != nil {
+		return 0, err
+	}
+	return charset[n.Int64()], nil
+}
@@ -0,0 +1,337 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var (
+	// vpcIDPattern and securityGroupIDPattern tell EC2 IDs apart from the names of
+	// resources in the config
+	vpcIDPattern           = regexp.MustCompile(`^vpc-[0-9a-f]{8,17}$`)
+	securityGroupIDPattern = regexp.MustCompile(`^sg-[0-9a-f]{8,17}$`)
+)
+
+// allProtocols is the IP protocol EC2 uses for rules that allow all traffic
+const allProtocols = "-1"
+
+// securityGroupPermission is a rule for one protocol, port range and source or
+// destination, the unit in which configured and current rules are compared
+type securityGroupPermission struct {
+	Protocol string
+	FromPort int32
+	ToPort   int32
+	CIDR     string
+	GroupID  string
+}
+
+// CreateSecurityGroups creates the configured security groups in their VPCs and makes
+// their rules match the configuration, authorizing missing rules and revoking the rest
+func (b *Bootstrapper) CreateSecurityGroups(ctx context.Context, groups []SecurityGroup) ([]ResourceResult, error) {
+	var results []ResourceResult
+	for _, group := range groups {
+		// Stop before starting the next resource if the run was cancelled or timed out
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+		res := newResourceResult(ResourceTypeSecurityGroup, group.Name)
+		err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+			return b.ensureSecurityGroup(ctx, group, res)
+		})
+		results = append(results, res.finish(err))
+		if err != nil && !b.tolerate(err) {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// ensureSecurityGroup creates the security group if its VPC has no group with the name,
+// then reconciles its ingress rules and, when configured, its egress rules
+func (b *Bootstrapper) ensureSecurityGroup(ctx context.Context, group SecurityGroup, res *ResourceResult) error {
+	logger.Info("Ensuring security group", "security_group", group.Name)
+
+	vpcID, err := b.resolveVPCID(ctx, group.VPC)
+	if err != nil {
+		return fmt.Errorf("failed to resolve VPC of security group %s: %w", group.Name, err)
+	}
+	existing, err := b.findSecurityGroup(ctx, vpcID, group.Name)
+	if err != nil {
+		return err
+	}
+
+	var groupID string
+	var ingress, egress []ec2types.IpPermission
+	if existing == nil {
+		created, err := b.ec2Client.CreateSecurityGroup(ctx, &ec2.CreateSecurityGroupInput{
+			GroupName:         aws.String(group.Name),
+			Description:       aws.String(group.description()),
+			VpcId:             aws.String(vpcID),
+			TagSpecifications: ec2TagSpecifications(ec2types.ResourceTypeSecurityGroup, group.Name, group.Tags),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create security group %s: %w", group.Name, err)
+		}
+		res.created()
+		groupID = aws.ToString(created.GroupId)
+		res.ARN = aws.ToString(created.SecurityGroupArn)
+		// A new group starts with the default rule allowing all outbound traffic
+		egress = []ec2types.IpPermission{{
+			IpProtocol: aws.String(allProtocols),
+			IpRanges:   []ec2types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+		}}
+		logger.Info("Created security group", "security_group", group.Name, "group_id", groupID)
+	} else {
+		groupID = aws.ToString(existing.GroupId)
+		res.ARN = aws.ToString(existing.SecurityGroupArn)
+		ingress, egress = existing.IpPermissions, existing.IpPermissionsEgress
+		logger.Info("Security group already exists", "security_group", group.Name, "group_id", groupID)
+		// Its rules are left as they are too
+		if group.IfNotExists {
+			leaveExisting(res)
+			return nil
+		}
+		if group.Description != "" && aws.ToString(existing.Description) != group.Description {
+			res.warnf("security group %s has description %q; the description cannot be changed", group.Name, aws.ToString(existing.Description))
+		}
+		if len(group.Tags) > 0 {
+			b.tagEC2Resource(ctx, groupID, "security group "+group.Name, group.Tags, res)
+		}
+	}
+
+	resolve := func(ref string) (string, error) {
+		return b.resolveSecurityGroupID(ctx, group, vpcID, groupID, ref)
+	}
+	if err := b.syncSecurityGroupRules(ctx, group, groupID, false, ingress, group.Ingress, resolve, res); err != nil {
+		return err
+	}
+	if len(group.Egress) > 0 {
+		return b.syncSecurityGroupRules(ctx, group, groupID, true, egress, group.Egress, resolve, res)
+	}
+	return nil
+}
+
+// description returns the configured description, or one naming the group
+func (g SecurityGroup) description() string {
+	if g.Description != "" {
+		return g.Description
+	}
+	return fmt.Sprintf("Security group %s", g.Name)
+}
+
+// findSecurityGroup returns the security group of the VPC with the name, or nil when there
+// is none
+func (b *Bootstrapper) findSecurityGroup(ctx context.Context, vpcID, name string) (*ec2types.SecurityGroup, error) {
+	output, err := b.ec2Client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: []ec2types.Filter{
+			{Name: aws.String("vpc-id"), Values: []string{vpcID}},
+			{Name: aws.String("group-name"), Values: []string{name}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up security group %s: %w", name, err)
+	}
+	if len(output.SecurityGroups) == 0 {
+		return nil, nil
+	}
+	return &output.SecurityGroups[0], nil
+}
+
+// resolveVPCID returns the ID of a VPC given by ID or by the name it is tagged with
+func (b *Bootstrapper) resolveVPCID(ctx context.Context, vpc string) (string, error) {
+	if vpcIDPattern.MatchString(vpc) {
+		return vpc, nil
+	}
+	existing, err := b.findVPC(ctx, vpc)
+	if err != nil {
+		return "", err
+	}
+	if existing == nil {
+		return "", fmt.Errorf("VPC %s not found", vpc)
+	}
+	return aws.ToString(existing.VpcId), nil
+}
+
+// resolveSecurityGroupID returns the ID of a security group a rule refers to by ID, or by
+// name in the VPC of the group being reconciled, which may be the group itself
+func (b *Bootstrapper) resolveSecurityGroupID(ctx context.Context, group SecurityGroup, vpcID, groupID, ref string) (string, error) {
+	if securityGroupIDPattern.MatchString(ref) {
+		return ref, nil
+	}
+	if ref == group.Name {
+		return groupID, nil
+	}
+	source, err := b.findSecurityGroup(ctx, vpcID, ref)
+	if err != nil {
+		return "", err
+	}
+	if source == nil {
+		return "", fmt.Errorf("security group %s referenced by security group %s not found in its VPC", ref, group.Name)
+	}
+	return aws.ToString(source.GroupId), nil
+}
+
+// syncSecurityGroupRules authorizes the configured permissions the group lacks and revokes
+// the ones it has that are not configured. Rules for prefix lists are left alone.
+func (b *Bootstrapper) syncSecurityGroupRules(ctx context.Context, group SecurityGroup, groupID string, egress bool,
+	current []ec2types.IpPermission, rules []SecurityGroupRule, resolve func(string) (string, error), res *ResourceResult) error {
+	direction := "ingress"
+	if egress {
+		direction = "egress"
+	}
+
+	want, descriptions, err := desiredPermissions(rules, resolve)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s rules of security group %s: %w", direction, group.Name, err)
+	}
+	have := currentPermissions(current)
+
+	var authorize, revoke []ec2types.IpPermission
+	for _, permission := range want {
+		if !slices.Contains(have, permission) {
+			authorize = append(authorize, permission.ipPermission(descriptions[permission]))
+		}
+	}
+	for _, permission := range have {
+		if !slices.Contains(want, permission) {
+			revoke = append(revoke, permission.ipPermission(""))
+		}
+	}
+
+	if len(authorize) > 0 {
+		if egress {
+			_, err = b.ec2Client.AuthorizeSecurityGroupEgress(ctx, &ec2.AuthorizeSecurityGroupEgressInput{GroupId: aws.String(groupID), IpPermissions: authorize})
+		} else {
+			_, err = b.ec2Client.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{GroupId: aws.String(groupID), IpPermissions: authorize})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to authorize %s rules of security group %s: %w", direction, group.Name, err)
+		}
+		res.updated()
+		logger.Info("Authorized security group rules", "security_group", group.Name, "direction", direction, "rules", len(authorize))
+	}
+	if len(revoke) > 0 {
+		if egress {
+			_, err = b.ec2Client.RevokeSecurityGroupEgress(ctx, &ec2.RevokeSecurityGroupEgressInput{GroupId: aws.String(groupID), IpPermissions: revoke})
+		} else {
+			_, err = b.ec2Client.RevokeSecurityGroupIngress(ctx, &ec2.RevokeSecurityGroupIngressInput{GroupId: aws.String(groupID), IpPermissions: revoke})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to revoke %s rules of security group %s: %w", direction, group.Name, err)
+		}
+		res.updated()
+		logger.Info("Revoked security group rules", "security_group", group.Name, "direction", direction, "rules", len(revoke))
+	}
+	return nil
+}
+
+// desiredPermissions flattens the configured rules into one permission per source or
+// destination, with the description of the rule each came from
+func desiredPermissions(rules []SecurityGroupRule, resolve func(string) (string, error)) ([]securityGroupPermission, map[securityGroupPermission]string, error) {
+	var permissions []securityGroupPermission
+	descriptions := make(map[securityGroupPermission]string)
+	add := func(permission securityGroupPermission, description string) {
+		if !slices.Contains(permissions, permission) {
+			permissions = append(permissions, permission)
+			descriptions[permission] = description
+		}
+	}
+
+	for _, rule := range rules {
+		base := rule.permission()
+		for _, cidr := range rule.CIDRBlocks {
+			permission := base
+			permission.CIDR = cidr
+			add(permission, rule.Description)
+		}
+		for _, ref := range rule.SecurityGroups {
+			groupID, err := resolve(ref)
+			if err != nil {
+				return nil, nil, err
+			}
+			permission := base
+			permission.GroupID = groupID
+			add(permission, rule.Description)
+		}
+	}
+	return permissions, descriptions, nil
+}
+
+// currentPermissions flattens the rules of a security group into one permission per
+// source or destination
+func currentPermissions(ipPermissions []ec2types.IpPermission) []securityGroupPermission {
+	var permissions []securityGroupPermission
+	for _, ipPermission := range ipPermissions {
+		base := securityGroupPermission{Protocol: strings.ToLower(aws.ToString(ipPermission.IpProtocol))}
+		if base.Protocol != allProtocols {
+			base.FromPort = aws.ToInt32(ipPermission.FromPort)
+			base.ToPort = aws.ToInt32(ipPermission.ToPort)
+		}
+		for _, ipRange := range ipPermission.IpRanges {
+			permission := base
+			permission.CIDR = aws.ToString(ipRange.CidrIp)
+			permissions = append(permissions, permission)
+		}
+		for _, ipRange := range ipPermission.Ipv6Ranges {
+			permission := base
+			permission.CIDR = aws.ToString(ipRange.CidrIpv6)
+			permissions = append(permissions, permission)
+		}
+		for _, pair := range ipPermission.UserIdGroupPairs {
+			permission := base
+			permission.GroupID = aws.ToString(pair.GroupId)
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// permission returns the protocol and port range of the rule as EC2 reports them
+func (r SecurityGroupRule) permission() securityGroupPermission {
+	protocol := strings.ToLower(r.Protocol)
+	if protocol == "all" || protocol == allProtocols {
+		return securityGroupPermission{Protocol: allProtocols}
+	}
+	from, to := r.FromPort, r.ToPort
+	if r.Port != 0 {
+		from, to = r.Port, r.Port
+	}
+	return securityGroupPermission{Protocol: protocol, FromPort: int32(from), ToPort: int32(to)}
+}
+
+// ipPermission converts the permission into the form the EC2 API takes
+func (p securityGroupPermission) ipPermission(description string) ec2types.IpPermission {
+	ipPermission := ec2types.IpPermission{IpProtocol: aws.String(p.Protocol)}
+	if p.Protocol != allProtocols {
+		ipPermission.FromPort = aws.Int32(p.FromPort)
+		ipPermission.ToPort = aws.Int32(p.ToPort)
+	}
+	var desc *string
+	if description != "" {
+		desc = aws.String(description)
+	}
+
+	switch {
+	case p.GroupID != "":
+		ipPermission.UserIdGroupPairs = []ec2types.UserIdGroupPair{{GroupId: aws.String(p.GroupID), Description: desc}}
+	case isIPv6CIDR(p.CIDR):
+		ipPermission.Ipv6Ranges = []ec2types.Ipv6Range{{CidrIpv6: aws.String(p.CIDR), Description: desc}}
+	default:
+		ipPermission.IpRanges = []ec2types.IpRange{{CidrIp: aws.String(p.CIDR), Description: desc}}
+	}
+	return ipPermission
+}
+
+// isIPv6CIDR reports whether a CIDR block is an IPv6 block
+func isIPv6CIDR(cidr string) bool {
+	ip, _, err := net.ParseCIDR(cidr)
+	return err == nil && ip.To4() == nil
+}
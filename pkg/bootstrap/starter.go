@@ -0,0 +1,43 @@
+package bootstrap
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// starterConfig is the commented example configuration written by WriteStarterConfig
+//
+//go:embed starter.yaml
+var starterConfig []byte
+
+// StarterConfig returns a commented example configuration that defines one of each
+// resource type
+func StarterConfig() []byte {
+	return append([]byte(nil), starterConfig...)
+}
+
+// WriteStarterConfig writes the starter configuration to path. An existing file is only
+// replaced when overwrite is set.
+func WriteStarterConfig(path string, overwrite bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+
+	file, err := os.OpenFile(path, flags, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists; use -force to overwrite it", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	if _, err := file.Write(starterConfig); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,248 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateVersion is the version of the state file format written by SaveState
+const stateVersion = 1
+
+// State is the manifest of resources the bootstrapper has provisioned, persisted between
+// runs so that resources dropped from the configuration can be found again
+type State struct {
+	Version   int             `json:"version"`
+	Resources []StateResource `json:"resources"`
+}
+
+// StateResource records the last known outcome for a single managed resource
+type StateResource struct {
+	Type      string         `json:"type"`
+	Name      string         `json:"name"`
+	ARN       string         `json:"arn,omitempty"`
+	Action    ResourceAction `json:"action"`
+	Timestamp time.Time      `json:"timestamp"`
+	// ConfigHash is the hash of the configuration last applied without failures or
+	// warnings; incremental runs skip the resource while its configuration hashes the same
+	ConfigHash string `json:"config_hash,omitempty"`
+}
+
+// LoadState reads a state file. A missing file is not an error and yields an empty state,
+// so the first run with a new state path starts from scratch.
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &State{Version: stateVersion}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if state.Version != stateVersion {
+		return nil, fmt.Errorf("state file %s has unsupported version %d", path, state.Version)
+	}
+	return &state, nil
+}
+
+// Save writes the state to path. The file is written to a temporary file first and
+// renamed into place so an interrupted write never corrupts the previous state.
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// Record updates the state with the results of a provisioning run. Resources from earlier
+// runs are kept, including ones no longer in the configuration, so they can still be
+// reported as orphans. Failed resources keep whatever was recorded for them before, unless
+// this run created them. Only resources applied without warnings record their config hash,
+// so incremental runs check the others again.
+func (s *State) Record(result *ProvisionResult, now time.Time) {
+	index := make(map[string]int, len(s.Resources))
+	for i, res := range s.Resources {
+		index[stateKey(res.Type, res.Name)] = i
+	}
+
+	for _, res := range result.Resources {
+		if res.Action == ActionFailed && !res.wasCreated {
+			// The resource may not exist, so keep whatever was recorded before
+			continue
+		}
+
+		entry := StateResource{
+			Type:      res.Type,
+			Name:      res.Name,
+			ARN:       res.ARN,
+			Action:    res.Action,
+			Timestamp: now.UTC(),
+		}
+		if res.Action != ActionFailed && res.Action != ActionRolledBack && len(res.Warnings) == 0 {
+			entry.ConfigHash = res.configHash
+		}
+		if i, known := index[stateKey(res.Type, res.Name)]; known {
+			if entry.ARN == "" {
+				entry.ARN = s.Resources[i].ARN
+			}
+			s.Resources[i] = entry
+		} else {
+			index[stateKey(res.Type, res.Name)] = len(s.Resources)
+			s.Resources = append(s.Resources, entry)
+		}
+	}
+}
+
+// Orphans returns the resources recorded in the state that no longer appear in config
+func (s *State) Orphans(config *Config) []StateResource {
+	configured := configuredKeys(config)
+	var orphans []StateResource
+	for _, res := range s.Resources {
+		if !configured[stateKey(res.Type, res.Name)] {
+			orphans = append(orphans, res)
+		}
+	}
+	return orphans
+}
+
+// OrphanedConfig returns a config holding only the orphans of config, so they can be
+// deleted with DestroyResources. The state only records names, so RDS instances keep the
+// default of taking a final snapshot, and customer-managed policies created for IAM users
+// and groups are detached but not deleted. Orphans of types DestroyResources does not
+// delete are left out; UnprunableOrphans returns them.
+func (s *State) OrphanedConfig(config *Config) *Config {
+	orphaned := &Config{Region: config.Region, ResourceRoles: config.ResourceRoles}
+	for _, res := range s.Orphans(config) {
+		switch res.Type {
+		case ResourceTypeS3:
+			orphaned.S3Buckets = append(orphaned.S3Buckets, S3Bucket{Name: res.Name})
+		case ResourceTypeECR:
+			orphaned.ECRRepositories = append(orphaned.ECRRepositories, ECRRepository{Name: res.Name})
+		case ResourceTypeIAMGroup:
+			orphaned.IAMGroups = append(orphaned.IAMGroups, IAMGroup{Name: res.Name})
+		case ResourceTypeIAM:
+			orphaned.IAMUsers = append(orphaned.IAMUsers, IAMUser{Name: res.Name})
+		case ResourceTypeRDS:
+			orphaned.RDSInstances = append(orphaned.RDSInstances, RDSInstance{Identifier: res.Name})
+		}
+	}
+	return orphaned
+}
+
+// UnprunableOrphans returns the orphans of config that OrphanedConfig leaves out because
+// DestroyResources does not delete their type, so they have to be deleted by hand
+func (s *State) UnprunableOrphans(config *Config) []StateResource {
+	var unprunable []StateResource
+	for _, res := range s.Orphans(config) {
+		if _, ok := destroyedTypes[res.Type]; !ok {
+			unprunable = append(unprunable, res)
+		}
+	}
+	return unprunable
+}
+
+// Forget removes the resources in config from the state, for example after they have
+// been destroyed
+func (s *State) Forget(config *Config) {
+	configured := configuredKeys(config)
+	kept := s.Resources[:0]
+	for _, res := range s.Resources {
+		if !configured[stateKey(res.Type, res.Name)] {
+			kept = append(kept, res)
+		}
+	}
+	s.Resources = kept
+}
+
+// ForgetDestroyed removes the resources DestroyResources deletes for config from the state.
+// Disabled resources and resources of the types it leaves in place stay recorded, since
+// they still exist.
+func (s *State) ForgetDestroyed(config *Config) {
+	configured := configuredKeys(config.withoutDisabled())
+	kept := s.Resources[:0]
+	for _, res := range s.Resources {
+		_, destroyed := destroyedTypes[res.Type]
+		if !destroyed || !configured[stateKey(res.Type, res.Name)] {
+			kept = append(kept, res)
+		}
+	}
+	s.Resources = kept
+}
+
+// configuredKeys returns the state keys of every resource in config
+func configuredKeys(config *Config) map[string]bool {
+	configured := make(map[string]bool)
+	for _, bucket := range config.S3Buckets {
+		configured[stateKey(ResourceTypeS3, bucket.Name)] = true
+	}
+	for _, repo := range config.ECRRepositories {
+		configured[stateKey(ResourceTypeECR, repo.Name)] = true
+	}
+	for _, group := range config.IAMGroups {
+		configured[stateKey(ResourceTypeIAMGroup, group.Name)] = true
+	}
+	for _, user := range config.IAMUsers {
+		configured[stateKey(ResourceTypeIAM, user.Name)] = true
+	}
+	for _, instance := range config.RDSInstances {
+		configured[stateKey(ResourceTypeRDS, instance.Identifier)] = true
+	}
+	for _, cluster := range config.AuroraClusters {
+		configured[stateKey(ResourceTypeAurora, cluster.Identifier)] = true
+	}
+	for _, zone := range config.HostedZones {
+		configured[stateKey(ResourceTypeHostedZone, zone.Name)] = true
+	}
+	for _, certificate := range config.Certificates {
+		configured[stateKey(ResourceTypeCertificate, certificate.DomainName)] = true
+	}
+	for _, function := range config.LambdaFunctions {
+		configured[stateKey(ResourceTypeLambda, function.Name)] = true
+	}
+	for _, vpc := range config.VPCs {
+		configured[stateKey(ResourceTypeVPC, vpc.Name)] = true
+	}
+	for _, keyPair := range config.KeyPairs {
+		configured[stateKey(ResourceTypeKeyPair, keyPair.Name)] = true
+	}
+	for _, group := range config.SecurityGroups {
+		configured[stateKey(ResourceTypeSecurityGroup, group.Name)] = true
+	}
+	for _, rule := range config.EventBridgeRules {
+		configured[stateKey(ResourceTypeEventBridgeRule, rule.Name)] = true
+	}
+	if config.PasswordPolicy != nil {
+		configured[stateKey(ResourceTypePasswordPolicy, passwordPolicyName)] = true
+	}
+	return configured
+}
+
+// stateKey identifies a resource by type and name
+func stateKey(resourceType, name string) string {
+	return resourceType + "/" + name
+}
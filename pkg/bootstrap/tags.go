@@ -0,0 +1,191 @@
+package bootstrap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// mergeTags combines global tags with a resource's own tags. Local tags win on key
+// conflicts. The result is nil when neither map has any tags.
+func mergeTags(global, local map[string]string) map[string]string {
+	if len(global) == 0 && len(local) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]string, len(global)+len(local))
+	for key, value := range global {
+		merged[key] = value
+	}
+	for key, value := range local {
+		merged[key] = value
+	}
+	return merged
+}
+
+// withGlobalTags returns a copy of the config with the top-level tags merged into every
+// taggable resource. The receiver is not modified.
+func (c *Config) withGlobalTags() *Config {
+	if len(c.Tags) == 0 {
+		return c
+	}
+
+	merged := *c
+	merged.S3Buckets = append([]S3Bucket(nil), c.S3Buckets...)
+	for i := range merged.S3Buckets {
+		merged.S3Buckets[i].Tags = mergeTags(c.Tags, merged.S3Buckets[i].Tags)
+	}
+	merged.ECRRepositories = append([]ECRRepository(nil), c.ECRRepositories...)
+	for i := range merged.ECRRepositories {
+		merged.ECRRepositories[i].Tags = mergeTags(c.Tags, merged.ECRRepositories[i].Tags)
+	}
+	merged.IAMGroups = append([]IAMGroup(nil), c.IAMGroups...)
+	for i := range merged.IAMGroups {
+		merged.IAMGroups[i].Policies = policiesWithTags(c.Tags, merged.IAMGroups[i].Policies)
+	}
+	merged.IAMUsers = append([]IAMUser(nil), c.IAMUsers...)
+	for i := range merged.IAMUsers {
+		merged.IAMUsers[i].Tags = mergeTags(c.Tags, merged.IAMUsers[i].Tags)
+		merged.IAMUsers[i].Policies = policiesWithTags(c.Tags, merged.IAMUsers[i].Policies)
+	}
+	merged.RDSInstances = append([]RDSInstance(nil), c.RDSInstances...)
+	for i := range merged.RDSInstances {
+		merged.RDSInstances[i].Tags = mergeTags(c.Tags, merged.RDSInstances[i].Tags)
+	}
+	merged.AuroraClusters = append([]AuroraCluster(nil), c.AuroraClusters...)
+	for i := range merged.AuroraClusters {
+		merged.AuroraClusters[i].Tags = mergeTags(c.Tags, merged.AuroraClusters[i].Tags)
+	}
+	merged.Certificates = append([]Certificate(nil), c.Certificates...)
+	for i := range merged.Certificates {
+		merged.Certificates[i].Tags = mergeTags(c.Tags, merged.Certificates[i].Tags)
+	}
+	merged.LambdaFunctions = append([]LambdaFunction(nil), c.LambdaFunctions...)
+	for i := range merged.LambdaFunctions {
+		merged.LambdaFunctions[i].Tags = mergeTags(c.Tags, merged.LambdaFunctions[i].Tags)
+	}
+	merged.VPCs = append([]VPC(nil), c.VPCs...)
+	for i := range merged.VPCs {
+		merged.VPCs[i].Tags = mergeTags(c.Tags, merged.VPCs[i].Tags)
+	}
+	merged.KeyPairs = append([]KeyPair(nil), c.KeyPairs...)
+	for i := range merged.KeyPairs {
+		merged.KeyPairs[i].Tags = mergeTags(c.Tags, merged.KeyPairs[i].Tags)
+	}
+	merged.SecurityGroups = append([]SecurityGroup(nil), c.SecurityGroups...)
+	for i := range merged.SecurityGroups {
+		merged.SecurityGroups[i].Tags = mergeTags(c.Tags, merged.SecurityGroups[i].Tags)
+	}
+	merged.EventBridgeRules = append([]EventBridgeRule(nil), c.EventBridgeRules...)
+	for i := range merged.EventBridgeRules {
+		merged.EventBridgeRules[i].Tags = mergeTags(c.Tags, merged.EventBridgeRules[i].Tags)
+	}
+	return &merged
+}
+
+// validateRequiredTags checks that every taggable resource has each of the required_tags
+// keys, counting the top-level tags. IAM policies are checked when they are created from a
+// policy document, since policies referenced by ARN are not tagged.
+func (c *Config) validateRequiredTags(v *validator) {
+	if len(c.RequiredTags) == 0 {
+		return
+	}
+	for i, key := range c.RequiredTags {
+		if strings.TrimSpace(key) == "" {
+			v.addf(fmt.Sprintf("required_tags[%d]", i), "must not be empty")
+		}
+	}
+
+	merged := c.withGlobalTags()
+	check := func(path, resource string, tags map[string]string) {
+		var missing []string
+		for _, key := range c.RequiredTags {
+			if _, ok := tags[key]; !ok && strings.TrimSpace(key) != "" {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			v.addf(path+".tags", "%s is missing required tags: %s", resource, strings.Join(missing, ", "))
+		}
+	}
+	checkPolicies := func(path, owner string, policies []IAMPolicy) {
+		for j, policy := range policies {
+			if policy.PolicyDocument != "" {
+				check(fmt.Sprintf("%s.policies[%d]", path, j), fmt.Sprintf("IAM policy %s of %s", policy.Name, owner), policy.Tags)
+			}
+		}
+	}
+
+	for i, bucket := range merged.S3Buckets {
+		check(fmt.Sprintf("s3_buckets[%d]", i), "S3 bucket "+bucket.Name, bucket.Tags)
+	}
+	for i, repo := range merged.ECRRepositories {
+		check(fmt.Sprintf("ecr_repositories[%d]", i), "ECR repository "+repo.Name, repo.Tags)
+	}
+	for i, group := range merged.IAMGroups {
+		checkPolicies(fmt.Sprintf("iam_groups[%d]", i), "IAM group "+group.Name, group.Policies)
+	}
+	for i, user := range merged.IAMUsers {
+		path := fmt.Sprintf("iam_users[%d]", i)
+		check(path, "IAM user "+user.Name, user.Tags)
+		checkPolicies(path, "IAM user "+user.Name, user.Policies)
+	}
+	for i, instance := range merged.RDSInstances {
+		check(fmt.Sprintf("rds_instances[%d]", i), "RDS instance "+instance.Identifier, instance.Tags)
+	}
+	for i, cluster := range merged.AuroraClusters {
+		check(fmt.Sprintf("aurora_clusters[%d]", i), "Aurora cluster "+cluster.Identifier, cluster.Tags)
+	}
+	for i, certificate := range merged.Certificates {
+		check(fmt.Sprintf("certificates[%d]", i), "certificate "+certificate.DomainName, certificate.Tags)
+	}
+	for i, function := range merged.LambdaFunctions {
+		check(fmt.Sprintf("lambda_functions[%d]", i), "Lambda function "+function.Name, function.Tags)
+	}
+	for i, vpc := range merged.VPCs {
+		check(fmt.Sprintf("vpcs[%d]", i), "VPC "+vpc.Name, vpc.Tags)
+	}
+	for i, keyPair := range merged.KeyPairs {
+		check(fmt.Sprintf("key_pairs[%d]", i), "key pair "+keyPair.Name, keyPair.Tags)
+	}
+	for i, group := range merged.SecurityGroups {
+		check(fmt.Sprintf("security_groups[%d]", i), "security group "+group.Name, group.Tags)
+	}
+	for i, rule := range merged.EventBridgeRules {
+		check(fmt.Sprintf("eventbridge_rules[%d]", i), "EventBridge rule "+rule.Name, rule.Tags)
+	}
+}
+
+// policiesWithTags returns a copy of the policies with the global tags merged into those
+// created from a policy document. Policies referenced by ARN are not tagged.
+func policiesWithTags(global map[string]string, policies []IAMPolicy) []IAMPolicy {
+	merged := append([]IAMPolicy(nil), policies...)
+	for i := range merged {
+		if merged[i].PolicyDocument != "" {
+			merged[i].Tags = mergeTags(global, merged[i].Tags)
+		}
+	}
+	return merged
+}
+
+// staleTagKeys returns the keys of current tags that are not in the configured tags, sorted
+func staleTagKeys(current, want map[string]string) []string {
+	var stale []string
+	for _, key := range sortedKeys(current) {
+		if _, ok := want[key]; !ok {
+			stale = append(stale, key)
+		}
+	}
+	return stale
+}
+
+// sortedKeys returns the keys of a tag map in sorted order so that repeated runs
+// produce identical API requests
+func sortedKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
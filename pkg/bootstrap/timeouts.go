@@ -0,0 +1,91 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// defaultTimeouts bound how long provisioning one resource of each type may take when
+// timeouts has no entry for it. Types that wait for AWS, such as RDS instances becoming
+// available or certificates being issued, get enough time for those waits.
+var defaultTimeouts = map[string]time.Duration{
+	ResourceTypeS3:              30 * time.Second,
+	ResourceTypeECR:             30 * time.Second,
+	ResourceTypeIAM:             30 * time.Second,
+	ResourceTypeIAMGroup:        30 * time.Second,
+	ResourceTypePasswordPolicy:  30 * time.Second,
+	ResourceTypeKeyPair:         30 * time.Second,
+	ResourceTypeSecurityGroup:   30 * time.Second,
+	ResourceTypeEventBridgeRule: 30 * time.Second,
+	ResourceTypeHostedZone:      2 * time.Minute,
+	ResourceTypeLambda:          10 * time.Minute,
+	ResourceTypeVPC:             10 * time.Minute,
+	ResourceTypeCertificate:     45 * time.Minute,
+	ResourceTypeRDS:             90 * time.Minute,
+	ResourceTypeAurora:          90 * time.Minute,
+}
+
+// validateTimeouts checks the keys and durations of timeouts
+func (c *Config) validateTimeouts(v *validator) {
+	for _, key := range slices.Sorted(maps.Keys(c.Timeouts)) {
+		path := "timeouts." + key
+		if _, err := parseSelectors([]string{key}); err != nil {
+			v.addf(path, "%v", err)
+			continue
+		}
+		if timeout, err := time.ParseDuration(c.Timeouts[key]); err != nil || timeout <= 0 {
+			v.addf(path, "must be a positive duration such as 90s or 5m, got %q", c.Timeouts[key])
+		}
+	}
+}
+
+// resourceTimeout returns how long provisioning the resource may take. A type:name key
+// wins over a key that selects only the type, which wins over one that selects several,
+// such as iam.
+func (b *Bootstrapper) resourceTimeout(resourceType, name string) time.Duration {
+	timeout := defaultTimeouts[resourceType]
+	rank := 0
+	for key, value := range b.timeouts {
+		selectors, err := parseSelectors([]string{key})
+		if err != nil || !selectors[0].matches(resourceType, name) {
+			continue
+		}
+		keyRank := 1
+		if selectors[0].name != "" {
+			keyRank = 3
+		} else if len(selectors[0].types) == 1 {
+			keyRank = 2
+		}
+		if keyRank <= rank {
+			continue
+		}
+		if parsed, err := time.ParseDuration(value); err == nil {
+			timeout, rank = parsed, keyRank
+		}
+	}
+	return timeout
+}
+
+// withResourceTimeout provisions the resource of res with fn, under a context that expires
+// after the resource's timeout. When the timeout fires the error names the resource; the
+// caller then stops or, with continue-on-error, goes on with the next resource.
+func (b *Bootstrapper) withResourceTimeout(ctx context.Context, res *ResourceResult, fn func(ctx context.Context) error) error {
+	timeout := b.resourceTimeout(res.Type, res.Name)
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	resourceCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(resourceCtx)
+	// Only this resource's own deadline counts; an interrupt or the -timeout of the whole
+	// run is reported as it is
+	if err != nil && ctx.Err() == nil && errors.Is(resourceCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s %s timed out after %s: %w", res.Type, res.Name, timeout, err)
+	}
+	return err
+}
@@ -1,64 +1,720 @@
 package bootstrap
 
+import (
+	"bytes"
+	"encoding/json"
+
+	"gopkg.in/yaml.v3"
+)
+
 // Config represents the AWS resources configuration
 type Config struct {
-	Region          string          `yaml:"region"`
-	S3Buckets       []S3Bucket      `yaml:"s3_buckets"`
-	ECRRepositories []ECRRepository `yaml:"ecr_repositories"`
-	IAMUsers        []IAMUser       `yaml:"iam_users"`
-	RDSInstances    []RDSInstance   `yaml:"rds_instances,omitempty"`
+	Region          string           `yaml:"region" json:"region" schema:"required"`
+	S3Buckets       []S3Bucket       `yaml:"s3_buckets" json:"s3_buckets"`
+	ECRRepositories []ECRRepository  `yaml:"ecr_repositories" json:"ecr_repositories"`
+	IAMGroups       []IAMGroup       `yaml:"iam_groups,omitempty" json:"iam_groups,omitempty"`
+	IAMUsers        []IAMUser        `yaml:"iam_users" json:"iam_users"`
+	RDSInstances    []RDSInstance    `yaml:"rds_instances,omitempty" json:"rds_instances,omitempty"`
+	AuroraClusters  []AuroraCluster  `yaml:"aurora_clusters,omitempty" json:"aurora_clusters,omitempty"`
+	HostedZones     []HostedZone     `yaml:"hosted_zones,omitempty" json:"hosted_zones,omitempty"`
+	Certificates    []Certificate    `yaml:"certificates,omitempty" json:"certificates,omitempty"`
+	LambdaFunctions []LambdaFunction `yaml:"lambda_functions,omitempty" json:"lambda_functions,omitempty"`
+	VPCs            []VPC            `yaml:"vpcs,omitempty" json:"vpcs,omitempty"`
+	KeyPairs        []KeyPair        `yaml:"key_pairs,omitempty" json:"key_pairs,omitempty"`
+	SecurityGroups  []SecurityGroup  `yaml:"security_groups,omitempty" json:"security_groups,omitempty"`
+
+	EventBridgeRules []EventBridgeRule `yaml:"eventbridge_rules,omitempty" json:"eventbridge_rules,omitempty"`
+
+	// PasswordPolicy is the account password policy, applied before any IAM user so that
+	// console passwords created in the same run follow it
+	PasswordPolicy *PasswordPolicy `yaml:"password_policy,omitempty" json:"password_policy,omitempty"`
+
+	// Tags are applied to every taggable resource. Tags set on a resource take
+	// precedence over these on key conflicts.
+	Tags map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// RequiredTags are tag keys every taggable resource must have once the top-level tags
+	// are merged in; validation fails for resources that miss any of them
+	RequiredTags []string `yaml:"required_tags,omitempty" json:"required_tags,omitempty"`
+
+	// AssumeRoleARN is a role to assume for all AWS calls, optionally with an external ID
+	// and session name. The -assume-role-arn flag overrides it.
+	AssumeRoleARN   string `yaml:"assume_role_arn,omitempty" json:"assume_role_arn,omitempty"`
+	ExternalID      string `yaml:"external_id,omitempty" json:"external_id,omitempty"`
+	RoleSessionName string `yaml:"role_session_name,omitempty" json:"role_session_name,omitempty"`
+	// MFASerial is the MFA device required by the assumed role; the code is read from
+	// stdin unless the -mfa-token flag is given
+	MFASerial string `yaml:"mfa_serial,omitempty" json:"mfa_serial,omitempty"`
+
+	// ResourceRoles provision some resource types with another role, usually in another
+	// account, keyed by the type names accepted by -only (s3, rds, iam, ...). A type name
+	// that selects a single type takes precedence over iam. Types without an entry use the
+	// session's own credentials.
+	ResourceRoles map[string]ResourceRole `yaml:"resource_roles,omitempty" json:"resource_roles,omitempty"`
+
+	// Timeouts bound how long provisioning a single resource may take, keyed like
+	// resource_roles or by type:name for one resource, with durations such as 5m. Types
+	// without an entry use a default that suits them, from 30s for S3 to 90m for RDS.
+	Timeouts map[string]string `yaml:"timeouts,omitempty" json:"timeouts,omitempty"`
+
+	// RetryMaxAttempts and RetryMode tune how throttled or failed AWS calls are retried;
+	// they default to 3 attempts in standard mode
+	RetryMaxAttempts int    `yaml:"retry_max_attempts,omitempty" json:"retry_max_attempts,omitempty"`
+	RetryMode        string `yaml:"retry_mode,omitempty" json:"retry_mode,omitempty" schema:"enum=standard|adaptive"`
+}
+
+// Empty reports whether the config defines no resources
+func (c *Config) Empty() bool {
+	return len(c.S3Buckets) == 0 && len(c.ECRRepositories) == 0 && len(c.IAMGroups) == 0 &&
+		len(c.IAMUsers) == 0 && len(c.RDSInstances) == 0 && len(c.AuroraClusters) == 0 &&
+		len(c.HostedZones) == 0 && len(c.Certificates) == 0 && len(c.LambdaFunctions) == 0 &&
+		len(c.VPCs) == 0 && len(c.KeyPairs) == 0 && len(c.SecurityGroups) == 0 &&
+		len(c.EventBridgeRules) == 0 && c.PasswordPolicy == nil
+}
+
+// ResourceRole is a role assumed, on top of the session's credentials, for the resources of
+// one type. Either AssumeRoleARN or Account and RoleName are set.
+type ResourceRole struct {
+	AssumeRoleARN string `yaml:"assume_role_arn,omitempty" json:"assume_role_arn,omitempty"`
+	// Account is the 12-digit ID of the account the role is in; together with RoleName it
+	// stands in for the role ARN
+	Account  string `yaml:"account,omitempty" json:"account,omitempty"`
+	RoleName string `yaml:"role_name,omitempty" json:"role_name,omitempty"`
+
+	ExternalID      string `yaml:"external_id,omitempty" json:"external_id,omitempty"`
+	RoleSessionName string `yaml:"role_session_name,omitempty" json:"role_session_name,omitempty"`
+}
+
+// PasswordPolicy is the IAM password policy of the account. Settings left out take the
+// IAM defaults rather than keeping their current values.
+type PasswordPolicy struct {
+	// MinimumLength is the minimum password length, 6 to 128; IAM defaults to 8
+	MinimumLength    int  `yaml:"minimum_length,omitempty" json:"minimum_length,omitempty"`
+	RequireSymbols   bool `yaml:"require_symbols,omitempty" json:"require_symbols,omitempty"`
+	RequireNumbers   bool `yaml:"require_numbers,omitempty" json:"require_numbers,omitempty"`
+	RequireUppercase bool `yaml:"require_uppercase,omitempty" json:"require_uppercase,omitempty"`
+	RequireLowercase bool `yaml:"require_lowercase,omitempty" json:"require_lowercase,omitempty"`
+	// AllowUsersToChangePassword lets users change their own password and defaults to true
+	AllowUsersToChangePassword *bool `yaml:"allow_users_to_change_password,omitempty" json:"allow_users_to_change_password,omitempty"`
+	// MaxAgeDays is how many days a password is valid, up to 1095; 0 means passwords never expire
+	MaxAgeDays int `yaml:"max_age_days,omitempty" json:"max_age_days,omitempty"`
+	// ReusePrevention is how many previous passwords cannot be reused, up to 24
+	ReusePrevention int `yaml:"reuse_prevention,omitempty" json:"reuse_prevention,omitempty"`
+	// HardExpiry stops users from setting a new password once theirs has expired, so an
+	// administrator has to reset it. It requires max_age_days.
+	HardExpiry bool `yaml:"hard_expiry,omitempty" json:"hard_expiry,omitempty"`
+
+	// IfNotExists set to true only sets the policy when the account has none; an existing
+	// policy is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
 }
 
 // S3Bucket represents an S3 bucket configuration
 type S3Bucket struct {
-	Name       string      `yaml:"name"`
-	Versioning string      `yaml:"versioning"`
-	Encryption string      `yaml:"encryption"`
-	CORS       *CORSConfig `yaml:"cors,omitempty"`
-	Policy     string      `yaml:"policy,omitempty"`
+	Name       string    `yaml:"name" json:"name" schema:"required"`
+	Versioning string    `yaml:"versioning" json:"versioning" schema:"enum=enabled|suspended"`
+	Encryption string    `yaml:"encryption" json:"encryption" schema:"enum=AES256|aws:kms"`
+	KMSKeyID   string    `yaml:"kms_key_id,omitempty" json:"kms_key_id,omitempty"`
+	CORS       CORSRules `yaml:"cors,omitempty" json:"cors,omitempty"`
+	Policy     string    `yaml:"policy,omitempty" json:"policy,omitempty"`
+	PolicyFile string    `yaml:"policy_file,omitempty" json:"policy_file,omitempty"`
+
+	LifecycleRules []S3LifecycleRule `yaml:"lifecycle_rules,omitempty" json:"lifecycle_rules,omitempty"`
+	Tags           map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// ObjectOwnership is BucketOwnerEnforced, BucketOwnerPreferred or ObjectWriter. New
+	// buckets default to BucketOwnerEnforced, which disables ACLs.
+	ObjectOwnership string `yaml:"object_ownership,omitempty" json:"object_ownership,omitempty" schema:"enum=BucketOwnerEnforced|BucketOwnerPreferred|ObjectWriter"`
+	// ACL is a canned bucket ACL: private, public-read, public-read-write or authenticated-read
+	ACL string `yaml:"acl,omitempty" json:"acl,omitempty" schema:"enum=private|public-read|public-read-write|authenticated-read"`
+
+	// ObjectLock enables Object Lock with a default retention. It can only be turned on
+	// when the bucket is created.
+	ObjectLock *S3ObjectLock `yaml:"object_lock,omitempty" json:"object_lock,omitempty"`
+
+	// Replication copies new objects to another bucket. It requires versioning, which is
+	// enabled automatically when versioning is not set.
+	Replication *S3Replication `yaml:"replication,omitempty" json:"replication,omitempty"`
+
+	// Notifications publish bucket events to SNS topics, SQS queues or Lambda functions
+	Notifications []S3Notification `yaml:"notifications,omitempty" json:"notifications,omitempty"`
+
+	// TransferAcceleration enables or suspends S3 Transfer Acceleration; unset leaves it as it is
+	TransferAcceleration *bool `yaml:"transfer_acceleration,omitempty" json:"transfer_acceleration,omitempty"`
+	// RequestPayer is BucketOwner or Requester, who pays for requests and downloads
+	RequestPayer string `yaml:"request_payer,omitempty" json:"request_payer,omitempty" schema:"enum=BucketOwner|Requester"`
+
+	// AccessPoints are S3 access points that give groups of clients their own entry point
+	// and policy for the bucket
+	AccessPoints []S3AccessPoint `yaml:"access_points,omitempty" json:"access_points,omitempty"`
+
+	// Region creates the bucket in another region than the config's, for example for a
+	// replica. It is provisioned with clients for that region.
+	Region string `yaml:"region,omitempty" json:"region,omitempty"`
+
+	// Enabled set to false skips the bucket without removing it from the config
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// IfNotExists set to true only creates the bucket; an existing one is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
+}
+
+// S3AccessPoint represents an access point of an S3 bucket. The network origin is fixed
+// when the access point is created: with VPCID set it only accepts requests from that VPC,
+// otherwise it accepts requests from the internet.
+type S3AccessPoint struct {
+	Name   string `yaml:"name" json:"name" schema:"required"`
+	VPCID  string `yaml:"vpc_id,omitempty" json:"vpc_id,omitempty"`
+	Policy string `yaml:"policy,omitempty" json:"policy,omitempty"`
+}
+
+// S3Notification represents an event notification of an S3 bucket. Exactly one of Topic,
+// Queue or LambdaFunction is set to the ARN of the destination.
+type S3Notification struct {
+	ID             string   `yaml:"id,omitempty" json:"id,omitempty"`
+	Topic          string   `yaml:"topic,omitempty" json:"topic,omitempty"`
+	Queue          string   `yaml:"queue,omitempty" json:"queue,omitempty"`
+	LambdaFunction string   `yaml:"lambda_function,omitempty" json:"lambda_function,omitempty"`
+	Events         []string `yaml:"events" json:"events" schema:"required"` // e.g. s3:ObjectCreated:*
+	Prefix         string   `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	Suffix         string   `yaml:"suffix,omitempty" json:"suffix,omitempty"`
+}
+
+// S3Replication represents the replication configuration of an S3 bucket
+type S3Replication struct {
+	// Role is the ARN of the IAM role S3 assumes to replicate objects
+	Role string `yaml:"role" json:"role" schema:"required"`
+	// DestinationBucket is the ARN of the bucket objects are replicated to
+	DestinationBucket string `yaml:"destination_bucket" json:"destination_bucket" schema:"required"`
+	// StorageClass optionally overrides the storage class of the replicas
+	StorageClass string `yaml:"storage_class,omitempty" json:"storage_class,omitempty"`
+	// Prefixes limits replication to objects under these key prefixes; each gets its own
+	// rule. Everything is replicated when it is empty.
+	Prefixes []string `yaml:"prefixes,omitempty" json:"prefixes,omitempty"`
+}
+
+// S3ObjectLock represents the Object Lock default retention for an S3 bucket
+type S3ObjectLock struct {
+	Mode          string `yaml:"mode" json:"mode" schema:"required,enum=GOVERNANCE|COMPLIANCE"` // GOVERNANCE or COMPLIANCE
+	RetentionDays int    `yaml:"retention_days" json:"retention_days" schema:"required"`
 }
 
-// CORSConfig represents CORS configuration for an S3 bucket
+// S3LifecycleRule represents a lifecycle rule for an S3 bucket
+type S3LifecycleRule struct {
+	ID                              string                  `yaml:"id" json:"id" schema:"required"`
+	Prefix                          string                  `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	ExpirationDays                  int                     `yaml:"expiration_days,omitempty" json:"expiration_days,omitempty"`
+	Transitions                     []S3LifecycleTransition `yaml:"transitions,omitempty" json:"transitions,omitempty"`
+	NoncurrentVersionExpirationDays int                     `yaml:"noncurrent_version_expiration_days,omitempty" json:"noncurrent_version_expiration_days,omitempty"`
+}
+
+// S3LifecycleTransition represents a storage class transition within a lifecycle rule
+type S3LifecycleTransition struct {
+	Days         int    `yaml:"days" json:"days"`
+	StorageClass string `yaml:"storage_class" json:"storage_class"`
+}
+
+// CORSRules is the list of CORS rules for an S3 bucket. For backward compatibility it can be
+// written in YAML either as a list of rules or as a single rule object.
+type CORSRules []CORSConfig
+
+// UnmarshalYAML accepts both the single-object and the list form of the cors setting
+func (r *CORSRules) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		var rule CORSConfig
+		if err := value.Decode(&rule); err != nil {
+			return err
+		}
+		*r = CORSRules{rule}
+		return nil
+	}
+
+	var rules []CORSConfig
+	if err := value.Decode(&rules); err != nil {
+		return err
+	}
+	*r = rules
+	return nil
+}
+
+// UnmarshalJSON accepts both the single-object and the list form of the cors setting
+func (r *CORSRules) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var rule CORSConfig
+		if err := json.Unmarshal(data, &rule); err != nil {
+			return err
+		}
+		*r = CORSRules{rule}
+		return nil
+	}
+
+	var rules []CORSConfig
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return err
+	}
+	*r = rules
+	return nil
+}
+
+// CORSConfig represents a single CORS rule for an S3 bucket
 type CORSConfig struct {
-	AllowedOrigins []string `yaml:"allowed_origins"`
-	AllowedMethods []string `yaml:"allowed_methods"`
-	AllowedHeaders []string `yaml:"allowed_headers"`
-	ExposeHeaders  []string `yaml:"expose_headers,omitempty"`
-	MaxAgeSeconds  int      `yaml:"max_age_seconds"`
+	AllowedOrigins []string `yaml:"allowed_origins" json:"allowed_origins" schema:"required"`
+	AllowedMethods []string `yaml:"allowed_methods" json:"allowed_methods" schema:"required"`
+	AllowedHeaders []string `yaml:"allowed_headers,omitempty" json:"allowed_headers,omitempty"`
+	ExposeHeaders  []string `yaml:"expose_headers,omitempty" json:"expose_headers,omitempty"`
+	MaxAgeSeconds  int      `yaml:"max_age_seconds" json:"max_age_seconds"`
 }
 
 // ECRRepository represents an ECR repository configuration
 type ECRRepository struct {
-	Name           string `yaml:"name"`
-	LifecyclePolicy string `yaml:"lifecycle_policy,omitempty"`
+	Name            string `yaml:"name" json:"name" schema:"required"`
+	LifecyclePolicy string `yaml:"lifecycle_policy,omitempty" json:"lifecycle_policy,omitempty"`
+	// LifecyclePolicyFile reads the lifecycle policy from a file, relative to the config file
+	LifecyclePolicyFile string `yaml:"lifecycle_policy_file,omitempty" json:"lifecycle_policy_file,omitempty"`
+
+	// RepositoryPolicy is a raw JSON repository policy. PullAccountIDs is a shorthand that
+	// grants the listed AWS accounts pull access; only one of the two may be set.
+	RepositoryPolicy string   `yaml:"repository_policy,omitempty" json:"repository_policy,omitempty"`
+	PullAccountIDs   []string `yaml:"pull_account_ids,omitempty" json:"pull_account_ids,omitempty"`
+
+	// Encryption can only be set when the repository is created
+	Encryption *ECREncryption `yaml:"encryption,omitempty" json:"encryption,omitempty"`
+
+	// ImageTagMutability is MUTABLE or IMMUTABLE, which stops a tag from being pushed again
+	// for another image. ScanOnPush scans every pushed image for vulnerabilities. Unset,
+	// both are left as they are on existing repositories.
+	ImageTagMutability string `yaml:"image_tag_mutability,omitempty" json:"image_tag_mutability,omitempty" schema:"enum=MUTABLE|IMMUTABLE"`
+	ScanOnPush         *bool  `yaml:"scan_on_push,omitempty" json:"scan_on_push,omitempty"`
+
+	Tags map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// Region creates the repository in another region than the config's. It is
+	// provisioned with clients for that region.
+	Region string `yaml:"region,omitempty" json:"region,omitempty"`
+
+	// Enabled set to false skips the repository without removing it from the config
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// IfNotExists set to true only creates the repository; an existing one is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
+}
+
+// ECREncryption represents the encryption settings of an ECR repository
+type ECREncryption struct {
+	// Type is AES256 (the default) or KMS
+	Type string `yaml:"type" json:"type" schema:"enum=AES256|KMS"`
+	// KMSKey is an optional KMS key ARN; without it ECR uses the AWS managed key
+	KMSKey string `yaml:"kms_key,omitempty" json:"kms_key,omitempty"`
 }
 
 // IAMUser represents an IAM user configuration
 type IAMUser struct {
-	Name     string      `yaml:"name"`
-	Policies []IAMPolicy `yaml:"policies"`
+	Name     string      `yaml:"name" json:"name" schema:"required"`
+	Policies []IAMPolicy `yaml:"policies" json:"policies"`
+
+	// Groups lists the IAM groups the user belongs to. When set, the user is also removed
+	// from any group not listed; when omitted, group membership is left unmanaged.
+	Groups []string `yaml:"groups,omitempty" json:"groups,omitempty"`
+
+	// InlinePolicies are embedded directly in the user. Inline policies not listed here
+	// are removed from the user.
+	InlinePolicies []IAMInlinePolicy `yaml:"inline_policies,omitempty" json:"inline_policies,omitempty"`
+	// PermissionBoundary is the ARN of the managed policy used as the user's permissions
+	// boundary. An existing boundary is removed when this is empty.
+	PermissionBoundary string `yaml:"permission_boundary,omitempty" json:"permission_boundary,omitempty"`
+	// ConsoleAccess gives the user a console password. When omitted, an existing console
+	// password is removed.
+	ConsoleAccess *IAMConsoleAccess `yaml:"console_access,omitempty" json:"console_access,omitempty"`
+
+	Tags map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// Enabled set to false skips the user without removing it from the config
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// IfNotExists set to true only creates the user; an existing one is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
+}
+
+// IAMConsoleAccess configures the console password (login profile) of an IAM user
+type IAMConsoleAccess struct {
+	// Password is the initial password. When empty a password meeting the account password
+	// policy is generated and written to the -credentials-out file. The password of an
+	// existing login profile is never changed.
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+	// PasswordResetRequired makes the user choose a new password at the next sign-in
+	PasswordResetRequired bool `yaml:"password_reset_required,omitempty" json:"password_reset_required,omitempty"`
 }
 
-// IAMPolicy represents an IAM policy configuration
+// generatesPassword reports whether the user's console password is generated
+func (u IAMUser) generatesPassword() bool {
+	return u.ConsoleAccess != nil && u.ConsoleAccess.Password == ""
+}
+
+// IAMInlinePolicy represents an inline policy embedded in an IAM user
+type IAMInlinePolicy struct {
+	Name           string `yaml:"name" json:"name" schema:"required"`
+	PolicyDocument string `yaml:"policy_document" json:"policy_document" schema:"required"`
+}
+
+// IAMGroup represents an IAM group configuration
+type IAMGroup struct {
+	Name     string      `yaml:"name" json:"name" schema:"required"`
+	Policies []IAMPolicy `yaml:"policies,omitempty" json:"policies,omitempty"`
+
+	// Enabled set to false skips the group without removing it from the config
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// IfNotExists set to true only creates the group; an existing one is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
+}
+
+// IAMPolicy represents an IAM policy configuration. Either PolicyDocument is set and a
+// customer-managed policy is created, or PolicyArn references an existing managed policy.
 type IAMPolicy struct {
-	Name           string `yaml:"name"`
-	Description    string `yaml:"description"`
-	PolicyDocument string `yaml:"policy_document"`
+	Name           string `yaml:"name" json:"name" schema:"required"`
+	Description    string `yaml:"description" json:"description"`
+	PolicyDocument string `yaml:"policy_document,omitempty" json:"policy_document,omitempty"`
+	PolicyArn      string `yaml:"policy_arn,omitempty" json:"policy_arn,omitempty"`
+	// Tags are set on the policy created from policy_document
+	Tags map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// Simulate checks the decisions IAM makes for the user once the policy is attached. It
+	// is only supported on the policies of IAM users.
+	Simulate *IAMPolicySimulation `yaml:"simulate,omitempty" json:"simulate,omitempty"`
+}
+
+// IAMPolicySimulation lists the decisions a user's policies are expected to make
+type IAMPolicySimulation struct {
+	Checks []IAMSimulationCheck `yaml:"checks" json:"checks" schema:"required"`
+	// WarnOnly reports a mismatch as a warning instead of failing the user
+	WarnOnly bool `yaml:"warn_only,omitempty" json:"warn_only,omitempty"`
+}
+
+// IAMSimulationCheck is an action on a resource and the expected decision, allowed or denied
+type IAMSimulationCheck struct {
+	Action string `yaml:"action" json:"action" schema:"required"`
+	// Resource is the ARN the action is simulated on; it defaults to *
+	Resource string `yaml:"resource,omitempty" json:"resource,omitempty"`
+	Expect   string `yaml:"expect" json:"expect" schema:"required,enum=allowed|denied"`
 }
 
 // RDSInstance represents an RDS database instance configuration
 type RDSInstance struct {
-	Identifier       string `yaml:"identifier"`
-	Engine           string `yaml:"engine"`
-	EngineVersion    string `yaml:"engine_version,omitempty"`
-	InstanceClass    string `yaml:"instance_class"`
-	StorageType      string `yaml:"storage_type,omitempty"`
-	AllocatedStorage int    `yaml:"allocated_storage"`
-	DBName           string `yaml:"db_name"`
-	MasterUsername   string `yaml:"master_username,omitempty"`
-	MasterPassword   string `yaml:"master_password,omitempty"`
-	PubliclyAccessible bool  `yaml:"publicly_accessible,omitempty"`
-	BackupRetentionPeriod int `yaml:"backup_retention_period,omitempty"`
-	MultiAZ          bool   `yaml:"multi_az,omitempty"`
-	SkipFinalSnapshot bool  `yaml:"skip_final_snapshot,omitempty"`
+	Identifier            string `yaml:"identifier" json:"identifier" schema:"required"`
+	Engine                string `yaml:"engine" json:"engine" schema:"required"`
+	EngineVersion         string `yaml:"engine_version,omitempty" json:"engine_version,omitempty"`
+	InstanceClass         string `yaml:"instance_class" json:"instance_class" schema:"required"`
+	StorageType           string `yaml:"storage_type,omitempty" json:"storage_type,omitempty"`
+	AllocatedStorage      int    `yaml:"allocated_storage" json:"allocated_storage" schema:"required"`
+	DBName                string `yaml:"db_name" json:"db_name"`
+	MasterUsername        string `yaml:"master_username,omitempty" json:"master_username,omitempty"`
+	MasterPassword        string `yaml:"master_password,omitempty" json:"master_password,omitempty"`
+	PubliclyAccessible    bool   `yaml:"publicly_accessible,omitempty" json:"publicly_accessible,omitempty"`
+	BackupRetentionPeriod int    `yaml:"backup_retention_period,omitempty" json:"backup_retention_period,omitempty"`
+	MultiAZ               bool   `yaml:"multi_az,omitempty" json:"multi_az,omitempty"`
+	SkipFinalSnapshot     bool   `yaml:"skip_final_snapshot,omitempty" json:"skip_final_snapshot,omitempty"`
+	// FinalSnapshotIdentifier names the snapshot taken when the instance is deleted; it
+	// defaults to <identifier>-final-<timestamp>
+	FinalSnapshotIdentifier string `yaml:"final_snapshot_identifier,omitempty" json:"final_snapshot_identifier,omitempty"`
+	DeletionProtection      bool   `yaml:"deletion_protection,omitempty" json:"deletion_protection,omitempty"`
+	WaitForAvailable        bool   `yaml:"wait_for_available,omitempty" json:"wait_for_available,omitempty"`
+	// removeProtection turns deletion protection off before the instance is deleted. It is
+	// only set when rolling back, since deletion protection is what keeps -destroy away.
+	removeProtection bool
+	// DesiredState is running or stopped; the instance is started or stopped to match.
+	// When empty the instance is left in whatever state it is in. With wait_for_available
+	// the run waits for the desired state instead.
+	DesiredState string `yaml:"desired_state,omitempty" json:"desired_state,omitempty" schema:"enum=running|stopped"`
+
+	Tags map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// ApplyImmediately controls whether modifications are applied right away (the default)
+	// or deferred to the next maintenance window
+	ApplyImmediately *bool `yaml:"apply_immediately,omitempty" json:"apply_immediately,omitempty"`
+
+	// MasterPasswordSecret names an existing Secrets Manager secret holding the master password.
+	// When neither it nor MasterPassword is set, a password is generated and stored in a new
+	// secret named MasterPasswordSecretName (default "rds/<identifier>/master-password").
+	MasterPasswordSecret     string `yaml:"master_password_secret,omitempty" json:"master_password_secret,omitempty"`
+	MasterPasswordSecretName string `yaml:"master_password_secret_name,omitempty" json:"master_password_secret_name,omitempty"`
+
+	// DBSubnetGroupName and VPCSecurityGroupIDs place a new instance in a VPC. SubnetGroup
+	// defines the subnet group inline instead; it is created if it does not exist.
+	DBSubnetGroupName   string          `yaml:"db_subnet_group_name,omitempty" json:"db_subnet_group_name,omitempty"`
+	SubnetGroup         *RDSSubnetGroup `yaml:"subnet_group,omitempty" json:"subnet_group,omitempty"`
+	VPCSecurityGroupIDs []string        `yaml:"vpc_security_group_ids,omitempty" json:"vpc_security_group_ids,omitempty"`
+
+	// DBParameterGroupName attaches an existing parameter group. ParameterGroup defines the
+	// group inline instead; it is created if needed and its parameters are reconciled.
+	DBParameterGroupName string             `yaml:"db_parameter_group_name,omitempty" json:"db_parameter_group_name,omitempty"`
+	ParameterGroup       *RDSParameterGroup `yaml:"parameter_group,omitempty" json:"parameter_group,omitempty"`
+
+	// Enabled set to false skips the instance without removing it from the config
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// IfNotExists set to true only creates the instance; an existing one is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
+}
+
+// RDSParameterGroup represents a DB parameter group defined alongside an RDS instance
+type RDSParameterGroup struct {
+	Name        string            `yaml:"name" json:"name" schema:"required"`
+	Family      string            `yaml:"family" json:"family" schema:"required"` // e.g. postgres16
+	Description string            `yaml:"description,omitempty" json:"description,omitempty"`
+	Parameters  map[string]string `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+}
+
+// RDSSubnetGroup represents a DB subnet group defined alongside an RDS instance
+type RDSSubnetGroup struct {
+	Name        string `yaml:"name" json:"name" schema:"required"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// SubnetIDs are subnet IDs or <vpc>/<subnet> references to subnets of a VPC created by
+	// this tool
+	SubnetIDs []string `yaml:"subnet_ids" json:"subnet_ids" schema:"required"`
+}
+
+// AuroraCluster represents an Aurora DB cluster and the DB instances that belong to it
+type AuroraCluster struct {
+	Identifier            string `yaml:"identifier" json:"identifier" schema:"required"`
+	Engine                string `yaml:"engine" json:"engine" schema:"required,enum=aurora-mysql|aurora-postgresql"` // aurora-mysql or aurora-postgresql
+	EngineVersion         string `yaml:"engine_version,omitempty" json:"engine_version,omitempty"`
+	DBName                string `yaml:"db_name,omitempty" json:"db_name,omitempty"`
+	MasterUsername        string `yaml:"master_username" json:"master_username" schema:"required"`
+	MasterPassword        string `yaml:"master_password,omitempty" json:"master_password,omitempty"`
+	BackupRetentionPeriod int    `yaml:"backup_retention_period,omitempty" json:"backup_retention_period,omitempty"`
+	DeletionProtection    bool   `yaml:"deletion_protection,omitempty" json:"deletion_protection,omitempty"`
+
+	Instances []AuroraInstance `yaml:"instances" json:"instances"`
+
+	Tags map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// MasterPasswordSecret and MasterPasswordSecretName work as they do for RDS instances
+	MasterPasswordSecret     string `yaml:"master_password_secret,omitempty" json:"master_password_secret,omitempty"`
+	MasterPasswordSecretName string `yaml:"master_password_secret_name,omitempty" json:"master_password_secret_name,omitempty"`
+
+	// Enabled set to false skips the cluster without removing it from the config
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// IfNotExists set to true only creates the cluster; an existing one is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
+}
+
+// AuroraInstance represents a DB instance that is a member of an Aurora cluster
+type AuroraInstance struct {
+	Identifier         string `yaml:"identifier" json:"identifier" schema:"required"`
+	InstanceClass      string `yaml:"instance_class" json:"instance_class" schema:"required"`
+	PubliclyAccessible bool   `yaml:"publicly_accessible,omitempty" json:"publicly_accessible,omitempty"`
+}
+
+// HostedZone represents a Route53 hosted zone and the records kept in it. An existing zone
+// with the same name and visibility is reused rather than creating a duplicate.
+type HostedZone struct {
+	Name    string `yaml:"name" json:"name" schema:"required"` // domain name, e.g. example.com
+	Comment string `yaml:"comment,omitempty" json:"comment,omitempty"`
+
+	// Private zones are only visible from the VPC they are associated with. VPCRegion
+	// defaults to the config region.
+	Private   bool   `yaml:"private,omitempty" json:"private,omitempty"`
+	VPCID     string `yaml:"vpc_id,omitempty" json:"vpc_id,omitempty"`
+	VPCRegion string `yaml:"vpc_region,omitempty" json:"vpc_region,omitempty"`
+
+	Records []DNSRecord `yaml:"records,omitempty" json:"records,omitempty"`
+
+	// Enabled set to false skips the zone without removing it from the config
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// IfNotExists set to true only creates the zone; an existing one is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
+}
+
+// DNSRecord represents a record set in a hosted zone. Names are relative to the zone unless
+// they end in the zone name; an empty name or "@" is the zone apex. Exactly one of Values
+// or Alias is set.
+type DNSRecord struct {
+	Name   string    `yaml:"name,omitempty" json:"name,omitempty"`
+	Type   string    `yaml:"type" json:"type" schema:"required,enum=A|AAAA|CAA|CNAME|DS|MX|NAPTR|NS|PTR|SOA|SPF|SRV|TXT"` // A, AAAA, CNAME, MX, TXT, ...
+	TTL    int64     `yaml:"ttl,omitempty" json:"ttl,omitempty"`
+	Values []string  `yaml:"values,omitempty" json:"values,omitempty"`
+	Alias  *DNSAlias `yaml:"alias,omitempty" json:"alias,omitempty"`
+}
+
+// Certificate represents an ACM certificate. With DNS validation, the validation records
+// are created in the hosted zones of the config that the domains belong to.
+type Certificate struct {
+	DomainName              string   `yaml:"domain_name" json:"domain_name" schema:"required"`
+	SubjectAlternativeNames []string `yaml:"subject_alternative_names,omitempty" json:"subject_alternative_names,omitempty"`
+	ValidationMethod        string   `yaml:"validation_method,omitempty" json:"validation_method,omitempty" schema:"enum=DNS|EMAIL"` // DNS (default) or EMAIL
+
+	// WaitForValidation blocks until the certificate is issued
+	WaitForValidation bool `yaml:"wait_for_validation,omitempty" json:"wait_for_validation,omitempty"`
+
+	Tags map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// Enabled set to false skips the certificate without removing it from the config
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// IfNotExists set to true only creates the certificate; an existing one is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
+}
+
+// LambdaFunction represents a Lambda function deployed from a local zip file or a container
+// image. Exactly one of ZipFile or ImageURI is set.
+type LambdaFunction struct {
+	Name        string `yaml:"name" json:"name" schema:"required"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Role        string `yaml:"role" json:"role" schema:"required"` // execution role ARN
+
+	// Runtime and Handler are required for zip files and unused for images
+	Runtime string `yaml:"runtime,omitempty" json:"runtime,omitempty"`
+	Handler string `yaml:"handler,omitempty" json:"handler,omitempty"`
+
+	MemorySize int32 `yaml:"memory_size,omitempty" json:"memory_size,omitempty"` // MB, defaults to 128
+	Timeout    int32 `yaml:"timeout,omitempty" json:"timeout,omitempty"`         // seconds, defaults to 3
+
+	// ZipFile is a path to the deployment package, relative to the config file
+	ZipFile string `yaml:"zip_file,omitempty" json:"zip_file,omitempty"`
+	// ImageURI is an ECR image URI, or repository[:tag] naming an ECR repository in the
+	// same config, which is resolved to the repository's URI
+	ImageURI string `yaml:"image_uri,omitempty" json:"image_uri,omitempty"`
+
+	Environment map[string]string `yaml:"environment,omitempty" json:"environment,omitempty"`
+	Tags        map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// VPCConfig connects the function to subnets of a VPC
+	VPCConfig *LambdaVPCConfig `yaml:"vpc_config,omitempty" json:"vpc_config,omitempty"`
+
+	// Enabled set to false skips the function without removing it from the config
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// IfNotExists set to true only creates the function; an existing one is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
+}
+
+// LambdaVPCConfig places a function's network interfaces in subnets of a VPC
+type LambdaVPCConfig struct {
+	// SubnetIDs are subnet IDs or <vpc>/<subnet> references to subnets of a VPC created by
+	// this tool
+	SubnetIDs        []string `yaml:"subnet_ids" json:"subnet_ids" schema:"required"`
+	SecurityGroupIDs []string `yaml:"security_group_ids" json:"security_group_ids" schema:"required"`
+}
+
+// VPC represents a VPC with its subnets. The VPC and its subnets are found again by the
+// names they are tagged with, so they are only created once.
+type VPC struct {
+	Name      string      `yaml:"name" json:"name" schema:"required"`
+	CIDRBlock string      `yaml:"cidr_block" json:"cidr_block" schema:"required"`
+	Subnets   []VPCSubnet `yaml:"subnets,omitempty" json:"subnets,omitempty"`
+	// InternetGateway attaches an internet gateway, which public subnets route through
+	InternetGateway bool `yaml:"internet_gateway,omitempty" json:"internet_gateway,omitempty"`
+
+	Tags map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// Enabled set to false skips the VPC without removing it from the config
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// IfNotExists set to true only creates the VPC; an existing one is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
+}
+
+// VPCSubnet is a subnet of a VPC. Other resources in the config refer to it as
+// <vpc name>/<subnet name>.
+type VPCSubnet struct {
+	Name             string `yaml:"name" json:"name" schema:"required"`
+	AvailabilityZone string `yaml:"availability_zone" json:"availability_zone" schema:"required"`
+	CIDRBlock        string `yaml:"cidr_block" json:"cidr_block" schema:"required"`
+	// Public subnets route to the internet gateway and give instances public IP addresses
+	Public bool `yaml:"public,omitempty" json:"public,omitempty"`
+}
+
+// KeyPair is an EC2 key pair. A public key given inline or in a file is imported;
+// otherwise a new key pair is created and its private key is written to the
+// -credentials-out file, the only time it can be retrieved.
+type KeyPair struct {
+	Name          string `yaml:"name" json:"name" schema:"required"`
+	PublicKey     string `yaml:"public_key,omitempty" json:"public_key,omitempty"`
+	PublicKeyFile string `yaml:"public_key_file,omitempty" json:"public_key_file,omitempty"`
+	// KeyType is rsa or ed25519 for a created key pair; it defaults to rsa
+	KeyType string `yaml:"key_type,omitempty" json:"key_type,omitempty" schema:"enum=rsa|ed25519"`
+
+	Tags map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// Enabled set to false skips the key pair without removing it from the config
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// IfNotExists set to true only creates the key pair; an existing one is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
+}
+
+// SecurityGroup is a VPC security group whose rules are kept equal to the configured ones
+type SecurityGroup struct {
+	Name        string `yaml:"name" json:"name" schema:"required"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// VPC is the name of a VPC created by this tool, usually in the same config, or a VPC ID
+	VPC     string              `yaml:"vpc" json:"vpc" schema:"required"`
+	Ingress []SecurityGroupRule `yaml:"ingress,omitempty" json:"ingress,omitempty"`
+	// Egress rules replace the default rule that allows all outbound traffic; without
+	// them the group's outbound rules are left as they are
+	Egress []SecurityGroupRule `yaml:"egress,omitempty" json:"egress,omitempty"`
+
+	Tags map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// Enabled set to false skips the security group without removing it from the config
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// IfNotExists set to true only creates the security group; an existing one is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
+}
+
+// SecurityGroupRule allows traffic on a port range from, or to, CIDR blocks and other
+// security groups
+type SecurityGroupRule struct {
+	// Protocol is tcp, udp, icmp or all
+	Protocol string `yaml:"protocol" json:"protocol" schema:"required,enum=tcp|udp|icmp|all|-1"`
+	// Port sets a single port; FromPort and ToPort set a range instead. For icmp they are
+	// the ICMP type and code, -1 for any. Ports are ignored for all.
+	Port     int `yaml:"port,omitempty" json:"port,omitempty"`
+	FromPort int `yaml:"from_port,omitempty" json:"from_port,omitempty"`
+	ToPort   int `yaml:"to_port,omitempty" json:"to_port,omitempty"`
+
+	// CIDRBlocks are IPv4 or IPv6 blocks
+	CIDRBlocks []string `yaml:"cidr_blocks,omitempty" json:"cidr_blocks,omitempty"`
+	// SecurityGroups are security group IDs or the names of groups in the same VPC
+	SecurityGroups []string `yaml:"security_groups,omitempty" json:"security_groups,omitempty"`
+	Description    string   `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// EventBridgeRule is a rule on the default event bus that sends the events matching its
+// pattern, or an event on its schedule, to its targets
+type EventBridgeRule struct {
+	Name        string `yaml:"name" json:"name" schema:"required"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Exactly one of EventPattern, a JSON event pattern, or ScheduleExpression, such as
+	// rate(5 minutes) or cron(0 12 * * ? *), is set
+	EventPattern       string `yaml:"event_pattern,omitempty" json:"event_pattern,omitempty"`
+	ScheduleExpression string `yaml:"schedule_expression,omitempty" json:"schedule_expression,omitempty"`
+	// State is ENABLED, the default, or DISABLED
+	State   string              `yaml:"state,omitempty" json:"state,omitempty" schema:"enum=ENABLED|DISABLED"`
+	Targets []EventBridgeTarget `yaml:"targets" json:"targets" schema:"required"`
+
+	Tags map[string]string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// Enabled set to false skips the rule without removing it from the config
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// IfNotExists set to true only creates the rule; an existing one is left as it is
+	IfNotExists bool `yaml:"if_not_exists,omitempty" json:"if_not_exists,omitempty"`
+}
+
+// EventBridgeTarget receives the events of a rule. Exactly one of LambdaFunction, Queue or
+// Topic is set.
+type EventBridgeTarget struct {
+	// ID identifies the target within the rule; it defaults to the name of the function,
+	// queue or topic
+	ID string `yaml:"id,omitempty" json:"id,omitempty"`
+	// LambdaFunction is the name of a Lambda function in the same config, or a function ARN.
+	// The function is allowed to be invoked by the rule.
+	LambdaFunction string `yaml:"lambda_function,omitempty" json:"lambda_function,omitempty"`
+	// Queue and Topic are SQS queue and SNS topic ARNs; their policies must allow
+	// events.amazonaws.com to send to them
+	Queue string `yaml:"queue,omitempty" json:"queue,omitempty"`
+	Topic string `yaml:"topic,omitempty" json:"topic,omitempty"`
+	// Input is JSON sent to the target instead of the matched event
+	Input string `yaml:"input,omitempty" json:"input,omitempty"`
+}
+
+// DNSAlias points a record at an AWS resource. S3Website names a bucket in the same config
+// and is resolved to the bucket's website endpoint; otherwise DNSName and HostedZoneID
+// give the target directly.
+type DNSAlias struct {
+	S3Website            string `yaml:"s3_website,omitempty" json:"s3_website,omitempty"`
+	DNSName              string `yaml:"dns_name,omitempty" json:"dns_name,omitempty"`
+	HostedZoneID         string `yaml:"hosted_zone_id,omitempty" json:"hosted_zone_id,omitempty"`
+	EvaluateTargetHealth bool   `yaml:"evaluate_target_health,omitempty" json:"evaluate_target_health,omitempty"`
 }
@@ -0,0 +1,832 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+var (
+	// regionPattern matches AWS region names such as us-west-2 or us-gov-east-1
+	regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+	// bucketNamePattern enforces the characters allowed in S3 bucket names; length and the
+	// remaining DNS rules are checked separately
+	bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*[a-z0-9]$`)
+
+	// snapshotIdentifierPattern enforces the RDS rules for snapshot identifiers: a letter
+	// first, then letters, digits and single hyphens, not ending in a hyphen
+	snapshotIdentifierPattern = regexp.MustCompile(`^[A-Za-z](-?[A-Za-z0-9])*$`)
+
+	// accessPointNamePattern enforces the S3 rules for access point names: 3 to 50
+	// lowercase letters, digits and hyphens, starting and ending with a letter or digit
+	accessPointNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,48}[a-z0-9]$`)
+)
+
+// validator collects configuration problems so they can be reported together
+type validator struct {
+	errs []error
+}
+
+// addf records a problem with the config entry at path
+func (v *validator) addf(path, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+// requireJSON records a problem if document is set but is not valid JSON
+func (v *validator) requireJSON(path, field, document string) {
+	if document == "" {
+		return
+	}
+	if !json.Valid([]byte(document)) {
+		v.addf(path, "%s is not valid JSON", field)
+	}
+}
+
+// Validate checks the configuration for missing required fields, invalid values and
+// malformed policy documents. All problems are returned together as a single joined error.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	if err := validateRegion(c.Region); err != nil {
+		v.addf("region", "%v", err)
+	}
+
+	if c.AssumeRoleARN != "" {
+		if err := validateRoleARN(c.AssumeRoleARN); err != nil {
+			v.addf("assume_role_arn", "%v", err)
+		}
+	}
+	if c.MFASerial != "" && c.AssumeRoleARN == "" {
+		v.addf("mfa_serial", "requires assume_role_arn")
+	}
+	if c.RetryMaxAttempts < 0 {
+		v.addf("retry_max_attempts", "must not be negative")
+	}
+	if err := validateRetryMode(c.RetryMode); err != nil {
+		v.addf("retry_mode", "%v", err)
+	}
+	c.validateResourceRoles(v)
+	c.validateTimeouts(v)
+	c.validateRequiredTags(v)
+
+	for i, bucket := range c.S3Buckets {
+		bucket.validate(v, fmt.Sprintf("s3_buckets[%d]", i))
+	}
+	for i, repo := range c.ECRRepositories {
+		repo.validate(v, fmt.Sprintf("ecr_repositories[%d]", i))
+	}
+	for i, group := range c.IAMGroups {
+		path := fmt.Sprintf("iam_groups[%d]", i)
+		if group.Name == "" {
+			v.addf(path, "name is required")
+		}
+		validatePolicies(v, path, group.Policies)
+		for j, policy := range group.Policies {
+			if policy.Simulate != nil {
+				v.addf(fmt.Sprintf("%s.policies[%d]", path, j), "simulate is only supported on the policies of IAM users")
+			}
+		}
+	}
+	for i, user := range c.IAMUsers {
+		user.validate(v, fmt.Sprintf("iam_users[%d]", i))
+	}
+	if c.PasswordPolicy != nil {
+		c.PasswordPolicy.validate(v, "password_policy")
+	}
+	for i, instance := range c.RDSInstances {
+		instance.validate(v, fmt.Sprintf("rds_instances[%d]", i))
+	}
+	for i, cluster := range c.AuroraClusters {
+		cluster.validate(v, fmt.Sprintf("aurora_clusters[%d]", i))
+	}
+
+	buckets := make(map[string]bool, len(c.S3Buckets))
+	for _, bucket := range c.S3Buckets {
+		buckets[bucket.Name] = true
+	}
+	for i, zone := range c.HostedZones {
+		zone.validate(v, fmt.Sprintf("hosted_zones[%d]", i), buckets)
+	}
+	for i, certificate := range c.Certificates {
+		certificate.validate(v, fmt.Sprintf("certificates[%d]", i))
+	}
+	repositories := make(map[string]bool, len(c.ECRRepositories))
+	for _, repo := range c.ECRRepositories {
+		repositories[repo.Name] = true
+	}
+	for i, function := range c.LambdaFunctions {
+		function.validate(v, fmt.Sprintf("lambda_functions[%d]", i), repositories)
+	}
+	for i, vpc := range c.VPCs {
+		vpc.validate(v, fmt.Sprintf("vpcs[%d]", i))
+	}
+	for i, keyPair := range c.KeyPairs {
+		keyPair.validate(v, fmt.Sprintf("key_pairs[%d]", i))
+	}
+	groupVPCs := make(map[string]string, len(c.SecurityGroups))
+	for _, group := range c.SecurityGroups {
+		groupVPCs[group.Name] = group.VPC
+	}
+	for i, group := range c.SecurityGroups {
+		group.validate(v, fmt.Sprintf("security_groups[%d]", i), groupVPCs)
+	}
+	for i, rule := range c.EventBridgeRules {
+		rule.validate(v, fmt.Sprintf("eventbridge_rules[%d]", i))
+	}
+
+	// References to a VPC in the configuration must name one of its subnets; references
+	// to other VPCs are looked up when they are used
+	vpcs := make(map[string]bool, len(c.VPCs))
+	subnets := make(map[string]bool)
+	for _, vpc := range c.VPCs {
+		vpcs[vpc.Name] = true
+		for _, subnet := range vpc.Subnets {
+			subnets[vpc.Name+"/"+subnet.Name] = true
+		}
+	}
+	for i, instance := range c.RDSInstances {
+		if instance.SubnetGroup != nil {
+			validateSubnetReferences(v, fmt.Sprintf("rds_instances[%d].subnet_group", i), instance.SubnetGroup.SubnetIDs, vpcs, subnets)
+		}
+	}
+	for i, function := range c.LambdaFunctions {
+		if function.VPCConfig != nil {
+			validateSubnetReferences(v, fmt.Sprintf("lambda_functions[%d].vpc_config", i), function.VPCConfig.SubnetIDs, vpcs, subnets)
+		}
+	}
+
+	return errors.Join(v.errs...)
+}
+
+func (b S3Bucket) validate(v *validator, path string) {
+	if b.Name == "" {
+		v.addf(path, "name is required")
+	} else if err := validateBucketName(b.Name); err != nil {
+		v.addf(path, "bucket name %q %v", b.Name, err)
+	}
+	if b.Region != "" {
+		if err := validateRegion(b.Region); err != nil {
+			v.addf(path+".region", "%v", err)
+		}
+	}
+
+	switch b.Versioning {
+	case "", "enabled", "suspended":
+	default:
+		v.addf(path, "versioning must be enabled, suspended or empty, got %q", b.Versioning)
+	}
+
+	switch b.Encryption {
+	case "", "AES256":
+		if b.KMSKeyID != "" {
+			v.addf(path, "kms_key_id requires encryption aws:kms")
+		}
+	case "aws:kms":
+		if b.KMSKeyID == "" {
+			v.addf(path, "kms_key_id is required when encryption is aws:kms")
+		}
+	default:
+		v.addf(path, "encryption must be AES256 or aws:kms, got %q", b.Encryption)
+	}
+
+	switch b.ObjectOwnership {
+	case "", "BucketOwnerPreferred", "ObjectWriter":
+	case "BucketOwnerEnforced":
+		if b.ACL != "" {
+			v.addf(path, "acl cannot be set when object_ownership is BucketOwnerEnforced, which disables ACLs")
+		}
+	default:
+		v.addf(path, "object_ownership must be BucketOwnerEnforced, BucketOwnerPreferred or ObjectWriter, got %q", b.ObjectOwnership)
+	}
+	switch b.ACL {
+	case "", "private", "public-read", "public-read-write", "authenticated-read":
+	default:
+		v.addf(path, "acl must be private, public-read, public-read-write or authenticated-read, got %q", b.ACL)
+	}
+
+	switch b.RequestPayer {
+	case "", "BucketOwner", "Requester":
+	default:
+		v.addf(path, "request_payer must be BucketOwner or Requester, got %q", b.RequestPayer)
+	}
+	// Accelerated endpoints are virtual-hosted, so they cannot serve names with dots
+	if b.TransferAcceleration != nil && *b.TransferAcceleration && strings.Contains(b.Name, ".") {
+		v.addf(path, "transfer_acceleration cannot be enabled for bucket names that contain dots")
+	}
+
+	if b.Policy != "" && b.PolicyFile != "" {
+		v.addf(path, "only one of policy or policy_file may be set")
+	}
+	v.requireJSON(path, "policy", b.Policy)
+
+	for i, rule := range b.CORS {
+		if len(rule.AllowedOrigins) == 0 || len(rule.AllowedMethods) == 0 {
+			v.addf(fmt.Sprintf("%s.cors[%d]", path, i), "allowed_origins and allowed_methods are required")
+		}
+	}
+	for i, rule := range b.LifecycleRules {
+		if rule.ID == "" {
+			v.addf(fmt.Sprintf("%s.lifecycle_rules[%d]", path, i), "id is required")
+		}
+	}
+
+	if lock := b.ObjectLock; lock != nil {
+		switch lock.Mode {
+		case "GOVERNANCE", "COMPLIANCE":
+		default:
+			v.addf(path+".object_lock", "mode must be GOVERNANCE or COMPLIANCE, got %q", lock.Mode)
+		}
+		if lock.RetentionDays <= 0 {
+			v.addf(path+".object_lock", "retention_days must be greater than zero")
+		}
+		// Object Lock keeps versioning enabled for the life of the bucket
+		if b.Versioning == "suspended" {
+			v.addf(path, "versioning cannot be suspended when object_lock is set")
+		}
+	}
+
+	if replication := b.Replication; replication != nil {
+		replicationPath := path + ".replication"
+		if err := validateRoleARN(replication.Role); err != nil {
+			v.addf(replicationPath, "role %v", err)
+		}
+		if _, name, ok := strings.Cut(replication.DestinationBucket, ":::"); !ok || !strings.HasPrefix(replication.DestinationBucket, "arn:") || name == "" {
+			v.addf(replicationPath, "destination_bucket must be a bucket ARN such as arn:aws:s3:::my-replica, got %q", replication.DestinationBucket)
+		}
+		if b.Versioning == "suspended" {
+			v.addf(path, "versioning cannot be suspended when replication is set")
+		}
+	}
+
+	for i, notification := range b.Notifications {
+		notification.validate(v, fmt.Sprintf("%s.notifications[%d]", path, i))
+	}
+
+	accessPoints := make(map[string]bool, len(b.AccessPoints))
+	for i, accessPoint := range b.AccessPoints {
+		accessPointPath := fmt.Sprintf("%s.access_points[%d]", path, i)
+		switch {
+		case accessPoint.Name == "":
+			v.addf(accessPointPath, "name is required")
+		case !accessPointNamePattern.MatchString(accessPoint.Name):
+			v.addf(accessPointPath, "name %q must be 3 to 50 lowercase letters, digits and hyphens, starting and ending with a letter or digit", accessPoint.Name)
+		case accessPoints[accessPoint.Name]:
+			v.addf(accessPointPath, "name %q is used by another access point", accessPoint.Name)
+		}
+		accessPoints[accessPoint.Name] = true
+		if accessPoint.VPCID != "" && !strings.HasPrefix(accessPoint.VPCID, "vpc-") {
+			v.addf(accessPointPath, "vpc_id must be a VPC ID such as vpc-0123456789abcdef0, got %q", accessPoint.VPCID)
+		}
+		v.requireJSON(accessPointPath, "policy", accessPoint.Policy)
+	}
+}
+
+func (n S3Notification) validate(v *validator, path string) {
+	targets := 0
+	for _, target := range []struct{ field, service, arn string }{
+		{"topic", "sns", n.Topic},
+		{"queue", "sqs", n.Queue},
+		{"lambda_function", "lambda", n.LambdaFunction},
+	} {
+		if target.arn == "" {
+			continue
+		}
+		targets++
+		if parts := strings.SplitN(target.arn, ":", 6); len(parts) < 6 || parts[0] != "arn" || parts[2] != target.service {
+			v.addf(path, "%s must be an %s ARN, got %q", target.field, target.service, target.arn)
+		}
+	}
+	if targets != 1 {
+		v.addf(path, "exactly one of topic, queue or lambda_function must be set")
+	}
+
+	if len(n.Events) == 0 {
+		v.addf(path, "events is required")
+	}
+	for _, event := range n.Events {
+		if !strings.HasPrefix(event, "s3:") {
+			v.addf(path, "event %q must start with s3:, e.g. s3:ObjectCreated:*", event)
+		}
+	}
+}
+
+// validateBucketName enforces the S3 rules for DNS-compatible bucket names
+func validateBucketName(name string) error {
+	switch {
+	case len(name) < 3 || len(name) > 63:
+		return fmt.Errorf("must be between 3 and 63 characters long")
+	case !bucketNamePattern.MatchString(name):
+		return fmt.Errorf("may only contain lowercase letters, numbers, dots and hyphens, and must begin and end with a letter or number")
+	case strings.Contains(name, ".."):
+		return fmt.Errorf("must not contain two adjacent periods")
+	case net.ParseIP(name) != nil:
+		return fmt.Errorf("must not be formatted as an IP address")
+	case strings.HasPrefix(name, "xn--") || strings.HasPrefix(name, "sthree-"):
+		return fmt.Errorf("must not start with a reserved prefix")
+	case strings.HasSuffix(name, "-s3alias") || strings.HasSuffix(name, "--ol-s3"):
+		return fmt.Errorf("must not end with a reserved suffix")
+	}
+	return nil
+}
+
+func (r ECRRepository) validate(v *validator, path string) {
+	if r.Name == "" {
+		v.addf(path, "name is required")
+	}
+	if r.Region != "" {
+		if err := validateRegion(r.Region); err != nil {
+			v.addf(path+".region", "%v", err)
+		}
+	}
+	if _, err := loadECRLifecyclePolicy(r); err != nil {
+		v.addf(path, "%v", err)
+	}
+	v.requireJSON(path, "repository_policy", r.RepositoryPolicy)
+	if r.RepositoryPolicy != "" && len(r.PullAccountIDs) > 0 {
+		v.addf(path, "only one of repository_policy or pull_account_ids may be set")
+	}
+	if _, err := buildECREncryption(r.Encryption); err != nil {
+		v.addf(path, "encryption: %v", err)
+	}
+	switch r.ImageTagMutability {
+	case "", "MUTABLE", "IMMUTABLE":
+	default:
+		v.addf(path, "image_tag_mutability must be MUTABLE or IMMUTABLE, got %q", r.ImageTagMutability)
+	}
+}
+
+func (u IAMUser) validate(v *validator, path string) {
+	if u.Name == "" {
+		v.addf(path, "name is required")
+	}
+	validatePolicies(v, path, u.Policies)
+	for i, policy := range u.InlinePolicies {
+		policyPath := fmt.Sprintf("%s.inline_policies[%d]", path, i)
+		if policy.Name == "" {
+			v.addf(policyPath, "name is required")
+		}
+		if policy.PolicyDocument == "" {
+			v.addf(policyPath, "policy_document is required")
+		}
+		v.requireJSON(policyPath, "policy_document", policy.PolicyDocument)
+	}
+	if u.ConsoleAccess != nil && len(u.ConsoleAccess.Password) > maxIAMPasswordLength {
+		v.addf(path+".console_access", "password must be at most %d characters", maxIAMPasswordLength)
+	}
+}
+
+func (p PasswordPolicy) validate(v *validator, path string) {
+	if p.MinimumLength != 0 && (p.MinimumLength < 6 || p.MinimumLength > maxIAMPasswordLength) {
+		v.addf(path, "minimum_length must be between 6 and %d, got %d", maxIAMPasswordLength, p.MinimumLength)
+	}
+	if p.MaxAgeDays < 0 || p.MaxAgeDays > 1095 {
+		v.addf(path, "max_age_days must be between 0 and 1095, got %d", p.MaxAgeDays)
+	}
+	if p.ReusePrevention < 0 || p.ReusePrevention > 24 {
+		v.addf(path, "reuse_prevention must be between 0 and 24, got %d", p.ReusePrevention)
+	}
+	if p.HardExpiry && p.MaxAgeDays == 0 {
+		v.addf(path, "hard_expiry requires max_age_days")
+	}
+}
+
+// validatePolicies checks the managed policies of a user or group
+func validatePolicies(v *validator, path string, policies []IAMPolicy) {
+	for i, policy := range policies {
+		policyPath := fmt.Sprintf("%s.policies[%d]", path, i)
+		if policy.Name == "" {
+			v.addf(policyPath, "name is required")
+		}
+		if (policy.PolicyDocument == "") == (policy.PolicyArn == "") {
+			v.addf(policyPath, "exactly one of policy_document or policy_arn must be set")
+		}
+		v.requireJSON(policyPath, "policy_document", policy.PolicyDocument)
+		if len(policy.Tags) > 0 && policy.PolicyArn != "" {
+			v.addf(policyPath, "tags are only set on policies created from policy_document, not on policy_arn")
+		}
+		if policy.Simulate != nil {
+			policy.Simulate.validate(v, policyPath+".simulate")
+		}
+	}
+}
+
+func (s IAMPolicySimulation) validate(v *validator, path string) {
+	if len(s.Checks) == 0 {
+		v.addf(path, "checks must list at least one check")
+	}
+	for i, check := range s.Checks {
+		checkPath := fmt.Sprintf("%s.checks[%d]", path, i)
+		if !strings.Contains(check.Action, ":") {
+			v.addf(checkPath, "action %q must be a service:action name such as s3:GetObject", check.Action)
+		}
+		if check.Expect != simulationAllowed && check.Expect != simulationDenied {
+			v.addf(checkPath, "expect must be allowed or denied, got %q", check.Expect)
+		}
+	}
+}
+
+func (i RDSInstance) validate(v *validator, path string) {
+	if i.Identifier == "" {
+		v.addf(path, "identifier is required")
+	}
+	if i.Engine == "" {
+		v.addf(path, "engine is required")
+	}
+	if i.InstanceClass == "" {
+		v.addf(path, "instance_class is required")
+	}
+	if i.AllocatedStorage <= 0 {
+		v.addf(path, "allocated_storage must be greater than zero")
+	}
+	if i.MasterPassword != "" && i.MasterPasswordSecret != "" {
+		v.addf(path, "only one of master_password or master_password_secret may be set")
+	}
+	switch i.DesiredState {
+	case "", rdsStateRunning:
+	case rdsStateStopped:
+		if i.MultiAZ {
+			v.addf(path, "desired_state stopped requires a single-AZ instance")
+		}
+	default:
+		v.addf(path, "desired_state must be running, stopped or empty, got %q", i.DesiredState)
+	}
+	if name := i.FinalSnapshotIdentifier; name != "" {
+		if i.SkipFinalSnapshot {
+			v.addf(path, "final_snapshot_identifier cannot be set with skip_final_snapshot")
+		}
+		if len(name) > 255 || !snapshotIdentifierPattern.MatchString(name) {
+			v.addf(path, "final_snapshot_identifier %q must start with a letter and contain only letters, digits and single hyphens, not ending in a hyphen", name)
+		}
+	}
+	if group := i.SubnetGroup; group != nil {
+		if i.DBSubnetGroupName != "" {
+			v.addf(path, "only one of db_subnet_group_name or subnet_group may be set")
+		}
+		if group.Name == "" {
+			v.addf(path+".subnet_group", "name is required")
+		}
+		// RDS requires subnets in at least two availability zones
+		if len(group.SubnetIDs) < 2 {
+			v.addf(path+".subnet_group", "subnet_ids must list at least two subnets")
+		}
+	}
+	if group := i.ParameterGroup; group != nil {
+		if i.DBParameterGroupName != "" {
+			v.addf(path, "only one of db_parameter_group_name or parameter_group may be set")
+		}
+		if group.Name == "" {
+			v.addf(path+".parameter_group", "name is required")
+		}
+		if group.Family == "" {
+			v.addf(path+".parameter_group", "family is required")
+		}
+	}
+}
+
+func (c AuroraCluster) validate(v *validator, path string) {
+	if c.Identifier == "" {
+		v.addf(path, "identifier is required")
+	}
+	switch c.Engine {
+	case "aurora-mysql", "aurora-postgresql":
+	default:
+		v.addf(path, "engine must be aurora-mysql or aurora-postgresql, got %q", c.Engine)
+	}
+	if c.MasterUsername == "" {
+		v.addf(path, "master_username is required")
+	}
+	if c.MasterPassword != "" && c.MasterPasswordSecret != "" {
+		v.addf(path, "only one of master_password or master_password_secret may be set")
+	}
+	if c.BackupRetentionPeriod < 0 {
+		v.addf(path, "backup_retention_period must not be negative")
+	}
+	for j, instance := range c.Instances {
+		instancePath := fmt.Sprintf("%s.instances[%d]", path, j)
+		if instance.Identifier == "" {
+			v.addf(instancePath, "identifier is required")
+		}
+		if instance.InstanceClass == "" {
+			v.addf(instancePath, "instance_class is required")
+		}
+	}
+}
+
+// validRecordTypes are the record types Route53 accepts in a hosted zone
+var validRecordTypes = map[string]bool{
+	"A": true, "AAAA": true, "CAA": true, "CNAME": true, "DS": true, "MX": true, "NAPTR": true,
+	"NS": true, "PTR": true, "SOA": true, "SPF": true, "SRV": true, "TXT": true,
+}
+
+// validate checks a hosted zone and its records; buckets holds the names of the buckets in
+// the config, which S3 website aliases must refer to
+func (z HostedZone) validate(v *validator, path string, buckets map[string]bool) {
+	if z.Name == "" {
+		v.addf(path, "name is required")
+	}
+	if z.Private && z.VPCID == "" {
+		v.addf(path, "vpc_id is required for a private zone")
+	}
+	if !z.Private && (z.VPCID != "" || z.VPCRegion != "") {
+		v.addf(path, "vpc_id and vpc_region require private")
+	}
+
+	for j, record := range z.Records {
+		recordPath := fmt.Sprintf("%s.records[%d]", path, j)
+		recordType := strings.ToUpper(record.Type)
+		if !validRecordTypes[recordType] {
+			v.addf(recordPath, "type must be a Route53 record type such as A, CNAME or TXT, got %q", record.Type)
+		}
+		if (len(record.Values) == 0) == (record.Alias == nil) {
+			v.addf(recordPath, "exactly one of values or alias must be set")
+		}
+		if record.TTL < 0 {
+			v.addf(recordPath, "ttl must not be negative")
+		}
+
+		alias := record.Alias
+		if alias == nil {
+			continue
+		}
+		if record.TTL != 0 {
+			v.addf(recordPath, "ttl cannot be set on an alias record")
+		}
+		if alias.S3Website != "" {
+			if alias.DNSName != "" || alias.HostedZoneID != "" {
+				v.addf(recordPath+".alias", "only one of s3_website or dns_name may be set")
+			}
+			if !buckets[alias.S3Website] {
+				v.addf(recordPath+".alias", "s3_website %q is not a bucket in the configuration", alias.S3Website)
+			}
+			// S3 serves a website only under a host name equal to the bucket name
+			if name := strings.TrimSuffix(qualifyRecordName(record.Name, z.Name), "."); name != alias.S3Website {
+				v.addf(recordPath+".alias", "s3_website bucket %q must be named after the record %s", alias.S3Website, name)
+			}
+			if recordType != "A" {
+				v.addf(recordPath, "an s3_website alias must be an A record")
+			}
+		} else if alias.DNSName == "" || alias.HostedZoneID == "" {
+			v.addf(recordPath+".alias", "s3_website or both dns_name and hosted_zone_id are required")
+		}
+	}
+}
+
+func (c Certificate) validate(v *validator, path string) {
+	if c.DomainName == "" {
+		v.addf(path, "domain_name is required")
+	}
+	switch c.ValidationMethod {
+	case "", "DNS", "EMAIL":
+	default:
+		v.addf(path, "validation_method must be DNS or EMAIL, got %q", c.ValidationMethod)
+	}
+}
+
+// validate checks a Lambda function; repositories holds the names of the ECR repositories
+// in the config, which image references without a registry must refer to
+func (f LambdaFunction) validate(v *validator, path string, repositories map[string]bool) {
+	if f.Name == "" {
+		v.addf(path, "name is required")
+	}
+	if err := validateRoleARN(f.Role); err != nil {
+		v.addf(path, "role %v", err)
+	}
+
+	switch {
+	case (f.ZipFile == "") == (f.ImageURI == ""):
+		v.addf(path, "exactly one of zip_file or image_uri must be set")
+	case f.ZipFile != "":
+		if f.Runtime == "" || f.Handler == "" {
+			v.addf(path, "runtime and handler are required with zip_file")
+		}
+	default:
+		if f.Runtime != "" || f.Handler != "" {
+			v.addf(path, "runtime and handler cannot be set with image_uri")
+		}
+		if repo, _, ok := ecrImageReference(f.ImageURI); ok && !repositories[repo] {
+			v.addf(path, "image_uri %q must be a full image URI or name an ECR repository in the configuration", f.ImageURI)
+		}
+	}
+
+	if f.MemorySize != 0 && (f.MemorySize < 128 || f.MemorySize > 10240) {
+		v.addf(path, "memory_size must be between 128 and 10240 MB, got %d", f.MemorySize)
+	}
+	if f.Timeout != 0 && (f.Timeout < 1 || f.Timeout > 900) {
+		v.addf(path, "timeout must be between 1 and 900 seconds, got %d", f.Timeout)
+	}
+	if vpc := f.VPCConfig; vpc != nil && (len(vpc.SubnetIDs) == 0 || len(vpc.SecurityGroupIDs) == 0) {
+		v.addf(path+".vpc_config", "subnet_ids and security_group_ids must both list at least one entry")
+	}
+}
+
+func (n VPC) validate(v *validator, path string) {
+	if n.Name == "" {
+		v.addf(path, "name is required")
+	} else if strings.Contains(n.Name, "/") {
+		v.addf(path, "name %q cannot contain /", n.Name)
+	}
+	_, network, err := net.ParseCIDR(n.CIDRBlock)
+	if err != nil {
+		v.addf(path, "cidr_block %q is not a valid CIDR block", n.CIDRBlock)
+	} else if ones, _ := network.Mask.Size(); network.IP.To4() == nil || ones < 16 || ones > 28 {
+		v.addf(path, "cidr_block %q must be an IPv4 block between /16 and /28", n.CIDRBlock)
+	}
+
+	names := make(map[string]bool, len(n.Subnets))
+	for i, subnet := range n.Subnets {
+		subnetPath := fmt.Sprintf("%s.subnets[%d]", path, i)
+		switch {
+		case subnet.Name == "":
+			v.addf(subnetPath, "name is required")
+		case strings.Contains(subnet.Name, "/"):
+			v.addf(subnetPath, "name %q cannot contain /", subnet.Name)
+		case names[subnet.Name]:
+			v.addf(subnetPath, "name %q is used by another subnet", subnet.Name)
+		}
+		names[subnet.Name] = true
+		if subnet.AvailabilityZone == "" {
+			v.addf(subnetPath, "availability_zone is required")
+		}
+		ip, _, err := net.ParseCIDR(subnet.CIDRBlock)
+		if err != nil {
+			v.addf(subnetPath, "cidr_block %q is not a valid CIDR block", subnet.CIDRBlock)
+		} else if network != nil && !network.Contains(ip) {
+			v.addf(subnetPath, "cidr_block %s is outside the VPC block %s", subnet.CIDRBlock, n.CIDRBlock)
+		}
+		if subnet.Public && !n.InternetGateway {
+			v.addf(subnetPath, "public subnets require internet_gateway")
+		}
+	}
+}
+
+func (k KeyPair) validate(v *validator, path string) {
+	if k.Name == "" {
+		v.addf(path, "name is required")
+	}
+	if k.PublicKey != "" && k.PublicKeyFile != "" {
+		v.addf(path, "only one of public_key or public_key_file may be set")
+	}
+	if k.PublicKey != "" && !isOpenSSHPublicKey(k.PublicKey) {
+		v.addf(path, "public_key must be an OpenSSH public key, such as ssh-ed25519 AAAA...")
+	}
+	switch k.KeyType {
+	case "", "rsa", "ed25519":
+		if k.KeyType != "" && (k.PublicKey != "" || k.PublicKeyFile != "") {
+			v.addf(path, "key_type cannot be set when a public key is imported")
+		}
+	default:
+		v.addf(path, "key_type must be rsa or ed25519, got %q", k.KeyType)
+	}
+}
+
+// isOpenSSHPublicKey reports whether a key looks like a single-line OpenSSH public key
+func isOpenSSHPublicKey(key string) bool {
+	fields := strings.Fields(key)
+	return len(fields) >= 2 && (strings.HasPrefix(fields[0], "ssh-") || strings.HasPrefix(fields[0], "ecdsa-sha2-"))
+}
+
+// validate checks the security group and its rules; groupVPCs maps the names of the
+// security groups in the config to their VPCs
+func (g SecurityGroup) validate(v *validator, path string, groupVPCs map[string]string) {
+	switch {
+	case g.Name == "":
+		v.addf(path, "name is required")
+	case strings.HasPrefix(g.Name, "sg-"):
+		v.addf(path, "name %q cannot start with sg-", g.Name)
+	}
+	if g.VPC == "" {
+		v.addf(path, "vpc is required")
+	}
+	for i, rule := range g.Ingress {
+		rule.validate(v, fmt.Sprintf("%s.ingress[%d]", path, i), g, groupVPCs)
+	}
+	for i, rule := range g.Egress {
+		rule.validate(v, fmt.Sprintf("%s.egress[%d]", path, i), g, groupVPCs)
+	}
+}
+
+func (r SecurityGroupRule) validate(v *validator, path string, group SecurityGroup, groupVPCs map[string]string) {
+	switch strings.ToLower(r.Protocol) {
+	case "tcp", "udp":
+		switch {
+		case r.Port != 0 && (r.FromPort != 0 || r.ToPort != 0):
+			v.addf(path, "only one of port or from_port and to_port may be set")
+		case r.Port != 0:
+			if r.Port < 1 || r.Port > 65535 {
+				v.addf(path, "port must be between 1 and 65535, got %d", r.Port)
+			}
+		case r.FromPort == 0 && r.ToPort == 0:
+			v.addf(path, "port or from_port and to_port are required")
+		case r.FromPort < 0 || r.ToPort > 65535 || r.FromPort > r.ToPort:
+			v.addf(path, "port range %d-%d must be within 0-65535 and not reversed", r.FromPort, r.ToPort)
+		}
+	case "icmp":
+		if r.Port != 0 {
+			v.addf(path, "port cannot be set for icmp; use from_port for the ICMP type and to_port for the code")
+		}
+		if r.FromPort < -1 || r.FromPort > 255 || r.ToPort < -1 || r.ToPort > 255 {
+			v.addf(path, "icmp type and code must be between -1 and 255")
+		}
+	case "all", allProtocols:
+		if r.Port != 0 || r.FromPort != 0 || r.ToPort != 0 {
+			v.addf(path, "ports cannot be set for protocol all")
+		}
+	default:
+		v.addf(path, "protocol must be tcp, udp, icmp or all, got %q", r.Protocol)
+	}
+
+	if len(r.CIDRBlocks) == 0 && len(r.SecurityGroups) == 0 {
+		v.addf(path, "cidr_blocks or security_groups is required")
+	}
+	for _, block := range r.CIDRBlocks {
+		_, network, err := net.ParseCIDR(block)
+		if err != nil {
+			v.addf(path, "cidr_block %q is not a valid CIDR block", block)
+		} else if network.String() != block {
+			v.addf(path, "cidr_block %s must be written as %s", block, network)
+		}
+	}
+	for _, ref := range r.SecurityGroups {
+		if securityGroupIDPattern.MatchString(ref) {
+			continue
+		}
+		if vpc, ok := groupVPCs[ref]; ok && vpc != group.VPC {
+			v.addf(path, "security group %s is in VPC %s, not %s", ref, vpc, group.VPC)
+		}
+	}
+}
+
+func (r EventBridgeRule) validate(v *validator, path string) {
+	if r.Name == "" {
+		v.addf(path, "name is required")
+	}
+	switch {
+	case r.EventPattern == "" && r.ScheduleExpression == "":
+		v.addf(path, "event_pattern or schedule_expression is required")
+	case r.EventPattern != "" && r.ScheduleExpression != "":
+		v.addf(path, "only one of event_pattern or schedule_expression may be set")
+	}
+	v.requireJSON(path, "event_pattern", r.EventPattern)
+	if r.ScheduleExpression != "" && !strings.HasPrefix(r.ScheduleExpression, "rate(") && !strings.HasPrefix(r.ScheduleExpression, "cron(") {
+		v.addf(path, "schedule_expression must be rate(...) or cron(...), got %q", r.ScheduleExpression)
+	}
+	switch r.State {
+	case "", "ENABLED", "DISABLED":
+	default:
+		v.addf(path, "state must be ENABLED or DISABLED, got %q", r.State)
+	}
+
+	switch {
+	case len(r.Targets) == 0:
+		v.addf(path, "at least one target is required")
+	case len(r.Targets) > maxEventBridgeTargets:
+		v.addf(path, "at most %d targets are allowed, got %d", maxEventBridgeTargets, len(r.Targets))
+	}
+	ids := make(map[string]bool, len(r.Targets))
+	for i, target := range r.Targets {
+		targetPath := fmt.Sprintf("%s.targets[%d]", path, i)
+		set := 0
+		for _, destination := range []string{target.LambdaFunction, target.Queue, target.Topic} {
+			if destination != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			v.addf(targetPath, "exactly one of lambda_function, queue or topic is required")
+		}
+		if target.Queue != "" && !strings.HasPrefix(target.Queue, "arn:aws:sqs:") {
+			v.addf(targetPath, "queue must be an SQS queue ARN such as arn:aws:sqs:us-east-1:123456789012:jobs, got %q", target.Queue)
+		}
+		if target.Topic != "" && !strings.HasPrefix(target.Topic, "arn:aws:sns:") {
+			v.addf(targetPath, "topic must be an SNS topic ARN such as arn:aws:sns:us-east-1:123456789012:alerts, got %q", target.Topic)
+		}
+		if strings.HasPrefix(target.LambdaFunction, "arn:") && !strings.HasPrefix(target.LambdaFunction, "arn:aws:lambda:") {
+			v.addf(targetPath, "lambda_function must be a function name or Lambda function ARN, got %q", target.LambdaFunction)
+		}
+		v.requireJSON(targetPath, "input", target.Input)
+		if id := target.id(); id != "" {
+			if ids[id] {
+				v.addf(targetPath, "id %q is used by another target; set id to tell them apart", id)
+			}
+			ids[id] = true
+		}
+	}
+}
+
+// validateSubnetReferences checks that <vpc>/<subnet> references to a VPC in the
+// configuration name one of its subnets
+func validateSubnetReferences(v *validator, path string, subnetIDs []string, vpcs, subnets map[string]bool) {
+	for _, subnetID := range subnetIDs {
+		if !isSubnetReference(subnetID) {
+			continue
+		}
+		vpcName, _, _ := strings.Cut(subnetID, "/")
+		if vpcs[vpcName] && !subnets[subnetID] {
+			v.addf(path, "subnet %q is not a subnet of VPC %s in the configuration", subnetID, vpcName)
+		}
+	}
+}
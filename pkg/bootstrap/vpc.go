@@ -0,0 +1,378 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Tags that record the config names of the networking resources this tool creates, so
+// later runs find them again instead of creating duplicates
+const (
+	vpcNameTag        = "cloud-bootstrap:vpc"
+	subnetNameTag     = "cloud-bootstrap:subnet"
+	routeTableNameTag = "cloud-bootstrap:route-table"
+)
+
+// publicRouteTable is the name of the route table public subnets are associated with
+const publicRouteTable = "public"
+
+// CreateVPCs creates the configured VPCs with their subnets and, when requested, an
+// internet gateway that public subnets route through. Existing VPCs and subnets are
+// found by the names they are tagged with.
+func (b *Bootstrapper) CreateVPCs(ctx context.Context, vpcs []VPC) ([]ResourceResult, error) {
+	var results []ResourceResult
+	for _, vpc := range vpcs {
+		// Stop before starting the next resource if the run was cancelled or timed out
+		if err := ctx.Err(); err != nil {
+			return results, fmt.Errorf("provisioning interrupted: %w", err)
+		}
+		res := newResourceResult(ResourceTypeVPC, vpc.Name)
+		err := b.withResourceTimeout(ctx, res, func(ctx context.Context) error {
+			return b.ensureVPC(ctx, vpc, res)
+		})
+		results = append(results, res.finish(err))
+		if err != nil && !b.tolerate(err) {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// ensureVPC creates the VPC if no VPC is tagged with its name, then reconciles its
+// internet gateway, subnets and public route table
+func (b *Bootstrapper) ensureVPC(ctx context.Context, vpc VPC, res *ResourceResult) error {
+	logger.Info("Ensuring VPC", "vpc", vpc.Name)
+
+	existing, err := b.findVPC(ctx, vpc.Name)
+	if err != nil {
+		return err
+	}
+
+	var vpcID, owner string
+	if existing == nil {
+		output, err := b.ec2Client.CreateVpc(ctx, &ec2.CreateVpcInput{
+			CidrBlock:         aws.String(vpc.CIDRBlock),
+			TagSpecifications: ec2TagSpecifications(ec2types.ResourceTypeVpc, vpc.Name, vpc.Tags, vpcNameTag, vpc.Name),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create VPC %s: %w", vpc.Name, err)
+		}
+		res.created()
+		vpcID = aws.ToString(output.Vpc.VpcId)
+		owner = aws.ToString(output.Vpc.OwnerId)
+		logger.Info("Created VPC", "vpc", vpc.Name, "vpc_id", vpcID)
+	} else {
+		vpcID = aws.ToString(existing.VpcId)
+		owner = aws.ToString(existing.OwnerId)
+		logger.Info("VPC already exists", "vpc", vpc.Name, "vpc_id", vpcID)
+		// Its internet gateway, subnets and route table are left as they are too, but the
+		// IDs of its subnets are still recorded for the resources that reference them
+		if vpc.IfNotExists {
+			res.ARN = fmt.Sprintf("arn:%s:ec2:%s:%s:vpc/%s", partitionForRegion(b.awsConfig.Region), b.awsConfig.Region, owner, vpcID)
+			for _, subnet := range vpc.Subnets {
+				current, err := b.findSubnet(ctx, vpc, vpcID, subnet)
+				if err != nil {
+					return err
+				}
+				if current == nil {
+					res.warnf("subnet %s of VPC %s does not exist and is not created because of if_not_exists", subnet.Name, vpc.Name)
+					continue
+				}
+				res.recordSubnetID(subnet.Name, aws.ToString(current.SubnetId))
+			}
+			leaveExisting(res)
+			return nil
+		}
+		if current := aws.ToString(existing.CidrBlock); current != vpc.CIDRBlock {
+			res.warnf("VPC %s has CIDR block %s, not %s; the CIDR block cannot be changed", vpc.Name, current, vpc.CIDRBlock)
+		}
+		if len(vpc.Tags) > 0 {
+			b.tagEC2Resource(ctx, vpcID, "VPC "+vpc.Name, vpc.Tags, res)
+		}
+	}
+	res.ARN = fmt.Sprintf("arn:%s:ec2:%s:%s:vpc/%s", partitionForRegion(b.awsConfig.Region), b.awsConfig.Region, owner, vpcID)
+
+	var gatewayID string
+	if vpc.InternetGateway {
+		if gatewayID, err = b.ensureInternetGateway(ctx, vpc, vpcID, res); err != nil {
+			return err
+		}
+	}
+
+	var public []string
+	for _, subnet := range vpc.Subnets {
+		subnetID, err := b.ensureSubnet(ctx, vpc, vpcID, subnet, res)
+		if err != nil {
+			return err
+		}
+		res.recordSubnetID(subnet.Name, subnetID)
+		if subnet.Public {
+			public = append(public, subnetID)
+		}
+	}
+
+	if len(public) > 0 {
+		return b.ensurePublicRouteTable(ctx, vpc, vpcID, gatewayID, public, res)
+	}
+	return nil
+}
+
+// findVPC returns the VPC tagged with the config name, or nil when there is none
+func (b *Bootstrapper) findVPC(ctx context.Context, name string) (*ec2types.Vpc, error) {
+	output, err := b.ec2Client.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{
+		Filters: []ec2types.Filter{tagFilter(vpcNameTag, name)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up VPC %s: %w", name, err)
+	}
+	switch len(output.Vpcs) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &output.Vpcs[0], nil
+	default:
+		return nil, fmt.Errorf("found %d VPCs tagged %s=%s; remove the tag from all but one", len(output.Vpcs), vpcNameTag, name)
+	}
+}
+
+// ensureInternetGateway attaches an internet gateway to the VPC unless one is attached
+// already, and returns its ID
+func (b *Bootstrapper) ensureInternetGateway(ctx context.Context, vpc VPC, vpcID string, res *ResourceResult) (string, error) {
+	output, err := b.ec2Client.DescribeInternetGateways(ctx, &ec2.DescribeInternetGatewaysInput{
+		Filters: []ec2types.Filter{{Name: aws.String("attachment.vpc-id"), Values: []string{vpcID}}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to look up internet gateway of VPC %s: %w", vpc.Name, err)
+	}
+	if len(output.InternetGateways) > 0 {
+		return aws.ToString(output.InternetGateways[0].InternetGatewayId), nil
+	}
+
+	created, err := b.ec2Client.CreateInternetGateway(ctx, &ec2.CreateInternetGatewayInput{
+		TagSpecifications: ec2TagSpecifications(ec2types.ResourceTypeInternetGateway, vpc.Name, vpc.Tags, vpcNameTag, vpc.Name),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create internet gateway for VPC %s: %w", vpc.Name, err)
+	}
+	gatewayID := aws.ToString(created.InternetGateway.InternetGatewayId)
+	_, err = b.ec2Client.AttachInternetGateway(ctx, &ec2.AttachInternetGatewayInput{
+		InternetGatewayId: aws.String(gatewayID),
+		VpcId:             aws.String(vpcID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to attach internet gateway %s to VPC %s: %w", gatewayID, vpc.Name, err)
+	}
+	res.updated()
+	logger.Info("Attached internet gateway", "vpc", vpc.Name, "internet_gateway", gatewayID)
+	return gatewayID, nil
+}
+
+// findSubnet returns the subnet of the VPC tagged with the subnet's name, or nil if there is none
+func (b *Bootstrapper) findSubnet(ctx context.Context, vpc VPC, vpcID string, subnet VPCSubnet) (*ec2types.Subnet, error) {
+	output, err := b.ec2Client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{
+		Filters: []ec2types.Filter{
+			{Name: aws.String("vpc-id"), Values: []string{vpcID}},
+			tagFilter(subnetNameTag, subnet.Name),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up subnet %s of VPC %s: %w", subnet.Name, vpc.Name, err)
+	}
+	if len(output.Subnets) == 0 {
+		return nil, nil
+	}
+	return &output.Subnets[0], nil
+}
+
+// ensureSubnet creates the subnet if the VPC has no subnet tagged with its name and makes
+// public subnets assign public IP addresses. It returns the subnet ID.
+func (b *Bootstrapper) ensureSubnet(ctx context.Context, vpc VPC, vpcID string, subnet VPCSubnet, res *ResourceResult) (string, error) {
+	current, err := b.findSubnet(ctx, vpc, vpcID, subnet)
+	if err != nil {
+		return "", err
+	}
+
+	var subnetID string
+	mapPublicIP := false
+	if current != nil {
+		subnetID = aws.ToString(current.SubnetId)
+		mapPublicIP = aws.ToBool(current.MapPublicIpOnLaunch)
+		if aws.ToString(current.CidrBlock) != subnet.CIDRBlock || aws.ToString(current.AvailabilityZone) != subnet.AvailabilityZone {
+			res.warnf("subnet %s of VPC %s is %s in %s, not %s in %s; subnets cannot be moved", subnet.Name, vpc.Name,
+				aws.ToString(current.CidrBlock), aws.ToString(current.AvailabilityZone), subnet.CIDRBlock, subnet.AvailabilityZone)
+		}
+	} else {
+		created, err := b.ec2Client.CreateSubnet(ctx, &ec2.CreateSubnetInput{
+			VpcId:             aws.String(vpcID),
+			CidrBlock:         aws.String(subnet.CIDRBlock),
+			AvailabilityZone:  aws.String(subnet.AvailabilityZone),
+			TagSpecifications: ec2TagSpecifications(ec2types.ResourceTypeSubnet, vpc.Name+"-"+subnet.Name, vpc.Tags, vpcNameTag, vpc.Name, subnetNameTag, subnet.Name),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to create subnet %s of VPC %s: %w", subnet.Name, vpc.Name, err)
+		}
+		subnetID = aws.ToString(created.Subnet.SubnetId)
+		res.updated()
+		logger.Info("Created subnet", "vpc", vpc.Name, "subnet", subnet.Name, "subnet_id", subnetID)
+	}
+
+	if mapPublicIP != subnet.Public {
+		_, err := b.ec2Client.ModifySubnetAttribute(ctx, &ec2.ModifySubnetAttributeInput{
+			SubnetId:            aws.String(subnetID),
+			MapPublicIpOnLaunch: &ec2types.AttributeBooleanValue{Value: aws.Bool(subnet.Public)},
+		})
+		if err != nil {
+			res.warnf("failed to set public IP assignment for subnet %s of VPC %s: %v", subnet.Name, vpc.Name, err)
+		} else {
+			res.updated()
+		}
+	}
+	return subnetID, nil
+}
+
+// ensurePublicRouteTable routes the public subnets to the internet through a route table
+// with a default route to the internet gateway
+func (b *Bootstrapper) ensurePublicRouteTable(ctx context.Context, vpc VPC, vpcID, gatewayID string, subnetIDs []string, res *ResourceResult) error {
+	output, err := b.ec2Client.DescribeRouteTables(ctx, &ec2.DescribeRouteTablesInput{
+		Filters: []ec2types.Filter{
+			{Name: aws.String("vpc-id"), Values: []string{vpcID}},
+			tagFilter(routeTableNameTag, publicRouteTable),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to look up public route table of VPC %s: %w", vpc.Name, err)
+	}
+
+	var table ec2types.RouteTable
+	if len(output.RouteTables) > 0 {
+		table = output.RouteTables[0]
+	} else {
+		created, err := b.ec2Client.CreateRouteTable(ctx, &ec2.CreateRouteTableInput{
+			VpcId:             aws.String(vpcID),
+			TagSpecifications: ec2TagSpecifications(ec2types.ResourceTypeRouteTable, vpc.Name+"-"+publicRouteTable, vpc.Tags, vpcNameTag, vpc.Name, routeTableNameTag, publicRouteTable),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create public route table for VPC %s: %w", vpc.Name, err)
+		}
+		table = *created.RouteTable
+		res.updated()
+		logger.Info("Created public route table", "vpc", vpc.Name, "route_table", aws.ToString(table.RouteTableId))
+	}
+	tableID := aws.ToString(table.RouteTableId)
+
+	hasDefaultRoute := slices.ContainsFunc(table.Routes, func(route ec2types.Route) bool {
+		return aws.ToString(route.DestinationCidrBlock) == "0.0.0.0/0"
+	})
+	if !hasDefaultRoute {
+		_, err := b.ec2Client.CreateRoute(ctx, &ec2.CreateRouteInput{
+			RouteTableId:         aws.String(tableID),
+			DestinationCidrBlock: aws.String("0.0.0.0/0"),
+			GatewayId:            aws.String(gatewayID),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add default route to public route table of VPC %s: %w", vpc.Name, err)
+		}
+		res.updated()
+	}
+
+	for _, subnetID := range subnetIDs {
+		associated := slices.ContainsFunc(table.Associations, func(association ec2types.RouteTableAssociation) bool {
+			return aws.ToString(association.SubnetId) == subnetID
+		})
+		if associated {
+			continue
+		}
+		_, err := b.ec2Client.AssociateRouteTable(ctx, &ec2.AssociateRouteTableInput{
+			RouteTableId: aws.String(tableID),
+			SubnetId:     aws.String(subnetID),
+		})
+		if err != nil {
+			res.warnf("failed to associate subnet %s with the public route table of VPC %s: %v", subnetID, vpc.Name, err)
+			continue
+		}
+		res.updated()
+		logger.Info("Associated subnet with public route table", "vpc", vpc.Name, "subnet_id", subnetID)
+	}
+	return nil
+}
+
+// tagEC2Resource sets the configured tags on an existing EC2 resource
+func (b *Bootstrapper) tagEC2Resource(ctx context.Context, resourceID, description string, tags map[string]string, res *ResourceResult) {
+	_, err := b.ec2Client.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{resourceID},
+		Tags:      buildEC2Tags(tags),
+	})
+	if err != nil {
+		res.warnf("failed to set tags for %s: %v", description, err)
+		return
+	}
+	res.updated()
+	logger.Info("Set tags", "resource", description, "tags", len(tags))
+}
+
+// isSubnetReference reports whether a subnet ID is a <vpc>/<subnet> reference to a subnet
+// of a VPC created by this tool
+func isSubnetReference(subnetID string) bool {
+	return strings.Contains(subnetID, "/")
+}
+
+// resolveSubnetIDs replaces <vpc>/<subnet> references with the IDs of the subnets tagged
+// with those names. Subnet IDs are returned unchanged.
+func (b *Bootstrapper) resolveSubnetIDs(ctx context.Context, subnetIDs []string) ([]string, error) {
+	resolved := make([]string, 0, len(subnetIDs))
+	for _, subnetID := range subnetIDs {
+		if !isSubnetReference(subnetID) {
+			resolved = append(resolved, subnetID)
+			continue
+		}
+
+		vpcName, subnetName, _ := strings.Cut(subnetID, "/")
+		output, err := b.ec2Client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{
+			Filters: []ec2types.Filter{tagFilter(vpcNameTag, vpcName), tagFilter(subnetNameTag, subnetName)},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up subnet %s: %w", subnetID, err)
+		}
+		if len(output.Subnets) == 0 {
+			return nil, fmt.Errorf("subnet %s not found", subnetID)
+		}
+		resolved = append(resolved, aws.ToString(output.Subnets[0].SubnetId))
+	}
+	return resolved, nil
+}
+
+// tagFilter matches EC2 resources that have the tag
+func tagFilter(key, value string) ec2types.Filter {
+	return ec2types.Filter{Name: aws.String("tag:" + key), Values: []string{value}}
+}
+
+// ec2TagSpecifications tags a new EC2 resource with a Name, the configured tags and the
+// given key/value pairs recording its config names. A Name in the configured tags wins.
+func ec2TagSpecifications(resourceType ec2types.ResourceType, name string, tags map[string]string, nameTags ...string) []ec2types.TagSpecification {
+	all := map[string]string{"Name": name}
+	for key, value := range tags {
+		all[key] = value
+	}
+	for i := 0; i+1 < len(nameTags); i += 2 {
+		all[nameTags[i]] = nameTags[i+1]
+	}
+	return []ec2types.TagSpecification{{ResourceType: resourceType, Tags: buildEC2Tags(all)}}
+}
+
+// buildEC2Tags converts a tag map into EC2 tags sorted by key
+func buildEC2Tags(tags map[string]string) []ec2types.Tag {
+	result := make([]ec2types.Tag, 0, len(tags))
+	for _, key := range sortedKeys(tags) {
+		result = append(result, ec2types.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/smithy-go"
+)
+
+// Warning is a non-fatal problem met while provisioning a resource, such as a setting that
+// could not be applied
+type Warning struct {
+	Type string
+	Name string
+	// Operation is the AWS API operation that failed, e.g. PutBucketVersioning; it is empty
+	// when the warning does not come from a failed call
+	Operation string
+	Message   string
+	// Err is the underlying error, if any
+	Err error
+}
+
+// String returns the warning message
+func (w Warning) String() string {
+	return w.Message
+}
+
+// newWarning formats a warning for a resource. The last error among args, if any, becomes
+// the warning's Err, and the AWS operation it failed in becomes its Operation.
+func newWarning(resourceType, name, format string, args ...any) Warning {
+	warning := Warning{
+		Type:    resourceType,
+		Name:    name,
+		Message: fmt.Sprintf(format, args...),
+	}
+	for i := len(args) - 1; i >= 0; i-- {
+		if err, ok := args[i].(error); ok {
+			warning.Err = err
+			break
+		}
+	}
+
+	var opErr *smithy.OperationError
+	if errors.As(warning.Err, &opErr) {
+		warning.Operation = opErr.Operation()
+	}
+	return warning
+}
+
+// logAttrs returns the attributes the warning is logged with
+func (w Warning) logAttrs() []any {
+	attrs := []any{"type", w.Type, "name", w.Name}
+	if w.Operation != "" {
+		attrs = append(attrs, slog.String("operation", w.Operation))
+	}
+	return attrs
+}
+
+// Warnings returns every warning recorded for the resources of the run, in the order they
+// were provisioned
+func (r *ProvisionResult) Warnings() []Warning {
+	var warnings []Warning
+	for _, res := range r.Resources {
+		warnings = append(warnings, res.Warnings...)
+	}
+	return warnings
+}
+
+// WarningsFor returns the warnings recorded for one resource
+func (r *ProvisionResult) WarningsFor(resourceType, name string) []Warning {
+	var warnings []Warning
+	for _, res := range r.Resources {
+		if res.Type == resourceType && res.Name == name {
+			warnings = append(warnings, res.Warnings...)
+		}
+	}
+	return warnings
+}
+
+// warningMessages returns the messages of the warnings
+func warningMessages(warnings []Warning) []string {
+	if len(warnings) == 0 {
+		return nil
+	}
+	messages := make([]string, len(warnings))
+	for i, warning := range warnings {
+		messages[i] = warning.Message
+	}
+	return messages
+}
@@ -0,0 +1,134 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	acmtypes "github.com/aws/aws-sdk-go-v2/service/acm/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
+)
+
+// MockACMClient is a mock implementation of the ACM client
+type MockACMClient struct {
+	mock.Mock
+}
+
+func (m *MockACMClient) ListCertificates(ctx context.Context, params *acm.ListCertificatesInput, optFns ...func(*acm.Options)) (*acm.ListCertificatesOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*acm.ListCertificatesOutput), args.Error(1)
+}
+
+func (m *MockACMClient) DescribeCertificate(ctx context.Context, params *acm.DescribeCertificateInput, optFns ...func(*acm.Options)) (*acm.DescribeCertificateOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*acm.DescribeCertificateOutput), args.Error(1)
+}
+
+func (m *MockACMClient) RequestCertificate(ctx context.Context, params *acm.RequestCertificateInput, optFns ...func(*acm.Options)) (*acm.RequestCertificateOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*acm.RequestCertificateOutput), args.Error(1)
+}
+
+func (m *MockACMClient) AddTagsToCertificate(ctx context.Context, params *acm.AddTagsToCertificateInput, optFns ...func(*acm.Options)) (*acm.AddTagsToCertificateOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*acm.AddTagsToCertificateOutput), args.Error(1)
+}
+
+const testCertificateARN = "arn:aws:acm:us-west-2:123456789012:certificate/abc"
+
+// pendingCertificate describes a certificate for example.com and *.example.com, which share
+// a validation record
+func pendingCertificate() *acm.DescribeCertificateOutput {
+	record := &acmtypes.ResourceRecord{
+		Name:  aws.String("_x1.example.com."),
+		Type:  acmtypes.RecordTypeCname,
+		Value: aws.String("_y1.acm-validations.aws."),
+	}
+	return &acm.DescribeCertificateOutput{Certificate: &acmtypes.CertificateDetail{
+		CertificateArn: aws.String(testCertificateARN),
+		Status:         acmtypes.CertificateStatusPendingValidation,
+		DomainValidationOptions: []acmtypes.DomainValidation{
+			{DomainName: aws.String("example.com"), ResourceRecord: record},
+			{DomainName: aws.String("*.example.com"), ResourceRecord: record},
+		},
+	}}
+}
+
+// TestCertificateRequestWithDNSValidation tests that a new certificate is requested and its
+// validation record is created once in the zone from the config
+func TestCertificateRequestWithDNSValidation(t *testing.T) {
+	mockACMClient := new(MockACMClient)
+	mockACMClient.On("ListCertificates", mock.Anything, mock.Anything).Return(&acm.ListCertificatesOutput{
+		CertificateSummaryList: []acmtypes.CertificateSummary{
+			// Same domain but a different set of names, so it must not be reused
+			{CertificateArn: aws.String("arn:aws:acm:us-west-2:123456789012:certificate/old"), DomainName: aws.String("example.com"),
+				SubjectAlternativeNameSummaries: []string{"example.com"}},
+		},
+	}, nil)
+	mockACMClient.On("RequestCertificate", mock.Anything, mock.MatchedBy(func(input *acm.RequestCertificateInput) bool {
+		return aws.ToString(input.DomainName) == "example.com" && input.ValidationMethod == acmtypes.ValidationMethodDns &&
+			len(aws.ToString(input.IdempotencyToken)) == 32
+	})).Return(&acm.RequestCertificateOutput{CertificateArn: aws.String(testCertificateARN)}, nil)
+	mockACMClient.On("DescribeCertificate", mock.Anything, mock.Anything).Return(pendingCertificate(), nil)
+
+	mockRoute53Client := new(MockRoute53Client)
+	mockRoute53Client.On("ListHostedZonesByName", mock.Anything, mock.Anything).Return(&route53.ListHostedZonesByNameOutput{
+		HostedZones: []types.HostedZone{
+			{Id: aws.String("/hostedzone/ZPUBLIC"), Name: aws.String("example.com."), Config: &types.HostedZoneConfig{}},
+		},
+	}, nil)
+	mockRoute53Client.On("ChangeResourceRecordSets", mock.Anything, mock.MatchedBy(func(input *route53.ChangeResourceRecordSetsInput) bool {
+		changes := input.ChangeBatch.Changes
+		return aws.ToString(input.HostedZoneId) == "ZPUBLIC" && len(changes) == 1 &&
+			changes[0].Action == types.ChangeActionUpsert && changes[0].ResourceRecordSet.Type == types.RRTypeCname &&
+			aws.ToString(changes[0].ResourceRecordSet.Name) == "_x1.example.com."
+	})).Return(&route53.ChangeResourceRecordSetsOutput{}, nil).Once()
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{ACM: mockACMClient, Route53: mockRoute53Client})
+	results, err := bootstrapper.RequestCertificates(context.Background(), []bootstrap.Certificate{
+		{DomainName: "example.com", SubjectAlternativeNames: []string{"*.example.com"}},
+	}, []bootstrap.HostedZone{{Name: "example.com"}})
+	if err != nil {
+		t.Fatalf("Failed to request certificate: %v", err)
+	}
+
+	if results[0].Action != bootstrap.ActionCreated || results[0].ARN != testCertificateARN || len(results[0].Warnings) != 0 {
+		t.Errorf("Expected certificate to be created without warnings, got %+v", results[0])
+	}
+	mockACMClient.AssertExpectations(t)
+	mockRoute53Client.AssertExpectations(t)
+}
+
+// TestCertificateReusesExisting tests that a certificate for the same names is not
+// requested again, and that a domain outside the configured zones is reported
+func TestCertificateReusesExisting(t *testing.T) {
+	mockACMClient := new(MockACMClient)
+	mockACMClient.On("ListCertificates", mock.Anything, mock.Anything).Return(&acm.ListCertificatesOutput{
+		CertificateSummaryList: []acmtypes.CertificateSummary{
+			{CertificateArn: aws.String(testCertificateARN), DomainName: aws.String("example.com"),
+				SubjectAlternativeNameSummaries: []string{"*.example.com", "example.com"}},
+		},
+	}, nil)
+	mockACMClient.On("DescribeCertificate", mock.Anything, mock.Anything).Return(pendingCertificate(), nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{ACM: mockACMClient})
+	results, err := bootstrapper.RequestCertificates(context.Background(), []bootstrap.Certificate{
+		{DomainName: "example.com", SubjectAlternativeNames: []string{"*.example.com"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Failed to reconcile certificate: %v", err)
+	}
+
+	if results[0].Action != bootstrap.ActionUnchanged || results[0].ARN != testCertificateARN {
+		t.Errorf("Expected existing certificate to be reused, got %+v", results[0])
+	}
+	if len(results[0].Warnings) != 1 {
+		t.Errorf("Expected one warning about the missing validation record, got %v", results[0].Warnings)
+	}
+	mockACMClient.AssertNotCalled(t, "RequestCertificate", mock.Anything, mock.Anything)
+	mockACMClient.AssertExpectations(t)
+}
@@ -0,0 +1,119 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
+)
+
+// testAuroraCluster is a two-instance cluster with a configured master password
+func testAuroraCluster() bootstrap.AuroraCluster {
+	return bootstrap.AuroraCluster{
+		Identifier:            "app-cluster",
+		Engine:                "aurora-postgresql",
+		MasterUsername:        "admin",
+		MasterPassword:        "correct-horse-battery",
+		BackupRetentionPeriod: 7,
+		DeletionProtection:    true,
+		Instances: []bootstrap.AuroraInstance{
+			{Identifier: "app-cluster-1", InstanceClass: "db.r6g.large"},
+			{Identifier: "app-cluster-2", InstanceClass: "db.r6g.large"},
+		},
+	}
+}
+
+// existingAuroraCluster is app-cluster in the given status with only its first instance,
+// a one-day retention and no deletion protection
+func existingAuroraCluster(status string) *rds.DescribeDBClustersOutput {
+	return &rds.DescribeDBClustersOutput{DBClusters: []rdstypes.DBCluster{{
+		DBClusterIdentifier:   aws.String("app-cluster"),
+		DBClusterArn:          aws.String("arn:aws:rds:us-west-2:123456789012:cluster:app-cluster"),
+		Status:                aws.String(status),
+		BackupRetentionPeriod: aws.Int32(1),
+		DeletionProtection:    aws.Bool(false),
+		DBClusterMembers:      []rdstypes.DBClusterMember{{DBInstanceIdentifier: aws.String("app-cluster-1")}},
+	}}}
+}
+
+// auroraMember matches the CreateDBInstance call for a member of app-cluster
+func auroraMember(identifier string) any {
+	return mock.MatchedBy(func(input *rds.CreateDBInstanceInput) bool {
+		return aws.ToString(input.DBInstanceIdentifier) == identifier &&
+			aws.ToString(input.DBClusterIdentifier) == "app-cluster" &&
+			aws.ToString(input.Engine) == "aurora-postgresql"
+	})
+}
+
+// TestAuroraClusterCreate tests that a missing cluster is created with its settings, and
+// that every member instance is then added to it
+func TestAuroraClusterCreate(t *testing.T) {
+	mockRDSClient := new(MockRDSClient)
+	mockRDSClient.On("DescribeDBClusters", mock.Anything, mock.Anything).Return((*rds.DescribeDBClustersOutput)(nil), &rdstypes.DBClusterNotFoundFault{})
+	mockRDSClient.On("CreateDBCluster", mock.Anything, mock.MatchedBy(func(input *rds.CreateDBClusterInput) bool {
+		return aws.ToString(input.DBClusterIdentifier) == "app-cluster" &&
+			aws.ToString(input.MasterUserPassword) == "correct-horse-battery" &&
+			aws.ToInt32(input.BackupRetentionPeriod) == 7 && aws.ToBool(input.DeletionProtection)
+	})).Return(&rds.CreateDBClusterOutput{DBCluster: &rdstypes.DBCluster{
+		DBClusterArn: aws.String("arn:aws:rds:us-west-2:123456789012:cluster:app-cluster"),
+	}}, nil).Once()
+	mockRDSClient.On("CreateDBInstance", mock.Anything, auroraMember("app-cluster-1")).Return(&rds.CreateDBInstanceOutput{}, nil).Once()
+	mockRDSClient.On("CreateDBInstance", mock.Anything, auroraMember("app-cluster-2")).Return(&rds.CreateDBInstanceOutput{}, nil).Once()
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient})
+	results, err := bootstrapper.ManageAuroraClusters(context.Background(), []bootstrap.AuroraCluster{testAuroraCluster()})
+	if err != nil {
+		t.Fatalf("Failed to create Aurora cluster: %v", err)
+	}
+	if results[0].Action != bootstrap.ActionCreated || results[0].ARN != "arn:aws:rds:us-west-2:123456789012:cluster:app-cluster" {
+		t.Errorf("Expected the cluster to be created, got %+v", results[0])
+	}
+	mockRDSClient.AssertExpectations(t)
+}
+
+// TestAuroraClusterReconcile tests that an existing cluster gets its missing member
+// instances and has its retention and deletion protection changed in one call
+func TestAuroraClusterReconcile(t *testing.T) {
+	mockRDSClient := new(MockRDSClient)
+	mockRDSClient.On("DescribeDBClusters", mock.Anything, mock.Anything).Return(existingAuroraCluster("available"), nil)
+	mockRDSClient.On("ModifyDBCluster", mock.Anything, mock.MatchedBy(func(input *rds.ModifyDBClusterInput) bool {
+		return aws.ToInt32(input.BackupRetentionPeriod) == 7 && aws.ToBool(input.DeletionProtection)
+	})).Return(&rds.ModifyDBClusterOutput{}, nil).Once()
+	mockRDSClient.On("CreateDBInstance", mock.Anything, auroraMember("app-cluster-2")).Return(&rds.CreateDBInstanceOutput{}, nil).Once()
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient})
+	results, err := bootstrapper.ManageAuroraClusters(context.Background(), []bootstrap.AuroraCluster{testAuroraCluster()})
+	if err != nil {
+		t.Fatalf("Failed to reconcile Aurora cluster: %v", err)
+	}
+	if results[0].Action != bootstrap.ActionUpdated || len(results[0].Warnings) != 0 {
+		t.Errorf("Expected the cluster to be updated without warnings, got %+v", results[0])
+	}
+	mockRDSClient.AssertNotCalled(t, "CreateDBCluster", mock.Anything, mock.Anything)
+	mockRDSClient.AssertNotCalled(t, "CreateDBInstance", mock.Anything, auroraMember("app-cluster-1"))
+	mockRDSClient.AssertExpectations(t)
+}
+
+// TestAuroraClusterBusySkipsModify tests that the settings of a cluster that is not
+// available are only warned about, while missing members are still added
+func TestAuroraClusterBusySkipsModify(t *testing.T) {
+	mockRDSClient := new(MockRDSClient)
+	mockRDSClient.On("DescribeDBClusters", mock.Anything, mock.Anything).Return(existingAuroraCluster("backing-up"), nil)
+	mockRDSClient.On("CreateDBInstance", mock.Anything, auroraMember("app-cluster-2")).Return(&rds.CreateDBInstanceOutput{}, nil).Once()
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient})
+	results, err := bootstrapper.ManageAuroraClusters(context.Background(), []bootstrap.AuroraCluster{testAuroraCluster()})
+	if err != nil {
+		t.Fatalf("Failed to reconcile Aurora cluster: %v", err)
+	}
+	if len(results[0].Warnings) != 1 || !strings.Contains(results[0].Warnings[0].Message, "backing-up state") {
+		t.Errorf("Expected a warning about the cluster state, got %v", results[0].Warnings)
+	}
+	mockRDSClient.AssertNotCalled(t, "ModifyDBCluster", mock.Anything, mock.Anything)
+	mockRDSClient.AssertExpectations(t)
+}
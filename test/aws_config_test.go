@@ -0,0 +1,74 @@
+package test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
+)
+
+// isolateAWSConfig keeps the test from reading the shared AWS config and credentials files
+func isolateAWSConfig(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_MAX_ATTEMPTS", "")
+	t.Setenv("AWS_RETRY_MODE", "")
+}
+
+// TestLoadAWSConfigRetryOptions tests that retry options are passed through to the SDK config
+func TestLoadAWSConfigRetryOptions(t *testing.T) {
+	isolateAWSConfig(t)
+
+	tests := []struct {
+		name        string
+		opts        bootstrap.AWSOptions
+		wantAttempt int
+		wantMode    aws.RetryMode
+	}{
+		{name: "defaults", wantAttempt: 3, wantMode: aws.RetryModeStandard},
+		{name: "custom", opts: bootstrap.AWSOptions{RetryMaxAttempts: 10, RetryMode: "adaptive"}, wantAttempt: 10, wantMode: aws.RetryModeAdaptive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := bootstrap.LoadAWSConfig(context.Background(), "us-west-2", tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to load AWS config: %v", err)
+			}
+			if cfg.RetryMaxAttempts != tt.wantAttempt {
+				t.Errorf("Expected %d max attempts, got %d", tt.wantAttempt, cfg.RetryMaxAttempts)
+			}
+			if cfg.RetryMode != tt.wantMode {
+				t.Errorf("Expected retry mode %s, got %s", tt.wantMode, cfg.RetryMode)
+			}
+		})
+	}
+
+	if _, err := bootstrap.LoadAWSConfig(context.Background(), "us-west-2", bootstrap.AWSOptions{RetryMode: "aggressive"}); err == nil {
+		t.Error("Expected an error for an unknown retry mode")
+	}
+}
+
+// TestLoadAWSConfigEndpoint tests that an endpoint override is applied to the SDK config
+func TestLoadAWSConfigEndpoint(t *testing.T) {
+	isolateAWSConfig(t)
+	t.Setenv("AWS_ENDPOINT_URL", "")
+
+	cfg, err := bootstrap.LoadAWSConfig(context.Background(), "us-west-2", bootstrap.AWSOptions{EndpointURL: "http://localhost:4566"})
+	if err != nil {
+		t.Fatalf("Failed to load AWS config: %v", err)
+	}
+	if aws.ToString(cfg.BaseEndpoint) != "http://localhost:4566" {
+		t.Errorf("Expected base endpoint http://localhost:4566, got %q", aws.ToString(cfg.BaseEndpoint))
+	}
+
+	if _, err := bootstrap.LoadAWSConfig(context.Background(), "us-west-2", bootstrap.AWSOptions{EndpointURL: "localhost:4566"}); err == nil {
+		t.Error("Expected an error for an endpoint without a scheme")
+	}
+}
@@ -0,0 +1,245 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/mock"
+	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
+)
+
+// MockECRClient is a mock implementation of the ECR client
+type MockECRClient struct {
+	mock.Mock
+}
+
+func (m *MockECRClient) DescribeRepositories(ctx context.Context, params *ecr.DescribeRepositoriesInput, optFns ...func(*ecr.Options)) (*ecr.DescribeRepositoriesOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.DescribeRepositoriesOutput), args.Error(1)
+}
+
+func (m *MockECRClient) CreateRepository(ctx context.Context, params *ecr.CreateRepositoryInput, optFns ...func(*ecr.Options)) (*ecr.CreateRepositoryOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.CreateRepositoryOutput), args.Error(1)
+}
+
+func (m *MockECRClient) PutLifecyclePolicy(ctx context.Context, params *ecr.PutLifecyclePolicyInput, optFns ...func(*ecr.Options)) (*ecr.PutLifecyclePolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.PutLifecyclePolicyOutput), args.Error(1)
+}
+
+func (m *MockECRClient) SetRepositoryPolicy(ctx context.Context, params *ecr.SetRepositoryPolicyInput, optFns ...func(*ecr.Options)) (*ecr.SetRepositoryPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.SetRepositoryPolicyOutput), args.Error(1)
+}
+
+func (m *MockECRClient) DeleteRepository(ctx context.Context, params *ecr.DeleteRepositoryInput, optFns ...func(*ecr.Options)) (*ecr.DeleteRepositoryOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.DeleteRepositoryOutput), args.Error(1)
+}
+
+func (m *MockECRClient) TagResource(ctx context.Context, params *ecr.TagResourceInput, optFns ...func(*ecr.Options)) (*ecr.TagResourceOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.TagResourceOutput), args.Error(1)
+}
+
+func (m *MockECRClient) ListTagsForResource(ctx context.Context, params *ecr.ListTagsForResourceInput, optFns ...func(*ecr.Options)) (*ecr.ListTagsForResourceOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.ListTagsForResourceOutput), args.Error(1)
+}
+
+func (m *MockECRClient) UntagResource(ctx context.Context, params *ecr.UntagResourceInput, optFns ...func(*ecr.Options)) (*ecr.UntagResourceOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.UntagResourceOutput), args.Error(1)
+}
+
+func (m *MockECRClient) GetLifecyclePolicy(ctx context.Context, params *ecr.GetLifecyclePolicyInput, optFns ...func(*ecr.Options)) (*ecr.GetLifecyclePolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.GetLifecyclePolicyOutput), args.Error(1)
+}
+
+func (m *MockECRClient) GetRepositoryPolicy(ctx context.Context, params *ecr.GetRepositoryPolicyInput, optFns ...func(*ecr.Options)) (*ecr.GetRepositoryPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.GetRepositoryPolicyOutput), args.Error(1)
+}
+
+func (m *MockECRClient) DeleteLifecyclePolicy(ctx context.Context, params *ecr.DeleteLifecyclePolicyInput, optFns ...func(*ecr.Options)) (*ecr.DeleteLifecyclePolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.DeleteLifecyclePolicyOutput), args.Error(1)
+}
+
+func (m *MockECRClient) DeleteRepositoryPolicy(ctx context.Context, params *ecr.DeleteRepositoryPolicyInput, optFns ...func(*ecr.Options)) (*ecr.DeleteRepositoryPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.DeleteRepositoryPolicyOutput), args.Error(1)
+}
+
+func (m *MockECRClient) PutImageTagMutability(ctx context.Context, params *ecr.PutImageTagMutabilityInput, optFns ...func(*ecr.Options)) (*ecr.PutImageTagMutabilityOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.PutImageTagMutabilityOutput), args.Error(1)
+}
+
+func (m *MockECRClient) PutImageScanningConfiguration(ctx context.Context, params *ecr.PutImageScanningConfigurationInput, optFns ...func(*ecr.Options)) (*ecr.PutImageScanningConfigurationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*ecr.PutImageScanningConfigurationOutput), args.Error(1)
+}
+
+// TestECRLifecyclePolicyFile tests that a lifecycle policy is read from its file and that a
+// malformed file fails before the repository is touched, naming the file and line
+func TestECRLifecyclePolicyFile(t *testing.T) {
+	dir := t.TempDir()
+	policy := `{"rules": [{"rulePriority": 1, "selection": {"tagStatus": "untagged", "countType": "sinceImagePushed", "countUnit": "days", "countNumber": 14}, "action": {"type": "expire"}}]}`
+	valid := filepath.Join(dir, "lifecycle.json")
+	broken := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(valid, []byte(policy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(broken, []byte("{\n  \"rules\": [\n    {\"rulePriority\": 1\n}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mockECRClient := new(MockECRClient)
+	mockECRClient.On("DescribeRepositories", mock.Anything, mock.Anything).Return(&ecr.DescribeRepositoriesOutput{
+		Repositories: []ecrtypes.Repository{{RepositoryArn: aws.String("arn:aws:ecr:us-west-2:123456789012:repository/api")}},
+	}, nil)
+	mockECRClient.On("PutLifecyclePolicy", mock.Anything, mock.MatchedBy(func(input *ecr.PutLifecyclePolicyInput) bool {
+		return aws.ToString(input.LifecyclePolicyText) == policy
+	})).Return(&ecr.PutLifecyclePolicyOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{ECR: mockECRClient})
+	results, err := bootstrapper.CreateECRRepositories(context.Background(), []bootstrap.ECRRepository{
+		{Name: "api", LifecyclePolicyFile: valid},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create ECR repository: %v", err)
+	}
+	if results[0].Action != bootstrap.ActionUpdated {
+		t.Errorf("Expected the lifecycle policy to be applied, got %+v", results[0])
+	}
+	mockECRClient.AssertExpectations(t)
+
+	_, err = bootstrapper.CreateECRRepositories(context.Background(), []bootstrap.ECRRepository{
+		{Name: "worker", LifecyclePolicyFile: broken},
+	})
+	if err == nil || !strings.Contains(err.Error(), broken+": line 4") {
+		t.Errorf("Expected a parse error naming %s and the line, got %v", broken, err)
+	}
+	mockECRClient.AssertNumberOfCalls(t, "DescribeRepositories", 1)
+}
+
+// TestECRInventoryFollowsPages tests that plan and destroy find repositories on every page
+// of DescribeRepositories, and that destroy skips repositories that are not listed
+func TestECRInventoryFollowsPages(t *testing.T) {
+	mockECRClient := new(MockECRClient)
+	mockECRClient.On("DescribeRepositories", mock.Anything, mock.MatchedBy(func(input *ecr.DescribeRepositoriesInput) bool {
+		return input.NextToken == nil
+	})).Return(&ecr.DescribeRepositoriesOutput{
+		Repositories: []ecrtypes.Repository{{RepositoryName: aws.String("api")}},
+		NextToken:    aws.String("page-2"),
+	}, nil)
+	mockECRClient.On("DescribeRepositories", mock.Anything, mock.MatchedBy(func(input *ecr.DescribeRepositoriesInput) bool {
+		return aws.ToString(input.NextToken) == "page-2"
+	})).Return(&ecr.DescribeRepositoriesOutput{
+		Repositories: []ecrtypes.Repository{{RepositoryName: aws.String("worker")}},
+	}, nil)
+	mockECRClient.On("DeleteRepository", mock.Anything, mock.Anything).Return(&ecr.DeleteRepositoryOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{ECR: mockECRClient})
+	config := &bootstrap.Config{
+		Region:          "us-west-2",
+		ECRRepositories: []bootstrap.ECRRepository{{Name: "api"}, {Name: "worker"}, {Name: "missing"}},
+	}
+
+	plan, err := bootstrapper.Plan(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	actions := make(map[string]bootstrap.PlanAction)
+	for _, p := range plan.Resources {
+		actions[p.Name] = p.Action
+	}
+	if actions["api"] != bootstrap.PlanNoOp || actions["worker"] != bootstrap.PlanNoOp || actions["missing"] != bootstrap.PlanCreate {
+		t.Errorf("Expected only the missing repository to be created, got %v", actions)
+	}
+
+	if err := bootstrapper.DeleteECRRepositories(context.Background(), config.ECRRepositories); err != nil {
+		t.Fatalf("Failed to delete repositories: %v", err)
+	}
+	mockECRClient.AssertNumberOfCalls(t, "DeleteRepository", 2)
+	mockECRClient.AssertNotCalled(t, "DeleteRepository", mock.Anything, &ecr.DeleteRepositoryInput{RepositoryName: aws.String("missing"), Force: true})
+}
+
+// TestECRExistenceCheck tests that only RepositoryNotFoundException means the repository is
+// missing; AccessDenied or throttling stops provisioning instead of attempting a create
+func TestECRExistenceCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		describeErr error
+		wantCreated bool
+	}{
+		{name: "not found", describeErr: &ecrtypes.RepositoryNotFoundException{Message: aws.String("repository not found")}, wantCreated: true},
+		{name: "access denied", describeErr: &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized to perform ecr:DescribeRepositories"}},
+		{name: "throttled", describeErr: &smithy.GenericAPIError{Code: "ThrottlingException", Message: "rate exceeded"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockECRClient := new(MockECRClient)
+			mockECRClient.On("DescribeRepositories", mock.Anything, mock.Anything).Return((*ecr.DescribeRepositoriesOutput)(nil), tt.describeErr)
+			mockECRClient.On("CreateRepository", mock.Anything, mock.Anything).Return(&ecr.CreateRepositoryOutput{
+				Repository: &ecrtypes.Repository{RepositoryArn: aws.String("arn:aws:ecr:us-west-2:123456789012:repository/api")},
+			}, nil)
+
+			bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{ECR: mockECRClient})
+			results, err := bootstrapper.CreateECRRepositories(context.Background(), []bootstrap.ECRRepository{{Name: "api"}})
+
+			if tt.wantCreated {
+				if err != nil {
+					t.Fatalf("Failed to create repository: %v", err)
+				}
+				if results[0].Action != bootstrap.ActionCreated {
+					t.Errorf("Expected repository to be created, got %s", results[0].Action)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "failed to describe ECR repository api") {
+				t.Fatalf("Expected the describe error to stop provisioning, got %v", err)
+			}
+			mockECRClient.AssertNotCalled(t, "CreateRepository", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+// TestPlanECRImageSettings tests that image tag mutability and scan-on-push drift is planned
+// as an update, since provisioning applies both
+func TestPlanECRImageSettings(t *testing.T) {
+	mockECRClient := new(MockECRClient)
+	mockECRClient.On("DescribeRepositories", mock.Anything, mock.Anything).Return(&ecr.DescribeRepositoriesOutput{
+		Repositories: []ecrtypes.Repository{{
+			RepositoryName:             aws.String("api"),
+			ImageTagMutability:         ecrtypes.ImageTagMutabilityMutable,
+			ImageScanningConfiguration: &ecrtypes.ImageScanningConfiguration{ScanOnPush: false},
+		}},
+	}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{ECR: mockECRClient})
+	plan, err := bootstrapper.Plan(context.Background(), &bootstrap.Config{
+		Region:          "us-west-2",
+		ECRRepositories: []bootstrap.ECRRepository{{Name: "api", ImageTagMutability: "IMMUTABLE", ScanOnPush: aws.Bool(true)}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if len(plan.Resources) != 1 || plan.Resources[0].Action != bootstrap.PlanUpdate || len(plan.Resources[0].Changes) != 2 {
+		t.Errorf("Expected an update for both image settings, got %+v", plan.Resources)
+	}
+	if len(plan.Drifted()) != 1 {
+		t.Errorf("Expected the repository to count as drift, got %+v", plan.Drifted())
+	}
+}
@@ -0,0 +1,179 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
+)
+
+// MockEventBridgeClient is a mock implementation of the EventBridge client
+type MockEventBridgeClient struct {
+	mock.Mock
+}
+
+func (m *MockEventBridgeClient) DescribeRule(ctx context.Context, params *eventbridge.DescribeRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DescribeRuleOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*eventbridge.DescribeRuleOutput), args.Error(1)
+}
+
+func (m *MockEventBridgeClient) PutRule(ctx context.Context, params *eventbridge.PutRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutRuleOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*eventbridge.PutRuleOutput), args.Error(1)
+}
+
+func (m *MockEventBridgeClient) ListTargetsByRule(ctx context.Context, params *eventbridge.ListTargetsByRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListTargetsByRuleOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*eventbridge.ListTargetsByRuleOutput), args.Error(1)
+}
+
+func (m *MockEventBridgeClient) PutTargets(ctx context.Context, params *eventbridge.PutTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutTargetsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*eventbridge.PutTargetsOutput), args.Error(1)
+}
+
+func (m *MockEventBridgeClient) RemoveTargets(ctx context.Context, params *eventbridge.RemoveTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.RemoveTargetsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*eventbridge.RemoveTargetsOutput), args.Error(1)
+}
+
+func (m *MockEventBridgeClient) TagResource(ctx context.Context, params *eventbridge.TagResourceInput, optFns ...func(*eventbridge.Options)) (*eventbridge.TagResourceOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*eventbridge.TagResourceOutput), args.Error(1)
+}
+
+const testRuleARN = "arn:aws:events:us-west-2:123456789012:rule/nightly"
+
+// TestCreateEventBridgeRuleWithLambdaTarget tests that a new rule targeting a function in the
+// config is created, sends events to the function's ARN and is allowed to invoke it
+func TestCreateEventBridgeRuleWithLambdaTarget(t *testing.T) {
+	mockEventsClient := new(MockEventBridgeClient)
+	mockLambdaClient := new(MockLambdaClient)
+
+	mockLambdaClient.On("GetFunction", mock.Anything, mock.Anything).Return(&lambda.GetFunctionOutput{
+		Configuration: &lambdatypes.FunctionConfiguration{FunctionArn: aws.String("arn:aws:lambda:us-west-2:123456789012:function:report")},
+	}, nil)
+	mockEventsClient.On("DescribeRule", mock.Anything, mock.Anything).Return((*eventbridge.DescribeRuleOutput)(nil), &ebtypes.ResourceNotFoundException{})
+	mockEventsClient.On("PutRule", mock.Anything, mock.MatchedBy(func(input *eventbridge.PutRuleInput) bool {
+		return aws.ToString(input.ScheduleExpression) == "rate(1 day)" && input.State == ebtypes.RuleStateEnabled
+	})).Return(&eventbridge.PutRuleOutput{RuleArn: aws.String(testRuleARN)}, nil)
+	mockLambdaClient.On("AddPermission", mock.Anything, mock.MatchedBy(func(input *lambda.AddPermissionInput) bool {
+		return aws.ToString(input.Principal) == "events.amazonaws.com" && aws.ToString(input.SourceArn) == testRuleARN
+	})).Return(&lambda.AddPermissionOutput{}, nil).Once()
+	mockEventsClient.On("ListTargetsByRule", mock.Anything, mock.Anything).Return(&eventbridge.ListTargetsByRuleOutput{}, nil)
+	mockEventsClient.On("PutTargets", mock.Anything, mock.MatchedBy(func(input *eventbridge.PutTargetsInput) bool {
+		return len(input.Targets) == 1 && aws.ToString(input.Targets[0].Id) == "report" &&
+			aws.ToString(input.Targets[0].Arn) == "arn:aws:lambda:us-west-2:123456789012:function:report"
+	})).Return(&eventbridge.PutTargetsOutput{}, nil).Once()
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{EventBridge: mockEventsClient, Lambda: mockLambdaClient})
+	results, err := bootstrapper.CreateEventBridgeRules(context.Background(), []bootstrap.EventBridgeRule{{
+		Name:               "nightly",
+		ScheduleExpression: "rate(1 day)",
+		Targets:            []bootstrap.EventBridgeTarget{{LambdaFunction: "report"}},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create EventBridge rule: %v", err)
+	}
+	if results[0].Action != bootstrap.ActionCreated || results[0].ARN != testRuleARN {
+		t.Errorf("Expected rule to be created, got %+v", results[0])
+	}
+
+	mockEventsClient.AssertExpectations(t)
+	mockLambdaClient.AssertExpectations(t)
+}
+
+// TestCreateEventBridgeRuleReconcilesTargets tests that an unchanged rule is left alone, a
+// changed target is put again and a target that is not configured is removed
+func TestCreateEventBridgeRuleReconcilesTargets(t *testing.T) {
+	mockEventsClient := new(MockEventBridgeClient)
+	queue := "arn:aws:sqs:us-west-2:123456789012:jobs"
+
+	mockEventsClient.On("DescribeRule", mock.Anything, mock.Anything).Return(&eventbridge.DescribeRuleOutput{
+		Arn:          aws.String(testRuleARN),
+		EventPattern: aws.String(`{"source": ["aws.s3"]}`),
+		State:        ebtypes.RuleStateEnabled,
+	}, nil)
+	mockEventsClient.On("ListTargetsByRule", mock.Anything, mock.Anything).Return(&eventbridge.ListTargetsByRuleOutput{
+		Targets: []ebtypes.Target{
+			{Id: aws.String("jobs"), Arn: aws.String(queue), Input: aws.String(`{"kind":"old"}`)},
+			{Id: aws.String("retired"), Arn: aws.String("arn:aws:sqs:us-west-2:123456789012:retired")},
+		},
+	}, nil)
+	mockEventsClient.On("PutTargets", mock.Anything, mock.MatchedBy(func(input *eventbridge.PutTargetsInput) bool {
+		return len(input.Targets) == 1 && aws.ToString(input.Targets[0].Input) == `{"kind":"new"}`
+	})).Return(&eventbridge.PutTargetsOutput{}, nil).Once()
+	mockEventsClient.On("RemoveTargets", mock.Anything, mock.MatchedBy(func(input *eventbridge.RemoveTargetsInput) bool {
+		return len(input.Ids) == 1 && input.Ids[0] == "retired"
+	})).Return(&eventbridge.RemoveTargetsOutput{}, nil).Once()
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{EventBridge: mockEventsClient})
+	results, err := bootstrapper.CreateEventBridgeRules(context.Background(), []bootstrap.EventBridgeRule{{
+		Name:         "nightly",
+		EventPattern: `{"source":["aws.s3"]}`,
+		Targets:      []bootstrap.EventBridgeTarget{{Queue: queue, Input: `{"kind":"new"}`}},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to reconcile EventBridge rule: %v", err)
+	}
+	if results[0].Action != bootstrap.ActionUpdated {
+		t.Errorf("Expected rule to be updated, got %+v", results[0])
+	}
+
+	mockEventsClient.AssertNotCalled(t, "PutRule", mock.Anything, mock.Anything)
+	mockEventsClient.AssertExpectations(t)
+}
+
+// TestRollbackLeavesUndeletableTypes tests that a created Lambda function, which rollback
+// cannot delete, is reported with a warning instead of as rolled back
+func TestRollbackLeavesUndeletableTypes(t *testing.T) {
+	const functionARN = "arn:aws:lambda:us-west-2:123456789012:function:report"
+	mockLambdaClient := new(MockLambdaClient)
+	mockLambdaClient.On("GetFunction", mock.Anything, mock.Anything).Return((*lambda.GetFunctionOutput)(nil), &lambdatypes.ResourceNotFoundException{}).Once()
+	mockLambdaClient.On("CreateFunction", mock.Anything, mock.Anything).Return(&lambda.CreateFunctionOutput{FunctionArn: aws.String(functionARN)}, nil)
+	mockLambdaClient.On("GetFunction", mock.Anything, mock.Anything).Return(&lambda.GetFunctionOutput{
+		Configuration: &lambdatypes.FunctionConfiguration{FunctionArn: aws.String(functionARN)},
+	}, nil)
+
+	// The rule that targets the new function fails, which ends the run
+	mockEventsClient := new(MockEventBridgeClient)
+	mockEventsClient.On("DescribeRule", mock.Anything, mock.Anything).Return((*eventbridge.DescribeRuleOutput)(nil), errors.New("throttled"))
+
+	config := &bootstrap.Config{
+		Region: "us-west-2",
+		LambdaFunctions: []bootstrap.LambdaFunction{
+			{Name: "report", Role: "arn:aws:iam::123456789012:role/report", ImageURI: "public.ecr.aws/example/report:v1"},
+		},
+		EventBridgeRules: []bootstrap.EventBridgeRule{
+			{Name: "nightly", ScheduleExpression: "rate(1 day)", Targets: []bootstrap.EventBridgeTarget{{LambdaFunction: "report"}}},
+		},
+	}
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{EventBridge: mockEventsClient, Lambda: mockLambdaClient})
+	result, err := bootstrapper.ProvisionResources(context.Background(), config)
+	if err == nil {
+		t.Fatal("Expected provisioning to fail")
+	}
+
+	rolledBack, err := bootstrapper.Rollback(context.Background(), result, config)
+	if err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if !rolledBack.Empty() {
+		t.Errorf("Expected nothing to be rolled back, got %+v", rolledBack)
+	}
+	function := result.Resources[0]
+	if function.Type != bootstrap.ResourceTypeLambda || function.Action != bootstrap.ActionCreated {
+		t.Fatalf("Expected the function to stay created, got %+v", function)
+	}
+	if len(function.Warnings) != 1 || !strings.Contains(function.Warnings[0].Message, "cannot be rolled back") {
+		t.Errorf("Expected a warning that the function was left in place, got %+v", function.Warnings)
+	}
+}
@@ -0,0 +1,822 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
+)
+
+// MockIAMClient is a mock implementation of the IAM client
+type MockIAMClient struct {
+	mock.Mock
+}
+
+func (m *MockIAMClient) GetUser(ctx context.Context, params *iam.GetUserInput, optFns ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.GetUserOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) CreateUser(ctx context.Context, params *iam.CreateUserInput, optFns ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.CreateUserOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) DeleteUser(ctx context.Context, params *iam.DeleteUserInput, optFns ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.DeleteUserOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) UntagUser(ctx context.Context, params *iam.UntagUserInput, optFns ...func(*iam.Options)) (*iam.UntagUserOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.UntagUserOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) ListPolicyTags(ctx context.Context, params *iam.ListPolicyTagsInput, optFns ...func(*iam.Options)) (*iam.ListPolicyTagsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.ListPolicyTagsOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) TagPolicy(ctx context.Context, params *iam.TagPolicyInput, optFns ...func(*iam.Options)) (*iam.TagPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.TagPolicyOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) UntagPolicy(ctx context.Context, params *iam.UntagPolicyInput, optFns ...func(*iam.Options)) (*iam.UntagPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.UntagPolicyOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) TagUser(ctx context.Context, params *iam.TagUserInput, optFns ...func(*iam.Options)) (*iam.TagUserOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.TagUserOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) ListPolicies(ctx context.Context, params *iam.ListPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListPoliciesOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.ListPoliciesOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) CreatePolicy(ctx context.Context, params *iam.CreatePolicyInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.CreatePolicyOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) DeletePolicy(ctx context.Context, params *iam.DeletePolicyInput, optFns ...func(*iam.Options)) (*iam.DeletePolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.DeletePolicyOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) CreatePolicyVersion(ctx context.Context, params *iam.CreatePolicyVersionInput, optFns ...func(*iam.Options)) (*iam.CreatePolicyVersionOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.CreatePolicyVersionOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.GetPolicyVersionOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) ListPolicyVersions(ctx context.Context, params *iam.ListPolicyVersionsInput, optFns ...func(*iam.Options)) (*iam.ListPolicyVersionsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.ListPolicyVersionsOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) DeletePolicyVersion(ctx context.Context, params *iam.DeletePolicyVersionInput, optFns ...func(*iam.Options)) (*iam.DeletePolicyVersionOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.DeletePolicyVersionOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) AttachUserPolicy(ctx context.Context, params *iam.AttachUserPolicyInput, optFns ...func(*iam.Options)) (*iam.AttachUserPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.AttachUserPolicyOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) DetachUserPolicy(ctx context.Context, params *iam.DetachUserPolicyInput, optFns ...func(*iam.Options)) (*iam.DetachUserPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.DetachUserPolicyOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) ListAttachedUserPolicies(ctx context.Context, params *iam.ListAttachedUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.ListAttachedUserPoliciesOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) GetGroup(ctx context.Context, params *iam.GetGroupInput, optFns ...func(*iam.Options)) (*iam.GetGroupOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.GetGroupOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) CreateGroup(ctx context.Context, params *iam.CreateGroupInput, optFns ...func(*iam.Options)) (*iam.CreateGroupOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.CreateGroupOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) DeleteGroup(ctx context.Context, params *iam.DeleteGroupInput, optFns ...func(*iam.Options)) (*iam.DeleteGroupOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.DeleteGroupOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) AttachGroupPolicy(ctx context.Context, params *iam.AttachGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.AttachGroupPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.AttachGroupPolicyOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) DetachGroupPolicy(ctx context.Context, params *iam.DetachGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.DetachGroupPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.DetachGroupPolicyOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) ListAttachedGroupPolicies(ctx context.Context, params *iam.ListAttachedGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedGroupPoliciesOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.ListAttachedGroupPoliciesOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) ListGroupsForUser(ctx context.Context, params *iam.ListGroupsForUserInput, optFns ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.ListGroupsForUserOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) AddUserToGroup(ctx context.Context, params *iam.AddUserToGroupInput, optFns ...func(*iam.Options)) (*iam.AddUserToGroupOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.AddUserToGroupOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) RemoveUserFromGroup(ctx context.Context, params *iam.RemoveUserFromGroupInput, optFns ...func(*iam.Options)) (*iam.RemoveUserFromGroupOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.RemoveUserFromGroupOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) PutUserPolicy(ctx context.Context, params *iam.PutUserPolicyInput, optFns ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.PutUserPolicyOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) DeleteUserPolicy(ctx context.Context, params *iam.DeleteUserPolicyInput, optFns ...func(*iam.Options)) (*iam.DeleteUserPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.DeleteUserPolicyOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) ListUserPolicies(ctx context.Context, params *iam.ListUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.ListUserPoliciesOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) PutUserPermissionsBoundary(ctx context.Context, params *iam.PutUserPermissionsBoundaryInput, optFns ...func(*iam.Options)) (*iam.PutUserPermissionsBoundaryOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.PutUserPermissionsBoundaryOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) DeleteUserPermissionsBoundary(ctx context.Context, params *iam.DeleteUserPermissionsBoundaryInput, optFns ...func(*iam.Options)) (*iam.DeleteUserPermissionsBoundaryOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.DeleteUserPermissionsBoundaryOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) GetLoginProfile(ctx context.Context, params *iam.GetLoginProfileInput, optFns ...func(*iam.Options)) (*iam.GetLoginProfileOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.GetLoginProfileOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) CreateLoginProfile(ctx context.Context, params *iam.CreateLoginProfileInput, optFns ...func(*iam.Options)) (*iam.CreateLoginProfileOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.CreateLoginProfileOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) UpdateLoginProfile(ctx context.Context, params *iam.UpdateLoginProfileInput, optFns ...func(*iam.Options)) (*iam.UpdateLoginProfileOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.UpdateLoginProfileOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) DeleteLoginProfile(ctx context.Context, params *iam.DeleteLoginProfileInput, optFns ...func(*iam.Options)) (*iam.DeleteLoginProfileOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.DeleteLoginProfileOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) GetAccountPasswordPolicy(ctx context.Context, params *iam.GetAccountPasswordPolicyInput, optFns ...func(*iam.Options)) (*iam.GetAccountPasswordPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.GetAccountPasswordPolicyOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) UpdateAccountPasswordPolicy(ctx context.Context, params *iam.UpdateAccountPasswordPolicyInput, optFns ...func(*iam.Options)) (*iam.UpdateAccountPasswordPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.UpdateAccountPasswordPolicyOutput), args.Error(1)
+}
+
+func (m *MockIAMClient) SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*iam.SimulatePrincipalPolicyOutput), args.Error(1)
+}
+
+// TestIAMPolicyVersionCleanup tests that the oldest non-default policy version is deleted
+// before a new version is created when the policy already has five versions
+func TestIAMPolicyVersionCleanup(t *testing.T) {
+	mockIAMClient := new(MockIAMClient)
+	policyArn := "arn:aws:iam::123456789012:policy/test-user-s3-access"
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Five versions exist; v5 is the default and v2 is the oldest non-default version
+	versions := []types.PolicyVersion{
+		{VersionId: aws.String("v5"), IsDefaultVersion: true, CreateDate: aws.Time(created.AddDate(0, 0, 5))},
+		{VersionId: aws.String("v4"), CreateDate: aws.Time(created.AddDate(0, 0, 4))},
+		{VersionId: aws.String("v2"), CreateDate: aws.Time(created.AddDate(0, 0, 1))},
+		{VersionId: aws.String("v3"), CreateDate: aws.Time(created.AddDate(0, 0, 3))},
+		{VersionId: aws.String("v6"), CreateDate: aws.Time(created.AddDate(0, 0, 6))},
+	}
+
+	mockIAMClient.On("GetUser", mock.Anything, mock.Anything).Return(&iam.GetUserOutput{}, nil)
+	mockIAMClient.On("GetLoginProfile", mock.Anything, mock.Anything).Return((*iam.GetLoginProfileOutput)(nil), &types.NoSuchEntityException{})
+	mockIAMClient.On("ListPolicies", mock.Anything, mock.Anything).Return(&iam.ListPoliciesOutput{
+		Policies: []types.Policy{{PolicyName: aws.String("test-user-s3-access"), Arn: aws.String(policyArn)}},
+	}, nil)
+	mockIAMClient.On("GetPolicyVersion", mock.Anything, mock.Anything).Return(&iam.GetPolicyVersionOutput{
+		PolicyVersion: &types.PolicyVersion{Document: aws.String(`{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"*","Resource":"*"}]}`)},
+	}, nil)
+	mockIAMClient.On("ListPolicyVersions", mock.Anything, mock.Anything).Return(&iam.ListPolicyVersionsOutput{Versions: versions}, nil)
+	deleteCall := mockIAMClient.On("DeletePolicyVersion", mock.Anything, mock.MatchedBy(func(input *iam.DeletePolicyVersionInput) bool {
+		return aws.ToString(input.PolicyArn) == policyArn && aws.ToString(input.VersionId) == "v2"
+	})).Return(&iam.DeletePolicyVersionOutput{}, nil).Once()
+	mockIAMClient.On("CreatePolicyVersion", mock.Anything, mock.Anything).
+		Return(&iam.CreatePolicyVersionOutput{}, nil).Once().NotBefore(deleteCall)
+	mockIAMClient.On("AttachUserPolicy", mock.Anything, mock.Anything).Return(&iam.AttachUserPolicyOutput{}, nil)
+	mockIAMClient.On("ListUserPolicies", mock.Anything, mock.Anything).Return(&iam.ListUserPoliciesOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+	_, err := bootstrapper.CreateIAMUsersAndPolicies(context.Background(), []bootstrap.IAMUser{
+		{
+			Name: "test-user",
+			Policies: []bootstrap.IAMPolicy{
+				{Name: "s3-access", PolicyDocument: `{"Version":"2012-10-17","Statement":[]}`},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update IAM policy: %v", err)
+	}
+
+	// Verify expectations
+	mockIAMClient.AssertExpectations(t)
+	mockIAMClient.AssertNumberOfCalls(t, "DeletePolicyVersion", 1)
+}
+
+// TestIAMUserPruneTags tests that -prune-tags removes only the tags missing from the configuration
+func TestIAMUserPruneTags(t *testing.T) {
+	mockIAMClient := new(MockIAMClient)
+
+	mockIAMClient.On("GetUser", mock.Anything, mock.Anything).Return(&iam.GetUserOutput{
+		User: &types.User{
+			UserName: aws.String("test-user"),
+			Tags: []types.Tag{
+				{Key: aws.String("Team"), Value: aws.String("platform")},
+				{Key: aws.String("Owner"), Value: aws.String("someone")},
+			},
+		},
+	}, nil)
+	mockIAMClient.On("TagUser", mock.Anything, mock.Anything).Return(&iam.TagUserOutput{}, nil)
+	mockIAMClient.On("GetLoginProfile", mock.Anything, mock.Anything).Return((*iam.GetLoginProfileOutput)(nil), &types.NoSuchEntityException{})
+	mockIAMClient.On("UntagUser", mock.Anything, mock.MatchedBy(func(input *iam.UntagUserInput) bool {
+		return aws.ToString(input.UserName) == "test-user" && reflect.DeepEqual(input.TagKeys, []string{"Owner"})
+	})).Return(&iam.UntagUserOutput{}, nil).Once()
+	mockIAMClient.On("ListUserPolicies", mock.Anything, mock.Anything).Return(&iam.ListUserPoliciesOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+	bootstrapper.SetPruneTags(true)
+	_, err := bootstrapper.CreateIAMUsersAndPolicies(context.Background(), []bootstrap.IAMUser{
+		{Name: "test-user", Tags: map[string]string{"Team": "platform"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to reconcile IAM user: %v", err)
+	}
+
+	mockIAMClient.AssertExpectations(t)
+}
+
+// TestIAMAttachRetriesWhileUserPropagates tests that attaching a policy is retried while IAM
+// does not see the new user yet
+func TestIAMAttachRetriesWhileUserPropagates(t *testing.T) {
+	mockIAMClient := new(MockIAMClient)
+	policyArn := "arn:aws:iam::123456789012:policy/new-user-s3-access"
+
+	mockIAMClient.On("GetUser", mock.Anything, mock.Anything).Return((*iam.GetUserOutput)(nil), &types.NoSuchEntityException{Message: aws.String("user not found")})
+	mockIAMClient.On("CreateUser", mock.Anything, mock.Anything).Return(&iam.CreateUserOutput{}, nil)
+	mockIAMClient.On("ListPolicies", mock.Anything, mock.Anything).Return(&iam.ListPoliciesOutput{}, nil)
+	mockIAMClient.On("CreatePolicy", mock.Anything, mock.Anything).Return(&iam.CreatePolicyOutput{
+		Policy: &types.Policy{Arn: aws.String(policyArn)},
+	}, nil)
+	mockIAMClient.On("AttachUserPolicy", mock.Anything, mock.Anything).
+		Return((*iam.AttachUserPolicyOutput)(nil), &types.NoSuchEntityException{Message: aws.String("The user with name new-user cannot be found")}).Twice()
+	mockIAMClient.On("AttachUserPolicy", mock.Anything, mock.Anything).Return(&iam.AttachUserPolicyOutput{}, nil).Once()
+	mockIAMClient.On("ListUserPolicies", mock.Anything, mock.Anything).Return(&iam.ListUserPoliciesOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+	bootstrapper.SetIAMRetry(3, time.Millisecond)
+	results, err := bootstrapper.CreateIAMUsersAndPolicies(context.Background(), []bootstrap.IAMUser{
+		{
+			Name: "new-user",
+			Policies: []bootstrap.IAMPolicy{
+				{Name: "s3-access", PolicyDocument: `{"Version":"2012-10-17","Statement":[]}`},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create IAM user: %v", err)
+	}
+	if len(results) != 1 || len(results[0].Warnings) != 0 {
+		t.Errorf("Expected the attach to succeed without warnings, got %+v", results)
+	}
+
+	mockIAMClient.AssertNumberOfCalls(t, "AttachUserPolicy", 3)
+}
+
+// TestIAMGetUserErrorIsNotMissing tests that an error other than NoSuchEntity from GetUser
+// fails the user instead of trying to create it again
+func TestIAMGetUserErrorIsNotMissing(t *testing.T) {
+	mockIAMClient := new(MockIAMClient)
+	mockIAMClient.On("GetUser", mock.Anything, mock.Anything).Return((*iam.GetUserOutput)(nil), errors.New("AccessDenied: not authorized to perform iam:GetUser"))
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+	users := []bootstrap.IAMUser{{Name: "alice"}}
+	if _, err := bootstrapper.CreateIAMUsersAndPolicies(context.Background(), users); err == nil || !strings.Contains(err.Error(), "failed to get IAM user alice") {
+		t.Errorf("Expected the GetUser error to be returned, got %v", err)
+	}
+	mockIAMClient.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+
+	if _, err := bootstrapper.Plan(context.Background(), &bootstrap.Config{Region: "us-west-2", IAMUsers: users}); err == nil || !strings.Contains(err.Error(), "failed to get IAM user alice") {
+		t.Errorf("Expected the plan to fail on the GetUser error, got %v", err)
+	}
+}
+
+// TestIAMUserConsoleAccess tests that a generated console password is written only to the
+// credentials file, and that an existing login profile is updated or removed to match
+func TestIAMUserConsoleAccess(t *testing.T) {
+	t.Run("generated password for new user", func(t *testing.T) {
+		mockIAMClient := new(MockIAMClient)
+		mockIAMClient.On("GetUser", mock.Anything, mock.Anything).Return((*iam.GetUserOutput)(nil), &types.NoSuchEntityException{})
+		mockIAMClient.On("CreateUser", mock.Anything, mock.Anything).Return(&iam.CreateUserOutput{}, nil)
+		mockIAMClient.On("GetAccountPasswordPolicy", mock.Anything, mock.Anything).Return(&iam.GetAccountPasswordPolicyOutput{
+			PasswordPolicy: &types.PasswordPolicy{MinimumPasswordLength: aws.Int32(40)},
+		}, nil)
+		var password string
+		mockIAMClient.On("CreateLoginProfile", mock.Anything, mock.MatchedBy(func(input *iam.CreateLoginProfileInput) bool {
+			password = aws.ToString(input.Password)
+			return aws.ToString(input.UserName) == "console-user" && input.PasswordResetRequired
+		})).Return(&iam.CreateLoginProfileOutput{}, nil).Once()
+		mockIAMClient.On("ListUserPolicies", mock.Anything, mock.Anything).Return(&iam.ListUserPoliciesOutput{}, nil)
+
+		path := filepath.Join(t.TempDir(), "credentials.json")
+		bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+		bootstrapper.SetCredentialsOut(path)
+		_, err := bootstrapper.CreateIAMUsersAndPolicies(context.Background(), []bootstrap.IAMUser{
+			{Name: "console-user", ConsoleAccess: &bootstrap.IAMConsoleAccess{PasswordResetRequired: true}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create IAM user: %v", err)
+		}
+		mockIAMClient.AssertExpectations(t)
+		if len(password) != 40 {
+			t.Errorf("Expected a 40 character password to meet the policy, got %d characters", len(password))
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat credentials file: %v", err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("Expected credentials file mode 0600, got %v", info.Mode().Perm())
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read credentials file: %v", err)
+		}
+		var credentials []bootstrap.Credential
+		if err := json.Unmarshal(data, &credentials); err != nil {
+			t.Fatalf("Failed to parse credentials file: %v", err)
+		}
+		expected := []bootstrap.Credential{{Type: bootstrap.ResourceTypeIAM, Name: "console-user", Password: password}}
+		if !reflect.DeepEqual(credentials, expected) {
+			t.Errorf("Expected credentials %v, got %v", expected, credentials)
+		}
+	})
+
+	t.Run("generated password without credentials file", func(t *testing.T) {
+		mockIAMClient := new(MockIAMClient)
+		mockIAMClient.On("GetUser", mock.Anything, mock.Anything).Return(&iam.GetUserOutput{}, nil)
+		mockIAMClient.On("GetLoginProfile", mock.Anything, mock.Anything).Return((*iam.GetLoginProfileOutput)(nil), &types.NoSuchEntityException{})
+		mockIAMClient.On("GetAccountPasswordPolicy", mock.Anything, mock.Anything).Return((*iam.GetAccountPasswordPolicyOutput)(nil), &types.NoSuchEntityException{})
+
+		bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+		_, err := bootstrapper.CreateIAMUsersAndPolicies(context.Background(), []bootstrap.IAMUser{
+			{Name: "console-user", ConsoleAccess: &bootstrap.IAMConsoleAccess{}},
+		})
+		if err == nil || !strings.Contains(err.Error(), "-credentials-out") {
+			t.Fatalf("Expected an error asking for -credentials-out, got %v", err)
+		}
+		mockIAMClient.AssertNotCalled(t, "CreateLoginProfile", mock.Anything, mock.Anything)
+	})
+
+	t.Run("reset flag updated", func(t *testing.T) {
+		mockIAMClient := new(MockIAMClient)
+		mockIAMClient.On("GetUser", mock.Anything, mock.Anything).Return(&iam.GetUserOutput{}, nil)
+		mockIAMClient.On("GetLoginProfile", mock.Anything, mock.Anything).Return(&iam.GetLoginProfileOutput{
+			LoginProfile: &types.LoginProfile{UserName: aws.String("console-user"), PasswordResetRequired: true},
+		}, nil)
+		mockIAMClient.On("UpdateLoginProfile", mock.Anything, mock.MatchedBy(func(input *iam.UpdateLoginProfileInput) bool {
+			return input.Password == nil && input.PasswordResetRequired != nil && !*input.PasswordResetRequired
+		})).Return(&iam.UpdateLoginProfileOutput{}, nil).Once()
+		mockIAMClient.On("ListUserPolicies", mock.Anything, mock.Anything).Return(&iam.ListUserPoliciesOutput{}, nil)
+
+		bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+		results, err := bootstrapper.CreateIAMUsersAndPolicies(context.Background(), []bootstrap.IAMUser{
+			{Name: "console-user", ConsoleAccess: &bootstrap.IAMConsoleAccess{Password: "Initial-Passw0rd!"}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to reconcile IAM user: %v", err)
+		}
+		mockIAMClient.AssertExpectations(t)
+		if results[0].Action != bootstrap.ActionUpdated {
+			t.Errorf("Expected the user to be updated, got %s", results[0].Action)
+		}
+	})
+
+	t.Run("section removed", func(t *testing.T) {
+		mockIAMClient := new(MockIAMClient)
+		mockIAMClient.On("GetUser", mock.Anything, mock.Anything).Return(&iam.GetUserOutput{}, nil)
+		mockIAMClient.On("GetLoginProfile", mock.Anything, mock.Anything).Return(&iam.GetLoginProfileOutput{
+			LoginProfile: &types.LoginProfile{UserName: aws.String("console-user")},
+		}, nil)
+		mockIAMClient.On("DeleteLoginProfile", mock.Anything, mock.Anything).Return(&iam.DeleteLoginProfileOutput{}, nil).Once()
+		mockIAMClient.On("ListUserPolicies", mock.Anything, mock.Anything).Return(&iam.ListUserPoliciesOutput{}, nil)
+
+		bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+		_, err := bootstrapper.CreateIAMUsersAndPolicies(context.Background(), []bootstrap.IAMUser{{Name: "console-user"}})
+		if err != nil {
+			t.Fatalf("Failed to reconcile IAM user: %v", err)
+		}
+		mockIAMClient.AssertExpectations(t)
+	})
+}
+
+// TestPasswordPolicy tests that the account password policy is only written when it differs
+// from the configuration, and that the plan lists the settings that differ
+func TestPasswordPolicy(t *testing.T) {
+	policy := bootstrap.PasswordPolicy{MinimumLength: 14, RequireSymbols: true, MaxAgeDays: 90, ReusePrevention: 5}
+	matching := &types.PasswordPolicy{
+		MinimumPasswordLength:      aws.Int32(14),
+		RequireSymbols:             true,
+		AllowUsersToChangePassword: true,
+		ExpirePasswords:            true,
+		MaxPasswordAge:             aws.Int32(90),
+		PasswordReusePrevention:    aws.Int32(5),
+		HardExpiry:                 aws.Bool(false),
+	}
+	outdated := *matching
+	outdated.MinimumPasswordLength = aws.Int32(8)
+	outdated.PasswordReusePrevention = nil
+
+	tests := []struct {
+		name        string
+		current     *types.PasswordPolicy
+		wantAction  bootstrap.ResourceAction
+		wantChanges []string
+	}{
+		{name: "missing", wantAction: bootstrap.ActionCreated},
+		{name: "matching", current: matching, wantAction: bootstrap.ActionUnchanged},
+		{name: "outdated", current: &outdated, wantAction: bootstrap.ActionUpdated,
+			wantChanges: []string{"minimum_length: 8 -> 14", "reuse_prevention: 0 -> 5"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockIAMClient := new(MockIAMClient)
+			if tt.current == nil {
+				mockIAMClient.On("GetAccountPasswordPolicy", mock.Anything, mock.Anything).Return((*iam.GetAccountPasswordPolicyOutput)(nil), &types.NoSuchEntityException{})
+			} else {
+				mockIAMClient.On("GetAccountPasswordPolicy", mock.Anything, mock.Anything).Return(&iam.GetAccountPasswordPolicyOutput{PasswordPolicy: tt.current}, nil)
+			}
+			mockIAMClient.On("UpdateAccountPasswordPolicy", mock.Anything, mock.MatchedBy(func(input *iam.UpdateAccountPasswordPolicyInput) bool {
+				return aws.ToInt32(input.MinimumPasswordLength) == 14 && input.RequireSymbols && input.AllowUsersToChangePassword &&
+					aws.ToInt32(input.MaxPasswordAge) == 90 && aws.ToInt32(input.PasswordReusePrevention) == 5
+			})).Return(&iam.UpdateAccountPasswordPolicyOutput{}, nil)
+
+			bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+			res, err := bootstrapper.ApplyPasswordPolicy(context.Background(), policy)
+			if err != nil {
+				t.Fatalf("Failed to apply password policy: %v", err)
+			}
+			if res.Action != tt.wantAction {
+				t.Errorf("Expected action %s, got %s", tt.wantAction, res.Action)
+			}
+			if tt.wantAction == bootstrap.ActionUnchanged {
+				mockIAMClient.AssertNotCalled(t, "UpdateAccountPasswordPolicy", mock.Anything, mock.Anything)
+			} else {
+				mockIAMClient.AssertNumberOfCalls(t, "UpdateAccountPasswordPolicy", 1)
+			}
+
+			plan, err := bootstrapper.Plan(context.Background(), &bootstrap.Config{Region: "us-west-2", PasswordPolicy: &policy})
+			if err != nil {
+				t.Fatalf("Failed to plan: %v", err)
+			}
+			if len(plan.Resources) != 1 || !reflect.DeepEqual(plan.Resources[0].Changes, tt.wantChanges) {
+				t.Errorf("Expected plan changes %v, got %+v", tt.wantChanges, plan.Resources)
+			}
+		})
+	}
+}
+
+// TestIAMGroupExistenceCheck tests that only the typed NoSuchEntity error means the group
+// is missing; any other error, even one mentioning the code, stops provisioning
+func TestIAMGroupExistenceCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		getErr      error
+		wantCreated bool
+	}{
+		{name: "typed not found", getErr: &types.NoSuchEntityException{Message: aws.String("group not found")}, wantCreated: true},
+		{name: "untyped error", getErr: errors.New("NoSuchEntity mentioned in an unrelated failure")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockIAMClient := new(MockIAMClient)
+			mockIAMClient.On("GetGroup", mock.Anything, mock.Anything).Return((*iam.GetGroupOutput)(nil), tt.getErr)
+			mockIAMClient.On("CreateGroup", mock.Anything, mock.Anything).Return(&iam.CreateGroupOutput{
+				Group: &types.Group{Arn: aws.String("arn:aws:iam::123456789012:group/developers")},
+			}, nil)
+
+			bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+			results, err := bootstrapper.CreateIAMGroups(context.Background(), []bootstrap.IAMGroup{{Name: "developers"}})
+
+			if tt.wantCreated {
+				if err != nil {
+					t.Fatalf("Failed to create group: %v", err)
+				}
+				if results[0].Action != bootstrap.ActionCreated {
+					t.Errorf("Expected group to be created, got %s", results[0].Action)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Expected an untyped error to stop provisioning")
+			}
+			mockIAMClient.AssertNotCalled(t, "CreateGroup", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+// TestIAMPolicyUpdateSkipsIdenticalDocument tests that a policy whose current document only
+// differs in encoding and layout is left alone, and that a changed one is diffed and updated
+func TestIAMPolicyUpdateSkipsIdenticalDocument(t *testing.T) {
+	const configured = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::my-bucket/*"}]}`
+	tests := []struct {
+		name       string
+		current    string // URL-encoded, as IAM returns it
+		wantUpdate bool
+		wantInDiff string
+		wantAction bootstrap.ResourceAction
+	}{
+		{
+			name:       "equal",
+			current:    url.PathEscape(`{ "Statement": [ { "Resource": "arn:aws:s3:::my-bucket/*", "Action": "s3:GetObject", "Effect": "Allow" } ], "Version": "2012-10-17" }`),
+			wantAction: bootstrap.ActionUnchanged,
+		},
+		{
+			name:       "changed",
+			current:    url.PathEscape(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:PutObject","Resource":"arn:aws:s3:::my-bucket/*"}]}`),
+			wantUpdate: true,
+			wantInDiff: "-      \"Action\": \"s3:PutObject\",\n+      \"Action\": \"s3:GetObject\",\n",
+			wantAction: bootstrap.ActionUpdated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockIAMClient := new(MockIAMClient)
+			mockIAMClient.On("GetUser", mock.Anything, mock.Anything).Return(&iam.GetUserOutput{}, nil)
+			mockIAMClient.On("GetLoginProfile", mock.Anything, mock.Anything).Return((*iam.GetLoginProfileOutput)(nil), &types.NoSuchEntityException{})
+			mockIAMClient.On("ListPolicies", mock.Anything, mock.Anything).Return(&iam.ListPoliciesOutput{
+				Policies: []types.Policy{{
+					PolicyName:       aws.String("test-user-s3-access"),
+					Arn:              aws.String("arn:aws:iam::123456789012:policy/test-user-s3-access"),
+					DefaultVersionId: aws.String("v1"),
+				}},
+			}, nil)
+			mockIAMClient.On("GetPolicyVersion", mock.Anything, mock.MatchedBy(func(input *iam.GetPolicyVersionInput) bool {
+				return aws.ToString(input.VersionId) == "v1"
+			})).Return(&iam.GetPolicyVersionOutput{
+				PolicyVersion: &types.PolicyVersion{Document: aws.String(tt.current)},
+			}, nil)
+			mockIAMClient.On("ListPolicyVersions", mock.Anything, mock.Anything).Return(&iam.ListPolicyVersionsOutput{}, nil)
+			mockIAMClient.On("CreatePolicyVersion", mock.Anything, mock.Anything).Return(&iam.CreatePolicyVersionOutput{}, nil)
+			mockIAMClient.On("AttachUserPolicy", mock.Anything, mock.Anything).Return(&iam.AttachUserPolicyOutput{}, nil)
+			mockIAMClient.On("ListUserPolicies", mock.Anything, mock.Anything).Return(&iam.ListUserPoliciesOutput{}, nil)
+
+			var diff strings.Builder
+			bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+			bootstrapper.SetPolicyDiff(&diff)
+			results, err := bootstrapper.CreateIAMUsersAndPolicies(context.Background(), []bootstrap.IAMUser{
+				{Name: "test-user", Policies: []bootstrap.IAMPolicy{{Name: "s3-access", PolicyDocument: configured}}},
+			})
+			if err != nil {
+				t.Fatalf("Failed to reconcile IAM policy: %v", err)
+			}
+
+			if results[0].Action != tt.wantAction {
+				t.Errorf("Expected action %s, got %s", tt.wantAction, results[0].Action)
+			}
+			if tt.wantUpdate {
+				mockIAMClient.AssertNumberOfCalls(t, "CreatePolicyVersion", 1)
+				if !strings.Contains(diff.String(), "--- test-user-s3-access (current)") || !strings.Contains(diff.String(), tt.wantInDiff) {
+					t.Errorf("Expected diff to contain %q, got:\n%s", tt.wantInDiff, diff.String())
+				}
+			} else {
+				mockIAMClient.AssertNotCalled(t, "CreatePolicyVersion", mock.Anything, mock.Anything)
+				if diff.Len() != 0 {
+					t.Errorf("Expected no diff for an identical document, got:\n%s", diff.String())
+				}
+			}
+		})
+	}
+}
+
+// TestIAMPolicySimulation tests that simulation checks are recorded in the result and that
+// a mismatch fails the user unless the simulation is warn_only
+func TestIAMPolicySimulation(t *testing.T) {
+	checks := []bootstrap.IAMSimulationCheck{
+		{Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/*", Expect: "allowed"},
+		{Action: "s3:DeleteBucket", Expect: "denied"},
+	}
+	tests := []struct {
+		name         string
+		deleteResult types.PolicyEvaluationDecisionType
+		warnOnly     bool
+		wantPassed   bool
+		wantErr      bool
+		wantWarnings int
+	}{
+		{name: "matching", deleteResult: types.PolicyEvaluationDecisionTypeImplicitDeny, wantPassed: true},
+		{name: "mismatch", deleteResult: types.PolicyEvaluationDecisionTypeAllowed, wantErr: true},
+		{name: "mismatch warn only", deleteResult: types.PolicyEvaluationDecisionTypeAllowed, warnOnly: true, wantWarnings: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockIAMClient := new(MockIAMClient)
+			mockIAMClient.On("GetUser", mock.Anything, mock.Anything).Return(&iam.GetUserOutput{
+				User: &types.User{Arn: aws.String("arn:aws:iam::123456789012:user/reader")},
+			}, nil)
+			mockIAMClient.On("GetLoginProfile", mock.Anything, mock.Anything).Return((*iam.GetLoginProfileOutput)(nil), &types.NoSuchEntityException{})
+			mockIAMClient.On("ListUserPolicies", mock.Anything, mock.Anything).Return(&iam.ListUserPoliciesOutput{}, nil)
+			mockIAMClient.On("AttachUserPolicy", mock.Anything, mock.Anything).Return(&iam.AttachUserPolicyOutput{}, nil)
+			mockIAMClient.On("SimulatePrincipalPolicy", mock.Anything, mock.MatchedBy(func(input *iam.SimulatePrincipalPolicyInput) bool {
+				return aws.ToString(input.PolicySourceArn) == "arn:aws:iam::123456789012:user/reader" &&
+					input.ActionNames[0] == "s3:GetObject" && input.ResourceArns[0] == "arn:aws:s3:::my-bucket/*"
+			})).Return(&iam.SimulatePrincipalPolicyOutput{
+				EvaluationResults: []types.EvaluationResult{{EvalActionName: aws.String("s3:GetObject"), EvalDecision: types.PolicyEvaluationDecisionTypeAllowed}},
+			}, nil)
+			mockIAMClient.On("SimulatePrincipalPolicy", mock.Anything, mock.MatchedBy(func(input *iam.SimulatePrincipalPolicyInput) bool {
+				return input.ActionNames[0] == "s3:DeleteBucket" && input.ResourceArns[0] == "*"
+			})).Return(&iam.SimulatePrincipalPolicyOutput{
+				EvaluationResults: []types.EvaluationResult{{EvalActionName: aws.String("s3:DeleteBucket"), EvalDecision: tt.deleteResult}},
+			}, nil)
+
+			bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+			results, err := bootstrapper.CreateIAMUsersAndPolicies(context.Background(), []bootstrap.IAMUser{{
+				Name: "reader",
+				Policies: []bootstrap.IAMPolicy{{
+					Name:      "read-only",
+					PolicyArn: "arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess",
+					Simulate:  &bootstrap.IAMPolicySimulation{Checks: checks, WarnOnly: tt.warnOnly},
+				}},
+			}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "FAIL read-only: s3:DeleteBucket on * allowed, expected denied") {
+				t.Errorf("Expected the error to name the failed check, got %v", err)
+			}
+
+			result := results[0]
+			if len(result.Simulations) != 2 || !result.Simulations[0].Passed || result.Simulations[1].Passed != tt.wantPassed {
+				t.Errorf("Unexpected simulation results %+v", result.Simulations)
+			}
+			if len(result.Warnings) != tt.wantWarnings {
+				t.Errorf("Expected %d warning(s), got %v", tt.wantWarnings, result.Warnings)
+			}
+		})
+	}
+}
+
+// TestDestroyKeepsGroupWithOutsideMembers tests that the users in the configuration are
+// deleted before their group, and that a group that still has other members is kept and
+// reported instead of being emptied
+func TestDestroyKeepsGroupWithOutsideMembers(t *testing.T) {
+	mockIAMClient := new(MockIAMClient)
+	mockIAMClient.On("GetUser", mock.Anything, mock.Anything).Return(&iam.GetUserOutput{User: &types.User{UserName: aws.String("alice")}}, nil)
+	mockIAMClient.On("ListAttachedUserPolicies", mock.Anything, mock.Anything).Return(&iam.ListAttachedUserPoliciesOutput{}, nil)
+	mockIAMClient.On("ListUserPolicies", mock.Anything, mock.Anything).Return(&iam.ListUserPoliciesOutput{}, nil)
+	mockIAMClient.On("ListGroupsForUser", mock.Anything, mock.Anything).Return(&iam.ListGroupsForUserOutput{
+		Groups: []types.Group{{GroupName: aws.String("shared")}},
+	}, nil)
+	mockIAMClient.On("RemoveUserFromGroup", mock.Anything, mock.Anything).Return(&iam.RemoveUserFromGroupOutput{}, nil)
+	mockIAMClient.On("DeleteLoginProfile", mock.Anything, mock.Anything).Return((*iam.DeleteLoginProfileOutput)(nil), &types.NoSuchEntityException{})
+	mockIAMClient.On("DeleteUser", mock.Anything, mock.Anything).Return(&iam.DeleteUserOutput{}, nil)
+
+	// bob joined the shared group outside the configuration
+	mockIAMClient.On("GetGroup", mock.Anything, mock.MatchedBy(func(input *iam.GetGroupInput) bool {
+		return aws.ToString(input.GroupName) == "shared"
+	})).Return(&iam.GetGroupOutput{Users: []types.User{{UserName: aws.String("bob")}}}, nil)
+	mockIAMClient.On("GetGroup", mock.Anything, mock.MatchedBy(func(input *iam.GetGroupInput) bool {
+		return aws.ToString(input.GroupName) == "solo"
+	})).Return(&iam.GetGroupOutput{}, nil)
+	mockIAMClient.On("ListAttachedGroupPolicies", mock.Anything, mock.Anything).Return(&iam.ListAttachedGroupPoliciesOutput{}, nil)
+	mockIAMClient.On("DeleteGroup", mock.Anything, mock.Anything).Return(&iam.DeleteGroupOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+	err := bootstrapper.DestroyResources(context.Background(), &bootstrap.Config{
+		Region:    "us-west-2",
+		IAMGroups: []bootstrap.IAMGroup{{Name: "shared"}, {Name: "solo"}},
+		IAMUsers:  []bootstrap.IAMUser{{Name: "alice", Groups: []string{"shared"}}},
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "iam_group:shared <- IAM user bob (not in the configuration)") {
+		t.Fatalf("Expected the kept group to be reported, got %v", err)
+	}
+	mockIAMClient.AssertCalled(t, "DeleteUser", mock.Anything, mock.Anything)
+	mockIAMClient.AssertNumberOfCalls(t, "DeleteGroup", 1)
+	mockIAMClient.AssertCalled(t, "DeleteGroup", mock.Anything, &iam.DeleteGroupInput{GroupName: aws.String("solo")})
+	mockIAMClient.AssertNumberOfCalls(t, "RemoveUserFromGroup", 1)
+}
+
+// TestIAMPolicyTags tests that a new policy is created with its tags, and that an existing
+// policy only gets the tags that differ while -prune-tags removes the ones not configured
+func TestIAMPolicyTags(t *testing.T) {
+	const document = `{"Version":"2012-10-17","Statement":[]}`
+	existingArn := "arn:aws:iam::123456789012:policy/test-user-s3-access"
+	createdArn := "arn:aws:iam::123456789012:policy/new-user-s3-access"
+	tags := map[string]string{"Team": "platform", "Owner": "ops"}
+
+	mockIAMClient := new(MockIAMClient)
+	mockIAMClient.On("GetUser", mock.Anything, mock.Anything).Return(&iam.GetUserOutput{User: &types.User{}}, nil)
+	mockIAMClient.On("GetLoginProfile", mock.Anything, mock.Anything).Return((*iam.GetLoginProfileOutput)(nil), &types.NoSuchEntityException{})
+	mockIAMClient.On("ListUserPolicies", mock.Anything, mock.Anything).Return(&iam.ListUserPoliciesOutput{}, nil)
+	mockIAMClient.On("AttachUserPolicy", mock.Anything, mock.Anything).Return(&iam.AttachUserPolicyOutput{}, nil)
+	mockIAMClient.On("ListPolicies", mock.Anything, mock.Anything).Return(&iam.ListPoliciesOutput{
+		Policies: []types.Policy{{PolicyName: aws.String("test-user-s3-access"), Arn: aws.String(existingArn)}},
+	}, nil)
+	mockIAMClient.On("GetPolicyVersion", mock.Anything, mock.Anything).Return(&iam.GetPolicyVersionOutput{
+		PolicyVersion: &types.PolicyVersion{Document: aws.String(document)},
+	}, nil)
+	mockIAMClient.On("CreatePolicy", mock.Anything, mock.MatchedBy(func(input *iam.CreatePolicyInput) bool {
+		return reflect.DeepEqual(input.Tags, []types.Tag{
+			{Key: aws.String("Owner"), Value: aws.String("ops")},
+			{Key: aws.String("Team"), Value: aws.String("platform")},
+		})
+	})).Return(&iam.CreatePolicyOutput{Policy: &types.Policy{Arn: aws.String(createdArn)}}, nil).Once()
+
+	// The new policy already carries its tags, the existing one has an outdated and a stale tag
+	mockIAMClient.On("ListPolicyTags", mock.Anything, &iam.ListPolicyTagsInput{PolicyArn: aws.String(createdArn)}).Return(&iam.ListPolicyTagsOutput{
+		Tags: []types.Tag{{Key: aws.String("Owner"), Value: aws.String("ops")}, {Key: aws.String("Team"), Value: aws.String("platform")}},
+	}, nil)
+	mockIAMClient.On("ListPolicyTags", mock.Anything, &iam.ListPolicyTagsInput{PolicyArn: aws.String(existingArn)}).Return(&iam.ListPolicyTagsOutput{
+		Tags: []types.Tag{
+			{Key: aws.String("Owner"), Value: aws.String("ops")},
+			{Key: aws.String("Team"), Value: aws.String("data")},
+			{Key: aws.String("Stale"), Value: aws.String("yes")},
+		},
+	}, nil)
+	mockIAMClient.On("TagPolicy", mock.Anything, &iam.TagPolicyInput{
+		PolicyArn: aws.String(existingArn),
+		Tags:      []types.Tag{{Key: aws.String("Team"), Value: aws.String("platform")}},
+	}).Return(&iam.TagPolicyOutput{}, nil).Once()
+	mockIAMClient.On("UntagPolicy", mock.Anything, &iam.UntagPolicyInput{
+		PolicyArn: aws.String(existingArn),
+		TagKeys:   []string{"Stale"},
+	}).Return(&iam.UntagPolicyOutput{}, nil).Once()
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{IAM: mockIAMClient})
+	bootstrapper.SetPruneTags(true)
+	results, err := bootstrapper.CreateIAMUsersAndPolicies(context.Background(), []bootstrap.IAMUser{
+		{Name: "test-user", Policies: []bootstrap.IAMPolicy{{Name: "s3-access", PolicyDocument: document, Tags: tags}}},
+		{Name: "new-user", Policies: []bootstrap.IAMPolicy{{Name: "s3-access", PolicyDocument: document, Tags: tags}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to reconcile IAM policies: %v", err)
+	}
+	if results[0].Action != bootstrap.ActionUpdated {
+		t.Errorf("Expected the retagged policy to update its user, got %s", results[0].Action)
+	}
+
+	mockIAMClient.AssertExpectations(t)
+	mockIAMClient.AssertNumberOfCalls(t, "TagPolicy", 1)
+}
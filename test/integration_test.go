@@ -5,13 +5,13 @@ import (
 	"os"
 	"testing"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
 )
 
 // TestS3BucketIntegration performs an integration test with AWS
 // Note: This test requires valid AWS credentials and will create actual resources
-// Set the TEST_INTEGRATION environment variable to run this test
+// Set the TEST_INTEGRATION environment variable to run this test. To run it against
+// LocalStack instead of a real account, also set AWS_ENDPOINT_URL=http://localhost:4566.
 func TestS3BucketIntegration(t *testing.T) {
 	// Skip if not running integration tests
 	if os.Getenv("TEST_INTEGRATION") == "" {
@@ -20,40 +20,39 @@ func TestS3BucketIntegration(t *testing.T) {
 
 	// Use a unique test bucket name
 	testBucketName := "test-bucket-" + os.Getenv("USER") + "-" + os.Getenv("TEST_RUN_ID")
+	buckets := []bootstrap.S3Bucket{{Name: testBucketName, Versioning: "enabled"}}
 
-	// Initialize AWS config
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("us-west-2"))
+	// The SDK picks up AWS_ENDPOINT_URL on its own, so the same code runs against LocalStack
+	ctx := context.Background()
+	bootstrapper, err := bootstrap.NewBootstrapper(ctx, "us-west-2", bootstrap.AWSOptions{})
 	if err != nil {
-		t.Fatalf("Failed to load AWS config: %v", err)
+		t.Fatalf("Failed to initialize bootstrapper: %v", err)
 	}
 
-	// Create S3 client
-	s3Client := s3.NewFromConfig(cfg)
-
 	// Create test bucket
-	_, err = s3Client.CreateBucket(context.TODO(), &s3.CreateBucketInput{
-		Bucket: &testBucketName,
-	})
+	results, err := bootstrapper.CreateS3Buckets(ctx, buckets)
 	if err != nil {
 		t.Fatalf("Failed to create test bucket: %v", err)
 	}
 
 	// Clean up after test
 	defer func() {
-		_, err = s3Client.DeleteBucket(context.TODO(), &s3.DeleteBucketInput{
-			Bucket: &testBucketName,
-		})
-		if err != nil {
+		if err := bootstrapper.DeleteS3Buckets(ctx, buckets); err != nil {
 			t.Logf("Warning: Failed to delete test bucket: %v", err)
 		}
 	}()
 
-	// Verify bucket exists
-	_, err = s3Client.HeadBucket(context.TODO(), &s3.HeadBucketInput{
-		Bucket: &testBucketName,
-	})
+	if len(results[0].Warnings) > 0 {
+		t.Errorf("Expected no warnings, got %v", results[0].Warnings)
+	}
+
+	// Verify the bucket exists and matches its configuration
+	plan, err := bootstrapper.Plan(ctx, &bootstrap.Config{Region: "us-west-2", S3Buckets: buckets})
 	if err != nil {
-		t.Fatalf("Test bucket does not exist: %v", err)
+		t.Fatalf("Failed to plan test bucket: %v", err)
+	}
+	if plan.Resources[0].Action != bootstrap.PlanNoOp {
+		t.Fatalf("Expected test bucket to be up to date, got %+v", plan.Resources[0])
 	}
 
 	t.Logf("Successfully created and verified test bucket: %s", testBucketName)
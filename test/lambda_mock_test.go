@@ -0,0 +1,128 @@
+package test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
+)
+
+// MockLambdaClient is a mock implementation of the Lambda client
+type MockLambdaClient struct {
+	mock.Mock
+}
+
+func (m *MockLambdaClient) GetFunction(ctx context.Context, params *lambda.GetFunctionInput, optFns ...func(*lambda.Options)) (*lambda.GetFunctionOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*lambda.GetFunctionOutput), args.Error(1)
+}
+
+func (m *MockLambdaClient) CreateFunction(ctx context.Context, params *lambda.CreateFunctionInput, optFns ...func(*lambda.Options)) (*lambda.CreateFunctionOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*lambda.CreateFunctionOutput), args.Error(1)
+}
+
+func (m *MockLambdaClient) UpdateFunctionConfiguration(ctx context.Context, params *lambda.UpdateFunctionConfigurationInput, optFns ...func(*lambda.Options)) (*lambda.UpdateFunctionConfigurationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*lambda.UpdateFunctionConfigurationOutput), args.Error(1)
+}
+
+func (m *MockLambdaClient) UpdateFunctionCode(ctx context.Context, params *lambda.UpdateFunctionCodeInput, optFns ...func(*lambda.Options)) (*lambda.UpdateFunctionCodeOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*lambda.UpdateFunctionCodeOutput), args.Error(1)
+}
+
+func (m *MockLambdaClient) TagResource(ctx context.Context, params *lambda.TagResourceInput, optFns ...func(*lambda.Options)) (*lambda.TagResourceOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*lambda.TagResourceOutput), args.Error(1)
+}
+
+func (m *MockLambdaClient) AddPermission(ctx context.Context, params *lambda.AddPermissionInput, optFns ...func(*lambda.Options)) (*lambda.AddPermissionOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*lambda.AddPermissionOutput), args.Error(1)
+}
+
+// TestLambdaFunctionCreateFromConfigRepository tests that an image reference to a repository
+// in the config is resolved to the repository URI when the function is created
+func TestLambdaFunctionCreateFromConfigRepository(t *testing.T) {
+	mockECRClient := new(MockECRClient)
+	mockECRClient.On("DescribeRepositories", mock.Anything, mock.Anything).Return(&ecr.DescribeRepositoriesOutput{
+		Repositories: []ecrtypes.Repository{
+			{RepositoryUri: aws.String("123456789012.dkr.ecr.us-west-2.amazonaws.com/my-app")},
+		},
+	}, nil)
+
+	mockLambdaClient := new(MockLambdaClient)
+	mockLambdaClient.On("GetFunction", mock.Anything, mock.Anything).Return((*lambda.GetFunctionOutput)(nil), &types.ResourceNotFoundException{Message: aws.String("Function not found")})
+	mockLambdaClient.On("CreateFunction", mock.Anything, mock.MatchedBy(func(input *lambda.CreateFunctionInput) bool {
+		return input.PackageType == types.PackageTypeImage &&
+			aws.ToString(input.Code.ImageUri) == "123456789012.dkr.ecr.us-west-2.amazonaws.com/my-app:v1" &&
+			input.Runtime == "" && input.Handler == nil
+	})).Return(&lambda.CreateFunctionOutput{FunctionArn: aws.String("arn:aws:lambda:us-west-2:123456789012:function:api")}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{ECR: mockECRClient, Lambda: mockLambdaClient})
+	results, err := bootstrapper.CreateLambdaFunctions(context.Background(), []bootstrap.LambdaFunction{
+		{Name: "api", Role: "arn:aws:iam::123456789012:role/api", ImageURI: "my-app:v1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Lambda function: %v", err)
+	}
+
+	if results[0].Action != bootstrap.ActionCreated || results[0].ARN != "arn:aws:lambda:us-west-2:123456789012:function:api" {
+		t.Errorf("Expected function to be created, got %+v", results[0])
+	}
+	mockECRClient.AssertExpectations(t)
+	mockLambdaClient.AssertExpectations(t)
+}
+
+// TestLambdaFunctionUpdatesChangedConfiguration tests that only the configuration of an
+// existing function is updated when its zip file is already deployed
+func TestLambdaFunctionUpdatesChangedConfiguration(t *testing.T) {
+	zip := []byte("deployment package")
+	zipFile := filepath.Join(t.TempDir(), "function.zip")
+	if err := os.WriteFile(zipFile, zip, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(zip)
+
+	mockLambdaClient := new(MockLambdaClient)
+	mockLambdaClient.On("GetFunction", mock.Anything, mock.Anything).Return(&lambda.GetFunctionOutput{
+		Configuration: &types.FunctionConfiguration{
+			FunctionArn:      aws.String("arn:aws:lambda:us-west-2:123456789012:function:thumbnailer"),
+			Role:             aws.String("arn:aws:iam::123456789012:role/thumbnailer"),
+			Runtime:          types.RuntimePython312,
+			Handler:          aws.String("app.handler"),
+			MemorySize:       aws.Int32(128),
+			CodeSha256:       aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+			LastUpdateStatus: types.LastUpdateStatusSuccessful,
+		},
+	}, nil)
+	mockLambdaClient.On("UpdateFunctionConfiguration", mock.Anything, mock.MatchedBy(func(input *lambda.UpdateFunctionConfigurationInput) bool {
+		return aws.ToInt32(input.MemorySize) == 512
+	})).Return(&lambda.UpdateFunctionConfigurationOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{Lambda: mockLambdaClient})
+	results, err := bootstrapper.CreateLambdaFunctions(context.Background(), []bootstrap.LambdaFunction{
+		{Name: "thumbnailer", Role: "arn:aws:iam::123456789012:role/thumbnailer", Runtime: "python3.12",
+			Handler: "app.handler", ZipFile: zipFile, MemorySize: 512},
+	})
+	if err != nil {
+		t.Fatalf("Failed to reconcile Lambda function: %v", err)
+	}
+
+	if results[0].Action != bootstrap.ActionUpdated {
+		t.Errorf("Expected function to be updated, got %+v", results[0])
+	}
+	mockLambdaClient.AssertNotCalled(t, "UpdateFunctionCode", mock.Anything, mock.Anything)
+	mockLambdaClient.AssertExpectations(t)
+}
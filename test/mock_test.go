@@ -2,10 +2,25 @@ package test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	"github.com/stretchr/testify/mock"
+	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
 )
 
 // MockS3Client is a mock implementation of the S3 client
@@ -13,16 +28,61 @@ type MockS3Client struct {
 	mock.Mock
 }
 
+func (m *MockS3Client) DeleteBucketTagging(ctx context.Context, params *s3.DeleteBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketTaggingOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.DeleteBucketTaggingOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetBucketOwnershipControls(ctx context.Context, params *s3.GetBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.GetBucketOwnershipControlsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetBucketOwnershipControlsOutput), args.Error(1)
+}
+
+func (m *MockS3Client) PutBucketOwnershipControls(ctx context.Context, params *s3.PutBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.PutBucketOwnershipControlsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.PutBucketOwnershipControlsOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetBucketAcl(ctx context.Context, params *s3.GetBucketAclInput, optFns ...func(*s3.Options)) (*s3.GetBucketAclOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetBucketAclOutput), args.Error(1)
+}
+
+func (m *MockS3Client) PutBucketAcl(ctx context.Context, params *s3.PutBucketAclInput, optFns ...func(*s3.Options)) (*s3.PutBucketAclOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.PutBucketAclOutput), args.Error(1)
+}
+
+func (m *MockS3Client) PutBucketNotificationConfiguration(ctx context.Context, params *s3.PutBucketNotificationConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketNotificationConfigurationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.PutBucketNotificationConfigurationOutput), args.Error(1)
+}
+
+func (m *MockS3Client) PutBucketReplication(ctx context.Context, params *s3.PutBucketReplicationInput, optFns ...func(*s3.Options)) (*s3.PutBucketReplicationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.PutBucketReplicationOutput), args.Error(1)
+}
+
 func (m *MockS3Client) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
 	args := m.Called(ctx, params)
 	return args.Get(0).(*s3.HeadBucketOutput), args.Error(1)
 }
 
+func (m *MockS3Client) GetBucketLocation(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetBucketLocationOutput), args.Error(1)
+}
+
 func (m *MockS3Client) CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
 	args := m.Called(ctx, params)
 	return args.Get(0).(*s3.CreateBucketOutput), args.Error(1)
 }
 
+func (m *MockS3Client) PutBucketTagging(ctx context.Context, params *s3.PutBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.PutBucketTaggingOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.PutBucketTaggingOutput), args.Error(1)
+}
+
 func (m *MockS3Client) PutBucketVersioning(ctx context.Context, params *s3.PutBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.PutBucketVersioningOutput, error) {
 	args := m.Called(ctx, params)
 	return args.Get(0).(*s3.PutBucketVersioningOutput), args.Error(1)
@@ -38,35 +98,1140 @@ func (m *MockS3Client) PutBucketCors(ctx context.Context, params *s3.PutBucketCo
 	return args.Get(0).(*s3.PutBucketCorsOutput), args.Error(1)
 }
 
+func (m *MockS3Client) PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.PutBucketLifecycleConfigurationOutput), args.Error(1)
+}
+
 func (m *MockS3Client) PutBucketPolicy(ctx context.Context, params *s3.PutBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.PutBucketPolicyOutput, error) {
 	args := m.Called(ctx, params)
 	return args.Get(0).(*s3.PutBucketPolicyOutput), args.Error(1)
 }
 
+func (m *MockS3Client) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.ListObjectVersionsOutput), args.Error(1)
+}
+
+func (m *MockS3Client) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.DeleteObjectsOutput), args.Error(1)
+}
+
+func (m *MockS3Client) DeleteBucket(ctx context.Context, params *s3.DeleteBucketInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.DeleteBucketOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetBucketVersioning(ctx context.Context, params *s3.GetBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetBucketVersioningOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetBucketEncryptionOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetBucketTaggingOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetBucketPolicy(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetBucketPolicyOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetObjectLockConfiguration(ctx context.Context, params *s3.GetObjectLockConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetObjectLockConfigurationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetObjectLockConfigurationOutput), args.Error(1)
+}
+
+func (m *MockS3Client) PutObjectLockConfiguration(ctx context.Context, params *s3.PutObjectLockConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutObjectLockConfigurationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.PutObjectLockConfigurationOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetBucketAccelerateConfiguration(ctx context.Context, params *s3.GetBucketAccelerateConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketAccelerateConfigurationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetBucketAccelerateConfigurationOutput), args.Error(1)
+}
+
+func (m *MockS3Client) PutBucketAccelerateConfiguration(ctx context.Context, params *s3.PutBucketAccelerateConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketAccelerateConfigurationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.PutBucketAccelerateConfigurationOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetBucketRequestPayment(ctx context.Context, params *s3.GetBucketRequestPaymentInput, optFns ...func(*s3.Options)) (*s3.GetBucketRequestPaymentOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetBucketRequestPaymentOutput), args.Error(1)
+}
+
+func (m *MockS3Client) PutBucketRequestPayment(ctx context.Context, params *s3.PutBucketRequestPaymentInput, optFns ...func(*s3.Options)) (*s3.PutBucketRequestPaymentOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.PutBucketRequestPaymentOutput), args.Error(1)
+}
+
+func (m *MockS3Client) DeleteBucketPolicy(ctx context.Context, params *s3.DeleteBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.DeleteBucketPolicyOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetBucketCors(ctx context.Context, params *s3.GetBucketCorsInput, optFns ...func(*s3.Options)) (*s3.GetBucketCorsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetBucketCorsOutput), args.Error(1)
+}
+
+func (m *MockS3Client) DeleteBucketCors(ctx context.Context, params *s3.DeleteBucketCorsInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketCorsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.DeleteBucketCorsOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetBucketLifecycleConfigurationOutput), args.Error(1)
+}
+
+func (m *MockS3Client) DeleteBucketLifecycle(ctx context.Context, params *s3.DeleteBucketLifecycleInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketLifecycleOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.DeleteBucketLifecycleOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetBucketReplication(ctx context.Context, params *s3.GetBucketReplicationInput, optFns ...func(*s3.Options)) (*s3.GetBucketReplicationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetBucketReplicationOutput), args.Error(1)
+}
+
+func (m *MockS3Client) DeleteBucketReplication(ctx context.Context, params *s3.DeleteBucketReplicationInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketReplicationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.DeleteBucketReplicationOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetBucketNotificationConfiguration(ctx context.Context, params *s3.GetBucketNotificationConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketNotificationConfigurationOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3.GetBucketNotificationConfigurationOutput), args.Error(1)
+}
+
 // TestS3BucketCreation tests the S3 bucket creation functionality with mocks
 func TestS3BucketCreation(t *testing.T) {
-	// Skip this test for now since it's just a demonstration
-	// In a real implementation, we would refactor the main.go code to accept
-	// an interface for the S3 client so we could inject our mock
-	t.Skip("Skipping mock test until we refactor the code to be more testable")
+	mockS3Client := new(MockS3Client)
+
+	// Setup expectations: the bucket doesn't exist yet, so it is created and then configured
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return((*s3.HeadBucketOutput)(nil), &types.NotFound{})
+	mockS3Client.On("CreateBucket", mock.Anything, mock.Anything).Return(&s3.CreateBucketOutput{}, nil)
+	mockS3Client.On("PutBucketVersioning", mock.Anything, mock.MatchedBy(func(input *s3.PutBucketVersioningInput) bool {
+		return aws.ToString(input.Bucket) == "test-bucket" &&
+			input.VersioningConfiguration.Status == types.BucketVersioningStatusEnabled
+	})).Return(&s3.PutBucketVersioningOutput{}, nil)
+	mockS3Client.On("PutBucketEncryption", mock.Anything, mock.MatchedBy(func(input *s3.PutBucketEncryptionInput) bool {
+		rules := input.ServerSideEncryptionConfiguration.Rules
+		return aws.ToString(input.Bucket) == "test-bucket" && len(rules) == 1 &&
+			rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm == types.ServerSideEncryptionAes256
+	})).Return(&s3.PutBucketEncryptionOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	results, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{
+		{Name: "test-bucket", Versioning: "enabled", Encryption: "AES256"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bucket: %v", err)
+	}
+
+	if len(results) != 1 || results[0].Action != bootstrap.ActionCreated {
+		t.Errorf("Expected bucket to be reported as created, got %+v", results)
+	}
+
+	// Verify expectations
+	mockS3Client.AssertExpectations(t)
+}
+
+// TestS3BucketExistenceCached tests that a bucket is only looked up once per run, and that
+// one the run created is known to exist in the configured region without a lookup
+func TestS3BucketExistenceCached(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return((*s3.HeadBucketOutput)(nil), &types.NotFound{}).Once()
+	mockS3Client.On("CreateBucket", mock.Anything, mock.Anything).Return(&s3.CreateBucketOutput{}, nil).Once()
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	buckets := []bootstrap.S3Bucket{{Name: "test-bucket"}}
+	if _, err := bootstrapper.CreateS3Buckets(context.Background(), buckets); err != nil {
+		t.Fatalf("Failed to create bucket: %v", err)
+	}
+	results, err := bootstrapper.CreateS3Buckets(context.Background(), buckets)
+	if err != nil {
+		t.Fatalf("Failed to reconcile bucket again: %v", err)
+	}
+
+	if len(results) != 1 || results[0].Action != bootstrap.ActionUnchanged {
+		t.Errorf("Expected existing bucket to be unchanged, got %+v", results)
+	}
+	mockS3Client.AssertNotCalled(t, "GetBucketLocation", mock.Anything, mock.Anything)
+	mockS3Client.AssertExpectations(t)
+}
+
+// TestS3BucketCreationCancelled tests that a cancelled context stops provisioning before any API call
+func TestS3BucketCreationCancelled(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	_, err := bootstrapper.CreateS3Buckets(ctx, []bootstrap.S3Bucket{{Name: "test-bucket"}})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
 
-	// The following code would be used if we had refactored our code:
-	/*
+	mockS3Client.AssertNotCalled(t, "HeadBucket", mock.Anything, mock.Anything)
+}
+
+// httpStatusError builds the error the SDK returns for a HeadBucket call answered with the given status
+func httpStatusError(status int) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+			Err:      errors.New(http.StatusText(status)),
+		},
+	}
+}
+
+// TestS3BucketNameCollisions tests that buckets owned by other accounts are all reported before anything is created
+func TestS3BucketNameCollisions(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	forBucket := func(name string) any {
+		return mock.MatchedBy(func(in *s3.HeadBucketInput) bool { return aws.ToString(in.Bucket) == name })
+	}
+
+	mockS3Client.On("HeadBucket", mock.Anything, forBucket("free-bucket")).Return((*s3.HeadBucketOutput)(nil), httpStatusError(http.StatusNotFound))
+	mockS3Client.On("HeadBucket", mock.Anything, forBucket("taken-bucket")).Return((*s3.HeadBucketOutput)(nil), httpStatusError(http.StatusForbidden))
+	mockS3Client.On("HeadBucket", mock.Anything, forBucket("other-taken-bucket")).Return((*s3.HeadBucketOutput)(nil), httpStatusError(http.StatusForbidden))
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	_, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{
+		{Name: "free-bucket"}, {Name: "taken-bucket"}, {Name: "other-taken-bucket"},
+	})
+	if err == nil {
+		t.Fatal("Expected bucket name collisions to fail")
+	}
+	for _, name := range []string{"bucket taken-bucket already exists", "bucket other-taken-bucket already exists"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected error to contain %q, got: %v", name, err)
+		}
+	}
+
+	mockS3Client.AssertNotCalled(t, "CreateBucket", mock.Anything, mock.Anything)
+}
+
+// TestS3ExistenceCheck tests that only a 404 from HeadBucket means the bucket is missing:
+// AccessDenied or throttling neither triggers a create nor lets destroy skip the bucket
+func TestS3ExistenceCheck(t *testing.T) {
+	tests := []struct {
+		name          string
+		headErr       error
+		wantCreateErr string
+		wantDeleteErr string
+	}{
+		{name: "not found", headErr: httpStatusError(http.StatusNotFound)},
+		{
+			name:          "access denied",
+			headErr:       httpStatusError(http.StatusForbidden),
+			wantCreateErr: "owned by another AWS account",
+			wantDeleteErr: "access to it is denied",
+		},
+		{
+			name:          "throttled",
+			headErr:       httpStatusError(http.StatusServiceUnavailable),
+			wantCreateErr: "failed to check bucket my-bucket",
+			wantDeleteErr: "failed to check bucket my-bucket",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3Client := new(MockS3Client)
+			mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return((*s3.HeadBucketOutput)(nil), tt.headErr)
+			mockS3Client.On("CreateBucket", mock.Anything, mock.Anything).Return(&s3.CreateBucketOutput{}, nil)
+			mockS3Client.On("PutPublicAccessBlock", mock.Anything, mock.Anything).Return(&s3.PutPublicAccessBlockOutput{}, nil)
+
+			bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+			_, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{{Name: "my-bucket"}})
+			if tt.wantCreateErr == "" {
+				if err != nil {
+					t.Fatalf("Failed to create bucket: %v", err)
+				}
+				mockS3Client.AssertCalled(t, "CreateBucket", mock.Anything, mock.Anything)
+			} else {
+				if err == nil || !strings.Contains(err.Error(), tt.wantCreateErr) {
+					t.Errorf("Expected create to fail with %q, got %v", tt.wantCreateErr, err)
+				}
+				mockS3Client.AssertNotCalled(t, "CreateBucket", mock.Anything, mock.Anything)
+			}
+
+			err = bootstrapper.DeleteS3Buckets(context.Background(), []bootstrap.S3Bucket{{Name: "my-bucket"}})
+			if tt.wantDeleteErr == "" {
+				if err != nil {
+					t.Fatalf("Expected a missing bucket to be skipped, got %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantDeleteErr) {
+				t.Errorf("Expected delete to fail with %q, got %v", tt.wantDeleteErr, err)
+			}
+			mockS3Client.AssertNotCalled(t, "DeleteBucket", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+// TestS3BucketAlreadyOwnedByYou tests that a bucket CreateBucket reports as already owned is configured like an existing bucket
+func TestS3BucketAlreadyOwnedByYou(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return((*s3.HeadBucketOutput)(nil), httpStatusError(http.StatusNotFound))
+	mockS3Client.On("CreateBucket", mock.Anything, mock.Anything).Return((*s3.CreateBucketOutput)(nil), &types.BucketAlreadyOwnedByYou{})
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{LocationConstraint: types.BucketLocationConstraintUsWest2}, nil)
+	mockS3Client.On("PutBucketTagging", mock.Anything, mock.Anything).Return(&s3.PutBucketTaggingOutput{}, nil)
+	mockS3Client.On("PutPublicAccessBlock", mock.Anything, mock.Anything).Return(&s3.PutPublicAccessBlockOutput{}, nil).Maybe()
+	// With -prune-tags the stale tags of the bucket without configured tags are removed,
+	// and they are replaced on the bucket with tags
+	mockS3Client.On("GetBucketTagging", mock.Anything, mock.Anything).Return(&s3.GetBucketTaggingOutput{TagSet: []types.Tag{{Key: aws.String("Stale"), Value: aws.String("yes")}}}, nil)
+	mockS3Client.On("DeleteBucketTagging", mock.Anything, mock.MatchedBy(func(in *s3.DeleteBucketTaggingInput) bool {
+		return aws.ToString(in.Bucket) == "untagged-bucket"
+	})).Return(&s3.DeleteBucketTaggingOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	bootstrapper.SetPruneTags(true)
+	results, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{
+		{Name: "my-bucket", Tags: map[string]string{"Team": "platform"}},
+		{Name: "untagged-bucket"},
+	})
+	if err != nil {
+		t.Fatalf("Expected an already owned bucket to be configured, got %v", err)
+	}
+	if len(results) != 2 || results[0].Action == bootstrap.ActionCreated || results[1].Action == bootstrap.ActionCreated {
+		t.Errorf("Expected the buckets not to be reported as created, got %+v", results)
+	}
+	mockS3Client.AssertExpectations(t)
+}
+
+// TestS3BucketIfNotExists tests that an existing bucket with if_not_exists is left as it is
+func TestS3BucketIfNotExists(t *testing.T) {
 	mockS3Client := new(MockS3Client)
-	
-	// Setup expectations
 	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
-	mockS3Client.On("PutBucketVersioning", mock.Anything, mock.Anything).Return(&s3.PutBucketVersioningOutput{}, nil)
-	mockS3Client.On("PutBucketEncryption", mock.Anything, mock.Anything).Return(&s3.PutBucketEncryptionOutput{}, nil)
-	mockS3Client.On("PutBucketPolicy", mock.Anything, mock.Anything).Return(&s3.PutBucketPolicyOutput{}, nil)
-	
-	// Call our refactored function that would accept the mock client
-	err := createS3Bucket(mockS3Client, "test-bucket", "enabled", "AES256", "{}")
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	results, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{{
+		Name:        "my-bucket",
+		Versioning:  "enabled",
+		Tags:        map[string]string{"Team": "platform"},
+		IfNotExists: true,
+	}})
+	if err != nil {
+		t.Fatalf("Failed to ensure bucket: %v", err)
+	}
+	if len(results) != 1 || results[0].Action != bootstrap.ActionUnchanged {
+		t.Errorf("Expected the bucket to be unchanged, got %+v", results)
+	}
+	// HeadBucket is the only call, so nothing about the bucket was read or written
+	mockS3Client.AssertExpectations(t)
+	for _, method := range []string{"CreateBucket", "GetBucketLocation", "PutBucketVersioning", "PutBucketTagging", "PutPublicAccessBlock"} {
+		mockS3Client.AssertNotCalled(t, method, mock.Anything, mock.Anything)
+	}
+}
+
+// TestRollbackDeletesCreatedBuckets tests that a failed run only rolls back the buckets it created
+func TestRollbackDeletesCreatedBuckets(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	forBucket := func(name string) any {
+		return mock.MatchedBy(func(input any) bool {
+			switch in := input.(type) {
+			case *s3.HeadBucketInput:
+				return aws.ToString(in.Bucket) == name
+			case *s3.CreateBucketInput:
+				return aws.ToString(in.Bucket) == name
+			case *s3.DeleteBucketInput:
+				return aws.ToString(in.Bucket) == name
+			}
+			return false
+		})
+	}
+
+	// created-bucket is new and gets created; broken-bucket fails to create and stops the run
+	mockS3Client.On("HeadBucket", mock.Anything, forBucket("created-bucket")).Return((*s3.HeadBucketOutput)(nil), &types.NotFound{}).Once()
+	mockS3Client.On("CreateBucket", mock.Anything, forBucket("created-bucket")).Return(&s3.CreateBucketOutput{}, nil)
+	mockS3Client.On("HeadBucket", mock.Anything, forBucket("broken-bucket")).Return((*s3.HeadBucketOutput)(nil), &types.NotFound{})
+	mockS3Client.On("CreateBucket", mock.Anything, forBucket("broken-bucket")).Return((*s3.CreateBucketOutput)(nil), errors.New("AccessDenied"))
+
+	// Rollback finds the created bucket, empties it and deletes it
+	mockS3Client.On("HeadBucket", mock.Anything, forBucket("created-bucket")).Return(&s3.HeadBucketOutput{}, nil).Once()
+	mockS3Client.On("ListObjectVersions", mock.Anything, mock.Anything).Return(&s3.ListObjectVersionsOutput{}, nil)
+	mockS3Client.On("DeleteBucket", mock.Anything, forBucket("created-bucket")).Return(&s3.DeleteBucketOutput{}, nil)
+
+	config := &bootstrap.Config{
+		Region:    "us-west-2",
+		S3Buckets: []bootstrap.S3Bucket{{Name: "created-bucket"}, {Name: "broken-bucket"}},
+	}
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	result, err := bootstrapper.ProvisionResources(context.Background(), config)
+	if err == nil {
+		t.Fatal("Expected provisioning to fail")
+	}
+
+	rolledBack, err := bootstrapper.Rollback(context.Background(), result, config)
+	if err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if len(rolledBack.S3Buckets) != 1 || rolledBack.S3Buckets[0].Name != "created-bucket" {
+		t.Errorf("Expected only created-bucket to be rolled back, got %+v", rolledBack.S3Buckets)
+	}
+	if result.Resources[0].Action != bootstrap.ActionRolledBack || result.Resources[1].Action != bootstrap.ActionFailed {
+		t.Errorf("Expected rolled_back and failed results, got %+v", result.Resources)
+	}
+
+	mockS3Client.AssertExpectations(t)
+	mockS3Client.AssertNotCalled(t, "DeleteBucket", mock.Anything, forBucket("broken-bucket"))
+}
+
+// TestS3BucketLocationConstraint tests that buckets are created without a location
+// constraint in us-east-1, which rejects one, and with the session region everywhere else
+func TestS3BucketLocationConstraint(t *testing.T) {
+	tests := []struct {
+		region string
+		want   types.BucketLocationConstraint // empty when no configuration is expected
+	}{
+		{region: "us-east-1"},
+		{region: "us-west-2", want: types.BucketLocationConstraintUsWest2},
+		{region: "eu-west-1", want: types.BucketLocationConstraintEuWest1},
+		{region: "ap-southeast-1", want: types.BucketLocationConstraintApSoutheast1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.region, func(t *testing.T) {
+			var input *s3.CreateBucketInput
+			mockS3Client := new(MockS3Client)
+			mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return((*s3.HeadBucketOutput)(nil), httpStatusError(http.StatusNotFound))
+			mockS3Client.On("CreateBucket", mock.Anything, mock.Anything).Return(&s3.CreateBucketOutput{}, nil).Run(func(args mock.Arguments) {
+				input = args.Get(1).(*s3.CreateBucketInput)
+			})
+			mockS3Client.On("PutPublicAccessBlock", mock.Anything, mock.Anything).Return(&s3.PutPublicAccessBlockOutput{}, nil)
+
+			bootstrapper := bootstrap.NewBootstrapperWithClients(tt.region, bootstrap.Clients{S3: mockS3Client})
+			if _, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{{Name: "test-bucket"}}); err != nil {
+				t.Fatalf("Failed to create bucket: %v", err)
+			}
+
+			if input == nil {
+				t.Fatal("Expected CreateBucket to be called")
+			}
+			if tt.want == "" {
+				if input.CreateBucketConfiguration != nil {
+					t.Errorf("Expected no bucket configuration in %s, got %+v", tt.region, input.CreateBucketConfiguration)
+				}
+				return
+			}
+			if input.CreateBucketConfiguration == nil || input.CreateBucketConfiguration.LocationConstraint != tt.want {
+				t.Errorf("Expected location constraint %s, got %+v", tt.want, input.CreateBucketConfiguration)
+			}
+		})
+	}
+}
+
+// TestResourceRegionOverride tests that a bucket and a repository with their own region are
+// provisioned with the clients of that region, and that the cost of crossing regions is
+// reported as a warning
+func TestResourceRegionOverride(t *testing.T) {
+	sessionS3 := new(MockS3Client)
+	regionalS3 := new(MockS3Client)
+	regionalS3.On("HeadBucket", mock.Anything, mock.Anything).Return((*s3.HeadBucketOutput)(nil), httpStatusError(http.StatusNotFound))
+	regionalS3.On("CreateBucket", mock.Anything, mock.MatchedBy(func(input *s3.CreateBucketInput) bool {
+		return input.CreateBucketConfiguration != nil && input.CreateBucketConfiguration.LocationConstraint == types.BucketLocationConstraintEuWest1
+	})).Return(&s3.CreateBucketOutput{}, nil).Once()
+
+	sessionECR := new(MockECRClient)
+	regionalECR := new(MockECRClient)
+	regionalECR.On("DescribeRepositories", mock.Anything, mock.Anything).Return((*ecr.DescribeRepositoriesOutput)(nil),
+		&ecrtypes.RepositoryNotFoundException{Message: aws.String("repository not found")})
+	regionalECR.On("CreateRepository", mock.Anything, mock.Anything).Return(&ecr.CreateRepositoryOutput{
+		Repository: &ecrtypes.Repository{RepositoryArn: aws.String("arn:aws:ecr:eu-west-1:123456789012:repository/api")},
+	}, nil).Once()
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: sessionS3, ECR: sessionECR})
+	bootstrapper.SetRegionClients("eu-west-1", bootstrap.Clients{S3: regionalS3, ECR: regionalECR})
+
+	buckets, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{{Name: "replica-bucket", Region: "eu-west-1"}})
 	if err != nil {
 		t.Fatalf("Failed to create bucket: %v", err)
 	}
-	
-	// Verify expectations
+	repos, err := bootstrapper.CreateECRRepositories(context.Background(), []bootstrap.ECRRepository{{Name: "api", Region: "eu-west-1"}})
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	for _, res := range []bootstrap.ResourceResult{buckets[0], repos[0]} {
+		if res.Action != bootstrap.ActionCreated {
+			t.Errorf("Expected %s %s to be created, got %s", res.Type, res.Name, res.Action)
+		}
+		if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0].Message, "is in eu-west-1 rather than us-west-2") {
+			t.Errorf("Expected a cross-region warning for %s %s, got %+v", res.Type, res.Name, res.Warnings)
+		}
+	}
+	regionalS3.AssertExpectations(t)
+	regionalECR.AssertExpectations(t)
+	sessionS3.AssertNotCalled(t, "HeadBucket", mock.Anything, mock.Anything)
+	sessionECR.AssertNotCalled(t, "DescribeRepositories", mock.Anything, mock.Anything)
+}
+
+// TestS3BucketVersioning tests that versioning on an existing bucket is only written when it differs
+func TestS3BucketVersioning(t *testing.T) {
+	tests := []struct {
+		name       string
+		versioning string
+		current    types.BucketVersioningStatus
+		want       types.BucketVersioningStatus // empty when no write is expected
+	}{
+		{name: "enable", versioning: "enabled", current: types.BucketVersioningStatusSuspended, want: types.BucketVersioningStatusEnabled},
+		{name: "suspend", versioning: "suspended", current: types.BucketVersioningStatusEnabled, want: types.BucketVersioningStatusSuspended},
+		{name: "already enabled", versioning: "enabled", current: types.BucketVersioningStatusEnabled},
+		{name: "never enabled counts as suspended", versioning: "suspended", current: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3Client := new(MockS3Client)
+			mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+			mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+				LocationConstraint: types.BucketLocationConstraintUsWest2,
+			}, nil)
+			mockS3Client.On("GetBucketVersioning", mock.Anything, mock.Anything).Return(&s3.GetBucketVersioningOutput{Status: tt.current}, nil)
+			if tt.want != "" {
+				mockS3Client.On("PutBucketVersioning", mock.Anything, mock.MatchedBy(func(input *s3.PutBucketVersioningInput) bool {
+					return input.VersioningConfiguration.Status == tt.want
+				})).Return(&s3.PutBucketVersioningOutput{}, nil)
+			}
+
+			bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+			results, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{
+				{Name: "test-bucket", Versioning: tt.versioning},
+			})
+			if err != nil {
+				t.Fatalf("Failed to reconcile bucket: %v", err)
+			}
+
+			wantAction := bootstrap.ActionUnchanged
+			if tt.want != "" {
+				wantAction = bootstrap.ActionUpdated
+			} else {
+				mockS3Client.AssertNotCalled(t, "PutBucketVersioning", mock.Anything, mock.Anything)
+			}
+			if results[0].Action != wantAction {
+				t.Errorf("Expected action %s, got %s", wantAction, results[0].Action)
+			}
+			mockS3Client.AssertExpectations(t)
+		})
+	}
+}
+
+// TestS3BucketAccelerationAndRequestPayer tests that transfer acceleration and the request
+// payer of an existing bucket are only written when they differ from the configuration
+func TestS3BucketAccelerationAndRequestPayer(t *testing.T) {
+	enabled := true
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+	mockS3Client.On("GetBucketAccelerateConfiguration", mock.Anything, mock.Anything).Return(&s3.GetBucketAccelerateConfigurationOutput{}, nil)
+	mockS3Client.On("PutBucketAccelerateConfiguration", mock.Anything, mock.MatchedBy(func(input *s3.PutBucketAccelerateConfigurationInput) bool {
+		return input.AccelerateConfiguration.Status == types.BucketAccelerateStatusEnabled
+	})).Return(&s3.PutBucketAccelerateConfigurationOutput{}, nil)
+	mockS3Client.On("GetBucketRequestPayment", mock.Anything, mock.Anything).Return(&s3.GetBucketRequestPaymentOutput{Payer: types.PayerRequester}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	results, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{
+		{Name: "uploads-bucket", TransferAcceleration: &enabled, RequestPayer: "Requester"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to reconcile bucket: %v", err)
+	}
+
+	if results[0].Action != bootstrap.ActionUpdated {
+		t.Errorf("Expected action %s, got %s", bootstrap.ActionUpdated, results[0].Action)
+	}
+	mockS3Client.AssertNotCalled(t, "PutBucketRequestPayment", mock.Anything, mock.Anything)
+	mockS3Client.AssertExpectations(t)
+}
+
+// TestS3BucketVersioningUnset tests that an empty versioning setting leaves the bucket alone
+func TestS3BucketVersioningUnset(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	if _, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{{Name: "test-bucket"}}); err != nil {
+		t.Fatalf("Failed to reconcile bucket: %v", err)
+	}
+
+	mockS3Client.AssertNotCalled(t, "GetBucketVersioning", mock.Anything, mock.Anything)
+	mockS3Client.AssertNotCalled(t, "PutBucketVersioning", mock.Anything, mock.Anything)
+}
+
+// TestS3BucketReplication tests that replication enables source versioning first and warns
+// about a destination in the same config that is not versioned
+func TestS3BucketReplication(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+	mockS3Client.On("GetBucketVersioning", mock.Anything, mock.Anything).Return(&s3.GetBucketVersioningOutput{}, nil)
+	mockS3Client.On("PutBucketVersioning", mock.Anything, mock.MatchedBy(func(input *s3.PutBucketVersioningInput) bool {
+		return aws.ToString(input.Bucket) == "source-bucket" &&
+			input.VersioningConfiguration.Status == types.BucketVersioningStatusEnabled
+	})).Return(&s3.PutBucketVersioningOutput{}, nil)
+	mockS3Client.On("GetBucketReplication", mock.Anything, mock.Anything).Return((*s3.GetBucketReplicationOutput)(nil),
+		&smithy.GenericAPIError{Code: "ReplicationConfigurationNotFoundError"})
+	mockS3Client.On("PutBucketReplication", mock.Anything, mock.MatchedBy(func(input *s3.PutBucketReplicationInput) bool {
+		rules := input.ReplicationConfiguration.Rules
+		return aws.ToString(input.Bucket) == "source-bucket" && len(rules) == 2 &&
+			aws.ToString(rules[1].Filter.Prefix) == "reports/" && aws.ToInt32(rules[1].Priority) == 2 &&
+			aws.ToString(rules[0].Destination.Bucket) == "arn:aws:s3:::replica-bucket"
+	})).Return(&s3.PutBucketReplicationOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	results, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{
+		{Name: "source-bucket", Replication: &bootstrap.S3Replication{
+			Role:              "arn:aws:iam::123456789012:role/replication",
+			DestinationBucket: "arn:aws:s3:::replica-bucket",
+			Prefixes:          []string{"uploads/", "reports/"},
+		}},
+		{Name: "replica-bucket"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to reconcile buckets: %v", err)
+	}
+
+	if results[0].Action != bootstrap.ActionUpdated {
+		t.Errorf("Expected source bucket to be updated, got %s", results[0].Action)
+	}
+	if len(results[0].Warnings) != 1 || !strings.Contains(results[0].Warnings[0].Message, "replica-bucket, which does not have versioning enabled") {
+		t.Errorf("Expected a warning about the unversioned destination, got %v", results[0].Warnings)
+	}
+	mockS3Client.AssertExpectations(t)
+}
+
+// TestS3BucketNotificationsPermissionWarning tests that a destination S3 cannot publish to
+// is reported as a warning naming the missing permission
+func TestS3BucketNotificationsPermissionWarning(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+	mockS3Client.On("GetBucketNotificationConfiguration", mock.Anything, mock.Anything).Return(&s3.GetBucketNotificationConfigurationOutput{}, nil)
+	mockS3Client.On("PutBucketNotificationConfiguration", mock.Anything, mock.MatchedBy(func(input *s3.PutBucketNotificationConfigurationInput) bool {
+		queues := input.NotificationConfiguration.QueueConfigurations
+		return len(queues) == 1 && aws.ToString(queues[0].QueueArn) == "arn:aws:sqs:us-west-2:123456789012:uploads" &&
+			len(queues[0].Filter.Key.FilterRules) == 1 && queues[0].Events[0] == types.Event("s3:ObjectCreated:*")
+	})).Return((*s3.PutBucketNotificationConfigurationOutput)(nil),
+		&smithy.GenericAPIError{Code: "InvalidArgument", Message: "Unable to validate the following destination configurations"})
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	results, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{
+		{Name: "test-bucket", Notifications: []bootstrap.S3Notification{
+			{Queue: "arn:aws:sqs:us-west-2:123456789012:uploads", Events: []string{"s3:ObjectCreated:*"}, Prefix: "uploads/"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to reconcile bucket: %v", err)
+	}
+
+	if len(results[0].Warnings) != 1 || !strings.Contains(results[0].Warnings[0].Message, "does not grant s3.amazonaws.com permission to publish") {
+		t.Errorf("Expected a permission warning, got %v", results[0].Warnings)
+	}
+	mockS3Client.AssertExpectations(t)
+}
+
+// TestProvisionCollectsStructuredWarnings tests that a warning records the resource, the
+// AWS operation that failed and the underlying error, and can be looked up after the run
+func TestProvisionCollectsStructuredWarnings(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+	mockS3Client.On("GetBucketTagging", mock.Anything, mock.Anything).Return((*s3.GetBucketTaggingOutput)(nil), &smithy.GenericAPIError{Code: "NoSuchTagSet"})
+	accessDenied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+	mockS3Client.On("PutBucketTagging", mock.Anything, mock.Anything).Return((*s3.PutBucketTaggingOutput)(nil),
+		&smithy.OperationError{ServiceID: "S3", OperationName: "PutBucketTagging", Err: accessDenied})
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	result, err := bootstrapper.ProvisionResources(context.Background(), &bootstrap.Config{
+		Region:    "us-west-2",
+		S3Buckets: []bootstrap.S3Bucket{{Name: "tagged-bucket", Tags: map[string]string{"team": "platform"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to provision: %v", err)
+	}
+
+	warnings := result.WarningsFor(bootstrap.ResourceTypeS3, "tagged-bucket")
+	if len(warnings) != 1 || len(result.Warnings()) != 1 {
+		t.Fatalf("Expected one warning, got %+v", result.Warnings())
+	}
+	warning := warnings[0]
+	if warning.Type != bootstrap.ResourceTypeS3 || warning.Name != "tagged-bucket" || warning.Operation != "PutBucketTagging" {
+		t.Errorf("Expected the warning to name the bucket and the failed operation, got %+v", warning)
+	}
+	var apiErr smithy.APIError
+	if !errors.As(warning.Err, &apiErr) || apiErr.ErrorCode() != "AccessDenied" {
+		t.Errorf("Expected the underlying AccessDenied error, got %v", warning.Err)
+	}
+	if !strings.Contains(warning.Message, "failed to set tags for bucket tagged-bucket") {
+		t.Errorf("Unexpected warning message %q", warning.Message)
+	}
+}
+
+// TestProvisionDependencyOrder tests that a replication destination is provisioned before
+// the bucket replicating to it, and that a reference cycle is reported with its chain
+func TestProvisionDependencyOrder(t *testing.T) {
+	replicateTo := func(name string) *bootstrap.S3Replication {
+		return &bootstrap.S3Replication{Role: "arn:aws:iam::123456789012:role/replication", DestinationBucket: "arn:aws:s3:::" + name}
+	}
+
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+	mockS3Client.On("GetBucketVersioning", mock.Anything, mock.Anything).Return(&s3.GetBucketVersioningOutput{
+		Status: types.BucketVersioningStatusEnabled,
+	}, nil)
+	mockS3Client.On("GetBucketReplication", mock.Anything, mock.Anything).Return((*s3.GetBucketReplicationOutput)(nil),
+		&smithy.GenericAPIError{Code: "ReplicationConfigurationNotFoundError"})
+	mockS3Client.On("PutBucketReplication", mock.Anything, mock.Anything).Return(&s3.PutBucketReplicationOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	result, err := bootstrapper.ProvisionResources(context.Background(), &bootstrap.Config{
+		Region: "us-west-2",
+		S3Buckets: []bootstrap.S3Bucket{
+			{Name: "source-bucket", Replication: replicateTo("replica-bucket")},
+			{Name: "replica-bucket", Versioning: "enabled"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to provision: %v", err)
+	}
+	if len(result.Resources) != 2 || result.Resources[0].Name != "replica-bucket" || result.Resources[1].Name != "source-bucket" {
+		t.Errorf("Expected replica-bucket to be provisioned first, got %+v", result.Resources)
+	}
+
+	cyclic := new(MockS3Client)
+	bootstrapper = bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: cyclic})
+	_, err = bootstrapper.ProvisionResources(context.Background(), &bootstrap.Config{
+		Region: "us-west-2",
+		S3Buckets: []bootstrap.S3Bucket{
+			{Name: "bucket-a", Replication: replicateTo("bucket-b")},
+			{Name: "bucket-b", Replication: replicateTo("bucket-a")},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "dependency cycle: s3:bucket-a -> s3:bucket-b -> s3:bucket-a") {
+		t.Errorf("Expected a dependency cycle error, got %v", err)
+	}
+	cyclic.AssertNotCalled(t, "HeadBucket", mock.Anything, mock.Anything)
+}
+
+// TestProvisionPreflight tests that problems later resources would run into are all
+// reported before the first resource is created
+func TestProvisionPreflight(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.MatchedBy(func(input *s3.HeadBucketInput) bool {
+		return aws.ToString(input.Bucket) == "new-bucket"
+	})).Return((*s3.HeadBucketOutput)(nil), &types.NotFound{})
+	mockS3Client.On("HeadBucket", mock.Anything, mock.MatchedBy(func(input *s3.HeadBucketInput) bool {
+		return aws.ToString(input.Bucket) == "taken-bucket"
+	})).Return((*s3.HeadBucketOutput)(nil), &smithy.GenericAPIError{Code: "Forbidden"})
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	_, err := bootstrapper.ProvisionResources(context.Background(), &bootstrap.Config{
+		Region:    "us-west-2",
+		S3Buckets: []bootstrap.S3Bucket{{Name: "new-bucket"}, {Name: "taken-bucket"}},
+		LambdaFunctions: []bootstrap.LambdaFunction{{
+			Name: "worker", Runtime: "python3.12", Handler: "app.handler", Role: "arn:aws:iam::123456789012:role/worker",
+			ZipFile: filepath.Join(t.TempDir(), "missing.zip"),
+		}},
+	})
+	if err == nil {
+		t.Fatal("Expected preflight checks to fail")
+	}
+	for _, expected := range []string{
+		"preflight checks failed, nothing was changed",
+		"Lambda function worker: failed to read zip file",
+		"taken-bucket",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to contain %q, got:\n%v", expected, err)
+		}
+	}
+	mockS3Client.AssertNotCalled(t, "CreateBucket", mock.Anything, mock.Anything)
+}
+
+// TestDeleteS3BucketsEmptiesVersions tests that every object version and delete marker is
+// removed before a bucket is deleted, across pages and in batches of at most 1000
+func TestDeleteS3BucketsEmptiesVersions(t *testing.T) {
+	versions := func(prefix string, n int) []types.ObjectVersion {
+		var out []types.ObjectVersion
+		for i := 0; i < n; i++ {
+			out = append(out, types.ObjectVersion{Key: aws.String(fmt.Sprintf("%s-%d", prefix, i)), VersionId: aws.String("v1")})
+		}
+		return out
+	}
+	var markers []types.DeleteMarkerEntry
+	for i := 0; i < 300; i++ {
+		markers = append(markers, types.DeleteMarkerEntry{Key: aws.String(fmt.Sprintf("deleted-%d", i)), VersionId: aws.String("m1")})
+	}
+
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("ListObjectVersions", mock.Anything, mock.MatchedBy(func(input *s3.ListObjectVersionsInput) bool {
+		return input.KeyMarker == nil
+	})).Return(&s3.ListObjectVersionsOutput{
+		Versions:            versions("first", 900),
+		DeleteMarkers:       markers,
+		IsTruncated:         aws.Bool(true),
+		NextKeyMarker:       aws.String("first-899"),
+		NextVersionIdMarker: aws.String("v1"),
+	}, nil)
+	mockS3Client.On("ListObjectVersions", mock.Anything, mock.MatchedBy(func(input *s3.ListObjectVersionsInput) bool {
+		return aws.ToString(input.KeyMarker) == "first-899"
+	})).Return(&s3.ListObjectVersionsOutput{Versions: versions("second", 10)}, nil)
+
+	var batches []int
+	mockS3Client.On("DeleteObjects", mock.Anything, mock.MatchedBy(func(input *s3.DeleteObjectsInput) bool {
+		batches = append(batches, len(input.Delete.Objects))
+		return true
+	})).Return(&s3.DeleteObjectsOutput{}, nil)
+	mockS3Client.On("DeleteBucket", mock.Anything, mock.Anything).Return(&s3.DeleteBucketOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	if err := bootstrapper.DeleteS3Buckets(context.Background(), []bootstrap.S3Bucket{{Name: "versioned-bucket"}}); err != nil {
+		t.Fatalf("Failed to delete bucket: %v", err)
+	}
+
+	if !reflect.DeepEqual(batches, []int{1000, 200, 10}) {
+		t.Errorf("Expected delete batches of 1000, 200 and 10 objects, got %v", batches)
+	}
+	mockS3Client.AssertExpectations(t)
+}
+
+// TestProvisionSkipsDisabledResources tests that resources with enabled: false are left alone
+func TestProvisionSkipsDisabledResources(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.MatchedBy(func(input *s3.HeadBucketInput) bool {
+		return aws.ToString(input.Bucket) == "enabled-bucket"
+	})).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	result, err := bootstrapper.ProvisionResources(context.Background(), &bootstrap.Config{
+		Region: "us-west-2",
+		S3Buckets: []bootstrap.S3Bucket{
+			{Name: "disabled-bucket", Enabled: aws.Bool(false)},
+			{Name: "enabled-bucket", Enabled: aws.Bool(true)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to provision: %v", err)
+	}
+	if len(result.Resources) != 1 || result.Resources[0].Name != "enabled-bucket" {
+		t.Errorf("Expected only enabled-bucket to be provisioned, got %+v", result.Resources)
+	}
+	mockS3Client.AssertExpectations(t)
+}
+
+// TestProvisionIncremental tests that an incremental run only provisions the resources
+// whose configuration changed since the run recorded in the state
+func TestProvisionIncremental(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+
+	config := &bootstrap.Config{
+		Region:    "us-west-2",
+		S3Buckets: []bootstrap.S3Bucket{{Name: "bucket-a"}, {Name: "bucket-b"}},
+	}
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	first, err := bootstrapper.ProvisionResources(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Failed to provision: %v", err)
+	}
+	state := &bootstrap.State{Version: 1}
+	state.Record(first, time.Now())
+
+	// bucket-b changes and bucket-c is new; bucket-a is left as it was
+	config.S3Buckets = []bootstrap.S3Bucket{{Name: "bucket-a"}, {Name: "bucket-b", Versioning: "suspended"}, {Name: "bucket-c"}}
+	mockS3Client.On("GetBucketVersioning", mock.Anything, mock.Anything).Return(&s3.GetBucketVersioningOutput{
+		Status: types.BucketVersioningStatusSuspended,
+	}, nil)
+
+	incremental := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	incremental.SetIncremental(state.ConfigHashes())
+	second, err := incremental.ProvisionResources(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Failed to provision incrementally: %v", err)
+	}
+	if second.Skipped != 1 || len(second.Resources) != 2 ||
+		second.Resources[0].Name != "bucket-b" || second.Resources[1].Name != "bucket-c" {
+		t.Errorf("Expected only bucket-b and bucket-c to be provisioned, got %d skipped and %+v", second.Skipped, second.Resources)
+	}
+}
+
+// TestProvisionResourceRoles tests that resource types with a role in resource_roles are
+// provisioned with that role's clients, and other types with the session's own
+func TestProvisionResourceRoles(t *testing.T) {
+	sessionS3Client := new(MockS3Client)
+	roleS3Client := new(MockS3Client)
+	roleS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	roleS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+
+	config := &bootstrap.Config{
+		Region:    "us-west-2",
+		S3Buckets: []bootstrap.S3Bucket{{Name: "storage-bucket"}},
+		ResourceRoles: map[string]bootstrap.ResourceRole{
+			"s3": {Account: "222222222222", RoleName: "StorageAdmin"},
+		},
+	}
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: sessionS3Client})
+	bootstrapper.SetRoleClients("arn:aws:iam::222222222222:role/StorageAdmin", bootstrap.Clients{S3: roleS3Client})
+
+	result, err := bootstrapper.ProvisionResources(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Failed to provision: %v", err)
+	}
+	if len(result.Resources) != 1 || result.Resources[0].Action != bootstrap.ActionUnchanged {
+		t.Errorf("Expected storage-bucket to be unchanged, got %+v", result.Resources)
+	}
+	roleS3Client.AssertCalled(t, "HeadBucket", mock.Anything, mock.Anything)
+	sessionS3Client.AssertNotCalled(t, "HeadBucket", mock.Anything, mock.Anything)
+}
+
+// TestProvisionContinueOnError tests that failed resources are collected instead of stopping
+// the run, until more of them fail than the limit allows
+func TestProvisionContinueOnError(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxErrors   int
+		wantResults int
+		wantErr     string
+	}{
+		{name: "no limit", maxErrors: 0, wantResults: 3, wantErr: "2 resource(s) failed to provision"},
+		{name: "limit exceeded", maxErrors: 1, wantResults: 2, wantErr: "stopped after 2 resources failed, more than the limit of 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockS3Client := new(MockS3Client)
+			mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+			// Buckets in another region fail; the last bucket is in the configured one
+			mockS3Client.On("GetBucketLocation", mock.Anything, mock.MatchedBy(func(input *s3.GetBucketLocationInput) bool {
+				return aws.ToString(input.Bucket) != "good-bucket"
+			})).Return(&s3.GetBucketLocationOutput{LocationConstraint: types.BucketLocationConstraintEuWest1}, nil)
+			mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+				LocationConstraint: types.BucketLocationConstraintUsWest2,
+			}, nil)
+
+			bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+			bootstrapper.SetContinueOnError(true, tt.maxErrors)
+			result, err := bootstrapper.ProvisionResources(context.Background(), &bootstrap.Config{
+				Region: "us-west-2",
+				S3Buckets: []bootstrap.S3Bucket{
+					{Name: "first-bucket"},
+					{Name: "second-bucket"},
+					{Name: "good-bucket"},
+				},
+			})
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+			// Every collected failure is reported, not just the last one
+			if !strings.Contains(err.Error(), "first-bucket") || !strings.Contains(err.Error(), "second-bucket") {
+				t.Errorf("Expected both failures in the error, got %v", err)
+			}
+			if len(result.Resources) != tt.wantResults {
+				t.Errorf("Expected %d results, got %+v", tt.wantResults, result.Resources)
+			}
+			if len(result.Failed()) != 2 {
+				t.Errorf("Expected 2 failed resources, got %+v", result.Failed())
+			}
+		})
+	}
+}
+
+// TestProvisionResourceTimeout tests that a resource running past its timeout fails with an
+// error naming it, and that continue-on-error goes on with the next resource
+func TestProvisionResourceTimeout(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	// The slow bucket's lookup only returns once its context expires
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.MatchedBy(func(input *s3.GetBucketLocationInput) bool {
+		return aws.ToString(input.Bucket) == "slow-bucket"
+	})).Run(func(args mock.Arguments) {
+		<-args.Get(0).(context.Context).Done()
+	}).Return((*s3.GetBucketLocationOutput)(nil), context.DeadlineExceeded)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	bootstrapper.SetContinueOnError(true, 0)
+	result, err := bootstrapper.ProvisionResources(context.Background(), &bootstrap.Config{
+		Region:    "us-west-2",
+		Timeouts:  map[string]string{"s3": "1m", "s3:slow-bucket": "10ms"},
+		S3Buckets: []bootstrap.S3Bucket{{Name: "slow-bucket"}, {Name: "fast-bucket"}},
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "s3 slow-bucket timed out after 10ms") {
+		t.Fatalf("Expected the slow bucket to time out, got %v", err)
+	}
+	if len(result.Resources) != 2 || len(result.Failed()) != 1 || result.Resources[1].Error != nil {
+		t.Errorf("Expected only the slow bucket to fail, got %+v", result.Resources)
+	}
+}
+
+// TestS3BucketOwnership tests that the ownership of an existing bucket is reconciled before
+// its ACL is applied
+func TestS3BucketOwnership(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+	mockS3Client.On("GetBucketOwnershipControls", mock.Anything, mock.Anything).Return(&s3.GetBucketOwnershipControlsOutput{
+		OwnershipControls: &types.OwnershipControls{
+			Rules: []types.OwnershipControlsRule{{ObjectOwnership: types.ObjectOwnershipBucketOwnerEnforced}},
+		},
+	}, nil)
+	putOwnership := mockS3Client.On("PutBucketOwnershipControls", mock.Anything, mock.MatchedBy(func(input *s3.PutBucketOwnershipControlsInput) bool {
+		return input.OwnershipControls.Rules[0].ObjectOwnership == types.ObjectOwnershipBucketOwnerPreferred
+	})).Return(&s3.PutBucketOwnershipControlsOutput{}, nil)
+	mockS3Client.On("GetBucketAcl", mock.Anything, mock.Anything).Return(&s3.GetBucketAclOutput{}, nil)
+	mockS3Client.On("PutBucketAcl", mock.Anything, mock.MatchedBy(func(input *s3.PutBucketAclInput) bool {
+		return input.ACL == types.BucketCannedACLPublicRead
+	})).Return(&s3.PutBucketAclOutput{}, nil).NotBefore(putOwnership)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	results, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{
+		{Name: "log-bucket", ObjectOwnership: "BucketOwnerPreferred", ACL: "public-read"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to reconcile bucket: %v", err)
+	}
+
+	if results[0].Action != bootstrap.ActionUpdated || len(results[0].Warnings) != 0 {
+		t.Errorf("Expected bucket to be updated without warnings, got %+v", results[0])
+	}
+	mockS3Client.AssertExpectations(t)
+}
+
+// TestS3BucketMatchingConfigUnchanged tests that an existing bucket whose settings already
+// match the configuration is reported as unchanged, without any writes
+func TestS3BucketMatchingConfigUnchanged(t *testing.T) {
+	policy := `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:*","Resource":"arn:aws:s3:::site-bucket/*","Condition":{"Bool":{"aws:SecureTransport":"false"}}}]}`
+
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+	mockS3Client.On("GetBucketAcl", mock.Anything, mock.Anything).Return(&s3.GetBucketAclOutput{
+		Owner: &types.Owner{ID: aws.String("owner")},
+		Grants: []types.Grant{
+			{Grantee: &types.Grantee{Type: types.TypeCanonicalUser, ID: aws.String("owner")}, Permission: types.PermissionFullControl},
+			{Grantee: &types.Grantee{Type: types.TypeGroup, URI: aws.String("http://acs.amazonaws.com/groups/global/AllUsers")}, Permission: types.PermissionRead},
+		},
+	}, nil)
+	mockS3Client.On("GetBucketTagging", mock.Anything, mock.Anything).Return(&s3.GetBucketTaggingOutput{
+		TagSet: []types.Tag{{Key: aws.String("Team"), Value: aws.String("web")}},
+	}, nil)
+	mockS3Client.On("GetBucketEncryption", mock.Anything, mock.Anything).Return(&s3.GetBucketEncryptionOutput{
+		ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{Rules: []types.ServerSideEncryptionRule{{
+			ApplyServerSideEncryptionByDefault: &types.ServerSideEncryptionByDefault{SSEAlgorithm: types.ServerSideEncryptionAes256},
+			BucketKeyEnabled:                   aws.Bool(false),
+		}}},
+	}, nil)
+	mockS3Client.On("GetBucketCors", mock.Anything, mock.Anything).Return(&s3.GetBucketCorsOutput{
+		CORSRules: []types.CORSRule{{AllowedMethods: []string{"GET"}, AllowedOrigins: []string{"*"}}},
+	}, nil)
+	mockS3Client.On("GetBucketLifecycleConfiguration", mock.Anything, mock.Anything).Return(&s3.GetBucketLifecycleConfigurationOutput{
+		Rules: []types.LifecycleRule{{
+			ID:         aws.String("expire-logs"),
+			Status:     types.ExpirationStatusEnabled,
+			Filter:     &types.LifecycleRuleFilter{Prefix: aws.String("logs/")},
+			Expiration: &types.LifecycleExpiration{Days: aws.Int32(30)},
+		}},
+	}, nil)
+	mockS3Client.On("GetBucketPolicy", mock.Anything, mock.Anything).Return(&s3.GetBucketPolicyOutput{Policy: aws.String(policy)}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	results, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{{
+		Name:           "site-bucket",
+		ACL:            "public-read",
+		Tags:           map[string]string{"Team": "web"},
+		Encryption:     "AES256",
+		CORS:           bootstrap.CORSRules{{AllowedMethods: []string{"get"}, AllowedOrigins: []string{"*"}}},
+		LifecycleRules: []bootstrap.S3LifecycleRule{{ID: "expire-logs", Prefix: "logs/", ExpirationDays: 30}},
+		Policy:         policy,
+	}})
+	if err != nil {
+		t.Fatalf("Failed to reconcile bucket: %v", err)
+	}
+	if results[0].Action != bootstrap.ActionUnchanged || len(results[0].Warnings) != 0 {
+		t.Errorf("Expected the bucket to be unchanged, got %+v", results[0])
+	}
+	for _, method := range []string{"PutBucketAcl", "PutBucketTagging", "PutBucketEncryption", "PutBucketCors", "PutBucketLifecycleConfiguration", "PutBucketPolicy"} {
+		mockS3Client.AssertNotCalled(t, method, mock.Anything, mock.Anything)
+	}
+}
+
+// TestS3BucketImportRemovesUnconfiguredSettings tests that adopting an existing bucket
+// removes the settings present on it that the configuration leaves out, and only those
+func TestS3BucketImportRemovesUnconfiguredSettings(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+	mockS3Client.On("GetBucketPolicy", mock.Anything, mock.Anything).Return(&s3.GetBucketPolicyOutput{
+		Policy: aws.String(`{"Version":"2012-10-17","Statement":[]}`),
+	}, nil)
+	mockS3Client.On("DeleteBucketPolicy", mock.Anything, mock.Anything).Return(&s3.DeleteBucketPolicyOutput{}, nil)
+	mockS3Client.On("GetBucketCors", mock.Anything, mock.Anything).Return(&s3.GetBucketCorsOutput{
+		CORSRules: []types.CORSRule{{AllowedMethods: []string{"GET"}, AllowedOrigins: []string{"*"}}},
+	}, nil)
+	mockS3Client.On("DeleteBucketCors", mock.Anything, mock.Anything).Return(&s3.DeleteBucketCorsOutput{}, nil)
+	mockS3Client.On("GetBucketLifecycleConfiguration", mock.Anything, mock.Anything).Return(
+		(*s3.GetBucketLifecycleConfigurationOutput)(nil), &smithy.GenericAPIError{Code: "NoSuchLifecycleConfiguration"})
+	mockS3Client.On("GetBucketReplication", mock.Anything, mock.Anything).Return(
+		(*s3.GetBucketReplicationOutput)(nil), &smithy.GenericAPIError{Code: "ReplicationConfigurationNotFoundError"})
+	mockS3Client.On("GetBucketNotificationConfiguration", mock.Anything, mock.Anything).Return(&s3.GetBucketNotificationConfigurationOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{S3: mockS3Client})
+	bootstrapper.SetImport(true)
+	results, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{{Name: "legacy-bucket"}})
+	if err != nil {
+		t.Fatalf("Failed to import bucket: %v", err)
+	}
+
+	if results[0].Action != bootstrap.ActionUpdated || len(results[0].Warnings) != 0 {
+		t.Errorf("Expected bucket to be updated without warnings, got %+v", results[0])
+	}
 	mockS3Client.AssertExpectations(t)
-	*/
+	mockS3Client.AssertNotCalled(t, "DeleteBucketLifecycle", mock.Anything, mock.Anything)
+	mockS3Client.AssertNotCalled(t, "DeleteBucketReplication", mock.Anything, mock.Anything)
+	mockS3Client.AssertNotCalled(t, "PutBucketNotificationConfiguration", mock.Anything, mock.Anything)
 }
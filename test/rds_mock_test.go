@@ -0,0 +1,676 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdstypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
+)
+
+// MockRDSClient is a mock implementation of the RDS client
+type MockRDSClient struct {
+	mock.Mock
+}
+
+func (m *MockRDSClient) DescribeDBInstances(ctx context.Context, params *rds.DescribeDBInstancesInput, optFns ...func(*rds.Options)) (*rds.DescribeDBInstancesOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.DescribeDBInstancesOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) CreateDBInstance(ctx context.Context, params *rds.CreateDBInstanceInput, optFns ...func(*rds.Options)) (*rds.CreateDBInstanceOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.CreateDBInstanceOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) ModifyDBInstance(ctx context.Context, params *rds.ModifyDBInstanceInput, optFns ...func(*rds.Options)) (*rds.ModifyDBInstanceOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.ModifyDBInstanceOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) DeleteDBInstance(ctx context.Context, params *rds.DeleteDBInstanceInput, optFns ...func(*rds.Options)) (*rds.DeleteDBInstanceOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.DeleteDBInstanceOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) StopDBInstance(ctx context.Context, params *rds.StopDBInstanceInput, optFns ...func(*rds.Options)) (*rds.StopDBInstanceOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.StopDBInstanceOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) StartDBInstance(ctx context.Context, params *rds.StartDBInstanceInput, optFns ...func(*rds.Options)) (*rds.StartDBInstanceOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.StartDBInstanceOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) DescribeDBSubnetGroups(ctx context.Context, params *rds.DescribeDBSubnetGroupsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBSubnetGroupsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.DescribeDBSubnetGroupsOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) CreateDBSubnetGroup(ctx context.Context, params *rds.CreateDBSubnetGroupInput, optFns ...func(*rds.Options)) (*rds.CreateDBSubnetGroupOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.CreateDBSubnetGroupOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) DescribeDBParameterGroups(ctx context.Context, params *rds.DescribeDBParameterGroupsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBParameterGroupsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.DescribeDBParameterGroupsOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) CreateDBParameterGroup(ctx context.Context, params *rds.CreateDBParameterGroupInput, optFns ...func(*rds.Options)) (*rds.CreateDBParameterGroupOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.CreateDBParameterGroupOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) ModifyDBParameterGroup(ctx context.Context, params *rds.ModifyDBParameterGroupInput, optFns ...func(*rds.Options)) (*rds.ModifyDBParameterGroupOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.ModifyDBParameterGroupOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) DescribeDBParameters(ctx context.Context, params *rds.DescribeDBParametersInput, optFns ...func(*rds.Options)) (*rds.DescribeDBParametersOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.DescribeDBParametersOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) DescribeEngineDefaultParameters(ctx context.Context, params *rds.DescribeEngineDefaultParametersInput, optFns ...func(*rds.Options)) (*rds.DescribeEngineDefaultParametersOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.DescribeEngineDefaultParametersOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) DescribeDBClusters(ctx context.Context, params *rds.DescribeDBClustersInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClustersOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.DescribeDBClustersOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) CreateDBCluster(ctx context.Context, params *rds.CreateDBClusterInput, optFns ...func(*rds.Options)) (*rds.CreateDBClusterOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.CreateDBClusterOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) ModifyDBCluster(ctx context.Context, params *rds.ModifyDBClusterInput, optFns ...func(*rds.Options)) (*rds.ModifyDBClusterOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.ModifyDBClusterOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) AddTagsToResource(ctx context.Context, params *rds.AddTagsToResourceInput, optFns ...func(*rds.Options)) (*rds.AddTagsToResourceOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.AddTagsToResourceOutput), args.Error(1)
+}
+
+func (m *MockRDSClient) RemoveTagsFromResource(ctx context.Context, params *rds.RemoveTagsFromResourceInput, optFns ...func(*rds.Options)) (*rds.RemoveTagsFromResourceOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*rds.RemoveTagsFromResourceOutput), args.Error(1)
+}
+
+// MockSecretsManagerClient is a mock implementation of the Secrets Manager client
+type MockSecretsManagerClient struct {
+	mock.Mock
+}
+
+func (m *MockSecretsManagerClient) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*secretsmanager.GetSecretValueOutput), args.Error(1)
+}
+
+func (m *MockSecretsManagerClient) CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*secretsmanager.CreateSecretOutput), args.Error(1)
+}
+
+func (m *MockSecretsManagerClient) PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*secretsmanager.PutSecretValueOutput), args.Error(1)
+}
+
+// existingDBInstance is an instance that already matches testDBInstance, in the given status
+func existingDBInstance(status string) *rds.DescribeDBInstancesOutput {
+	return &rds.DescribeDBInstancesOutput{DBInstances: []rdstypes.DBInstance{{
+		DBInstanceIdentifier: aws.String("dev-db"),
+		DBInstanceArn:        aws.String("arn:aws:rds:us-west-2:123456789012:db:dev-db"),
+		DBInstanceStatus:     aws.String(status),
+		DBInstanceClass:      aws.String("db.t3.micro"),
+		AllocatedStorage:     aws.Int32(20),
+	}}}
+}
+
+// testDBInstance is a single-AZ instance kept in the desired state
+func testDBInstance(desiredState string) bootstrap.RDSInstance {
+	return bootstrap.RDSInstance{
+		Identifier:       "dev-db",
+		Engine:           "postgres",
+		InstanceClass:    "db.t3.micro",
+		AllocatedStorage: 20,
+		DesiredState:     desiredState,
+	}
+}
+
+// TestRDSInstanceDesiredStateStops tests that an available instance with desired_state
+// stopped is stopped, with a warning that RDS restarts it after 7 days
+func TestRDSInstanceDesiredStateStops(t *testing.T) {
+	mockRDSClient := new(MockRDSClient)
+	mockRDSClient.On("DescribeDBInstances", mock.Anything, mock.Anything).Return(existingDBInstance("available"), nil)
+	mockRDSClient.On("StopDBInstance", mock.Anything, mock.MatchedBy(func(input *rds.StopDBInstanceInput) bool {
+		return aws.ToString(input.DBInstanceIdentifier) == "dev-db"
+	})).Return(&rds.StopDBInstanceOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient})
+	results, err := bootstrapper.ManageRDSInstances(context.Background(), []bootstrap.RDSInstance{testDBInstance("stopped")})
+	if err != nil {
+		t.Fatalf("Failed to stop RDS instance: %v", err)
+	}
+
+	if results[0].Action != bootstrap.ActionUpdated {
+		t.Errorf("Expected instance to be updated, got %+v", results[0])
+	}
+	if len(results[0].Warnings) != 1 || !strings.Contains(results[0].Warnings[0].Message, "7 days") {
+		t.Errorf("Expected a warning about the automatic restart, got %v", results[0].Warnings)
+	}
+	mockRDSClient.AssertNotCalled(t, "StartDBInstance", mock.Anything, mock.Anything)
+	mockRDSClient.AssertExpectations(t)
+}
+
+// TestRDSInstanceDesiredStateStarts tests that a stopped instance with desired_state
+// running is started, and that one already stopped is left alone
+func TestRDSInstanceDesiredStateStarts(t *testing.T) {
+	mockRDSClient := new(MockRDSClient)
+	mockRDSClient.On("DescribeDBInstances", mock.Anything, mock.Anything).Return(existingDBInstance("stopped"), nil)
+	mockRDSClient.On("StartDBInstance", mock.Anything, mock.MatchedBy(func(input *rds.StartDBInstanceInput) bool {
+		return aws.ToString(input.DBInstanceIdentifier) == "dev-db"
+	})).Return(&rds.StartDBInstanceOutput{}, nil).Once()
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient})
+	results, err := bootstrapper.ManageRDSInstances(context.Background(), []bootstrap.RDSInstance{testDBInstance("running")})
+	if err != nil {
+		t.Fatalf("Failed to start RDS instance: %v", err)
+	}
+	if results[0].Action != bootstrap.ActionUpdated {
+		t.Errorf("Expected instance to be updated, got %+v", results[0])
+	}
+
+	results, err = bootstrapper.ManageRDSInstances(context.Background(), []bootstrap.RDSInstance{testDBInstance("stopped")})
+	if err != nil {
+		t.Fatalf("Failed to reconcile stopped RDS instance: %v", err)
+	}
+	if results[0].Action != bootstrap.ActionUnchanged || len(results[0].Warnings) != 0 {
+		t.Errorf("Expected stopped instance to be unchanged, got %+v", results[0])
+	}
+	mockRDSClient.AssertNotCalled(t, "StopDBInstance", mock.Anything, mock.Anything)
+	mockRDSClient.AssertExpectations(t)
+}
+
+// createdMasterPassword creates instance with missing-instance mocks and returns the master
+// password CreateDBInstance was called with
+func createdMasterPassword(t *testing.T, instance bootstrap.RDSInstance, secrets *MockSecretsManagerClient, calls *[]string) string {
+	t.Helper()
+
+	var password string
+	mockRDSClient := new(MockRDSClient)
+	mockRDSClient.On("DescribeDBInstances", mock.Anything, mock.Anything).Return((*rds.DescribeDBInstancesOutput)(nil), &rdstypes.DBInstanceNotFoundFault{})
+	mockRDSClient.On("CreateDBInstance", mock.Anything, mock.Anything).Return(&rds.CreateDBInstanceOutput{}, nil).Run(func(args mock.Arguments) {
+		password = aws.ToString(args.Get(1).(*rds.CreateDBInstanceInput).MasterUserPassword)
+		*calls = append(*calls, "CreateDBInstance")
+	})
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient, SecretsManager: secrets})
+	if _, err := bootstrapper.ManageRDSInstances(context.Background(), []bootstrap.RDSInstance{instance}); err != nil {
+		t.Fatalf("Failed to create RDS instance: %v", err)
+	}
+	return password
+}
+
+// secretPassword returns the password in a secret value written by the bootstrapper
+func secretPassword(t *testing.T, value string) string {
+	t.Helper()
+
+	var secret struct {
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal([]byte(value), &secret); err != nil {
+		t.Fatalf("Failed to parse secret value %q: %v", value, err)
+	}
+	return secret.Password
+}
+
+// TestRDSGeneratedMasterPassword tests that a generated master password fits the engine's
+// length limit, contains every character class and none RDS rejects, and is stored in
+// Secrets Manager before the instance is created
+func TestRDSGeneratedMasterPassword(t *testing.T) {
+	for engine, length := range map[string]int{"postgres": 32, "mysql": 32, "oracle-se2": 30} {
+		t.Run(engine, func(t *testing.T) {
+			var calls []string
+			var stored string
+			mockSecrets := new(MockSecretsManagerClient)
+			mockSecrets.On("CreateSecret", mock.Anything, mock.MatchedBy(func(input *secretsmanager.CreateSecretInput) bool {
+				return aws.ToString(input.Name) == "rds/dev-db/master-password"
+			})).Return(&secretsmanager.CreateSecretOutput{}, nil).Run(func(args mock.Arguments) {
+				stored = aws.ToString(args.Get(1).(*secretsmanager.CreateSecretInput).SecretString)
+				calls = append(calls, "CreateSecret")
+			}).Once()
+
+			instance := testDBInstance("")
+			instance.Engine = engine
+			password := createdMasterPassword(t, instance, mockSecrets, &calls)
+
+			if len(password) != length {
+				t.Errorf("Expected a %d character password, got %d: %q", length, len(password), password)
+			}
+			for _, class := range []string{"abcdefghijklmnopqrstuvwxyz", "ABCDEFGHIJKLMNOPQRSTUVWXYZ", "0123456789", "!#$%^&*()-_=+[]{}:,.?~"} {
+				if !strings.ContainsAny(password, class) {
+					t.Errorf("Expected the password to contain one of %q, got %q", class, password)
+				}
+			}
+			if strings.ContainsAny(password, `/@" `) {
+				t.Errorf("Expected the password to avoid characters RDS rejects, got %q", password)
+			}
+			if got := secretPassword(t, stored); got != password {
+				t.Errorf("Expected the stored password %q to be the one the instance was created with, got %q", password, got)
+			}
+			if !reflect.DeepEqual(calls, []string{"CreateSecret", "CreateDBInstance"}) {
+				t.Errorf("Expected the secret to be written before the instance is created, got %v", calls)
+			}
+			mockSecrets.AssertExpectations(t)
+		})
+	}
+}
+
+// TestRDSGeneratedMasterPasswordExistingSecret tests that a generated password replaces the
+// value of a secret that already exists
+func TestRDSGeneratedMasterPasswordExistingSecret(t *testing.T) {
+	var calls []string
+	var stored string
+	mockSecrets := new(MockSecretsManagerClient)
+	mockSecrets.On("CreateSecret", mock.Anything, mock.Anything).Return((*secretsmanager.CreateSecretOutput)(nil), &smtypes.ResourceExistsException{})
+	mockSecrets.On("PutSecretValue", mock.Anything, mock.MatchedBy(func(input *secretsmanager.PutSecretValueInput) bool {
+		return aws.ToString(input.SecretId) == "rds/dev-db/master-password"
+	})).Return(&secretsmanager.PutSecretValueOutput{}, nil).Run(func(args mock.Arguments) {
+		stored = aws.ToString(args.Get(1).(*secretsmanager.PutSecretValueInput).SecretString)
+		calls = append(calls, "PutSecretValue")
+	}).Once()
+
+	password := createdMasterPassword(t, testDBInstance(""), mockSecrets, &calls)
+	if got := secretPassword(t, stored); got == "" || got != password {
+		t.Errorf("Expected the existing secret to hold the new password %q, got %q", password, got)
+	}
+	if !reflect.DeepEqual(calls, []string{"PutSecretValue", "CreateDBInstance"}) {
+		t.Errorf("Expected the secret to be written before the instance is created, got %v", calls)
+	}
+	mockSecrets.AssertExpectations(t)
+}
+
+// TestRDSMasterPasswordPrecedence tests that a configured master password is used as it is,
+// that master_password_secret is read in plain text or JSON form, and that setting both is
+// rejected
+func TestRDSMasterPasswordPrecedence(t *testing.T) {
+	t.Run("configured password", func(t *testing.T) {
+		mockSecrets := new(MockSecretsManagerClient)
+		instance := testDBInstance("")
+		instance.MasterPassword = "correct-horse-battery"
+		if password := createdMasterPassword(t, instance, mockSecrets, new([]string)); password != "correct-horse-battery" {
+			t.Errorf("Expected the configured password, got %q", password)
+		}
+		mockSecrets.AssertNotCalled(t, "CreateSecret", mock.Anything, mock.Anything)
+		mockSecrets.AssertNotCalled(t, "GetSecretValue", mock.Anything, mock.Anything)
+	})
+
+	for name, value := range map[string]string{"plain secret": "from-the-secret", "JSON secret": `{"username":"admin","password":"from-the-secret"}`} {
+		t.Run(name, func(t *testing.T) {
+			mockSecrets := new(MockSecretsManagerClient)
+			mockSecrets.On("GetSecretValue", mock.Anything, mock.MatchedBy(func(input *secretsmanager.GetSecretValueInput) bool {
+				return aws.ToString(input.SecretId) == "prod/db-password"
+			})).Return(&secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil)
+
+			instance := testDBInstance("")
+			instance.MasterPasswordSecret = "prod/db-password"
+			if password := createdMasterPassword(t, instance, mockSecrets, new([]string)); password != "from-the-secret" {
+				t.Errorf("Expected the password from the secret, got %q", password)
+			}
+			mockSecrets.AssertNotCalled(t, "CreateSecret", mock.Anything, mock.Anything)
+		})
+	}
+
+	t.Run("both set", func(t *testing.T) {
+		mockRDSClient := new(MockRDSClient)
+		mockRDSClient.On("DescribeDBInstances", mock.Anything, mock.Anything).Return((*rds.DescribeDBInstancesOutput)(nil), &rdstypes.DBInstanceNotFoundFault{})
+		instance := testDBInstance("")
+		instance.MasterPassword = "correct-horse-battery"
+		instance.MasterPasswordSecret = "prod/db-password"
+
+		bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient, SecretsManager: new(MockSecretsManagerClient)})
+		_, err := bootstrapper.ManageRDSInstances(context.Background(), []bootstrap.RDSInstance{instance})
+		if err == nil || !strings.Contains(err.Error(), "only one of master_password or master_password_secret") {
+			t.Errorf("Expected both password settings to be rejected, got %v", err)
+		}
+		mockRDSClient.AssertNotCalled(t, "CreateDBInstance", mock.Anything, mock.Anything)
+	})
+}
+
+// TestRDSStorageWaitsForAvailable tests that a storage change on a busy instance is only
+// warned about, while the other settings are still reconciled
+func TestRDSStorageWaitsForAvailable(t *testing.T) {
+	mockRDSClient := new(MockRDSClient)
+	mockRDSClient.On("DescribeDBInstances", mock.Anything, mock.Anything).Return(existingDBInstance("backing-up"), nil)
+	mockRDSClient.On("ModifyDBInstance", mock.Anything, mock.MatchedBy(func(input *rds.ModifyDBInstanceInput) bool {
+		return aws.ToBool(input.DeletionProtection) && input.AllocatedStorage == nil
+	})).Return(&rds.ModifyDBInstanceOutput{}, nil).Once()
+
+	instance := testDBInstance("")
+	instance.AllocatedStorage = 50
+	instance.DeletionProtection = true
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient})
+	results, err := bootstrapper.ManageRDSInstances(context.Background(), []bootstrap.RDSInstance{instance})
+	if err != nil {
+		t.Fatalf("Failed to reconcile RDS instance: %v", err)
+	}
+	if results[0].Action != bootstrap.ActionUpdated {
+		t.Errorf("Expected deletion protection to be updated, got %+v", results[0])
+	}
+	if len(results[0].Warnings) != 1 || !strings.Contains(results[0].Warnings[0].Message, "cannot modify storage") {
+		t.Errorf("Expected a warning about the storage change, got %v", results[0].Warnings)
+	}
+	mockRDSClient.AssertExpectations(t)
+}
+
+// TestRDSParameterGroupBatchesParameters tests that changed parameters are written at most
+// 20 per call, and that static parameters are set to apply at the next reboot with a warning
+func TestRDSParameterGroupBatchesParameters(t *testing.T) {
+	parameters := make(map[string]string)
+	var defaults []rdstypes.Parameter
+	for i := range 25 {
+		name := fmt.Sprintf("param_%02d", i)
+		parameters[name] = "on"
+		applyType := "dynamic"
+		if i == 0 {
+			applyType = "static"
+		}
+		defaults = append(defaults, rdstypes.Parameter{ParameterName: aws.String(name), ApplyType: aws.String(applyType)})
+	}
+
+	existing := existingDBInstance("available")
+	existing.DBInstances[0].DBParameterGroups = []rdstypes.DBParameterGroupStatus{{DBParameterGroupName: aws.String("dev-db-params")}}
+	mockRDSClient := new(MockRDSClient)
+	mockRDSClient.On("DescribeDBInstances", mock.Anything, mock.Anything).Return(existing, nil)
+	mockRDSClient.On("DescribeDBParameterGroups", mock.Anything, mock.Anything).Return(&rds.DescribeDBParameterGroupsOutput{
+		DBParameterGroups: []rdstypes.DBParameterGroup{{DBParameterGroupName: aws.String("dev-db-params"), DBParameterGroupFamily: aws.String("postgres16")}},
+	}, nil)
+	mockRDSClient.On("DescribeDBParameters", mock.Anything, mock.Anything).Return(&rds.DescribeDBParametersOutput{
+		Parameters: []rdstypes.Parameter{{ParameterName: aws.String("param_24"), ParameterValue: aws.String("on")}},
+	}, nil)
+	mockRDSClient.On("DescribeEngineDefaultParameters", mock.Anything, mock.Anything).Return(&rds.DescribeEngineDefaultParametersOutput{
+		EngineDefaults: &rdstypes.EngineDefaults{Parameters: defaults},
+	}, nil)
+	var batches [][]rdstypes.Parameter
+	mockRDSClient.On("ModifyDBParameterGroup", mock.Anything, mock.Anything).Return(&rds.ModifyDBParameterGroupOutput{}, nil).Run(func(args mock.Arguments) {
+		batches = append(batches, args.Get(1).(*rds.ModifyDBParameterGroupInput).Parameters)
+	})
+
+	instance := testDBInstance("")
+	instance.ParameterGroup = &bootstrap.RDSParameterGroup{Name: "dev-db-params", Family: "postgres16", Parameters: parameters}
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient})
+	results, err := bootstrapper.ManageRDSInstances(context.Background(), []bootstrap.RDSInstance{instance})
+	if err != nil {
+		t.Fatalf("Failed to reconcile RDS instance: %v", err)
+	}
+
+	// param_24 already has its value, so 24 parameters are written
+	if len(batches) != 2 || len(batches[0]) != 20 || len(batches[1]) != 4 {
+		t.Fatalf("Expected the 24 changed parameters in batches of 20 and 4, got %d batches", len(batches))
+	}
+	for _, parameter := range append(batches[0], batches[1]...) {
+		want := rdstypes.ApplyMethodImmediate
+		if aws.ToString(parameter.ParameterName) == "param_00" {
+			want = rdstypes.ApplyMethodPendingReboot
+		}
+		if parameter.ApplyMethod != want {
+			t.Errorf("Expected %s to apply %s, got %s", aws.ToString(parameter.ParameterName), want, parameter.ApplyMethod)
+		}
+	}
+	if results[0].Action != bootstrap.ActionUpdated || len(results[0].Warnings) != 1 ||
+		!strings.Contains(results[0].Warnings[0].Message, "parameters param_00 of DB parameter group dev-db-params only take effect after") {
+		t.Errorf("Expected a reboot warning for the static parameter, got %+v", results[0])
+	}
+}
+
+// TestRDSInstanceClassChange tests that a different instance class is applied to an
+// available instance, but not stacked on a class change that is still pending
+func TestRDSInstanceClassChange(t *testing.T) {
+	t.Run("applied", func(t *testing.T) {
+		mockRDSClient := new(MockRDSClient)
+		mockRDSClient.On("DescribeDBInstances", mock.Anything, mock.Anything).Return(existingDBInstance("available"), nil)
+		mockRDSClient.On("ModifyDBInstance", mock.Anything, mock.MatchedBy(func(input *rds.ModifyDBInstanceInput) bool {
+			return aws.ToString(input.DBInstanceClass) == "db.t3.medium"
+		})).Return(&rds.ModifyDBInstanceOutput{}, nil).Once()
+
+		instance := testDBInstance("")
+		instance.InstanceClass = "db.t3.medium"
+		bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient})
+		results, err := bootstrapper.ManageRDSInstances(context.Background(), []bootstrap.RDSInstance{instance})
+		if err != nil {
+			t.Fatalf("Failed to reconcile RDS instance: %v", err)
+		}
+		if results[0].Action != bootstrap.ActionUpdated {
+			t.Errorf("Expected the instance class to be changed, got %+v", results[0])
+		}
+		mockRDSClient.AssertExpectations(t)
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		existing := existingDBInstance("available")
+		existing.DBInstances[0].PendingModifiedValues = &rdstypes.PendingModifiedValues{DBInstanceClass: aws.String("db.t3.large")}
+		mockRDSClient := new(MockRDSClient)
+		mockRDSClient.On("DescribeDBInstances", mock.Anything, mock.Anything).Return(existing, nil)
+
+		instance := testDBInstance("")
+		instance.InstanceClass = "db.t3.medium"
+		bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient})
+		results, err := bootstrapper.ManageRDSInstances(context.Background(), []bootstrap.RDSInstance{instance})
+		if err != nil {
+			t.Fatalf("Failed to reconcile RDS instance: %v", err)
+		}
+		if len(results[0].Warnings) != 1 || !strings.Contains(results[0].Warnings[0].Message, "pending instance class change to db.t3.large") {
+			t.Errorf("Expected a warning about the pending change, got %v", results[0].Warnings)
+		}
+		mockRDSClient.AssertNotCalled(t, "ModifyDBInstance", mock.Anything, mock.Anything)
+	})
+}
+
+// TestRDSWaitReportsProgress tests that waiting for an instance draws a spinner line, and
+// that log records written during the wait erase it first so they start on a clean line
+func TestRDSWaitReportsProgress(t *testing.T) {
+	var terminal bytes.Buffer
+	spinner := bootstrap.NewProgress(&terminal, true)
+	logger, err := bootstrap.NewLogger(spinner, "text", slog.LevelInfo)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	bootstrap.SetProgress(spinner)
+	bootstrap.SetLogger(logger)
+	defer bootstrap.SetProgress(bootstrap.NewProgress(os.Stderr, false))
+	defer bootstrap.SetLogger(slog.Default())
+
+	instance := existingDBInstance("available")
+	mockRDSClient := new(MockRDSClient)
+	mockRDSClient.On("DescribeDBInstances", mock.Anything, mock.Anything).Return(instance, nil)
+	mockRDSClient.On("StopDBInstance", mock.Anything, mock.Anything).Return(&rds.StopDBInstanceOutput{}, nil).Run(func(mock.Arguments) {
+		instance.DBInstances[0].DBInstanceStatus = aws.String("stopped")
+	})
+
+	dbInstance := testDBInstance("stopped")
+	dbInstance.WaitForAvailable = true
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient})
+	if _, err := bootstrapper.ManageRDSInstances(context.Background(), []bootstrap.RDSInstance{dbInstance}); err != nil {
+		t.Fatalf("Failed to stop RDS instance: %v", err)
+	}
+
+	output := terminal.String()
+	if !strings.Contains(output, "RDS dev-db: waiting (0s)") {
+		t.Errorf("Expected a spinner line for the wait, got %q", output)
+	}
+	if !strings.Contains(output, "\r\033[Ktime=") {
+		t.Errorf("Expected the spinner line to be erased before a log record, got %q", output)
+	}
+	if !strings.HasSuffix(output, "\r\033[K") {
+		t.Errorf("Expected the spinner line to be erased when the wait ends, got %q", output)
+	}
+	mockRDSClient.AssertExpectations(t)
+}
+
+// TestPlanRDSInstances tests that the dry-run plan shows the old and new value of every
+// attribute that differs, and that a missing instance would be created
+func TestPlanRDSInstances(t *testing.T) {
+	mockRDSClient := new(MockRDSClient)
+	existing := existingDBInstance("available")
+	existing.DBInstances[0].EngineVersion = aws.String("15.4")
+	existing.DBInstances[0].BackupRetentionPeriod = aws.Int32(1)
+	mockRDSClient.On("DescribeDBInstances", mock.Anything, mock.MatchedBy(func(input *rds.DescribeDBInstancesInput) bool {
+		return aws.ToString(input.DBInstanceIdentifier) == "dev-db"
+	})).Return(existing, nil)
+	mockRDSClient.On("DescribeDBInstances", mock.Anything, mock.MatchedBy(func(input *rds.DescribeDBInstancesInput) bool {
+		return aws.ToString(input.DBInstanceIdentifier) == "new-db"
+	})).Return((*rds.DescribeDBInstancesOutput)(nil), &rdstypes.DBInstanceNotFoundFault{})
+
+	instance := testDBInstance("")
+	instance.InstanceClass = "db.t3.small"
+	instance.AllocatedStorage = 50
+	instance.EngineVersion = "16.1"
+	instance.MultiAZ = true
+	instance.BackupRetentionPeriod = 7
+	created := testDBInstance("")
+	created.Identifier = "new-db"
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient})
+	plans, err := bootstrapper.PlanRDSInstances(context.Background(), &bootstrap.Config{
+		Region:       "us-west-2",
+		RDSInstances: []bootstrap.RDSInstance{instance, created},
+	})
+	if err != nil {
+		t.Fatalf("Failed to plan RDS instances: %v", err)
+	}
+	if len(plans) != 2 {
+		t.Fatalf("Expected 2 plans, got %d", len(plans))
+	}
+
+	if plans[0].Action != bootstrap.PlanUpdate {
+		t.Errorf("Expected dev-db to be updated, got %s", plans[0].Action)
+	}
+	changes := strings.Join(plans[0].Changes, "\n")
+	for _, want := range []string{
+		"allocated_storage: 20 GB -> 50 GB",
+		"instance_class: db.t3.micro -> db.t3.small",
+		"engine_version: 15.4 -> 16.1",
+		"multi_az: false -> true",
+		"backup_retention_period: 1 day(s) -> 7 day(s)",
+	} {
+		if !strings.Contains(changes, want) {
+			t.Errorf("Expected change %q, got:\n%s", want, changes)
+		}
+	}
+
+	if plans[1].Action != bootstrap.PlanCreate {
+		t.Errorf("Expected new-db to be created, got %s", plans[1].Action)
+	}
+	mockRDSClient.AssertNotCalled(t, "ModifyDBInstance", mock.Anything, mock.Anything)
+}
+
+// TestRDSInstanceIfNotExists tests that an existing instance with if_not_exists is neither
+// modified nor stopped, and that the plan shows no changes for it
+func TestRDSInstanceIfNotExists(t *testing.T) {
+	mockRDSClient := new(MockRDSClient)
+	mockRDSClient.On("DescribeDBInstances", mock.Anything, mock.Anything).Return(existingDBInstance("available"), nil)
+
+	instance := testDBInstance("stopped")
+	instance.AllocatedStorage = 50
+	instance.InstanceClass = "db.t3.small"
+	instance.IfNotExists = true
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient})
+	results, err := bootstrapper.ManageRDSInstances(context.Background(), []bootstrap.RDSInstance{instance})
+	if err != nil {
+		t.Fatalf("Failed to manage RDS instance: %v", err)
+	}
+	if results[0].Action != bootstrap.ActionUnchanged {
+		t.Errorf("Expected the instance to be unchanged, got %s", results[0].Action)
+	}
+	mockRDSClient.AssertNotCalled(t, "ModifyDBInstance", mock.Anything, mock.Anything)
+	mockRDSClient.AssertNotCalled(t, "StopDBInstance", mock.Anything, mock.Anything)
+	mockRDSClient.AssertNotCalled(t, "AddTagsToResource", mock.Anything, mock.Anything)
+
+	plans, err := bootstrapper.PlanRDSInstances(context.Background(), &bootstrap.Config{
+		Region:       "us-west-2",
+		RDSInstances: []bootstrap.RDSInstance{instance},
+	})
+	if err != nil {
+		t.Fatalf("Failed to plan RDS instance: %v", err)
+	}
+	if plans[0].Action != bootstrap.PlanNoOp || len(plans[0].Changes) != 0 {
+		t.Errorf("Expected no changes in the plan, got %s %v", plans[0].Action, plans[0].Changes)
+	}
+}
+
+// TestRollbackRemovesDeletionProtection tests that rolling back an instance created with
+// deletion_protection turns the protection off before deleting it
+func TestRollbackRemovesDeletionProtection(t *testing.T) {
+	forInstance := func(id string) any {
+		return mock.MatchedBy(func(input any) bool {
+			switch in := input.(type) {
+			case *rds.DescribeDBInstancesInput:
+				return aws.ToString(in.DBInstanceIdentifier) == id
+			case *rds.CreateDBInstanceInput:
+				return aws.ToString(in.DBInstanceIdentifier) == id
+			}
+			return false
+		})
+	}
+
+	// dev-db is created; broken-db fails to create and stops the run
+	mockRDSClient := new(MockRDSClient)
+	mockRDSClient.On("DescribeDBInstances", mock.Anything, mock.Anything).Return((*rds.DescribeDBInstancesOutput)(nil), &rdstypes.DBInstanceNotFoundFault{})
+	mockRDSClient.On("CreateDBInstance", mock.Anything, forInstance("dev-db")).Return(&rds.CreateDBInstanceOutput{DBInstance: &rdstypes.DBInstance{
+		DBInstanceArn: aws.String("arn:aws:rds:us-west-2:123456789012:db:dev-db"),
+	}}, nil)
+	mockRDSClient.On("CreateDBInstance", mock.Anything, forInstance("broken-db")).Return((*rds.CreateDBInstanceOutput)(nil), errors.New("StorageQuotaExceeded"))
+
+	// Rollback turns deletion protection off, then deletes dev-db without a snapshot
+	mockRDSClient.On("ModifyDBInstance", mock.Anything, mock.MatchedBy(func(input *rds.ModifyDBInstanceInput) bool {
+		return aws.ToString(input.DBInstanceIdentifier) == "dev-db" && input.DeletionProtection != nil && !*input.DeletionProtection
+	})).Return(&rds.ModifyDBInstanceOutput{}, nil)
+	mockRDSClient.On("DeleteDBInstance", mock.Anything, mock.MatchedBy(func(input *rds.DeleteDBInstanceInput) bool {
+		return aws.ToString(input.DBInstanceIdentifier) == "dev-db" && aws.ToBool(input.SkipFinalSnapshot)
+	})).Return(&rds.DeleteDBInstanceOutput{}, nil)
+
+	protected := testDBInstance("")
+	protected.MasterPassword = "correct-horse-battery"
+	protected.DeletionProtection = true
+	broken := testDBInstance("")
+	broken.Identifier = "broken-db"
+	broken.MasterPassword = "correct-horse-battery"
+	config := &bootstrap.Config{Region: "us-west-2", RDSInstances: []bootstrap.RDSInstance{protected, broken}}
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{RDS: mockRDSClient})
+	result, err := bootstrapper.ProvisionResources(context.Background(), config)
+	if err == nil {
+		t.Fatal("Expected provisioning to fail")
+	}
+
+	rolledBack, err := bootstrapper.Rollback(context.Background(), result, config)
+	if err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if len(rolledBack.RDSInstances) != 1 || rolledBack.RDSInstances[0].Identifier != "dev-db" {
+		t.Errorf("Expected only dev-db to be rolled back, got %+v", rolledBack.RDSInstances)
+	}
+	mockRDSClient.AssertExpectations(t)
+}
@@ -0,0 +1,111 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
+)
+
+// MockRoute53Client is a mock implementation of the Route53 client
+type MockRoute53Client struct {
+	mock.Mock
+}
+
+func (m *MockRoute53Client) ListHostedZonesByName(ctx context.Context, params *route53.ListHostedZonesByNameInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesByNameOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*route53.ListHostedZonesByNameOutput), args.Error(1)
+}
+
+func (m *MockRoute53Client) CreateHostedZone(ctx context.Context, params *route53.CreateHostedZoneInput, optFns ...func(*route53.Options)) (*route53.CreateHostedZoneOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*route53.CreateHostedZoneOutput), args.Error(1)
+}
+
+func (m *MockRoute53Client) ChangeResourceRecordSets(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*route53.ChangeResourceRecordSetsOutput), args.Error(1)
+}
+
+// TestHostedZoneReusesExistingZone tests that an existing public zone is reused instead of
+// creating a duplicate, and that records are upserted with aliases resolved
+func TestHostedZoneReusesExistingZone(t *testing.T) {
+	mockRoute53Client := new(MockRoute53Client)
+	mockRoute53Client.On("ListHostedZonesByName", mock.Anything, mock.Anything).Return(&route53.ListHostedZonesByNameOutput{
+		HostedZones: []types.HostedZone{
+			{Id: aws.String("/hostedzone/ZPRIVATE"), Name: aws.String("example.com."), Config: &types.HostedZoneConfig{PrivateZone: true}},
+			{Id: aws.String("/hostedzone/ZPUBLIC"), Name: aws.String("example.com."), Config: &types.HostedZoneConfig{}},
+			{Id: aws.String("/hostedzone/ZOTHER"), Name: aws.String("example.net."), Config: &types.HostedZoneConfig{}},
+		},
+	}, nil)
+	mockRoute53Client.On("ChangeResourceRecordSets", mock.Anything, mock.MatchedBy(func(input *route53.ChangeResourceRecordSetsInput) bool {
+		if aws.ToString(input.HostedZoneId) != "ZPUBLIC" || len(input.ChangeBatch.Changes) != 3 {
+			return false
+		}
+		for _, change := range input.ChangeBatch.Changes {
+			if change.Action != types.ChangeActionUpsert {
+				return false
+			}
+		}
+		www := input.ChangeBatch.Changes[0].ResourceRecordSet
+		txt := input.ChangeBatch.Changes[1].ResourceRecordSet
+		static := input.ChangeBatch.Changes[2].ResourceRecordSet
+		return aws.ToString(www.Name) == "www.example.com." && aws.ToInt64(www.TTL) == 300 &&
+			aws.ToString(txt.Name) == "example.com." && aws.ToString(txt.ResourceRecords[0].Value) == `"v=spf1 -all"` &&
+			aws.ToString(static.AliasTarget.DNSName) == "s3-website-us-west-2.amazonaws.com" &&
+			aws.ToString(static.AliasTarget.HostedZoneId) == "Z3BJ6K6RIION7M"
+	})).Return(&route53.ChangeResourceRecordSetsOutput{}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{Route53: mockRoute53Client})
+	results, err := bootstrapper.CreateHostedZones(context.Background(), []bootstrap.HostedZone{
+		{Name: "example.com", Records: []bootstrap.DNSRecord{
+			{Name: "www", Type: "CNAME", Values: []string{"example.com"}},
+			{Type: "TXT", Values: []string{"v=spf1 -all"}},
+			{Name: "static.example.com", Type: "A", Alias: &bootstrap.DNSAlias{S3Website: "static.example.com"}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to reconcile hosted zone: %v", err)
+	}
+
+	if results[0].Action != bootstrap.ActionUpdated || results[0].ARN != "arn:aws:route53:::hostedzone/ZPUBLIC" {
+		t.Errorf("Expected existing zone ZPUBLIC to be updated, got %+v", results[0])
+	}
+	mockRoute53Client.AssertNotCalled(t, "CreateHostedZone", mock.Anything, mock.Anything)
+	mockRoute53Client.AssertExpectations(t)
+}
+
+// TestHostedZoneCreatesPrivateZone tests that a private zone is created with its VPC when
+// only a public zone of the same name exists
+func TestHostedZoneCreatesPrivateZone(t *testing.T) {
+	mockRoute53Client := new(MockRoute53Client)
+	mockRoute53Client.On("ListHostedZonesByName", mock.Anything, mock.Anything).Return(&route53.ListHostedZonesByNameOutput{
+		HostedZones: []types.HostedZone{
+			{Id: aws.String("/hostedzone/ZPUBLIC"), Name: aws.String("internal.example.com."), Config: &types.HostedZoneConfig{}},
+		},
+	}, nil)
+	mockRoute53Client.On("CreateHostedZone", mock.Anything, mock.MatchedBy(func(input *route53.CreateHostedZoneInput) bool {
+		return input.HostedZoneConfig.PrivateZone && aws.ToString(input.VPC.VPCId) == "vpc-123" &&
+			input.VPC.VPCRegion == types.VPCRegionUsWest2 && aws.ToString(input.CallerReference) != ""
+	})).Return(&route53.CreateHostedZoneOutput{
+		HostedZone: &types.HostedZone{Id: aws.String("/hostedzone/ZNEW")},
+	}, nil)
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{Route53: mockRoute53Client})
+	results, err := bootstrapper.CreateHostedZones(context.Background(), []bootstrap.HostedZone{
+		{Name: "internal.example.com", Private: true, VPCID: "vpc-123"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create hosted zone: %v", err)
+	}
+
+	if results[0].Action != bootstrap.ActionCreated || results[0].ARN != "arn:aws:route53:::hostedzone/ZNEW" {
+		t.Errorf("Expected zone ZNEW to be created, got %+v", results[0])
+	}
+	mockRoute53Client.AssertNotCalled(t, "ChangeResourceRecordSets", mock.Anything, mock.Anything)
+	mockRoute53Client.AssertExpectations(t)
+}
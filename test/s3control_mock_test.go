@@ -0,0 +1,139 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/mock"
+	"github.com/tendant/cloud-bootstrap/pkg/bootstrap"
+)
+
+// MockS3ControlClient is a mock implementation of the S3 Control client
+type MockS3ControlClient struct {
+	mock.Mock
+}
+
+func (m *MockS3ControlClient) ListAccessPoints(ctx context.Context, params *s3control.ListAccessPointsInput, optFns ...func(*s3control.Options)) (*s3control.ListAccessPointsOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3control.ListAccessPointsOutput), args.Error(1)
+}
+
+func (m *MockS3ControlClient) CreateAccessPoint(ctx context.Context, params *s3control.CreateAccessPointInput, optFns ...func(*s3control.Options)) (*s3control.CreateAccessPointOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3control.CreateAccessPointOutput), args.Error(1)
+}
+
+func (m *MockS3ControlClient) GetAccessPointPolicy(ctx context.Context, params *s3control.GetAccessPointPolicyInput, optFns ...func(*s3control.Options)) (*s3control.GetAccessPointPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3control.GetAccessPointPolicyOutput), args.Error(1)
+}
+
+func (m *MockS3ControlClient) PutAccessPointPolicy(ctx context.Context, params *s3control.PutAccessPointPolicyInput, optFns ...func(*s3control.Options)) (*s3control.PutAccessPointPolicyOutput, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(*s3control.PutAccessPointPolicyOutput), args.Error(1)
+}
+
+const testAccessPointPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:role/tenant"},"Action":"s3:GetObject","Resource":"arn:aws:s3:us-west-2:123456789012:accesspoint/tenant-a/object/*"}]}`
+
+// TestS3BucketAccessPoints tests that missing access points are created in the account of
+// the clients, that the policy of an existing one is only written when it differs, and that
+// the ARNs and aliases are recorded in the result
+func TestS3BucketAccessPoints(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+
+	mockControlClient := new(MockS3ControlClient)
+	mockControlClient.On("ListAccessPoints", mock.Anything, mock.MatchedBy(func(input *s3control.ListAccessPointsInput) bool {
+		return aws.ToString(input.AccountId) == "123456789012" && aws.ToString(input.Bucket) == "shared-data"
+	})).Return(&s3control.ListAccessPointsOutput{
+		AccessPointList: []controltypes.AccessPoint{{
+			Name:           aws.String("tenant-a"),
+			NetworkOrigin:  controltypes.NetworkOriginInternet,
+			AccessPointArn: aws.String("arn:aws:s3:us-west-2:123456789012:accesspoint/tenant-a"),
+			Alias:          aws.String("tenant-a-abc123-s3alias"),
+		}},
+	}, nil)
+	mockControlClient.On("GetAccessPointPolicy", mock.Anything, mock.MatchedBy(func(input *s3control.GetAccessPointPolicyInput) bool {
+		return aws.ToString(input.Name) == "tenant-a"
+	})).Return(&s3control.GetAccessPointPolicyOutput{Policy: aws.String(testAccessPointPolicy)}, nil)
+	mockControlClient.On("CreateAccessPoint", mock.Anything, mock.MatchedBy(func(input *s3control.CreateAccessPointInput) bool {
+		return aws.ToString(input.Name) == "tenant-b" && aws.ToString(input.VpcConfiguration.VpcId) == "vpc-0123456789abcdef0"
+	})).Return(&s3control.CreateAccessPointOutput{
+		AccessPointArn: aws.String("arn:aws:s3:us-west-2:123456789012:accesspoint/tenant-b"),
+		Alias:          aws.String("tenant-b-def456-s3alias"),
+	}, nil).Once()
+	mockControlClient.On("PutAccessPointPolicy", mock.Anything, mock.MatchedBy(func(input *s3control.PutAccessPointPolicyInput) bool {
+		return aws.ToString(input.Name) == "tenant-b"
+	})).Return(&s3control.PutAccessPointPolicyOutput{}, nil).Once()
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{
+		S3: mockS3Client, S3Control: mockControlClient, Account: "123456789012",
+	})
+	results, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{{
+		Name: "shared-data",
+		AccessPoints: []bootstrap.S3AccessPoint{
+			{Name: "tenant-a", Policy: testAccessPointPolicy},
+			{Name: "tenant-b", VPCID: "vpc-0123456789abcdef0", Policy: strings.ReplaceAll(testAccessPointPolicy, "tenant-a", "tenant-b")},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to reconcile bucket: %v", err)
+	}
+
+	accessPoints := results[0].AccessPoints
+	if len(accessPoints) != 2 || accessPoints[0].Alias != "tenant-a-abc123-s3alias" ||
+		accessPoints[1].ARN != "arn:aws:s3:us-west-2:123456789012:accesspoint/tenant-b" {
+		t.Errorf("Expected both access points in the result, got %+v", accessPoints)
+	}
+	if results[0].Action != bootstrap.ActionUpdated || len(results[0].Warnings) != 0 {
+		t.Errorf("Expected bucket to be updated without warnings, got %+v", results[0])
+	}
+	mockControlClient.AssertNotCalled(t, "PutAccessPointPolicy", mock.Anything, mock.MatchedBy(func(input *s3control.PutAccessPointPolicyInput) bool {
+		return aws.ToString(input.Name) == "tenant-a"
+	}))
+	mockControlClient.AssertExpectations(t)
+}
+
+// TestS3BucketAccessPointNetworkOriginWarning tests that an access point whose network origin
+// differs from the configuration is reported, since it cannot be changed in place
+func TestS3BucketAccessPointNetworkOriginWarning(t *testing.T) {
+	mockS3Client := new(MockS3Client)
+	mockS3Client.On("HeadBucket", mock.Anything, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+	mockS3Client.On("GetBucketLocation", mock.Anything, mock.Anything).Return(&s3.GetBucketLocationOutput{
+		LocationConstraint: types.BucketLocationConstraintUsWest2,
+	}, nil)
+
+	mockControlClient := new(MockS3ControlClient)
+	mockControlClient.On("ListAccessPoints", mock.Anything, mock.Anything).Return(&s3control.ListAccessPointsOutput{
+		AccessPointList: []controltypes.AccessPoint{{Name: aws.String("tenant-a"), NetworkOrigin: controltypes.NetworkOriginInternet}},
+	}, nil)
+	mockControlClient.On("GetAccessPointPolicy", mock.Anything, mock.Anything).Return((*s3control.GetAccessPointPolicyOutput)(nil),
+		&smithy.GenericAPIError{Code: "NoSuchAccessPointPolicy"})
+	mockControlClient.On("PutAccessPointPolicy", mock.Anything, mock.Anything).Return(&s3control.PutAccessPointPolicyOutput{}, nil).Once()
+
+	bootstrapper := bootstrap.NewBootstrapperWithClients("us-west-2", bootstrap.Clients{
+		S3: mockS3Client, S3Control: mockControlClient, Account: "123456789012",
+	})
+	results, err := bootstrapper.CreateS3Buckets(context.Background(), []bootstrap.S3Bucket{{
+		Name:         "shared-data",
+		AccessPoints: []bootstrap.S3AccessPoint{{Name: "tenant-a", VPCID: "vpc-0123456789abcdef0", Policy: testAccessPointPolicy}},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to reconcile bucket: %v", err)
+	}
+
+	if len(results[0].Warnings) != 1 || !strings.Contains(results[0].Warnings[0].Message, "has network origin internet, but VPC vpc-0123456789abcdef0 is configured") {
+		t.Errorf("Expected a network origin warning, got %v", results[0].Warnings)
+	}
+	mockControlClient.AssertExpectations(t)
+}